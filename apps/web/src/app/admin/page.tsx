@@ -253,7 +253,8 @@ export default async function AdminSurfacePage({ searchParams }: AdminSurfacePag
                         {adminOverview.disputes.pending_total}
                       </p>
                       <p className="mt-1 text-xs text-muted">
-                        Total {adminOverview.disputes.refund_requests_total}
+                        Total {adminOverview.disputes.refund_requests_total} · Chargebacks{" "}
+                        {adminOverview.disputes.chargebacks_open}
                       </p>
                     </div>
                   </div>
@@ -1,6 +1,9 @@
 export const roleList = [
   "buyer",
   "vendor_owner",
+  "vendor_catalog_manager",
+  "vendor_fulfilment",
+  "vendor_finance",
   "super_admin",
   "support",
   "finance",
@@ -21,7 +24,188 @@ export interface AuthResponse {
     email: string;
     role: string;
     vendor_id: string | null;
+    email_verified: boolean;
+    mfa_enabled: boolean;
   };
+  mfa_enrollment_required?: boolean;
+}
+
+// Returned by POST /auth/login for users with MFA; complete the login on
+// POST /auth/mfa/verify.
+export interface MFAChallengeResponse {
+  mfa_required: true;
+  mfa_token: string;
+  mfa_expires_at: string;
+}
+
+export interface MFAVerifyRequest {
+  mfa_token: string;
+  code: string;
+}
+
+export interface MFAStatusResponse {
+  enabled: boolean;
+  enabled_at?: string;
+  required: boolean;
+  session_verified: boolean;
+  recovery_codes_remaining: number;
+}
+
+export interface MFAEnrollResponse {
+  secret: string;
+  provisioning_uri: string;
+}
+
+export interface MFAEnrollConfirmResponse extends AuthResponse {
+  recovery_codes: string[];
+}
+
+export interface OIDCAuthorization {
+  provider: string;
+  authorization_url: string;
+  state: string;
+  expires_at: string;
+}
+
+export interface OIDCCallbackRequest {
+  state: string;
+  code: string;
+}
+
+export interface ExternalIdentity {
+  provider: string;
+  subject: string;
+  email?: string;
+  linked_at: string;
+}
+
+export interface ExternalIdentitiesResponse {
+  identities: ExternalIdentity[];
+  has_password: boolean;
+}
+
+export interface AuthSession {
+  id: string;
+  device: string;
+  ip?: string;
+  user_agent?: string;
+  mfa_verified: boolean;
+  current: boolean;
+  created_at: string;
+  last_used_at: string;
+  expires_at: string;
+}
+
+export interface AuthSessionsResponse {
+  items: AuthSession[];
+}
+
+export type VendorTeamRole = "owner" | "catalog_manager" | "fulfilment" | "finance";
+
+export interface VendorTeamMember {
+  user_id: string;
+  email: string;
+  role: VendorTeamRole;
+  primary_owner: boolean;
+  invited_by?: string;
+  joined_at: string;
+}
+
+export interface VendorTeamInvitation {
+  id: string;
+  vendor_id: string;
+  email: string;
+  role: VendorTeamRole;
+  invited_by: string;
+  created_at: string;
+  expires_at: string;
+  accepted_at?: string;
+}
+
+export interface VendorTeamResponse {
+  vendor_id: string;
+  members: VendorTeamMember[];
+  invitations: VendorTeamInvitation[];
+}
+
+export interface VendorTeamInviteRequest {
+  email: string;
+  role: VendorTeamRole;
+}
+
+export interface MFAPolicy {
+  // Built-in roles or custom roles from /admin/roles.
+  required_roles: string[];
+}
+
+export interface RoleDefinition {
+  name: string;
+  description?: string;
+  permissions: string[];
+  built_in: boolean;
+  created_at?: string;
+  updated_at?: string;
+}
+
+export interface RoleListResponse {
+  items: RoleDefinition[];
+  permissions: string[];
+}
+
+export interface RoleRequest {
+  name?: string;
+  description?: string;
+  permissions: string[];
+}
+
+export interface Impersonation {
+  id: string;
+  impersonator_id: string;
+  subject_id: string;
+  reason: string;
+  elevated: boolean;
+  started_at: string;
+  expires_at: string;
+  ended_at?: string;
+}
+
+export interface ImpersonationStartRequest {
+  user_id: string;
+  reason: string;
+  elevated?: boolean;
+}
+
+// The token is read-only unless elevated and cannot be refreshed.
+export interface ImpersonationStartResponse {
+  access_token: string;
+  expires_at: string;
+  impersonation: Impersonation;
+  user: AuthResponse["user"];
+}
+
+export interface RoleDetailResponse extends RoleDefinition {
+  users: Array<{ id: string; email: string; role: string }>;
+}
+
+// Returned by POST /auth/register instead of tokens when the API requires a
+// verified email before login.
+export interface AuthVerificationRequiredResponse {
+  user: AuthResponse["user"];
+  verification_required: true;
+}
+
+export interface AccountEmailRequest {
+  email: string;
+}
+
+export interface AccountTokenRequest {
+  token: string;
+  password?: string;
+}
+
+export interface PasswordResetResponse {
+  status: "password_reset";
+  revoked_sessions: number;
 }
 
 export interface VendorProfile {
@@ -31,10 +215,23 @@ export interface VendorProfile {
   display_name: string;
   verification_state: "pending" | "verified" | "rejected" | "suspended";
   commission_override_bps: number | null;
+  stripe_account_id?: string;
+  payouts_enabled: boolean;
+  legal_details?: VendorLegalDetails;
   created_at: string;
   updated_at: string;
 }
 
+export interface VendorLegalDetails {
+  legal_name: string;
+  tax_id?: string;
+  address: string;
+  email?: string;
+  country_code?: string;
+  invoice_locale?: InvoiceLocale;
+  invoice_footer?: string;
+}
+
 export interface AdminVendorListResponse {
   items: VendorProfile[];
   total: number;
@@ -72,6 +269,9 @@ export interface AuditLogEntry {
   before_json?: Record<string, unknown>;
   after_json?: Record<string, unknown>;
   metadata_json?: Record<string, unknown>;
+  // Set on actions staff took while impersonating a user.
+  impersonation_id?: string;
+  on_behalf_of?: string;
   created_at: string;
 }
 
@@ -86,6 +286,7 @@ export interface AdminDashboardOrderVolumes {
   cod_confirmed: number;
   paid: number;
   payment_failed: number;
+  expired: number;
 }
 
 export interface AdminDashboardVendorMetrics {
@@ -107,6 +308,10 @@ export interface AdminDashboardDisputeMetrics {
   pending_total: number;
   approved_total: number;
   rejected_total: number;
+  chargebacks_total: number;
+  chargebacks_open: number;
+  chargebacks_won: number;
+  chargebacks_lost: number;
 }
 
 export interface AdminDashboardOverviewResponse {
@@ -117,6 +322,7 @@ export interface AdminDashboardOverviewResponse {
   vendor_metrics: AdminDashboardVendorMetrics;
   moderation_queue: AdminDashboardModerationQueueMetrics;
   disputes: AdminDashboardDisputeMetrics;
+  unconverted_order_count: number;
   generated_at: string;
 }
 
@@ -139,6 +345,7 @@ export interface AdminAnalyticsRevenueResponse {
   window_days: number;
   summary: AdminAnalyticsRevenueSummary;
   points: AdminAnalyticsRevenuePoint[];
+  unconverted_order_count: number;
 }
 
 export interface AdminVendorAnalyticsItem {
@@ -165,6 +372,7 @@ export interface AdminVendorAnalyticsItem {
 }
 
 export interface AdminAnalyticsVendorsResponse {
+  currency: string;
   items: AdminVendorAnalyticsItem[];
   total: number;
   limit: number;
@@ -182,6 +390,9 @@ export interface VendorProduct {
   price_incl_tax_cents: number;
   currency: string;
   stock_qty: number;
+  backorder_limit?: number;
+  preorder?: boolean;
+  expected_ship_date?: string;
   rating_average: number;
   status: "draft" | "pending_approval" | "approved" | "rejected";
   moderation_reason?: string;
@@ -248,8 +459,14 @@ export interface CatalogProduct {
   price_incl_tax_cents: number;
   currency: string;
   stock_qty: number;
+  backorder_limit?: number;
+  preorder?: boolean;
+  expected_ship_date?: string;
   rating_average: number;
   created_at: string;
+  display_price_incl_tax_cents?: number;
+  display_currency?: string;
+  display_fx_rate?: string;
 }
 
 export interface CatalogListResponse {
@@ -279,11 +496,14 @@ export interface CatalogSearchParams {
   price_min?: number;
   price_max?: number;
   min_rating?: number;
+  currency?: string;
   sort?: "relevance" | "newest" | "price_low_high" | "price_high_low" | "rating";
   limit?: number;
   offset?: number;
 }
 
+export type FulfillmentType = "backorder" | "preorder";
+
 export interface CartItem {
   id: string;
   product_id: string;
@@ -293,7 +513,14 @@ export interface CartItem {
   unit_price_cents: number;
   line_total_cents: number;
   currency: string;
+  list_unit_price_cents?: number;
+  list_currency?: string;
+  fx_rate?: string;
   available_stock: number;
+  backorder_limit?: number;
+  fulfillment?: FulfillmentType;
+  backordered_qty?: number;
+  expected_ship_date?: string;
   last_updated_unix: number;
 }
 
@@ -307,12 +534,25 @@ export interface CartResponse {
   guest_token?: string;
 }
 
+export interface CartCurrencyRequest {
+  currency: string;
+}
+
+export interface FXRateSnapshot {
+  from_currency: string;
+  to_currency: string;
+  rate: string;
+  captured_at: string;
+}
+
 export interface QuoteShipment {
   vendor_id: string;
   item_count: number;
   subtotal_cents: number;
   shipping_fee_cents: number;
   total_cents: number;
+  on_hold?: boolean;
+  expected_ship_date?: string;
   items: CartItem[];
 }
 
@@ -324,6 +564,8 @@ export interface CheckoutQuoteResponse {
   shipping_cents: number;
   total_cents: number;
   shipments: QuoteShipment[];
+  fx_rates?: FXRateSnapshot[];
+  expected_ship_date?: string;
   guest_token?: string;
 }
 
@@ -335,6 +577,9 @@ export interface OrderShipment {
   subtotal_cents: number;
   shipping_fee_cents: number;
   total_cents: number;
+  carrier_code?: string;
+  tracking_number?: string;
+  expected_ship_date?: string;
 }
 
 export interface OrderItem {
@@ -347,15 +592,27 @@ export interface OrderItem {
   unit_price_cents: number;
   line_total_cents: number;
   currency: string;
+  list_unit_price_cents?: number;
+  list_currency?: string;
+  fx_rate?: string;
+  fulfillment?: FulfillmentType;
+  backordered_qty?: number;
+  expected_ship_date?: string;
+  stock_allocated_at?: string;
 }
 
-export type VendorShipmentStatus = "pending" | "packed" | "shipped" | "delivered" | "cancelled";
+export type VendorShipmentStatus = "on_hold" | "pending" | "packed" | "shipped" | "delivered" | "cancelled";
 
 export interface VendorShipmentStatusEvent {
   shipment_id: string;
   vendor_id: string;
   status: VendorShipmentStatus;
   actor_user_id?: string;
+  carrier_code?: string;
+  tracking_number?: string;
+  carrier_status?: string;
+  location?: string;
+  description?: string;
   at: string;
 }
 
@@ -370,6 +627,9 @@ export interface VendorShipment {
   shipping_fee_cents: number;
   total_cents: number;
   currency: string;
+  carrier_code?: string;
+  tracking_number?: string;
+  expected_ship_date?: string;
   items: OrderItem[];
   created_at: string;
   updated_at: string;
@@ -495,6 +755,8 @@ export interface Order {
   idempotency_key: string;
   shipments: OrderShipment[];
   items: OrderItem[];
+  fx_rates?: FXRateSnapshot[];
+  expected_ship_date?: string;
   created_at: string;
 }
 
@@ -503,7 +765,7 @@ export interface OrderResponse {
   guest_token?: string;
 }
 
-export type OrderStatus = "pending_payment" | "cod_confirmed" | "paid" | "payment_failed";
+export type OrderStatus = "pending_payment" | "cod_confirmed" | "paid" | "payment_failed" | "expired";
 
 export interface AdminOrderListResponse {
   items: Order[];
@@ -512,30 +774,330 @@ export interface AdminOrderListResponse {
   offset: number;
 }
 
+export type StripePaymentStatus =
+  | "pending"
+  | "requires_action"
+  | "processing"
+  | "authorized"
+  | "partially_captured"
+  | "succeeded"
+  | "failed"
+  | "cancelled";
+
+export type PaymentAttention =
+  | "authorization_expiring"
+  | "authorization_expired"
+  | "capture_failed"
+  | "transfer_failed";
+
+export interface TransferReversal {
+  reference: string;
+  reversal_ref?: string;
+  amount_cents: number;
+  reversed_at: string;
+}
+
+export interface PayoutHold {
+  reference: string;
+  status: "held" | "released" | "forfeited";
+  amount_cents: number;
+  reversal_ref?: string;
+  release_ref?: string;
+  held_at: string;
+  closed_at?: string;
+}
+
+export interface VendorTransfer {
+  order_id: string;
+  shipment_id: string;
+  vendor_id: string;
+  destination: string;
+  transfer_ref?: string;
+  status: "pending" | "paid" | "failed" | "reversed";
+  amount_cents: number;
+  application_fee_cents: number;
+  reversed_cents: number;
+  reversals: TransferReversal[];
+  held_cents: number;
+  holds: PayoutHold[];
+  cod_offset_cents: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface VendorPayoutListResponse {
+  items: VendorTransfer[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export interface VendorConnectOnboardingResponse {
+  stripe_account_id: string;
+  onboarding_url: string;
+  payouts_enabled: boolean;
+}
+
+export interface VendorConnectStatusResponse {
+  stripe_account_id: string;
+  details_submitted: boolean;
+  charges_enabled: boolean;
+  payouts_enabled: boolean;
+}
+
+export interface PaymentCapture {
+  shipment_id: string;
+  amount_cents: number;
+  final: boolean;
+  captured_at: string;
+}
+
+export interface PaymentRelease {
+  shipment_id: string;
+  amount_cents: number;
+  released_at: string;
+}
+
 export interface StripeIntentResponse {
   id: string;
   order_id: string;
   method: "stripe";
-  status: "pending" | "succeeded" | "failed";
+  status: StripePaymentStatus;
   provider: "stripe";
   provider_ref: string;
   client_secret: string;
   amount_cents: number;
   currency: string;
+  capture_method: "manual";
+  captured_cents: number;
+  captures: PaymentCapture[];
+  released_cents: number;
+  releases: PaymentRelease[];
+  authorized_at?: string;
+  authorization_expires_at?: string;
+  reauthorizations: number;
+  transfers: VendorTransfer[];
+  attention?: PaymentAttention;
+  created_at: string;
+  updated_at: string;
+  guest_token?: string;
+}
+
+export interface AdminPaymentAuthorizationListResponse {
+  items: StripeIntentResponse[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export type PaymentWebhookEventStatus = "received" | "processed" | "ignored" | "failed" | "dead_letter";
+
+export interface PaymentWebhookEvent {
+  id: string;
+  provider: string;
+  provider_event_id: string;
+  event_type: string;
+  provider_ref?: string;
+  payload: string;
+  status: PaymentWebhookEventStatus;
+  attempts: number;
+  last_error?: string;
+  payment_id?: string;
+  order_id?: string;
+  next_attempt_at?: string;
+  received_at: string;
+  processed_at?: string;
+  updated_at: string;
+}
+
+export interface PaymentWebhookEventListResponse {
+  items: PaymentWebhookEvent[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export interface PaymentRecord {
+  provider: string;
+  provider_ref: string;
+  payment_id?: string;
+  order_id?: string;
+  status: string;
+  amount_cents: number;
+  currency: string;
   created_at: string;
+}
+
+export type ReconciliationMismatchKind =
+  | "orphan_payment"
+  | "amount_mismatch"
+  | "stuck_pending_payment"
+  | "missing_payment";
+
+export interface ReconciliationMismatch {
+  id: string;
+  kind: ReconciliationMismatchKind;
+  order_id?: string;
+  order_status?: string;
+  currency: string;
+  expected_cents: number;
+  actual_cents: number;
+  payments: PaymentRecord[];
+  detail: string;
+  fixable: boolean;
+  fixed_at?: string;
+  fix_error?: string;
+}
+
+export interface ReconciliationReport {
+  id: string;
+  status: "completed" | "failed";
+  error?: string;
+  window_start: string;
+  window_end: string;
+  payments_checked: number;
+  orders_checked: number;
+  mismatches: ReconciliationMismatch[];
+  created_at: string;
+}
+
+export interface ReconciliationReportListResponse {
+  items: ReconciliationReport[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export interface ReconciliationFixResult {
+  fixed: number;
+  failed: number;
+  report: ReconciliationReport;
+}
+
+export interface PaymentStatusResponse {
+  id: string;
+  order_id: string;
+  order_status: OrderStatus;
+  method: string;
+  provider: string;
+  status: string;
+  action_required: boolean;
+  client_secret?: string;
+  client_token?: string;
+  redirect_url?: string;
+  amount_cents: number;
+  currency: string;
   updated_at: string;
   guest_token?: string;
 }
 
+export interface CODCollection {
+  shipment_id: string;
+  vendor_id: string;
+  status: "collected" | "refused";
+  amount_cents: number;
+  commission_cents: number;
+  confirmed_by: string;
+  recorded_at: string;
+}
+
+export interface CODCollectionRequest {
+  outcome: "collected" | "refused";
+  amount_cents?: number;
+}
+
+export interface CODCollectionResponse {
+  shipment: VendorShipment;
+  payment: CODPaymentResponse;
+}
+
+export interface CODSettlement {
+  kind: "offset" | "remittance";
+  reference: string;
+  amount_cents: number;
+  settled_at: string;
+}
+
+export interface CODVendorBalance {
+  vendor_id: string;
+  currency: string;
+  collected_cents: number;
+  commission_cents: number;
+  offset_cents: number;
+  remitted_cents: number;
+  outstanding_cents: number;
+  settlements: CODSettlement[];
+  updated_at: string;
+}
+
+export interface CODVendorBalanceListResponse {
+  items: CODVendorBalance[];
+  total?: number;
+  limit?: number;
+  offset?: number;
+}
+
+export interface CODRemittanceRequest {
+  currency: string;
+  amount_cents: number;
+  reference: string;
+}
+
+export interface CODBuyerFlag {
+  buyer_ref: string;
+  refusals: number;
+  order_ids: string[];
+  flagged: boolean;
+  flagged_at?: string;
+}
+
+export interface CODBuyerFlagListResponse {
+  items: CODBuyerFlag[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
 export interface CODPaymentResponse {
   id: string;
   order_id: string;
   method: "cod";
-  status: "pending_collection";
+  status: "pending_collection" | "collected" | "refused";
   provider: "cod";
   provider_ref: string;
   amount_cents: number;
   currency: string;
+  collected_cents: number;
+  collections: CODCollection[];
+  created_at: string;
+  updated_at: string;
+  guest_token?: string;
+}
+
+export interface PaymentRefund {
+  refund_ref: string;
+  reference: string;
+  amount_cents: number;
+  refunded_at: string;
+}
+
+export interface ProviderPaymentResponse {
+  id: string;
+  order_id: string;
+  method: string;
+  status: "pending" | "authorized" | "succeeded" | "failed" | "cancelled";
+  provider: string;
+  provider_ref: string;
+  client_token?: string;
+  redirect_url?: string;
+  amount_cents: number;
+  currency: string;
+  captured_cents: number;
+  refunded_cents: number;
+  captures: PaymentCapture[];
+  released_cents: number;
+  releases: PaymentRelease[];
+  refunds: PaymentRefund[];
   created_at: string;
   updated_at: string;
   guest_token?: string;
@@ -547,11 +1109,267 @@ export interface StripeWebhookResponse {
   duplicate: boolean;
   payment_id?: string;
   order_id?: string;
-  payment_status?: "pending" | "succeeded" | "failed";
+  payment_status?: StripePaymentStatus;
+  dispute_ref?: string;
+}
+
+export type DisputeStatus =
+  | "warning_needs_response"
+  | "warning_under_review"
+  | "warning_closed"
+  | "needs_response"
+  | "under_review"
+  | "won"
+  | "lost";
+
+export type DisputeEvidenceKind =
+  | "tracking"
+  | "delivery_confirmation"
+  | "customer_communication"
+  | "refund_policy"
+  | "other";
+
+export interface DisputeShipmentShare {
+  shipment_id: string;
+  vendor_id: string;
+  amount_cents: number;
+}
+
+export interface DisputeEvidence {
+  id: string;
+  vendor_id: string;
+  kind: DisputeEvidenceKind;
+  text: string;
+  submitted_by_user_id: string;
+  created_at: string;
+}
+
+export interface Dispute {
+  id: string;
+  order_id: string;
+  payment_id: string;
+  provider_ref: string;
+  reason: string;
+  status: DisputeStatus;
+  amount_cents: number;
+  currency: string;
+  evidence_due_by?: string;
+  shipments: DisputeShipmentShare[];
+  evidence: DisputeEvidence[];
+  created_at: string;
+  updated_at: string;
+  closed_at?: string;
+}
+
+export interface DisputeListResponse {
+  items: Dispute[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export interface VendorDisputeEvidenceRequest {
+  kind: DisputeEvidenceKind;
+  text: string;
 }
 
 export interface PaymentSettingsResponse {
   stripe_enabled: boolean;
   cod_enabled: boolean;
+  providers: Record<string, boolean>;
+  updated_at: string;
+}
+
+export interface CurrenciesResponse {
+  base_currency: string;
+  items: string[];
+}
+
+export interface FXRate {
+  currency: string;
+  rate: string;
+  updated_at: string;
+  updated_by?: string;
+}
+
+export interface AdminFXRatesResponse {
+  base_currency: string;
+  reporting_currency: string;
+  items: FXRate[];
+}
+
+export interface AdminFXRateUpsertRequest {
+  rate: string;
+}
+
+export interface WishlistItem {
+  product_id: string;
+  added_at: string;
+  product?: CatalogProduct;
+}
+
+export interface Wishlist {
+  id: string;
+  buyer_user_id: string;
+  name: string;
+  items: WishlistItem[];
+  created_at: string;
   updated_at: string;
 }
+
+export interface WishlistListResponse {
+  items: Wishlist[];
+}
+
+export interface WishlistNameRequest {
+  name: string;
+}
+
+export interface WishlistAddItemRequest {
+  product_id: string;
+}
+
+export type ProductAlertKind = "back_in_stock" | "price_drop";
+
+export interface ProductAlert {
+  id: string;
+  buyer_user_id: string;
+  product_id: string;
+  kind: ProductAlertKind;
+  price_threshold_cents?: number;
+  created_at: string;
+  last_notified_at?: string;
+}
+
+export interface ProductAlertListResponse {
+  items: ProductAlert[];
+}
+
+export interface ProductAlertCreateRequest {
+  product_id: string;
+  kind: ProductAlertKind;
+  price_threshold_cents?: number;
+}
+
+export interface Notification {
+  kind: string;
+  recipient_user_id: string;
+  subject: string;
+  body: string;
+  data?: Record<string, string>;
+  created_at: string;
+}
+
+export interface NotificationListResponse {
+  items: Notification[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export type CartRecoveryStatus = "notified" | "recovered" | "expired";
+
+export interface CartRecovery {
+  cart_id: string;
+  buyer_user_id: string;
+  status: CartRecoveryStatus;
+  currency: string;
+  item_count: number;
+  subtotal_cents: number;
+  coupon_code?: string;
+  idle_since: string;
+  notified_at: string;
+  recovered_at?: string;
+  order_id?: string;
+  expired_at?: string;
+}
+
+export interface CartRecoveryMetrics {
+  abandoned_total: number;
+  pending_total: number;
+  recovered_total: number;
+  expired_total: number;
+  coupons_issued: number;
+  conversion_rate_bps: number;
+  carts_expired: number;
+  last_run_at?: string;
+}
+
+export interface AdminCartRecoveryListResponse {
+  metrics: CartRecoveryMetrics;
+  items: CartRecovery[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export interface AdminCartRecoveryRunResponse {
+  result: {
+    idle_carts: number;
+    notified: number;
+    notify_failed: number;
+    carts_expired: number;
+  };
+  metrics: CartRecoveryMetrics;
+}
+
+export type InvoiceKind = "invoice" | "commission_invoice" | "credit_note";
+
+export interface InvoiceParty {
+  id: string;
+  name: string;
+  legal_name?: string;
+  tax_id?: string;
+  address?: string;
+  email?: string;
+  country_code?: string;
+}
+
+export type InvoiceFormat = "pdf" | "ubl";
+
+export interface InvoiceLine {
+  description: string;
+  qty: number;
+  unit_price_cents: number;
+  total_cents: number;
+}
+
+export type InvoiceLocale = "de" | "en" | "fr";
+
+export interface Invoice {
+  id: string;
+  kind: InvoiceKind;
+  order_id: string;
+  shipment_id: string;
+  vendor_id: string;
+  issuer_id: string;
+  invoice_number: string;
+  file_name: string;
+  issued_at: string;
+  issuer: InvoiceParty;
+  recipient: InvoiceParty;
+  lines: InvoiceLine[];
+  currency: string;
+  subtotal_cents: number;
+  shipping_cents: number;
+  tax_cents: number;
+  total_cents: number;
+  original_invoice_id?: string;
+  original_invoice_number?: string;
+  refund_request_id?: string;
+  reason?: string;
+  locale: InvoiceLocale;
+  footer?: string;
+  storage_key: string;
+  content_sha256: string;
+  content_size: number;
+  retain_until: string;
+  purged_at?: string;
+}
+
+export interface InvoiceListResponse {
+  items: Invoice[];
+  total?: number;
+  limit?: number;
+  offset?: number;
+}
@@ -1,6 +1,6 @@
 module github.com/yxshee/marketplace-platform/services/api
 
-go 1.19
+go 1.24.0
 
 require (
 	github.com/go-chi/chi/v5 v5.2.0
@@ -12,4 +12,4 @@ require github.com/stripe/stripe-go/v83 v83.2.1
 
 require github.com/go-pdf/fpdf v0.9.0
 
-require golang.org/x/time v0.14.0 // indirect
+require golang.org/x/time v0.14.0
@@ -23,7 +23,12 @@ type Entry struct {
 	BeforeJSON   json.RawMessage `json:"before_json,omitempty"`
 	AfterJSON    json.RawMessage `json:"after_json,omitempty"`
 	MetadataJSON json.RawMessage `json:"metadata_json,omitempty"`
-	CreatedAt    time.Time       `json:"created_at"`
+	// ImpersonationID and OnBehalfOf are set on actions staff took while
+	// impersonating a user: the actor is the real staff member and
+	// OnBehalfOf the user they were viewing as.
+	ImpersonationID string    `json:"impersonation_id,omitempty"`
+	OnBehalfOf      string    `json:"on_behalf_of,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
 type RecordInput struct {
@@ -36,16 +41,20 @@ type RecordInput struct {
 	Before     interface{}
 	After      interface{}
 	Metadata   interface{}
+	// ImpersonationID and OnBehalfOf tag actions taken under impersonation.
+	ImpersonationID string
+	OnBehalfOf      string
 }
 
 type ListInput struct {
-	ActorType  string
-	ActorID    string
-	Action     string
-	TargetType string
-	TargetID   string
-	Limit      int
-	Offset     int
+	ActorType       string
+	ActorID         string
+	Action          string
+	TargetType      string
+	TargetID        string
+	ImpersonationID string
+	Limit           int
+	Offset          int
 }
 
 type ListResult struct {
@@ -103,18 +112,28 @@ func (s *Service) Record(input RecordInput) (Entry, error) {
 		return Entry{}, err
 	}
 
+	// Impersonation tags come as a pair so that an entry never names only
+	// half of an impersonation.
+	impersonationID := strings.TrimSpace(input.ImpersonationID)
+	onBehalfOf := strings.TrimSpace(input.OnBehalfOf)
+	if (impersonationID == "") != (onBehalfOf == "") {
+		return Entry{}, ErrInvalidAuditLog
+	}
+
 	entry := Entry{
-		ID:           identifier.New("aud"),
-		ActorType:    actorType,
-		ActorID:      actorID,
-		ActorRole:    strings.ToLower(strings.TrimSpace(input.ActorRole)),
-		Action:       action,
-		TargetType:   targetType,
-		TargetID:     targetID,
-		BeforeJSON:   beforeJSON,
-		AfterJSON:    afterJSON,
-		MetadataJSON: metadataJSON,
-		CreatedAt:    s.now(),
+		ID:              identifier.New("aud"),
+		ActorType:       actorType,
+		ActorID:         actorID,
+		ActorRole:       strings.ToLower(strings.TrimSpace(input.ActorRole)),
+		Action:          action,
+		TargetType:      targetType,
+		TargetID:        targetID,
+		BeforeJSON:      beforeJSON,
+		AfterJSON:       afterJSON,
+		MetadataJSON:    metadataJSON,
+		ImpersonationID: impersonationID,
+		OnBehalfOf:      onBehalfOf,
+		CreatedAt:       s.now(),
 	}
 
 	s.mu.Lock()
@@ -142,6 +161,7 @@ func (s *Service) List(input ListInput) ListResult {
 	action := strings.ToLower(strings.TrimSpace(input.Action))
 	targetType := strings.ToLower(strings.TrimSpace(input.TargetType))
 	targetID := strings.TrimSpace(input.TargetID)
+	impersonationID := strings.TrimSpace(input.ImpersonationID)
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -168,6 +188,9 @@ func (s *Service) List(input ListInput) ListResult {
 		if targetID != "" && entry.TargetID != targetID {
 			continue
 		}
+		if impersonationID != "" && entry.ImpersonationID != impersonationID {
+			continue
+		}
 		matches = append(matches, entry)
 	}
 
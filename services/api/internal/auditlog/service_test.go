@@ -133,3 +133,43 @@ func TestRecordValidation(t *testing.T) {
 		t.Fatalf("expected invalid raw json payload to fail")
 	}
 }
+
+func TestRecordTagsImpersonatedActions(t *testing.T) {
+	svc := NewService()
+
+	if _, err := svc.Record(RecordInput{
+		ActorType:       "admin",
+		ActorID:         "usr_support",
+		Action:          "impersonated_request",
+		TargetType:      "user",
+		TargetID:        "usr_buyer",
+		ImpersonationID: "imp_1",
+	}); err != ErrInvalidAuditLog {
+		t.Fatalf("expected a half-tagged entry to be rejected, got %v", err)
+	}
+
+	tagged, err := svc.Record(RecordInput{
+		ActorType:       "admin",
+		ActorID:         "usr_support",
+		ActorRole:       "support",
+		Action:          "impersonated_request",
+		TargetType:      "user",
+		TargetID:        "usr_buyer",
+		ImpersonationID: "imp_1",
+		OnBehalfOf:      "usr_buyer",
+	})
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if tagged.ImpersonationID != "imp_1" || tagged.OnBehalfOf != "usr_buyer" {
+		t.Fatalf("unexpected tags: %+v", tagged)
+	}
+	if _, err := svc.Record(RecordInput{ActorType: "buyer", ActorID: "usr_buyer", Action: "auth_sessions_revoked", TargetType: "user", TargetID: "usr_buyer"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	result := svc.List(ListInput{ImpersonationID: "imp_1"})
+	if result.Total != 1 || result.Items[0].ID != tagged.ID {
+		t.Fatalf("expected only the tagged entry, got %+v", result.Items)
+	}
+}
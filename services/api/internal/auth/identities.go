@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+var (
+	ErrIdentityAlreadyLinked = errors.New("external identity already linked")
+	ErrIdentityNotLinked     = errors.New("external identity not linked")
+	ErrLastSignInMethod      = errors.New("cannot remove the last sign-in method")
+	ErrEmailNotVerified      = errors.New("email address is not verified")
+	ErrLinkRequiresSignIn    = errors.New("account email is not verified; link the identity while signed in")
+)
+
+// ExternalIdentity is an account at an OpenID provider that signs in as a
+// user.
+type ExternalIdentity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+func externalIdentityKey(provider, subject string) string {
+	return provider + "\x00" + subject
+}
+
+// SignInWithExternalIdentity resolves a provider login to a user. A linked
+// identity signs in as its user. Otherwise the provider must vouch for the
+// email: it is linked to the account with that email, or a new account is
+// created. An account whose owner never verified the email is not linked,
+// since whoever registered it may not own the address; its owner links the
+// identity while signed in instead. The second return value reports whether
+// the identity was linked by this call, and the third whether the user was
+// created.
+func (s *Service) SignInWithExternalIdentity(identity ExternalIdentity, emailVerified bool) (User, bool, bool, error) {
+	identity.Provider = strings.ToLower(strings.TrimSpace(identity.Provider))
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if userID, linked := s.externalIdentities[externalIdentityKey(identity.Provider, identity.Subject)]; linked {
+		return s.usersByID[userID], false, false, nil
+	}
+	if !emailVerified || identity.Email == "" {
+		return User{}, false, false, ErrEmailNotVerified
+	}
+
+	now := time.Now().UTC()
+	created := false
+	userID, exists := s.usersByEmail[identity.Email]
+	if exists && s.usersByID[userID].EmailVerifiedAt == nil {
+		return User{}, false, false, ErrLinkRequiresSignIn
+	}
+	if !exists {
+		role := RoleBuyer
+		if bootstrappedRole, ok := s.bootstrapRoles[identity.Email]; ok {
+			role = bootstrappedRole
+		}
+		user := User{
+			ID:              identifier.New("usr"),
+			Email:           identity.Email,
+			Role:            role,
+			EmailVerifiedAt: &now,
+			CreatedAt:       now,
+		}
+		s.usersByID[user.ID] = user
+		s.usersByEmail[user.Email] = user.ID
+		userID = user.ID
+		created = true
+	}
+
+	user, err := s.linkExternalIdentityLocked(userID, identity, now)
+	if err != nil {
+		return User{}, false, false, err
+	}
+	return user, true, created, nil
+}
+
+// LinkExternalIdentity adds a provider identity to a signed-in user. Each
+// user links at most one identity per provider.
+func (s *Service) LinkExternalIdentity(userID string, identity ExternalIdentity) (User, error) {
+	identity.Provider = strings.ToLower(strings.TrimSpace(identity.Provider))
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.linkExternalIdentityLocked(userID, identity, time.Now().UTC())
+}
+
+func (s *Service) linkExternalIdentityLocked(userID string, identity ExternalIdentity, now time.Time) (User, error) {
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	key := externalIdentityKey(identity.Provider, identity.Subject)
+	if linkedUserID, linked := s.externalIdentities[key]; linked {
+		if linkedUserID == userID {
+			return user, nil
+		}
+		return User{}, ErrIdentityAlreadyLinked
+	}
+	for _, existing := range user.ExternalIdentities {
+		if existing.Provider == identity.Provider {
+			return User{}, ErrIdentityAlreadyLinked
+		}
+	}
+
+	identity.LinkedAt = now
+	user.ExternalIdentities = append(append([]ExternalIdentity(nil), user.ExternalIdentities...), identity)
+	s.usersByID[userID] = user
+	s.externalIdentities[key] = userID
+	return user, nil
+}
+
+// UnlinkExternalIdentity removes the user's identity at a provider. Users
+// without a password keep at least one identity so they can still sign in.
+func (s *Service) UnlinkExternalIdentity(userID, provider string) (User, ExternalIdentity, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, ExternalIdentity{}, ErrUserNotFound
+	}
+	for i, identity := range user.ExternalIdentities {
+		if identity.Provider != provider {
+			continue
+		}
+		if user.PasswordHash == "" && len(user.ExternalIdentities) == 1 {
+			return User{}, ExternalIdentity{}, ErrLastSignInMethod
+		}
+		remaining := make([]ExternalIdentity, 0, len(user.ExternalIdentities)-1)
+		remaining = append(remaining, user.ExternalIdentities[:i]...)
+		user.ExternalIdentities = append(remaining, user.ExternalIdentities[i+1:]...)
+		s.usersByID[userID] = user
+		delete(s.externalIdentities, externalIdentityKey(identity.Provider, identity.Subject))
+		return user, identity, nil
+	}
+	return User{}, ExternalIdentity{}, ErrIdentityNotLinked
+}
@@ -8,6 +8,36 @@ type Identity struct {
 	Role      Role
 	SessionID string
 	VendorID  *string
+	// MFAVerified is true when the session was opened with a second factor.
+	MFAVerified bool
+	// ImpersonatorID is the staff member acting as UserID when the token
+	// belongs to an impersonation; SessionID is then the impersonation ID.
+	ImpersonatorID   string
+	ImpersonatorRole Role
+	// Elevated impersonations may make changes; others are read-only.
+	Elevated bool
+	// Permissions are the grants of a custom role signed into the token that
+	// the role still holds.
+	Permissions []Permission
+}
+
+// Impersonated reports whether a staff member is acting as the user.
+func (i Identity) Impersonated() bool {
+	return i.ImpersonatorID != ""
+}
+
+// Allowed checks a permission against the built-in matrix, or for custom
+// roles against the permissions the token was issued with.
+func (i Identity) Allowed(permission Permission) bool {
+	if isKnownRole(i.Role) {
+		return IsAllowed(i.Role, permission)
+	}
+	for _, granted := range i.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
 }
 
 type identityContextKey string
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestImpersonationLifecycleAndToken(t *testing.T) {
+	svc := NewService(map[string]Role{"support@example.com": RoleSupport})
+	support, _ := svc.Register("support@example.com", "strong-password")
+	buyer, _ := svc.Register("buyer@example.com", "strong-password")
+
+	if _, _, err := svc.StartImpersonation(support.ID, buyer.ID, "  ", false, time.Minute); !errors.Is(err, ErrImpersonationReason) {
+		t.Fatalf("expected ErrImpersonationReason, got %v", err)
+	}
+	if _, _, err := svc.StartImpersonation(buyer.ID, support.ID, "ticket 42", false, time.Minute); !errors.Is(err, ErrNotImpersonatable) {
+		t.Fatalf("expected staff not to be impersonatable, got %v", err)
+	}
+	if _, _, err := svc.StartImpersonation(support.ID, "usr_missing", "ticket 42", false, time.Minute); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	impersonation, subject, err := svc.StartImpersonation(support.ID, buyer.ID, "ticket 42", false, time.Minute)
+	if err != nil || subject.ID != buyer.ID || impersonation.ImpersonatorRole != RoleSupport {
+		t.Fatalf("StartImpersonation() = %+v err=%v", impersonation, err)
+	}
+	if active := svc.ActiveImpersonations(); len(active) != 1 || active[0].ID != impersonation.ID {
+		t.Fatalf("unexpected active impersonations: %+v", active)
+	}
+
+	manager, _ := NewTokenManager("secret", "marketplace-api", testDuration(900), testDuration(3600))
+	token, err := manager.IssueImpersonationToken(subject, impersonation)
+	if err != nil {
+		t.Fatalf("IssueImpersonationToken() error = %v", err)
+	}
+	claims, err := manager.ParseAndValidate(token, TokenTypeAccess)
+	if err != nil || claims.UserID != buyer.ID || claims.ImpersonatorID != support.ID || claims.SessionID != impersonation.ID || claims.Elevated {
+		t.Fatalf("ParseAndValidate() = %+v err=%v", claims, err)
+	}
+	if claims.ExpiresAt.After(impersonation.ExpiresAt.Add(time.Second)) {
+		t.Fatalf("expected the token to expire with the impersonation, got %v", claims.ExpiresAt)
+	}
+
+	if _, err := svc.EndImpersonation(impersonation.ID); err != nil {
+		t.Fatalf("EndImpersonation() error = %v", err)
+	}
+	if _, active := svc.ActiveImpersonation(impersonation.ID); active {
+		t.Fatal("expected the ended impersonation to be inactive")
+	}
+	if _, err := svc.EndImpersonation(impersonation.ID); !errors.Is(err, ErrImpersonationNotFound) {
+		t.Fatalf("expected ErrImpersonationNotFound, got %v", err)
+	}
+
+	expired, _, _ := svc.StartImpersonation(support.ID, buyer.ID, "ticket 43", false, -time.Second)
+	if _, active := svc.ActiveImpersonation(expired.ID); active {
+		t.Fatal("expected an expired impersonation to be inactive")
+	}
+}
+
+func TestOnlySuperAdminsStartElevatedImpersonations(t *testing.T) {
+	svc := NewService(map[string]Role{"admin@example.com": RoleSuperAdmin, "support@example.com": RoleSupport})
+	admin, _ := svc.Register("admin@example.com", "strong-password")
+	support, _ := svc.Register("support@example.com", "strong-password")
+	buyer, _ := svc.Register("buyer@example.com", "strong-password")
+
+	if _, _, err := svc.StartImpersonation(support.ID, buyer.ID, "ticket 44", true, time.Minute); !errors.Is(err, ErrElevationNotPermitted) {
+		t.Fatalf("expected support to be refused elevation, got %v", err)
+	}
+	if _, _, err := svc.StartImpersonation(support.ID, buyer.ID, "ticket 44", false, time.Minute); err != nil {
+		t.Fatalf("expected support to start a read-only impersonation, got %v", err)
+	}
+	elevated, _, err := svc.StartImpersonation(admin.ID, buyer.ID, "ticket 44", true, time.Minute)
+	if err != nil || !elevated.Elevated {
+		t.Fatalf("expected a super admin to start an elevated impersonation, got %+v err=%v", elevated, err)
+	}
+}
@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFAAlreadyEnabled  = errors.New("mfa already enabled")
+	ErrMFANotEnabled      = errors.New("mfa not enabled")
+	ErrMFANotEnrolling    = errors.New("mfa enrolment not started")
+	ErrInvalidMFACode     = errors.New("invalid mfa code")
+	ErrMFARequiredForRole = errors.New("mfa is required for the role")
+	ErrUnknownRole        = errors.New("unknown role")
+)
+
+// TOTP parameters follow RFC 6238 with the defaults authenticator apps
+// assume: SHA-1, six digits and 30 second steps.
+const (
+	totpDigits        = 6
+	totpPeriod        = 30 * time.Second
+	totpSkewSteps     = 1
+	recoveryCodeCount = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAEnrollment is a TOTP secret waiting for the user to confirm a first code.
+type MFAEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// GenerateTOTPSecret returns a random 160-bit secret in base32.
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(buf), nil
+}
+
+// ProvisioningURI builds the otpauth:// URI that authenticator apps scan as a
+// QR code.
+func ProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code of the step containing at.
+func TOTPCode(secret string, at time.Time) (string, error) {
+	return totpCodeForStep(secret, totpStep(at))
+}
+
+func totpStep(at time.Time) int64 {
+	return at.Unix() / int64(totpPeriod.Seconds())
+}
+
+func totpCodeForStep(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000), nil
+}
+
+// matchTOTP returns the step a code belongs to, allowing one step of clock
+// skew either way. Steps at or before lastStep are rejected so a code cannot
+// be replayed.
+func matchTOTP(secret, code string, at time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpStep(at)
+	for step := current - totpSkewSteps; step <= current+totpSkewSteps; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCodeForStep(secret, step)
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32NoPadding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if len(code) == 8 && !strings.Contains(code, "-") {
+		code = code[:4] + "-" + code[4:]
+	}
+	return code
+}
+
+// BeginMFAEnrollment stores a new pending TOTP secret for the user. Starting
+// again replaces a secret that was never confirmed.
+func (s *Service) BeginMFAEnrollment(userID, issuer string) (MFAEnrollment, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return MFAEnrollment{}, ErrUserNotFound
+	}
+	if user.MFAEnabledAt != nil {
+		return MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	user.pendingTOTPSecret = secret
+	s.usersByID[userID] = user
+
+	return MFAEnrollment{Secret: secret, ProvisioningURI: ProvisioningURI(issuer, user.Email, secret)}, nil
+}
+
+// ConfirmMFAEnrollment enables MFA once the user proves the authenticator
+// works, and returns the recovery codes. Only their hashes are kept.
+func (s *Service) ConfirmMFAEnrollment(userID, code string) (User, []string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, nil, ErrUserNotFound
+	}
+	if user.MFAEnabledAt != nil {
+		return User{}, nil, ErrMFAAlreadyEnabled
+	}
+	if user.pendingTOTPSecret == "" {
+		return User{}, nil, ErrMFANotEnrolling
+	}
+	now := time.Now().UTC()
+	step, ok := matchTOTP(user.pendingTOTPSecret, code, now, 0)
+	if !ok {
+		return User{}, nil, ErrInvalidMFACode
+	}
+
+	user.totpSecret = user.pendingTOTPSecret
+	user.pendingTOTPSecret = ""
+	user.totpLastStep = step
+	user.recoveryCodeHashes = hashes
+	user.MFAEnabledAt = &now
+	s.usersByID[userID] = user
+	return user, codes, nil
+}
+
+// VerifyMFA checks a TOTP code or an unused recovery code. Recovery codes
+// work once; the second return value reports whether one was used.
+func (s *Service) VerifyMFA(userID, code string) (User, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, false, ErrUserNotFound
+	}
+	if user.MFAEnabledAt == nil {
+		return User{}, false, ErrMFANotEnabled
+	}
+
+	usedRecoveryCode, err := s.checkMFACodeLocked(&user, code)
+	if err != nil {
+		return User{}, false, err
+	}
+	s.usersByID[userID] = user
+	return user, usedRecoveryCode, nil
+}
+
+// DisableMFA turns MFA off after checking a current code. Users whose role
+// requires MFA cannot disable it.
+func (s *Service) DisableMFA(userID, code string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	if user.MFAEnabledAt == nil {
+		return User{}, ErrMFANotEnabled
+	}
+	if s.mfaRequiredRoles[user.Role] {
+		return User{}, ErrMFARequiredForRole
+	}
+	if _, err := s.checkMFACodeLocked(&user, code); err != nil {
+		return User{}, err
+	}
+
+	user.MFAEnabledAt = nil
+	user.totpSecret = ""
+	user.totpLastStep = 0
+	user.recoveryCodeHashes = nil
+	s.usersByID[userID] = user
+	return user, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current code.
+func (s *Service) RegenerateRecoveryCodes(userID, code string) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	if user.MFAEnabledAt == nil {
+		return nil, ErrMFANotEnabled
+	}
+	if _, err := s.checkMFACodeLocked(&user, code); err != nil {
+		return nil, err
+	}
+
+	user.recoveryCodeHashes = hashes
+	s.usersByID[userID] = user
+	return codes, nil
+}
+
+// RemainingRecoveryCodes returns how many recovery codes the user has left.
+func (s *Service) RemainingRecoveryCodes(userID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.usersByID[userID].recoveryCodeHashes)
+}
+
+func (s *Service) checkMFACodeLocked(user *User, code string) (bool, error) {
+	if step, ok := matchTOTP(user.totpSecret, code, time.Now().UTC(), user.totpLastStep); ok {
+		user.totpLastStep = step
+		return false, nil
+	}
+
+	hash := HashToken(normalizeRecoveryCode(code))
+	for i, candidate := range user.recoveryCodeHashes {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(hash)) == 1 {
+			remaining := make([]string, 0, len(user.recoveryCodeHashes)-1)
+			remaining = append(remaining, user.recoveryCodeHashes[:i]...)
+			user.recoveryCodeHashes = append(remaining, user.recoveryCodeHashes[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, ErrInvalidMFACode
+}
+
+// SetMFARequiredRoles replaces the roles whose users must pass MFA before
+// using privileged permissions.
+func (s *Service) SetMFARequiredRoles(roles []Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	required := make(map[Role]bool, len(roles))
+	for _, role := range roles {
+		if !s.knownRoleLocked(role) {
+			return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+		}
+		required[role] = true
+	}
+	s.mfaRequiredRoles = required
+	return nil
+}
+
+// MFARequiredRoles returns the roles that require MFA in stable order.
+func (s *Service) MFARequiredRoles() []Role {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]Role, 0, len(s.mfaRequiredRoles))
+	for role := range s.mfaRequiredRoles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+	return roles
+}
+
+// MFARequired reports whether a session of the user must have passed MFA to
+// use privileged permissions: the user enrolled, or their role requires it.
+func (s *Service) MFARequired(userID string, role Role) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.mfaRequiredRoles[role] {
+		return true
+	}
+	user, exists := s.usersByID[userID]
+	return exists && user.MFAEnabledAt != nil
+}
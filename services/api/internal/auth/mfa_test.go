@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 seed, truncated to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil || got != want {
+			t.Fatalf("TOTPCode(%d) = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+
+	uri := ProvisioningURI("Marketplace", "admin@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Marketplace:admin@example.com?") || !strings.Contains(uri, "secret="+secret) || !strings.Contains(uri, "issuer=Marketplace") {
+		t.Fatalf("unexpected provisioning uri %q", uri)
+	}
+}
+
+func TestMFAEnrollmentVerificationAndRecoveryCodes(t *testing.T) {
+	svc := NewService(map[string]Role{"admin@example.com": RoleSuperAdmin})
+	user, err := svc.Register("admin@example.com", "strong-password")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if svc.MFARequired(user.ID, user.Role) {
+		t.Fatal("expected mfa not to apply before enrolment or policy")
+	}
+
+	if _, _, err := svc.VerifyMFA(user.ID, "000000"); !errors.Is(err, ErrMFANotEnabled) {
+		t.Fatalf("expected ErrMFANotEnabled, got %v", err)
+	}
+	if _, _, err := svc.ConfirmMFAEnrollment(user.ID, "000000"); !errors.Is(err, ErrMFANotEnrolling) {
+		t.Fatalf("expected ErrMFANotEnrolling, got %v", err)
+	}
+	enrollment, err := svc.BeginMFAEnrollment(user.ID, "Marketplace")
+	if err != nil {
+		t.Fatalf("BeginMFAEnrollment() error = %v", err)
+	}
+	if _, _, err := svc.ConfirmMFAEnrollment(user.ID, "12345"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected ErrInvalidMFACode, got %v", err)
+	}
+	code, _ := TOTPCode(enrollment.Secret, time.Now())
+	user, recoveryCodes, err := svc.ConfirmMFAEnrollment(user.ID, code)
+	if err != nil {
+		t.Fatalf("ConfirmMFAEnrollment() error = %v", err)
+	}
+	if user.MFAEnabledAt == nil || len(recoveryCodes) != recoveryCodeCount || !svc.MFARequired(user.ID, user.Role) {
+		t.Fatalf("expected mfa enabled with %d recovery codes, got %+v %v", recoveryCodeCount, user, recoveryCodes)
+	}
+	if _, err := svc.BeginMFAEnrollment(user.ID, "Marketplace"); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Fatalf("expected ErrMFAAlreadyEnabled, got %v", err)
+	}
+
+	if _, _, err := svc.VerifyMFA(user.ID, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected the enrolment code not to be replayable, got %v", err)
+	}
+	next, _ := TOTPCode(enrollment.Secret, time.Now().Add(totpPeriod))
+	if _, usedRecovery, err := svc.VerifyMFA(user.ID, next); err != nil || usedRecovery {
+		t.Fatalf("expected the next step's code to pass within the skew, err=%v recovery=%v", err, usedRecovery)
+	}
+
+	if _, usedRecovery, err := svc.VerifyMFA(user.ID, strings.ToUpper(strings.ReplaceAll(recoveryCodes[3], "-", ""))); err != nil || !usedRecovery {
+		t.Fatalf("expected the recovery code to pass, err=%v recovery=%v", err, usedRecovery)
+	}
+	if _, _, err := svc.VerifyMFA(user.ID, recoveryCodes[3]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected recovery codes to be single-use, got %v", err)
+	}
+	if remaining := svc.RemainingRecoveryCodes(user.ID); remaining != recoveryCodeCount-1 {
+		t.Fatalf("expected %d remaining recovery codes, got %d", recoveryCodeCount-1, remaining)
+	}
+
+	if err := svc.SetMFARequiredRoles([]Role{RoleSuperAdmin, "janitor"}); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("expected ErrUnknownRole, got %v", err)
+	}
+	if err := svc.SetMFARequiredRoles([]Role{RoleSuperAdmin, RoleFinance}); err != nil {
+		t.Fatalf("SetMFARequiredRoles() error = %v", err)
+	}
+	if roles := svc.MFARequiredRoles(); len(roles) != 2 || roles[0] != RoleFinance {
+		t.Fatalf("unexpected required roles %v", roles)
+	}
+	if _, err := svc.DisableMFA(user.ID, recoveryCodes[0]); !errors.Is(err, ErrMFARequiredForRole) {
+		t.Fatalf("expected ErrMFARequiredForRole, got %v", err)
+	}
+	_ = svc.SetMFARequiredRoles(nil)
+	if user, err = svc.DisableMFA(user.ID, recoveryCodes[0]); err != nil || user.MFAEnabledAt != nil {
+		t.Fatalf("DisableMFA() user=%+v error=%v", user, err)
+	}
+}
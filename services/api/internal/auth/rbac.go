@@ -15,6 +15,10 @@ const (
 	RoleSupport          Role = "support"
 	RoleFinance          Role = "finance"
 	RoleCatalogModerator Role = "catalog_moderator"
+	// Vendor team members below the owner each handle one part of the shop.
+	RoleVendorCatalogManager Role = "vendor_catalog_manager"
+	RoleVendorFulfilment     Role = "vendor_fulfilment"
+	RoleVendorFinance        Role = "vendor_finance"
 )
 
 // Permission represents an action that can be authorized.
@@ -27,6 +31,7 @@ const (
 	PermissionManageShipmentOrders     Permission = "manage_shipment_orders"
 	PermissionManageRefundDecisions    Permission = "manage_refund_decisions"
 	PermissionViewVendorAnalytics      Permission = "view_vendor_analytics"
+	PermissionManageVendorPayouts      Permission = "manage_vendor_payouts"
 	PermissionManageVendorVerification Permission = "manage_vendor_verification"
 	PermissionModerateProducts         Permission = "moderate_products"
 	PermissionManageOrdersOperations   Permission = "manage_orders_operations"
@@ -36,6 +41,13 @@ const (
 	PermissionManageTaxSettings        Permission = "manage_tax_settings"
 	PermissionViewAdminAnalytics       Permission = "view_admin_analytics"
 	PermissionViewAuditLogs            Permission = "view_audit_logs"
+	PermissionManageSecuritySettings   Permission = "manage_security_settings"
+	PermissionManageVendorTeam         Permission = "manage_vendor_team"
+	PermissionManageRoles              Permission = "manage_roles"
+	PermissionImpersonateUsers         Permission = "impersonate_users"
+	// PermissionImpersonateUsersElevated lets an impersonation make changes
+	// as the user; without it impersonations are read-only.
+	PermissionImpersonateUsersElevated Permission = "impersonate_users_elevated"
 )
 
 var permissionMatrix = map[Role]map[Permission]bool{
@@ -49,12 +61,30 @@ var permissionMatrix = map[Role]map[Permission]bool{
 		PermissionManageShipmentOrders:  true,
 		PermissionManageRefundDecisions: true,
 		PermissionViewVendorAnalytics:   true,
+		PermissionManageVendorPayouts:   true,
+		PermissionManageVendorTeam:      true,
+	},
+	RoleVendorCatalogManager: {
+		PermissionViewCatalog:          true,
+		PermissionManageVendorProducts: true,
+		PermissionManageVendorCoupons:  true,
+	},
+	RoleVendorFulfilment: {
+		PermissionViewCatalog:          true,
+		PermissionManageShipmentOrders: true,
+	},
+	RoleVendorFinance: {
+		PermissionViewCatalog:           true,
+		PermissionViewVendorAnalytics:   true,
+		PermissionManageRefundDecisions: true,
+		PermissionManageVendorPayouts:   true,
 	},
 	RoleSupport: {
 		PermissionViewCatalog:              true,
 		PermissionManageOrdersOperations:   true,
 		PermissionManageVendorVerification: true,
 		PermissionViewAuditLogs:            true,
+		PermissionImpersonateUsers:         true,
 	},
 	RoleFinance: {
 		PermissionViewCatalog:           true,
@@ -70,7 +100,31 @@ var permissionMatrix = map[Role]map[Permission]bool{
 		PermissionModerateProducts: true,
 		PermissionViewAuditLogs:    true,
 	},
-	RoleSuperAdmin: {},
+	RoleSuperAdmin: {
+		PermissionManageSecuritySettings:   true,
+		PermissionManageRoles:              true,
+		PermissionImpersonateUsersElevated: true,
+	},
+}
+
+// privilegedPermissions move money, change platform settings or expose other
+// users' data. Sessions that must pass MFA and have not are refused them.
+var privilegedPermissions = map[Permission]bool{
+	PermissionManageVendorPayouts:      true,
+	PermissionManageVendorVerification: true,
+	PermissionModerateProducts:         true,
+	PermissionManageOrdersOperations:   true,
+	PermissionManagePromotions:         true,
+	PermissionManageCommission:         true,
+	PermissionManagePaymentSettings:    true,
+	PermissionManageTaxSettings:        true,
+	PermissionViewAdminAnalytics:       true,
+	PermissionViewAuditLogs:            true,
+	PermissionManageSecuritySettings:   true,
+	PermissionManageVendorTeam:         true,
+	PermissionManageRoles:              true,
+	PermissionImpersonateUsers:         true,
+	PermissionImpersonateUsersElevated: true,
 }
 
 func init() {
@@ -94,6 +148,9 @@ func Roles() []Role {
 	roles := []Role{
 		RoleBuyer,
 		RoleVendorOwner,
+		RoleVendorCatalogManager,
+		RoleVendorFulfilment,
+		RoleVendorFinance,
 		RoleSupport,
 		RoleFinance,
 		RoleCatalogModerator,
@@ -122,7 +179,18 @@ func (p Permission) String() string {
 	return string(p)
 }
 
+// IsVendorRole reports whether a role belongs to a vendor team member.
+func IsVendorRole(role Role) bool {
+	switch role {
+	case RoleVendorOwner, RoleVendorCatalogManager, RoleVendorFulfilment, RoleVendorFinance:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsAllowed checks a role/permission pair against the canonical RBAC matrix.
+// Custom roles are checked by Identity.Allowed.
 func IsAllowed(role Role, permission Permission) bool {
 	rolePerms, exists := permissionMatrix[role]
 	if !exists {
@@ -131,6 +199,12 @@ func IsAllowed(role Role, permission Permission) bool {
 	return rolePerms[permission]
 }
 
+// IsPrivileged reports whether a permission needs a session that passed MFA
+// when MFA applies to the user.
+func IsPrivileged(permission Permission) bool {
+	return privilegedPermissions[permission]
+}
+
 // MustBeAllowed validates and returns an error useful for API handlers.
 func MustBeAllowed(role Role, permission Permission) error {
 	if IsAllowed(role, permission) {
@@ -15,7 +15,15 @@ func TestIsAllowed(t *testing.T) {
 		{name: "finance cannot moderate products", role: RoleFinance, permission: PermissionModerateProducts, want: false},
 		{name: "support can manage vendor verification", role: RoleSupport, permission: PermissionManageVendorVerification, want: true},
 		{name: "support cannot manage commission", role: RoleSupport, permission: PermissionManageCommission, want: false},
+		{name: "support can impersonate users", role: RoleSupport, permission: PermissionImpersonateUsers, want: true},
+		{name: "support cannot elevate impersonations", role: RoleSupport, permission: PermissionImpersonateUsersElevated, want: false},
+		{name: "super admin can elevate impersonations", role: RoleSuperAdmin, permission: PermissionImpersonateUsersElevated, want: true},
+		{name: "finance cannot impersonate users", role: RoleFinance, permission: PermissionImpersonateUsers, want: false},
 		{name: "catalog moderator can moderate products", role: RoleCatalogModerator, permission: PermissionModerateProducts, want: true},
+		{name: "vendor fulfilment can manage shipments", role: RoleVendorFulfilment, permission: PermissionManageShipmentOrders, want: true},
+		{name: "vendor catalog manager cannot view vendor analytics", role: RoleVendorCatalogManager, permission: PermissionViewVendorAnalytics, want: false},
+		{name: "vendor finance can manage vendor payouts", role: RoleVendorFinance, permission: PermissionManageVendorPayouts, want: true},
+		{name: "vendor finance cannot manage vendor team", role: RoleVendorFinance, permission: PermissionManageVendorTeam, want: false},
 		{name: "super admin can do everything", role: RoleSuperAdmin, permission: PermissionManageTaxSettings, want: true},
 	}
 
@@ -51,12 +59,30 @@ func TestPermissionMatrixCoverage(t *testing.T) {
 			PermissionManageShipmentOrders:  true,
 			PermissionManageRefundDecisions: true,
 			PermissionViewVendorAnalytics:   true,
+			PermissionManageVendorPayouts:   true,
+			PermissionManageVendorTeam:      true,
+		},
+		RoleVendorCatalogManager: {
+			PermissionViewCatalog:          true,
+			PermissionManageVendorProducts: true,
+			PermissionManageVendorCoupons:  true,
+		},
+		RoleVendorFulfilment: {
+			PermissionViewCatalog:          true,
+			PermissionManageShipmentOrders: true,
+		},
+		RoleVendorFinance: {
+			PermissionViewCatalog:           true,
+			PermissionViewVendorAnalytics:   true,
+			PermissionManageRefundDecisions: true,
+			PermissionManageVendorPayouts:   true,
 		},
 		RoleSupport: {
 			PermissionViewCatalog:              true,
 			PermissionManageOrdersOperations:   true,
 			PermissionManageVendorVerification: true,
 			PermissionViewAuditLogs:            true,
+			PermissionImpersonateUsers:         true,
 		},
 		RoleFinance: {
 			PermissionViewCatalog:           true,
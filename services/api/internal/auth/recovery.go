@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// TokenPurpose tells single-use account tokens apart, so a verification token
+// can never reset a password.
+type TokenPurpose string
+
+const (
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+)
+
+type actionToken struct {
+	UserID    string
+	Purpose   TokenPurpose
+	ExpiresAt time.Time
+}
+
+// IssueEmailVerificationToken returns a token that marks the user's email as
+// verified. Earlier verification tokens of the user stop working.
+func (s *Service) IssueEmailVerificationToken(userID string, ttl time.Duration) (string, User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return "", User{}, ErrUserNotFound
+	}
+	raw, err := s.issueActionTokenLocked(user.ID, TokenPurposeEmailVerification, ttl)
+	if err != nil {
+		return "", User{}, err
+	}
+	return raw, user, nil
+}
+
+// IssuePasswordResetToken returns a single-use token that sets a new password
+// for the account with the email. Earlier reset tokens of the user stop
+// working.
+func (s *Service) IssuePasswordResetToken(email string, ttl time.Duration) (string, User, error) {
+	normalized := strings.ToLower(strings.TrimSpace(email))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, exists := s.usersByEmail[normalized]
+	if !exists {
+		return "", User{}, ErrUserNotFound
+	}
+	raw, err := s.issueActionTokenLocked(userID, TokenPurposePasswordReset, ttl)
+	if err != nil {
+		return "", User{}, err
+	}
+	return raw, s.usersByID[userID], nil
+}
+
+// GetUserByEmail looks a user up by normalized email.
+func (s *Service) GetUserByEmail(email string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, exists := s.usersByEmail[strings.ToLower(strings.TrimSpace(email))]
+	if !exists {
+		return User{}, false
+	}
+	return s.usersByID[userID], true
+}
+
+// VerifyEmail consumes a verification token and marks the email as verified.
+func (s *Service) VerifyEmail(rawToken string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.consumeActionTokenLocked(rawToken, TokenPurposeEmailVerification)
+	if err != nil {
+		return User{}, err
+	}
+	user, exists := s.usersByID[token.UserID]
+	if !exists {
+		return User{}, ErrInvalidActionToken
+	}
+	if user.EmailVerifiedAt == nil {
+		verifiedAt := time.Now().UTC()
+		user.EmailVerifiedAt = &verifiedAt
+		s.usersByID[user.ID] = user
+	}
+	return user, nil
+}
+
+// ResetPassword consumes a reset token, sets the new password and revokes all
+// of the user's sessions. It returns the user and the number of revoked
+// sessions. Completing a reset also proves control of the email address.
+func (s *Service) ResetPassword(rawToken, newPassword string) (User, int, error) {
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return User{}, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.consumeActionTokenLocked(rawToken, TokenPurposePasswordReset)
+	if err != nil {
+		return User{}, 0, err
+	}
+	user, exists := s.usersByID[token.UserID]
+	if !exists {
+		return User{}, 0, ErrInvalidActionToken
+	}
+
+	user.PasswordHash = hash
+	if user.EmailVerifiedAt == nil {
+		verifiedAt := time.Now().UTC()
+		user.EmailVerifiedAt = &verifiedAt
+	}
+	s.usersByID[user.ID] = user
+	return user, s.revokeUserSessionsLocked(user.ID, ""), nil
+}
+
+func (s *Service) issueActionTokenLocked(userID string, purpose TokenPurpose, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	for hash, token := range s.actionTokens {
+		if token.UserID == userID && token.Purpose == purpose || token.ExpiresAt.Before(now) {
+			delete(s.actionTokens, hash)
+		}
+	}
+	s.actionTokens[HashToken(raw)] = actionToken{UserID: userID, Purpose: purpose, ExpiresAt: now.Add(ttl)}
+	return raw, nil
+}
+
+// consumeActionTokenLocked deletes the token whatever its state, so a token
+// is accepted at most once.
+func (s *Service) consumeActionTokenLocked(rawToken string, purpose TokenPurpose) (actionToken, error) {
+	hash := HashToken(strings.TrimSpace(rawToken))
+	token, exists := s.actionTokens[hash]
+	if !exists || token.Purpose != purpose {
+		return actionToken{}, ErrInvalidActionToken
+	}
+	delete(s.actionTokens, hash)
+	if !token.ExpiresAt.After(time.Now().UTC()) {
+		return actionToken{}, ErrInvalidActionToken
+	}
+	return token, nil
+}
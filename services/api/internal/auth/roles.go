@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRoleName   = errors.New("invalid role name")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrBuiltInRole       = errors.New("built-in roles cannot be changed")
+	ErrRoleInUse         = errors.New("role is assigned to users")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrLastSuperAdmin    = errors.New("the last super admin cannot be reassigned")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,47}$`)
+
+// RoleDefinition describes a role and the permissions it grants. Built-in
+// roles come from the compile-time matrix; custom roles are created by super
+// admins at runtime from the same permission set.
+type RoleDefinition struct {
+	Name        Role
+	Description string
+	Permissions []Permission
+	BuiltIn     bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func validRoleName(role Role) bool {
+	return roleNamePattern.MatchString(string(role))
+}
+
+// superAdminPermissions cannot be granted to custom roles. A role holding one
+// of them could widen its own access, decide who must use MFA or act as any
+// user.
+var superAdminPermissions = map[Permission]bool{
+	PermissionManageRoles:              true,
+	PermissionManageSecuritySettings:   true,
+	PermissionImpersonateUsers:         true,
+	PermissionImpersonateUsersElevated: true,
+}
+
+// GrantablePermissions returns the permissions a custom role may grant:
+// everything but the permissions reserved to super admins.
+func GrantablePermissions() []Permission {
+	grantable := make([]Permission, 0, len(Permissions()))
+	for _, permission := range Permissions() {
+		if !superAdminPermissions[permission] {
+			grantable = append(grantable, permission)
+		}
+	}
+	return grantable
+}
+
+func normalizePermissions(permissions []Permission) ([]Permission, error) {
+	grantable := make(map[Permission]bool)
+	for _, permission := range GrantablePermissions() {
+		grantable[permission] = true
+	}
+
+	seen := make(map[Permission]bool, len(permissions))
+	normalized := make([]Permission, 0, len(permissions))
+	for _, raw := range permissions {
+		permission := Permission(strings.ToLower(strings.TrimSpace(string(raw))))
+		if !grantable[permission] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, raw)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			normalized = append(normalized, permission)
+		}
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i] < normalized[j] })
+	return normalized, nil
+}
+
+func builtInRoleDefinition(role Role) RoleDefinition {
+	permissions := make([]Permission, 0, len(permissionMatrix[role]))
+	for permission, allowed := range permissionMatrix[role] {
+		if allowed {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return RoleDefinition{Name: role, Permissions: permissions, BuiltIn: true}
+}
+
+// knownRoleLocked reports whether a role is built in or was created at
+// runtime. Callers hold s.mu.
+func (s *Service) knownRoleLocked(role Role) bool {
+	if isKnownRole(role) {
+		return true
+	}
+	_, exists := s.customRoles[role]
+	return exists
+}
+
+// KnownRole reports whether a role is built in or was created at runtime.
+func (s *Service) KnownRole(role Role) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.knownRoleLocked(role)
+}
+
+// RolePermissions returns the current grants of a custom role, or nil for
+// built-in and unknown roles. Tokens carry them from issue time and
+// LivePermissions narrows them to the role's current grants.
+func (s *Service) RolePermissions(role Role) []Permission {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	definition, exists := s.customRoles[role]
+	if !exists {
+		return nil
+	}
+	return append([]Permission(nil), definition.Permissions...)
+}
+
+// LivePermissions returns the permissions signed into a custom role's token
+// that the role still grants, or nil for built-in and unknown roles. A
+// permission removed from a role stops working on the holder's next request;
+// added permissions wait for the next refresh.
+func (s *Service) LivePermissions(role Role, signed []Permission) []Permission {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	definition, exists := s.customRoles[role]
+	if !exists {
+		return nil
+	}
+
+	current := make(map[Permission]bool, len(definition.Permissions))
+	for _, permission := range definition.Permissions {
+		current[permission] = true
+	}
+	live := make([]Permission, 0, len(signed))
+	for _, permission := range signed {
+		if current[permission] {
+			live = append(live, permission)
+		}
+	}
+	return live
+}
+
+// RoleDefinitions lists the built-in roles followed by the custom roles by
+// name.
+func (s *Service) RoleDefinitions() []RoleDefinition {
+	definitions := make([]RoleDefinition, 0, len(Roles()))
+	for _, role := range Roles() {
+		definitions = append(definitions, builtInRoleDefinition(role))
+	}
+
+	s.mu.RLock()
+	custom := make([]RoleDefinition, 0, len(s.customRoles))
+	for _, definition := range s.customRoles {
+		custom = append(custom, definition)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(custom, func(i, j int) bool { return custom[i].Name < custom[j].Name })
+	return append(definitions, custom...)
+}
+
+// RoleDefinition returns a built-in or custom role.
+func (s *Service) RoleDefinition(role Role) (RoleDefinition, bool) {
+	if isKnownRole(role) {
+		return builtInRoleDefinition(role), true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	definition, exists := s.customRoles[role]
+	return definition, exists
+}
+
+// CreateRole adds a custom role granting the given permissions.
+func (s *Service) CreateRole(name Role, description string, permissions []Permission) (RoleDefinition, error) {
+	name = Role(strings.ToLower(strings.TrimSpace(string(name))))
+	if !validRoleName(name) {
+		return RoleDefinition{}, ErrInvalidRoleName
+	}
+	normalized, err := normalizePermissions(permissions)
+	if err != nil {
+		return RoleDefinition{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.knownRoleLocked(name) {
+		return RoleDefinition{}, ErrRoleExists
+	}
+	now := time.Now().UTC()
+	definition := RoleDefinition{
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		Permissions: normalized,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.customRoles[name] = definition
+	return definition, nil
+}
+
+// UpdateRole replaces a custom role's description and permissions and
+// returns the role before and after. Removed permissions stop working at once;
+// holders get added permissions when their tokens are next issued or
+// refreshed.
+func (s *Service) UpdateRole(name Role, description string, permissions []Permission) (RoleDefinition, RoleDefinition, error) {
+	if isKnownRole(name) {
+		return RoleDefinition{}, RoleDefinition{}, ErrBuiltInRole
+	}
+	normalized, err := normalizePermissions(permissions)
+	if err != nil {
+		return RoleDefinition{}, RoleDefinition{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, exists := s.customRoles[name]
+	if !exists {
+		return RoleDefinition{}, RoleDefinition{}, ErrUnknownRole
+	}
+	after := before
+	after.Description = strings.TrimSpace(description)
+	after.Permissions = normalized
+	after.UpdatedAt = time.Now().UTC()
+	s.customRoles[name] = after
+	return before, after, nil
+}
+
+// DeleteRole removes a custom role that no user holds.
+func (s *Service) DeleteRole(name Role) (RoleDefinition, error) {
+	if isKnownRole(name) {
+		return RoleDefinition{}, ErrBuiltInRole
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	definition, exists := s.customRoles[name]
+	if !exists {
+		return RoleDefinition{}, ErrUnknownRole
+	}
+	for _, user := range s.usersByID {
+		if user.Role == name {
+			return RoleDefinition{}, ErrRoleInUse
+		}
+	}
+	delete(s.customRoles, name)
+	delete(s.mfaRequiredRoles, name)
+	return definition, nil
+}
+
+// UsersWithRole lists the users holding a role, oldest first.
+func (s *Service) UsersWithRole(role Role) []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0)
+	for _, user := range s.usersByID {
+		if user.Role == role {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// AssignRole gives a user a built-in staff role, a custom role or the buyer
+// role and returns the user before and after. Vendor roles follow vendor team
+// membership and cannot be assigned here, and the last super admin keeps
+// their role. The change reaches the user's tokens on their next refresh.
+func (s *Service) AssignRole(userID string, role Role) (User, User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.knownRoleLocked(role) {
+		return User{}, User{}, fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+	before, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, User{}, ErrUserNotFound
+	}
+	if IsVendorRole(role) || before.VendorID != nil {
+		return User{}, User{}, ErrRoleNotAssignable
+	}
+	if before.Role == RoleSuperAdmin && role != RoleSuperAdmin && s.countRoleLocked(RoleSuperAdmin) == 1 {
+		return User{}, User{}, ErrLastSuperAdmin
+	}
+
+	after := before
+	after.Role = role
+	s.usersByID[userID] = after
+	return before, after, nil
+}
+
+func (s *Service) countRoleLocked(role Role) int {
+	count := 0
+	for _, user := range s.usersByID {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count
+}
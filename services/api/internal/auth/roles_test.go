@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCustomRolesGrantPermissionsAndFollowAssignment(t *testing.T) {
+	svc := NewService(map[string]Role{"admin@example.com": RoleSuperAdmin})
+	admin, _ := svc.Register("admin@example.com", "strong-password")
+	user, _ := svc.Register("analyst@example.com", "strong-password")
+	allowed := func(role Role, permission Permission) bool {
+		return Identity{Role: role, Permissions: svc.RolePermissions(role)}.Allowed(permission)
+	}
+
+	for _, name := range []Role{"ab", "Has Space", "9lives"} {
+		if _, err := svc.CreateRole(name, "", nil); !errors.Is(err, ErrInvalidRoleName) {
+			t.Fatalf("CreateRole(%q) expected ErrInvalidRoleName, got %v", name, err)
+		}
+	}
+	if _, err := svc.CreateRole("support", "", nil); !errors.Is(err, ErrRoleExists) {
+		t.Fatalf("expected built-in names to be taken, got %v", err)
+	}
+	if _, err := svc.CreateRole("analyst", "", []Permission{"fly"}); !errors.Is(err, ErrUnknownPermission) {
+		t.Fatalf("expected ErrUnknownPermission, got %v", err)
+	}
+	if _, err := svc.CreateRole("escalator", "", []Permission{PermissionManageRoles}); !errors.Is(err, ErrUnknownPermission) {
+		t.Fatalf("expected manage_roles not to be grantable, got %v", err)
+	}
+
+	analyst, err := svc.CreateRole(" Analyst ", "Reads reports", []Permission{PermissionViewAuditLogs, PermissionViewAdminAnalytics, PermissionViewAuditLogs})
+	if err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	if analyst.Name != "analyst" || len(analyst.Permissions) != 2 || analyst.Permissions[0] != PermissionViewAdminAnalytics {
+		t.Fatalf("unexpected role: %+v", analyst)
+	}
+	if !allowed("analyst", PermissionViewAuditLogs) || allowed("analyst", PermissionManageCommission) {
+		t.Fatal("expected the custom role to grant exactly its permissions")
+	}
+	if !allowed(RoleFinance, PermissionManageCommission) || allowed("ghost", PermissionViewCatalog) {
+		t.Fatal("expected built-in roles to follow the matrix and unknown roles nothing")
+	}
+	if definitions := svc.RoleDefinitions(); len(definitions) != len(Roles())+1 || definitions[len(definitions)-1].Name != "analyst" {
+		t.Fatalf("expected built-ins followed by custom roles, got %d", len(definitions))
+	}
+
+	if _, _, err := svc.AssignRole(user.ID, "ghost"); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("expected ErrUnknownRole, got %v", err)
+	}
+	if _, _, err := svc.AssignRole(user.ID, RoleVendorOwner); !errors.Is(err, ErrRoleNotAssignable) {
+		t.Fatalf("expected vendor roles to be refused, got %v", err)
+	}
+	if _, _, err := svc.AssignRole(admin.ID, RoleBuyer); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Fatalf("expected ErrLastSuperAdmin, got %v", err)
+	}
+	before, after, err := svc.AssignRole(user.ID, "analyst")
+	if err != nil || before.Role != RoleBuyer || after.Role != "analyst" {
+		t.Fatalf("AssignRole() = %v -> %v err=%v", before.Role, after.Role, err)
+	}
+	if holders := svc.UsersWithRole("analyst"); len(holders) != 1 || holders[0].ID != user.ID {
+		t.Fatalf("unexpected holders: %+v", holders)
+	}
+
+	if err := svc.SetMFARequiredRoles([]Role{"analyst"}); err != nil || !svc.MFARequired(user.ID, "analyst") {
+		t.Fatalf("expected custom roles in the MFA policy, err=%v", err)
+	}
+	if _, _, err := svc.UpdateRole(RoleSupport, "", nil); !errors.Is(err, ErrBuiltInRole) {
+		t.Fatalf("expected ErrBuiltInRole, got %v", err)
+	}
+	if _, updated, err := svc.UpdateRole("analyst", "Audit only", []Permission{PermissionViewAuditLogs}); err != nil || len(updated.Permissions) != 1 {
+		t.Fatalf("UpdateRole() = %+v err=%v", updated, err)
+	}
+	if allowed("analyst", PermissionViewAdminAnalytics) {
+		t.Fatal("expected the removed permission to be gone")
+	}
+
+	if _, err := svc.DeleteRole("analyst"); !errors.Is(err, ErrRoleInUse) {
+		t.Fatalf("expected ErrRoleInUse, got %v", err)
+	}
+	_, _, _ = svc.AssignRole(user.ID, RoleBuyer)
+	if _, err := svc.DeleteRole("analyst"); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	if svc.KnownRole("analyst") || len(svc.MFARequiredRoles()) != 0 {
+		t.Fatal("expected the deleted role to be gone from the registry and MFA policy")
+	}
+}
+
+func TestSuperAdminPermissionsAreNotGrantable(t *testing.T) {
+	grantable := make(map[Permission]bool)
+	for _, permission := range GrantablePermissions() {
+		grantable[permission] = true
+	}
+	for _, permission := range []Permission{PermissionManageRoles, PermissionManageSecuritySettings, PermissionImpersonateUsers, PermissionImpersonateUsersElevated} {
+		if grantable[permission] {
+			t.Fatalf("expected %s to stay with super admins", permission)
+		}
+	}
+	if !grantable[PermissionViewAuditLogs] || len(grantable) != len(Permissions())-len(superAdminPermissions) {
+		t.Fatalf("expected every other permission to be grantable, got %d", len(grantable))
+	}
+
+	svc := NewService(nil)
+	if _, err := svc.CreateRole("delegate", "", []Permission{PermissionImpersonateUsers}); !errors.Is(err, ErrUnknownPermission) {
+		t.Fatalf("expected impersonate_users to be refused, got %v", err)
+	}
+}
+
+func TestLivePermissionsDropRemovedGrantsBeforeRefresh(t *testing.T) {
+	svc := NewService(nil)
+	if _, err := svc.CreateRole("analyst", "", []Permission{PermissionViewAuditLogs, PermissionViewAdminAnalytics}); err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	signed := svc.RolePermissions("analyst")
+
+	if _, _, err := svc.UpdateRole("analyst", "", []Permission{PermissionViewAuditLogs, PermissionManageCommission}); err != nil {
+		t.Fatalf("UpdateRole() error = %v", err)
+	}
+	live := svc.LivePermissions("analyst", signed)
+	if len(live) != 1 || live[0] != PermissionViewAuditLogs {
+		t.Fatalf("expected only the still-granted permission signed into the token, got %v", live)
+	}
+	if svc.LivePermissions(RoleSupport, signed) != nil || svc.LivePermissions("ghost", signed) != nil {
+		t.Fatal("expected nil for built-in and unknown roles")
+	}
+}
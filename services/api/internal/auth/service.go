@@ -14,6 +14,8 @@ var (
 	ErrInvalidCredentials  = errors.New("invalid credentials")
 	ErrUserNotFound        = errors.New("user not found")
 	ErrVendorAlreadyLinked = errors.New("vendor already linked")
+	ErrInvalidActionToken  = errors.New("token is invalid, expired or already used")
+	ErrRoleNotAssignable   = errors.New("role cannot be assigned to this user")
 )
 
 // User is the in-memory auth aggregate root used during foundation phase.
@@ -24,14 +26,34 @@ type User struct {
 	Role         Role
 	VendorID     *string
 	CreatedAt    time.Time
+	// EmailVerifiedAt is set once the user confirmed their email address.
+	EmailVerifiedAt *time.Time
+	// MFAEnabledAt is set once the user confirmed a TOTP authenticator.
+	MFAEnabledAt *time.Time
+	// ExternalIdentities are the OpenID provider accounts that sign in as
+	// the user. Users created by a provider login have no password.
+	ExternalIdentities []ExternalIdentity
+
+	totpSecret         string
+	pendingTOTPSecret  string
+	totpLastStep       int64
+	recoveryCodeHashes []string
 }
 
-// Session is the auth refresh-session state tracked server-side.
+// Session is the auth refresh-session state tracked server-side. A session
+// keeps its ID for its whole life; each refresh replaces RefreshTokenHash.
 type Session struct {
 	ID               string
 	UserID           string
 	RefreshTokenHash string
 	ExpiresAt        time.Time
+	// MFAVerified records that the session was opened with a second factor;
+	// refreshed tokens keep it.
+	MFAVerified bool
+	IP          string
+	UserAgent   string
+	CreatedAt   time.Time
+	LastUsedAt  time.Time
 }
 
 // Service provides first-party auth and session management behavior.
@@ -41,6 +63,18 @@ type Service struct {
 	usersByEmail   map[string]string
 	sessionsByID   map[string]Session
 	bootstrapRoles map[string]Role
+	// actionTokens holds email verification and password reset tokens by
+	// hash; the raw token only ever reaches the user's inbox.
+	actionTokens map[string]actionToken
+	// mfaRequiredRoles lists the roles that must pass MFA before using
+	// privileged permissions.
+	mfaRequiredRoles map[Role]bool
+	// externalIdentities maps provider and subject to the linked user.
+	externalIdentities map[string]string
+	// customRoles are the roles super admins created at runtime.
+	customRoles map[Role]RoleDefinition
+	// impersonations are staff sessions viewing the marketplace as a user.
+	impersonations map[string]Impersonation
 }
 
 func NewService(bootstrapRoles map[string]Role) *Service {
@@ -50,10 +84,15 @@ func NewService(bootstrapRoles map[string]Role) *Service {
 	}
 
 	return &Service{
-		usersByID:      make(map[string]User),
-		usersByEmail:   make(map[string]string),
-		sessionsByID:   make(map[string]Session),
-		bootstrapRoles: normalized,
+		usersByID:          make(map[string]User),
+		usersByEmail:       make(map[string]string),
+		sessionsByID:       make(map[string]Session),
+		bootstrapRoles:     normalized,
+		actionTokens:       make(map[string]actionToken),
+		mfaRequiredRoles:   make(map[Role]bool),
+		externalIdentities: make(map[string]string),
+		customRoles:        make(map[Role]RoleDefinition),
+		impersonations:     make(map[string]Impersonation),
 	}
 }
 
@@ -158,6 +197,54 @@ func (s *Service) AttachVendor(userID, vendorID string) (User, error) {
 	return user, nil
 }
 
+// SetVendorRole gives a vendor team member their vendor role. Buyers join
+// the team; members of the vendor change role. Staff accounts and members
+// of other vendors are refused.
+func (s *Service) SetVendorRole(userID, vendorID string, role Role) (User, error) {
+	if !IsVendorRole(role) {
+		return User{}, ErrRoleNotAssignable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	if user.VendorID != nil && *user.VendorID != vendorID {
+		return User{}, ErrVendorAlreadyLinked
+	}
+	if user.VendorID == nil && user.Role != RoleBuyer {
+		return User{}, ErrRoleNotAssignable
+	}
+
+	user.Role = role
+	userVendorID := vendorID
+	user.VendorID = &userVendorID
+	s.usersByID[userID] = user
+	return user, nil
+}
+
+// DetachVendor turns a former vendor team member back into a buyer.
+func (s *Service) DetachVendor(userID, vendorID string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return User{}, ErrUserNotFound
+	}
+	if user.VendorID == nil || *user.VendorID != vendorID {
+		return user, nil
+	}
+
+	user.Role = RoleBuyer
+	user.VendorID = nil
+	s.usersByID[userID] = user
+	return user, nil
+}
+
 func (s *Service) SaveSession(session Session) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -176,3 +263,30 @@ func (s *Service) DeleteSession(sessionID string) {
 	defer s.mu.Unlock()
 	delete(s.sessionsByID, sessionID)
 }
+
+// RevokeUserSessions deletes every refresh session of a user and returns how
+// many were revoked.
+func (s *Service) RevokeUserSessions(userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revokeUserSessionsLocked(userID, "")
+}
+
+// RevokeOtherSessions deletes every refresh session of a user except
+// keepSessionID and returns how many were revoked.
+func (s *Service) RevokeOtherSessions(userID, keepSessionID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revokeUserSessionsLocked(userID, keepSessionID)
+}
+
+func (s *Service) revokeUserSessionsLocked(userID, keepSessionID string) int {
+	revoked := 0
+	for id, session := range s.sessionsByID {
+		if session.UserID == userID && id != keepSessionID {
+			delete(s.sessionsByID, id)
+			revoked++
+		}
+	}
+	return revoked
+}
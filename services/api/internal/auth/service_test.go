@@ -1,6 +1,10 @@
 package auth
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+)
 
 func TestRegisterAuthenticateAndAttachVendor(t *testing.T) {
 	service := NewService(BuildBootstrapRoleMap("", "", "", ""))
@@ -51,3 +55,156 @@ func TestBootstrapRoles(t *testing.T) {
 		t.Fatalf("expected super_admin role, got %s", user.Role)
 	}
 }
+
+func TestEmailVerificationAndPasswordResetTokens(t *testing.T) {
+	service := NewService(BuildBootstrapRoleMap("", "", "", ""))
+	user, err := service.Register("buyer@example.com", "strong-password")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if user.EmailVerifiedAt != nil {
+		t.Fatal("expected a new account to be unverified")
+	}
+
+	stale, _, err := service.IssueEmailVerificationToken(user.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueEmailVerificationToken() error = %v", err)
+	}
+	fresh, _, _ := service.IssueEmailVerificationToken(user.ID, time.Hour)
+	if _, err := service.VerifyEmail(stale); err != ErrInvalidActionToken {
+		t.Fatalf("expected a superseded token to be rejected, got %v", err)
+	}
+	if _, _, err := service.ResetPassword(fresh, "new-strong-password"); err != ErrInvalidActionToken {
+		t.Fatalf("expected a verification token to be refused for a reset, got %v", err)
+	}
+	verified, err := service.VerifyEmail(fresh)
+	if err != nil || verified.EmailVerifiedAt == nil {
+		t.Fatalf("VerifyEmail() = %+v err=%v", verified, err)
+	}
+
+	if _, _, err := service.IssuePasswordResetToken("missing@example.com", time.Hour); err != ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	expired, _, _ := service.IssuePasswordResetToken("buyer@example.com", -time.Minute)
+	if _, _, err := service.ResetPassword(expired, "new-strong-password"); err != ErrInvalidActionToken {
+		t.Fatalf("expected an expired token to be rejected, got %v", err)
+	}
+
+	service.SaveSession(Session{ID: "ses_1", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	service.SaveSession(Session{ID: "ses_2", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	reset, _, _ := service.IssuePasswordResetToken(" Buyer@Example.com ", time.Hour)
+	if _, _, err := service.ResetPassword(reset, "short"); err != ErrWeakPassword {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+	if _, revoked, err := service.ResetPassword(reset, "new-strong-password"); err != nil || revoked != 2 {
+		t.Fatalf("expected both sessions revoked, got %d err=%v", revoked, err)
+	}
+	if _, _, err := service.ResetPassword(reset, "another-password"); err != ErrInvalidActionToken {
+		t.Fatalf("expected the reset token to be single-use, got %v", err)
+	}
+	if _, exists := service.GetSession("ses_1"); exists {
+		t.Fatal("expected sessions to be revoked after a reset")
+	}
+	if _, err := service.Authenticate("buyer@example.com", "new-strong-password"); err != nil {
+		t.Fatalf("expected the new password to work, got %v", err)
+	}
+}
+
+func TestExternalIdentitySignInLinksByVerifiedEmail(t *testing.T) {
+	service := NewService(BuildBootstrapRoleMap("", "", "finance@example.com", ""))
+	existing, err := service.Register("buyer@example.com", "strong-password")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	if _, _, _, err := service.SignInWithExternalIdentity(ExternalIdentity{Provider: "acme", Subject: "1", Email: "buyer@example.com"}, false); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("expected an unverified email not to link, got %v", err)
+	}
+	// Whoever registered the address may not own it, so an unverified
+	// account is never linked from a provider login.
+	if _, _, _, err := service.SignInWithExternalIdentity(ExternalIdentity{Provider: "acme", Subject: "1", Email: "buyer@example.com"}, true); !errors.Is(err, ErrLinkRequiresSignIn) {
+		t.Fatalf("expected an unverified account not to be linked, got %v", err)
+	}
+	token, _, err := service.IssueEmailVerificationToken(existing.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueEmailVerificationToken() error = %v", err)
+	}
+	if _, err := service.VerifyEmail(token); err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	user, linked, created, err := service.SignInWithExternalIdentity(ExternalIdentity{Provider: "Acme", Subject: "1", Email: "Buyer@Example.com"}, true)
+	if err != nil || user.ID != existing.ID || !linked || created || user.EmailVerifiedAt == nil {
+		t.Fatalf("expected the verified email to link the existing user, got %+v linked=%v created=%v err=%v", user, linked, created, err)
+	}
+	// Later logins find the identity even if the provider's email changed.
+	user, linked, _, err = service.SignInWithExternalIdentity(ExternalIdentity{Provider: "acme", Subject: "1", Email: "renamed@example.com"}, false)
+	if err != nil || user.ID != existing.ID || linked {
+		t.Fatalf("expected the linked identity to sign in, got %+v linked=%v err=%v", user, linked, err)
+	}
+
+	staff, _, created, err := service.SignInWithExternalIdentity(ExternalIdentity{Provider: "acme", Subject: "2", Email: "finance@example.com"}, true)
+	if err != nil || !created || staff.Role != RoleFinance || staff.PasswordHash != "" {
+		t.Fatalf("expected a new passwordless user with the bootstrap role, got %+v created=%v err=%v", staff, created, err)
+	}
+	if _, err := service.Authenticate("finance@example.com", ""); err == nil {
+		t.Fatal("expected a passwordless user not to sign in with an empty password")
+	}
+	if _, err := service.LinkExternalIdentity(staff.ID, ExternalIdentity{Provider: "acme", Subject: "1"}); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Fatalf("expected an identity linked elsewhere to be refused, got %v", err)
+	}
+	if _, _, err := service.UnlinkExternalIdentity(staff.ID, "acme"); !errors.Is(err, ErrLastSignInMethod) {
+		t.Fatalf("expected the last sign-in method to stay, got %v", err)
+	}
+
+	user, removed, err := service.UnlinkExternalIdentity(existing.ID, "acme")
+	if err != nil || removed.Subject != "1" || len(user.ExternalIdentities) != 0 {
+		t.Fatalf("UnlinkExternalIdentity() user=%+v removed=%+v err=%v", user, removed, err)
+	}
+	if _, _, err := service.UnlinkExternalIdentity(existing.ID, "acme"); !errors.Is(err, ErrIdentityNotLinked) {
+		t.Fatalf("expected ErrIdentityNotLinked, got %v", err)
+	}
+	if user, err = service.LinkExternalIdentity(staff.ID, ExternalIdentity{Provider: "acme", Subject: "1"}); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Fatalf("expected one identity per provider, got %v", err)
+	}
+}
+
+func TestRotateSessionRevokesFamilyOnReuse(t *testing.T) {
+	service := NewService(nil)
+	user, err := service.Register("buyer@example.com", "strong-password")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	expiresAt := time.Now().UTC().Add(time.Hour)
+	service.SaveSession(Session{ID: "ses_1", UserID: user.ID, RefreshTokenHash: HashToken("first"), ExpiresAt: expiresAt})
+	service.SaveSession(Session{ID: "ses_2", UserID: user.ID, RefreshTokenHash: HashToken("other"), ExpiresAt: expiresAt})
+
+	rotated, err := service.RotateSession("ses_1", HashToken("first"), SessionRotation{
+		RefreshTokenHash: HashToken("second"),
+		ExpiresAt:        expiresAt.Add(time.Hour),
+		IP:               "203.0.113.7",
+		UserAgent:        "test-agent",
+	})
+	if err != nil || rotated.ID != "ses_1" || rotated.IP != "203.0.113.7" || rotated.LastUsedAt.IsZero() {
+		t.Fatalf("RotateSession() = %+v err=%v", rotated, err)
+	}
+
+	if _, err := service.RotateSession("ses_1", HashToken("first"), SessionRotation{RefreshTokenHash: HashToken("third"), ExpiresAt: expiresAt}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected reuse to be detected, got %v", err)
+	}
+	if _, exists := service.GetSession("ses_1"); exists {
+		t.Fatal("expected reuse to revoke the session")
+	}
+	if _, err := service.RotateSession("ses_1", HashToken("second"), SessionRotation{}); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected the newest token of a revoked session to fail, got %v", err)
+	}
+
+	if sessions := service.UserSessions(user.ID); len(sessions) != 1 || sessions[0].ID != "ses_2" {
+		t.Fatalf("UserSessions() = %+v", sessions)
+	}
+	if _, err := service.RevokeSession("usr_other", "ses_2"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected another user's session to be hidden, got %v", err)
+	}
+	if _, err := service.RevokeSession(user.ID, "ses_2"); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+}
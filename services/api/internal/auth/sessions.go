@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionExpired     = errors.New("session expired")
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// SessionRotation is the refresh token that replaces the presented one and
+// the client that presented it.
+type SessionRotation struct {
+	RefreshTokenHash string
+	ExpiresAt        time.Time
+	IP               string
+	UserAgent        string
+}
+
+// RotateSession swaps the session's refresh token for the next one. Refresh
+// tokens are signed for one session, so a valid token that is not the
+// session's current one was already rotated out: someone replayed it, and
+// the session is revoked along with every token it issued.
+func (s *Service) RotateSession(sessionID, presentedTokenHash string, next SessionRotation) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessionsByID[sessionID]
+	if !exists {
+		return Session{}, ErrSessionNotFound
+	}
+	now := time.Now().UTC()
+	if !session.ExpiresAt.After(now) {
+		delete(s.sessionsByID, sessionID)
+		return Session{}, ErrSessionExpired
+	}
+	if session.RefreshTokenHash != presentedTokenHash {
+		delete(s.sessionsByID, sessionID)
+		return session, ErrRefreshTokenReused
+	}
+
+	session.RefreshTokenHash = next.RefreshTokenHash
+	session.ExpiresAt = next.ExpiresAt
+	session.IP = next.IP
+	session.UserAgent = next.UserAgent
+	session.LastUsedAt = now
+	s.sessionsByID[sessionID] = session
+	return session, nil
+}
+
+// UserSessions lists the user's live sessions, most recently used first.
+func (s *Service) UserSessions(userID string) []Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now().UTC()
+	sessions := make([]Session, 0)
+	for _, session := range s.sessionsByID {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions
+}
+
+// RevokeSession deletes one of the user's sessions. Sessions of other users
+// are reported as not found.
+func (s *Service) RevokeSession(userID, sessionID string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessionsByID[sessionID]
+	if !exists || session.UserID != userID {
+		return Session{}, ErrSessionNotFound
+	}
+	delete(s.sessionsByID, sessionID)
+	return session, nil
+}
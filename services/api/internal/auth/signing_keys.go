@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrInvalidSigningKey = errors.New("invalid signing key")
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	minRSAKeyBits = 2048
+)
+
+// SigningKey is a private key that signs tokens under its key ID (kid).
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	private   crypto.Signer
+}
+
+// ParseSigningKeyPEM reads an RSA (PKCS#1 or PKCS#8) or Ed25519 (PKCS#8)
+// private key. RSA keys sign RS256 and Ed25519 keys sign EdDSA.
+func ParseSigningKeyPEM(id string, pemBytes []byte) (SigningKey, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return SigningKey{}, fmt.Errorf("%w: key id must not be empty", ErrInvalidSigningKey)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("%w: %s is not PEM encoded", ErrInvalidSigningKey, id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("%w: %s has unsupported PEM type %q", ErrInvalidSigningKey, id, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("%w: %s: %v", ErrInvalidSigningKey, id, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return SigningKey{}, fmt.Errorf("%w: %s must be at least %d bits", ErrInvalidSigningKey, id, minRSAKeyBits)
+		}
+		return SigningKey{ID: id, Algorithm: AlgorithmRS256, private: key}, nil
+	case ed25519.PrivateKey:
+		return SigningKey{ID: id, Algorithm: AlgorithmEdDSA, private: key}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("%w: %s must be an RSA or Ed25519 key", ErrInvalidSigningKey, id)
+	}
+}
+
+// LoadSigningKeys parses comma-separated kid=source pairs. A source is the
+// path of a PEM file, or the PEM itself base64 encoded behind a "base64:"
+// prefix for deployments that keep keys in their secret store.
+func LoadSigningKeys(specs string) ([]SigningKey, error) {
+	keys := make([]SigningKey, 0)
+	for _, raw := range strings.Split(specs, ",") {
+		spec := strings.TrimSpace(raw)
+		if spec == "" {
+			continue
+		}
+		id, source, found := strings.Cut(spec, "=")
+		if !found || strings.TrimSpace(source) == "" {
+			return nil, fmt.Errorf("%w: %q must be kid=source", ErrInvalidSigningKey, spec)
+		}
+		source = strings.TrimSpace(source)
+
+		var pemBytes []byte
+		var err error
+		if encoded, inline := strings.CutPrefix(source, "base64:"); inline {
+			pemBytes, err = base64.StdEncoding.DecodeString(encoded)
+		} else {
+			pemBytes, err = os.ReadFile(source)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSigningKey, strings.TrimSpace(id), err)
+		}
+
+		key, err := ParseSigningKeyPEM(id, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeySet is the active key that signs new tokens plus the previous keys,
+// which keep verifying tokens issued up to the grace period before the set
+// was loaded so that rotating keys does not sign anyone out.
+type KeySet struct {
+	active   SigningKey
+	keys     map[string]SigningKey
+	grace    time.Duration
+	loadedAt time.Time
+}
+
+// NewKeySet builds a key set. An empty activeID selects the first key.
+func NewKeySet(keys []SigningKey, activeID string, grace time.Duration) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: at least one key is required", ErrInvalidSigningKey)
+	}
+	if grace < 0 {
+		return nil, fmt.Errorf("%w: grace period must not be negative", ErrInvalidSigningKey)
+	}
+
+	set := &KeySet{keys: make(map[string]SigningKey, len(keys)), grace: grace, loadedAt: time.Now().UTC()}
+	for _, key := range keys {
+		if _, duplicate := set.keys[key.ID]; duplicate {
+			return nil, fmt.Errorf("%w: duplicate key id %s", ErrInvalidSigningKey, key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	activeID = strings.TrimSpace(activeID)
+	if activeID == "" {
+		activeID = keys[0].ID
+	}
+	active, ok := set.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("%w: active key %s is not configured", ErrInvalidSigningKey, activeID)
+	}
+	set.active = active
+	return set, nil
+}
+
+func (k *KeySet) ActiveKeyID() string {
+	return k.active.ID
+}
+
+func (key SigningKey) signingMethod() jwt.SigningMethod {
+	if key.Algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// acceptsRetired reports whether a token signed before the rotation, by a
+// retired key or the HMAC secret, is still within the grace period. Tokens
+// claiming to be issued after the rotation cannot be genuine.
+func (k *KeySet) acceptsRetired(issuedAt time.Time) bool {
+	return !issuedAt.After(k.loadedAt) && time.Since(issuedAt) <= k.grace
+}
+
+// verificationKey returns the public key for a token's kid and whether the
+// key was retired.
+func (k *KeySet) verificationKey(token *jwt.Token) (interface{}, bool, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := k.keys[id]
+	if !ok || token.Method.Alg() != key.Algorithm {
+		return nil, false, ErrInvalidToken
+	}
+	return key.private.Public(), id != k.active.ID, nil
+}
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public keys, active key first.
+func (k *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		if id != k.active.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids = append([]string{k.active.ID}, ids...)
+
+	document := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		document.Keys = append(document.Keys, jwk)
+	}
+	return document
+}
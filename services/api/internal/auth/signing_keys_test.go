@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func rsaKeyPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func ed25519KeyPEM(t *testing.T) []byte {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestLoadSigningKeysFromFilesAndConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rsa.pem")
+	if err := os.WriteFile(path, rsaKeyPEM(t), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	inline := base64.StdEncoding.EncodeToString(ed25519KeyPEM(t))
+
+	keys, err := LoadSigningKeys(" rsa-1=" + path + ", ed-1=base64:" + inline)
+	if err != nil {
+		t.Fatalf("LoadSigningKeys() error = %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "rsa-1" || keys[0].Algorithm != AlgorithmRS256 || keys[1].Algorithm != AlgorithmEdDSA {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	set, err := NewKeySet(keys, "ed-1", time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	document := set.JWKS()
+	if len(document.Keys) != 2 || document.Keys[0].KeyID != "ed-1" || document.Keys[0].KeyType != "OKP" || document.Keys[0].X == "" {
+		t.Fatalf("expected the active Ed25519 key first, got %+v", document.Keys)
+	}
+	if document.Keys[1].KeyType != "RSA" || document.Keys[1].N == "" || document.Keys[1].E != "AQAB" {
+		t.Fatalf("unexpected RSA jwk: %+v", document.Keys[1])
+	}
+
+	for _, spec := range []string{"rsa-1", "missing=" + filepath.Join(t.TempDir(), "nope.pem"), "bad=base64:!!"} {
+		if _, err := LoadSigningKeys(spec); !errors.Is(err, ErrInvalidSigningKey) {
+			t.Fatalf("LoadSigningKeys(%q) expected ErrInvalidSigningKey, got %v", spec, err)
+		}
+	}
+	if _, err := NewKeySet(keys, "unknown", time.Hour); !errors.Is(err, ErrInvalidSigningKey) {
+		t.Fatalf("expected an unknown active key to fail, got %v", err)
+	}
+}
+
+func TestKeyRotationAcceptsRetiredKeysDuringGracePeriod(t *testing.T) {
+	first, err := ParseSigningKeyPEM("key-1", rsaKeyPEM(t))
+	if err != nil {
+		t.Fatalf("ParseSigningKeyPEM() error = %v", err)
+	}
+	second, err := ParseSigningKeyPEM("key-2", ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatalf("ParseSigningKeyPEM() error = %v", err)
+	}
+	user := User{ID: "usr_1", Role: RoleBuyer}
+
+	legacy, _ := NewTokenManager("shared-secret", "marketplace-api", testDuration(900), testDuration(3600))
+	legacyPair, _ := legacy.IssueTokenPair(user, "ses_legacy", false)
+
+	before, _ := NewTokenManager("shared-secret", "marketplace-api", testDuration(900), testDuration(3600))
+	beforeKeys, _ := NewKeySet([]SigningKey{first}, "", time.Hour)
+	before.UseKeySet(beforeKeys)
+	oldPair, err := before.IssueTokenPair(user, "ses_1", false)
+	if err != nil {
+		t.Fatalf("IssueTokenPair() error = %v", err)
+	}
+	header, _, _ := new(jwt.Parser).ParseUnverified(oldPair.AccessToken, jwt.MapClaims{})
+	if header.Header["kid"] != "key-1" || header.Method.Alg() != AlgorithmRS256 {
+		t.Fatalf("unexpected token header: %+v", header.Header)
+	}
+	if _, err := before.ParseAndValidate(legacyPair.AccessToken, TokenTypeAccess); err != nil {
+		t.Fatalf("expected HMAC tokens to survive the switch to keys, got %v", err)
+	}
+
+	after, _ := NewTokenManager("shared-secret", "marketplace-api", testDuration(900), testDuration(3600))
+	afterKeys, _ := NewKeySet([]SigningKey{first, second}, "key-2", time.Hour)
+	after.UseKeySet(afterKeys)
+	newPair, _ := after.IssueTokenPair(user, "ses_2", false)
+	if claims, err := after.ParseAndValidate(newPair.AccessToken, TokenTypeAccess); err != nil || claims.SessionID != "ses_2" {
+		t.Fatalf("ParseAndValidate(new) = %+v err=%v", claims, err)
+	}
+	if _, err := after.ParseAndValidate(oldPair.RefreshToken, TokenTypeRefresh); err != nil {
+		t.Fatalf("expected retired key to verify within grace, got %v", err)
+	}
+	if _, err := before.ParseAndValidate(newPair.AccessToken, TokenTypeAccess); err != ErrInvalidToken {
+		t.Fatalf("expected an unknown kid to be rejected, got %v", err)
+	}
+
+	expired, _ := NewTokenManager("shared-secret", "marketplace-api", testDuration(900), testDuration(3600))
+	expiredKeys, _ := NewKeySet([]SigningKey{first, second}, "key-2", 0)
+	expired.UseKeySet(expiredKeys)
+	if _, err := expired.ParseAndValidate(oldPair.AccessToken, TokenTypeAccess); err != ErrInvalidToken {
+		t.Fatalf("expected retired key to be rejected after grace, got %v", err)
+	}
+	if _, err := expired.ParseAndValidate(legacyPair.AccessToken, TokenTypeAccess); err != ErrInvalidToken {
+		t.Fatalf("expected HMAC token to be rejected after grace, got %v", err)
+	}
+
+	afterKeys.loadedAt = time.Now().Add(-time.Minute)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		Role:      RoleBuyer.String(),
+		SessionID: "ses_forged",
+		TokenType: string(TokenTypeAccess),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Second)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	raw, _ := forged.SignedString([]byte("shared-secret"))
+	if _, err := after.ParseAndValidate(raw, TokenTypeAccess); err != ErrInvalidToken {
+		t.Fatalf("expected HMAC tokens minted after the rotation to be rejected, got %v", err)
+	}
+	if keys := legacy.JWKS().Keys; len(keys) != 0 {
+		t.Fatalf("expected no published keys while signing with HMAC, got %+v", keys)
+	}
+}
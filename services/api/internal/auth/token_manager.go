@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
 )
 
 type TokenType string
@@ -14,6 +15,9 @@ type TokenType string
 const (
 	TokenTypeAccess  TokenType = "access"
 	TokenTypeRefresh TokenType = "refresh"
+	// TokenTypeMFAChallenge proves the password step of a login and is only
+	// accepted to complete the MFA step.
+	TokenTypeMFAChallenge TokenType = "mfa_challenge"
 )
 
 var (
@@ -29,13 +33,31 @@ type Claims struct {
 	VendorID  *string
 	TokenType TokenType
 	ExpiresAt time.Time
+	// MFAVerified is set on tokens of sessions opened with a second factor.
+	MFAVerified bool
+	// ImpersonatorID is set on impersonation tokens, whose SessionID is the
+	// impersonation ID.
+	ImpersonatorID string
+	Elevated       bool
+	// Permissions are the grants of a custom role when the token was issued.
+	// Built-in roles are checked against the matrix instead.
+	Permissions []Permission
+}
+
+// actorClaim names the party acting for the subject (RFC 8693 "act").
+type actorClaim struct {
+	Subject string `json:"sub"`
 }
 
 type tokenClaims struct {
-	Role      string `json:"role"`
-	SessionID string `json:"sid"`
-	VendorID  string `json:"vendor_id,omitempty"`
-	TokenType string `json:"typ"`
+	Role      string      `json:"role"`
+	SessionID string      `json:"sid"`
+	VendorID  string      `json:"vendor_id,omitempty"`
+	TokenType string      `json:"typ"`
+	MFA       bool        `json:"mfa,omitempty"`
+	Actor     *actorClaim `json:"act,omitempty"`
+	Elevated  bool        `json:"elevated,omitempty"`
+	Perms     []string    `json:"perms,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -47,12 +69,16 @@ type TokenPair struct {
 	RefreshExpiresAt time.Time
 }
 
-// TokenManager signs and validates auth tokens.
+// TokenManager signs and validates auth tokens. It signs with the shared
+// HMAC secret until UseKeySet switches it to asymmetric keys.
 type TokenManager struct {
 	secret         []byte
 	issuer         string
 	accessTokenTTL time.Duration
 	refreshTTL     time.Duration
+	keys           *KeySet
+	// rolePermissions resolves the grants of custom roles at issue time.
+	rolePermissions func(Role) []Permission
 }
 
 func NewTokenManager(secret, issuer string, accessTokenTTL, refreshTTL time.Duration) (*TokenManager, error) {
@@ -74,17 +100,42 @@ func NewTokenManager(secret, issuer string, accessTokenTTL, refreshTTL time.Dura
 	}, nil
 }
 
-func (m *TokenManager) IssueTokenPair(user User, sessionID string) (TokenPair, error) {
+// UseKeySet signs new tokens with the key set's active key. Tokens signed
+// with the HMAC secret or a retired key stay valid for the key set's grace
+// period, so switching keys does not sign anyone out.
+func (m *TokenManager) UseKeySet(keys *KeySet) {
+	m.keys = keys
+}
+
+// UseRolePermissions resolves the permissions of custom roles, which are
+// signed into each token. Holders pick up changes to a role when their
+// tokens are next issued or refreshed.
+func (m *TokenManager) UseRolePermissions(resolve func(Role) []Permission) {
+	m.rolePermissions = resolve
+}
+
+// JWKS returns the public keys other services verify tokens with. It is
+// empty while tokens are signed with the HMAC secret.
+func (m *TokenManager) JWKS() JWKS {
+	if m.keys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return m.keys.JWKS()
+}
+
+// IssueTokenPair signs the tokens of a session. mfaVerified marks sessions
+// opened with a second factor.
+func (m *TokenManager) IssueTokenPair(user User, sessionID string, mfaVerified bool) (TokenPair, error) {
 	issuedAt := time.Now().UTC()
 	accessExpiry := issuedAt.Add(m.accessTokenTTL)
 	refreshExpiry := issuedAt.Add(m.refreshTTL)
 
-	accessToken, err := m.sign(user, sessionID, TokenTypeAccess, issuedAt, accessExpiry)
+	accessToken, err := m.sign(user, sessionID, TokenTypeAccess, mfaVerified, issuedAt, accessExpiry)
 	if err != nil {
 		return TokenPair{}, err
 	}
 
-	refreshToken, err := m.sign(user, sessionID, TokenTypeRefresh, issuedAt, refreshExpiry)
+	refreshToken, err := m.sign(user, sessionID, TokenTypeRefresh, mfaVerified, issuedAt, refreshExpiry)
 	if err != nil {
 		return TokenPair{}, err
 	}
@@ -97,12 +148,44 @@ func (m *TokenManager) IssueTokenPair(user User, sessionID string) (TokenPair, e
 	}, nil
 }
 
-func (m *TokenManager) sign(user User, sessionID string, tokenType TokenType, issuedAt, expiresAt time.Time) (string, error) {
+// IssueMFAChallenge signs a short-lived token for a user who passed the
+// password step and still has to enter a second factor.
+func (m *TokenManager) IssueMFAChallenge(user User, ttl time.Duration) (string, time.Time, error) {
+	if ttl <= 0 {
+		return "", time.Time{}, errors.New("mfa challenge ttl must be positive")
+	}
+	issuedAt := time.Now().UTC()
+	expiresAt := issuedAt.Add(ttl)
+	token, err := m.sign(user, "", TokenTypeMFAChallenge, false, issuedAt, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// IssueImpersonationToken signs an access token for the impersonation's
+// subject that names the impersonator as its actor. It has no refresh token
+// and expires with the impersonation.
+func (m *TokenManager) IssueImpersonationToken(subject User, impersonation Impersonation) (string, error) {
+	claims := m.claims(subject, impersonation.ID, TokenTypeAccess, false, time.Now().UTC(), impersonation.ExpiresAt)
+	claims.Actor = &actorClaim{Subject: impersonation.ImpersonatorID}
+	claims.Elevated = impersonation.Elevated
+	return m.signClaims(claims)
+}
+
+func (m *TokenManager) sign(user User, sessionID string, tokenType TokenType, mfaVerified bool, issuedAt, expiresAt time.Time) (string, error) {
+	return m.signClaims(m.claims(user, sessionID, tokenType, mfaVerified, issuedAt, expiresAt))
+}
+
+func (m *TokenManager) claims(user User, sessionID string, tokenType TokenType, mfaVerified bool, issuedAt, expiresAt time.Time) tokenClaims {
 	claims := tokenClaims{
 		Role:      user.Role.String(),
 		SessionID: sessionID,
 		TokenType: string(tokenType),
+		MFA:       mfaVerified,
 		RegisteredClaims: jwt.RegisteredClaims{
+			// A unique ID keeps tokens rotated within the same second apart.
+			ID:        identifier.New("jti"),
 			Issuer:    m.issuer,
 			Subject:   user.ID,
 			IssuedAt:  jwt.NewNumericDate(issuedAt),
@@ -113,22 +196,46 @@ func (m *TokenManager) sign(user User, sessionID string, tokenType TokenType, is
 	if user.VendorID != nil {
 		claims.VendorID = *user.VendorID
 	}
+	if !isKnownRole(user.Role) && m.rolePermissions != nil {
+		claims.Perms = make([]string, 0)
+		for _, permission := range m.rolePermissions(user.Role) {
+			claims.Perms = append(claims.Perms, string(permission))
+		}
+	}
+	return claims
+}
 
+func (m *TokenManager) signClaims(claims tokenClaims) (string, error) {
+	if m.keys != nil {
+		token := jwt.NewWithClaims(m.keys.active.signingMethod(), claims)
+		token.Header["kid"] = m.keys.active.ID
+		return token.SignedString(m.keys.active.private)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(m.secret)
 }
 
 func (m *TokenManager) ParseAndValidate(rawToken string, expectedType TokenType) (Claims, error) {
 	claims := tokenClaims{}
+	retired := false
 	token, err := jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if token.Method == jwt.SigningMethodHS256 {
+			retired = m.keys != nil
+			return m.secret, nil
+		}
+		if m.keys == nil {
 			return nil, ErrInvalidToken
 		}
-		return m.secret, nil
-	})
+		key, isRetired, err := m.keys.verificationKey(token)
+		retired = isRetired
+		return key, err
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), AlgorithmRS256, AlgorithmEdDSA}))
 	if err != nil || !token.Valid {
 		return Claims{}, ErrInvalidToken
 	}
+	if retired && (claims.IssuedAt == nil || !m.keys.acceptsRetired(claims.IssuedAt.Time)) {
+		return Claims{}, ErrInvalidToken
+	}
 
 	if claims.TokenType != string(expectedType) {
 		return Claims{}, ErrInvalidTokenType
@@ -140,8 +247,10 @@ func (m *TokenManager) ParseAndValidate(rawToken string, expectedType TokenType)
 		vendorID = &value
 	}
 
+	// Custom roles are only known to the auth service, which checks them
+	// when the token is used.
 	role := Role(claims.Role)
-	if !isKnownRole(role) {
+	if !validRoleName(role) {
 		return Claims{}, ErrInvalidToken
 	}
 
@@ -149,14 +258,29 @@ func (m *TokenManager) ParseAndValidate(rawToken string, expectedType TokenType)
 		return Claims{}, ErrInvalidToken
 	}
 
-	return Claims{
-		UserID:    claims.Subject,
-		Role:      role,
-		SessionID: claims.SessionID,
-		VendorID:  vendorID,
-		TokenType: expectedType,
-		ExpiresAt: claims.ExpiresAt.Time,
-	}, nil
+	parsed := Claims{
+		UserID:      claims.Subject,
+		Role:        role,
+		SessionID:   claims.SessionID,
+		VendorID:    vendorID,
+		TokenType:   expectedType,
+		ExpiresAt:   claims.ExpiresAt.Time,
+		MFAVerified: claims.MFA,
+	}
+	if !isKnownRole(role) {
+		parsed.Permissions = make([]Permission, 0, len(claims.Perms))
+		for _, permission := range claims.Perms {
+			parsed.Permissions = append(parsed.Permissions, Permission(permission))
+		}
+	}
+	if claims.Actor != nil {
+		if claims.Actor.Subject == "" {
+			return Claims{}, ErrInvalidToken
+		}
+		parsed.ImpersonatorID = claims.Actor.Subject
+		parsed.Elevated = claims.Elevated
+	}
+	return parsed, nil
 }
 
 func isKnownRole(role Role) bool {
@@ -12,7 +12,7 @@ func TestIssueAndParseTokenPair(t *testing.T) {
 	}
 
 	user := User{ID: "usr_1", Role: RoleBuyer}
-	pair, err := manager.IssueTokenPair(user, "ses_1")
+	pair, err := manager.IssueTokenPair(user, "ses_1", false)
 	if err != nil {
 		t.Fatalf("IssueTokenPair() error = %v", err)
 	}
@@ -38,6 +38,45 @@ func TestIssueAndParseTokenPair(t *testing.T) {
 	}
 }
 
+func TestCustomRolePermissionsAreSignedIntoTokens(t *testing.T) {
+	manager, err := NewTokenManager("test-secret", "marketplace-api", testDuration(900), testDuration(3600))
+	if err != nil {
+		t.Fatalf("NewTokenManager() error = %v", err)
+	}
+	granted := []Permission{PermissionViewAuditLogs}
+	manager.UseRolePermissions(func(role Role) []Permission {
+		if role == "analyst" {
+			return granted
+		}
+		return nil
+	})
+
+	issue := func(role Role) Identity {
+		t.Helper()
+		pair, err := manager.IssueTokenPair(User{ID: "usr_1", Role: role}, "ses_1", false)
+		if err != nil {
+			t.Fatalf("IssueTokenPair() error = %v", err)
+		}
+		claims, err := manager.ParseAndValidate(pair.AccessToken, TokenTypeAccess)
+		if err != nil {
+			t.Fatalf("ParseAndValidate() error = %v", err)
+		}
+		return Identity{Role: claims.Role, Permissions: claims.Permissions}
+	}
+
+	analyst := issue("analyst")
+	granted = []Permission{PermissionViewAdminAnalytics}
+	if !analyst.Allowed(PermissionViewAuditLogs) || analyst.Allowed(PermissionViewAdminAnalytics) {
+		t.Fatalf("expected the token to keep the grants it was issued with, got %+v", analyst.Permissions)
+	}
+	if refreshed := issue("analyst"); refreshed.Allowed(PermissionViewAuditLogs) || !refreshed.Allowed(PermissionViewAdminAnalytics) {
+		t.Fatalf("expected a new token to carry the changed grants, got %+v", refreshed.Permissions)
+	}
+	if finance := issue(RoleFinance); finance.Permissions != nil || !finance.Allowed(PermissionManageCommission) {
+		t.Fatalf("expected built-in roles to use the matrix, got %+v", finance.Permissions)
+	}
+}
+
 func TestParseInvalidSignature(t *testing.T) {
 	good, err := NewTokenManager("good-secret", "marketplace-api", testDuration(900), testDuration(3600))
 	if err != nil {
@@ -48,7 +87,7 @@ func TestParseInvalidSignature(t *testing.T) {
 		t.Fatalf("NewTokenManager() error = %v", err)
 	}
 
-	pair, err := good.IssueTokenPair(User{ID: "usr_1", Role: RoleBuyer}, "ses_1")
+	pair, err := good.IssueTokenPair(User{ID: "usr_1", Role: RoleBuyer}, "ses_1", false)
 	if err != nil {
 		t.Fatalf("IssueTokenPair() error = %v", err)
 	}
@@ -58,6 +97,36 @@ func TestParseInvalidSignature(t *testing.T) {
 	}
 }
 
+func TestMFAChallengeAndVerifiedSessionTokens(t *testing.T) {
+	manager, err := NewTokenManager("test-secret", "marketplace-api", testDuration(900), testDuration(3600))
+	if err != nil {
+		t.Fatalf("NewTokenManager() error = %v", err)
+	}
+	user := User{ID: "usr_1", Role: RoleFinance}
+
+	challenge, expiresAt, err := manager.IssueMFAChallenge(user, testDuration(300))
+	if err != nil {
+		t.Fatalf("IssueMFAChallenge() error = %v", err)
+	}
+	if _, err := manager.ParseAndValidate(challenge, TokenTypeAccess); err != ErrInvalidTokenType {
+		t.Fatalf("expected a challenge token not to be usable as access token, got %v", err)
+	}
+	claims, err := manager.ParseAndValidate(challenge, TokenTypeMFAChallenge)
+	if err != nil || claims.UserID != user.ID || claims.MFAVerified || !claims.ExpiresAt.Equal(expiresAt.Truncate(time.Second)) {
+		t.Fatalf("unexpected challenge claims %+v err=%v", claims, err)
+	}
+
+	pair, err := manager.IssueTokenPair(user, "ses_1", true)
+	if err != nil {
+		t.Fatalf("IssueTokenPair() error = %v", err)
+	}
+	for tokenType, raw := range map[TokenType]string{TokenTypeAccess: pair.AccessToken, TokenTypeRefresh: pair.RefreshToken} {
+		if claims, err := manager.ParseAndValidate(raw, tokenType); err != nil || !claims.MFAVerified {
+			t.Fatalf("expected %s token to carry mfa, claims=%+v err=%v", tokenType, claims, err)
+		}
+	}
+}
+
 func testDuration(seconds int) time.Duration {
 	return time.Duration(seconds) * time.Second
 }
@@ -0,0 +1,48 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStoresRoundTripListAndRejectEscapingKeys(t *testing.T) {
+	dirStore, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirStore() error = %v", err)
+	}
+	ctx := context.Background()
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "dir": dirStore} {
+		if err := store.Put(ctx, "invoices/ven_1/2026/a.pdf", []byte("%PDF-a")); err != nil {
+			t.Fatalf("%s Put() error = %v", name, err)
+		}
+		if err := store.Put(ctx, "invoices/ven_1/2026/b.pdf", []byte("%PDF-b")); err != nil {
+			t.Fatalf("%s Put() error = %v", name, err)
+		}
+		if err := store.Put(ctx, "sequences/ven_1", []byte("2")); err != nil {
+			t.Fatalf("%s Put() error = %v", name, err)
+		}
+
+		content, err := store.Get(ctx, "invoices/ven_1/2026/a.pdf")
+		if err != nil || string(content) != "%PDF-a" {
+			t.Fatalf("%s Get() = %q err=%v", name, content, err)
+		}
+		keys, err := store.List(ctx, "invoices/")
+		if err != nil || len(keys) != 2 || keys[0] != "invoices/ven_1/2026/a.pdf" {
+			t.Fatalf("%s List() = %v err=%v", name, keys, err)
+		}
+
+		if err := store.Delete(ctx, "invoices/ven_1/2026/a.pdf"); err != nil {
+			t.Fatalf("%s Delete() error = %v", name, err)
+		}
+		if _, err := store.Get(ctx, "invoices/ven_1/2026/a.pdf"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s expected ErrNotFound after delete, got %v", name, err)
+		}
+		for _, key := range []string{"", "/etc/passwd", "../outside", "invoices/../../outside", "invoices//a.pdf"} {
+			if err := store.Put(ctx, key, nil); !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("%s expected ErrInvalidKey for %q, got %v", name, key, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package carriers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FileCarrierCode is the carrier code used by the file-driven fake carrier.
+const FileCarrierCode = "fake"
+
+// FileCarrier is a file-driven fake carrier for local development and tests.
+//
+// Poll reads a JSON document keyed by tracking number, so scan progress can be
+// scripted by rewriting the file. Webhooks carry the same event shape and are
+// signed with a hex-encoded HMAC-SHA256 of the raw payload.
+type FileCarrier struct {
+	mu            sync.Mutex
+	code          string
+	path          string
+	webhookSecret string
+}
+
+type fileScanEvent struct {
+	ID                string `json:"id"`
+	TrackingNumber    string `json:"tracking_number"`
+	Status            string `json:"status"`
+	Location          string `json:"location"`
+	Description       string `json:"description"`
+	CODCollectedCents int64  `json:"cod_collected_cents"`
+	OccurredAt        string `json:"occurred_at"`
+}
+
+type fileWebhookPayload struct {
+	Events []fileScanEvent `json:"events"`
+}
+
+func NewFileCarrier(code, path, webhookSecret string) *FileCarrier {
+	normalizedCode := normalizeCarrierCode(code)
+	if normalizedCode == "" {
+		normalizedCode = FileCarrierCode
+	}
+	return &FileCarrier{
+		code:          normalizedCode,
+		path:          strings.TrimSpace(path),
+		webhookSecret: strings.TrimSpace(webhookSecret),
+	}
+}
+
+func (c *FileCarrier) Code() string {
+	return c.code
+}
+
+func (c *FileCarrier) Poll(_ context.Context, trackingNumber string) ([]ScanEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var byTrackingNumber map[string][]fileScanEvent
+	if err := json.Unmarshal(raw, &byTrackingNumber); err != nil {
+		return nil, ErrInvalidPayload
+	}
+
+	normalizedTrackingNumber := normalizeTrackingNumber(trackingNumber)
+	events := make([]ScanEvent, 0)
+	for key, entries := range byTrackingNumber {
+		if normalizeTrackingNumber(key) != normalizedTrackingNumber {
+			continue
+		}
+		for _, entry := range entries {
+			entry.TrackingNumber = key
+			event, err := c.toScanEvent(entry)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (c *FileCarrier) ParseWebhook(payload []byte, signatureHeader string) ([]ScanEvent, error) {
+	if c.webhookSecret == "" {
+		return nil, ErrWebhookSecretRequired
+	}
+	if !hmac.Equal([]byte(SignFilePayload(c.webhookSecret, payload)), []byte(strings.TrimSpace(signatureHeader))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var body fileWebhookPayload
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, ErrInvalidPayload
+	}
+
+	events := make([]ScanEvent, 0, len(body.Events))
+	for _, entry := range body.Events {
+		event, err := c.toScanEvent(entry)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (c *FileCarrier) toScanEvent(entry fileScanEvent) (ScanEvent, error) {
+	occurredAt, err := parseOccurredAt(entry.OccurredAt)
+	if err != nil {
+		return ScanEvent{}, ErrInvalidPayload
+	}
+	event := ScanEvent{
+		ID:             strings.TrimSpace(entry.ID),
+		CarrierCode:    c.code,
+		TrackingNumber: normalizeTrackingNumber(entry.TrackingNumber),
+		Status:         normalizeScanStatus(entry.Status),
+		Location:       strings.TrimSpace(entry.Location),
+		Description:    strings.TrimSpace(entry.Description),
+		OccurredAt:     occurredAt,
+	}
+	if event.TrackingNumber == "" || !isValidScanStatus(event.Status) || entry.CODCollectedCents < 0 {
+		return ScanEvent{}, ErrInvalidPayload
+	}
+	if event.Status == ScanStatusDelivered {
+		event.CODCollectedCents = entry.CODCollectedCents
+	}
+	return event, nil
+}
+
+// SignFilePayload returns the signature header value expected by FileCarrier webhooks.
+func SignFilePayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(strings.TrimSpace(secret)))
+	_, _ = mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,356 @@
+package carriers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ScanStatusInfoReceived   = "info_received"
+	ScanStatusInTransit      = "in_transit"
+	ScanStatusOutForDelivery = "out_for_delivery"
+	ScanStatusDelivered      = "delivered"
+	ScanStatusRefused        = "refused"
+	ScanStatusException      = "exception"
+)
+
+var (
+	ErrUnsupportedCarrier    = errors.New("carrier is not supported")
+	ErrInvalidTracking       = errors.New("tracking number is invalid")
+	ErrWebhookSecretRequired = errors.New("carrier webhook secret is required")
+	ErrInvalidSignature      = errors.New("invalid carrier webhook signature")
+	ErrInvalidPayload        = errors.New("invalid carrier payload")
+)
+
+// ScanEvent is a normalized carrier scan for one tracking number.
+// CODCollectedCents is the cash the courier reports collecting on a
+// cash-on-delivery parcel, set on delivered scans only.
+type ScanEvent struct {
+	ID                string    `json:"id"`
+	CarrierCode       string    `json:"carrier_code"`
+	TrackingNumber    string    `json:"tracking_number"`
+	Status            string    `json:"status"`
+	Location          string    `json:"location,omitempty"`
+	Description       string    `json:"description,omitempty"`
+	CODCollectedCents int64     `json:"cod_collected_cents,omitempty"`
+	OccurredAt        time.Time `json:"occurred_at"`
+}
+
+// Adapter integrates one carrier, either by polling its tracking API or by
+// parsing the tracking webhooks it pushes to us.
+type Adapter interface {
+	Code() string
+	Poll(ctx context.Context, trackingNumber string) ([]ScanEvent, error)
+	ParseWebhook(payload []byte, signatureHeader string) ([]ScanEvent, error)
+}
+
+type Config struct {
+	Adapters []Adapter
+	// ApplyScan forwards a new scan to the shipment owner. It returns false when
+	// no shipment matches the scan's carrier and tracking number.
+	ApplyScan func(event ScanEvent) bool
+}
+
+// Tracking is a carrier/tracking-number pair registered for polling.
+type Tracking struct {
+	CarrierCode    string     `json:"carrier_code"`
+	TrackingNumber string     `json:"tracking_number"`
+	RegisteredAt   time.Time  `json:"registered_at"`
+	LastPolledAt   *time.Time `json:"last_polled_at,omitempty"`
+}
+
+// IngestResult summarizes how a batch of scans was applied.
+type IngestResult struct {
+	Received   int `json:"received"`
+	Applied    int `json:"applied"`
+	Duplicates int `json:"duplicates"`
+	Unmatched  int `json:"unmatched"`
+}
+
+// Service keeps the carrier registry, the set of actively tracked parcels and
+// the processed scan ids used to make polling and webhooks idempotent.
+type Service struct {
+	mu         sync.Mutex
+	adapters   map[string]Adapter
+	applyScan  func(event ScanEvent) bool
+	now        func() time.Time
+	tracked    map[string]Tracking
+	seenEvents map[string]struct{}
+}
+
+func NewService(cfg Config) *Service {
+	adapters := make(map[string]Adapter, len(cfg.Adapters))
+	for _, adapter := range cfg.Adapters {
+		if adapter == nil {
+			continue
+		}
+		code := normalizeCarrierCode(adapter.Code())
+		if code == "" {
+			continue
+		}
+		adapters[code] = adapter
+	}
+
+	return &Service{
+		adapters:   adapters,
+		applyScan:  cfg.ApplyScan,
+		now:        func() time.Time { return time.Now().UTC() },
+		tracked:    make(map[string]Tracking),
+		seenEvents: make(map[string]struct{}),
+	}
+}
+
+// SupportedCarriers returns registered carrier codes in stable order.
+func (s *Service) SupportedCarriers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := make([]string, 0, len(s.adapters))
+	for code := range s.adapters {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func (s *Service) IsSupported(carrierCode string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.adapters[normalizeCarrierCode(carrierCode)]
+	return exists
+}
+
+// Track registers a parcel so that Poll picks up its scans.
+func (s *Service) Track(carrierCode, trackingNumber string) (Tracking, error) {
+	normalizedCode := normalizeCarrierCode(carrierCode)
+	normalizedTrackingNumber := normalizeTrackingNumber(trackingNumber)
+	if normalizedTrackingNumber == "" {
+		return Tracking{}, ErrInvalidTracking
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.adapters[normalizedCode]; !exists {
+		return Tracking{}, ErrUnsupportedCarrier
+	}
+
+	key := trackingKey(normalizedCode, normalizedTrackingNumber)
+	if existing, exists := s.tracked[key]; exists {
+		return existing, nil
+	}
+	tracking := Tracking{
+		CarrierCode:    normalizedCode,
+		TrackingNumber: normalizedTrackingNumber,
+		RegisteredAt:   s.now(),
+	}
+	s.tracked[key] = tracking
+	return tracking, nil
+}
+
+// Untrack stops polling for a parcel.
+func (s *Service) Untrack(carrierCode, trackingNumber string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tracked, trackingKey(normalizeCarrierCode(carrierCode), normalizeTrackingNumber(trackingNumber)))
+}
+
+// ListTracked returns actively tracked parcels in stable order.
+func (s *Service) ListTracked() []Tracking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]Tracking, 0, len(s.tracked))
+	for _, tracking := range s.tracked {
+		items = append(items, tracking)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].CarrierCode == items[j].CarrierCode {
+			return items[i].TrackingNumber < items[j].TrackingNumber
+		}
+		return items[i].CarrierCode < items[j].CarrierCode
+	})
+	return items
+}
+
+// HandleWebhook verifies and applies a carrier push notification.
+func (s *Service) HandleWebhook(carrierCode string, payload []byte, signatureHeader string) (IngestResult, error) {
+	s.mu.Lock()
+	adapter, exists := s.adapters[normalizeCarrierCode(carrierCode)]
+	s.mu.Unlock()
+	if !exists {
+		return IngestResult{}, ErrUnsupportedCarrier
+	}
+
+	events, err := adapter.ParseWebhook(payload, signatureHeader)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	return s.ingest(adapter.Code(), events), nil
+}
+
+// Poll asks each carrier for scans on every tracked parcel. Poll errors for a
+// single parcel are skipped so one failing carrier does not block the others.
+func (s *Service) Poll(ctx context.Context) IngestResult {
+	tracked := s.ListTracked()
+
+	var total IngestResult
+	for _, tracking := range tracked {
+		if ctx.Err() != nil {
+			break
+		}
+
+		s.mu.Lock()
+		adapter, exists := s.adapters[tracking.CarrierCode]
+		s.mu.Unlock()
+		if !exists {
+			continue
+		}
+
+		events, err := adapter.Poll(ctx, tracking.TrackingNumber)
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		key := trackingKey(tracking.CarrierCode, tracking.TrackingNumber)
+		if current, stillTracked := s.tracked[key]; stillTracked {
+			polledAt := s.now()
+			current.LastPolledAt = &polledAt
+			s.tracked[key] = current
+		}
+		s.mu.Unlock()
+
+		result := s.ingest(tracking.CarrierCode, events)
+		total.Received += result.Received
+		total.Applied += result.Applied
+		total.Duplicates += result.Duplicates
+		total.Unmatched += result.Unmatched
+	}
+	return total
+}
+
+// Run polls on a fixed interval in the background until ctx is cancelled.
+// The returned channel is closed once polling has stopped.
+func (s *Service) Run(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Poll(ctx)
+			}
+		}
+	}()
+	return done
+}
+
+func (s *Service) ingest(carrierCode string, events []ScanEvent) IngestResult {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].OccurredAt.Before(events[j].OccurredAt)
+	})
+
+	result := IngestResult{Received: len(events)}
+	for _, event := range events {
+		event.CarrierCode = normalizeCarrierCode(carrierCode)
+		event.TrackingNumber = normalizeTrackingNumber(event.TrackingNumber)
+		event.Status = normalizeScanStatus(event.Status)
+		if strings.TrimSpace(event.ID) == "" {
+			event.ID = derivedEventID(event)
+		}
+		if event.OccurredAt.IsZero() {
+			event.OccurredAt = s.now()
+		}
+
+		// Reserve the event before applying it so a poll and a webhook
+		// delivering the same scan at once cannot both apply it.
+		seenKey := event.CarrierCode + "::" + event.ID
+		s.mu.Lock()
+		_, seen := s.seenEvents[seenKey]
+		if !seen {
+			s.seenEvents[seenKey] = struct{}{}
+		}
+		s.mu.Unlock()
+		if seen {
+			result.Duplicates++
+			continue
+		}
+
+		if s.applyScan == nil || !s.applyScan(event) {
+			s.mu.Lock()
+			delete(s.seenEvents, seenKey)
+			s.mu.Unlock()
+			result.Unmatched++
+			continue
+		}
+
+		s.mu.Lock()
+		if event.Status == ScanStatusDelivered || event.Status == ScanStatusRefused {
+			delete(s.tracked, trackingKey(event.CarrierCode, event.TrackingNumber))
+		}
+		s.mu.Unlock()
+		result.Applied++
+	}
+	return result
+}
+
+func derivedEventID(event ScanEvent) string {
+	return strings.Join([]string{
+		event.TrackingNumber,
+		event.Status,
+		event.OccurredAt.UTC().Format(time.RFC3339Nano),
+	}, "|")
+}
+
+func trackingKey(carrierCode, trackingNumber string) string {
+	return carrierCode + "::" + trackingNumber
+}
+
+func normalizeCarrierCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+func normalizeTrackingNumber(trackingNumber string) string {
+	return strings.ToUpper(strings.TrimSpace(trackingNumber))
+}
+
+func normalizeScanStatus(status string) string {
+	return strings.ToLower(strings.TrimSpace(status))
+}
+
+func isValidScanStatus(status string) bool {
+	switch normalizeScanStatus(status) {
+	case ScanStatusInfoReceived, ScanStatusInTransit, ScanStatusOutForDelivery, ScanStatusDelivered, ScanStatusRefused, ScanStatusException:
+		return true
+	default:
+		return false
+	}
+}
+
+func parseOccurredAt(raw string) (time.Time, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, trimmed)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsed.UTC(), nil
+}
@@ -0,0 +1,230 @@
+package carriers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeScanFile(t *testing.T, path string, byTrackingNumber map[string][]map[string]string) {
+	t.Helper()
+
+	raw, err := json.Marshal(byTrackingNumber)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+}
+
+func TestPollAppliesFileScansOnceAndStopsAfterDelivery(t *testing.T) {
+	scanFile := filepath.Join(t.TempDir(), "scans.json")
+	writeScanFile(t, scanFile, map[string][]map[string]string{
+		"trk-100": {
+			{"id": "scan_1", "status": "in_transit", "location": "Hub A", "occurred_at": "2026-03-01T10:00:00Z"},
+		},
+	})
+
+	applied := make([]ScanEvent, 0)
+	svc := NewService(Config{
+		Adapters: []Adapter{NewFileCarrier(FileCarrierCode, scanFile, "carrier_secret")},
+		ApplyScan: func(event ScanEvent) bool {
+			applied = append(applied, event)
+			return event.TrackingNumber == "TRK-100"
+		},
+	})
+
+	if _, err := svc.Track("unknown", "TRK-100"); err != ErrUnsupportedCarrier {
+		t.Fatalf("expected ErrUnsupportedCarrier, got %v", err)
+	}
+	if _, err := svc.Track(FileCarrierCode, "  "); err != ErrInvalidTracking {
+		t.Fatalf("expected ErrInvalidTracking, got %v", err)
+	}
+	if _, err := svc.Track("FAKE", "trk-100"); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	first := svc.Poll(context.Background())
+	if first.Applied != 1 || first.Duplicates != 0 {
+		t.Fatalf("unexpected first poll result %+v", first)
+	}
+	if applied[0].CarrierCode != FileCarrierCode || applied[0].Location != "Hub A" {
+		t.Fatalf("unexpected applied scan %+v", applied[0])
+	}
+
+	writeScanFile(t, scanFile, map[string][]map[string]string{
+		"trk-100": {
+			{"id": "scan_1", "status": "in_transit", "location": "Hub A", "occurred_at": "2026-03-01T10:00:00Z"},
+			{"id": "scan_2", "status": "delivered", "location": "Front door", "occurred_at": "2026-03-02T09:00:00Z"},
+		},
+	})
+
+	second := svc.Poll(context.Background())
+	if second.Applied != 1 || second.Duplicates != 1 {
+		t.Fatalf("unexpected second poll result %+v", second)
+	}
+	if applied[len(applied)-1].Status != ScanStatusDelivered {
+		t.Fatalf("expected delivered scan to be applied last, got %+v", applied[len(applied)-1])
+	}
+	if tracked := svc.ListTracked(); len(tracked) != 0 {
+		t.Fatalf("expected delivered parcel to stop being tracked, got %+v", tracked)
+	}
+}
+
+func TestHandleWebhookVerifiesSignatureAndDeduplicates(t *testing.T) {
+	matched := 0
+	svc := NewService(Config{
+		Adapters: []Adapter{NewFileCarrier(FileCarrierCode, "", "carrier_secret")},
+		ApplyScan: func(event ScanEvent) bool {
+			if event.TrackingNumber != "TRK-200" {
+				return false
+			}
+			matched++
+			return true
+		},
+	})
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"events": []map[string]string{
+			{"id": "evt_1", "tracking_number": "trk-200", "status": "out_for_delivery", "occurred_at": "2026-03-01T08:00:00Z"},
+			{"id": "evt_2", "tracking_number": "trk-404", "status": "in_transit", "occurred_at": "2026-03-01T07:00:00Z"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	if _, err := svc.HandleWebhook(FileCarrierCode, payload, "bad-signature"); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	if _, err := svc.HandleWebhook("unknown", payload, SignFilePayload("carrier_secret", payload)); err != ErrUnsupportedCarrier {
+		t.Fatalf("expected ErrUnsupportedCarrier, got %v", err)
+	}
+
+	result, err := svc.HandleWebhook(FileCarrierCode, payload, SignFilePayload("carrier_secret", payload))
+	if err != nil {
+		t.Fatalf("HandleWebhook() error = %v", err)
+	}
+	if result.Received != 2 || result.Applied != 1 || result.Unmatched != 1 {
+		t.Fatalf("unexpected webhook result %+v", result)
+	}
+
+	replay, err := svc.HandleWebhook(FileCarrierCode, payload, SignFilePayload("carrier_secret", payload))
+	if err != nil {
+		t.Fatalf("HandleWebhook() replay error = %v", err)
+	}
+	if replay.Duplicates != 1 || replay.Applied != 0 || matched != 1 {
+		t.Fatalf("expected replayed scan to be deduplicated, got %+v matched=%d", replay, matched)
+	}
+
+	invalid := []byte(`{"events":[{"tracking_number":"trk-200","status":"teleported"}]}`)
+	if _, err := svc.HandleWebhook(FileCarrierCode, invalid, SignFilePayload("carrier_secret", invalid)); err != ErrInvalidPayload {
+		t.Fatalf("expected ErrInvalidPayload, got %v", err)
+	}
+}
+
+func TestConcurrentDeliveriesApplyAScanOnce(t *testing.T) {
+	var applied atomic.Int32
+	var matching atomic.Bool
+	svc := NewService(Config{
+		Adapters: []Adapter{NewFileCarrier(FileCarrierCode, "", "carrier_secret")},
+		ApplyScan: func(event ScanEvent) bool {
+			if !matching.Load() {
+				return false
+			}
+			time.Sleep(5 * time.Millisecond)
+			applied.Add(1)
+			return true
+		},
+	})
+
+	payload := []byte(`{"events":[{"id":"evt_race","tracking_number":"trk-300","status":"delivered","occurred_at":"2026-03-01T08:00:00Z"}]}`)
+	signature := SignFilePayload("carrier_secret", payload)
+	deliver := func() IngestResult {
+		result, err := svc.HandleWebhook(FileCarrierCode, payload, signature)
+		if err != nil {
+			t.Errorf("HandleWebhook() error = %v", err)
+		}
+		return result
+	}
+
+	if result := deliver(); result.Unmatched != 1 {
+		t.Fatalf("expected the scan to be unmatched before its shipment exists, got %+v", result)
+	}
+
+	matching.Store(true)
+	var wg sync.WaitGroup
+	var duplicates atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			duplicates.Add(int32(deliver().Duplicates))
+		}()
+	}
+	wg.Wait()
+	if applied.Load() != 1 || duplicates.Load() != 7 {
+		t.Fatalf("expected one delivery to apply the scan and seven duplicates, got applied=%d duplicates=%d", applied.Load(), duplicates.Load())
+	}
+}
+
+func TestWebhookCarriesCODCashAndRefusalsEndTracking(t *testing.T) {
+	applied := make([]ScanEvent, 0)
+	svc := NewService(Config{
+		Adapters: []Adapter{NewFileCarrier(FileCarrierCode, "", "carrier_secret")},
+		ApplyScan: func(event ScanEvent) bool {
+			applied = append(applied, event)
+			return true
+		},
+	})
+	if _, err := svc.Track(FileCarrierCode, "trk-300"); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	payload := []byte(`{"events":[` +
+		`{"id":"evt_cash","tracking_number":"trk-301","status":"delivered","cod_collected_cents":4200,"occurred_at":"2026-03-01T08:00:00Z"},` +
+		`{"id":"evt_refused","tracking_number":"trk-300","status":"refused","cod_collected_cents":900,"occurred_at":"2026-03-01T09:00:00Z"}]}`)
+	result, err := svc.HandleWebhook(FileCarrierCode, payload, SignFilePayload("carrier_secret", payload))
+	if err != nil {
+		t.Fatalf("HandleWebhook() error = %v", err)
+	}
+	if result.Applied != 2 || len(applied) != 2 {
+		t.Fatalf("expected both scans applied, got %+v", result)
+	}
+	if applied[0].CODCollectedCents != 4200 || applied[1].Status != ScanStatusRefused || applied[1].CODCollectedCents != 0 {
+		t.Fatalf("expected cash on the delivered scan only, got %+v", applied)
+	}
+	if tracked := svc.ListTracked(); len(tracked) != 0 {
+		t.Fatalf("expected refused parcel to stop being tracked, got %+v", tracked)
+	}
+
+	negative := []byte(`{"events":[{"tracking_number":"trk-302","status":"delivered","cod_collected_cents":-1}]}`)
+	if _, err := svc.HandleWebhook(FileCarrierCode, negative, SignFilePayload("carrier_secret", negative)); err != ErrInvalidPayload {
+		t.Fatalf("expected ErrInvalidPayload, got %v", err)
+	}
+}
+
+func TestRunStopsWhenContextIsCancelled(t *testing.T) {
+	svc := NewService(Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := svc.Run(ctx, time.Hour)
+	select {
+	case <-done:
+		t.Fatal("expected polling to run until cancelled")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected polling to stop after cancel")
+	}
+}
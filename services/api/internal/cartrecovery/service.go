@@ -0,0 +1,391 @@
+package cartrecovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/notifications"
+)
+
+const (
+	NotificationKind        = "cart_recovery"
+	DefaultIdleThreshold    = 24 * time.Hour
+	DefaultRetention        = 30 * 24 * time.Hour
+	notificationSendTimeout = 10 * time.Second
+
+	StatusNotified  = "notified"
+	StatusRecovered = "recovered"
+	StatusExpired   = "expired"
+)
+
+// Cart is an idle buyer cart as reported by the cart owner.
+type Cart struct {
+	CartID        string
+	BuyerUserID   string
+	Currency      string
+	ItemCount     int32
+	SubtotalCents int64
+	UpdatedAt     time.Time
+}
+
+type Config struct {
+	// IdleThreshold is how long a buyer cart must be untouched before a
+	// recovery notification is sent.
+	IdleThreshold time.Duration
+	// Retention is how long any cart may stay idle before it is expired.
+	Retention time.Duration
+	Notifier  notifications.Notifier
+	// ListIdleCarts returns non-empty buyer carts not updated since idleSince.
+	ListIdleCarts func(idleSince time.Time) []Cart
+	// ExpireCarts drops carts not updated since idleSince and returns their ids.
+	ExpireCarts func(idleSince time.Time) []string
+	// IssueCoupon optionally creates a single-use incentive for the buyer and
+	// returns its code.
+	IssueCoupon func(cart Cart) (string, error)
+}
+
+// Recovery tracks one abandoned cart from notification to conversion or expiry.
+type Recovery struct {
+	CartID        string     `json:"cart_id"`
+	BuyerUserID   string     `json:"buyer_user_id"`
+	Status        string     `json:"status"`
+	Currency      string     `json:"currency"`
+	ItemCount     int32      `json:"item_count"`
+	SubtotalCents int64      `json:"subtotal_cents"`
+	CouponCode    string     `json:"coupon_code,omitempty"`
+	IdleSince     time.Time  `json:"idle_since"`
+	NotifiedAt    time.Time  `json:"notified_at"`
+	RecoveredAt   *time.Time `json:"recovered_at,omitempty"`
+	OrderID       string     `json:"order_id,omitempty"`
+	ExpiredAt     *time.Time `json:"expired_at,omitempty"`
+}
+
+// Metrics summarizes the abandoned-to-recovered funnel since startup.
+type Metrics struct {
+	AbandonedTotal    int        `json:"abandoned_total"`
+	PendingTotal      int        `json:"pending_total"`
+	RecoveredTotal    int        `json:"recovered_total"`
+	ExpiredTotal      int        `json:"expired_total"`
+	CouponsIssued     int        `json:"coupons_issued"`
+	ConversionRateBPS int        `json:"conversion_rate_bps"`
+	CartsExpired      int        `json:"carts_expired"`
+	LastRunAt         *time.Time `json:"last_run_at,omitempty"`
+}
+
+// RunResult summarizes one detection pass.
+type RunResult struct {
+	IdleCarts    int `json:"idle_carts"`
+	Notified     int `json:"notified"`
+	NotifyFailed int `json:"notify_failed"`
+	CartsExpired int `json:"carts_expired"`
+}
+
+// Service detects abandoned buyer carts, sends recovery notifications and
+// keeps the recovery conversion metric.
+type Service struct {
+	mu             sync.Mutex
+	cfg            Config
+	now            func() time.Time
+	byCartID       map[string]Recovery
+	pendingByBuyer map[string]string
+	recoveredTotal int
+	expiredTotal   int
+	abandonedTotal int
+	couponsIssued  int
+	cartsExpired   int
+	lastRunAt      *time.Time
+	runInProgress  bool
+}
+
+func NewService(cfg Config) *Service {
+	service := &Service{
+		cfg:            cfg,
+		now:            func() time.Time { return time.Now().UTC() },
+		byCartID:       make(map[string]Recovery),
+		pendingByBuyer: make(map[string]string),
+	}
+	if service.cfg.IdleThreshold <= 0 {
+		service.cfg.IdleThreshold = DefaultIdleThreshold
+	}
+	if service.cfg.Retention <= 0 {
+		service.cfg.Retention = DefaultRetention
+	}
+	if service.cfg.Retention < service.cfg.IdleThreshold {
+		service.cfg.Retention = service.cfg.IdleThreshold
+	}
+	if service.cfg.Notifier == nil {
+		service.cfg.Notifier = notifications.LogNotifier{}
+	}
+	return service
+}
+
+// Run notifies newly abandoned carts, then expires carts past retention. A
+// cart is notified at most once per abandonment.
+func (s *Service) Run(ctx context.Context) RunResult {
+	s.mu.Lock()
+	if s.runInProgress {
+		s.mu.Unlock()
+		return RunResult{}
+	}
+	s.runInProgress = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.runInProgress = false
+		s.mu.Unlock()
+	}()
+
+	now := s.now()
+	result := RunResult{}
+
+	if s.cfg.ListIdleCarts != nil {
+		idleCarts := s.cfg.ListIdleCarts(now.Add(-s.cfg.IdleThreshold))
+		result.IdleCarts = len(idleCarts)
+		for _, cart := range idleCarts {
+			if ctx.Err() != nil {
+				break
+			}
+			if !s.shouldNotify(cart) {
+				continue
+			}
+			if s.notify(ctx, cart, now) {
+				result.Notified++
+			} else {
+				result.NotifyFailed++
+			}
+		}
+	}
+
+	if s.cfg.ExpireCarts != nil {
+		expiredIDs := s.cfg.ExpireCarts(now.Add(-s.cfg.Retention))
+		result.CartsExpired = len(expiredIDs)
+		s.markExpired(expiredIDs, now)
+	}
+
+	s.mu.Lock()
+	s.cartsExpired += result.CartsExpired
+	s.lastRunAt = &now
+	s.pruneLocked(now)
+	s.mu.Unlock()
+
+	return result
+}
+
+// Start runs detection on a fixed interval in the background until ctx is
+// cancelled. The returned channel is closed once detection has stopped.
+func (s *Service) Start(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Run(ctx)
+			}
+		}
+	}()
+	return done
+}
+
+// MarkRecovered records that a notified buyer placed an order. It returns
+// false when the buyer had no pending recovery.
+func (s *Service) MarkRecovered(buyerUserID, orderID string) bool {
+	buyerUserID = strings.TrimSpace(buyerUserID)
+	if buyerUserID == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, exists := s.pendingByBuyer[buyerUserID]
+	if !exists {
+		return false
+	}
+	recovery := s.byCartID[cartID]
+	recoveredAt := s.now()
+	recovery.Status = StatusRecovered
+	recovery.RecoveredAt = &recoveredAt
+	recovery.OrderID = strings.TrimSpace(orderID)
+	s.byCartID[cartID] = recovery
+	delete(s.pendingByBuyer, buyerUserID)
+	s.recoveredTotal++
+	return true
+}
+
+// List returns tracked recoveries, newest notification first.
+func (s *Service) List(statusFilter string) []Recovery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statusFilter = strings.ToLower(strings.TrimSpace(statusFilter))
+	items := make([]Recovery, 0, len(s.byCartID))
+	for _, recovery := range s.byCartID {
+		if statusFilter != "" && recovery.Status != statusFilter {
+			continue
+		}
+		items = append(items, recovery)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].NotifiedAt.Equal(items[j].NotifiedAt) {
+			return items[i].CartID < items[j].CartID
+		}
+		return items[i].NotifiedAt.After(items[j].NotifiedAt)
+	})
+	return items
+}
+
+func (s *Service) Metrics() Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics := Metrics{
+		AbandonedTotal: s.abandonedTotal,
+		PendingTotal:   len(s.pendingByBuyer),
+		RecoveredTotal: s.recoveredTotal,
+		ExpiredTotal:   s.expiredTotal,
+		CouponsIssued:  s.couponsIssued,
+		CartsExpired:   s.cartsExpired,
+	}
+	if s.abandonedTotal > 0 {
+		metrics.ConversionRateBPS = (s.recoveredTotal * 10000) / s.abandonedTotal
+	}
+	if s.lastRunAt != nil {
+		lastRunAt := *s.lastRunAt
+		metrics.LastRunAt = &lastRunAt
+	}
+	return metrics
+}
+
+func (s *Service) shouldNotify(cart Cart) bool {
+	if strings.TrimSpace(cart.CartID) == "" || strings.TrimSpace(cart.BuyerUserID) == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recovery, tracked := s.byCartID[cart.CartID]
+	if !tracked {
+		return true
+	}
+	// Carts keep their id after checkout, so a closed recovery only blocks a
+	// new notification until the buyer touches the cart again.
+	return recovery.Status != StatusNotified && cart.UpdatedAt.After(recovery.NotifiedAt)
+}
+
+func (s *Service) notify(ctx context.Context, cart Cart, now time.Time) bool {
+	couponCode := ""
+	if s.cfg.IssueCoupon != nil {
+		if code, err := s.cfg.IssueCoupon(cart); err == nil {
+			couponCode = code
+		}
+	}
+
+	notifyCtx, cancel := context.WithTimeout(ctx, notificationSendTimeout)
+	defer cancel()
+	if err := s.cfg.Notifier.Notify(notifyCtx, recoveryMessage(cart, couponCode, now)); err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previousCartID, exists := s.pendingByBuyer[cart.BuyerUserID]; exists {
+		// A buyer only has one cart; an older pending record belongs to a cart
+		// that was replaced and can no longer convert.
+		previous := s.byCartID[previousCartID]
+		previous.Status = StatusExpired
+		previous.ExpiredAt = &now
+		s.byCartID[previousCartID] = previous
+		s.expiredTotal++
+	}
+	s.byCartID[cart.CartID] = Recovery{
+		CartID:        cart.CartID,
+		BuyerUserID:   cart.BuyerUserID,
+		Status:        StatusNotified,
+		Currency:      cart.Currency,
+		ItemCount:     cart.ItemCount,
+		SubtotalCents: cart.SubtotalCents,
+		CouponCode:    couponCode,
+		IdleSince:     cart.UpdatedAt,
+		NotifiedAt:    now,
+	}
+	s.pendingByBuyer[cart.BuyerUserID] = cart.CartID
+	s.abandonedTotal++
+	if couponCode != "" {
+		s.couponsIssued++
+	}
+	return true
+}
+
+func (s *Service) markExpired(cartIDs []string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cartID := range cartIDs {
+		recovery, exists := s.byCartID[cartID]
+		if !exists || recovery.Status != StatusNotified {
+			continue
+		}
+		recovery.Status = StatusExpired
+		recovery.ExpiredAt = &now
+		s.byCartID[cartID] = recovery
+		delete(s.pendingByBuyer, recovery.BuyerUserID)
+		s.expiredTotal++
+	}
+}
+
+// pruneLocked forgets closed recoveries older than the retention period so
+// the tracking map stays bounded; the aggregate counters keep the metric.
+func (s *Service) pruneLocked(now time.Time) {
+	cutoff := now.Add(-s.cfg.Retention)
+	for cartID, recovery := range s.byCartID {
+		if recovery.Status == StatusNotified {
+			continue
+		}
+		if recovery.NotifiedAt.Before(cutoff) {
+			delete(s.byCartID, cartID)
+		}
+	}
+}
+
+func recoveryMessage(cart Cart, couponCode string, now time.Time) notifications.Message {
+	body := fmt.Sprintf("You left %d item(s) in your cart. Complete your order before they sell out.", cart.ItemCount)
+	if couponCode != "" {
+		body += fmt.Sprintf(" Use code %s at checkout.", couponCode)
+	}
+
+	data := map[string]string{
+		"cart_id":        cart.CartID,
+		"item_count":     strconv.Itoa(int(cart.ItemCount)),
+		"subtotal_cents": strconv.FormatInt(cart.SubtotalCents, 10),
+		"currency":       cart.Currency,
+	}
+	if couponCode != "" {
+		data["coupon_code"] = couponCode
+	}
+
+	return notifications.Message{
+		Kind:            NotificationKind,
+		RecipientUserID: cart.BuyerUserID,
+		Subject:         "You left something in your cart",
+		Body:            body,
+		Data:            data,
+		CreatedAt:       now,
+	}
+}
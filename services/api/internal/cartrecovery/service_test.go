@@ -0,0 +1,168 @@
+package cartrecovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/notifications"
+)
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(context.Context, notifications.Message) error {
+	return errors.New("smtp unavailable")
+}
+
+func TestRunNotifiesOnceIssuesCouponAndTracksConversion(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	carts := []Cart{
+		{CartID: "crt_1", BuyerUserID: "usr_1", Currency: "USD", ItemCount: 2, SubtotalCents: 4800, UpdatedAt: now.Add(-3 * time.Hour)},
+		{CartID: "crt_2", BuyerUserID: "usr_2", Currency: "USD", ItemCount: 1, SubtotalCents: 1200, UpdatedAt: now.Add(-5 * time.Hour)},
+	}
+	var requestedIdleSince time.Time
+	outbox := notifications.NewOutbox(nil, 10)
+	issued := 0
+
+	svc := NewService(Config{
+		IdleThreshold: 2 * time.Hour,
+		Retention:     48 * time.Hour,
+		Notifier:      outbox,
+		ListIdleCarts: func(idleSince time.Time) []Cart {
+			requestedIdleSince = idleSince
+			return carts
+		},
+		ExpireCarts: func(time.Time) []string { return nil },
+		IssueCoupon: func(cart Cart) (string, error) {
+			issued++
+			return "COMEBACK-" + cart.CartID, nil
+		},
+	})
+	svc.now = func() time.Time { return now }
+
+	first := svc.Run(context.Background())
+	if first.IdleCarts != 2 || first.Notified != 2 {
+		t.Fatalf("unexpected first run %+v", first)
+	}
+	if !requestedIdleSince.Equal(now.Add(-2 * time.Hour)) {
+		t.Fatalf("expected idle cutoff of 2h, got %s", requestedIdleSince)
+	}
+
+	messages := outbox.List(NotificationKind, "usr_1")
+	if len(messages) != 1 || messages[0].Data["coupon_code"] != "COMEBACK-crt_1" {
+		t.Fatalf("expected one recovery message with coupon, got %+v", messages)
+	}
+
+	second := svc.Run(context.Background())
+	if second.Notified != 0 || issued != 2 {
+		t.Fatalf("expected carts to be notified once, got %+v issued=%d", second, issued)
+	}
+
+	if !svc.MarkRecovered("usr_1", "ord_1") {
+		t.Fatal("expected pending recovery to be marked recovered")
+	}
+	if svc.MarkRecovered("usr_1", "ord_2") {
+		t.Fatal("expected second recovery for the same cart to be ignored")
+	}
+	if svc.MarkRecovered("usr_3", "ord_3") {
+		t.Fatal("expected buyer without notification to be ignored")
+	}
+
+	metrics := svc.Metrics()
+	if metrics.AbandonedTotal != 2 || metrics.RecoveredTotal != 1 || metrics.PendingTotal != 1 || metrics.ConversionRateBPS != 5000 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+	if metrics.CouponsIssued != 2 || metrics.LastRunAt == nil {
+		t.Fatalf("expected coupon count and last run timestamp, got %+v", metrics)
+	}
+
+	recovered := svc.List(StatusRecovered)
+	if len(recovered) != 1 || recovered[0].OrderID != "ord_1" {
+		t.Fatalf("unexpected recovered list %+v", recovered)
+	}
+
+	// The recovered cart becomes idle again after the buyer returns to it.
+	now = now.Add(6 * time.Hour)
+	carts = []Cart{{CartID: "crt_1", BuyerUserID: "usr_1", Currency: "USD", ItemCount: 1, SubtotalCents: 900, UpdatedAt: now.Add(-3 * time.Hour)}}
+	third := svc.Run(context.Background())
+	if third.Notified != 1 {
+		t.Fatalf("expected a new abandonment episode to be notified, got %+v", third)
+	}
+}
+
+func TestRunExpiresIdleCartsAndRecordsFailedNotifications(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	var expireCutoff time.Time
+	expireIDs := []string{}
+
+	svc := NewService(Config{
+		IdleThreshold: time.Hour,
+		Retention:     24 * time.Hour,
+		Notifier:      notifications.NewOutbox(nil, 10),
+		ListIdleCarts: func(time.Time) []Cart {
+			return []Cart{{CartID: "crt_old", BuyerUserID: "usr_old", Currency: "USD", ItemCount: 1, UpdatedAt: now.Add(-2 * time.Hour)}}
+		},
+		ExpireCarts: func(idleSince time.Time) []string {
+			expireCutoff = idleSince
+			return expireIDs
+		},
+	})
+	svc.now = func() time.Time { return now }
+
+	if result := svc.Run(context.Background()); result.Notified != 1 || result.CartsExpired != 0 {
+		t.Fatalf("unexpected first run %+v", result)
+	}
+
+	expireIDs = []string{"crt_old", "crt_guest"}
+	now = now.Add(48 * time.Hour)
+	result := svc.Run(context.Background())
+	if result.CartsExpired != 2 {
+		t.Fatalf("expected two expired carts, got %+v", result)
+	}
+	if !expireCutoff.Equal(now.Add(-24 * time.Hour)) {
+		t.Fatalf("expected retention cutoff of 24h, got %s", expireCutoff)
+	}
+
+	metrics := svc.Metrics()
+	if metrics.ExpiredTotal != 1 || metrics.PendingTotal != 0 || metrics.CartsExpired != 2 {
+		t.Fatalf("unexpected metrics after expiry %+v", metrics)
+	}
+	if svc.MarkRecovered("usr_old", "ord_late") {
+		t.Fatal("expected expired recovery not to convert")
+	}
+
+	failing := NewService(Config{
+		IdleThreshold: time.Hour,
+		Notifier:      failingNotifier{},
+		ListIdleCarts: func(time.Time) []Cart {
+			return []Cart{{CartID: "crt_fail", BuyerUserID: "usr_fail", UpdatedAt: now.Add(-2 * time.Hour)}}
+		},
+	})
+	failing.now = func() time.Time { return now }
+	if result := failing.Run(context.Background()); result.NotifyFailed != 1 || result.Notified != 0 {
+		t.Fatalf("expected failed notification to be reported, got %+v", result)
+	}
+	if retried := failing.Run(context.Background()); retried.NotifyFailed != 1 {
+		t.Fatalf("expected failed notification to be retried on the next run, got %+v", retried)
+	}
+}
+
+func TestStartStopsWhenContextIsCancelled(t *testing.T) {
+	svc := NewService(Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := svc.Start(ctx, time.Hour)
+	select {
+	case <-done:
+		t.Fatal("expected detection to run until cancelled")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected detection to stop after cancel")
+	}
+}
@@ -51,6 +51,8 @@ type Category struct {
 }
 
 // Product models the core catalog aggregate used in foundation branches.
+// BackorderLimit is how many units may be sold beyond StockQty; pre-order
+// products sell without a stock limit and ship from ExpectedShipDate.
 type Product struct {
 	ID                string        `json:"id"`
 	VendorID          string        `json:"vendor_id"`
@@ -62,6 +64,9 @@ type Product struct {
 	PriceInclTaxCents int64         `json:"price_incl_tax_cents"`
 	Currency          string        `json:"currency"`
 	StockQty          int32         `json:"stock_qty"`
+	BackorderLimit    int32         `json:"backorder_limit,omitempty"`
+	Preorder          bool          `json:"preorder,omitempty"`
+	ExpectedShipDate  *time.Time    `json:"expected_ship_date,omitempty"`
 	RatingAverage     float64       `json:"rating_average"`
 	Status            ProductStatus `json:"status"`
 	ModerationReason  string        `json:"moderation_reason,omitempty"`
@@ -79,6 +84,9 @@ type CreateProductInput struct {
 	PriceInclTaxCents int64
 	Currency          string
 	StockQty          int32
+	BackorderLimit    int32
+	Preorder          bool
+	ExpectedShipDate  *time.Time
 	RatingAverage     float64
 	Status            ProductStatus
 }
@@ -108,6 +116,10 @@ type UpdateProductInput struct {
 	PriceInclTaxCents *int64
 	Currency          *string
 	StockQty          *int32
+	BackorderLimit    *int32
+	Preorder          *bool
+	// ExpectedShipDate replaces the ship date; a zero time clears it.
+	ExpectedShipDate *time.Time
 }
 
 // Service provides product and moderation workflow operations.
@@ -117,6 +129,9 @@ type Service struct {
 	ordered       []string
 	categories    map[string]Category
 	categoryOrder []string
+	// productUpdated is invoked after a successful UpdateProduct, outside the
+	// service lock. It is set once at startup.
+	productUpdated func(previous, updated Product)
 }
 
 func NewService() *Service {
@@ -188,6 +203,9 @@ func (s *Service) CreateProductWithInput(input CreateProductInput) Product {
 		PriceInclTaxCents: input.PriceInclTaxCents,
 		Currency:          strings.ToUpper(strings.TrimSpace(input.Currency)),
 		StockQty:          input.StockQty,
+		BackorderLimit:    input.BackorderLimit,
+		Preorder:          input.Preorder,
+		ExpectedShipDate:  normalizeShipDate(input.ExpectedShipDate),
 		RatingAverage:     input.RatingAverage,
 		Status:            input.Status,
 		CreatedAt:         now,
@@ -227,24 +245,42 @@ func (s *Service) ListVendorProducts(ownerUserID, vendorID string) []Product {
 	return items
 }
 
+// OnProductUpdated registers a callback for vendor product updates, used to
+// drive stock and price alerts.
+func (s *Service) OnProductUpdated(callback func(previous, updated Product)) {
+	s.productUpdated = callback
+}
+
 func (s *Service) UpdateProduct(productID, ownerUserID, vendorID string, input UpdateProductInput) (Product, error) {
+	previous, updated, err := s.updateProduct(productID, ownerUserID, vendorID, input)
+	if err != nil {
+		return Product{}, err
+	}
+	if s.productUpdated != nil {
+		s.productUpdated(previous, updated)
+	}
+	return updated, nil
+}
+
+func (s *Service) updateProduct(productID, ownerUserID, vendorID string, input UpdateProductInput) (Product, Product, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	product, exists := s.byID[productID]
 	if !exists {
-		return Product{}, ErrProductNotFound
+		return Product{}, Product{}, ErrProductNotFound
 	}
 	if product.OwnerUserID != ownerUserID || product.VendorID != vendorID {
-		return Product{}, ErrUnauthorizedProductAccess
+		return Product{}, Product{}, ErrUnauthorizedProductAccess
 	}
+	previous := product
 
 	contentChanged := false
 
 	if input.Title != nil {
 		title := strings.TrimSpace(*input.Title)
 		if title == "" {
-			return Product{}, ErrInvalidProductInput
+			return Product{}, Product{}, ErrInvalidProductInput
 		}
 		if title != product.Title {
 			product.Title = title
@@ -261,7 +297,7 @@ func (s *Service) UpdateProduct(productID, ownerUserID, vendorID string, input U
 	if input.CategorySlug != nil {
 		category := strings.ToLower(strings.TrimSpace(*input.CategorySlug))
 		if category == "" {
-			return Product{}, ErrInvalidProductInput
+			return Product{}, Product{}, ErrInvalidProductInput
 		}
 		if category != product.CategorySlug {
 			product.CategorySlug = category
@@ -279,7 +315,7 @@ func (s *Service) UpdateProduct(productID, ownerUserID, vendorID string, input U
 	}
 	if input.PriceInclTaxCents != nil {
 		if *input.PriceInclTaxCents <= 0 {
-			return Product{}, ErrInvalidProductInput
+			return Product{}, Product{}, ErrInvalidProductInput
 		}
 		if *input.PriceInclTaxCents != product.PriceInclTaxCents {
 			product.PriceInclTaxCents = *input.PriceInclTaxCents
@@ -289,7 +325,7 @@ func (s *Service) UpdateProduct(productID, ownerUserID, vendorID string, input U
 	if input.Currency != nil {
 		currency := strings.ToUpper(strings.TrimSpace(*input.Currency))
 		if currency == "" {
-			return Product{}, ErrInvalidProductInput
+			return Product{}, Product{}, ErrInvalidProductInput
 		}
 		if currency != product.Currency {
 			product.Currency = currency
@@ -298,10 +334,25 @@ func (s *Service) UpdateProduct(productID, ownerUserID, vendorID string, input U
 	}
 	if input.StockQty != nil {
 		if *input.StockQty < 0 {
-			return Product{}, ErrInvalidProductInput
+			return Product{}, Product{}, ErrInvalidProductInput
 		}
 		product.StockQty = *input.StockQty
 	}
+	if input.BackorderLimit != nil {
+		if *input.BackorderLimit < 0 {
+			return Product{}, Product{}, ErrInvalidProductInput
+		}
+		product.BackorderLimit = *input.BackorderLimit
+	}
+	if input.Preorder != nil {
+		product.Preorder = *input.Preorder
+	}
+	if input.ExpectedShipDate != nil {
+		product.ExpectedShipDate = normalizeShipDate(input.ExpectedShipDate)
+	}
+	if product.Preorder && product.ExpectedShipDate == nil {
+		return Product{}, Product{}, ErrInvalidProductInput
+	}
 
 	if contentChanged && product.Status == ProductStatusApproved {
 		product.Status = ProductStatusDraft
@@ -310,7 +361,7 @@ func (s *Service) UpdateProduct(productID, ownerUserID, vendorID string, input U
 	product.UpdatedAt = time.Now().UTC()
 	s.byID[productID] = product
 
-	return product, nil
+	return previous, product, nil
 }
 
 func (s *Service) DeleteProduct(productID, ownerUserID, vendorID string) error {
@@ -565,6 +616,15 @@ func relevanceScore(product Product, query string) int {
 	return score
 }
 
+// normalizeShipDate stores ship dates in UTC and maps a zero time to unset.
+func normalizeShipDate(value *time.Time) *time.Time {
+	if value == nil || value.IsZero() {
+		return nil
+	}
+	normalized := value.UTC()
+	return &normalized
+}
+
 func categoryDisplayName(slug string) string {
 	parts := strings.Split(strings.ReplaceAll(slug, "-", " "), " ")
 	for i, part := range parts {
@@ -154,3 +154,30 @@ func TestVendorProductUpdateDeleteAndList(t *testing.T) {
 		t.Fatalf("expected no products after delete")
 	}
 }
+
+func TestUpdateProductInvokesUpdateCallback(t *testing.T) {
+	service := NewService()
+	product := service.CreateProduct("usr_1", "ven_1", "Lamp", "Desk lamp", "USD", 3000)
+
+	var previous, updated Product
+	calls := 0
+	service.OnProductUpdated(func(before, after Product) {
+		calls++
+		previous, updated = before, after
+	})
+
+	stock := int32(4)
+	if _, err := service.UpdateProduct(product.ID, "usr_1", "ven_1", UpdateProductInput{StockQty: &stock}); err != nil {
+		t.Fatalf("UpdateProduct() error = %v", err)
+	}
+	if calls != 1 || previous.StockQty != 0 || updated.StockQty != 4 {
+		t.Fatalf("unexpected callback calls=%d previous=%+v updated=%+v", calls, previous, updated)
+	}
+
+	if _, err := service.UpdateProduct(product.ID, "usr_2", "ven_1", UpdateProductInput{StockQty: &stock}); err != ErrUnauthorizedProductAccess {
+		t.Fatalf("expected ErrUnauthorizedProductAccess, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatal("expected failed updates not to invoke the callback")
+	}
+}
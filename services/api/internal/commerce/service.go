@@ -17,11 +17,15 @@ const (
 	OrderStatusCODConfirmed   = "cod_confirmed"
 	OrderStatusPaid           = "paid"
 	OrderStatusPaymentFailed  = "payment_failed"
+	OrderStatusExpired        = "expired"
+	ShipmentStatusOnHold      = "on_hold"
 	ShipmentStatusPending     = "pending"
 	ShipmentStatusPacked      = "packed"
 	ShipmentStatusShipped     = "shipped"
 	ShipmentStatusDelivered   = "delivered"
 	ShipmentStatusCancelled   = "cancelled"
+	FulfillmentBackorder      = "backorder"
+	FulfillmentPreorder       = "preorder"
 )
 
 var (
@@ -33,6 +37,7 @@ var (
 	ErrCartItemNotFound      = errors.New("cart item not found")
 	ErrCartEmpty             = errors.New("cart is empty")
 	ErrCurrencyMismatch      = errors.New("currency mismatch in cart")
+	ErrUnsupportedCurrency   = errors.New("currency is not supported")
 	ErrIdempotencyKey        = errors.New("idempotency key is required")
 	ErrShipmentNotFound      = errors.New("shipment not found")
 	ErrShipmentForbidden     = errors.New("shipment access forbidden")
@@ -41,6 +46,9 @@ var (
 	ErrOrderNotFound         = errors.New("order not found")
 	ErrInvalidOrderStatus    = errors.New("order status is invalid")
 	ErrOrderStatusTransition = errors.New("order status transition is invalid")
+	ErrInvalidTracking       = errors.New("shipment tracking is invalid")
+	ErrTrackingInUse         = errors.New("tracking number already assigned to another shipment")
+	ErrTrackingNotFound      = errors.New("tracking number not found")
 )
 
 // Actor represents the buyer context for cart and checkout operations.
@@ -71,20 +79,47 @@ type ProductSnapshot struct {
 	Currency              string
 	UnitPriceInclTaxCents int64
 	StockQty              int32
+	BackorderLimit        int32
+	Preorder              bool
+	ExpectedShipDate      *time.Time
 }
 
-// CartItem is a cart line snapshot.
+// CurrencyConverter converts minor-unit amounts between currencies and returns
+// the effective rate so it can be snapshotted on orders.
+type CurrencyConverter interface {
+	Convert(amountCents int64, fromCurrency, toCurrency string) (int64, string, error)
+}
+
+// FXRateSnapshot records the rate used to convert between two currencies.
+type FXRateSnapshot struct {
+	FromCurrency string    `json:"from_currency"`
+	ToCurrency   string    `json:"to_currency"`
+	Rate         string    `json:"rate"`
+	CapturedAt   time.Time `json:"captured_at"`
+}
+
+// CartItem is a cart line snapshot. List fields are set when the product is
+// priced in a different currency than the cart settles in. Fulfillment marks
+// lines that ship later, with BackorderedQty units expected to ship from the
+// product's ExpectedShipDate.
 type CartItem struct {
-	ID              string `json:"id"`
-	ProductID       string `json:"product_id"`
-	VendorID        string `json:"vendor_id"`
-	Title           string `json:"title"`
-	Qty             int32  `json:"qty"`
-	UnitPriceCents  int64  `json:"unit_price_cents"`
-	LineTotalCents  int64  `json:"line_total_cents"`
-	Currency        string `json:"currency"`
-	AvailableStock  int32  `json:"available_stock"`
-	LastUpdatedUnix int64  `json:"last_updated_unix"`
+	ID                 string     `json:"id"`
+	ProductID          string     `json:"product_id"`
+	VendorID           string     `json:"vendor_id"`
+	Title              string     `json:"title"`
+	Qty                int32      `json:"qty"`
+	UnitPriceCents     int64      `json:"unit_price_cents"`
+	LineTotalCents     int64      `json:"line_total_cents"`
+	Currency           string     `json:"currency"`
+	ListUnitPriceCents int64      `json:"list_unit_price_cents,omitempty"`
+	ListCurrency       string     `json:"list_currency,omitempty"`
+	FXRate             string     `json:"fx_rate,omitempty"`
+	AvailableStock     int32      `json:"available_stock"`
+	BackorderLimit     int32      `json:"backorder_limit,omitempty"`
+	Fulfillment        string     `json:"fulfillment,omitempty"`
+	BackorderedQty     int32      `json:"backordered_qty,omitempty"`
+	ExpectedShipDate   *time.Time `json:"expected_ship_date,omitempty"`
+	LastUpdatedUnix    int64      `json:"last_updated_unix"`
 }
 
 // Cart is an actor-scoped shopping cart.
@@ -98,24 +133,31 @@ type Cart struct {
 }
 
 // QuoteShipment models a vendor-specific shipment split during checkout.
+// OnHold shipments contain backordered or pre-order lines and are expected to
+// ship from ExpectedShipDate when the vendor has provided one.
 type QuoteShipment struct {
 	VendorID         string     `json:"vendor_id"`
 	ItemCount        int32      `json:"item_count"`
 	SubtotalCents    int64      `json:"subtotal_cents"`
 	ShippingFeeCents int64      `json:"shipping_fee_cents"`
 	TotalCents       int64      `json:"total_cents"`
+	OnHold           bool       `json:"on_hold,omitempty"`
+	ExpectedShipDate *time.Time `json:"expected_ship_date,omitempty"`
 	Items            []CartItem `json:"items"`
 }
 
 // CheckoutQuote includes order-level and shipment-level totals.
 type CheckoutQuote struct {
-	Currency      string          `json:"currency"`
-	ItemCount     int32           `json:"item_count"`
-	ShipmentCount int32           `json:"shipment_count"`
-	SubtotalCents int64           `json:"subtotal_cents"`
-	ShippingCents int64           `json:"shipping_cents"`
-	TotalCents    int64           `json:"total_cents"`
-	Shipments     []QuoteShipment `json:"shipments"`
+	Currency      string           `json:"currency"`
+	ItemCount     int32            `json:"item_count"`
+	ShipmentCount int32            `json:"shipment_count"`
+	SubtotalCents int64            `json:"subtotal_cents"`
+	ShippingCents int64            `json:"shipping_cents"`
+	TotalCents    int64            `json:"total_cents"`
+	Shipments     []QuoteShipment  `json:"shipments"`
+	FXRates       []FXRateSnapshot `json:"fx_rates,omitempty"`
+	// ExpectedShipDate is the latest expected ship date across held shipments.
+	ExpectedShipDate *time.Time `json:"expected_ship_date,omitempty"`
 }
 
 // OrderShipment is the shipment representation on placed orders.
@@ -127,22 +169,34 @@ type OrderShipment struct {
 	SubtotalCents    int64      `json:"subtotal_cents"`
 	ShippingFeeCents int64      `json:"shipping_fee_cents"`
 	TotalCents       int64      `json:"total_cents"`
+	CarrierCode      string     `json:"carrier_code,omitempty"`
+	TrackingNumber   string     `json:"tracking_number,omitempty"`
+	ExpectedShipDate *time.Time `json:"expected_ship_date,omitempty"`
 	UpdatedAt        time.Time  `json:"updated_at"`
 	ShippedAt        *time.Time `json:"shipped_at,omitempty"`
 	DeliveredAt      *time.Time `json:"delivered_at,omitempty"`
 }
 
-// OrderItem is an immutable order line snapshot.
+// OrderItem is an immutable order line snapshot. Backordered and pre-order
+// lines keep their Fulfillment marker; StockAllocatedAt is set once stock
+// arrives for them.
 type OrderItem struct {
-	ID             string `json:"id"`
-	ShipmentID     string `json:"shipment_id"`
-	ProductID      string `json:"product_id"`
-	VendorID       string `json:"vendor_id"`
-	Title          string `json:"title"`
-	Qty            int32  `json:"qty"`
-	UnitPriceCents int64  `json:"unit_price_cents"`
-	LineTotalCents int64  `json:"line_total_cents"`
-	Currency       string `json:"currency"`
+	ID                 string     `json:"id"`
+	ShipmentID         string     `json:"shipment_id"`
+	ProductID          string     `json:"product_id"`
+	VendorID           string     `json:"vendor_id"`
+	Title              string     `json:"title"`
+	Qty                int32      `json:"qty"`
+	UnitPriceCents     int64      `json:"unit_price_cents"`
+	LineTotalCents     int64      `json:"line_total_cents"`
+	Currency           string     `json:"currency"`
+	ListUnitPriceCents int64      `json:"list_unit_price_cents,omitempty"`
+	ListCurrency       string     `json:"list_currency,omitempty"`
+	FXRate             string     `json:"fx_rate,omitempty"`
+	Fulfillment        string     `json:"fulfillment,omitempty"`
+	BackorderedQty     int32      `json:"backordered_qty,omitempty"`
+	ExpectedShipDate   *time.Time `json:"expected_ship_date,omitempty"`
+	StockAllocatedAt   *time.Time `json:"stock_allocated_at,omitempty"`
 }
 
 // Order is created by checkout/place-order.
@@ -162,16 +216,59 @@ type Order struct {
 	IdempotencyKey string          `json:"idempotency_key"`
 	Shipments      []OrderShipment `json:"shipments"`
 	Items          []OrderItem     `json:"items"`
-	CreatedAt      time.Time       `json:"created_at"`
+	// FXRates snapshots every rate used to price the order, plus the rate from
+	// the settlement currency into the reporting currency when they differ.
+	FXRates          []FXRateSnapshot `json:"fx_rates,omitempty"`
+	ExpectedShipDate *time.Time       `json:"expected_ship_date,omitempty"`
+	CreatedAt        time.Time        `json:"created_at"`
 }
 
 // ShipmentStatusEvent is an auditable timeline event for shipment progression.
+// Carrier scans are recorded with CarrierStatus set and no actor.
 type ShipmentStatusEvent struct {
-	ShipmentID  string    `json:"shipment_id"`
-	VendorID    string    `json:"vendor_id"`
-	Status      string    `json:"status"`
-	ActorUserID string    `json:"actor_user_id,omitempty"`
-	At          time.Time `json:"at"`
+	ShipmentID     string    `json:"shipment_id"`
+	VendorID       string    `json:"vendor_id"`
+	Status         string    `json:"status"`
+	ActorUserID    string    `json:"actor_user_id,omitempty"`
+	CarrierCode    string    `json:"carrier_code,omitempty"`
+	TrackingNumber string    `json:"tracking_number,omitempty"`
+	CarrierStatus  string    `json:"carrier_status,omitempty"`
+	Location       string    `json:"location,omitempty"`
+	Description    string    `json:"description,omitempty"`
+	At             time.Time `json:"at"`
+}
+
+// ShipmentTracking identifies a parcel with its carrier.
+type ShipmentTracking struct {
+	CarrierCode    string `json:"carrier_code"`
+	TrackingNumber string `json:"tracking_number"`
+}
+
+// IsZero reports whether no tracking details were supplied.
+func (t ShipmentTracking) IsZero() bool {
+	return strings.TrimSpace(t.CarrierCode) == "" && strings.TrimSpace(t.TrackingNumber) == ""
+}
+
+func (t ShipmentTracking) normalized() ShipmentTracking {
+	return ShipmentTracking{
+		CarrierCode:    strings.ToLower(strings.TrimSpace(t.CarrierCode)),
+		TrackingNumber: strings.ToUpper(strings.TrimSpace(t.TrackingNumber)),
+	}
+}
+
+func (t ShipmentTracking) key() string {
+	normalized := t.normalized()
+	return normalized.CarrierCode + "::" + normalized.TrackingNumber
+}
+
+// CarrierScan is a carrier-reported scan applied to a tracked shipment.
+type CarrierScan struct {
+	CarrierStatus string
+	Delivered     bool
+	Refused       bool
+	Location      string
+	Description   string
+	OccurredAt    time.Time
 }
 
 // VendorShipment returns the vendor-centric view of a shipment and its item timeline.
@@ -186,6 +283,9 @@ type VendorShipment struct {
 	ShippingFeeCents int64                 `json:"shipping_fee_cents"`
 	TotalCents       int64                 `json:"total_cents"`
 	Currency         string                `json:"currency"`
+	CarrierCode      string                `json:"carrier_code,omitempty"`
+	TrackingNumber   string                `json:"tracking_number,omitempty"`
+	ExpectedShipDate *time.Time            `json:"expected_ship_date,omitempty"`
 	Items            []OrderItem           `json:"items"`
 	CreatedAt        time.Time             `json:"created_at"`
 	UpdatedAt        time.Time             `json:"updated_at"`
@@ -194,6 +294,16 @@ type VendorShipment struct {
 	Timeline         []ShipmentStatusEvent `json:"timeline"`
 }
 
+// IdleCart is a non-empty buyer cart that has not changed since UpdatedAt.
+type IdleCart struct {
+	CartID        string    `json:"cart_id"`
+	BuyerUserID   string    `json:"buyer_user_id"`
+	Currency      string    `json:"currency"`
+	ItemCount     int32     `json:"item_count"`
+	SubtotalCents int64     `json:"subtotal_cents"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
 type cartState struct {
 	id         string
 	currency   string
@@ -212,6 +322,9 @@ type Service struct {
 	idempotencyToOrderKey map[string]string
 	shipmentOrderIndex    map[string]string
 	shipmentEventsByID    map[string][]ShipmentStatusEvent
+	shipmentByTracking    map[string]string
+	converter             CurrencyConverter
+	reportingCurrency     string
 }
 
 func NewService(shippingFeeCents int64) *Service {
@@ -227,9 +340,20 @@ func NewService(shippingFeeCents int64) *Service {
 		idempotencyToOrderKey: make(map[string]string),
 		shipmentOrderIndex:    make(map[string]string),
 		shipmentEventsByID:    make(map[string][]ShipmentStatusEvent),
+		shipmentByTracking:    make(map[string]string),
 	}
 }
 
+// ConfigureCurrency enables multi-currency carts. Without a converter every
+// cart settles in DefaultCurrency and foreign-priced products are rejected.
+func (s *Service) ConfigureCurrency(converter CurrencyConverter, reportingCurrency string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.converter = converter
+	s.reportingCurrency = strings.ToUpper(strings.TrimSpace(reportingCurrency))
+}
+
 func (s *Service) GetCart(actor Actor) (Cart, error) {
 	key, err := actor.key()
 	if err != nil {
@@ -254,15 +378,17 @@ func (s *Service) UpsertItem(actor Actor, product ProductSnapshot, qty int32) (C
 	if err := validateProductSnapshot(product); err != nil {
 		return Cart{}, err
 	}
-	if product.StockQty > 0 && qty > product.StockQty {
-		return Cart{}, ErrInsufficientStock
+	fulfillment, backorderedQty, err := lineFulfillment(qty, product.StockQty, product.BackorderLimit, product.Preorder)
+	if err != nil {
+		return Cart{}, err
 	}
+	expectedShipDate := copyTime(product.ExpectedShipDate)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	state := s.getOrCreateCartLocked(key)
-	if state.currency != product.Currency {
+	if state.currency != product.Currency && s.converter == nil {
 		return Cart{}, ErrCurrencyMismatch
 	}
 
@@ -270,8 +396,13 @@ func (s *Service) UpsertItem(actor Actor, product ProductSnapshot, qty int32) (C
 		line := state.items[itemID]
 		line.Qty = qty
 		line.AvailableStock = product.StockQty
-		line.UnitPriceCents = product.UnitPriceInclTaxCents
-		line.LineTotalCents = product.UnitPriceInclTaxCents * int64(qty)
+		line.BackorderLimit = product.BackorderLimit
+		line.Fulfillment = fulfillment
+		line.BackorderedQty = backorderedQty
+		line.ExpectedShipDate = expectedShipDate
+		if _, err := s.priceLineLocked(&line, product.UnitPriceInclTaxCents, product.Currency, state.currency); err != nil {
+			return Cart{}, err
+		}
 		line.LastUpdatedUnix = time.Now().UTC().Unix()
 		state.items[itemID] = line
 		state.updatedAt = time.Now().UTC()
@@ -280,16 +411,20 @@ func (s *Service) UpsertItem(actor Actor, product ProductSnapshot, qty int32) (C
 
 	itemID := identifier.New("cit")
 	line := CartItem{
-		ID:              itemID,
-		ProductID:       product.ID,
-		VendorID:        product.VendorID,
-		Title:           strings.TrimSpace(product.Title),
-		Qty:             qty,
-		UnitPriceCents:  product.UnitPriceInclTaxCents,
-		LineTotalCents:  product.UnitPriceInclTaxCents * int64(qty),
-		Currency:        product.Currency,
-		AvailableStock:  product.StockQty,
-		LastUpdatedUnix: time.Now().UTC().Unix(),
+		ID:               itemID,
+		ProductID:        product.ID,
+		VendorID:         product.VendorID,
+		Title:            strings.TrimSpace(product.Title),
+		Qty:              qty,
+		AvailableStock:   product.StockQty,
+		BackorderLimit:   product.BackorderLimit,
+		Fulfillment:      fulfillment,
+		BackorderedQty:   backorderedQty,
+		ExpectedShipDate: expectedShipDate,
+		LastUpdatedUnix:  time.Now().UTC().Unix(),
+	}
+	if _, err := s.priceLineLocked(&line, product.UnitPriceInclTaxCents, product.Currency, state.currency); err != nil {
+		return Cart{}, err
 	}
 
 	state.items[itemID] = line
@@ -317,11 +452,14 @@ func (s *Service) UpdateItemQty(actor Actor, itemID string, qty int32) (Cart, er
 	if !exists {
 		return Cart{}, ErrCartItemNotFound
 	}
-	if line.AvailableStock > 0 && qty > line.AvailableStock {
-		return Cart{}, ErrInsufficientStock
+	fulfillment, backorderedQty, err := lineFulfillment(qty, line.AvailableStock, line.BackorderLimit, line.Fulfillment == FulfillmentPreorder)
+	if err != nil {
+		return Cart{}, err
 	}
 
 	line.Qty = qty
+	line.Fulfillment = fulfillment
+	line.BackorderedQty = backorderedQty
 	line.LineTotalCents = line.UnitPriceCents * int64(qty)
 	line.LastUpdatedUnix = time.Now().UTC().Unix()
 	state.items[itemID] = line
@@ -358,6 +496,43 @@ func (s *Service) RemoveItem(actor Actor, itemID string) (Cart, error) {
 	return snapshotCart(state), nil
 }
 
+// SetCartCurrency switches the currency the cart settles in and reprices every
+// line from its list price at the current rates.
+func (s *Service) SetCartCurrency(actor Actor, currency string) (Cart, error) {
+	key, err := actor.key()
+	if err != nil {
+		return Cart{}, err
+	}
+	normalized := strings.ToUpper(strings.TrimSpace(currency))
+	if normalized == "" {
+		return Cart{}, ErrUnsupportedCurrency
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.getOrCreateCartLocked(key)
+	if normalized != DefaultCurrency && s.converter == nil {
+		return Cart{}, ErrUnsupportedCurrency
+	}
+	if s.converter != nil {
+		if _, _, err := s.converter.Convert(0, DefaultCurrency, normalized); err != nil {
+			return Cart{}, ErrUnsupportedCurrency
+		}
+	}
+
+	previous := state.currency
+	state.currency = normalized
+	if _, err := s.repriceCartLocked(state); err != nil {
+		state.currency = previous
+		_, _ = s.repriceCartLocked(state)
+		return Cart{}, err
+	}
+	state.updatedAt = time.Now().UTC()
+
+	return snapshotCart(state), nil
+}
+
 func (s *Service) Quote(actor Actor) (CheckoutQuote, error) {
 	key, err := actor.key()
 	if err != nil {
@@ -402,10 +577,15 @@ func (s *Service) PlaceOrder(actor Actor, idempotencyKey string) (Order, error)
 	for _, shipment := range quote.Shipments {
 		shipmentID := identifier.New("shp")
 		shipmentIDByVendor[shipment.VendorID] = shipmentID
+		status := ShipmentStatusPending
+		if shipment.OnHold {
+			status = ShipmentStatusOnHold
+		}
 		shipments = append(shipments, OrderShipment{
 			ID:               shipmentID,
 			VendorID:         shipment.VendorID,
-			Status:           ShipmentStatusPending,
+			Status:           status,
+			ExpectedShipDate: shipment.ExpectedShipDate,
 			ItemCount:        shipment.ItemCount,
 			SubtotalCents:    shipment.SubtotalCents,
 			ShippingFeeCents: shipment.ShippingFeeCents,
@@ -420,36 +600,54 @@ func (s *Service) PlaceOrder(actor Actor, idempotencyKey string) (Order, error)
 		if !exists {
 			continue
 		}
-		items = append(items, OrderItem{
-			ID:             identifier.New("oit"),
-			ShipmentID:     shipmentIDByVendor[line.VendorID],
-			ProductID:      line.ProductID,
-			VendorID:       line.VendorID,
-			Title:          line.Title,
-			Qty:            line.Qty,
-			UnitPriceCents: line.UnitPriceCents,
-			LineTotalCents: line.LineTotalCents,
-			Currency:       line.Currency,
-		})
+		item := OrderItem{
+			ID:                 identifier.New("oit"),
+			ShipmentID:         shipmentIDByVendor[line.VendorID],
+			ProductID:          line.ProductID,
+			VendorID:           line.VendorID,
+			Title:              line.Title,
+			Qty:                line.Qty,
+			UnitPriceCents:     line.UnitPriceCents,
+			LineTotalCents:     line.LineTotalCents,
+			Currency:           line.Currency,
+			ListUnitPriceCents: line.ListUnitPriceCents,
+			ListCurrency:       line.ListCurrency,
+			FXRate:             line.FXRate,
+		}
+		if line.Fulfillment != "" {
+			item.Fulfillment = line.Fulfillment
+			item.BackorderedQty = line.BackorderedQty
+			item.ExpectedShipDate = copyTime(line.ExpectedShipDate)
+		}
+		items = append(items, item)
+	}
+
+	fxRates := append([]FXRateSnapshot(nil), quote.FXRates...)
+	if s.converter != nil && s.reportingCurrency != "" && s.reportingCurrency != quote.Currency {
+		if _, rate, err := s.converter.Convert(0, quote.Currency, s.reportingCurrency); err == nil {
+			fxRates = appendFXRate(fxRates, quote.Currency, s.reportingCurrency, rate, now)
+		}
 	}
 
 	order := Order{
-		ID:             identifier.New("ord"),
-		BuyerUserID:    strings.TrimSpace(actor.BuyerUserID),
-		GuestToken:     strings.TrimSpace(actor.GuestToken),
-		Status:         OrderStatusPendingPayment,
-		Currency:       quote.Currency,
-		ItemCount:      quote.ItemCount,
-		ShipmentCount:  quote.ShipmentCount,
-		SubtotalCents:  quote.SubtotalCents,
-		ShippingCents:  quote.ShippingCents,
-		DiscountCents:  0,
-		TaxCents:       0,
-		TotalCents:     quote.TotalCents,
-		IdempotencyKey: normalizedKey,
-		Shipments:      shipments,
-		Items:          items,
-		CreatedAt:      now,
+		ID:               identifier.New("ord"),
+		BuyerUserID:      strings.TrimSpace(actor.BuyerUserID),
+		GuestToken:       strings.TrimSpace(actor.GuestToken),
+		Status:           OrderStatusPendingPayment,
+		Currency:         quote.Currency,
+		ItemCount:        quote.ItemCount,
+		ShipmentCount:    quote.ShipmentCount,
+		SubtotalCents:    quote.SubtotalCents,
+		ShippingCents:    quote.ShippingCents,
+		DiscountCents:    0,
+		TaxCents:         0,
+		TotalCents:       quote.TotalCents,
+		IdempotencyKey:   normalizedKey,
+		Shipments:        shipments,
+		Items:            items,
+		FXRates:          fxRates,
+		ExpectedShipDate: quote.ExpectedShipDate,
+		CreatedAt:        now,
 	}
 
 	s.ordersByID[order.ID] = order
@@ -573,6 +771,9 @@ func (s *Service) UpdateOrderStatus(orderID, nextStatus string) (Order, error) {
 		return Order{}, ErrOrderStatusTransition
 	}
 
+	if targetStatus == OrderStatusExpired {
+		return s.expireOrderLocked(order), nil
+	}
 	order.Status = targetStatus
 	s.ordersByID[order.ID] = order
 	return order, nil
@@ -646,6 +847,17 @@ func (s *Service) GetVendorShipment(vendorID, shipmentID string) (VendorShipment
 
 // UpdateVendorShipmentStatus advances shipment status using a strict state machine.
 func (s *Service) UpdateVendorShipmentStatus(vendorID, shipmentID, nextStatus, actorUserID string) (VendorShipment, error) {
+	return s.UpdateVendorShipmentStatusWithTracking(vendorID, shipmentID, nextStatus, actorUserID, ShipmentTracking{})
+}
+
+// UpdateVendorShipmentStatusWithTracking advances shipment status and, when the
+// shipment is marked shipped, attaches the carrier code and tracking number.
+// Tracking may be corrected on an already shipped shipment by repeating the
+// shipped status with new details.
+func (s *Service) UpdateVendorShipmentStatusWithTracking(
+	vendorID, shipmentID, nextStatus, actorUserID string,
+	tracking ShipmentTracking,
+) (VendorShipment, error) {
 	normalizedVendorID := strings.TrimSpace(vendorID)
 	if normalizedVendorID == "" {
 		return VendorShipment{}, ErrInvalidVendor
@@ -658,52 +870,113 @@ func (s *Service) UpdateVendorShipmentStatus(vendorID, shipmentID, nextStatus, a
 	if !isValidShipmentStatus(targetStatus) {
 		return VendorShipment{}, ErrInvalidShipmentStatus
 	}
+	hasTracking := !tracking.IsZero()
+	tracking = tracking.normalized()
+	if hasTracking {
+		if targetStatus != ShipmentStatusShipped || tracking.CarrierCode == "" || tracking.TrackingNumber == "" {
+			return VendorShipment{}, ErrInvalidTracking
+		}
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	shipmentOrderID, exists := s.shipmentOrderIndex[normalizedShipmentID]
-	if !exists {
-		return VendorShipment{}, ErrShipmentNotFound
+	order, shipmentIndex, err := s.findShipmentLocked(normalizedShipmentID)
+	if err != nil {
+		return VendorShipment{}, err
 	}
-	order, exists := s.ordersByID[shipmentOrderID]
-	if !exists {
-		return VendorShipment{}, ErrShipmentNotFound
+
+	shipment := order.Shipments[shipmentIndex]
+	if shipment.VendorID != normalizedVendorID {
+		return VendorShipment{}, ErrShipmentForbidden
+	}
+	if hasTracking {
+		if ownerID, exists := s.shipmentByTracking[tracking.key()]; exists && ownerID != shipment.ID {
+			return VendorShipment{}, ErrTrackingInUse
+		}
 	}
 
-	shipmentIndex := -1
-	for i, shipment := range order.Shipments {
-		if shipment.ID == normalizedShipmentID {
-			shipmentIndex = i
-			break
+	trackingChanged := hasTracking &&
+		(shipment.CarrierCode != tracking.CarrierCode || shipment.TrackingNumber != tracking.TrackingNumber)
+	if shipment.Status == targetStatus && !trackingChanged {
+		return s.buildVendorShipmentLocked(order, shipment), nil
+	}
+	if !canTransitionShipmentStatus(shipment.Status, targetStatus) {
+		return VendorShipment{}, ErrShipmentTransition
+	}
+
+	now := time.Now().UTC()
+	if shipment.Status != targetStatus {
+		shipment.Status = targetStatus
+		if targetStatus == ShipmentStatusShipped {
+			shippedAt := now
+			shipment.ShippedAt = &shippedAt
+		}
+		if targetStatus == ShipmentStatusDelivered {
+			deliveredAt := now
+			shipment.DeliveredAt = &deliveredAt
 		}
 	}
-	if shipmentIndex < 0 {
-		return VendorShipment{}, ErrShipmentNotFound
+	if trackingChanged {
+		if shipment.TrackingNumber != "" {
+			delete(s.shipmentByTracking, ShipmentTracking{
+				CarrierCode:    shipment.CarrierCode,
+				TrackingNumber: shipment.TrackingNumber,
+			}.key())
+		}
+		shipment.CarrierCode = tracking.CarrierCode
+		shipment.TrackingNumber = tracking.TrackingNumber
+		s.shipmentByTracking[tracking.key()] = shipment.ID
 	}
+	shipment.UpdatedAt = now
+	order.Shipments[shipmentIndex] = shipment
+	s.ordersByID[order.ID] = order
+
+	event := ShipmentStatusEvent{
+		ShipmentID:  shipment.ID,
+		VendorID:    shipment.VendorID,
+		Status:      shipment.Status,
+		ActorUserID: strings.TrimSpace(actorUserID),
+		At:          now,
+	}
+	if trackingChanged {
+		event.CarrierCode = shipment.CarrierCode
+		event.TrackingNumber = shipment.TrackingNumber
+	}
+	s.shipmentEventsByID[shipment.ID] = append(s.shipmentEventsByID[shipment.ID], event)
+
+	return s.buildVendorShipmentLocked(order, shipment), nil
+}
+
+// RefuseShipmentDelivery cancels a shipped shipment the buyer refused to
+// accept at the door. Repeating it on the cancelled shipment is a no-op.
+func (s *Service) RefuseShipmentDelivery(vendorID, shipmentID, actorUserID string) (VendorShipment, error) {
+	normalizedVendorID := strings.TrimSpace(vendorID)
+	if normalizedVendorID == "" {
+		return VendorShipment{}, ErrInvalidVendor
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	order, shipmentIndex, err := s.findShipmentLocked(strings.TrimSpace(shipmentID))
+	if err != nil {
+		return VendorShipment{}, err
+	}
 	shipment := order.Shipments[shipmentIndex]
 	if shipment.VendorID != normalizedVendorID {
 		return VendorShipment{}, ErrShipmentForbidden
 	}
-	if shipment.Status == targetStatus {
+	if shipment.Status == ShipmentStatusCancelled {
 		return s.buildVendorShipmentLocked(order, shipment), nil
 	}
-	if !canTransitionShipmentStatus(shipment.Status, targetStatus) {
+	if shipment.Status != ShipmentStatusShipped {
 		return VendorShipment{}, ErrShipmentTransition
 	}
 
 	now := time.Now().UTC()
-	shipment.Status = targetStatus
+	shipment.Status = ShipmentStatusCancelled
 	shipment.UpdatedAt = now
-	if targetStatus == ShipmentStatusShipped {
-		shippedAt := now
-		shipment.ShippedAt = &shippedAt
-	}
-	if targetStatus == ShipmentStatusDelivered {
-		deliveredAt := now
-		shipment.DeliveredAt = &deliveredAt
-	}
 	order.Shipments[shipmentIndex] = shipment
 	s.ordersByID[order.ID] = order
 	s.shipmentEventsByID[shipment.ID] = append(s.shipmentEventsByID[shipment.ID], ShipmentStatusEvent{
@@ -711,12 +984,189 @@ func (s *Service) UpdateVendorShipmentStatus(vendorID, shipmentID, nextStatus, a
 		VendorID:    shipment.VendorID,
 		Status:      shipment.Status,
 		ActorUserID: strings.TrimSpace(actorUserID),
+		Description: "delivery refused by buyer",
 		At:          now,
 	})
 
 	return s.buildVendorShipmentLocked(order, shipment), nil
 }
 
+// ApplyCarrierScan records a carrier scan on the shipment that owns the
+// tracking number. A delivered scan on a shipped shipment marks it delivered;
+// a refused one cancels it.
+func (s *Service) ApplyCarrierScan(tracking ShipmentTracking, scan CarrierScan) (VendorShipment, error) {
+	tracking = tracking.normalized()
+	if tracking.CarrierCode == "" || tracking.TrackingNumber == "" {
+		return VendorShipment{}, ErrInvalidTracking
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shipmentID, exists := s.shipmentByTracking[tracking.key()]
+	if !exists {
+		return VendorShipment{}, ErrTrackingNotFound
+	}
+	order, shipmentIndex, err := s.findShipmentLocked(shipmentID)
+	if err != nil {
+		return VendorShipment{}, err
+	}
+
+	occurredAt := scan.OccurredAt.UTC()
+	if scan.OccurredAt.IsZero() {
+		occurredAt = time.Now().UTC()
+	}
+
+	shipment := order.Shipments[shipmentIndex]
+	if scan.Delivered && shipment.Status == ShipmentStatusShipped {
+		deliveredAt := occurredAt
+		shipment.Status = ShipmentStatusDelivered
+		shipment.DeliveredAt = &deliveredAt
+		shipment.UpdatedAt = time.Now().UTC()
+		order.Shipments[shipmentIndex] = shipment
+		s.ordersByID[order.ID] = order
+	}
+	if scan.Refused && shipment.Status == ShipmentStatusShipped {
+		shipment.Status = ShipmentStatusCancelled
+		shipment.UpdatedAt = time.Now().UTC()
+		order.Shipments[shipmentIndex] = shipment
+		s.ordersByID[order.ID] = order
+	}
+
+	s.shipmentEventsByID[shipment.ID] = append(s.shipmentEventsByID[shipment.ID], ShipmentStatusEvent{
+		ShipmentID:     shipment.ID,
+		VendorID:       shipment.VendorID,
+		Status:         shipment.Status,
+		CarrierCode:    tracking.CarrierCode,
+		TrackingNumber: tracking.TrackingNumber,
+		CarrierStatus:  strings.ToLower(strings.TrimSpace(scan.CarrierStatus)),
+		Location:       strings.TrimSpace(scan.Location),
+		Description:    strings.TrimSpace(scan.Description),
+		At:             occurredAt,
+	})
+
+	return s.buildVendorShipmentLocked(order, shipment), nil
+}
+
+// AllocateArrivedStock assigns arrivedQty newly arrived units of a restocked
+// product to held backorder and pre-order lines, oldest order first. Callers
+// pass only the units that arrived, not the new stock level, so units already
+// allocated by an earlier restock are never handed out again. Allocation stops
+// at the first line the stock cannot cover so later orders never jump the
+// queue. Shipments whose held lines are all covered move from on_hold to
+// pending and are returned.
+func (s *Service) AllocateArrivedStock(productID string, arrivedQty int32) []VendorShipment {
+	normalizedProductID := strings.TrimSpace(productID)
+	if normalizedProductID == "" || arrivedQty <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := make([]Order, 0)
+	for _, order := range s.ordersByID {
+		for _, shipment := range order.Shipments {
+			if shipment.Status == ShipmentStatusOnHold {
+				orders = append(orders, order)
+				break
+			}
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].ID < orders[j].ID
+		}
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+
+	now := time.Now().UTC()
+	remaining := arrivedQty
+	released := make([]VendorShipment, 0)
+	for _, order := range orders {
+		heldShipments := make(map[string]bool)
+		for _, shipment := range order.Shipments {
+			if shipment.Status == ShipmentStatusOnHold {
+				heldShipments[shipment.ID] = true
+			}
+		}
+
+		allocated := false
+		for i, item := range order.Items {
+			if item.ProductID != normalizedProductID || !heldShipments[item.ShipmentID] {
+				continue
+			}
+			if item.Fulfillment == "" || item.StockAllocatedAt != nil {
+				continue
+			}
+			if item.BackorderedQty > remaining {
+				remaining = 0
+				break
+			}
+			remaining -= item.BackorderedQty
+			allocatedAt := now
+			item.StockAllocatedAt = &allocatedAt
+			order.Items[i] = item
+			allocated = true
+		}
+		if !allocated {
+			if remaining == 0 {
+				break
+			}
+			continue
+		}
+
+		for i, shipment := range order.Shipments {
+			if shipment.Status != ShipmentStatusOnHold || !shipmentStockAllocated(order, shipment.ID) {
+				continue
+			}
+			shipment.Status = ShipmentStatusPending
+			shipment.UpdatedAt = now
+			order.Shipments[i] = shipment
+			s.shipmentEventsByID[shipment.ID] = append(s.shipmentEventsByID[shipment.ID], ShipmentStatusEvent{
+				ShipmentID:  shipment.ID,
+				VendorID:    shipment.VendorID,
+				Status:      shipment.Status,
+				Description: "stock arrived for held items",
+				At:          now,
+			})
+			released = append(released, s.buildVendorShipmentLocked(order, shipment))
+		}
+		s.ordersByID[order.ID] = order
+		if remaining == 0 {
+			break
+		}
+	}
+
+	return released
+}
+
+func shipmentStockAllocated(order Order, shipmentID string) bool {
+	for _, item := range order.Items {
+		if item.ShipmentID == shipmentID && item.Fulfillment != "" && item.StockAllocatedAt == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) findShipmentLocked(shipmentID string) (Order, int, error) {
+	shipmentOrderID, exists := s.shipmentOrderIndex[shipmentID]
+	if !exists {
+		return Order{}, -1, ErrShipmentNotFound
+	}
+	order, exists := s.ordersByID[shipmentOrderID]
+	if !exists {
+		return Order{}, -1, ErrShipmentNotFound
+	}
+	for i, shipment := range order.Shipments {
+		if shipment.ID == shipmentID {
+			return order, i, nil
+		}
+	}
+	return Order{}, -1, ErrShipmentNotFound
+}
+
 func (s *Service) MarkOrderPaid(orderID string) (Order, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -755,6 +1205,9 @@ func (s *Service) buildVendorShipmentLocked(order Order, shipment OrderShipment)
 		ShippingFeeCents: shipment.ShippingFeeCents,
 		TotalCents:       shipment.TotalCents,
 		Currency:         order.Currency,
+		CarrierCode:      shipment.CarrierCode,
+		TrackingNumber:   shipment.TrackingNumber,
+		ExpectedShipDate: shipment.ExpectedShipDate,
 		Items:            items,
 		CreatedAt:        order.CreatedAt,
 		UpdatedAt:        shipment.UpdatedAt,
@@ -774,7 +1227,7 @@ func normalizeOrderStatus(status string) string {
 
 func isValidOrderStatus(status string) bool {
 	switch normalizeOrderStatus(status) {
-	case OrderStatusPendingPayment, OrderStatusCODConfirmed, OrderStatusPaid, OrderStatusPaymentFailed:
+	case OrderStatusPendingPayment, OrderStatusCODConfirmed, OrderStatusPaid, OrderStatusPaymentFailed, OrderStatusExpired:
 		return true
 	default:
 		return false
@@ -783,7 +1236,7 @@ func isValidOrderStatus(status string) bool {
 
 func isValidShipmentStatus(status string) bool {
 	switch normalizeShipmentStatus(status) {
-	case ShipmentStatusPending, ShipmentStatusPacked, ShipmentStatusShipped, ShipmentStatusDelivered, ShipmentStatusCancelled:
+	case ShipmentStatusOnHold, ShipmentStatusPending, ShipmentStatusPacked, ShipmentStatusShipped, ShipmentStatusDelivered, ShipmentStatusCancelled:
 		return true
 	default:
 		return false
@@ -802,17 +1255,20 @@ func canTransitionOrderStatus(current, next string) bool {
 			OrderStatusPaymentFailed: true,
 			OrderStatusCODConfirmed:  true,
 			OrderStatusPaid:          true,
+			OrderStatusExpired:       true,
 		},
 		OrderStatusPaymentFailed: {
 			OrderStatusPendingPayment: true,
 			OrderStatusCODConfirmed:   true,
 			OrderStatusPaid:           true,
+			OrderStatusExpired:        true,
 		},
 		OrderStatusCODConfirmed: {
 			OrderStatusPaymentFailed: true,
 			OrderStatusPaid:          true,
 		},
-		OrderStatusPaid: {},
+		OrderStatusPaid:    {},
+		OrderStatusExpired: {},
 	}
 
 	transitions, exists := allowed[normalizedCurrent]
@@ -830,6 +1286,10 @@ func canTransitionShipmentStatus(current, next string) bool {
 	}
 
 	allowed := map[string]map[string]bool{
+		ShipmentStatusOnHold: {
+			ShipmentStatusPending:   true,
+			ShipmentStatusCancelled: true,
+		},
 		ShipmentStatusPending: {
 			ShipmentStatusPacked:    true,
 			ShipmentStatusShipped:   true,
@@ -887,6 +1347,99 @@ func (s *Service) MarkOrderPaymentFailed(orderID string) (Order, bool) {
 	return order, true
 }
 
+// MarkOrderExpired closes an order whose payment was abandoned. Only orders
+// still waiting for payment expire; their shipments are cancelled so vendors
+// stop seeing them. An order that moved on is returned unchanged.
+func (s *Service) MarkOrderExpired(orderID string) (Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, exists := s.ordersByID[strings.TrimSpace(orderID)]
+	if !exists {
+		return Order{}, false
+	}
+	if order.Status != OrderStatusPendingPayment && order.Status != OrderStatusPaymentFailed {
+		return order, true
+	}
+
+	return s.expireOrderLocked(order), true
+}
+
+func (s *Service) expireOrderLocked(order Order) Order {
+	now := time.Now().UTC()
+	order.Status = OrderStatusExpired
+	for i, shipment := range order.Shipments {
+		if !canTransitionShipmentStatus(shipment.Status, ShipmentStatusCancelled) {
+			continue
+		}
+		shipment.Status = ShipmentStatusCancelled
+		shipment.UpdatedAt = now
+		order.Shipments[i] = shipment
+		s.shipmentEventsByID[shipment.ID] = append(s.shipmentEventsByID[shipment.ID], ShipmentStatusEvent{
+			ShipmentID:  shipment.ID,
+			VendorID:    shipment.VendorID,
+			Status:      shipment.Status,
+			Description: "order expired before payment",
+			At:          now,
+		})
+	}
+	s.ordersByID[order.ID] = order
+
+	return order
+}
+
+// ListIdleBuyerCarts returns non-empty carts of authenticated buyers that have
+// not been updated since idleSince, oldest first. Guest carts are skipped since
+// there is nobody to notify.
+func (s *Service) ListIdleBuyerCarts(idleSince time.Time) []IdleCart {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]IdleCart, 0)
+	for actorKey, state := range s.cartsByActorKey {
+		if !strings.HasPrefix(actorKey, "usr:") || len(state.orderedIDs) == 0 {
+			continue
+		}
+		if !state.updatedAt.Before(idleSince) {
+			continue
+		}
+		cart := snapshotCart(state)
+		items = append(items, IdleCart{
+			CartID:        cart.ID,
+			BuyerUserID:   strings.TrimPrefix(actorKey, "usr:"),
+			Currency:      cart.Currency,
+			ItemCount:     cart.ItemCount,
+			SubtotalCents: cart.SubtotalCents,
+			UpdatedAt:     cart.UpdatedAt,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].UpdatedAt.Equal(items[j].UpdatedAt) {
+			return items[i].CartID < items[j].CartID
+		}
+		return items[i].UpdatedAt.Before(items[j].UpdatedAt)
+	})
+	return items
+}
+
+// ExpireIdleCarts drops every cart, guest or buyer, that has not been updated
+// since idleSince and returns the expired cart ids.
+func (s *Service) ExpireIdleCarts(idleSince time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := make([]string, 0)
+	for actorKey, state := range s.cartsByActorKey {
+		if !state.updatedAt.Before(idleSince) {
+			continue
+		}
+		expired = append(expired, state.id)
+		delete(s.cartsByActorKey, actorKey)
+	}
+	sort.Strings(expired)
+	return expired
+}
+
 func validateProductSnapshot(product ProductSnapshot) error {
 	if strings.TrimSpace(product.ID) == "" || strings.TrimSpace(product.VendorID) == "" {
 		return ErrInvalidProduct
@@ -897,12 +1450,50 @@ func validateProductSnapshot(product ProductSnapshot) error {
 	if product.UnitPriceInclTaxCents < 0 {
 		return ErrInvalidProduct
 	}
-	if product.StockQty < 0 {
+	if product.StockQty < 0 || product.BackorderLimit < 0 {
+		return ErrInvalidProduct
+	}
+	if product.Preorder && product.ExpectedShipDate == nil {
 		return ErrInvalidProduct
 	}
 	return nil
 }
 
+// lineFulfillment classifies a cart quantity against stock. Pre-order lines
+// are held in full; backorder lines hold the units beyond stock. A product
+// with no stock and no backorder limit is not stock-limited here.
+func lineFulfillment(qty, stockQty, backorderLimit int32, preorder bool) (string, int32, error) {
+	if preorder {
+		return FulfillmentPreorder, qty, nil
+	}
+	if (stockQty > 0 || backorderLimit > 0) && qty > stockQty+backorderLimit {
+		return "", 0, ErrInsufficientStock
+	}
+	if backorderLimit > 0 && qty > stockQty {
+		return FulfillmentBackorder, qty - stockQty, nil
+	}
+	return "", 0, nil
+}
+
+func copyTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// laterTime returns the later of two optional times.
+func laterTime(current, candidate *time.Time) *time.Time {
+	if candidate == nil {
+		return current
+	}
+	if current == nil || candidate.After(*current) {
+		return copyTime(candidate)
+	}
+	return current
+}
+
 func (s *Service) getOrCreateCartLocked(actorKey string) *cartState {
 	if existing, ok := s.cartsByActorKey[actorKey]; ok {
 		return existing
@@ -926,10 +1517,29 @@ func (s *Service) buildQuoteLocked(state *cartState) (CheckoutQuote, error) {
 		return CheckoutQuote{}, ErrCartEmpty
 	}
 
+	fxRates, err := s.repriceCartLocked(state)
+	if err != nil {
+		return CheckoutQuote{}, err
+	}
+	shippingFee := s.shippingFeeCents
+	if state.currency != DefaultCurrency {
+		if s.converter == nil {
+			return CheckoutQuote{}, ErrUnsupportedCurrency
+		}
+		converted, rate, err := s.converter.Convert(s.shippingFeeCents, DefaultCurrency, state.currency)
+		if err != nil {
+			return CheckoutQuote{}, ErrUnsupportedCurrency
+		}
+		shippingFee = converted
+		fxRates = appendFXRate(fxRates, DefaultCurrency, state.currency, rate, time.Now().UTC())
+	}
+
 	type shipmentAccumulator struct {
-		itemCount     int32
-		subtotalCents int64
-		items         []CartItem
+		itemCount        int32
+		subtotalCents    int64
+		onHold           bool
+		expectedShipDate *time.Time
+		items            []CartItem
 	}
 
 	byVendor := make(map[string]*shipmentAccumulator)
@@ -953,6 +1563,10 @@ func (s *Service) buildQuoteLocked(state *cartState) (CheckoutQuote, error) {
 		bucket.itemCount += line.Qty
 		bucket.subtotalCents += line.LineTotalCents
 		bucket.items = append(bucket.items, line)
+		if line.Fulfillment != "" {
+			bucket.onHold = true
+			bucket.expectedShipDate = laterTime(bucket.expectedShipDate, line.ExpectedShipDate)
+		}
 
 		totalItemCount += line.Qty
 		subtotal += line.LineTotalCents
@@ -965,10 +1579,11 @@ func (s *Service) buildQuoteLocked(state *cartState) (CheckoutQuote, error) {
 	sort.Strings(vendorIDs)
 	shipments := make([]QuoteShipment, 0, len(vendorIDs))
 	var shippingTotal int64
+	var expectedShipDate *time.Time
 
 	for _, vendorID := range vendorIDs {
 		bucket := byVendor[vendorID]
-		shipping := s.shippingFeeCents
+		shipping := shippingFee
 		shipmentTotal := bucket.subtotalCents + shipping
 		shipments = append(shipments, QuoteShipment{
 			VendorID:         vendorID,
@@ -976,22 +1591,100 @@ func (s *Service) buildQuoteLocked(state *cartState) (CheckoutQuote, error) {
 			SubtotalCents:    bucket.subtotalCents,
 			ShippingFeeCents: shipping,
 			TotalCents:       shipmentTotal,
+			OnHold:           bucket.onHold,
+			ExpectedShipDate: bucket.expectedShipDate,
 			Items:            append([]CartItem(nil), bucket.items...),
 		})
 		shippingTotal += shipping
+		expectedShipDate = laterTime(expectedShipDate, bucket.expectedShipDate)
 	}
 
 	return CheckoutQuote{
-		Currency:      state.currency,
-		ItemCount:     totalItemCount,
-		ShipmentCount: int32(len(shipments)),
-		SubtotalCents: subtotal,
-		ShippingCents: shippingTotal,
-		TotalCents:    subtotal + shippingTotal,
-		Shipments:     shipments,
+		Currency:         state.currency,
+		ItemCount:        totalItemCount,
+		ShipmentCount:    int32(len(shipments)),
+		SubtotalCents:    subtotal,
+		ShippingCents:    shippingTotal,
+		TotalCents:       subtotal + shippingTotal,
+		Shipments:        shipments,
+		FXRates:          fxRates,
+		ExpectedShipDate: expectedShipDate,
 	}, nil
 }
 
+// repriceCartLocked converts every line from its list price into the cart
+// currency at the current rates and returns the rates used.
+func (s *Service) repriceCartLocked(state *cartState) ([]FXRateSnapshot, error) {
+	now := time.Now().UTC()
+	fxRates := make([]FXRateSnapshot, 0)
+	for _, itemID := range state.orderedIDs {
+		line, exists := state.items[itemID]
+		if !exists {
+			continue
+		}
+
+		listUnitPrice := line.UnitPriceCents
+		listCurrency := line.Currency
+		if line.ListCurrency != "" {
+			listUnitPrice = line.ListUnitPriceCents
+			listCurrency = line.ListCurrency
+		}
+
+		rate, err := s.priceLineLocked(&line, listUnitPrice, listCurrency, state.currency)
+		if err != nil {
+			return nil, err
+		}
+		if rate != "" {
+			fxRates = appendFXRate(fxRates, listCurrency, state.currency, rate, now)
+		}
+		state.items[itemID] = line
+	}
+	return fxRates, nil
+}
+
+// priceLineLocked sets the line's unit price in the cart currency and returns
+// the FX rate applied, or "" when no conversion was needed.
+func (s *Service) priceLineLocked(line *CartItem, listUnitPriceCents int64, listCurrency, cartCurrency string) (string, error) {
+	if listCurrency == cartCurrency {
+		line.UnitPriceCents = listUnitPriceCents
+		line.Currency = cartCurrency
+		line.ListUnitPriceCents = 0
+		line.ListCurrency = ""
+		line.FXRate = ""
+		line.LineTotalCents = line.UnitPriceCents * int64(line.Qty)
+		return "", nil
+	}
+	if s.converter == nil {
+		return "", ErrCurrencyMismatch
+	}
+
+	converted, rate, err := s.converter.Convert(listUnitPriceCents, listCurrency, cartCurrency)
+	if err != nil {
+		return "", ErrUnsupportedCurrency
+	}
+	line.UnitPriceCents = converted
+	line.Currency = cartCurrency
+	line.ListUnitPriceCents = listUnitPriceCents
+	line.ListCurrency = listCurrency
+	line.FXRate = rate
+	line.LineTotalCents = line.UnitPriceCents * int64(line.Qty)
+	return rate, nil
+}
+
+func appendFXRate(rates []FXRateSnapshot, fromCurrency, toCurrency, rate string, capturedAt time.Time) []FXRateSnapshot {
+	for _, existing := range rates {
+		if existing.FromCurrency == fromCurrency && existing.ToCurrency == toCurrency {
+			return rates
+		}
+	}
+	return append(rates, FXRateSnapshot{
+		FromCurrency: fromCurrency,
+		ToCurrency:   toCurrency,
+		Rate:         rate,
+		CapturedAt:   capturedAt,
+	})
+}
+
 func snapshotCart(state *cartState) Cart {
 	items := make([]CartItem, 0, len(state.orderedIDs))
 	var itemCount int32
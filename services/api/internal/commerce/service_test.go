@@ -1,6 +1,10 @@
 package commerce
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+)
 
 func TestQuoteAndPlaceOrderMultiShipmentWithIdempotency(t *testing.T) {
 	svc := NewService(500)
@@ -386,6 +390,49 @@ func TestMarkOrderPaymentStatuses(t *testing.T) {
 	}
 }
 
+func TestMarkOrderExpiredCancelsOpenShipments(t *testing.T) {
+	svc := NewService(500)
+	actor := Actor{GuestToken: "gst_test_expired"}
+
+	if _, err := svc.UpsertItem(actor, ProductSnapshot{
+		ID:                    "prd_expired",
+		VendorID:              "ven_expired",
+		Title:                 "Desk Lamp",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 4200,
+		StockQty:              3,
+	}, 1); err != nil {
+		t.Fatalf("UpsertItem() error = %v", err)
+	}
+	order, err := svc.PlaceOrder(actor, "idem-expired")
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+
+	expired, ok := svc.MarkOrderExpired(order.ID)
+	if !ok || expired.Status != OrderStatusExpired {
+		t.Fatalf("expected order expired, got %s ok=%v", expired.Status, ok)
+	}
+	shipment, found, err := svc.GetVendorShipment("ven_expired", expired.Shipments[0].ID)
+	if err != nil || !found {
+		t.Fatalf("GetVendorShipment() found=%v err=%v", found, err)
+	}
+	last := shipment.Timeline[len(shipment.Timeline)-1]
+	if shipment.Status != ShipmentStatusCancelled || last.Status != ShipmentStatusCancelled {
+		t.Fatalf("expected shipment cancelled with a timeline event, got %s %+v", shipment.Status, last)
+	}
+
+	if !canTransitionOrderStatus(OrderStatusPaymentFailed, OrderStatusExpired) || canTransitionOrderStatus(OrderStatusExpired, OrderStatusPaid) {
+		t.Fatal("expected expired to be reachable from unpaid orders only and final")
+	}
+	if _, err := svc.UpdateOrderStatus(order.ID, OrderStatusPaid); !errors.Is(err, ErrOrderStatusTransition) {
+		t.Fatalf("expected expired order to reject status changes, got %v", err)
+	}
+	if _, ok := svc.MarkOrderExpired("ord_missing"); ok {
+		t.Fatal("expected unknown order lookup to fail")
+	}
+}
+
 func TestVendorShipmentListingAndStatusTransitions(t *testing.T) {
 	svc := NewService(500)
 	actor := Actor{GuestToken: "gst_test_vendor_shipments"}
@@ -567,3 +614,390 @@ func TestAdminOrderOperationsListingAndStatusUpdates(t *testing.T) {
 		t.Fatalf("expected ErrOrderNotFound on missing order, got %v", err)
 	}
 }
+
+func TestShipmentTrackingAndCarrierScans(t *testing.T) {
+	svc := NewService(500)
+	actor := Actor{GuestToken: "gst_test_tracking"}
+
+	if _, err := svc.UpsertItem(actor, ProductSnapshot{
+		ID:                    "prd_tracking_a",
+		VendorID:              "ven_tracking_a",
+		Title:                 "Notebook",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 1200,
+		StockQty:              10,
+	}, 1); err != nil {
+		t.Fatalf("UpsertItem() vendor a error = %v", err)
+	}
+	if _, err := svc.UpsertItem(actor, ProductSnapshot{
+		ID:                    "prd_tracking_b",
+		VendorID:              "ven_tracking_b",
+		Title:                 "Poster",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 1800,
+		StockQty:              10,
+	}, 1); err != nil {
+		t.Fatalf("UpsertItem() vendor b error = %v", err)
+	}
+
+	order, err := svc.PlaceOrder(actor, "idem-tracking")
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	shipmentIDByVendor := make(map[string]string, len(order.Shipments))
+	for _, shipment := range order.Shipments {
+		shipmentIDByVendor[shipment.VendorID] = shipment.ID
+	}
+	shipmentA := shipmentIDByVendor["ven_tracking_a"]
+	shipmentB := shipmentIDByVendor["ven_tracking_b"]
+
+	tracking := ShipmentTracking{CarrierCode: "FAKE", TrackingNumber: "trk-1"}
+	if _, err := svc.UpdateVendorShipmentStatusWithTracking("ven_tracking_a", shipmentA, ShipmentStatusPacked, "usr_a", tracking); err != ErrInvalidTracking {
+		t.Fatalf("expected ErrInvalidTracking for tracking on packed, got %v", err)
+	}
+	if _, err := svc.UpdateVendorShipmentStatusWithTracking("ven_tracking_a", shipmentA, ShipmentStatusShipped, "usr_a", ShipmentTracking{
+		CarrierCode: "fake",
+	}); err != ErrInvalidTracking {
+		t.Fatalf("expected ErrInvalidTracking for missing tracking number, got %v", err)
+	}
+
+	shipped, err := svc.UpdateVendorShipmentStatusWithTracking("ven_tracking_a", shipmentA, ShipmentStatusShipped, "usr_a", tracking)
+	if err != nil {
+		t.Fatalf("UpdateVendorShipmentStatusWithTracking(shipped) error = %v", err)
+	}
+	if shipped.CarrierCode != "fake" || shipped.TrackingNumber != "TRK-1" {
+		t.Fatalf("expected normalized tracking on shipment, got %s/%s", shipped.CarrierCode, shipped.TrackingNumber)
+	}
+	lastEvent := shipped.Timeline[len(shipped.Timeline)-1]
+	if lastEvent.TrackingNumber != "TRK-1" || lastEvent.Status != ShipmentStatusShipped {
+		t.Fatalf("expected shipped timeline event with tracking, got %+v", lastEvent)
+	}
+
+	if _, err := svc.UpdateVendorShipmentStatusWithTracking("ven_tracking_b", shipmentB, ShipmentStatusShipped, "usr_b", tracking); err != ErrTrackingInUse {
+		t.Fatalf("expected ErrTrackingInUse, got %v", err)
+	}
+	if _, err := svc.ApplyCarrierScan(ShipmentTracking{CarrierCode: "fake", TrackingNumber: "TRK-404"}, CarrierScan{
+		CarrierStatus: "in_transit",
+	}); err != ErrTrackingNotFound {
+		t.Fatalf("expected ErrTrackingNotFound, got %v", err)
+	}
+
+	inTransit, err := svc.ApplyCarrierScan(tracking, CarrierScan{
+		CarrierStatus: "in_transit",
+		Location:      "Hub A",
+	})
+	if err != nil {
+		t.Fatalf("ApplyCarrierScan(in_transit) error = %v", err)
+	}
+	if inTransit.Status != ShipmentStatusShipped {
+		t.Fatalf("expected shipment to remain shipped after transit scan, got %s", inTransit.Status)
+	}
+
+	deliveredAt := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	delivered, err := svc.ApplyCarrierScan(tracking, CarrierScan{
+		CarrierStatus: "delivered",
+		Delivered:     true,
+		Location:      "Front door",
+		OccurredAt:    deliveredAt,
+	})
+	if err != nil {
+		t.Fatalf("ApplyCarrierScan(delivered) error = %v", err)
+	}
+	if delivered.Status != ShipmentStatusDelivered {
+		t.Fatalf("expected delivered status after carrier scan, got %s", delivered.Status)
+	}
+	if delivered.DeliveredAt == nil || !delivered.DeliveredAt.Equal(deliveredAt) {
+		t.Fatalf("expected delivered_at from scan time, got %v", delivered.DeliveredAt)
+	}
+	if len(delivered.Timeline) != 4 {
+		t.Fatalf("expected 4 timeline events, got %d", len(delivered.Timeline))
+	}
+	scanEvent := delivered.Timeline[3]
+	if scanEvent.CarrierStatus != "delivered" || scanEvent.ActorUserID != "" || scanEvent.Location != "Front door" {
+		t.Fatalf("unexpected carrier scan timeline event %+v", scanEvent)
+	}
+
+	if _, err := svc.RefuseShipmentDelivery("ven_tracking_a", shipmentA, "usr_a"); err != ErrShipmentTransition {
+		t.Fatalf("expected ErrShipmentTransition refusing a delivered shipment, got %v", err)
+	}
+	refusedTracking := ShipmentTracking{CarrierCode: "fake", TrackingNumber: "trk-2"}
+	if _, err := svc.UpdateVendorShipmentStatusWithTracking("ven_tracking_b", shipmentB, ShipmentStatusShipped, "usr_b", refusedTracking); err != nil {
+		t.Fatalf("UpdateVendorShipmentStatusWithTracking(shipped) vendor b error = %v", err)
+	}
+	if _, err := svc.RefuseShipmentDelivery("ven_tracking_a", shipmentB, "usr_a"); err != ErrShipmentForbidden {
+		t.Fatalf("expected ErrShipmentForbidden, got %v", err)
+	}
+	refused, err := svc.ApplyCarrierScan(refusedTracking, CarrierScan{CarrierStatus: "refused", Refused: true})
+	if err != nil {
+		t.Fatalf("ApplyCarrierScan(refused) error = %v", err)
+	}
+	if refused.Status != ShipmentStatusCancelled || refused.DeliveredAt != nil {
+		t.Fatalf("expected refused parcel cancelled, got %+v", refused)
+	}
+	if again, err := svc.RefuseShipmentDelivery("ven_tracking_b", shipmentB, "usr_b"); err != nil || again.Status != ShipmentStatusCancelled {
+		t.Fatalf("expected repeated refusal to be a no-op, got %s err=%v", again.Status, err)
+	}
+}
+
+type fixedRateConverter map[string]string
+
+func (c fixedRateConverter) Convert(amountCents int64, fromCurrency, toCurrency string) (int64, string, error) {
+	if fromCurrency == toCurrency {
+		return amountCents, "1", nil
+	}
+	switch c[fromCurrency+"->"+toCurrency] {
+	case "0.5":
+		return amountCents / 2, "0.5", nil
+	case "2":
+		return amountCents * 2, "2", nil
+	default:
+		return 0, "", ErrUnsupportedCurrency
+	}
+}
+
+func TestMultiCurrencyCartSettlesInChosenCurrencyAndSnapshotsRates(t *testing.T) {
+	svc := NewService(500)
+	actor := Actor{GuestToken: "gst_fx"}
+	eurProduct := ProductSnapshot{
+		ID:                    "prd_eur",
+		VendorID:              "ven_eu",
+		Title:                 "Espresso cups",
+		Currency:              "EUR",
+		UnitPriceInclTaxCents: 1000,
+		StockQty:              5,
+	}
+
+	if _, err := svc.UpsertItem(actor, eurProduct, 1); err != ErrCurrencyMismatch {
+		t.Fatalf("expected ErrCurrencyMismatch without converter, got %v", err)
+	}
+	if _, err := svc.SetCartCurrency(actor, "EUR"); err != ErrUnsupportedCurrency {
+		t.Fatalf("expected ErrUnsupportedCurrency without converter, got %v", err)
+	}
+
+	svc.ConfigureCurrency(fixedRateConverter{
+		"EUR->USD": "2",
+		"USD->EUR": "0.5",
+	}, "USD")
+
+	cart, err := svc.UpsertItem(actor, eurProduct, 2)
+	if err != nil {
+		t.Fatalf("UpsertItem() error = %v", err)
+	}
+	line := cart.Items[0]
+	if cart.Currency != "USD" || line.UnitPriceCents != 2000 || line.LineTotalCents != 4000 {
+		t.Fatalf("expected EUR line converted into USD cart, got %+v", cart)
+	}
+	if line.ListCurrency != "EUR" || line.ListUnitPriceCents != 1000 || line.FXRate != "2" {
+		t.Fatalf("expected list price to be kept on converted line, got %+v", line)
+	}
+
+	if _, err := svc.UpsertItem(actor, ProductSnapshot{
+		ID:                    "prd_usd",
+		VendorID:              "ven_us",
+		Title:                 "Mug",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 800,
+		StockQty:              5,
+	}, 1); err != nil {
+		t.Fatalf("UpsertItem() usd error = %v", err)
+	}
+
+	if _, err := svc.SetCartCurrency(actor, "GBP"); err != ErrUnsupportedCurrency {
+		t.Fatalf("expected ErrUnsupportedCurrency for GBP, got %v", err)
+	}
+	cart, err = svc.SetCartCurrency(actor, "eur")
+	if err != nil {
+		t.Fatalf("SetCartCurrency() error = %v", err)
+	}
+	if cart.Currency != "EUR" || cart.SubtotalCents != 2400 {
+		t.Fatalf("expected repriced EUR cart subtotal 2400, got %+v", cart)
+	}
+	if cart.Items[0].ListCurrency != "" || cart.Items[0].UnitPriceCents != 1000 {
+		t.Fatalf("expected EUR line back at list price, got %+v", cart.Items[0])
+	}
+	if cart.Items[1].ListCurrency != "USD" || cart.Items[1].UnitPriceCents != 400 {
+		t.Fatalf("expected USD line converted into EUR, got %+v", cart.Items[1])
+	}
+
+	order, err := svc.PlaceOrder(actor, "idem-fx")
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	if order.Currency != "EUR" || order.ShippingCents != 500 || order.TotalCents != 2900 {
+		t.Fatalf("expected EUR order with converted shipping, got %+v", order)
+	}
+
+	rates := make(map[string]string, len(order.FXRates))
+	for _, snapshot := range order.FXRates {
+		rates[snapshot.FromCurrency+"->"+snapshot.ToCurrency] = snapshot.Rate
+	}
+	if len(rates) != 2 || rates["USD->EUR"] != "0.5" || rates["EUR->USD"] != "2" {
+		t.Fatalf("expected pricing and reporting rate snapshots, got %+v", order.FXRates)
+	}
+	if order.Items[1].ListCurrency != "USD" || order.Items[1].FXRate != "0.5" {
+		t.Fatalf("expected order item to keep list price snapshot, got %+v", order.Items[1])
+	}
+}
+
+func TestListIdleBuyerCartsAndExpireIdleCarts(t *testing.T) {
+	svc := NewService(500)
+	product := ProductSnapshot{
+		ID:                    "prd_idle",
+		VendorID:              "ven_idle",
+		Title:                 "Planner",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 1500,
+		StockQty:              10,
+	}
+
+	buyer := Actor{BuyerUserID: "usr_idle"}
+	guest := Actor{GuestToken: "gst_idle"}
+	freshBuyer := Actor{BuyerUserID: "usr_fresh"}
+	for _, actor := range []Actor{buyer, guest, freshBuyer} {
+		if _, err := svc.UpsertItem(actor, product, 2); err != nil {
+			t.Fatalf("UpsertItem() error = %v", err)
+		}
+	}
+	if _, err := svc.GetCart(Actor{BuyerUserID: "usr_empty"}); err != nil {
+		t.Fatalf("GetCart() error = %v", err)
+	}
+
+	now := time.Now().UTC()
+	svc.cartsByActorKey["usr:usr_idle"].updatedAt = now.Add(-3 * time.Hour)
+	svc.cartsByActorKey["gst:gst_idle"].updatedAt = now.Add(-3 * time.Hour)
+	svc.cartsByActorKey["usr:usr_empty"].updatedAt = now.Add(-3 * time.Hour)
+
+	idle := svc.ListIdleBuyerCarts(now.Add(-time.Hour))
+	if len(idle) != 1 {
+		t.Fatalf("expected only the non-empty idle buyer cart, got %+v", idle)
+	}
+	if idle[0].BuyerUserID != "usr_idle" || idle[0].ItemCount != 2 || idle[0].SubtotalCents != 3000 {
+		t.Fatalf("unexpected idle cart %+v", idle[0])
+	}
+
+	expired := svc.ExpireIdleCarts(now.Add(-2 * time.Hour))
+	if len(expired) != 3 {
+		t.Fatalf("expected idle buyer, guest and empty carts to expire, got %v", expired)
+	}
+	if _, exists := svc.cartsByActorKey["usr:usr_fresh"]; !exists {
+		t.Fatal("expected recently updated cart to be kept")
+	}
+
+	cart, err := svc.GetCart(buyer)
+	if err != nil {
+		t.Fatalf("GetCart() error = %v", err)
+	}
+	if cart.ID == idle[0].CartID || len(cart.Items) != 0 {
+		t.Fatalf("expected expired buyer to get a fresh empty cart, got %+v", cart)
+	}
+}
+
+func TestBackordersAndPreordersHoldShipmentsUntilStockArrives(t *testing.T) {
+	svc := NewService(500)
+	restockDate := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	releaseDate := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	backorderProduct := ProductSnapshot{
+		ID:                    "prd_back",
+		VendorID:              "ven_a",
+		Title:                 "Kettle",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 3000,
+		StockQty:              1,
+		BackorderLimit:        2,
+		ExpectedShipDate:      &restockDate,
+	}
+	first := Actor{BuyerUserID: "usr_first"}
+
+	if _, err := svc.UpsertItem(first, backorderProduct, 4); err != ErrInsufficientStock {
+		t.Fatalf("expected qty beyond stock and backorder limit to fail, got %v", err)
+	}
+	cart, err := svc.UpsertItem(first, backorderProduct, 3)
+	if err != nil {
+		t.Fatalf("UpsertItem() error = %v", err)
+	}
+	if cart.Items[0].Fulfillment != FulfillmentBackorder || cart.Items[0].BackorderedQty != 2 {
+		t.Fatalf("expected two backordered units, got %+v", cart.Items[0])
+	}
+	if cart, err = svc.UpdateItemQty(first, cart.Items[0].ID, 1); err != nil || cart.Items[0].Fulfillment != "" {
+		t.Fatalf("expected in-stock quantity to clear the backorder, got %+v err=%v", cart.Items, err)
+	}
+	if _, err := svc.UpdateItemQty(first, cart.Items[0].ID, 2); err != nil {
+		t.Fatalf("UpdateItemQty() error = %v", err)
+	}
+	if _, err := svc.UpsertItem(first, ProductSnapshot{
+		ID:                    "prd_stock",
+		VendorID:              "ven_b",
+		Title:                 "Mug",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 900,
+		StockQty:              5,
+	}, 1); err != nil {
+		t.Fatalf("UpsertItem() error = %v", err)
+	}
+
+	quote, err := svc.Quote(first)
+	if err != nil {
+		t.Fatalf("Quote() error = %v", err)
+	}
+	if quote.ExpectedShipDate == nil || !quote.ExpectedShipDate.Equal(restockDate) {
+		t.Fatalf("expected quote ship date %s, got %v", restockDate, quote.ExpectedShipDate)
+	}
+	if !quote.Shipments[0].OnHold || quote.Shipments[1].OnHold {
+		t.Fatalf("expected only the backordered vendor shipment to be held, got %+v", quote.Shipments)
+	}
+
+	firstOrder, err := svc.PlaceOrder(first, "idem-backorder-1")
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	if firstOrder.Shipments[0].Status != ShipmentStatusOnHold || firstOrder.Shipments[1].Status != ShipmentStatusPending {
+		t.Fatalf("unexpected shipment statuses %+v", firstOrder.Shipments)
+	}
+	if firstOrder.Items[0].Fulfillment != FulfillmentBackorder || firstOrder.Items[0].BackorderedQty != 1 {
+		t.Fatalf("expected backordered order line, got %+v", firstOrder.Items[0])
+	}
+	if _, err := svc.UpdateVendorShipmentStatus("ven_a", firstOrder.Shipments[0].ID, ShipmentStatusPacked, "usr_vendor"); err != ErrShipmentTransition {
+		t.Fatalf("expected held shipment not to be packed, got %v", err)
+	}
+
+	second := Actor{BuyerUserID: "usr_second"}
+	if _, err := svc.UpsertItem(second, ProductSnapshot{
+		ID:                    "prd_pre",
+		VendorID:              "ven_a",
+		Title:                 "Console",
+		Currency:              "USD",
+		UnitPriceInclTaxCents: 40000,
+		Preorder:              true,
+		ExpectedShipDate:      &releaseDate,
+	}, 2); err != nil {
+		t.Fatalf("UpsertItem() preorder error = %v", err)
+	}
+	secondOrder, err := svc.PlaceOrder(second, "idem-preorder-1")
+	if err != nil {
+		t.Fatalf("PlaceOrder() error = %v", err)
+	}
+	if secondOrder.Items[0].Fulfillment != FulfillmentPreorder || secondOrder.Items[0].BackorderedQty != 2 {
+		t.Fatalf("expected pre-order line to be held in full, got %+v", secondOrder.Items[0])
+	}
+	if secondOrder.ExpectedShipDate == nil || !secondOrder.ExpectedShipDate.Equal(releaseDate) {
+		t.Fatalf("expected order ship date %s, got %v", releaseDate, secondOrder.ExpectedShipDate)
+	}
+
+	if released := svc.AllocateArrivedStock("prd_pre", 1); len(released) != 0 {
+		t.Fatalf("expected partial pre-order stock to keep the shipment held, got %+v", released)
+	}
+	released := svc.AllocateArrivedStock("prd_back", 5)
+	if len(released) != 1 || released[0].ID != firstOrder.Shipments[0].ID || released[0].Status != ShipmentStatusPending {
+		t.Fatalf("expected backordered shipment release, got %+v", released)
+	}
+	if released[0].Items[0].StockAllocatedAt == nil {
+		t.Fatal("expected released line to record stock allocation")
+	}
+	timeline := released[0].Timeline
+	if timeline[len(timeline)-1].Description == "" {
+		t.Fatalf("expected release event on the timeline, got %+v", timeline)
+	}
+	if released := svc.AllocateArrivedStock("prd_pre", 2); len(released) != 1 || released[0].OrderID != secondOrder.ID {
+		t.Fatalf("expected pre-order shipment release, got %+v", released)
+	}
+}
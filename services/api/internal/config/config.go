@@ -14,6 +14,9 @@ type Config struct {
 	CORSAllowOrigins     string
 	JWTSecret            string
 	JWTIssuer            string
+	JWTSigningKeys       string
+	JWTActiveKeyID       string
+	JWTKeyGracePeriod    time.Duration
 	AccessTokenTTL       time.Duration
 	RefreshTokenTTL      time.Duration
 	SuperAdminEmails     string
@@ -30,6 +33,53 @@ type Config struct {
 	GlobalRateLimitBurst int
 	AuthRateLimitRPS     int
 	AuthRateLimitBurst   int
+	CarrierFakeFile      string
+	CarrierWebhookSecret string
+	CarrierPollInterval  time.Duration
+	BaseCurrency         string
+	ReportingCurrency    string
+	FXRates              string
+	CartRecoveryIdle     time.Duration
+	CartRetention        time.Duration
+	CartRecoveryInterval time.Duration
+	CartRecoveryCoupon   int64
+	PaymentSweepInterval time.Duration
+	PaymentReauthWindow  time.Duration
+	PaymentPendingTTL    time.Duration
+	CODRefusalLimit      int
+	PaymentProviders     string
+	PaymentProviderKeys  string
+	WebhookRetryInterval time.Duration
+	WebhookMaxAttempts   int
+	PaymentEventDir      string
+	ReconcileInterval    time.Duration
+	ReconcileWindow      time.Duration
+	InvoiceStorageDir    string
+	InvoiceRetention     time.Duration
+	InvoicePurgeInterval time.Duration
+	InvoiceLocale        string
+	InvoiceLogoFile      string
+	InvoicePrimaryColor  string
+	InvoiceAccentColor   string
+	MailTransport        string
+	MailFrom             string
+	MailDir              string
+	SMTPAddr             string
+	SMTPUsername         string
+	SMTPPassword         string
+	WebBaseURL           string
+	EmailVerificationTTL time.Duration
+	PasswordResetTTL     time.Duration
+	RequireVerifiedEmail bool
+	MFAIssuer            string
+	MFAChallengeTTL      time.Duration
+	MFARequiredRoles     string
+	OIDCProviders        string
+	OIDCClientIDs        string
+	OIDCClientSecrets    string
+	OIDCStateTTL         time.Duration
+	VendorInvitationTTL  time.Duration
+	ImpersonationTTL     time.Duration
 }
 
 func getenvOrDefault(key, fallback string) string {
@@ -90,6 +140,10 @@ func getenvFirstNonEmpty(fallback string, keys ...string) string {
 	return fallback
 }
 
+// DevCarrierWebhookSecret signs fake carrier webhooks in local development.
+// It is public, so production refuses it.
+const DevCarrierWebhookSecret = "carrier_dev_local"
+
 // Load reads config from env vars with safe defaults for local development.
 func Load() Config {
 	environment := getenvOrDefault("API_ENV", "development")
@@ -101,6 +155,9 @@ func Load() Config {
 		CORSAllowOrigins:     getenvOrDefault("API_CORS_ALLOW_ORIGINS", "http://localhost:3000,http://localhost:3001"),
 		JWTSecret:            getenvOrDefault("API_JWT_SECRET", "local-dev-jwt-secret-change-me"),
 		JWTIssuer:            getenvOrDefault("API_JWT_ISSUER", "marketplace-api"),
+		JWTSigningKeys:       getenvOrDefault("API_JWT_SIGNING_KEYS", ""),
+		JWTActiveKeyID:       getenvOrDefault("API_JWT_ACTIVE_KEY_ID", ""),
+		JWTKeyGracePeriod:    getenvDurationSeconds("API_JWT_KEY_GRACE_PERIOD_SECONDS", 1209600),
 		AccessTokenTTL:       getenvDurationSeconds("API_ACCESS_TOKEN_TTL_SECONDS", 900),
 		RefreshTokenTTL:      getenvDurationSeconds("API_REFRESH_TOKEN_TTL_SECONDS", 1209600),
 		SuperAdminEmails:     getenvOrDefault("API_SUPER_ADMIN_EMAILS", ""),
@@ -117,5 +174,52 @@ func Load() Config {
 		GlobalRateLimitBurst: getenvIntOrDefault("API_RATE_LIMIT_BURST", 90),
 		AuthRateLimitRPS:     getenvIntOrDefault("API_AUTH_RATE_LIMIT_RPS", 5),
 		AuthRateLimitBurst:   getenvIntOrDefault("API_AUTH_RATE_LIMIT_BURST", 10),
+		CarrierFakeFile:      getenvOrDefault("API_CARRIER_FAKE_FILE", ""),
+		CarrierWebhookSecret: getenvOrDefault("API_CARRIER_WEBHOOK_SECRET", DevCarrierWebhookSecret),
+		CarrierPollInterval:  getenvDurationSeconds("API_CARRIER_POLL_INTERVAL_SECONDS", 300),
+		BaseCurrency:         getenvOrDefault("API_BASE_CURRENCY", "USD"),
+		ReportingCurrency:    getenvOrDefault("API_REPORTING_CURRENCY", "USD"),
+		FXRates:              getenvOrDefault("API_FX_RATES", ""),
+		CartRecoveryIdle:     getenvDurationSeconds("API_CART_RECOVERY_IDLE_SECONDS", 86400),
+		CartRetention:        getenvDurationSeconds("API_CART_RETENTION_SECONDS", 2592000),
+		CartRecoveryInterval: getenvDurationSeconds("API_CART_RECOVERY_INTERVAL_SECONDS", 900),
+		CartRecoveryCoupon:   getenvInt64OrDefault("API_CART_RECOVERY_COUPON_PERCENT", 0),
+		PaymentSweepInterval: getenvDurationSeconds("API_PAYMENT_AUTH_SWEEP_INTERVAL_SECONDS", 3600),
+		PaymentReauthWindow:  getenvDurationSeconds("API_PAYMENT_REAUTHORIZE_WINDOW_SECONDS", 86400),
+		PaymentPendingTTL:    getenvDurationSeconds("API_PAYMENT_PENDING_TTL_SECONDS", 86400),
+		CODRefusalLimit:      getenvIntOrDefault("API_COD_REFUSAL_LIMIT", 2),
+		PaymentProviders:     getenvOrDefault("API_PAYMENT_PROVIDERS", ""),
+		PaymentProviderKeys:  getenvOrDefault("API_PAYMENT_PROVIDER_WEBHOOK_SECRETS", ""),
+		WebhookRetryInterval: getenvDurationSeconds("API_PAYMENT_WEBHOOK_RETRY_INTERVAL_SECONDS", 60),
+		WebhookMaxAttempts:   getenvIntOrDefault("API_PAYMENT_WEBHOOK_MAX_ATTEMPTS", 8),
+		PaymentEventDir:      getenvOrDefault("API_PAYMENT_EVENT_STORAGE_DIR", ""),
+		ReconcileInterval:    getenvDurationSeconds("API_PAYMENT_RECONCILIATION_INTERVAL_SECONDS", 86400),
+		ReconcileWindow:      getenvDurationSeconds("API_PAYMENT_RECONCILIATION_WINDOW_SECONDS", 259200),
+		InvoiceStorageDir:    getenvOrDefault("API_INVOICE_STORAGE_DIR", ""),
+		InvoiceRetention:     time.Duration(getenvIntOrDefault("API_INVOICE_RETENTION_DAYS", 3650)) * 24 * time.Hour,
+		InvoicePurgeInterval: getenvDurationSeconds("API_INVOICE_PURGE_INTERVAL_SECONDS", 86400),
+		InvoiceLocale:        getenvOrDefault("API_INVOICE_LOCALE", "en"),
+		InvoiceLogoFile:      getenvOrDefault("API_INVOICE_LOGO_FILE", ""),
+		InvoicePrimaryColor:  getenvOrDefault("API_INVOICE_PRIMARY_COLOR", "#1F2937"),
+		InvoiceAccentColor:   getenvOrDefault("API_INVOICE_ACCENT_COLOR", "#2563EB"),
+		MailTransport:        getenvOrDefault("API_MAIL_TRANSPORT", "log"),
+		MailFrom:             getenvOrDefault("API_MAIL_FROM", "Marketplace <no-reply@marketplace.local>"),
+		MailDir:              getenvOrDefault("API_MAIL_DIR", "tmp/mail"),
+		SMTPAddr:             getenvOrDefault("API_SMTP_ADDR", ""),
+		SMTPUsername:         getenvOrDefault("API_SMTP_USERNAME", ""),
+		SMTPPassword:         getenvOrDefault("API_SMTP_PASSWORD", ""),
+		WebBaseURL:           getenvOrDefault("API_WEB_BASE_URL", "http://localhost:3000"),
+		EmailVerificationTTL: getenvDurationSeconds("API_EMAIL_VERIFICATION_TTL_SECONDS", 86400),
+		PasswordResetTTL:     getenvDurationSeconds("API_PASSWORD_RESET_TTL_SECONDS", 3600),
+		RequireVerifiedEmail: getenvBoolOrDefault("API_REQUIRE_VERIFIED_EMAIL", false),
+		MFAIssuer:            getenvOrDefault("API_MFA_ISSUER", "Marketplace"),
+		MFAChallengeTTL:      getenvDurationSeconds("API_MFA_CHALLENGE_TTL_SECONDS", 300),
+		MFARequiredRoles:     getenvOrDefault("API_MFA_REQUIRED_ROLES", ""),
+		OIDCProviders:        getenvOrDefault("API_OIDC_PROVIDERS", ""),
+		OIDCClientIDs:        getenvOrDefault("API_OIDC_CLIENT_IDS", ""),
+		OIDCClientSecrets:    getenvOrDefault("API_OIDC_CLIENT_SECRETS", ""),
+		OIDCStateTTL:         getenvDurationSeconds("API_OIDC_STATE_TTL_SECONDS", 600),
+		VendorInvitationTTL:  getenvDurationSeconds("API_VENDOR_INVITATION_TTL_SECONDS", 604800),
+		ImpersonationTTL:     getenvDurationSeconds("API_IMPERSONATION_TTL_SECONDS", 900),
 	}
 }
@@ -24,6 +24,10 @@ var (
 	ErrInvalidCouponInput      = errors.New("invalid coupon input")
 )
 
+// PlatformScopeID scopes coupons issued by the platform itself, such as cart
+// recovery incentives, rather than by a vendor.
+const PlatformScopeID = "platform"
+
 var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
 
 type Coupon struct {
@@ -141,6 +145,44 @@ func (s *Service) Create(vendorID string, input CreateCouponInput) (Coupon, erro
 	return coupon, nil
 }
 
+// IssueSingleUse creates an active coupon with a generated code that can be
+// redeemed once before validFor elapses.
+func (s *Service) IssueSingleUse(scopeID, codePrefix string, discountType DiscountType, discountValue int64, validFor time.Duration) (Coupon, error) {
+	if validFor <= 0 {
+		return Coupon{}, ErrInvalidCouponInput
+	}
+
+	prefix := strings.ToUpper(strings.TrimSpace(codePrefix))
+	if len(prefix) > 20 {
+		return Coupon{}, ErrInvalidCouponInput
+	}
+	startsAt := s.now()
+	endsAt := startsAt.Add(validFor)
+	usageLimit := int32(1)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		suffix := strings.ToUpper(strings.TrimPrefix(identifier.New("c"), "c_"))[:10]
+		code := suffix
+		if prefix != "" {
+			code = prefix + "-" + suffix
+		}
+
+		coupon, err := s.Create(scopeID, CreateCouponInput{
+			Code:          code,
+			DiscountType:  discountType,
+			DiscountValue: discountValue,
+			StartsAt:      &startsAt,
+			EndsAt:        &endsAt,
+			UsageLimit:    &usageLimit,
+		})
+		if errors.Is(err, ErrCouponCodeInUse) {
+			continue
+		}
+		return coupon, err
+	}
+	return Coupon{}, ErrCouponCodeInUse
+}
+
 func (s *Service) Update(vendorID, couponID string, input UpdateCouponInput) (Coupon, error) {
 	if strings.TrimSpace(vendorID) == "" || strings.TrimSpace(couponID) == "" {
 		return Coupon{}, ErrInvalidCouponInput
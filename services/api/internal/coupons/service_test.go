@@ -1,6 +1,10 @@
 package coupons
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestCouponCRUDByVendorScope(t *testing.T) {
 	service := NewService()
@@ -87,3 +91,36 @@ func int64Ptr(value int64) *int64 {
 func discountTypePtr(value DiscountType) *DiscountType {
 	return &value
 }
+
+func TestIssueSingleUseGeneratesUniqueLimitedCoupons(t *testing.T) {
+	service := NewService()
+
+	first, err := service.IssueSingleUse(PlatformScopeID, "comeback", DiscountTypePercent, 10, 72*time.Hour)
+	if err != nil {
+		t.Fatalf("IssueSingleUse() error = %v", err)
+	}
+	second, err := service.IssueSingleUse(PlatformScopeID, "comeback", DiscountTypePercent, 10, 72*time.Hour)
+	if err != nil {
+		t.Fatalf("IssueSingleUse() second error = %v", err)
+	}
+
+	if !strings.HasPrefix(first.Code, "COMEBACK-") || first.Code == second.Code {
+		t.Fatalf("expected distinct prefixed codes, got %s and %s", first.Code, second.Code)
+	}
+	if first.UsageLimit == nil || *first.UsageLimit != 1 || !first.Active {
+		t.Fatalf("expected active single-use coupon, got %+v", first)
+	}
+	if first.EndsAt == nil || first.EndsAt.Sub(*first.StartsAt) != 72*time.Hour {
+		t.Fatalf("expected 72h validity window, got %+v", first)
+	}
+	if len(service.ListByVendor(PlatformScopeID)) != 2 {
+		t.Fatalf("expected coupons to be listed under the platform scope")
+	}
+
+	if _, err := service.IssueSingleUse(PlatformScopeID, "comeback", DiscountTypePercent, 10, 0); err != ErrInvalidCouponInput {
+		t.Fatalf("expected ErrInvalidCouponInput for empty validity, got %v", err)
+	}
+	if _, err := service.IssueSingleUse(PlatformScopeID, "comeback", DiscountTypePercent, 150, time.Hour); err != ErrInvalidCouponInput {
+		t.Fatalf("expected ErrInvalidCouponInput for invalid discount, got %v", err)
+	}
+}
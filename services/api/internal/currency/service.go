@@ -0,0 +1,287 @@
+package currency
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateDecimals is the precision used for effective cross rates. Conversions are
+// computed from the rounded cross rate so a snapshot reproduces the amount.
+const rateDecimals = 10
+
+var (
+	ErrInvalidCurrency  = errors.New("currency code is invalid")
+	ErrRateNotFound     = errors.New("fx rate not found")
+	ErrInvalidRate      = errors.New("fx rate must be a positive decimal")
+	ErrBaseCurrencyRate = errors.New("base currency rate is fixed at 1")
+)
+
+// zeroDecimalCurrencies and threeDecimalCurrencies follow ISO 4217 minor units.
+var (
+	zeroDecimalCurrencies = map[string]bool{
+		"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true,
+		"KMF": true, "KRW": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+		"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+	}
+	threeDecimalCurrencies = map[string]bool{
+		"BHD": true, "IQD": true, "JOD": true, "KWD": true, "LYD": true, "OMR": true, "TND": true,
+	}
+)
+
+// Rate is an admin-managed FX rate: one unit of the base currency buys Rate
+// units of Currency.
+type Rate struct {
+	Currency  string    `json:"currency"`
+	Rate      string    `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// Service keeps the FX rate table in-memory, quoted against a base currency.
+type Service struct {
+	mu           sync.RWMutex
+	baseCurrency string
+	rates        map[string]Rate
+	parsed       map[string]*big.Rat
+	now          func() time.Time
+}
+
+func NewService(baseCurrency string) *Service {
+	base, err := NormalizeCode(baseCurrency)
+	if err != nil {
+		base = "USD"
+	}
+	nowFn := func() time.Time { return time.Now().UTC() }
+
+	return &Service{
+		baseCurrency: base,
+		rates: map[string]Rate{
+			base: {Currency: base, Rate: "1", UpdatedAt: nowFn()},
+		},
+		parsed: map[string]*big.Rat{
+			base: big.NewRat(1, 1),
+		},
+		now: nowFn,
+	}
+}
+
+// NormalizeCode validates and upper-cases an ISO 4217 style code.
+func NormalizeCode(code string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(code))
+	if len(normalized) != 3 {
+		return "", ErrInvalidCurrency
+	}
+	for _, r := range normalized {
+		if r < 'A' || r > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+	return normalized, nil
+}
+
+// MinorUnits returns the number of decimal places used by a currency's minor unit.
+func MinorUnits(code string) int {
+	normalized := strings.ToUpper(strings.TrimSpace(code))
+	switch {
+	case zeroDecimalCurrencies[normalized]:
+		return 0
+	case threeDecimalCurrencies[normalized]:
+		return 3
+	default:
+		return 2
+	}
+}
+
+func (s *Service) BaseCurrency() string {
+	return s.baseCurrency
+}
+
+// ListRates returns the rate table, base currency first.
+func (s *Service) ListRates() []Rate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]Rate, 0, len(s.rates))
+	for _, rate := range s.rates {
+		items = append(items, rate)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Currency == s.baseCurrency || items[j].Currency == s.baseCurrency {
+			return items[i].Currency == s.baseCurrency
+		}
+		return items[i].Currency < items[j].Currency
+	})
+	return items
+}
+
+// SupportedCurrencies returns every currency that has a rate, base included.
+func (s *Service) SupportedCurrencies() []string {
+	rates := s.ListRates()
+	codes := make([]string, 0, len(rates))
+	for _, rate := range rates {
+		codes = append(codes, rate.Currency)
+	}
+	return codes
+}
+
+func (s *Service) IsSupported(code string) bool {
+	normalized, err := NormalizeCode(code)
+	if err != nil {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.parsed[normalized]
+	return exists
+}
+
+// SetRate creates or replaces the rate for a non-base currency.
+func (s *Service) SetRate(code, rate, actorUserID string) (Rate, error) {
+	normalized, err := NormalizeCode(code)
+	if err != nil {
+		return Rate{}, err
+	}
+	if normalized == s.baseCurrency {
+		return Rate{}, ErrBaseCurrencyRate
+	}
+	parsed, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || parsed.Sign() <= 0 {
+		return Rate{}, ErrInvalidRate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := Rate{
+		Currency:  normalized,
+		Rate:      formatRate(parsed),
+		UpdatedAt: s.now(),
+		UpdatedBy: strings.TrimSpace(actorUserID),
+	}
+	s.rates[normalized] = stored
+	s.parsed[normalized] = parsed
+	return stored, nil
+}
+
+// DeleteRate removes a non-base currency from the table.
+func (s *Service) DeleteRate(code string) error {
+	normalized, err := NormalizeCode(code)
+	if err != nil {
+		return err
+	}
+	if normalized == s.baseCurrency {
+		return ErrBaseCurrencyRate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rates[normalized]; !exists {
+		return ErrRateNotFound
+	}
+	delete(s.rates, normalized)
+	delete(s.parsed, normalized)
+	return nil
+}
+
+// CrossRate returns the effective rate for converting one unit of from into to,
+// rounded to the precision stored on snapshots.
+func (s *Service) CrossRate(from, to string) (string, error) {
+	rate, err := s.crossRate(from, to)
+	if err != nil {
+		return "", err
+	}
+	return formatRate(rate), nil
+}
+
+// Convert converts a minor-unit amount and returns the converted amount along
+// with the effective cross rate used.
+func (s *Service) Convert(amountCents int64, from, to string) (int64, string, error) {
+	rate, err := s.crossRate(from, to)
+	if err != nil {
+		return 0, "", err
+	}
+	return convertWithRate(amountCents, rate, MinorUnits(from), MinorUnits(to)), formatRate(rate), nil
+}
+
+// ConvertWithRate applies a previously snapshotted cross rate.
+func ConvertWithRate(amountCents int64, rate, from, to string) (int64, error) {
+	parsed, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || parsed.Sign() <= 0 {
+		return 0, ErrInvalidRate
+	}
+	return convertWithRate(amountCents, parsed, MinorUnits(from), MinorUnits(to)), nil
+}
+
+func (s *Service) crossRate(from, to string) (*big.Rat, error) {
+	normalizedFrom, err := NormalizeCode(from)
+	if err != nil {
+		return nil, err
+	}
+	normalizedTo, err := NormalizeCode(to)
+	if err != nil {
+		return nil, err
+	}
+	if normalizedFrom == normalizedTo {
+		return big.NewRat(1, 1), nil
+	}
+
+	s.mu.RLock()
+	fromRate, fromExists := s.parsed[normalizedFrom]
+	toRate, toExists := s.parsed[normalizedTo]
+	s.mu.RUnlock()
+	if !fromExists || !toExists {
+		return nil, ErrRateNotFound
+	}
+
+	cross := new(big.Rat).Quo(toRate, fromRate)
+	rounded, _ := new(big.Rat).SetString(cross.FloatString(rateDecimals))
+	return rounded, nil
+}
+
+func convertWithRate(amountCents int64, rate *big.Rat, fromMinorUnits, toMinorUnits int) int64 {
+	amount := new(big.Rat).SetInt64(amountCents)
+	amount.Mul(amount, rate)
+	scale := toMinorUnits - fromMinorUnits
+	factor := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(absInt(scale))), nil))
+	if scale >= 0 {
+		amount.Mul(amount, factor)
+	} else {
+		amount.Quo(amount, factor)
+	}
+	return roundHalfAwayFromZero(amount)
+}
+
+func roundHalfAwayFromZero(value *big.Rat) int64 {
+	num := new(big.Int).Set(value.Num())
+	den := value.Denom()
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(remainder, big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if negative {
+		quotient.Neg(quotient)
+	}
+	return quotient.Int64()
+}
+
+func formatRate(rate *big.Rat) string {
+	formatted := rate.FloatString(rateDecimals)
+	formatted = strings.TrimRight(formatted, "0")
+	return strings.TrimSuffix(formatted, ".")
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,92 @@
+package currency
+
+import "testing"
+
+func TestSetRateValidatesAndListsBaseFirst(t *testing.T) {
+	svc := NewService("usd")
+
+	if _, err := svc.SetRate("USD", "2", "usr_finance"); err != ErrBaseCurrencyRate {
+		t.Fatalf("expected ErrBaseCurrencyRate, got %v", err)
+	}
+	if _, err := svc.SetRate("EURO", "0.9", "usr_finance"); err != ErrInvalidCurrency {
+		t.Fatalf("expected ErrInvalidCurrency, got %v", err)
+	}
+	if _, err := svc.SetRate("EUR", "-1", "usr_finance"); err != ErrInvalidRate {
+		t.Fatalf("expected ErrInvalidRate, got %v", err)
+	}
+
+	stored, err := svc.SetRate("eur", "0.9200", "usr_finance")
+	if err != nil {
+		t.Fatalf("SetRate() error = %v", err)
+	}
+	if stored.Currency != "EUR" || stored.Rate != "0.92" || stored.UpdatedBy != "usr_finance" {
+		t.Fatalf("unexpected stored rate %+v", stored)
+	}
+	if _, err := svc.SetRate("AUD", "1.5", "usr_finance"); err != nil {
+		t.Fatalf("SetRate(AUD) error = %v", err)
+	}
+
+	rates := svc.ListRates()
+	if len(rates) != 3 || rates[0].Currency != "USD" || rates[1].Currency != "AUD" || rates[2].Currency != "EUR" {
+		t.Fatalf("unexpected rate ordering %+v", rates)
+	}
+
+	if err := svc.DeleteRate("AUD"); err != nil {
+		t.Fatalf("DeleteRate() error = %v", err)
+	}
+	if err := svc.DeleteRate("AUD"); err != ErrRateNotFound {
+		t.Fatalf("expected ErrRateNotFound, got %v", err)
+	}
+	if svc.IsSupported("AUD") {
+		t.Fatal("expected AUD to be unsupported after delete")
+	}
+}
+
+func TestConvertUsesCrossRatesAndMinorUnits(t *testing.T) {
+	svc := NewService("USD")
+	if _, err := svc.SetRate("EUR", "0.8", ""); err != nil {
+		t.Fatalf("SetRate(EUR) error = %v", err)
+	}
+	if _, err := svc.SetRate("JPY", "150", ""); err != nil {
+		t.Fatalf("SetRate(JPY) error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		amount     int64
+		from, to   string
+		wantAmount int64
+		wantRate   string
+	}{
+		{name: "same currency", amount: 1234, from: "USD", to: "usd", wantAmount: 1234, wantRate: "1"},
+		{name: "base to quote", amount: 1000, from: "USD", to: "EUR", wantAmount: 800, wantRate: "0.8"},
+		{name: "quote to base", amount: 800, from: "EUR", to: "USD", wantAmount: 1000, wantRate: "1.25"},
+		{name: "cross rate", amount: 1000, from: "EUR", to: "JPY", wantAmount: 1875, wantRate: "187.5"},
+		{name: "zero decimal source", amount: 150, from: "JPY", to: "USD", wantAmount: 100, wantRate: "0.0066666667"},
+		{name: "rounds half away from zero", amount: 1, from: "USD", to: "EUR", wantAmount: 1, wantRate: "0.8"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			amount, rate, err := svc.Convert(tc.amount, tc.from, tc.to)
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if amount != tc.wantAmount || rate != tc.wantRate {
+				t.Fatalf("Convert(%d %s->%s) = %d @ %s, want %d @ %s", tc.amount, tc.from, tc.to, amount, rate, tc.wantAmount, tc.wantRate)
+			}
+
+			replayed, err := ConvertWithRate(tc.amount, rate, tc.from, tc.to)
+			if err != nil {
+				t.Fatalf("ConvertWithRate() error = %v", err)
+			}
+			if replayed != amount {
+				t.Fatalf("expected snapshot replay %d, got %d", amount, replayed)
+			}
+		})
+	}
+
+	if _, _, err := svc.Convert(100, "USD", "GBP"); err != ErrRateNotFound {
+		t.Fatalf("expected ErrRateNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,498 @@
+package disputes
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/notifications"
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+// Statuses mirror Stripe's dispute statuses.
+const (
+	StatusWarningNeedsResponse = "warning_needs_response"
+	StatusWarningUnderReview   = "warning_under_review"
+	StatusWarningClosed        = "warning_closed"
+	StatusNeedsResponse        = "needs_response"
+	StatusUnderReview          = "under_review"
+	StatusWon                  = "won"
+	StatusLost                 = "lost"
+
+	EvidenceKindTracking      = "tracking"
+	EvidenceKindDelivery      = "delivery_confirmation"
+	EvidenceKindCommunication = "customer_communication"
+	EvidenceKindPolicy        = "refund_policy"
+	EvidenceKindOther         = "other"
+
+	NotificationKindOpened = "dispute_opened"
+	NotificationKindClosed = "dispute_closed"
+
+	maxEvidenceTextLength = 5000
+)
+
+var (
+	ErrInvalidDispute       = errors.New("dispute reference is required")
+	ErrInvalidOrder         = errors.New("order is required")
+	ErrInvalidVendor        = errors.New("vendor is required")
+	ErrInvalidStatus        = errors.New("dispute status is invalid")
+	ErrInvalidStatusFilter  = errors.New("status filter is invalid")
+	ErrInvalidEvidenceKind  = errors.New("evidence kind is invalid")
+	ErrInvalidEvidenceText  = errors.New("evidence text is invalid")
+	ErrDisputeNotFound      = errors.New("dispute not found")
+	ErrDisputeForbidden     = errors.New("dispute forbidden")
+	ErrDisputeClosed        = errors.New("dispute is closed")
+	ErrDisputeOrderMismatch = errors.New("dispute belongs to another order")
+)
+
+// ShipmentShare is the part of a disputed amount charged against one vendor
+// shipment.
+type ShipmentShare struct {
+	ShipmentID  string `json:"shipment_id"`
+	VendorID    string `json:"vendor_id"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// Evidence is one item a vendor submitted to contest a dispute.
+type Evidence struct {
+	ID                string    `json:"id"`
+	VendorID          string    `json:"vendor_id"`
+	Kind              string    `json:"kind"`
+	Text              string    `json:"text"`
+	SubmittedByUserID string    `json:"submitted_by_user_id"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// Dispute is a chargeback raised against an order payment, split across the
+// vendor shipments it covers.
+type Dispute struct {
+	ID            string          `json:"id"`
+	OrderID       string          `json:"order_id"`
+	PaymentID     string          `json:"payment_id"`
+	ProviderRef   string          `json:"provider_ref"`
+	Reason        string          `json:"reason"`
+	Status        string          `json:"status"`
+	AmountCents   int64           `json:"amount_cents"`
+	Currency      string          `json:"currency"`
+	EvidenceDueBy *time.Time      `json:"evidence_due_by,omitempty"`
+	Shipments     []ShipmentShare `json:"shipments"`
+	Evidence      []Evidence      `json:"evidence"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	ClosedAt      *time.Time      `json:"closed_at,omitempty"`
+}
+
+// Update is the provider's latest view of a dispute. Shipments is only used
+// when the dispute is first recorded.
+type Update struct {
+	ProviderRef   string
+	OrderID       string
+	PaymentID     string
+	Reason        string
+	Status        string
+	AmountCents   int64
+	Currency      string
+	EvidenceDueBy *time.Time
+	Shipments     []ShipmentShare
+}
+
+// RecordResult reports what an update changed, so callers notify vendors and
+// settle payout holds once.
+type RecordResult struct {
+	Dispute Dispute
+	Created bool
+	Closed  bool
+}
+
+// Summary counts disputes for the admin dashboard.
+type Summary struct {
+	Total int `json:"total"`
+	Open  int `json:"open"`
+	Won   int `json:"won"`
+	Lost  int `json:"lost"`
+}
+
+// Service stores disputes in-memory for API workflow validation.
+type Service struct {
+	mu                   sync.Mutex
+	disputesByID         map[string]Dispute
+	disputeIDByRef       map[string]string
+	disputeIDsByVendorID map[string][]string
+}
+
+func NewService() *Service {
+	return &Service{
+		disputesByID:         make(map[string]Dispute),
+		disputeIDByRef:       make(map[string]string),
+		disputeIDsByVendorID: make(map[string][]string),
+	}
+}
+
+// Record creates or updates the dispute for update.ProviderRef. Updates to a
+// closed dispute are kept but never reopen it.
+func (s *Service) Record(update Update) (RecordResult, error) {
+	providerRef := strings.TrimSpace(update.ProviderRef)
+	if providerRef == "" {
+		return RecordResult{}, ErrInvalidDispute
+	}
+	orderID := strings.TrimSpace(update.OrderID)
+	if orderID == "" {
+		return RecordResult{}, ErrInvalidOrder
+	}
+	status := normalizeStatus(update.Status)
+	if !isValidStatus(status) {
+		return RecordResult{}, ErrInvalidStatus
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	result := RecordResult{}
+	dispute, exists := s.disputesByID[s.disputeIDByRef[providerRef]]
+	if exists && dispute.OrderID != orderID {
+		return RecordResult{}, ErrDisputeOrderMismatch
+	}
+	if !exists {
+		dispute = Dispute{
+			ID:          identifier.New("dsp"),
+			OrderID:     orderID,
+			PaymentID:   strings.TrimSpace(update.PaymentID),
+			ProviderRef: providerRef,
+			Shipments:   append([]ShipmentShare{}, update.Shipments...),
+			Evidence:    []Evidence{},
+			CreatedAt:   now,
+		}
+		result.Created = true
+		s.disputeIDByRef[providerRef] = dispute.ID
+		for _, vendorID := range shareVendorIDs(dispute.Shipments) {
+			s.disputeIDsByVendorID[vendorID] = append(s.disputeIDsByVendorID[vendorID], dispute.ID)
+		}
+	}
+
+	if dispute.ClosedAt == nil {
+		dispute.Status = status
+		if IsClosedStatus(status) {
+			dispute.ClosedAt = &now
+			result.Closed = true
+		}
+	}
+	if reason := strings.TrimSpace(update.Reason); reason != "" {
+		dispute.Reason = reason
+	}
+	if update.AmountCents > 0 {
+		dispute.AmountCents = update.AmountCents
+	}
+	if currency := strings.ToUpper(strings.TrimSpace(update.Currency)); currency != "" {
+		dispute.Currency = currency
+	}
+	if update.EvidenceDueBy != nil {
+		dueBy := update.EvidenceDueBy.UTC()
+		dispute.EvidenceDueBy = &dueBy
+	}
+	dispute.UpdatedAt = now
+	s.disputesByID[dispute.ID] = dispute
+
+	result.Dispute = dispute
+	return result, nil
+}
+
+// List returns all disputes, optionally filtered by status, newest first.
+func (s *Service) List(statusFilter string) ([]Dispute, error) {
+	normalizedStatusFilter := normalizeStatus(statusFilter)
+	if normalizedStatusFilter != "" && !isValidStatus(normalizedStatusFilter) {
+		return nil, ErrInvalidStatusFilter
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Dispute, 0, len(s.disputesByID))
+	for _, dispute := range s.disputesByID {
+		if normalizedStatusFilter != "" && dispute.Status != normalizedStatusFilter {
+			continue
+		}
+		result = append(result, dispute)
+	}
+	sortDisputes(result)
+
+	return result, nil
+}
+
+// ListVendorDisputes returns disputes touching a vendor's shipments, scoped to
+// that vendor's shares and evidence.
+func (s *Service) ListVendorDisputes(vendorID, statusFilter string) ([]Dispute, error) {
+	normalizedVendorID := strings.TrimSpace(vendorID)
+	if normalizedVendorID == "" {
+		return nil, ErrInvalidVendor
+	}
+	normalizedStatusFilter := normalizeStatus(statusFilter)
+	if normalizedStatusFilter != "" && !isValidStatus(normalizedStatusFilter) {
+		return nil, ErrInvalidStatusFilter
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.disputeIDsByVendorID[normalizedVendorID]
+	result := make([]Dispute, 0, len(ids))
+	for _, id := range ids {
+		dispute, exists := s.disputesByID[id]
+		if !exists {
+			continue
+		}
+		if normalizedStatusFilter != "" && dispute.Status != normalizedStatusFilter {
+			continue
+		}
+		result = append(result, scopeToVendor(dispute, normalizedVendorID))
+	}
+	sortDisputes(result)
+
+	return result, nil
+}
+
+// GetVendorDispute returns one dispute scoped to the vendor.
+func (s *Service) GetVendorDispute(vendorID, disputeID string) (Dispute, error) {
+	normalizedVendorID := strings.TrimSpace(vendorID)
+	if normalizedVendorID == "" {
+		return Dispute{}, ErrInvalidVendor
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dispute, exists := s.disputesByID[strings.TrimSpace(disputeID)]
+	if !exists {
+		return Dispute{}, ErrDisputeNotFound
+	}
+	if !hasVendorShare(dispute, normalizedVendorID) {
+		return Dispute{}, ErrDisputeForbidden
+	}
+
+	return scopeToVendor(dispute, normalizedVendorID), nil
+}
+
+// AddEvidence attaches vendor evidence to an open dispute. It returns the
+// full dispute so the caller can forward every vendor's evidence together.
+func (s *Service) AddEvidence(vendorID, disputeID, kind, text, actorUserID string) (Dispute, error) {
+	normalizedVendorID := strings.TrimSpace(vendorID)
+	if normalizedVendorID == "" {
+		return Dispute{}, ErrInvalidVendor
+	}
+	normalizedKind := strings.ToLower(strings.TrimSpace(kind))
+	if !isValidEvidenceKind(normalizedKind) {
+		return Dispute{}, ErrInvalidEvidenceKind
+	}
+	normalizedText := strings.TrimSpace(text)
+	if normalizedText == "" || len(normalizedText) > maxEvidenceTextLength {
+		return Dispute{}, ErrInvalidEvidenceText
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dispute, exists := s.disputesByID[strings.TrimSpace(disputeID)]
+	if !exists {
+		return Dispute{}, ErrDisputeNotFound
+	}
+	if !hasVendorShare(dispute, normalizedVendorID) {
+		return Dispute{}, ErrDisputeForbidden
+	}
+	if dispute.ClosedAt != nil {
+		return Dispute{}, ErrDisputeClosed
+	}
+
+	now := time.Now().UTC()
+	dispute.Evidence = append(append([]Evidence{}, dispute.Evidence...), Evidence{
+		ID:                identifier.New("dev"),
+		VendorID:          normalizedVendorID,
+		Kind:              normalizedKind,
+		Text:              normalizedText,
+		SubmittedByUserID: strings.TrimSpace(actorUserID),
+		CreatedAt:         now,
+	})
+	dispute.UpdatedAt = now
+	s.disputesByID[dispute.ID] = dispute
+
+	return dispute, nil
+}
+
+// Summary counts disputes by outcome. Warning-only inquiries that closed
+// count as neither won nor lost.
+func (s *Service) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := Summary{Total: len(s.disputesByID)}
+	for _, dispute := range s.disputesByID {
+		switch {
+		case dispute.Status == StatusWon:
+			summary.Won++
+		case dispute.Status == StatusLost:
+			summary.Lost++
+		case !IsClosedStatus(dispute.Status):
+			summary.Open++
+		}
+	}
+	return summary
+}
+
+// EvidenceText joins a dispute's evidence into the single text block staged
+// with the provider.
+func (d Dispute) EvidenceText() string {
+	parts := make([]string, 0, len(d.Evidence))
+	for _, evidence := range d.Evidence {
+		parts = append(parts, "["+evidence.Kind+"] "+evidence.Text)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// AllocateShares splits a disputed amount across the order's live shipments
+// in proportion to their totals. Rounding is settled on the last shipment.
+func AllocateShares(order commerce.Order, amountCents int64) []ShipmentShare {
+	shipments := make([]commerce.OrderShipment, 0, len(order.Shipments))
+	totalCents := int64(0)
+	for _, shipment := range order.Shipments {
+		if shipment.Status == commerce.ShipmentStatusCancelled || shipment.TotalCents <= 0 {
+			continue
+		}
+		shipments = append(shipments, shipment)
+		totalCents += shipment.TotalCents
+	}
+	if amountCents > totalCents {
+		amountCents = totalCents
+	}
+
+	shares := make([]ShipmentShare, 0, len(shipments))
+	allocated := int64(0)
+	for index, shipment := range shipments {
+		share := amountCents * shipment.TotalCents / totalCents
+		if index == len(shipments)-1 {
+			share = amountCents - allocated
+		}
+		allocated += share
+		shares = append(shares, ShipmentShare{
+			ShipmentID:  shipment.ID,
+			VendorID:    shipment.VendorID,
+			AmountCents: share,
+		})
+	}
+	return shares
+}
+
+// VendorMessage tells a vendor owner that a dispute touching its shipment
+// opened or closed.
+func VendorMessage(kind string, dispute Dispute, share ShipmentShare, ownerUserID string, now time.Time) notifications.Message {
+	message := notifications.Message{
+		Kind:            kind,
+		RecipientUserID: ownerUserID,
+		Data: map[string]string{
+			"dispute_id":   dispute.ID,
+			"order_id":     dispute.OrderID,
+			"shipment_id":  share.ShipmentID,
+			"amount_cents": strconv.FormatInt(share.AmountCents, 10),
+			"currency":     dispute.Currency,
+			"status":       dispute.Status,
+		},
+		CreatedAt: now,
+	}
+	switch kind {
+	case NotificationKindOpened:
+		message.Subject = fmt.Sprintf("Chargeback opened on order %s", dispute.OrderID)
+		message.Body = "The buyer's bank disputed this payment. Your share is held from payouts until the dispute closes; submit evidence before the deadline."
+		if dispute.EvidenceDueBy != nil {
+			message.Data["evidence_due_by"] = dispute.EvidenceDueBy.Format(time.RFC3339)
+		}
+	case NotificationKindClosed:
+		message.Subject = fmt.Sprintf("Chargeback on order %s closed", dispute.OrderID)
+		message.Body = fmt.Sprintf("The dispute closed with status %s. Held payouts were settled accordingly.", dispute.Status)
+	}
+	return message
+}
+
+// IsClosedStatus reports whether Stripe has finished with a dispute.
+func IsClosedStatus(status string) bool {
+	switch normalizeStatus(status) {
+	case StatusWon, StatusLost, StatusWarningClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+func scopeToVendor(dispute Dispute, vendorID string) Dispute {
+	shares := make([]ShipmentShare, 0, len(dispute.Shipments))
+	for _, share := range dispute.Shipments {
+		if share.VendorID == vendorID {
+			shares = append(shares, share)
+		}
+	}
+	evidence := make([]Evidence, 0, len(dispute.Evidence))
+	for _, item := range dispute.Evidence {
+		if item.VendorID == vendorID {
+			evidence = append(evidence, item)
+		}
+	}
+	dispute.Shipments = shares
+	dispute.Evidence = evidence
+	return dispute
+}
+
+func hasVendorShare(dispute Dispute, vendorID string) bool {
+	for _, share := range dispute.Shipments {
+		if share.VendorID == vendorID {
+			return true
+		}
+	}
+	return false
+}
+
+func shareVendorIDs(shares []ShipmentShare) []string {
+	seen := make(map[string]struct{}, len(shares))
+	vendorIDs := make([]string, 0, len(shares))
+	for _, share := range shares {
+		if _, exists := seen[share.VendorID]; exists {
+			continue
+		}
+		seen[share.VendorID] = struct{}{}
+		vendorIDs = append(vendorIDs, share.VendorID)
+	}
+	return vendorIDs
+}
+
+func sortDisputes(items []Dispute) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].UpdatedAt.Equal(items[j].UpdatedAt) {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].UpdatedAt.After(items[j].UpdatedAt)
+	})
+}
+
+func normalizeStatus(status string) string {
+	return strings.ToLower(strings.TrimSpace(status))
+}
+
+func isValidStatus(status string) bool {
+	switch normalizeStatus(status) {
+	case StatusWarningNeedsResponse, StatusWarningUnderReview, StatusWarningClosed,
+		StatusNeedsResponse, StatusUnderReview, StatusWon, StatusLost:
+		return true
+	default:
+		return false
+	}
+}
+
+func isValidEvidenceKind(kind string) bool {
+	switch kind {
+	case EvidenceKindTracking, EvidenceKindDelivery, EvidenceKindCommunication, EvidenceKindPolicy, EvidenceKindOther:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+package disputes
+
+import (
+	"testing"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestRecordDisputeAndSubmitVendorEvidence(t *testing.T) {
+	svc := NewService()
+	order := commerce.Order{
+		ID:       "ord_1",
+		Currency: "USD",
+		Shipments: []commerce.OrderShipment{
+			{ID: "shp_1", VendorID: "ven_1", TotalCents: 3000, Status: commerce.ShipmentStatusShipped},
+			{ID: "shp_2", VendorID: "ven_2", TotalCents: 1000, Status: commerce.ShipmentStatusShipped},
+			{ID: "shp_3", VendorID: "ven_3", TotalCents: 5000, Status: commerce.ShipmentStatusCancelled},
+		},
+	}
+
+	shares := AllocateShares(order, 2001)
+	if len(shares) != 2 || shares[0].AmountCents != 1500 || shares[1].AmountCents != 501 {
+		t.Fatalf("expected proportional shares settling rounding last, got %+v", shares)
+	}
+
+	created, err := svc.Record(Update{
+		ProviderRef: "dp_1",
+		OrderID:     order.ID,
+		PaymentID:   "pay_1",
+		Reason:      "product_not_received",
+		Status:      StatusNeedsResponse,
+		AmountCents: 2001,
+		Currency:    "usd",
+		Shipments:   shares,
+	})
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if !created.Created || created.Closed || created.Dispute.Currency != "USD" {
+		t.Fatalf("unexpected create result %+v", created)
+	}
+	if _, err := svc.Record(Update{ProviderRef: "dp_1", OrderID: order.ID, Status: "escalated"}); err != ErrInvalidStatus {
+		t.Fatalf("expected ErrInvalidStatus, got %v", err)
+	}
+
+	vendorView, err := svc.GetVendorDispute("ven_2", created.Dispute.ID)
+	if err != nil {
+		t.Fatalf("GetVendorDispute() error = %v", err)
+	}
+	if len(vendorView.Shipments) != 1 || vendorView.Shipments[0].ShipmentID != "shp_2" {
+		t.Fatalf("expected vendor view scoped to its shipment, got %+v", vendorView.Shipments)
+	}
+	if _, err := svc.GetVendorDispute("ven_3", created.Dispute.ID); err != ErrDisputeForbidden {
+		t.Fatalf("expected ErrDisputeForbidden, got %v", err)
+	}
+
+	if _, err := svc.AddEvidence("ven_1", created.Dispute.ID, "photo", "tracking shows delivered", "usr_1"); err != ErrInvalidEvidenceKind {
+		t.Fatalf("expected ErrInvalidEvidenceKind, got %v", err)
+	}
+	if _, err := svc.AddEvidence("ven_1", created.Dispute.ID, EvidenceKindTracking, "Delivered 2026-10-02, signed by J.", "usr_1"); err != nil {
+		t.Fatalf("AddEvidence() error = %v", err)
+	}
+	withEvidence, err := svc.AddEvidence("ven_2", created.Dispute.ID, EvidenceKindCommunication, "Buyer confirmed receipt by email.", "usr_2")
+	if err != nil {
+		t.Fatalf("AddEvidence() second vendor error = %v", err)
+	}
+	if got := withEvidence.EvidenceText(); got != "[tracking] Delivered 2026-10-02, signed by J.\n\n[customer_communication] Buyer confirmed receipt by email." {
+		t.Fatalf("unexpected evidence text %q", got)
+	}
+	items, err := svc.ListVendorDisputes("ven_1", StatusNeedsResponse)
+	if err != nil {
+		t.Fatalf("ListVendorDisputes() error = %v", err)
+	}
+	if len(items) != 1 || len(items[0].Evidence) != 1 {
+		t.Fatalf("expected one dispute with the vendor's own evidence, got %+v", items)
+	}
+
+	closed, err := svc.Record(Update{ProviderRef: "dp_1", OrderID: order.ID, Status: StatusWon})
+	if err != nil {
+		t.Fatalf("Record() close error = %v", err)
+	}
+	if closed.Created || !closed.Closed || closed.Dispute.ClosedAt == nil {
+		t.Fatalf("unexpected close result %+v", closed)
+	}
+	repeated, err := svc.Record(Update{ProviderRef: "dp_1", OrderID: order.ID, Status: StatusLost})
+	if err != nil {
+		t.Fatalf("Record() after close error = %v", err)
+	}
+	if repeated.Closed || repeated.Dispute.Status != StatusWon {
+		t.Fatalf("expected closed dispute to stay won, got %+v", repeated)
+	}
+	if _, err := svc.AddEvidence("ven_1", created.Dispute.ID, EvidenceKindOther, "late", "usr_1"); err != ErrDisputeClosed {
+		t.Fatalf("expected ErrDisputeClosed, got %v", err)
+	}
+
+	if summary := svc.Summary(); summary.Total != 1 || summary.Won != 1 || summary.Open != 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
@@ -8,10 +8,10 @@ import (
 )
 
 func actorTypeForRole(role auth.Role) string {
-	switch role {
-	case auth.RoleVendorOwner:
+	switch {
+	case auth.IsVendorRole(role):
 		return "vendor"
-	case auth.RoleBuyer:
+	case role == auth.RoleBuyer:
 		return "buyer"
 	default:
 		return "admin"
@@ -35,7 +35,7 @@ func (a *api) recordAuditLog(
 		return
 	}
 
-	_, _ = a.auditLogs.Record(auditlog.RecordInput{
+	input := auditlog.RecordInput{
 		ActorType:  actorTypeForRole(identity.Role),
 		ActorID:    identity.UserID,
 		ActorRole:  identity.Role.String(),
@@ -45,5 +45,33 @@ func (a *api) recordAuditLog(
 		Before:     before,
 		After:      after,
 		Metadata:   metadata,
+	}
+	// Under impersonation the staff member is the actor and the user they
+	// are viewing as is recorded alongside.
+	if identity.Impersonated() {
+		input.ActorType = actorTypeForRole(identity.ImpersonatorRole)
+		input.ActorID = identity.ImpersonatorID
+		input.ActorRole = identity.ImpersonatorRole.String()
+		input.ImpersonationID = identity.SessionID
+		input.OnBehalfOf = identity.UserID
+	}
+	_, _ = a.auditLogs.Record(input)
+}
+
+// recordUserAuditLog records an action of a user who is not authenticated by
+// the request yet, such as a login step or a password reset.
+func (a *api) recordUserAuditLog(user auth.User, action string, metadata interface{}) {
+	if a.auditLogs == nil {
+		return
+	}
+
+	_, _ = a.auditLogs.Record(auditlog.RecordInput{
+		ActorType:  actorTypeForRole(user.Role),
+		ActorID:    user.ID,
+		ActorRole:  user.Role.String(),
+		Action:     action,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Metadata:   metadata,
 	})
 }
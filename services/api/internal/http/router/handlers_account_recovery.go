@@ -0,0 +1,150 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+	"github.com/yxshee/marketplace-platform/services/api/internal/mailer"
+)
+
+// accountEmailSettings configure the verification and password reset emails.
+// Links point at the web app, which posts the token back to the API.
+type accountEmailSettings struct {
+	webBaseURL      string
+	verificationTTL time.Duration
+	resetTTL        time.Duration
+	// requireVerified withholds tokens from accounts whose email is not
+	// verified yet.
+	requireVerified bool
+}
+
+type accountEmailRequest struct {
+	Email string `json:"email"`
+}
+
+type accountTokenRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// handleEmailVerificationRequest sends a new verification link. It answers
+// 202 whether or not the account exists, so it cannot be used to probe for
+// registered emails.
+func (a *api) handleEmailVerificationRequest(w http.ResponseWriter, r *http.Request) {
+	var req accountEmailRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if user, found := a.authService.GetUserByEmail(req.Email); found && user.EmailVerifiedAt == nil {
+		a.sendEmailVerification(r.Context(), user)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "verification_email_sent"})
+}
+
+func (a *api) handleEmailVerificationConfirm(w http.ResponseWriter, r *http.Request) {
+	var req accountTokenRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := a.authService.VerifyEmail(req.Token)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "verification token is invalid or expired")
+		return
+	}
+	writeJSON(w, http.StatusOK, toAuthUserDTO(user))
+}
+
+// handlePasswordResetRequest emails a reset link. Like the verification
+// request it always answers 202.
+func (a *api) handlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	var req accountEmailRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rawToken, user, err := a.authService.IssuePasswordResetToken(req.Email, a.accountEmails.resetTTL)
+	if err == nil {
+		a.sendAccountEmail(r.Context(), mailer.Mail{
+			Kind:    string(auth.TokenPurposePasswordReset),
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf(
+				"Someone asked to reset the password of your account.\n\nSet a new password: %s\n\nThe link works once and expires in %s. If you did not ask for this, ignore this email; your password stays the same.\n",
+				a.accountLink("/reset-password", rawToken),
+				a.accountEmails.resetTTL,
+			),
+		})
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "password_reset_email_sent"})
+}
+
+// handlePasswordResetConfirm sets the new password and signs the user out
+// everywhere.
+func (a *api) handlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	var req accountTokenRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, revoked, err := a.authService.ResetPassword(req.Token, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrWeakPassword):
+			writeError(w, http.StatusBadRequest, "password must be at least 8 characters")
+		default:
+			writeError(w, http.StatusBadRequest, "reset token is invalid or expired")
+		}
+		return
+	}
+
+	a.recordUserAuditLog(user, "auth_password_reset", map[string]int{"revoked_sessions": revoked})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":           "password_reset",
+		"revoked_sessions": revoked,
+	})
+}
+
+func (a *api) sendEmailVerification(ctx context.Context, user auth.User) {
+	rawToken, user, err := a.authService.IssueEmailVerificationToken(user.ID, a.accountEmails.verificationTTL)
+	if err != nil {
+		return
+	}
+	a.sendAccountEmail(ctx, mailer.Mail{
+		Kind:    string(auth.TokenPurposeEmailVerification),
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Confirm that this is your email address: %s\n\nThe link expires in %s.\n",
+			a.accountLink("/verify-email", rawToken),
+			a.accountEmails.verificationTTL,
+		),
+	})
+}
+
+// sendAccountEmail logs delivery failures instead of failing the request;
+// the user can ask for another email.
+func (a *api) sendAccountEmail(ctx context.Context, message mailer.Mail) {
+	if a.mailer == nil {
+		return
+	}
+	if err := a.mailer.Send(ctx, message); err != nil {
+		log.Printf("account email kind=%s delivery failed: %v", message.Kind, err)
+	}
+}
+
+func (a *api) accountLink(path, rawToken string) string {
+	return a.accountEmails.webBaseURL + path + "?token=" + url.QueryEscape(rawToken)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/yxshee/marketplace-platform/services/api/internal/catalog"
 	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/currency"
 	"github.com/yxshee/marketplace-platform/services/api/internal/refunds"
 	"github.com/yxshee/marketplace-platform/services/api/internal/vendors"
 )
@@ -21,6 +22,7 @@ type adminDashboardOverviewResponse struct {
 	VendorMetrics         adminDashboardVendorMetrics          `json:"vendor_metrics"`
 	ModerationQueue       adminDashboardModerationQueueMetrics `json:"moderation_queue"`
 	Disputes              adminDashboardDisputeMetrics         `json:"disputes"`
+	UnconvertedOrderCount int                                  `json:"unconverted_order_count"`
 	GeneratedAt           time.Time                            `json:"generated_at"`
 }
 
@@ -30,6 +32,7 @@ type adminDashboardOrderVolumes struct {
 	CODConfirmed   int `json:"cod_confirmed"`
 	Paid           int `json:"paid"`
 	PaymentFailed  int `json:"payment_failed"`
+	Expired        int `json:"expired"`
 }
 
 type adminDashboardVendorMetrics struct {
@@ -51,6 +54,10 @@ type adminDashboardDisputeMetrics struct {
 	PendingTotal        int `json:"pending_total"`
 	ApprovedTotal       int `json:"approved_total"`
 	RejectedTotal       int `json:"rejected_total"`
+	ChargebacksTotal    int `json:"chargebacks_total"`
+	ChargebacksOpen     int `json:"chargebacks_open"`
+	ChargebacksWon      int `json:"chargebacks_won"`
+	ChargebacksLost     int `json:"chargebacks_lost"`
 }
 
 type adminAnalyticsRevenueSummary struct {
@@ -68,10 +75,11 @@ type adminAnalyticsRevenuePoint struct {
 }
 
 type adminAnalyticsRevenueResponse struct {
-	Currency   string                       `json:"currency"`
-	WindowDays int                          `json:"window_days"`
-	Summary    adminAnalyticsRevenueSummary `json:"summary"`
-	Points     []adminAnalyticsRevenuePoint `json:"points"`
+	Currency              string                       `json:"currency"`
+	WindowDays            int                          `json:"window_days"`
+	Summary               adminAnalyticsRevenueSummary `json:"summary"`
+	Points                []adminAnalyticsRevenuePoint `json:"points"`
+	UnconvertedOrderCount int                          `json:"unconverted_order_count"`
 }
 
 type adminVendorAnalyticsItem struct {
@@ -98,10 +106,11 @@ type adminVendorAnalyticsItem struct {
 }
 
 type adminAnalyticsVendorsResponse struct {
-	Items  []adminVendorAnalyticsItem `json:"items"`
-	Total  int                        `json:"total"`
-	Limit  int                        `json:"limit"`
-	Offset int                        `json:"offset"`
+	Currency string                     `json:"currency"`
+	Items    []adminVendorAnalyticsItem `json:"items"`
+	Total    int                        `json:"total"`
+	Limit    int                        `json:"limit"`
+	Offset   int                        `json:"offset"`
 }
 
 type adminVendorPerformanceStats struct {
@@ -115,6 +124,11 @@ type adminRevenueAccumulator struct {
 }
 
 func (a *api) handleAdminDashboardOverview(w http.ResponseWriter, r *http.Request) {
+	reportingCurrency, ok := a.analyticsReportingCurrency(w, r)
+	if !ok {
+		return
+	}
+
 	orders, err := a.commerce.ListOrders("")
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "unable to load orders")
@@ -122,7 +136,7 @@ func (a *api) handleAdminDashboardOverview(w http.ResponseWriter, r *http.Reques
 	}
 
 	vendorList := a.vendorService.List(nil)
-	vendorPerformance, err := a.buildAdminVendorPerformance(vendorList)
+	vendorPerformance, err := a.buildAdminVendorPerformance(vendorList, reportingCurrency)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "unable to load vendor analytics")
 		return
@@ -133,9 +147,9 @@ func (a *api) handleAdminDashboardOverview(w http.ResponseWriter, r *http.Reques
 	orderVolumes := adminDashboardOrderVolumes{
 		Total: len(orders),
 	}
-	currency := commerce.DefaultCurrency
 	platformRevenueCents := int64(0)
 	commissionEarnedCents := int64(0)
+	unconvertedOrderCount := 0
 	for _, order := range orders {
 		switch strings.ToLower(strings.TrimSpace(order.Status)) {
 		case commerce.OrderStatusPendingPayment:
@@ -146,16 +160,29 @@ func (a *api) handleAdminDashboardOverview(w http.ResponseWriter, r *http.Reques
 			orderVolumes.Paid++
 		case commerce.OrderStatusPaymentFailed:
 			orderVolumes.PaymentFailed++
-		}
-		if normalized := strings.TrimSpace(order.Currency); normalized != "" {
-			currency = normalized
+		case commerce.OrderStatusExpired:
+			orderVolumes.Expired++
 		}
 		gross, commission := a.settledOrderFinancials(order, vendorList)
+		if gross == 0 && commission == 0 {
+			continue
+		}
+		gross, commission, converted := a.reportingFinancials(order, reportingCurrency, gross, commission)
+		if !converted {
+			unconvertedOrderCount++
+			continue
+		}
 		platformRevenueCents += gross
 		commissionEarnedCents += commission
 	}
 
-	disputes := adminDashboardDisputeMetrics{}
+	chargebacks := a.disputes.Summary()
+	disputes := adminDashboardDisputeMetrics{
+		ChargebacksTotal: chargebacks.Total,
+		ChargebacksOpen:  chargebacks.Open,
+		ChargebacksWon:   chargebacks.Won,
+		ChargebacksLost:  chargebacks.Lost,
+	}
 	vendorMetrics := adminDashboardVendorMetrics{
 		TotalVendors: len(vendorList),
 	}
@@ -186,7 +213,7 @@ func (a *api) handleAdminDashboardOverview(w http.ResponseWriter, r *http.Reques
 	}
 
 	writeJSON(w, http.StatusOK, adminDashboardOverviewResponse{
-		Currency:              currency,
+		Currency:              reportingCurrency,
 		PlatformRevenueCents:  platformRevenueCents,
 		CommissionEarnedCents: commissionEarnedCents,
 		OrderVolumes:          orderVolumes,
@@ -194,8 +221,9 @@ func (a *api) handleAdminDashboardOverview(w http.ResponseWriter, r *http.Reques
 		ModerationQueue: adminDashboardModerationQueueMetrics{
 			PendingProducts: len(moderationQueue),
 		},
-		Disputes:    disputes,
-		GeneratedAt: time.Now().UTC(),
+		Disputes:              disputes,
+		UnconvertedOrderCount: unconvertedOrderCount,
+		GeneratedAt:           time.Now().UTC(),
 	})
 }
 
@@ -209,6 +237,10 @@ func (a *api) handleAdminAnalyticsRevenue(w http.ResponseWriter, r *http.Request
 		}
 		windowDays = parsedDays
 	}
+	reportingCurrency, ok := a.analyticsReportingCurrency(w, r)
+	if !ok {
+		return
+	}
 
 	orders, err := a.commerce.ListOrders("")
 	if err != nil {
@@ -223,7 +255,7 @@ func (a *api) handleAdminAnalyticsRevenue(w http.ResponseWriter, r *http.Request
 
 	buckets := make(map[string]adminRevenueAccumulator, windowDays)
 	summary := adminAnalyticsRevenueSummary{}
-	currency := commerce.DefaultCurrency
+	unconvertedOrderCount := 0
 
 	for _, order := range orders {
 		if !isSettledOrderStatus(order.Status) {
@@ -236,8 +268,10 @@ func (a *api) handleAdminAnalyticsRevenue(w http.ResponseWriter, r *http.Request
 
 		dateKey := createdAt.Format("2006-01-02")
 		gross, commission := a.settledOrderFinancials(order, vendorList)
-		if normalized := strings.TrimSpace(order.Currency); normalized != "" {
-			currency = normalized
+		gross, commission, converted := a.reportingFinancials(order, reportingCurrency, gross, commission)
+		if !converted {
+			unconvertedOrderCount++
+			continue
 		}
 
 		bucket := buckets[dateKey]
@@ -269,10 +303,11 @@ func (a *api) handleAdminAnalyticsRevenue(w http.ResponseWriter, r *http.Request
 	}
 
 	writeJSON(w, http.StatusOK, adminAnalyticsRevenueResponse{
-		Currency:   currency,
-		WindowDays: windowDays,
-		Summary:    summary,
-		Points:     points,
+		Currency:              reportingCurrency,
+		WindowDays:            windowDays,
+		Summary:               summary,
+		Points:                points,
+		UnconvertedOrderCount: unconvertedOrderCount,
 	})
 }
 
@@ -282,9 +317,13 @@ func (a *api) handleAdminAnalyticsVendors(w http.ResponseWriter, r *http.Request
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	reportingCurrency, ok := a.analyticsReportingCurrency(w, r)
+	if !ok {
+		return
+	}
 
 	vendorList := a.vendorService.List(nil)
-	performance, err := a.buildAdminVendorPerformance(vendorList)
+	performance, err := a.buildAdminVendorPerformance(vendorList, reportingCurrency)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "unable to load vendor analytics")
 		return
@@ -308,14 +347,15 @@ func (a *api) handleAdminAnalyticsVendors(w http.ResponseWriter, r *http.Request
 	start, end := paginate(total, limit, offset)
 
 	writeJSON(w, http.StatusOK, adminAnalyticsVendorsResponse{
-		Items:  items[start:end],
-		Total:  total,
-		Limit:  limit,
-		Offset: offset,
+		Currency: reportingCurrency,
+		Items:    items[start:end],
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
 	})
 }
 
-func (a *api) buildAdminVendorPerformance(vendorList []vendors.Vendor) ([]adminVendorPerformanceStats, error) {
+func (a *api) buildAdminVendorPerformance(vendorList []vendors.Vendor, reportingCurrency string) ([]adminVendorPerformanceStats, error) {
 	performance := make([]adminVendorPerformanceStats, 0, len(vendorList))
 
 	for _, vendor := range vendorList {
@@ -347,12 +387,21 @@ func (a *api) buildAdminVendorPerformance(vendorList []vendors.Vendor) ([]adminV
 			if isSettledOrderStatus(shipment.OrderStatus) {
 				settledOrderSet[shipment.OrderID] = struct{}{}
 				if shipment.Status != commerce.ShipmentStatusCancelled {
-					grossRevenueCents += shipment.TotalCents
-					commissionEarnedCents += (shipment.TotalCents * int64(commissionBPS)) / 10000
+					order, _ := a.commerce.GetOrderForAdmin(shipment.OrderID)
+					gross, commission, converted := a.reportingFinancials(
+						order,
+						reportingCurrency,
+						shipment.TotalCents,
+						(shipment.TotalCents*int64(commissionBPS))/10000,
+					)
+					if converted {
+						grossRevenueCents += gross
+						commissionEarnedCents += commission
+					}
 				}
 			}
 			switch shipment.Status {
-			case commerce.ShipmentStatusPending:
+			case commerce.ShipmentStatusOnHold, commerce.ShipmentStatusPending:
 				pendingShipmentCount++
 			case commerce.ShipmentStatusPacked, commerce.ShipmentStatusShipped:
 				shippedShipmentCount++
@@ -436,3 +485,49 @@ func (a *api) settledOrderFinancials(order commerce.Order, vendorList []vendors.
 
 	return grossRevenueCents, commissionEarnedCents
 }
+
+// analyticsReportingCurrency resolves the currency analytics are reported in:
+// the optional ?currency= parameter, falling back to API_REPORTING_CURRENCY.
+func (a *api) analyticsReportingCurrency(w http.ResponseWriter, r *http.Request) (string, bool) {
+	raw := strings.TrimSpace(r.URL.Query().Get("currency"))
+	if raw == "" {
+		return a.reportingCurrency, true
+	}
+	normalized, err := currency.NormalizeCode(raw)
+	if err != nil || !a.currency.IsSupported(normalized) {
+		writeError(w, http.StatusBadRequest, "currency is not supported")
+		return "", false
+	}
+	return normalized, true
+}
+
+// reportingFinancials converts order-currency amounts into the reporting
+// currency. The rate snapshotted on the order at checkout wins over the live
+// FX table so historical revenue does not move when rates are edited.
+func (a *api) reportingFinancials(order commerce.Order, reportingCurrency string, grossCents, commissionCents int64) (int64, int64, bool) {
+	orderCurrency := strings.TrimSpace(order.Currency)
+	if orderCurrency == "" {
+		orderCurrency = commerce.DefaultCurrency
+	}
+	if orderCurrency == reportingCurrency {
+		return grossCents, commissionCents, true
+	}
+
+	for _, snapshot := range order.FXRates {
+		if snapshot.FromCurrency != orderCurrency || snapshot.ToCurrency != reportingCurrency {
+			continue
+		}
+		gross, grossErr := currency.ConvertWithRate(grossCents, snapshot.Rate, orderCurrency, reportingCurrency)
+		commission, commissionErr := currency.ConvertWithRate(commissionCents, snapshot.Rate, orderCurrency, reportingCurrency)
+		if grossErr == nil && commissionErr == nil {
+			return gross, commission, true
+		}
+	}
+
+	gross, _, grossErr := a.currency.Convert(grossCents, orderCurrency, reportingCurrency)
+	commission, _, commissionErr := a.currency.Convert(commissionCents, orderCurrency, reportingCurrency)
+	if grossErr != nil || commissionErr != nil {
+		return 0, 0, false
+	}
+	return gross, commission, true
+}
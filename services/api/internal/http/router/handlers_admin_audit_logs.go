@@ -37,13 +37,14 @@ func (a *api) handleAdminAuditLogsList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result := a.auditLogs.List(auditlog.ListInput{
-		ActorType:  strings.TrimSpace(r.URL.Query().Get("actor_type")),
-		ActorID:    strings.TrimSpace(r.URL.Query().Get("actor_id")),
-		Action:     strings.TrimSpace(r.URL.Query().Get("action")),
-		TargetType: strings.TrimSpace(r.URL.Query().Get("target_type")),
-		TargetID:   strings.TrimSpace(r.URL.Query().Get("target_id")),
-		Limit:      limit,
-		Offset:     offset,
+		ActorType:       strings.TrimSpace(r.URL.Query().Get("actor_type")),
+		ActorID:         strings.TrimSpace(r.URL.Query().Get("actor_id")),
+		Action:          strings.TrimSpace(r.URL.Query().Get("action")),
+		TargetType:      strings.TrimSpace(r.URL.Query().Get("target_type")),
+		TargetID:        strings.TrimSpace(r.URL.Query().Get("target_id")),
+		ImpersonationID: strings.TrimSpace(r.URL.Query().Get("impersonation_id")),
+		Limit:           limit,
+		Offset:          offset,
 	})
 
 	writeJSON(w, http.StatusOK, adminAuditLogListResponse{
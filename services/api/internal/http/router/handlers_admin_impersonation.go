@@ -0,0 +1,122 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+)
+
+type impersonationStartRequest struct {
+	UserID   string `json:"user_id"`
+	Reason   string `json:"reason"`
+	Elevated bool   `json:"elevated"`
+}
+
+type impersonationDTO struct {
+	ID             string     `json:"id"`
+	ImpersonatorID string     `json:"impersonator_id"`
+	SubjectID      string     `json:"subject_id"`
+	Reason         string     `json:"reason"`
+	Elevated       bool       `json:"elevated"`
+	StartedAt      time.Time  `json:"started_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+}
+
+type impersonationStartResponse struct {
+	AccessToken   string           `json:"access_token"`
+	ExpiresAt     time.Time        `json:"expires_at"`
+	Impersonation impersonationDTO `json:"impersonation"`
+	User          authUserDTO      `json:"user"`
+}
+
+func toImpersonationDTO(impersonation auth.Impersonation) impersonationDTO {
+	return impersonationDTO{
+		ID:             impersonation.ID,
+		ImpersonatorID: impersonation.ImpersonatorID,
+		SubjectID:      impersonation.SubjectID,
+		Reason:         impersonation.Reason,
+		Elevated:       impersonation.Elevated,
+		StartedAt:      impersonation.StartedAt,
+		ExpiresAt:      impersonation.ExpiresAt,
+		EndedAt:        impersonation.EndedAt,
+	}
+}
+
+func (a *api) handleAdminImpersonationsList(w http.ResponseWriter, _ *http.Request) {
+	active := a.authService.ActiveImpersonations()
+	items := make([]impersonationDTO, 0, len(active))
+	for _, impersonation := range active {
+		items = append(items, toImpersonationDTO(impersonation))
+	}
+	writeJSON(w, http.StatusOK, map[string][]impersonationDTO{"items": items})
+}
+
+// handleAdminImpersonationStart issues a short-lived access token that acts
+// as a buyer or vendor. There is no refresh token; the staff member starts a
+// new impersonation when it expires.
+func (a *api) handleAdminImpersonationStart(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	var req impersonationStartRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	impersonation, subject, err := a.authService.StartImpersonation(identity.UserID, req.UserID, req.Reason, req.Elevated, a.impersonationTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrImpersonationReason):
+			writeError(w, http.StatusBadRequest, "reason is required (at most 500 characters)")
+		case errors.Is(err, auth.ErrUserNotFound):
+			writeError(w, http.StatusNotFound, "user not found")
+		case errors.Is(err, auth.ErrNotImpersonatable):
+			writeError(w, http.StatusConflict, "only buyers and vendor team members can be impersonated")
+		case errors.Is(err, auth.ErrElevationNotPermitted):
+			writeError(w, http.StatusForbidden, "elevated impersonation requires impersonate_users_elevated")
+		default:
+			writeError(w, http.StatusInternalServerError, "unable to start impersonation")
+		}
+		return
+	}
+
+	token, err := a.tokenManager.IssueImpersonationToken(subject, impersonation)
+	if err != nil {
+		_, _ = a.authService.EndImpersonation(impersonation.ID)
+		writeError(w, http.StatusInternalServerError, "token issuance failed")
+		return
+	}
+
+	started := toImpersonationDTO(impersonation)
+	a.recordAuditLog(r, "impersonation_started", "user", subject.ID, nil, started, nil)
+	writeJSON(w, http.StatusCreated, impersonationStartResponse{
+		AccessToken:   token,
+		ExpiresAt:     impersonation.ExpiresAt,
+		Impersonation: started,
+		User:          toAuthUserDTO(subject),
+	})
+}
+
+// handleAdminImpersonationEnd stops an impersonation before it expires; its
+// token is rejected from then on.
+func (a *api) handleAdminImpersonationEnd(w http.ResponseWriter, r *http.Request) {
+	impersonation, err := a.authService.EndImpersonation(chi.URLParam(r, "impersonationID"))
+	if err != nil {
+		if errors.Is(err, auth.ErrImpersonationNotFound) {
+			writeError(w, http.StatusNotFound, "impersonation not found or already ended")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "unable to end impersonation")
+		return
+	}
+
+	a.recordAuditLog(r, "impersonation_ended", "user", impersonation.SubjectID, nil, toImpersonationDTO(impersonation), nil)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ended"})
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSupportImpersonationIsReadOnlyUnlessElevatedAndAudited(t *testing.T) {
+	r := mustRouter(t)
+	ownerToken, productID := createApprovedVendorProduct(t, r, "impersonated-vendor@example.com", "impersonated-vendor", 1500, 4)
+	admin := loginOrRegisterUser(t, r, "admin@example.com")
+	support := registerUser(t, r, "support@example.com")
+	finance := registerUser(t, r, "finance@example.com")
+	buyer := registerUser(t, r, "impersonated-buyer@example.com")
+
+	start := func(token, userID string, elevated bool) *httptest.ResponseRecorder {
+		t.Helper()
+		return requestJSON(t, r, http.MethodPost, "/api/v1/admin/impersonations", map[string]interface{}{
+			"user_id":  userID,
+			"reason":   "ticket 1042: checkout question",
+			"elevated": elevated,
+		}, token)
+	}
+	var session struct {
+		AccessToken   string `json:"access_token"`
+		Impersonation struct {
+			ID string `json:"id"`
+		} `json:"impersonation"`
+	}
+
+	if rr := start(finance.AccessToken, buyer.User.ID, false); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected finance to be refused impersonation, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/admin/impersonations", map[string]string{"user_id": buyer.User.ID}, support.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a reason to be required, status=%d", rr.Code)
+	}
+	if rr := start(support.AccessToken, admin.User.ID, false); rr.Code != http.StatusConflict {
+		t.Fatalf("expected staff to be refused, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	started := start(support.AccessToken, buyer.User.ID, false)
+	if started.Code != http.StatusCreated || strings.Contains(started.Body.String(), "refresh_token") {
+		t.Fatalf("start impersonation status=%d body=%s", started.Code, started.Body.String())
+	}
+	if err := json.Unmarshal(started.Body.Bytes(), &session); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	readOnly := session
+
+	me := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, readOnly.AccessToken)
+	if me.Code != http.StatusOK || !strings.Contains(me.Body.String(), `"id":"`+buyer.User.ID+`"`) {
+		t.Fatalf("expected to see the buyer, status=%d body=%s", me.Code, me.Body.String())
+	}
+	addItem := map[string]interface{}{"product_id": productID, "qty": 1}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/cart/items", addItem, readOnly.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected writes to be refused, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/orders", nil, readOnly.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected the buyer's permissions, status=%d", rr.Code)
+	}
+
+	if rr := start(support.AccessToken, buyer.User.ID, true); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected support to be refused elevation, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if err := json.Unmarshal(start(admin.AccessToken, buyer.User.ID, true).Body.Bytes(), &session); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	elevated := session
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/cart/items", addItem, elevated.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("elevated add to cart status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	for _, path := range []string{"/api/v1/auth/logout", "/api/v1/auth/mfa/enroll", "/api/v1/vendor/invitations/accept"} {
+		if rr := requestJSON(t, r, http.MethodPost, path, map[string]string{}, elevated.AccessToken); rr.Code != http.StatusForbidden {
+			t.Fatalf("expected %s to be refused while impersonating, status=%d", path, rr.Code)
+		}
+	}
+
+	var vendorSession struct {
+		AccessToken string `json:"access_token"`
+	}
+	vendorOwner := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, ownerToken)
+	var ownerBody struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(vendorOwner.Body.Bytes(), &ownerBody)
+	if err := json.Unmarshal(start(support.AccessToken, ownerBody.ID, false).Body.Bytes(), &vendorSession); err != nil || vendorSession.AccessToken == "" {
+		t.Fatalf("expected vendor owners to be impersonatable, err=%v", err)
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/products", nil, vendorSession.AccessToken); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), productID) {
+		t.Fatalf("expected the vendor's products, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	for _, path := range []string{"/api/v1/vendor/connect", "/api/v1/invoices/ord_missing", "/api/v1/payments/pay_missing"} {
+		if rr := requestJSON(t, r, http.MethodGet, path, nil, vendorSession.AccessToken); rr.Code != http.StatusForbidden {
+			t.Fatalf("expected %s to be refused as it writes, status=%d", path, rr.Code)
+		}
+	}
+
+	list := requestJSON(t, r, http.MethodGet, "/api/v1/admin/impersonations", nil, support.AccessToken)
+	if list.Code != http.StatusOK || strings.Count(list.Body.String(), `"impersonator_id":"`+support.User.ID+`"`) != 2 {
+		t.Fatalf("list impersonations status=%d body=%s", list.Code, list.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/admin/impersonations/"+readOnly.Impersonation.ID, nil, support.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("end impersonation status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, readOnly.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an ended impersonation's token to be rejected, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/admin/impersonations/"+readOnly.Impersonation.ID, nil, support.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected ending twice to be not found, status=%d", rr.Code)
+	}
+
+	var logs struct {
+		Items []struct {
+			ActorID         string          `json:"actor_id"`
+			ActorRole       string          `json:"actor_role"`
+			ImpersonationID string          `json:"impersonation_id"`
+			OnBehalfOf      string          `json:"on_behalf_of"`
+			MetadataJSON    json.RawMessage `json:"metadata_json"`
+		} `json:"items"`
+	}
+	tagged := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?impersonation_id="+readOnly.Impersonation.ID, nil, admin.AccessToken)
+	if err := json.Unmarshal(tagged.Body.Bytes(), &logs); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(logs.Items) != 3 {
+		t.Fatalf("expected every impersonated request to be audited, body=%s", tagged.Body.String())
+	}
+	for _, entry := range logs.Items {
+		if entry.ActorID != support.User.ID || entry.ActorRole != "support" || entry.OnBehalfOf != buyer.User.ID {
+			t.Fatalf("expected the real actor on %+v", entry)
+		}
+	}
+	if !strings.Contains(string(logs.Items[1].MetadataJSON), `"status":403`) {
+		t.Fatalf("expected the refused write to be audited with its status, got %s", logs.Items[1].MetadataJSON)
+	}
+
+	writes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?impersonation_id="+elevated.Impersonation.ID, nil, admin.AccessToken)
+	if !strings.Contains(writes.Body.String(), `"path":"/api/v1/cart/items","status":200`) {
+		t.Fatalf("expected the elevated write to be audited, body=%s", writes.Body.String())
+	}
+	for _, action := range []string{"impersonation_started", "impersonation_ended"} {
+		rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?action="+action+"&actor_id="+support.User.ID, nil, admin.AccessToken)
+		if !strings.Contains(rr.Body.String(), `"action":"`+action+`"`) {
+			t.Fatalf("expected %s audit entries, body=%s", action, rr.Body.String())
+		}
+	}
+}
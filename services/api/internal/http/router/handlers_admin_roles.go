@@ -0,0 +1,188 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+)
+
+type roleRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+type userRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type roleDTO struct {
+	Name        auth.Role         `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Permissions []auth.Permission `json:"permissions"`
+	BuiltIn     bool              `json:"built_in"`
+	CreatedAt   *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time        `json:"updated_at,omitempty"`
+}
+
+type roleUserDTO struct {
+	ID    string    `json:"id"`
+	Email string    `json:"email"`
+	Role  auth.Role `json:"role"`
+}
+
+type roleListResponse struct {
+	Items       []roleDTO         `json:"items"`
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+type roleDetailResponse struct {
+	roleDTO
+	Users []roleUserDTO `json:"users"`
+}
+
+func toRoleDTO(definition auth.RoleDefinition) roleDTO {
+	dto := roleDTO{
+		Name:        definition.Name,
+		Description: definition.Description,
+		Permissions: definition.Permissions,
+		BuiltIn:     definition.BuiltIn,
+	}
+	if !definition.BuiltIn {
+		createdAt, updatedAt := definition.CreatedAt, definition.UpdatedAt
+		dto.CreatedAt = &createdAt
+		dto.UpdatedAt = &updatedAt
+	}
+	return dto
+}
+
+func toRoleUserDTO(user auth.User) roleUserDTO {
+	return roleUserDTO{ID: user.ID, Email: user.Email, Role: user.Role}
+}
+
+func (a *api) handleAdminRolesList(w http.ResponseWriter, _ *http.Request) {
+	definitions := a.authService.RoleDefinitions()
+	response := roleListResponse{
+		Items:       make([]roleDTO, 0, len(definitions)),
+		Permissions: auth.GrantablePermissions(),
+	}
+	for _, definition := range definitions {
+		response.Items = append(response.Items, toRoleDTO(definition))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) handleAdminRoleDetail(w http.ResponseWriter, r *http.Request) {
+	role := auth.Role(chi.URLParam(r, "role"))
+	definition, exists := a.authService.RoleDefinition(role)
+	if !exists {
+		writeError(w, http.StatusNotFound, "role not found")
+		return
+	}
+
+	holders := a.authService.UsersWithRole(role)
+	response := roleDetailResponse{roleDTO: toRoleDTO(definition), Users: make([]roleUserDTO, 0, len(holders))}
+	for _, user := range holders {
+		response.Users = append(response.Users, toRoleUserDTO(user))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) handleAdminRoleCreate(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	definition, err := a.authService.CreateRole(auth.Role(req.Name), req.Description, req.Permissions)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	created := toRoleDTO(definition)
+	a.recordAuditLog(r, "role_created", "role", string(definition.Name), nil, created, nil)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// handleAdminRoleUpdate replaces a custom role's permissions. Holders get
+// them on their next token refresh.
+func (a *api) handleAdminRoleUpdate(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	before, after, err := a.authService.UpdateRole(auth.Role(chi.URLParam(r, "role")), req.Description, req.Permissions)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	updated := toRoleDTO(after)
+	a.recordAuditLog(r, "role_updated", "role", string(after.Name), toRoleDTO(before), updated, nil)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (a *api) handleAdminRoleDelete(w http.ResponseWriter, r *http.Request) {
+	definition, err := a.authService.DeleteRole(auth.Role(chi.URLParam(r, "role")))
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	a.recordAuditLog(r, "role_deleted", "role", string(definition.Name), toRoleDTO(definition), nil, nil)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleAdminUserRoleAssign changes a user's role. The user's tokens carry the
+// new role from their next refresh.
+func (a *api) handleAdminUserRoleAssign(w http.ResponseWriter, r *http.Request) {
+	var req userRoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	role := auth.Role(strings.ToLower(strings.TrimSpace(req.Role)))
+	before, after, err := a.authService.AssignRole(chi.URLParam(r, "userID"), role)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	assigned := toRoleUserDTO(after)
+	a.recordAuditLog(r, "user_role_assigned", "user", after.ID, toRoleUserDTO(before), assigned, nil)
+	writeJSON(w, http.StatusOK, assigned)
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidRoleName):
+		writeError(w, http.StatusBadRequest, "role name must be 3-48 lowercase letters, digits or underscores, starting with a letter")
+	case errors.Is(err, auth.ErrUnknownPermission):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth.ErrUnknownRole):
+		writeError(w, http.StatusNotFound, "role not found")
+	case errors.Is(err, auth.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, auth.ErrRoleExists):
+		writeError(w, http.StatusConflict, "role already exists")
+	case errors.Is(err, auth.ErrBuiltInRole):
+		writeError(w, http.StatusConflict, "built-in roles cannot be changed")
+	case errors.Is(err, auth.ErrRoleInUse):
+		writeError(w, http.StatusConflict, "role is assigned to users")
+	case errors.Is(err, auth.ErrRoleNotAssignable):
+		writeError(w, http.StatusConflict, "vendor roles follow vendor team membership")
+	case errors.Is(err, auth.ErrLastSuperAdmin):
+		writeError(w, http.StatusConflict, "the last super admin cannot be reassigned")
+	default:
+		writeError(w, http.StatusInternalServerError, "role update failed")
+	}
+}
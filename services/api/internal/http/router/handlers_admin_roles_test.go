@@ -0,0 +1,114 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdminCustomRolesTakeEffectOnRefreshAndAreAudited(t *testing.T) {
+	r := mustRouter(t)
+	admin := registerUser(t, r, "admin@example.com")
+	support := registerUser(t, r, "support@example.com")
+	analyst := registerUser(t, r, "analyst@example.com")
+
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/roles", nil, support.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected support to be refused role management, status=%d", rr.Code)
+	}
+	list := requestJSON(t, r, http.MethodGet, "/api/v1/admin/roles", nil, admin.AccessToken)
+	if list.Code != http.StatusOK || !strings.Contains(list.Body.String(), `"name":"support","permissions":[`) || strings.Contains(list.Body.String(), `"manage_roles"]}`) {
+		t.Fatalf("list roles status=%d body=%s", list.Code, list.Body.String())
+	}
+
+	for _, permission := range []string{"manage_roles", "manage_security_settings", "impersonate_users"} {
+		if rr := requestJSON(t, r, http.MethodPost, "/api/v1/admin/roles", map[string]interface{}{"name": "report_viewer", "permissions": []string{permission}}, admin.AccessToken); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be refused, status=%d body=%s", permission, rr.Code, rr.Body.String())
+		}
+	}
+	created := requestJSON(t, r, http.MethodPost, "/api/v1/admin/roles", map[string]interface{}{
+		"name":        "report_viewer",
+		"description": "Reads analytics and audit logs",
+		"permissions": []string{"view_admin_analytics", "view_audit_logs"},
+	}, admin.AccessToken)
+	if created.Code != http.StatusCreated || !strings.Contains(created.Body.String(), `"built_in":false`) {
+		t.Fatalf("create role status=%d body=%s", created.Code, created.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/admin/roles", map[string]interface{}{"name": "report_viewer"}, admin.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected duplicate role to conflict, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/roles/support", map[string]interface{}{"permissions": []string{}}, admin.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected built-in roles to be read-only, status=%d", rr.Code)
+	}
+
+	assigned := requestJSON(t, r, http.MethodPut, "/api/v1/admin/users/"+analyst.User.ID+"/role", map[string]string{"role": "report_viewer"}, admin.AccessToken)
+	if assigned.Code != http.StatusOK || !strings.Contains(assigned.Body.String(), `"role":"report_viewer"`) {
+		t.Fatalf("assign role status=%d body=%s", assigned.Code, assigned.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs", nil, analyst.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected the old token to keep the old role, status=%d", rr.Code)
+	}
+	refresh := func(token string) authPayload {
+		t.Helper()
+		rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": token}, "")
+		var payload authPayload
+		if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &payload) != nil {
+			t.Fatalf("refresh status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		return payload
+	}
+	analyst = refresh(analyst.RefreshToken)
+	if analyst.User.Role != "report_viewer" {
+		t.Fatalf("expected the custom role after refresh, got %s", analyst.User.Role)
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs", nil, analyst.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("custom role audit logs status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/roles", nil, analyst.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected custom role to be refused role management, status=%d", rr.Code)
+	}
+
+	detail := requestJSON(t, r, http.MethodGet, "/api/v1/admin/roles/report_viewer", nil, admin.AccessToken)
+	if detail.Code != http.StatusOK || !strings.Contains(detail.Body.String(), `"email":"analyst@example.com"`) {
+		t.Fatalf("role detail status=%d body=%s", detail.Code, detail.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/roles/report_viewer", map[string]interface{}{"permissions": []string{"view_admin_analytics"}}, admin.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("update role status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs", nil, analyst.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected the removed permission to be refused before refresh, status=%d", rr.Code)
+	}
+	analyst = refresh(analyst.RefreshToken)
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs", nil, analyst.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected the removed permission to be refused after refresh, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/admin/roles/report_viewer", nil, admin.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected a held role to be kept, status=%d", rr.Code)
+	}
+
+	if rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/users/"+analyst.User.ID+"/role", map[string]string{"role": "vendor_owner"}, admin.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected vendor roles to be refused, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/users/"+admin.User.ID+"/role", map[string]string{"role": "support"}, admin.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected the last super admin to be kept, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/users/"+analyst.User.ID+"/role", map[string]string{"role": "buyer"}, admin.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("reassign buyer status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/admin/roles/report_viewer", nil, admin.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("delete role status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, analyst.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected tokens of a deleted role to be rejected, status=%d", rr.Code)
+	}
+	if analyst = refresh(analyst.RefreshToken); analyst.User.Role != "buyer" {
+		t.Fatalf("expected buyer after refresh, got %s", analyst.User.Role)
+	}
+
+	for _, action := range []string{"role_created", "role_updated", "role_deleted", "user_role_assigned"} {
+		logs := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?action="+action, nil, admin.AccessToken)
+		if logs.Code != http.StatusOK || !strings.Contains(logs.Body.String(), `"actor_id":"`+admin.User.ID+`"`) {
+			t.Fatalf("expected %s audit entries, status=%d body=%s", action, logs.Code, logs.Body.String())
+		}
+	}
+}
@@ -11,8 +11,9 @@ type paymentSettingsResponse struct {
 }
 
 type paymentSettingsPatchRequest struct {
-	StripeEnabled *bool `json:"stripe_enabled"`
-	CODEnabled    *bool `json:"cod_enabled"`
+	StripeEnabled *bool           `json:"stripe_enabled"`
+	CODEnabled    *bool           `json:"cod_enabled"`
+	Providers     map[string]bool `json:"providers"`
 }
 
 func (a *api) handleAdminPaymentSettingsGet(w http.ResponseWriter, _ *http.Request) {
@@ -26,15 +27,22 @@ func (a *api) handleAdminPaymentSettingsPatch(w http.ResponseWriter, r *http.Req
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
-	if req.StripeEnabled == nil && req.CODEnabled == nil {
+	if req.StripeEnabled == nil && req.CODEnabled == nil && len(req.Providers) == 0 {
 		writeError(w, http.StatusBadRequest, "at least one settings field is required")
 		return
 	}
+	for name := range req.Providers {
+		if !a.payments.HasProvider(name) {
+			writeError(w, http.StatusBadRequest, "unknown payment provider")
+			return
+		}
+	}
 
 	previous := a.payments.GetSettings()
 	settings := a.payments.UpdateSettings(payments.PaymentSettingsUpdate{
 		StripeEnabled: req.StripeEnabled,
 		CODEnabled:    req.CODEnabled,
+		Providers:     req.Providers,
 	})
 	a.recordAuditLog(
 		r,
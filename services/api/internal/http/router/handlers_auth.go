@@ -25,6 +25,9 @@ type authResponse struct {
 	AccessExpiresAt  time.Time   `json:"access_expires_at"`
 	RefreshExpiresAt time.Time   `json:"refresh_expires_at"`
 	User             authUserDTO `json:"user"`
+	// MFAEnrollmentRequired tells users whose role requires MFA that they
+	// must enrol before privileged endpoints accept their session.
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
 }
 
 type authUserDTO struct {
@@ -33,6 +36,8 @@ type authUserDTO struct {
 	Role     auth.Role  `json:"role"`
 	VendorID *string    `json:"vendor_id,omitempty"`
 	Created  *time.Time `json:"created_at,omitempty"`
+	Verified bool       `json:"email_verified"`
+	MFA      bool       `json:"mfa_enabled"`
 }
 
 func toAuthUserDTO(user auth.User) authUserDTO {
@@ -43,30 +48,44 @@ func toAuthUserDTO(user auth.User) authUserDTO {
 		Role:     user.Role,
 		VendorID: user.VendorID,
 		Created:  &created,
+		Verified: user.EmailVerifiedAt != nil,
+		MFA:      user.MFAEnabledAt != nil,
 	}
 }
 
-func (a *api) issueTokensForUser(user auth.User) (authResponse, error) {
+func (a *api) issueTokensForUser(r *http.Request, user auth.User, mfaVerified bool) (authResponse, error) {
 	sessionID := identifier.New("ses")
-	pair, err := a.tokenManager.IssueTokenPair(user, sessionID)
+	pair, err := a.tokenManager.IssueTokenPair(user, sessionID, mfaVerified)
 	if err != nil {
 		return authResponse{}, err
 	}
 
+	now := time.Now().UTC()
 	a.authService.SaveSession(auth.Session{
 		ID:               sessionID,
 		UserID:           user.ID,
 		RefreshTokenHash: auth.HashToken(pair.RefreshToken),
 		ExpiresAt:        pair.RefreshExpiresAt,
+		MFAVerified:      mfaVerified,
+		IP:               requestIPKey(r),
+		UserAgent:        r.UserAgent(),
+		CreatedAt:        now,
+		LastUsedAt:       now,
 	})
 
+	return a.toAuthResponse(user, pair, mfaVerified), nil
+}
+
+func (a *api) toAuthResponse(user auth.User, pair auth.TokenPair, mfaVerified bool) authResponse {
 	return authResponse{
 		AccessToken:      pair.AccessToken,
 		RefreshToken:     pair.RefreshToken,
 		AccessExpiresAt:  pair.AccessExpiresAt,
 		RefreshExpiresAt: pair.RefreshExpiresAt,
 		User:             toAuthUserDTO(user),
-	}, nil
+		MFAEnrollmentRequired: !mfaVerified && user.MFAEnabledAt == nil &&
+			a.authService.MFARequired(user.ID, user.Role),
+	}
 }
 
 func (a *api) handleAuthRegister(w http.ResponseWriter, r *http.Request) {
@@ -89,7 +108,16 @@ func (a *api) handleAuthRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := a.issueTokensForUser(user)
+	a.sendEmailVerification(r.Context(), user)
+	if a.accountEmails.requireVerified {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"user":                  toAuthUserDTO(user),
+			"verification_required": true,
+		})
+		return
+	}
+
+	response, err := a.issueTokensForUser(r, user, false)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "token issuance failed")
 		return
@@ -110,8 +138,16 @@ func (a *api) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "invalid email or password")
 		return
 	}
+	if a.accountEmails.requireVerified && user.EmailVerifiedAt == nil {
+		writeError(w, http.StatusForbidden, "email address is not verified")
+		return
+	}
+	if user.MFAEnabledAt != nil {
+		a.writeMFAChallenge(w, user)
+		return
+	}
 
-	response, err := a.issueTokensForUser(user)
+	response, err := a.issueTokensForUser(r, user, false)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "token issuance failed")
 		return
@@ -138,15 +174,6 @@ func (a *api) handleAuthRefresh(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "invalid refresh session")
 		return
 	}
-	if session.ExpiresAt.Before(time.Now().UTC()) {
-		a.authService.DeleteSession(session.ID)
-		writeError(w, http.StatusUnauthorized, "refresh session expired")
-		return
-	}
-	if session.RefreshTokenHash != auth.HashToken(req.RefreshToken) {
-		writeError(w, http.StatusUnauthorized, "invalid refresh token")
-		return
-	}
 
 	user, exists := a.authService.GetUserByID(claims.UserID)
 	if !exists {
@@ -154,15 +181,35 @@ func (a *api) handleAuthRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.authService.DeleteSession(session.ID)
-
-	response, err := a.issueTokensForUser(user)
+	pair, err := a.tokenManager.IssueTokenPair(user, session.ID, session.MFAVerified)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "token issuance failed")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, response)
+	_, err = a.authService.RotateSession(session.ID, auth.HashToken(strings.TrimSpace(req.RefreshToken)), auth.SessionRotation{
+		RefreshTokenHash: auth.HashToken(pair.RefreshToken),
+		ExpiresAt:        pair.RefreshExpiresAt,
+		IP:               requestIPKey(r),
+		UserAgent:        r.UserAgent(),
+	})
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		a.recordUserAuditLog(user, "auth_refresh_token_reused", map[string]string{
+			"session_id": session.ID,
+			"ip":         requestIPKey(r),
+		})
+		writeError(w, http.StatusUnauthorized, "refresh token reuse detected; session revoked")
+		return
+	case errors.Is(err, auth.ErrSessionExpired):
+		writeError(w, http.StatusUnauthorized, "refresh session expired")
+		return
+	case err != nil:
+		writeError(w, http.StatusUnauthorized, "invalid refresh session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.toAuthResponse(user, pair, session.MFAVerified))
 }
 
 func (a *api) handleAuthLogout(w http.ResponseWriter, r *http.Request) {
@@ -200,3 +247,10 @@ func (a *api) handleAuthMe(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, toAuthUserDTO(user))
 }
+
+// handleJWKS publishes the token verification keys for other services. It
+// lists retired keys too until they leave the configuration.
+func (a *api) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, a.tokenManager.JWKS())
+}
@@ -24,6 +24,10 @@ type cartUpdateItemRequest struct {
 	Qty int32 `json:"qty"`
 }
 
+type cartCurrencyRequest struct {
+	Currency string `json:"currency"`
+}
+
 type checkoutPlaceOrderRequest struct {
 	IdempotencyKey string `json:"idempotency_key"`
 }
@@ -80,7 +84,7 @@ func (a *api) handleCartAddItem(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	if product.StockQty <= 0 {
+	if product.StockQty <= 0 && product.BackorderLimit <= 0 && !product.Preorder {
 		writeError(w, http.StatusConflict, "product out of stock")
 		return
 	}
@@ -92,6 +96,9 @@ func (a *api) handleCartAddItem(w http.ResponseWriter, r *http.Request) {
 		Currency:              product.Currency,
 		UnitPriceInclTaxCents: product.PriceInclTaxCents,
 		StockQty:              product.StockQty,
+		BackorderLimit:        product.BackorderLimit,
+		Preorder:              product.Preorder,
+		ExpectedShipDate:      product.ExpectedShipDate,
 	}, req.Qty)
 	if err != nil {
 		a.writeCartError(w, err)
@@ -145,16 +152,41 @@ func (a *api) handleCartDeleteItem(w http.ResponseWriter, r *http.Request) {
 	writeBuyerResponse(w, http.StatusOK, cartResponse{Cart: cart, GuestToken: guestToken}, guestToken)
 }
 
+func (a *api) handleCartSetCurrency(w http.ResponseWriter, r *http.Request) {
+	actor, guestToken := checkoutActor(r)
+
+	var req cartCurrencyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Currency) == "" {
+		writeError(w, http.StatusBadRequest, "currency is required")
+		return
+	}
+
+	cart, err := a.commerce.SetCartCurrency(actor, req.Currency)
+	if err != nil {
+		a.writeCartError(w, err)
+		return
+	}
+
+	writeBuyerResponse(w, http.StatusOK, cartResponse{Cart: cart, GuestToken: guestToken}, guestToken)
+}
+
 func (a *api) handleCheckoutQuote(w http.ResponseWriter, r *http.Request) {
 	actor, guestToken := checkoutActor(r)
 
 	quote, err := a.commerce.Quote(actor)
 	if err != nil {
-		if errors.Is(err, commerce.ErrCartEmpty) {
+		switch {
+		case errors.Is(err, commerce.ErrCartEmpty):
 			writeError(w, http.StatusConflict, "cart is empty")
-			return
+		case errors.Is(err, commerce.ErrUnsupportedCurrency):
+			writeError(w, http.StatusConflict, "fx rate unavailable for cart currency")
+		default:
+			writeError(w, http.StatusBadRequest, "unable to prepare checkout quote")
 		}
-		writeError(w, http.StatusBadRequest, "unable to prepare checkout quote")
 		return
 	}
 
@@ -180,11 +212,14 @@ func (a *api) handleCheckoutPlaceOrder(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusConflict, "cart is empty")
 		case errors.Is(err, commerce.ErrIdempotencyKey):
 			writeError(w, http.StatusBadRequest, "idempotency key is required")
+		case errors.Is(err, commerce.ErrUnsupportedCurrency):
+			writeError(w, http.StatusConflict, "fx rate unavailable for cart currency")
 		default:
 			writeError(w, http.StatusBadRequest, "unable to place order")
 		}
 		return
 	}
+	a.cartRecovery.MarkRecovered(actor.BuyerUserID, order.ID)
 
 	writeBuyerResponse(w, http.StatusCreated, orderResponse{
 		Order:      order,
@@ -235,6 +270,8 @@ func (a *api) writeCartError(w http.ResponseWriter, err error) {
 		writeError(w, http.StatusConflict, "insufficient stock")
 	case errors.Is(err, commerce.ErrCurrencyMismatch):
 		writeError(w, http.StatusConflict, "currency mismatch")
+	case errors.Is(err, commerce.ErrUnsupportedCurrency):
+		writeError(w, http.StatusBadRequest, "currency is not supported")
 	case errors.Is(err, commerce.ErrInvalidQuantity), errors.Is(err, commerce.ErrInvalidProduct), errors.Is(err, commerce.ErrInvalidActor):
 		writeError(w, http.StatusBadRequest, "invalid cart request")
 	default:
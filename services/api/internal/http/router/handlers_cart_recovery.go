@@ -0,0 +1,59 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/cartrecovery"
+)
+
+// cartRecoveryCouponValidity bounds how long a recovery coupon stays redeemable.
+const cartRecoveryCouponValidity = 72 * time.Hour
+
+func (a *api) handleAdminCartRecoveryList(w http.ResponseWriter, r *http.Request) {
+	statusFilter := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("status")))
+	switch statusFilter {
+	case "", cartrecovery.StatusNotified, cartrecovery.StatusRecovered, cartrecovery.StatusExpired:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid cart recovery status filter")
+		return
+	}
+
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := a.cartRecovery.List(statusFilter)
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"metrics": a.cartRecovery.Metrics(),
+		"items":   items[start:end],
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+func (a *api) handleAdminCartRecoveryRun(w http.ResponseWriter, r *http.Request) {
+	result := a.cartRecovery.Run(r.Context())
+
+	a.recordAuditLog(
+		r,
+		"cart_recovery_run",
+		"job",
+		"cart_recovery",
+		nil,
+		result,
+		nil,
+	)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"result":  result,
+		"metrics": a.cartRecovery.Metrics(),
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
@@ -20,6 +21,9 @@ type vendorCreateProductRequest struct {
 	Description       string   `json:"description"`
 	PriceInclTaxCents int64    `json:"price_incl_tax_cents"`
 	Currency          string   `json:"currency"`
+	BackorderLimit    int32    `json:"backorder_limit"`
+	Preorder          bool     `json:"preorder"`
+	ExpectedShipDate  string   `json:"expected_ship_date"`
 }
 
 type vendorUpdateProductRequest struct {
@@ -30,6 +34,9 @@ type vendorUpdateProductRequest struct {
 	Description       *string   `json:"description"`
 	PriceInclTaxCents *int64    `json:"price_incl_tax_cents"`
 	Currency          *string   `json:"currency"`
+	BackorderLimit    *int32    `json:"backorder_limit"`
+	Preorder          *bool     `json:"preorder"`
+	ExpectedShipDate  *string   `json:"expected_ship_date"`
 }
 
 type adminModerationRequest struct {
@@ -38,23 +45,8 @@ type adminModerationRequest struct {
 }
 
 func (a *api) handleVendorCreateProduct(w http.ResponseWriter, r *http.Request) {
-	identity, ok := auth.IdentityFromContext(r.Context())
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
-		writeError(w, http.StatusUnauthorized, "authentication required")
-		return
-	}
-	if identity.VendorID == nil {
-		writeError(w, http.StatusBadRequest, "vendor profile required")
-		return
-	}
-
-	registeredVendor, exists := a.vendorService.GetByID(*identity.VendorID)
-	if !exists {
-		writeError(w, http.StatusNotFound, "vendor not found")
-		return
-	}
-	if registeredVendor.OwnerUserID != identity.UserID {
-		writeError(w, http.StatusForbidden, "forbidden")
 		return
 	}
 
@@ -71,9 +63,22 @@ func (a *api) handleVendorCreateProduct(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusBadRequest, "stock qty must be zero or positive")
 		return
 	}
+	if req.BackorderLimit < 0 {
+		writeError(w, http.StatusBadRequest, "backorder limit must be zero or positive")
+		return
+	}
+	expectedShipDate, err := parseExpectedShipDate(req.ExpectedShipDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected ship date must be an RFC3339 timestamp or YYYY-MM-DD date")
+		return
+	}
+	if req.Preorder && expectedShipDate == nil {
+		writeError(w, http.StatusBadRequest, "pre-order products require an expected ship date")
+		return
+	}
 
 	product := a.catalogService.CreateProductWithInput(catalog.CreateProductInput{
-		OwnerUserID:       identity.UserID,
+		OwnerUserID:       registeredVendor.OwnerUserID,
 		VendorID:          registeredVendor.ID,
 		Title:             req.Title,
 		Description:       req.Description,
@@ -82,6 +87,9 @@ func (a *api) handleVendorCreateProduct(w http.ResponseWriter, r *http.Request)
 		PriceInclTaxCents: req.PriceInclTaxCents,
 		Currency:          req.Currency,
 		StockQty:          req.StockQty,
+		BackorderLimit:    req.BackorderLimit,
+		Preorder:          req.Preorder,
+		ExpectedShipDate:  expectedShipDate,
 		Status:            catalog.ProductStatusDraft,
 	})
 
@@ -89,7 +97,7 @@ func (a *api) handleVendorCreateProduct(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *api) handleVendorListProducts(w http.ResponseWriter, r *http.Request) {
-	identity, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -99,7 +107,7 @@ func (a *api) handleVendorListProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	items := a.catalogService.ListVendorProducts(identity.UserID, registeredVendor.ID)
+	items := a.catalogService.ListVendorProducts(registeredVendor.OwnerUserID, registeredVendor.ID)
 	total := len(items)
 	start, end := paginate(total, limit, offset)
 	writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -111,7 +119,7 @@ func (a *api) handleVendorListProducts(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *api) handleVendorUpdateProduct(w http.ResponseWriter, r *http.Request) {
-	identity, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -133,12 +141,28 @@ func (a *api) handleVendorUpdateProduct(w http.ResponseWriter, r *http.Request)
 		req.Title == nil &&
 		req.Description == nil &&
 		req.PriceInclTaxCents == nil &&
-		req.Currency == nil {
+		req.Currency == nil &&
+		req.BackorderLimit == nil &&
+		req.Preorder == nil &&
+		req.ExpectedShipDate == nil {
 		writeError(w, http.StatusBadRequest, "at least one field is required")
 		return
 	}
+	var expectedShipDate *time.Time
+	if req.ExpectedShipDate != nil {
+		parsed, err := parseExpectedShipDate(*req.ExpectedShipDate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "expected ship date must be an RFC3339 timestamp or YYYY-MM-DD date")
+			return
+		}
+		// An empty string clears the date.
+		expectedShipDate = &time.Time{}
+		if parsed != nil {
+			expectedShipDate = parsed
+		}
+	}
 
-	updated, err := a.catalogService.UpdateProduct(productID, identity.UserID, registeredVendor.ID, catalog.UpdateProductInput{
+	updated, err := a.catalogService.UpdateProduct(productID, registeredVendor.OwnerUserID, registeredVendor.ID, catalog.UpdateProductInput{
 		CategorySlug:      req.CategorySlug,
 		Tags:              req.Tags,
 		StockQty:          req.StockQty,
@@ -146,6 +170,9 @@ func (a *api) handleVendorUpdateProduct(w http.ResponseWriter, r *http.Request)
 		Description:       req.Description,
 		PriceInclTaxCents: req.PriceInclTaxCents,
 		Currency:          req.Currency,
+		BackorderLimit:    req.BackorderLimit,
+		Preorder:          req.Preorder,
+		ExpectedShipDate:  expectedShipDate,
 	})
 	if err != nil {
 		switch {
@@ -165,7 +192,7 @@ func (a *api) handleVendorUpdateProduct(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *api) handleVendorDeleteProduct(w http.ResponseWriter, r *http.Request) {
-	identity, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -176,7 +203,7 @@ func (a *api) handleVendorDeleteProduct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := a.catalogService.DeleteProduct(productID, identity.UserID, registeredVendor.ID); err != nil {
+	if err := a.catalogService.DeleteProduct(productID, registeredVendor.OwnerUserID, registeredVendor.ID); err != nil {
 		switch {
 		case errors.Is(err, catalog.ErrProductNotFound):
 			writeError(w, http.StatusNotFound, "product not found")
@@ -192,7 +219,7 @@ func (a *api) handleVendorDeleteProduct(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *api) handleVendorSubmitModeration(w http.ResponseWriter, r *http.Request) {
-	identity, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -202,7 +229,7 @@ func (a *api) handleVendorSubmitModeration(w http.ResponseWriter, r *http.Reques
 	}
 
 	productID := chi.URLParam(r, "productID")
-	updatedProduct, err := a.catalogService.SubmitForModeration(productID, identity.UserID, registeredVendor.ID)
+	updatedProduct, err := a.catalogService.SubmitForModeration(productID, registeredVendor.OwnerUserID, registeredVendor.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, catalog.ErrProductNotFound):
@@ -220,7 +247,10 @@ func (a *api) handleVendorSubmitModeration(w http.ResponseWriter, r *http.Reques
 	writeJSON(w, http.StatusOK, updatedProduct)
 }
 
-func (a *api) vendorOwnerContext(w http.ResponseWriter, r *http.Request) (auth.Identity, vendors.Vendor, bool) {
+// vendorContext resolves the vendor of the signed-in team member. Members
+// act on the whole vendor; requirePermission already limited what their
+// role may do.
+func (a *api) vendorContext(w http.ResponseWriter, r *http.Request) (auth.Identity, vendors.Vendor, bool) {
 	identity, ok := auth.IdentityFromContext(r.Context())
 	if !ok {
 		writeError(w, http.StatusUnauthorized, "authentication required")
@@ -236,7 +266,7 @@ func (a *api) vendorOwnerContext(w http.ResponseWriter, r *http.Request) (auth.I
 		writeError(w, http.StatusNotFound, "vendor not found")
 		return auth.Identity{}, vendors.Vendor{}, false
 	}
-	if registeredVendor.OwnerUserID != identity.UserID {
+	if _, member := a.vendorService.Member(registeredVendor.ID, identity.UserID); !member {
 		writeError(w, http.StatusForbidden, "forbidden")
 		return auth.Identity{}, vendors.Vendor{}, false
 	}
@@ -371,6 +401,11 @@ func (a *api) handleCatalogList(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "min_rating must be between 0 and 5")
 		return
 	}
+	displayCurrency, err := a.displayCurrency(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "currency is not supported")
+		return
+	}
 
 	result := a.catalogService.Search(catalog.SearchParams{
 		Query:     query,
@@ -390,8 +425,13 @@ func (a *api) handleCatalogList(w http.ResponseWriter, r *http.Request) {
 		return registeredVendor.VerificationState == vendors.VerificationVerified
 	})
 
+	items := make([]catalogProductView, 0, len(result.Items))
+	for _, product := range result.Items {
+		items = append(items, a.catalogProductView(product, displayCurrency))
+	}
+
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"items":  result.Items,
+		"items":  items,
 		"total":  result.Total,
 		"limit":  limit,
 		"offset": offset,
@@ -400,6 +440,11 @@ func (a *api) handleCatalogList(w http.ResponseWriter, r *http.Request) {
 
 func (a *api) handleCatalogProductDetail(w http.ResponseWriter, r *http.Request) {
 	productID := chi.URLParam(r, "productID")
+	displayCurrency, err := a.displayCurrency(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "currency is not supported")
+		return
+	}
 	product, exists := a.catalogService.GetProductByID(productID)
 	if !exists || product.Status != catalog.ProductStatusApproved {
 		writeError(w, http.StatusNotFound, "product not found")
@@ -413,7 +458,7 @@ func (a *api) handleCatalogProductDetail(w http.ResponseWriter, r *http.Request)
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"item": product,
+		"item": a.catalogProductView(product, displayCurrency),
 		"vendor": map[string]string{
 			"id":          registeredVendor.ID,
 			"slug":        registeredVendor.Slug,
@@ -457,3 +502,21 @@ func parseQueryFloat64WithBounds(r *http.Request, key string, fallback, min, max
 	}
 	return value, nil
 }
+
+// parseExpectedShipDate accepts an RFC3339 timestamp or a calendar date. An
+// empty value returns nil.
+func parseExpectedShipDate(raw string) (*time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		parsed, err = time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	parsed = parsed.UTC()
+	return &parsed, nil
+}
@@ -0,0 +1,282 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/carriers"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
+)
+
+type vendorCODCollectionRequest struct {
+	Outcome     string `json:"outcome"`
+	AmountCents *int64 `json:"amount_cents"`
+}
+
+type adminCODRemittanceRequest struct {
+	Currency    string `json:"currency"`
+	AmountCents int64  `json:"amount_cents"`
+	Reference   string `json:"reference"`
+}
+
+type vendorCODCollectionResponse struct {
+	Shipment commerce.VendorShipment `json:"shipment"`
+	Payment  payments.CODPayment     `json:"payment"`
+}
+
+// handleVendorCODCollection lets a vendor who delivers its own parcels report
+// whether the buyer paid cash or refused the shipment. The cash collected is
+// always the shipment total, so the vendor cannot shrink the commission it
+// owes by reporting a smaller amount.
+func (a *api) handleVendorCODCollection(w http.ResponseWriter, r *http.Request) {
+	identity, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	shipmentID := strings.TrimSpace(chi.URLParam(r, "shipmentID"))
+	if shipmentID == "" {
+		writeError(w, http.StatusBadRequest, "shipment id is required")
+		return
+	}
+
+	var req vendorCODCollectionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	outcome := strings.ToLower(strings.TrimSpace(req.Outcome))
+	if outcome != payments.PaymentStatusCollected && outcome != payments.PaymentStatusRefused {
+		writeError(w, http.StatusBadRequest, "outcome must be collected or refused")
+		return
+	}
+
+	shipment, found, err := a.commerce.GetVendorShipment(registeredVendor.ID, shipmentID)
+	if err != nil || !found {
+		writeError(w, http.StatusNotFound, "shipment not found")
+		return
+	}
+	if _, isCOD := a.payments.GetCODPayment(shipment.OrderID); !isCOD {
+		writeError(w, http.StatusConflict, "order is not paid cash on delivery")
+		return
+	}
+	if outcome == payments.PaymentStatusCollected && req.AmountCents != nil && *req.AmountCents != shipment.TotalCents {
+		writeError(w, http.StatusBadRequest, "amount_cents must equal the shipment total")
+		return
+	}
+
+	if outcome == payments.PaymentStatusCollected {
+		shipment, err = a.commerce.UpdateVendorShipmentStatus(registeredVendor.ID, shipmentID, commerce.ShipmentStatusDelivered, identity.UserID)
+	} else {
+		shipment, err = a.commerce.RefuseShipmentDelivery(registeredVendor.ID, shipmentID, identity.UserID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, commerce.ErrShipmentNotFound), errors.Is(err, commerce.ErrShipmentForbidden):
+			writeError(w, http.StatusNotFound, "shipment not found")
+		case errors.Is(err, commerce.ErrShipmentTransition):
+			writeError(w, http.StatusConflict, "shipment must be shipped before cash is collected")
+		default:
+			writeError(w, http.StatusBadRequest, "unable to update shipment status")
+		}
+		return
+	}
+	if outcome == payments.PaymentStatusRefused {
+		a.settleShipmentPayment(r.Context(), shipment)
+	}
+
+	payment, err := a.recordCODOutcome(shipment, outcome, "vendor:"+identity.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrCODOutcomeConflict):
+			writeError(w, http.StatusConflict, "shipment already has a different cod outcome")
+		case errors.Is(err, payments.ErrInvalidCODOutcome):
+			writeError(w, http.StatusBadRequest, "invalid cod collection")
+		default:
+			writeError(w, http.StatusBadRequest, "unable to record cod collection")
+		}
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"cod_collection_recorded",
+		"shipment",
+		shipment.ID,
+		nil,
+		map[string]interface{}{"outcome": outcome, "amount_cents": shipment.TotalCents, "payment_status": payment.Status},
+		map[string]interface{}{"order_id": shipment.OrderID},
+	)
+
+	writeJSON(w, http.StatusOK, vendorCODCollectionResponse{Shipment: shipment, Payment: payment})
+}
+
+func (a *api) handleVendorCODBalance(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": a.payments.ListCODBalances(registeredVendor.ID),
+	})
+}
+
+func (a *api) handleAdminCODBalancesList(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := a.payments.ListCODBalances(r.URL.Query().Get("vendor_id"))
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (a *api) handleAdminCODRemittanceCreate(w http.ResponseWriter, r *http.Request) {
+	vendorID := strings.TrimSpace(chi.URLParam(r, "vendorID"))
+
+	var req adminCODRemittanceRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	balance, err := a.payments.RecordCODRemittance(vendorID, req.Currency, req.AmountCents, req.Reference)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrInvalidRemittance):
+			writeError(w, http.StatusBadRequest, "currency, positive amount_cents and reference are required")
+		case errors.Is(err, payments.ErrRemittanceExceedsOwed):
+			writeError(w, http.StatusConflict, "remittance exceeds the commission the vendor owes")
+		default:
+			writeError(w, http.StatusBadRequest, "unable to record remittance")
+		}
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"cod_remittance_recorded",
+		"vendor",
+		vendorID,
+		nil,
+		map[string]interface{}{"currency": balance.Currency, "amount_cents": req.AmountCents, "outstanding_cents": balance.OutstandingCents},
+		map[string]interface{}{"reference": strings.TrimSpace(req.Reference)},
+	)
+
+	writeJSON(w, http.StatusCreated, balance)
+}
+
+func (a *api) handleAdminCODBuyerFlagsList(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := a.payments.ListCODBuyerFlags()
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (a *api) handleAdminCODBuyerFlagClear(w http.ResponseWriter, r *http.Request) {
+	flag, err := a.payments.ClearCODBuyerFlag(chi.URLParam(r, "buyerRef"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "cod buyer flag not found")
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"cod_buyer_flag_cleared",
+		"buyer",
+		flag.BuyerRef,
+		flag,
+		nil,
+		nil,
+	)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyCarrierScan moves the shipment behind a carrier scan and settles COD
+// cash the courier reports collecting, or the buyer's refusal.
+func (a *api) applyCarrierScan(event carriers.ScanEvent) bool {
+	shipment, err := a.commerce.ApplyCarrierScan(commerce.ShipmentTracking{
+		CarrierCode:    event.CarrierCode,
+		TrackingNumber: event.TrackingNumber,
+	}, commerce.CarrierScan{
+		CarrierStatus: event.Status,
+		Delivered:     event.Status == carriers.ScanStatusDelivered,
+		Refused:       event.Status == carriers.ScanStatusRefused,
+		Location:      event.Location,
+		Description:   event.Description,
+		OccurredAt:    event.OccurredAt,
+	})
+	if err != nil {
+		return false
+	}
+
+	confirmedBy := "carrier:" + event.CarrierCode
+	switch {
+	case shipment.Status == commerce.ShipmentStatusDelivered && event.CODCollectedCents > 0:
+		_, _ = a.recordCODOutcome(shipment, payments.PaymentStatusCollected, confirmedBy)
+	case shipment.Status == commerce.ShipmentStatusCancelled && event.Status == carriers.ScanStatusRefused:
+		a.settleShipmentPayment(context.Background(), shipment)
+		_, _ = a.recordCODOutcome(shipment, payments.PaymentStatusRefused, confirmedBy)
+	}
+	return true
+}
+
+// recordCODOutcome records a COD shipment outcome with the commission the
+// vendor owes on the cash it now holds, which is the shipment total. The payment settles once none of the
+// order's other shipments is still on its way.
+func (a *api) recordCODOutcome(shipment commerce.VendorShipment, outcome string, confirmedBy string) (payments.CODPayment, error) {
+	input := payments.CODOutcomeInput{
+		OrderID:     shipment.OrderID,
+		ShipmentID:  shipment.ID,
+		VendorID:    shipment.VendorID,
+		Outcome:     outcome,
+		Final:       true,
+		ConfirmedBy: confirmedBy,
+	}
+	if outcome == payments.PaymentStatusCollected {
+		commissionBPS := a.defaultCommBPS
+		if vendor, exists := a.vendorService.GetByID(shipment.VendorID); exists {
+			commissionBPS = a.vendorCommissionBPS(vendor)
+		}
+		input.AmountCents = shipment.TotalCents
+		input.CommissionCents = shipment.TotalCents * int64(commissionBPS) / 10000
+	}
+	if order, found := a.commerce.GetOrderForAdmin(shipment.OrderID); found {
+		for _, candidate := range order.Shipments {
+			if candidate.ID == shipment.ID {
+				continue
+			}
+			switch candidate.Status {
+			case commerce.ShipmentStatusDelivered, commerce.ShipmentStatusCancelled:
+			default:
+				input.Final = false
+			}
+		}
+	}
+	return a.payments.RecordCODOutcome(input)
+}
@@ -0,0 +1,166 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+	"github.com/yxshee/marketplace-platform/services/api/internal/catalog"
+	"github.com/yxshee/marketplace-platform/services/api/internal/currency"
+)
+
+type adminFXRateUpsertRequest struct {
+	Rate string `json:"rate"`
+}
+
+type adminFXRatesResponse struct {
+	BaseCurrency      string          `json:"base_currency"`
+	ReportingCurrency string          `json:"reporting_currency"`
+	Items             []currency.Rate `json:"items"`
+}
+
+// catalogProductView adds display-currency pricing to a catalog product when
+// the buyer asks for a currency other than the product's own.
+type catalogProductView struct {
+	catalog.Product
+	DisplayPriceInclTaxCents int64  `json:"display_price_incl_tax_cents,omitempty"`
+	DisplayCurrency          string `json:"display_currency,omitempty"`
+	DisplayFXRate            string `json:"display_fx_rate,omitempty"`
+}
+
+func (a *api) handleCurrencyList(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"base_currency": a.currency.BaseCurrency(),
+		"items":         a.currency.SupportedCurrencies(),
+	})
+}
+
+func (a *api) handleAdminFXRatesList(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, adminFXRatesResponse{
+		BaseCurrency:      a.currency.BaseCurrency(),
+		ReportingCurrency: a.reportingCurrency,
+		Items:             a.currency.ListRates(),
+	})
+}
+
+func (a *api) handleAdminFXRateUpsert(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req adminFXRateUpsertRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	code := chi.URLParam(r, "currency")
+	var before interface{}
+	if previous, exists := a.findFXRate(code); exists {
+		before = previous
+	}
+	rate, err := a.currency.SetRate(code, req.Rate, identity.UserID)
+	if err != nil {
+		writeFXRateError(w, err)
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"fx_rate_updated",
+		"fx_rate",
+		rate.Currency,
+		before,
+		rate,
+		nil,
+	)
+
+	writeJSON(w, http.StatusOK, rate)
+}
+
+func (a *api) handleAdminFXRateDelete(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "currency")
+	previous, exists := a.findFXRate(code)
+	if err := a.currency.DeleteRate(code); err != nil {
+		writeFXRateError(w, err)
+		return
+	}
+	if exists {
+		a.recordAuditLog(
+			r,
+			"fx_rate_deleted",
+			"fx_rate",
+			previous.Currency,
+			previous,
+			nil,
+			nil,
+		)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) findFXRate(code string) (currency.Rate, bool) {
+	normalized, err := currency.NormalizeCode(code)
+	if err != nil {
+		return currency.Rate{}, false
+	}
+	for _, rate := range a.currency.ListRates() {
+		if rate.Currency == normalized {
+			return rate, true
+		}
+	}
+	return currency.Rate{}, false
+}
+
+func writeFXRateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, currency.ErrInvalidCurrency):
+		writeError(w, http.StatusBadRequest, "invalid currency code")
+	case errors.Is(err, currency.ErrInvalidRate):
+		writeError(w, http.StatusBadRequest, "rate must be a positive decimal")
+	case errors.Is(err, currency.ErrBaseCurrencyRate):
+		writeError(w, http.StatusConflict, "base currency rate cannot be changed")
+	case errors.Is(err, currency.ErrRateNotFound):
+		writeError(w, http.StatusNotFound, "fx rate not found")
+	default:
+		writeError(w, http.StatusBadRequest, "unable to update fx rate")
+	}
+}
+
+// displayCurrency reads the optional ?currency= catalog parameter. An empty
+// result means prices are returned in each product's own currency.
+func (a *api) displayCurrency(r *http.Request) (string, error) {
+	raw := strings.TrimSpace(r.URL.Query().Get("currency"))
+	if raw == "" {
+		return "", nil
+	}
+	normalized, err := currency.NormalizeCode(raw)
+	if err != nil {
+		return "", err
+	}
+	if !a.currency.IsSupported(normalized) {
+		return "", currency.ErrRateNotFound
+	}
+	return normalized, nil
+}
+
+func (a *api) catalogProductView(product catalog.Product, displayCurrency string) catalogProductView {
+	view := catalogProductView{Product: product}
+	if displayCurrency == "" {
+		return view
+	}
+
+	converted, rate, err := a.currency.Convert(product.PriceInclTaxCents, product.Currency, displayCurrency)
+	if err != nil {
+		return view
+	}
+	view.DisplayPriceInclTaxCents = converted
+	view.DisplayCurrency = displayCurrency
+	view.DisplayFXRate = rate
+	return view
+}
@@ -0,0 +1,211 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/disputes"
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
+)
+
+type vendorDisputeEvidenceRequest struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// recordStripeDispute applies a Stripe dispute event: the disputed amount is
+// split across the order's shipments and held from their vendor payouts
+// until the dispute closes. Shipments captured later get their hold when
+// their transfer is sent. Every event of an open dispute places the holds
+// again, so one that failed is retried by Stripe's redelivery. Vendors are
+// told when it opens and closes.
+func (a *api) recordStripeDispute(event payments.DisputeEvent) bool {
+	order, found := a.commerce.GetOrderForAdmin(event.OrderID)
+	if !found {
+		return false
+	}
+
+	result, err := a.disputes.Record(disputes.Update{
+		ProviderRef:   event.DisputeRef,
+		OrderID:       order.ID,
+		PaymentID:     event.PaymentID,
+		Reason:        event.Reason,
+		Status:        event.Status,
+		AmountCents:   event.AmountCents,
+		Currency:      event.Currency,
+		EvidenceDueBy: event.EvidenceDueBy,
+		Shipments:     disputes.AllocateShares(order, event.AmountCents),
+	})
+	if err != nil {
+		return false
+	}
+
+	ctx := context.Background()
+	dispute := result.Dispute
+	held := true
+	if dispute.ClosedAt == nil {
+		for _, share := range dispute.Shipments {
+			if _, err := a.payments.HoldShipmentPayout(ctx, payments.ShipmentRefundInput{
+				OrderID:     dispute.OrderID,
+				ShipmentID:  share.ShipmentID,
+				AmountCents: share.AmountCents,
+				Reference:   dispute.ID,
+			}); err != nil {
+				held = false
+			}
+		}
+	}
+	if result.Created {
+		a.notifyDisputeVendors(ctx, disputes.NotificationKindOpened, dispute)
+	}
+	if result.Closed {
+		released := dispute.Status != disputes.StatusLost
+		_, _ = a.payments.ClosePayoutHolds(ctx, dispute.OrderID, dispute.ID, released)
+		a.notifyDisputeVendors(ctx, disputes.NotificationKindClosed, dispute)
+	}
+	return held
+}
+
+func (a *api) notifyDisputeVendors(ctx context.Context, kind string, dispute disputes.Dispute) {
+	now := time.Now().UTC()
+	for _, share := range dispute.Shipments {
+		vendor, exists := a.vendorService.GetByID(share.VendorID)
+		if !exists {
+			continue
+		}
+		_ = a.notifications.Notify(ctx, disputes.VendorMessage(kind, dispute, share, vendor.OwnerUserID, now))
+	}
+}
+
+func (a *api) handleVendorListDisputes(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	statusFilter := strings.TrimSpace(r.URL.Query().Get("status"))
+	items, err := a.disputes.ListVendorDisputes(registeredVendor.ID, statusFilter)
+	if err != nil {
+		switch {
+		case errors.Is(err, disputes.ErrInvalidStatusFilter):
+			writeError(w, http.StatusBadRequest, "invalid dispute status filter")
+		default:
+			writeError(w, http.StatusBadRequest, "unable to list disputes")
+		}
+		return
+	}
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (a *api) handleVendorDisputeDetail(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	dispute, err := a.disputes.GetVendorDispute(registeredVendor.ID, chi.URLParam(r, "disputeID"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "dispute not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dispute)
+}
+
+// handleVendorSubmitDisputeEvidence records vendor evidence and stages the
+// combined evidence of every vendor on the Stripe dispute. A failed upload
+// is picked up by the next submission, which sends everything again.
+func (a *api) handleVendorSubmitDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	identity, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	disputeID := strings.TrimSpace(chi.URLParam(r, "disputeID"))
+	if disputeID == "" {
+		writeError(w, http.StatusBadRequest, "dispute id is required")
+		return
+	}
+
+	var req vendorDisputeEvidenceRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	updated, err := a.disputes.AddEvidence(registeredVendor.ID, disputeID, req.Kind, req.Text, identity.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, disputes.ErrDisputeNotFound), errors.Is(err, disputes.ErrDisputeForbidden):
+			writeError(w, http.StatusNotFound, "dispute not found")
+		case errors.Is(err, disputes.ErrInvalidEvidenceKind):
+			writeError(w, http.StatusBadRequest, "invalid evidence kind")
+		case errors.Is(err, disputes.ErrInvalidEvidenceText):
+			writeError(w, http.StatusBadRequest, "evidence text is required")
+		case errors.Is(err, disputes.ErrDisputeClosed):
+			writeError(w, http.StatusConflict, "dispute is closed")
+		default:
+			writeError(w, http.StatusBadRequest, "unable to submit dispute evidence")
+		}
+		return
+	}
+
+	evidence := updated.Evidence[len(updated.Evidence)-1]
+	_ = a.payments.UpdateDisputeEvidence(r.Context(), updated.ProviderRef, updated.EvidenceText(), "evidence_"+evidence.ID)
+	a.recordAuditLog(
+		r,
+		"vendor_dispute_evidence_submitted",
+		"dispute",
+		updated.ID,
+		nil,
+		evidence,
+		map[string]interface{}{"vendor_id": registeredVendor.ID},
+	)
+
+	scoped, err := a.disputes.GetVendorDispute(registeredVendor.ID, updated.ID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "dispute not found")
+		return
+	}
+	writeJSON(w, http.StatusCreated, scoped)
+}
+
+func (a *api) handleAdminDisputesList(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, err := a.disputes.List(strings.TrimSpace(r.URL.Query().Get("status")))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid dispute status filter")
+		return
+	}
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
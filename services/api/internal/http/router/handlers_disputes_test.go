@@ -0,0 +1,123 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDisputeHoldsShipmentCapturedAfterItOpened(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_dispute_later"
+	r := mustRouterWithConfig(t, cfg)
+
+	firstToken, firstProductID := createApprovedVendorProduct(t, r, "vendor-dispute-first@example.com", "vendor-dispute-first", 3000, 5)
+	laterToken, laterProductID := createApprovedVendorProduct(t, r, "vendor-dispute-later@example.com", "vendor-dispute-later", 2000, 5)
+	for _, token := range []string{firstToken, laterToken} {
+		onboardingRes := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/connect/onboarding", map[string]string{
+			"refresh_url": "https://vendor.example.com/payouts/refresh",
+			"return_url":  "https://vendor.example.com/payouts/done",
+		}, token)
+		if onboardingRes.Code != http.StatusCreated {
+			t.Fatalf("connect onboarding status=%d body=%s", onboardingRes.Code, onboardingRes.Body.String())
+		}
+		_ = requestJSON(t, r, http.MethodGet, "/api/v1/vendor/connect", nil, token)
+	}
+
+	guestHeaders := map[string]string{guestTokenHeader: "gst_dispute_later"}
+	for _, productID := range []string{firstProductID, laterProductID} {
+		addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        1,
+		}, "", guestHeaders)
+		if addRes.Code != http.StatusOK {
+			t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "dispute-later-order",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID         string `json:"id"`
+			TotalCents int64  `json:"total_cents"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	intentRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "dispute-later-intent",
+	}, "", guestHeaders)
+	if intentRes.Code != http.StatusCreated {
+		t.Fatalf("create stripe intent status=%d body=%s", intentRes.Code, intentRes.Body.String())
+	}
+	var intentPayload struct {
+		ProviderRef string `json:"provider_ref"`
+	}
+	if err := json.Unmarshal(intentRes.Body.Bytes(), &intentPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	postWebhook := func(body []byte, signature string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(body))
+		req.Header.Set(stripeSignatureHeader, signature)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("webhook status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+	postWebhook(signedStripeWebhook(t, cfg.StripeWebhookSecret, "evt_dispute_later_auth", "payment_intent.amount_capturable_updated", intentPayload.ProviderRef))
+
+	ship := func(token string) int64 {
+		t.Helper()
+		res := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, token)
+		var payload struct {
+			Items []struct {
+				ID         string `json:"id"`
+				TotalCents int64  `json:"total_cents"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil || len(payload.Items) != 1 {
+			t.Fatalf("expected one vendor shipment, status=%d body=%s", res.Code, res.Body.String())
+		}
+		if shipRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+payload.Items[0].ID+"/status", map[string]string{"status": "shipped"}, token); shipRes.Code != http.StatusOK {
+			t.Fatalf("ship status=%d body=%s", shipRes.Code, shipRes.Body.String())
+		}
+		return payload.Items[0].TotalCents
+	}
+	heldCents := func(token string) int64 {
+		t.Helper()
+		res := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/payouts", nil, token)
+		var payload struct {
+			Items []struct {
+				HeldCents int64 `json:"held_cents"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil || len(payload.Items) != 1 {
+			t.Fatalf("list payouts status=%d body=%s", res.Code, res.Body.String())
+		}
+		return payload.Items[0].HeldCents
+	}
+
+	firstTotal := ship(firstToken)
+	postWebhook(signedStripeDisputeWebhook(t, cfg.StripeWebhookSecret, "evt_dispute_later_created", "charge.dispute.created", "dp_router_later", intentPayload.ProviderRef, orderPayload.Order.TotalCents, "needs_response"))
+	laterTotal := ship(laterToken)
+
+	for _, vendor := range []struct {
+		token string
+		total int64
+	}{{firstToken, firstTotal}, {laterToken, laterTotal}} {
+		share := vendor.total - vendor.total*int64(cfg.DefaultCommission)/10000
+		if got := heldCents(vendor.token); got != share {
+			t.Fatalf("expected vendor share %d held, got %d", share, got)
+		}
+	}
+}
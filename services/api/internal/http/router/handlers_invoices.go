@@ -1,34 +1,260 @@
 package router
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
 	"github.com/yxshee/marketplace-platform/services/api/internal/invoices"
+	"github.com/yxshee/marketplace-platform/services/api/internal/vendors"
 )
 
+// maxInvoiceArchiveDays bounds a single archive download.
+const maxInvoiceArchiveDays = 366
+
+type vendorLegalDetailsRequest struct {
+	LegalName     string `json:"legal_name"`
+	TaxID         string `json:"tax_id"`
+	Address       string `json:"address"`
+	Email         string `json:"email"`
+	CountryCode   string `json:"country_code"`
+	InvoiceLocale string `json:"invoice_locale"`
+	InvoiceFooter string `json:"invoice_footer"`
+}
+
+// handleInvoiceList returns the invoices and credit notes the order's vendors
+// issued to the buyer.
+func (a *api) handleInvoiceList(w http.ResponseWriter, r *http.Request) {
+	documents, guestToken, ok := a.buyerInvoiceDocuments(w, r)
+	if !ok {
+		return
+	}
+
+	writeBuyerResponse(w, http.StatusOK, map[string]interface{}{
+		"items": documents,
+	}, guestToken)
+}
+
+// handleInvoiceDownload serves one of the buyer's documents for an order as
+// PDF or UBL. The invoice_id query parameter picks the document; without it
+// the order's only invoice is served.
 func (a *api) handleInvoiceDownload(w http.ResponseWriter, r *http.Request) {
+	documents, guestToken, ok := a.buyerInvoiceDocuments(w, r)
+	if !ok {
+		return
+	}
+
+	invoiceID := strings.TrimSpace(r.URL.Query().Get("invoice_id"))
+	var selected []invoices.Invoice
+	for _, document := range documents {
+		if invoiceID == "" && document.Kind == invoices.KindInvoice || invoiceID != "" && document.ID == invoiceID {
+			selected = append(selected, document)
+		}
+	}
+	switch {
+	case len(selected) == 0:
+		writeError(w, http.StatusNotFound, "invoice not found")
+		return
+	case len(selected) > 1:
+		writeError(w, http.StatusBadRequest, "invoice_id is required when the order has several invoices")
+		return
+	}
+
+	if guestToken != "" {
+		w.Header().Set(guestTokenHeader, guestToken)
+	}
+	a.writeInvoiceDocument(w, r, selected[0])
+}
+
+func (a *api) handleVendorLegalDetailsUpdate(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	var req vendorLegalDetailsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	locale, err := invoices.NormalizeLocale(req.InvoiceLocale)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invoice_locale must be one of "+strings.Join(invoices.SupportedLocales(), ", "))
+		return
+	}
+	footer, err := invoices.NormalizeFooter(req.InvoiceFooter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invoice_footer must be at most 500 characters")
+		return
+	}
+
+	updated, err := a.vendorService.SetLegalDetails(registeredVendor.ID, vendors.LegalDetails{
+		LegalName:     req.LegalName,
+		TaxID:         req.TaxID,
+		Address:       req.Address,
+		Email:         req.Email,
+		CountryCode:   req.CountryCode,
+		InvoiceLocale: locale,
+		InvoiceFooter: footer,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, vendors.ErrInvalidLegal):
+			writeError(w, http.StatusBadRequest, "legal_name and address are required and country_code must be a two-letter ISO code")
+		default:
+			writeError(w, http.StatusNotFound, "vendor not found")
+		}
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"vendor_legal_details_updated",
+		"vendor",
+		updated.ID,
+		registeredVendor.LegalDetails,
+		updated.LegalDetails,
+		nil,
+	)
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// handleVendorInvoiceList returns the invoices and credit notes the vendor
+// issued, and the commission invoices the platform issued to it.
+func (a *api) handleVendorInvoiceList(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+	a.writeInvoicePage(w, r, registeredVendor.ID)
+}
+
+func (a *api) handleVendorInvoiceDownload(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	invoice, found := a.invoices.Get(chi.URLParam(r, "invoiceID"))
+	if !found || invoice.VendorID != registeredVendor.ID {
+		writeError(w, http.StatusNotFound, "invoice not found")
+		return
+	}
+	a.writeInvoiceDocument(w, r, invoice)
+}
+
+func (a *api) handleAdminInvoiceList(w http.ResponseWriter, r *http.Request) {
+	a.writeInvoicePage(w, r, r.URL.Query().Get("vendor_id"))
+}
+
+func (a *api) handleAdminInvoiceDownload(w http.ResponseWriter, r *http.Request) {
+	invoice, found := a.invoices.Get(chi.URLParam(r, "invoiceID"))
+	if !found {
+		writeError(w, http.StatusNotFound, "invoice not found")
+		return
+	}
+	a.writeInvoiceDocument(w, r, invoice)
+}
+
+// handleAdminInvoiceArchive serves a ZIP of the documents issued between the
+// from and to dates (inclusive, UTC) with a manifest of their hashes.
+func (a *api) handleAdminInvoiceArchive(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, fromErr := time.Parse(time.DateOnly, strings.TrimSpace(query.Get("from")))
+	to, toErr := time.Parse(time.DateOnly, strings.TrimSpace(query.Get("to")))
+	if fromErr != nil || toErr != nil {
+		writeError(w, http.StatusBadRequest, "from and to must be dates (YYYY-MM-DD)")
+		return
+	}
+	to = to.AddDate(0, 0, 1)
+	if !from.Before(to) || to.After(from.AddDate(0, 0, maxInvoiceArchiveDays)) {
+		writeError(w, http.StatusBadRequest, "from must not be after to and the range must not exceed 366 days")
+		return
+	}
+
+	kind := strings.TrimSpace(query.Get("kind"))
+	switch kind {
+	case "", invoices.KindInvoice, invoices.KindCommissionInvoice, invoices.KindCreditNote:
+	default:
+		writeError(w, http.StatusBadRequest, "kind must be invoice, commission_invoice or credit_note")
+		return
+	}
+
+	var archive bytes.Buffer
+	if _, err := a.invoices.WriteArchive(r.Context(), &archive, invoices.ArchiveFilter{
+		From:     from,
+		To:       to,
+		Kind:     kind,
+		VendorID: strings.TrimSpace(query.Get("vendor_id")),
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "unable to build invoice archive")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=invoices-"+from.Format(time.DateOnly)+"-"+to.AddDate(0, 0, -1).Format(time.DateOnly)+".zip")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(archive.Len()))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(archive.Bytes())
+}
+
+func (a *api) writeInvoicePage(w http.ResponseWriter, r *http.Request, vendorID string) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	kind := strings.TrimSpace(r.URL.Query().Get("kind"))
+	switch kind {
+	case "", invoices.KindInvoice, invoices.KindCommissionInvoice, invoices.KindCreditNote:
+	default:
+		writeError(w, http.StatusBadRequest, "kind must be invoice, commission_invoice or credit_note")
+		return
+	}
+
+	items := a.invoices.List(kind, vendorID)
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// buyerInvoiceDocuments resolves the buyer's order and issues any invoice it
+// is still missing. Commission invoices are between the platform and its
+// vendors and are left out.
+func (a *api) buyerInvoiceDocuments(w http.ResponseWriter, r *http.Request) ([]invoices.Invoice, string, bool) {
 	actor, guestToken := checkoutActor(r)
 	orderID := strings.TrimSpace(chi.URLParam(r, "orderID"))
 	if orderID == "" {
 		writeError(w, http.StatusBadRequest, "order id is required")
-		return
+		return nil, "", false
 	}
 
 	order, found, err := a.commerce.GetOrder(actor, orderID)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "unable to resolve order actor")
-		return
+		return nil, "", false
 	}
 	if !found {
 		writeError(w, http.StatusNotFound, "order not found")
-		return
+		return nil, "", false
 	}
 
-	invoice, err := a.invoices.GenerateForOrder(order)
+	issued, err := a.invoices.GenerateForOrder(r.Context(), order, a.invoiceBuyerParty(order))
 	if err != nil {
 		switch {
 		case errors.Is(err, invoices.ErrOrderNotInvoiceable):
@@ -36,16 +262,88 @@ func (a *api) handleInvoiceDownload(w http.ResponseWriter, r *http.Request) {
 		default:
 			writeError(w, http.StatusInternalServerError, "unable to generate invoice")
 		}
+		return nil, "", false
+	}
+
+	documents := make([]invoices.Invoice, 0, len(issued))
+	for _, document := range issued {
+		if document.Kind != invoices.KindCommissionInvoice {
+			documents = append(documents, document)
+		}
+	}
+	return documents, guestToken, true
+}
+
+// issueOrderInvoices issues an order's invoices as soon as its payment is
+// confirmed, so document numbers follow the order in which payments settle.
+func (a *api) issueOrderInvoices(ctx context.Context, orderID string) {
+	order, found := a.commerce.GetOrderForAdmin(orderID)
+	if !found {
 		return
 	}
+	_, _ = a.invoices.GenerateForOrder(ctx, order, a.invoiceBuyerParty(order))
+}
 
-	if guestToken != "" {
-		w.Header().Set(guestTokenHeader, guestToken)
+func (a *api) invoiceBuyerParty(order commerce.Order) invoices.Party {
+	if order.BuyerUserID == "" {
+		return invoices.Party{ID: "guest", Name: "Guest buyer"}
+	}
+	party := invoices.Party{ID: order.BuyerUserID, Name: order.BuyerUserID}
+	if user, found := a.authService.GetUserByID(order.BuyerUserID); found {
+		party.Name = user.Email
+		party.Email = user.Email
+	}
+	return party
+}
+
+func (a *api) invoiceVendorDetails(vendorID string) (invoices.VendorDetails, bool) {
+	vendor, found := a.vendorService.GetByID(vendorID)
+	if !found {
+		return invoices.VendorDetails{}, false
+	}
+
+	details := invoices.VendorDetails{
+		Party:         invoices.Party{ID: vendor.ID, Name: vendor.DisplayName},
+		Code:          vendor.Slug,
+		CommissionBPS: a.vendorCommissionBPS(vendor),
+	}
+	if vendor.LegalDetails != nil {
+		details.LegalName = vendor.LegalDetails.LegalName
+		details.TaxID = vendor.LegalDetails.TaxID
+		details.Address = vendor.LegalDetails.Address
+		details.Email = vendor.LegalDetails.Email
+		details.CountryCode = vendor.LegalDetails.CountryCode
+		details.Locale = vendor.LegalDetails.InvoiceLocale
+		details.Footer = vendor.LegalDetails.InvoiceFooter
+	}
+	return details, true
+}
+
+// writeInvoiceDocument serves a document in the format named by the format
+// query parameter: pdf (the default) or ubl. PDFs are the stored bytes and
+// carry their SHA-256 as ETag and X-Content-SHA256.
+func (a *api) writeInvoiceDocument(w http.ResponseWriter, r *http.Request, invoice invoices.Invoice) {
+	document, err := a.invoices.Export(r.Context(), invoice, r.URL.Query().Get("format"))
+	if err != nil {
+		switch {
+		case errors.Is(err, invoices.ErrUnsupportedFormat):
+			writeError(w, http.StatusBadRequest, "format must be pdf or ubl")
+		case errors.Is(err, invoices.ErrDocumentPurged):
+			writeError(w, http.StatusGone, "invoice document was purged after its retention period")
+		default:
+			writeError(w, http.StatusInternalServerError, "unable to render invoice")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", document.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+document.FileName)
+	if document.Format == invoices.FormatPDF {
+		w.Header().Set("ETag", `"`+invoice.ContentSHA256+`"`)
+		w.Header().Set("X-Content-SHA256", invoice.ContentSHA256)
 	}
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", "attachment; filename="+invoice.FileName)
 	w.Header().Set("Cache-Control", "no-store")
-	w.Header().Set("Content-Length", strconv.Itoa(len(invoice.Content)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(document.Content)))
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(invoice.Content)
+	_, _ = w.Write(document.Content)
 }
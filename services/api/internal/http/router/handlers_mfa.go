@@ -0,0 +1,264 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+)
+
+// mfaSettings configure TOTP enrolment and the login challenge.
+type mfaSettings struct {
+	// issuer is the account label shown in authenticator apps.
+	issuer       string
+	challengeTTL time.Duration
+}
+
+type mfaChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"mfa_expires_at"`
+}
+
+type mfaVerifyRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type mfaStatusResponse struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	Required               bool       `json:"required"`
+	SessionVerified        bool       `json:"session_verified"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+type mfaEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type mfaEnrollConfirmResponse struct {
+	authResponse
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type mfaPolicyRequest struct {
+	RequiredRoles []auth.Role `json:"required_roles"`
+}
+
+type mfaPolicyResponse struct {
+	RequiredRoles []auth.Role `json:"required_roles"`
+}
+
+// writeMFAChallenge answers the password step of a login for users with MFA.
+// The challenge token only unlocks POST /auth/mfa/verify.
+func (a *api) writeMFAChallenge(w http.ResponseWriter, user auth.User) {
+	token, expiresAt, err := a.tokenManager.IssueMFAChallenge(user, a.mfa.challengeTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "token issuance failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, mfaChallengeResponse{MFARequired: true, MFAToken: token, ExpiresAt: expiresAt})
+}
+
+func (a *api) handleMFAVerify(w http.ResponseWriter, r *http.Request) {
+	var req mfaVerifyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, err := a.tokenManager.ParseAndValidate(strings.TrimSpace(req.MFAToken), auth.TokenTypeMFAChallenge)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid mfa token")
+		return
+	}
+	user, usedRecoveryCode, err := a.authService.VerifyMFA(claims.UserID, req.Code)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid mfa code")
+		return
+	}
+
+	if usedRecoveryCode {
+		a.recordUserAuditLog(user, "auth_mfa_recovery_code_used", map[string]int{"recovery_codes_remaining": a.authService.RemainingRecoveryCodes(user.ID)})
+	}
+
+	response, err := a.issueTokensForUser(r, user, true)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "token issuance failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) handleMFAStatus(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	user, exists := a.authService.GetUserByID(identity.UserID)
+	if !exists {
+		writeError(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaStatusResponse{
+		Enabled:                user.MFAEnabledAt != nil,
+		EnabledAt:              user.MFAEnabledAt,
+		Required:               a.authService.MFARequired(user.ID, user.Role),
+		SessionVerified:        identity.MFAVerified,
+		RecoveryCodesRemaining: a.authService.RemainingRecoveryCodes(user.ID),
+	})
+}
+
+// handleMFAEnroll starts TOTP enrolment. The secret is shown once, as text
+// and as an otpauth:// URI for the QR code.
+func (a *api) handleMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	enrollment, err := a.authService.BeginMFAEnrollment(identity.UserID, a.mfa.issuer)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, mfaEnrollResponse{Secret: enrollment.Secret, ProvisioningURI: enrollment.ProvisioningURI})
+}
+
+// handleMFAEnrollConfirm enables MFA and swaps the current session for one
+// that passed MFA, since the user just proved the second factor.
+func (a *api) handleMFAEnrollConfirm(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	var req mfaCodeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, recoveryCodes, err := a.authService.ConfirmMFAEnrollment(identity.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	a.authService.DeleteSession(identity.SessionID)
+	response, err := a.issueTokensForUser(r, user, true)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "token issuance failed")
+		return
+	}
+
+	a.recordAuditLog(r, "auth_mfa_enabled", "user", user.ID, nil, map[string]interface{}{"mfa_enabled": true}, nil)
+	writeJSON(w, http.StatusOK, mfaEnrollConfirmResponse{authResponse: response, RecoveryCodes: recoveryCodes})
+}
+
+func (a *api) handleMFADisable(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	var req mfaCodeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := a.authService.DisableMFA(identity.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	a.recordAuditLog(r, "auth_mfa_disabled", "user", user.ID, map[string]interface{}{"mfa_enabled": true}, map[string]interface{}{"mfa_enabled": false}, nil)
+	writeJSON(w, http.StatusOK, toAuthUserDTO(user))
+}
+
+func (a *api) handleMFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	var req mfaCodeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	recoveryCodes, err := a.authService.RegenerateRecoveryCodes(identity.UserID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	a.recordAuditLog(r, "auth_mfa_recovery_codes_regenerated", "user", identity.UserID, nil, nil, map[string]int{"recovery_codes": len(recoveryCodes)})
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": recoveryCodes})
+}
+
+func (a *api) handleAdminMFAPolicyGet(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, mfaPolicyResponse{RequiredRoles: a.authService.MFARequiredRoles()})
+}
+
+func (a *api) handleAdminMFAPolicyPut(w http.ResponseWriter, r *http.Request) {
+	var req mfaPolicyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	previous := mfaPolicyResponse{RequiredRoles: a.authService.MFARequiredRoles()}
+	if err := a.authService.SetMFARequiredRoles(req.RequiredRoles); err != nil {
+		writeError(w, http.StatusBadRequest, "unknown role in required_roles")
+		return
+	}
+	policy := mfaPolicyResponse{RequiredRoles: a.authService.MFARequiredRoles()}
+
+	a.recordAuditLog(r, "mfa_policy_updated", "security_settings", "mfa_policy", previous, policy, nil)
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		writeError(w, http.StatusConflict, "mfa already enabled")
+	case errors.Is(err, auth.ErrMFANotEnabled):
+		writeError(w, http.StatusConflict, "mfa not enabled")
+	case errors.Is(err, auth.ErrMFANotEnrolling):
+		writeError(w, http.StatusConflict, "mfa enrolment not started")
+	case errors.Is(err, auth.ErrMFARequiredForRole):
+		writeError(w, http.StatusConflict, "mfa is required for your role")
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		writeError(w, http.StatusBadRequest, "invalid mfa code")
+	case errors.Is(err, auth.ErrUserNotFound):
+		writeError(w, http.StatusUnauthorized, "user not found")
+	default:
+		writeError(w, http.StatusInternalServerError, "mfa update failed")
+	}
+}
+
+// parseRoleList reads a comma-separated role list such as
+// API_MFA_REQUIRED_ROLES. Unknown roles are rejected by the auth service.
+func parseRoleList(value string) []auth.Role {
+	var roles []auth.Role
+	for _, raw := range strings.Split(value, ",") {
+		if role := strings.ToLower(strings.TrimSpace(raw)); role != "" {
+			roles = append(roles, auth.Role(role))
+		}
+	}
+	return roles
+}
@@ -0,0 +1,216 @@
+package router
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+	"github.com/yxshee/marketplace-platform/services/api/internal/oidc"
+)
+
+// oidcStateCookie binds a flow's state to the browser that started it, so a
+// state handed to someone else cannot complete the flow in their browser.
+const oidcStateCookie = "oidc_state"
+
+type oidcCallbackRequest struct {
+	State string `json:"state"`
+	Code  string `json:"code"`
+}
+
+type identitiesResponse struct {
+	Identities  []auth.ExternalIdentity `json:"identities"`
+	HasPassword bool                    `json:"has_password"`
+}
+
+func toIdentitiesResponse(user auth.User) identitiesResponse {
+	identities := user.ExternalIdentities
+	if identities == nil {
+		identities = []auth.ExternalIdentity{}
+	}
+	return identitiesResponse{Identities: identities, HasPassword: user.PasswordHash != ""}
+}
+
+func (a *api) handleOIDCProviders(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]string{"providers": a.oidc.Providers()})
+}
+
+// handleOIDCAuthorize starts a sign-in. The web app sends the browser to the
+// returned URL and posts the code and state it gets back to the callback from
+// the same browser, which carries the state cookie set here.
+func (a *api) handleOIDCAuthorize(w http.ResponseWriter, r *http.Request) {
+	authorization, err := a.oidc.Begin(r.Context(), chi.URLParam(r, "provider"), "")
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	a.setOIDCStateCookie(w, authorization)
+	writeJSON(w, http.StatusOK, authorization)
+}
+
+// handleOIDCCallback completes a flow. Sign-in flows answer like
+// POST /auth/login; flows started from POST /auth/identities/{provider} link
+// the identity to the user who started them.
+func (a *api) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	var req oidcCallbackRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || req.State == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		writeOIDCError(w, oidc.ErrInvalidState)
+		return
+	}
+	a.clearOIDCStateCookie(w)
+
+	result, err := a.oidc.Complete(r.Context(), chi.URLParam(r, "provider"), req.State, req.Code)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	identity := auth.ExternalIdentity{Provider: result.Provider, Subject: result.Claims.Subject, Email: result.Claims.Email}
+
+	if result.LinkUserID != "" {
+		user, err := a.authService.LinkExternalIdentity(result.LinkUserID, identity)
+		if err != nil {
+			writeIdentityError(w, err)
+			return
+		}
+		a.recordUserAuditLog(user, "auth_identity_linked", map[string]string{"provider": identity.Provider, "via": "link"})
+		writeJSON(w, http.StatusOK, toIdentitiesResponse(user))
+		return
+	}
+
+	user, linked, created, err := a.authService.SignInWithExternalIdentity(identity, result.Claims.EmailVerified)
+	if err != nil {
+		writeIdentityError(w, err)
+		return
+	}
+	if linked {
+		via := "verified_email"
+		if created {
+			via = "sign_up"
+		}
+		a.recordUserAuditLog(user, "auth_identity_linked", map[string]string{"provider": identity.Provider, "via": via})
+	}
+	if user.MFAEnabledAt != nil {
+		a.writeMFAChallenge(w, user)
+		return
+	}
+
+	response, err := a.issueTokensForUser(r, user, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "token issuance failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) handleIdentitiesList(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	user, exists := a.authService.GetUserByID(identity.UserID)
+	if !exists {
+		writeError(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, toIdentitiesResponse(user))
+}
+
+func (a *api) handleIdentityLinkStart(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	authorization, err := a.oidc.Begin(r.Context(), chi.URLParam(r, "provider"), identity.UserID)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	a.setOIDCStateCookie(w, authorization)
+	writeJSON(w, http.StatusOK, authorization)
+}
+
+func (a *api) handleIdentityUnlink(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	provider := strings.ToLower(strings.TrimSpace(chi.URLParam(r, "provider")))
+	user, removed, err := a.authService.UnlinkExternalIdentity(identity.UserID, provider)
+	if err != nil {
+		writeIdentityError(w, err)
+		return
+	}
+
+	a.recordAuditLog(r, "auth_identity_unlinked", "user", user.ID, removed, nil, map[string]string{"provider": provider})
+	writeJSON(w, http.StatusOK, toIdentitiesResponse(user))
+}
+
+func (a *api) setOIDCStateCookie(w http.ResponseWriter, authorization oidc.Authorization) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    authorization.State,
+		Path:     "/api/v1/auth/oidc",
+		Expires:  authorization.ExpiresAt,
+		MaxAge:   int(time.Until(authorization.ExpiresAt).Seconds()),
+		HttpOnly: true,
+		Secure:   a.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *api) clearOIDCStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   a.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func writeOIDCError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, oidc.ErrUnknownProvider):
+		writeError(w, http.StatusNotFound, "unknown identity provider")
+	case errors.Is(err, oidc.ErrInvalidState):
+		writeError(w, http.StatusBadRequest, "sign-in state is invalid or expired")
+	case errors.Is(err, oidc.ErrDiscovery):
+		writeError(w, http.StatusBadGateway, "identity provider unavailable")
+	default:
+		writeError(w, http.StatusUnauthorized, "identity provider sign-in failed")
+	}
+}
+
+func writeIdentityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		writeError(w, http.StatusForbidden, "identity provider did not verify the email address")
+	case errors.Is(err, auth.ErrLinkRequiresSignIn):
+		writeError(w, http.StatusConflict, "an account with this email exists; sign in and link the identity from your account")
+	case errors.Is(err, auth.ErrIdentityAlreadyLinked):
+		writeError(w, http.StatusConflict, "identity already linked")
+	case errors.Is(err, auth.ErrIdentityNotLinked):
+		writeError(w, http.StatusNotFound, "identity not linked")
+	case errors.Is(err, auth.ErrLastSignInMethod):
+		writeError(w, http.StatusConflict, "set a password or link another identity first")
+	case errors.Is(err, auth.ErrUserNotFound):
+		writeError(w, http.StatusUnauthorized, "user not found")
+	default:
+		writeError(w, http.StatusInternalServerError, "identity update failed")
+	}
+}
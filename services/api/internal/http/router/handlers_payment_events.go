@@ -0,0 +1,81 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
+)
+
+func (a *api) handleAdminWebhookEventsList(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, err := a.payments.ListWebhookEvents(payments.WebhookEventFilter{
+		Status:   r.URL.Query().Get("status"),
+		Provider: r.URL.Query().Get("provider"),
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook event status filter")
+		return
+	}
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (a *api) handleAdminWebhookEventDetail(w http.ResponseWriter, r *http.Request) {
+	event, exists := a.payments.GetWebhookEvent(strings.TrimSpace(chi.URLParam(r, "eventID")))
+	if !exists {
+		writeError(w, http.StatusNotFound, "webhook event not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, event)
+}
+
+// handleAdminWebhookEventReplay processes a stored event again. The response
+// carries the event's new status; a failed replay is not an HTTP error.
+func (a *api) handleAdminWebhookEventReplay(w http.ResponseWriter, r *http.Request) {
+	eventID := strings.TrimSpace(chi.URLParam(r, "eventID"))
+	before, exists := a.payments.GetWebhookEvent(eventID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "webhook event not found")
+		return
+	}
+
+	replayed, err := a.payments.ReplayWebhookEvent(eventID)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrWebhookEventNotFound):
+			writeError(w, http.StatusNotFound, "webhook event not found")
+		case errors.Is(err, payments.ErrWebhookEventInFlight):
+			writeError(w, http.StatusConflict, "webhook event is being processed")
+		default:
+			writeError(w, http.StatusInternalServerError, "unable to replay webhook event")
+		}
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"payment_webhook_event_replayed",
+		"payment_webhook_event",
+		replayed.ID,
+		map[string]interface{}{"status": before.Status, "attempts": before.Attempts},
+		map[string]interface{}{"status": replayed.Status, "attempts": replayed.Attempts, "last_error": replayed.LastError},
+		map[string]interface{}{"provider": replayed.Provider, "provider_event_id": replayed.ProviderEventID},
+	)
+
+	writeJSON(w, http.StatusOK, replayed)
+}
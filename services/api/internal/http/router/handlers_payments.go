@@ -1,11 +1,14 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
 	"strings"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
 	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
 )
 
@@ -26,11 +29,31 @@ type stripeIntentResponse struct {
 	GuestToken string `json:"guest_token,omitempty"`
 }
 
+type providerPaymentRequest struct {
+	OrderID        string `json:"order_id"`
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+type providerConfirmRequest struct {
+	OrderID string `json:"order_id"`
+}
+
+type providerPaymentResponse struct {
+	payments.ProviderPayment
+	GuestToken string `json:"guest_token,omitempty"`
+}
+
 type codPaymentResponse struct {
 	payments.CODPayment
 	GuestToken string `json:"guest_token,omitempty"`
 }
 
+type paymentStatusResponse struct {
+	payments.PaymentSummary
+	OrderStatus string `json:"order_status"`
+	GuestToken  string `json:"guest_token,omitempty"`
+}
+
 func (a *api) handleBuyerPaymentSettingsGet(w http.ResponseWriter, r *http.Request) {
 	_, guestToken := checkoutActor(r)
 	settings := a.payments.GetSettings()
@@ -83,6 +106,33 @@ func (a *api) handleStripeCreateIntent(w http.ResponseWriter, r *http.Request) {
 	}, guestToken)
 }
 
+// handlePaymentStatus is polled by checkout while a payment settles, for
+// example after a 3-D Secure challenge.
+func (a *api) handlePaymentStatus(w http.ResponseWriter, r *http.Request) {
+	actor, guestToken := checkoutActor(r)
+
+	payment, err := a.payments.GetPayment(r.Context(), chi.URLParam(r, "paymentID"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "payment not found")
+		return
+	}
+	order, found, err := a.commerce.GetOrder(actor, payment.OrderID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "unable to resolve order actor")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "payment not found")
+		return
+	}
+
+	writeBuyerResponse(w, http.StatusOK, paymentStatusResponse{
+		PaymentSummary: payment,
+		OrderStatus:    order.Status,
+		GuestToken:     guestToken,
+	}, guestToken)
+}
+
 func (a *api) handleStripeWebhook(w http.ResponseWriter, r *http.Request) {
 	signatureHeader := strings.TrimSpace(r.Header.Get(stripeSignatureHeader))
 	if signatureHeader == "" {
@@ -148,6 +198,8 @@ func (a *api) handleCODConfirmPayment(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "idempotency key is required")
 		case errors.Is(err, payments.ErrCODDisabled):
 			writeError(w, http.StatusConflict, "cod payments are disabled")
+		case errors.Is(err, payments.ErrCODBuyerFlagged):
+			writeError(w, http.StatusConflict, "cash on delivery is unavailable after repeated refusals")
 		case errors.Is(err, payments.ErrOrderNotPayable):
 			writeError(w, http.StatusConflict, "order is not payable")
 		default:
@@ -161,3 +213,223 @@ func (a *api) handleCODConfirmPayment(w http.ResponseWriter, r *http.Request) {
 		GuestToken: guestToken,
 	}, guestToken)
 }
+
+func (a *api) handleProviderCreatePayment(w http.ResponseWriter, r *http.Request) {
+	actor, guestToken := checkoutActor(r)
+
+	var req providerPaymentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	order, ok := a.payableOrder(w, actor, req.OrderID)
+	if !ok {
+		return
+	}
+
+	payment, err := a.payments.CreateProviderPayment(r.Context(), chi.URLParam(r, "provider"), order, req.IdempotencyKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrProviderNotFound):
+			writeError(w, http.StatusNotFound, "payment provider not found")
+		case errors.Is(err, payments.ErrIdempotencyKey):
+			writeError(w, http.StatusBadRequest, "idempotency key is required")
+		case errors.Is(err, payments.ErrProviderDisabled):
+			writeError(w, http.StatusConflict, "payment provider is disabled")
+		case errors.Is(err, payments.ErrOrderNotPayable):
+			writeError(w, http.StatusConflict, "order is not payable")
+		default:
+			writeError(w, http.StatusBadRequest, "unable to create payment")
+		}
+		return
+	}
+
+	writeBuyerResponse(w, http.StatusCreated, providerPaymentResponse{
+		ProviderPayment: payment,
+		GuestToken:      guestToken,
+	}, guestToken)
+}
+
+func (a *api) handleProviderConfirmPayment(w http.ResponseWriter, r *http.Request) {
+	actor, guestToken := checkoutActor(r)
+
+	var req providerConfirmRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	order, ok := a.payableOrder(w, actor, req.OrderID)
+	if !ok {
+		return
+	}
+
+	payment, err := a.payments.ConfirmProviderPayment(r.Context(), chi.URLParam(r, "provider"), order)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrProviderNotFound):
+			writeError(w, http.StatusNotFound, "payment provider not found")
+		case errors.Is(err, payments.ErrPaymentNotFound):
+			writeError(w, http.StatusNotFound, "payment not found")
+		case errors.Is(err, payments.ErrOrderSyncFailed):
+			writeError(w, http.StatusConflict, "payment could not be applied")
+		default:
+			writeError(w, http.StatusBadGateway, "unable to confirm payment with provider")
+		}
+		return
+	}
+
+	writeBuyerResponse(w, http.StatusOK, providerPaymentResponse{
+		ProviderPayment: payment,
+		GuestToken:      guestToken,
+	}, guestToken)
+}
+
+func (a *api) handleProviderWebhook(w http.ResponseWriter, r *http.Request) {
+	providerName := chi.URLParam(r, "provider")
+	signatureHeaderName, found := a.payments.ProviderSignatureHeader(providerName)
+	if !found {
+		writeError(w, http.StatusNotFound, "payment provider not found")
+		return
+	}
+	signatureHeader := strings.TrimSpace(r.Header.Get(signatureHeaderName))
+	if signatureHeader == "" {
+		writeError(w, http.StatusBadRequest, "missing webhook signature")
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook payload")
+		return
+	}
+
+	result, err := a.payments.HandleProviderWebhook(providerName, payload, signatureHeader)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrInvalidSignature):
+			writeError(w, http.StatusBadRequest, "invalid webhook signature")
+		case errors.Is(err, payments.ErrWebhookSecretRequired):
+			writeError(w, http.StatusServiceUnavailable, "webhook secret is not configured")
+		case errors.Is(err, payments.ErrPaymentNotFound):
+			writeError(w, http.StatusConflict, "payment event could not be matched")
+		case errors.Is(err, payments.ErrOrderSyncFailed):
+			writeError(w, http.StatusConflict, "payment event could not be applied")
+		case errors.Is(err, payments.ErrInvalidPayload):
+			writeError(w, http.StatusBadRequest, "invalid webhook payload")
+		default:
+			writeError(w, http.StatusInternalServerError, "unable to process payment webhook")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// payableOrder resolves the buyer's order for a payment request, writing the
+// error response when it cannot.
+func (a *api) payableOrder(w http.ResponseWriter, actor commerce.Actor, orderID string) (commerce.Order, bool) {
+	orderID = strings.TrimSpace(orderID)
+	if orderID == "" {
+		writeError(w, http.StatusBadRequest, "order id is required")
+		return commerce.Order{}, false
+	}
+
+	order, found, err := a.commerce.GetOrder(actor, orderID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "unable to resolve order actor")
+		return commerce.Order{}, false
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "order not found")
+		return commerce.Order{}, false
+	}
+	return order, true
+}
+
+func (a *api) handleAdminPaymentAuthorizationsList(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	flaggedOnly := false
+	switch strings.ToLower(strings.TrimSpace(r.URL.Query().Get("flagged"))) {
+	case "":
+	case "true":
+		flaggedOnly = true
+	case "false":
+	default:
+		writeError(w, http.StatusBadRequest, "flagged must be true or false")
+		return
+	}
+
+	items := a.payments.ListAuthorizations(flaggedOnly)
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// settleShipmentPayment captures a shipped shipment's share of the order
+// authorization, transferring it less commission to vendors with a connected
+// account. Shares split the charged order total, discounts included, by
+// shipment value. A shipment cancelled while others are still open has its share
+// recorded as released, so reauthorizations leave it out and the last capture
+// drops it; the remainder is voided once every shipment has either shipped or
+// been cancelled. Orders without a Stripe payment fall back to the
+// configured providers. Payment failures never undo the shipment update;
+// Stripe ones surface on the admin authorizations list instead.
+func (a *api) settleShipmentPayment(ctx context.Context, shipment commerce.VendorShipment) {
+	if shipment.Status != commerce.ShipmentStatusShipped && shipment.Status != commerce.ShipmentStatusCancelled {
+		return
+	}
+	order, found := a.commerce.GetOrderForAdmin(shipment.OrderID)
+	if !found {
+		return
+	}
+
+	outstanding := false
+	for _, candidate := range order.Shipments {
+		if candidate.ID == shipment.ID {
+			continue
+		}
+		switch candidate.Status {
+		case commerce.ShipmentStatusShipped, commerce.ShipmentStatusDelivered, commerce.ShipmentStatusCancelled:
+		default:
+			outstanding = true
+		}
+	}
+
+	share := payments.ShipmentCharges(order)[shipment.ID]
+	if shipment.Status == commerce.ShipmentStatusShipped {
+		input := payments.CaptureShipmentInput{
+			OrderID:     order.ID,
+			ShipmentID:  shipment.ID,
+			AmountCents: share,
+			Final:       !outstanding,
+			VendorID:    shipment.VendorID,
+		}
+		if vendor, exists := a.vendorService.GetByID(shipment.VendorID); exists && vendor.PayoutsEnabled {
+			input.Destination = vendor.StripeAccountID
+			input.ApplicationFeeCents = share * int64(a.vendorCommissionBPS(vendor)) / 10000
+		}
+		if _, err := a.payments.CaptureShipment(ctx, input); errors.Is(err, payments.ErrPaymentNotFound) {
+			_, _ = a.payments.CaptureProviderShipment(ctx, input)
+		}
+		return
+	}
+	if outstanding {
+		if _, err := a.payments.ReleaseShipment(order.ID, shipment.ID, share); errors.Is(err, payments.ErrPaymentNotFound) {
+			_, _ = a.payments.ReleaseProviderShipment(order.ID, shipment.ID, share)
+		}
+		return
+	}
+	if _, err := a.payments.ReleaseAuthorization(ctx, order.ID); errors.Is(err, payments.ErrPaymentNotFound) {
+		_, _ = a.payments.ReleaseProviderAuthorization(ctx, order.ID)
+	}
+}
@@ -0,0 +1,258 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStripeAuthorizationCapturesPerVendorShipment(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_capture"
+	r := mustRouterWithConfig(t, cfg)
+
+	shippingToken, shippingProductID := createApprovedVendorProduct(t, r, "vendor-capture-ships@example.com", "vendor-capture-ships", 3000, 5)
+	cancellingToken, cancellingProductID := createApprovedVendorProduct(t, r, "vendor-capture-cancels@example.com", "vendor-capture-cancels", 2000, 5)
+	guestHeaders := map[string]string{guestTokenHeader: "gst_capture_flow"}
+	for _, productID := range []string{shippingProductID, cancellingProductID} {
+		addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        1,
+		}, "", guestHeaders)
+		if addRes.Code != http.StatusOK {
+			t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+	}
+
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "capture-order-1",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID        string `json:"id"`
+			Shipments []struct {
+				ID string `json:"id"`
+			} `json:"shipments"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(orderPayload.Order.Shipments) != 2 {
+		t.Fatalf("expected one shipment per vendor, got %d", len(orderPayload.Order.Shipments))
+	}
+
+	intentRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "capture-intent-1",
+	}, "", guestHeaders)
+	if intentRes.Code != http.StatusCreated || !strings.Contains(intentRes.Body.String(), `"capture_method":"manual"`) {
+		t.Fatalf("create stripe intent status=%d body=%s", intentRes.Code, intentRes.Body.String())
+	}
+	var intentPayload struct {
+		ProviderRef string `json:"provider_ref"`
+	}
+	if err := json.Unmarshal(intentRes.Body.Bytes(), &intentPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	webhookBody, webhookSignature := signedStripeWebhook(t, cfg.StripeWebhookSecret, "evt_capture_auth", "payment_intent.amount_capturable_updated", intentPayload.ProviderRef)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(webhookBody))
+	req.Header.Set(stripeSignatureHeader, webhookSignature)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"payment_status":"authorized"`) {
+		t.Fatalf("authorization webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	orderView := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/orders/"+orderPayload.Order.ID, nil, "", guestHeaders)
+	if !strings.Contains(orderView.Body.String(), `"status":"paid"`) {
+		t.Fatalf("expected authorized order to be paid, body=%s", orderView.Body.String())
+	}
+
+	admin := loginOrRegisterUser(t, r, "admin@example.com")
+	type authorizationsPayload struct {
+		Items []struct {
+			OrderID       string `json:"order_id"`
+			Status        string `json:"status"`
+			CapturedCents int64  `json:"captured_cents"`
+			Captures      []struct {
+				ShipmentID string `json:"shipment_id"`
+			} `json:"captures"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	listAuthorizations := func() authorizationsPayload {
+		t.Helper()
+		res := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/authorizations", nil, admin.AccessToken)
+		if res.Code != http.StatusOK {
+			t.Fatalf("list authorizations status=%d body=%s", res.Code, res.Body.String())
+		}
+		var payload authorizationsPayload
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return payload
+	}
+	if authorized := listAuthorizations(); authorized.Total != 1 || authorized.Items[0].Status != "authorized" || authorized.Items[0].CapturedCents != 0 {
+		t.Fatalf("expected one uncaptured authorization, got %+v", authorized)
+	}
+	if invalid := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/authorizations?flagged=maybe", nil, admin.AccessToken); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid flagged filter 400, got %d", invalid.Code)
+	}
+
+	vendorShipment := func(token string) (string, int64) {
+		t.Helper()
+		res := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, token)
+		var payload struct {
+			Items []struct {
+				ID         string `json:"id"`
+				TotalCents int64  `json:"total_cents"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil || len(payload.Items) != 1 {
+			t.Fatalf("expected one vendor shipment, status=%d body=%s", res.Code, res.Body.String())
+		}
+		return payload.Items[0].ID, payload.Items[0].TotalCents
+	}
+	shippedID, shippedTotal := vendorShipment(shippingToken)
+	cancelledID, _ := vendorShipment(cancellingToken)
+
+	shipRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+shippedID+"/status", map[string]string{"status": "shipped"}, shippingToken)
+	if shipRes.Code != http.StatusOK {
+		t.Fatalf("ship status=%d body=%s", shipRes.Code, shipRes.Body.String())
+	}
+	partial := listAuthorizations()
+	if partial.Total != 1 || partial.Items[0].Status != "partially_captured" || partial.Items[0].CapturedCents != shippedTotal {
+		t.Fatalf("expected capture of shipped vendor share %d, got %+v", shippedTotal, partial)
+	}
+	if len(partial.Items[0].Captures) != 1 || partial.Items[0].Captures[0].ShipmentID != shippedID {
+		t.Fatalf("expected capture linked to shipment %s, got %+v", shippedID, partial.Items[0].Captures)
+	}
+
+	cancelRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+cancelledID+"/status", map[string]string{"status": "cancelled"}, cancellingToken)
+	if cancelRes.Code != http.StatusOK {
+		t.Fatalf("cancel status=%d body=%s", cancelRes.Code, cancelRes.Body.String())
+	}
+	if remaining := listAuthorizations(); remaining.Total != 0 {
+		t.Fatalf("expected remaining authorization to be voided, got %+v", remaining)
+	}
+}
+
+func TestShipmentCancelledWhileOthersAreOpenReleasesItsShare(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_release"
+	r := mustRouterWithConfig(t, cfg)
+
+	tokens := make([]string, 0, 3)
+	guestHeaders := map[string]string{guestTokenHeader: "gst_release_flow"}
+	for _, vendor := range []struct {
+		slug  string
+		price int64
+	}{{"vendor-release-a", 3000}, {"vendor-release-b", 2000}, {"vendor-release-c", 1500}} {
+		token, productID := createApprovedVendorProduct(t, r, vendor.slug+"@example.com", vendor.slug, vendor.price, 5)
+		tokens = append(tokens, token)
+		addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        1,
+		}, "", guestHeaders)
+		if addRes.Code != http.StatusOK {
+			t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "release-order-1",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID string `json:"id"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	intentRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "release-intent-1",
+	}, "", guestHeaders)
+	var intentPayload struct {
+		ProviderRef string `json:"provider_ref"`
+		AmountCents int64  `json:"amount_cents"`
+	}
+	if intentRes.Code != http.StatusCreated || json.Unmarshal(intentRes.Body.Bytes(), &intentPayload) != nil {
+		t.Fatalf("create stripe intent status=%d body=%s", intentRes.Code, intentRes.Body.String())
+	}
+	webhookBody, webhookSignature := signedStripeWebhook(t, cfg.StripeWebhookSecret, "evt_release_auth", "payment_intent.amount_capturable_updated", intentPayload.ProviderRef)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(webhookBody))
+	req.Header.Set(stripeSignatureHeader, webhookSignature)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("authorization webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	admin := loginOrRegisterUser(t, r, "admin@example.com")
+	type authorization struct {
+		Status        string `json:"status"`
+		CapturedCents int64  `json:"captured_cents"`
+		ReleasedCents int64  `json:"released_cents"`
+		Releases      []struct {
+			ShipmentID string `json:"shipment_id"`
+		} `json:"releases"`
+	}
+	listAuthorizations := func() []authorization {
+		t.Helper()
+		res := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/authorizations", nil, admin.AccessToken)
+		var payload struct {
+			Items []authorization `json:"items"`
+		}
+		if res.Code != http.StatusOK || json.Unmarshal(res.Body.Bytes(), &payload) != nil {
+			t.Fatalf("list authorizations status=%d body=%s", res.Code, res.Body.String())
+		}
+		return payload.Items
+	}
+	setStatus := func(token, status string) (string, int64) {
+		t.Helper()
+		res := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, token)
+		var payload struct {
+			Items []struct {
+				ID         string `json:"id"`
+				TotalCents int64  `json:"total_cents"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil || len(payload.Items) != 1 {
+			t.Fatalf("expected one vendor shipment, status=%d body=%s", res.Code, res.Body.String())
+		}
+		update := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+payload.Items[0].ID+"/status", map[string]string{"status": status}, token)
+		if update.Code != http.StatusOK {
+			t.Fatalf("%s status=%d body=%s", status, update.Code, update.Body.String())
+		}
+		return payload.Items[0].ID, payload.Items[0].TotalCents
+	}
+
+	cancelledID, cancelledTotal := setStatus(tokens[2], "cancelled")
+	open := listAuthorizations()
+	if len(open) != 1 || open[0].Status != "authorized" || open[0].ReleasedCents != cancelledTotal || len(open[0].Releases) != 1 || open[0].Releases[0].ShipmentID != cancelledID {
+		t.Fatalf("expected the cancelled share %d recorded as released, got %+v", cancelledTotal, open)
+	}
+
+	_, firstTotal := setStatus(tokens[0], "shipped")
+	if partial := listAuthorizations(); len(partial) != 1 || partial[0].Status != "partially_captured" || partial[0].CapturedCents != firstTotal {
+		t.Fatalf("expected a partial capture of %d, got %+v", firstTotal, partial)
+	}
+	_, secondTotal := setStatus(tokens[1], "shipped")
+	if remaining := listAuthorizations(); len(remaining) != 0 {
+		t.Fatalf("expected the last shipment's capture to settle the authorization, got %+v", remaining)
+	}
+	if firstTotal+secondTotal+cancelledTotal != intentPayload.AmountCents {
+		t.Fatalf("expected shipments to cover the authorization %d, got %d+%d+%d", intentPayload.AmountCents, firstTotal, secondTotal, cancelledTotal)
+	}
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/reconciliation"
+)
+
+func (a *api) handleAdminReconciliationReportsList(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 20, 100)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := a.reconciliation.List()
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (a *api) handleAdminReconciliationRun(w http.ResponseWriter, r *http.Request) {
+	report, started := a.reconciliation.Run(r.Context())
+	if !started {
+		writeError(w, http.StatusConflict, "reconciliation is already running")
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"payment_reconciliation_run",
+		"job",
+		"payment_reconciliation",
+		nil,
+		map[string]interface{}{"report_id": report.ID, "status": report.Status, "mismatches": len(report.Mismatches)},
+		nil,
+	)
+
+	writeJSON(w, http.StatusCreated, report)
+}
+
+func (a *api) handleAdminReconciliationReportDetail(w http.ResponseWriter, r *http.Request) {
+	report, exists := a.reconciliation.Get(chi.URLParam(r, "reportID"))
+	if !exists {
+		writeError(w, http.StatusNotFound, "reconciliation report not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (a *api) handleAdminReconciliationReportCSV(w http.ResponseWriter, r *http.Request) {
+	report, exists := a.reconciliation.Get(chi.URLParam(r, "reportID"))
+	if !exists {
+		writeError(w, http.StatusNotFound, "reconciliation report not found")
+		return
+	}
+
+	content, err := report.CSV()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "unable to render reconciliation report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=reconciliation-"+report.ID+".csv")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(content)
+}
+
+// handleAdminReconciliationFix settles the report's fixable mismatches: stuck
+// orders whose provider payment matches the order total.
+func (a *api) handleAdminReconciliationFix(w http.ResponseWriter, r *http.Request) {
+	result, err := a.reconciliation.Fix(r.Context(), chi.URLParam(r, "reportID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, reconciliation.ErrReportNotFound):
+			writeError(w, http.StatusNotFound, "reconciliation report not found")
+		default:
+			writeError(w, http.StatusInternalServerError, "unable to fix reconciliation report")
+		}
+		return
+	}
+
+	a.recordAuditLog(
+		r,
+		"payment_reconciliation_fixed",
+		"payment_reconciliation_report",
+		result.Report.ID,
+		nil,
+		map[string]interface{}{"fixed": result.Fixed, "failed": result.Failed},
+		nil,
+	)
+
+	writeJSON(w, http.StatusOK, result)
+}
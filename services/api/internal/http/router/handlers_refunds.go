@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/invoices"
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
 	"github.com/yxshee/marketplace-platform/services/api/internal/refunds"
 )
 
@@ -74,7 +76,7 @@ func (a *api) handleBuyerCreateRefundRequest(w http.ResponseWriter, r *http.Requ
 }
 
 func (a *api) handleVendorListRefundRequests(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -107,7 +109,7 @@ func (a *api) handleVendorListRefundRequests(w http.ResponseWriter, r *http.Requ
 }
 
 func (a *api) handleVendorRefundDecision(w http.ResponseWriter, r *http.Request) {
-	identity, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	identity, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -144,6 +146,25 @@ func (a *api) handleVendorRefundDecision(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+	if updated.Status == refunds.RequestStatusApproved {
+		// Stripe and COD refunds are still settled outside the platform; the
+		// vendor's share of a Stripe refund is pulled back from its transfer.
+		_, _ = a.payments.RefundProviderPayment(r.Context(), updated.OrderID, updated.RequestedAmountCents, updated.ID)
+		_, _ = a.payments.ReverseShipmentTransfer(r.Context(), payments.ShipmentRefundInput{
+			OrderID:     updated.OrderID,
+			ShipmentID:  updated.ShipmentID,
+			AmountCents: updated.RequestedAmountCents,
+			Reference:   updated.ID,
+		})
+		a.issueOrderInvoices(r.Context(), updated.OrderID)
+		_, _ = a.invoices.IssueCreditNote(r.Context(), invoices.CreditNoteInput{
+			OrderID:         updated.OrderID,
+			ShipmentID:      updated.ShipmentID,
+			RefundRequestID: updated.ID,
+			AmountCents:     updated.RequestedAmountCents,
+			Reason:          updated.Reason,
+		})
+	}
 
 	writeJSON(w, http.StatusOK, updated)
 }
@@ -0,0 +1,141 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+)
+
+type sessionDTO struct {
+	ID          string    `json:"id"`
+	Device      string    `json:"device"`
+	IP          string    `json:"ip,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	MFAVerified bool      `json:"mfa_verified"`
+	Current     bool      `json:"current"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func toSessionDTO(session auth.Session, currentSessionID string) sessionDTO {
+	return sessionDTO{
+		ID:          session.ID,
+		Device:      deviceLabel(session.UserAgent),
+		IP:          session.IP,
+		UserAgent:   session.UserAgent,
+		MFAVerified: session.MFAVerified,
+		Current:     session.ID == currentSessionID,
+		CreatedAt:   session.CreatedAt,
+		LastUsedAt:  session.LastUsedAt,
+		ExpiresAt:   session.ExpiresAt,
+	}
+}
+
+func (a *api) handleSessionsList(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	sessions := a.authService.UserSessions(identity.UserID)
+	items := make([]sessionDTO, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, toSessionDTO(session, identity.SessionID))
+	}
+	writeJSON(w, http.StatusOK, map[string][]sessionDTO{"items": items})
+}
+
+func (a *api) handleSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	session, err := a.authService.RevokeSession(identity.UserID, chi.URLParam(r, "sessionID"))
+	if err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "session revocation failed")
+		return
+	}
+
+	a.recordAuditLog(r, "auth_session_revoked", "session", session.ID, toSessionDTO(session, identity.SessionID), nil, nil)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// handleSessionsRevokeAll signs the user out everywhere. With
+// keep_current=true the session making the request stays signed in.
+func (a *api) handleSessionsRevokeAll(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	keepCurrent := strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("keep_current")), "true")
+	var revoked int
+	if keepCurrent {
+		revoked = a.authService.RevokeOtherSessions(identity.UserID, identity.SessionID)
+	} else {
+		revoked = a.authService.RevokeUserSessions(identity.UserID)
+	}
+
+	a.recordAuditLog(r, "auth_sessions_revoked", "user", identity.UserID, nil, nil, map[string]interface{}{
+		"revoked":      revoked,
+		"keep_current": keepCurrent,
+	})
+	writeJSON(w, http.StatusOK, map[string]int{"revoked": revoked})
+}
+
+// deviceLabel names the browser and platform of a user agent for the
+// session list, such as "Firefox on Windows".
+func deviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if strings.TrimSpace(ua) == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/") || strings.Contains(ua, "fxios/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os x") || strings.Contains(ua, "macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
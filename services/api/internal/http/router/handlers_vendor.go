@@ -65,7 +65,7 @@ func (a *api) handleVendorVerificationStatus(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	registeredVendor, exists := a.vendorService.GetByOwner(identity.UserID)
+	registeredVendor, _, exists := a.vendorService.GetByMember(identity.UserID)
 	if !exists {
 		writeError(w, http.StatusNotFound, "vendor not found")
 		return
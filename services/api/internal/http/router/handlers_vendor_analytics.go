@@ -70,7 +70,7 @@ type vendorAnalyticsCouponsResponse struct {
 }
 
 func (a *api) handleVendorAnalyticsOverview(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -152,7 +152,7 @@ func (a *api) handleVendorAnalyticsOverview(w http.ResponseWriter, r *http.Reque
 }
 
 func (a *api) handleVendorAnalyticsTopProducts(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -220,7 +220,7 @@ func (a *api) handleVendorAnalyticsTopProducts(w http.ResponseWriter, r *http.Re
 }
 
 func (a *api) handleVendorAnalyticsCoupons(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
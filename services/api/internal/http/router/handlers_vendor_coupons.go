@@ -28,7 +28,7 @@ type vendorUpdateCouponRequest struct {
 }
 
 func (a *api) handleVendorListCoupons(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -41,7 +41,7 @@ func (a *api) handleVendorListCoupons(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *api) handleVendorCreateCoupon(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -83,7 +83,7 @@ func (a *api) handleVendorCreateCoupon(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *api) handleVendorUpdateCoupon(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -136,7 +136,7 @@ func (a *api) handleVendorUpdateCoupon(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *api) handleVendorDeleteCoupon(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
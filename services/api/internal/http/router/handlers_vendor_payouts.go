@@ -0,0 +1,137 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
+	"github.com/yxshee/marketplace-platform/services/api/internal/vendors"
+)
+
+type vendorConnectOnboardingRequest struct {
+	RefreshURL string `json:"refresh_url"`
+	ReturnURL  string `json:"return_url"`
+}
+
+type vendorConnectOnboardingResponse struct {
+	StripeAccountID string `json:"stripe_account_id"`
+	OnboardingURL   string `json:"onboarding_url"`
+	PayoutsEnabled  bool   `json:"payouts_enabled"`
+}
+
+type vendorConnectStatusResponse struct {
+	StripeAccountID  string `json:"stripe_account_id"`
+	DetailsSubmitted bool   `json:"details_submitted"`
+	ChargesEnabled   bool   `json:"charges_enabled"`
+	PayoutsEnabled   bool   `json:"payouts_enabled"`
+}
+
+func (a *api) handleVendorConnectOnboarding(w http.ResponseWriter, r *http.Request) {
+	identity, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	var req vendorConnectOnboardingRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !isAbsoluteHTTPURL(req.RefreshURL) || !isAbsoluteHTTPURL(req.ReturnURL) {
+		writeError(w, http.StatusBadRequest, "refresh_url and return_url must be absolute http(s) urls")
+		return
+	}
+
+	email := ""
+	if user, exists := a.authService.GetUserByID(identity.UserID); exists {
+		email = user.Email
+	}
+	onboarding, err := a.payments.StartConnectOnboarding(r.Context(), payments.ConnectOnboardingInput{
+		VendorID:   registeredVendor.ID,
+		Email:      email,
+		AccountID:  registeredVendor.StripeAccountID,
+		RefreshURL: req.RefreshURL,
+		ReturnURL:  req.ReturnURL,
+	})
+	if onboarding.AccountID != "" && onboarding.AccountID != registeredVendor.StripeAccountID {
+		registeredVendor, _ = a.vendorService.SetStripeAccount(registeredVendor.ID, onboarding.AccountID, false)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "unable to start payout onboarding")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, vendorConnectOnboardingResponse{
+		StripeAccountID: onboarding.AccountID,
+		OnboardingURL:   onboarding.OnboardingURL,
+		PayoutsEnabled:  registeredVendor.PayoutsEnabled,
+	})
+}
+
+// handleVendorConnectStatus refreshes the vendor's connected account from
+// Stripe, so payouts switch on once onboarding completes.
+func (a *api) handleVendorConnectStatus(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+	if registeredVendor.StripeAccountID == "" {
+		writeError(w, http.StatusNotFound, "payout account not found")
+		return
+	}
+
+	status, err := a.payments.ConnectedAccount(r.Context(), registeredVendor.StripeAccountID)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "unable to load payout account")
+		return
+	}
+	if status.PayoutsEnabled != registeredVendor.PayoutsEnabled {
+		_, _ = a.vendorService.SetStripeAccount(registeredVendor.ID, registeredVendor.StripeAccountID, status.PayoutsEnabled)
+	}
+
+	writeJSON(w, http.StatusOK, vendorConnectStatusResponse{
+		StripeAccountID:  registeredVendor.StripeAccountID,
+		DetailsSubmitted: status.DetailsSubmitted,
+		ChargesEnabled:   status.ChargesEnabled,
+		PayoutsEnabled:   status.PayoutsEnabled,
+	})
+}
+
+func (a *api) handleVendorPayoutsList(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := a.payments.ListVendorTransfers(registeredVendor.ID)
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// vendorCommissionBPS is the commission withheld from the vendor's sales.
+func (a *api) vendorCommissionBPS(vendor vendors.Vendor) int32 {
+	if vendor.CommissionOverrideBPS != nil {
+		return *vendor.CommissionOverrideBPS
+	}
+	return a.defaultCommBPS
+}
+
+func isAbsoluteHTTPURL(raw string) bool {
+	parsed, err := url.ParseRequestURI(strings.TrimSpace(raw))
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return parsed.Scheme == "http" || parsed.Scheme == "https"
+}
@@ -2,19 +2,25 @@ package router
 
 import (
 	"errors"
+	"io"
 	"net/http"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/carriers"
 	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
 )
 
+const carrierSignatureHeader = "X-Carrier-Signature"
+
 type vendorShipmentStatusUpdateRequest struct {
-	Status string `json:"status"`
+	Status         string `json:"status"`
+	CarrierCode    string `json:"carrier_code"`
+	TrackingNumber string `json:"tracking_number"`
 }
 
 func (a *api) handleVendorListShipments(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -41,7 +47,7 @@ func (a *api) handleVendorListShipments(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *api) handleVendorShipmentDetail(w http.ResponseWriter, r *http.Request) {
-	_, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	_, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -71,7 +77,7 @@ func (a *api) handleVendorShipmentDetail(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *api) handleVendorShipmentStatusUpdate(w http.ResponseWriter, r *http.Request) {
-	identity, registeredVendor, ok := a.vendorOwnerContext(w, r)
+	identity, registeredVendor, ok := a.vendorContext(w, r)
 	if !ok {
 		return
 	}
@@ -92,13 +98,26 @@ func (a *api) handleVendorShipmentStatusUpdate(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	shipment, err := a.commerce.UpdateVendorShipmentStatus(registeredVendor.ID, shipmentID, req.Status, identity.UserID)
+	tracking := commerce.ShipmentTracking{
+		CarrierCode:    req.CarrierCode,
+		TrackingNumber: req.TrackingNumber,
+	}
+	if !tracking.IsZero() && !a.carriers.IsSupported(tracking.CarrierCode) {
+		writeError(w, http.StatusBadRequest, "unsupported carrier")
+		return
+	}
+
+	shipment, err := a.commerce.UpdateVendorShipmentStatusWithTracking(registeredVendor.ID, shipmentID, req.Status, identity.UserID, tracking)
 	if err != nil {
 		switch {
 		case errors.Is(err, commerce.ErrShipmentNotFound), errors.Is(err, commerce.ErrShipmentForbidden):
 			writeError(w, http.StatusNotFound, "shipment not found")
 		case errors.Is(err, commerce.ErrInvalidShipmentStatus):
 			writeError(w, http.StatusBadRequest, "invalid shipment status")
+		case errors.Is(err, commerce.ErrInvalidTracking):
+			writeError(w, http.StatusBadRequest, "carrier code and tracking number are required together when marking shipped")
+		case errors.Is(err, commerce.ErrTrackingInUse):
+			writeError(w, http.StatusConflict, "tracking number already assigned to another shipment")
 		case errors.Is(err, commerce.ErrShipmentTransition):
 			writeError(w, http.StatusConflict, "invalid shipment status transition")
 		default:
@@ -106,6 +125,47 @@ func (a *api) handleVendorShipmentStatusUpdate(w http.ResponseWriter, r *http.Re
 		}
 		return
 	}
+	if shipment.TrackingNumber != "" && shipment.Status == commerce.ShipmentStatusShipped {
+		_, _ = a.carriers.Track(shipment.CarrierCode, shipment.TrackingNumber)
+	}
+	a.settleShipmentPayment(r.Context(), shipment)
 
 	writeJSON(w, http.StatusOK, shipment)
 }
+
+func (a *api) handleVendorShipmentCarriers(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": a.carriers.SupportedCarriers(),
+	})
+}
+
+func (a *api) handleCarrierWebhook(w http.ResponseWriter, r *http.Request) {
+	carrierCode := strings.TrimSpace(chi.URLParam(r, "carrierCode"))
+	if carrierCode == "" {
+		writeError(w, http.StatusBadRequest, "carrier code is required")
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook payload")
+		return
+	}
+
+	result, err := a.carriers.HandleWebhook(carrierCode, payload, r.Header.Get(carrierSignatureHeader))
+	if err != nil {
+		switch {
+		case errors.Is(err, carriers.ErrUnsupportedCarrier):
+			writeError(w, http.StatusNotFound, "carrier not found")
+		case errors.Is(err, carriers.ErrInvalidSignature):
+			writeError(w, http.StatusBadRequest, "invalid carrier signature")
+		case errors.Is(err, carriers.ErrInvalidPayload):
+			writeError(w, http.StatusBadRequest, "invalid webhook payload")
+		default:
+			writeError(w, http.StatusInternalServerError, "unable to process carrier webhook")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,291 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+	"github.com/yxshee/marketplace-platform/services/api/internal/mailer"
+	"github.com/yxshee/marketplace-platform/services/api/internal/vendors"
+)
+
+// vendorMemberRoles maps team roles onto the auth roles that
+// requirePermission checks.
+var vendorMemberRoles = map[vendors.MemberRole]auth.Role{
+	vendors.MemberRoleOwner:          auth.RoleVendorOwner,
+	vendors.MemberRoleCatalogManager: auth.RoleVendorCatalogManager,
+	vendors.MemberRoleFulfilment:     auth.RoleVendorFulfilment,
+	vendors.MemberRoleFinance:        auth.RoleVendorFinance,
+}
+
+type vendorTeamInviteRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type vendorTeamRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type vendorInvitationAcceptRequest struct {
+	Token string `json:"token"`
+}
+
+type vendorTeamMemberDTO struct {
+	UserID       string             `json:"user_id"`
+	Email        string             `json:"email"`
+	Role         vendors.MemberRole `json:"role"`
+	PrimaryOwner bool               `json:"primary_owner"`
+	InvitedBy    string             `json:"invited_by,omitempty"`
+	JoinedAt     time.Time          `json:"joined_at"`
+}
+
+type vendorTeamResponse struct {
+	VendorID    string                `json:"vendor_id"`
+	Members     []vendorTeamMemberDTO `json:"members"`
+	Invitations []vendors.Invitation  `json:"invitations"`
+}
+
+type vendorInvitationAcceptResponse struct {
+	authResponse
+	Vendor vendors.Vendor      `json:"vendor"`
+	Member vendorTeamMemberDTO `json:"member"`
+}
+
+func (a *api) toVendorTeamMemberDTO(vendor vendors.Vendor, member vendors.Member) vendorTeamMemberDTO {
+	dto := vendorTeamMemberDTO{
+		UserID:       member.UserID,
+		Role:         member.Role,
+		PrimaryOwner: member.UserID == vendor.OwnerUserID,
+		InvitedBy:    member.InvitedBy,
+		JoinedAt:     member.JoinedAt,
+	}
+	if user, exists := a.authService.GetUserByID(member.UserID); exists {
+		dto.Email = user.Email
+	}
+	return dto
+}
+
+func (a *api) handleVendorTeam(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	members := a.vendorService.Members(registeredVendor.ID)
+	response := vendorTeamResponse{
+		VendorID:    registeredVendor.ID,
+		Members:     make([]vendorTeamMemberDTO, 0, len(members)),
+		Invitations: a.vendorService.PendingInvitations(registeredVendor.ID),
+	}
+	for _, member := range members {
+		response.Members = append(response.Members, a.toVendorTeamMemberDTO(registeredVendor, member))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) handleVendorTeamInvite(w http.ResponseWriter, r *http.Request) {
+	identity, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+	var req vendorTeamInviteRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if user, exists := a.authService.GetUserByEmail(req.Email); exists {
+		if _, member := a.vendorService.Member(registeredVendor.ID, user.ID); member {
+			writeError(w, http.StatusConflict, "user is already on the team")
+			return
+		}
+	}
+
+	role := vendors.MemberRole(strings.ToLower(strings.TrimSpace(req.Role)))
+	invitation, rawToken, err := a.vendorService.Invite(registeredVendor.ID, req.Email, role, identity.UserID, a.vendorInvitationTTL)
+	if err != nil {
+		writeVendorTeamError(w, err)
+		return
+	}
+
+	a.sendAccountEmail(r.Context(), mailer.Mail{
+		Kind:    "vendor_team_invitation",
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("Join %s on the marketplace", registeredVendor.DisplayName),
+		Body: fmt.Sprintf(
+			"You have been invited to join %s as %s: %s\n\nSign in or create an account with this email address to accept. The link expires in %s.\n",
+			registeredVendor.DisplayName,
+			strings.ReplaceAll(string(invitation.Role), "_", " "),
+			a.accountLink("/vendor/invitations/accept", rawToken),
+			a.vendorInvitationTTL,
+		),
+	})
+	a.recordAuditLog(r, "vendor_team_invitation_created", "vendor", registeredVendor.ID, nil, invitation, nil)
+	writeJSON(w, http.StatusCreated, invitation)
+}
+
+func (a *api) handleVendorTeamInvitationRevoke(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	invitation, err := a.vendorService.RevokeInvitation(registeredVendor.ID, chi.URLParam(r, "invitationID"))
+	if err != nil {
+		writeVendorTeamError(w, err)
+		return
+	}
+
+	a.recordAuditLog(r, "vendor_team_invitation_revoked", "vendor", registeredVendor.ID, invitation, nil, nil)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// handleVendorTeamMemberUpdate changes a member's role and signs them out,
+// since their tokens still carry the old role.
+func (a *api) handleVendorTeamMemberUpdate(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+	var req vendorTeamRoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID := chi.URLParam(r, "userID")
+	role := vendors.MemberRole(strings.ToLower(strings.TrimSpace(req.Role)))
+	before, after, err := a.vendorService.SetMemberRole(registeredVendor.ID, userID, role)
+	if err != nil {
+		writeVendorTeamError(w, err)
+		return
+	}
+	if _, err := a.authService.SetVendorRole(userID, registeredVendor.ID, vendorMemberRoles[after.Role]); err != nil {
+		_, _, _ = a.vendorService.SetMemberRole(registeredVendor.ID, userID, before.Role)
+		writeError(w, http.StatusInternalServerError, "unable to update member role")
+		return
+	}
+
+	revoked := a.authService.RevokeUserSessions(userID)
+
+	a.recordAuditLog(r, "vendor_team_member_role_updated", "vendor", registeredVendor.ID, before, after, map[string]int{"sessions_revoked": revoked})
+	writeJSON(w, http.StatusOK, a.toVendorTeamMemberDTO(registeredVendor, after))
+}
+
+// handleVendorTeamMemberRemove takes a member off the team and signs them
+// out, so their vendor access ends immediately.
+func (a *api) handleVendorTeamMemberRemove(w http.ResponseWriter, r *http.Request) {
+	_, registeredVendor, ok := a.vendorContext(w, r)
+	if !ok {
+		return
+	}
+
+	removed, err := a.vendorService.RemoveMember(registeredVendor.ID, chi.URLParam(r, "userID"))
+	if err != nil {
+		writeVendorTeamError(w, err)
+		return
+	}
+	if _, err := a.authService.DetachVendor(removed.UserID, registeredVendor.ID); err != nil && !errors.Is(err, auth.ErrUserNotFound) {
+		writeError(w, http.StatusInternalServerError, "unable to remove member")
+		return
+	}
+	revoked := a.authService.RevokeUserSessions(removed.UserID)
+
+	a.recordAuditLog(r, "vendor_team_member_removed", "vendor", registeredVendor.ID, removed, nil, map[string]int{"sessions_revoked": revoked})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+// handleVendorInvitationAccept joins the signed-in user to the team that
+// invited their email. The current session is replaced by one that carries
+// the vendor role.
+func (a *api) handleVendorInvitationAccept(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	// Accepting issues the user's own tokens, which an impersonation must
+	// never obtain.
+	if identity.Impersonated() {
+		writeError(w, http.StatusForbidden, "invitations cannot be accepted while impersonating")
+		return
+	}
+	var req vendorInvitationAcceptRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	user, exists := a.authService.GetUserByID(identity.UserID)
+	if !exists {
+		writeError(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if user.VendorID == nil && user.Role != auth.RoleBuyer {
+		writeError(w, http.StatusConflict, "staff accounts cannot join vendor teams")
+		return
+	}
+
+	invitation, member, err := a.vendorService.AcceptInvitation(req.Token, user.ID, user.Email)
+	if err != nil {
+		writeVendorTeamError(w, err)
+		return
+	}
+	user, err = a.authService.SetVendorRole(user.ID, invitation.VendorID, vendorMemberRoles[member.Role])
+	if err != nil {
+		_, _ = a.vendorService.RemoveMember(invitation.VendorID, member.UserID)
+		switch {
+		case errors.Is(err, auth.ErrVendorAlreadyLinked):
+			writeError(w, http.StatusConflict, "user already belongs to a vendor team")
+		case errors.Is(err, auth.ErrRoleNotAssignable):
+			writeError(w, http.StatusConflict, "staff accounts cannot join vendor teams")
+		default:
+			writeError(w, http.StatusInternalServerError, "unable to join vendor team")
+		}
+		return
+	}
+
+	registeredVendor, _ := a.vendorService.GetByID(invitation.VendorID)
+	a.authService.DeleteSession(identity.SessionID)
+	tokens, err := a.issueTokensForUser(r, user, identity.MFAVerified)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "token issuance failed")
+		return
+	}
+
+	a.recordAuditLog(r, "vendor_team_member_joined", "vendor", registeredVendor.ID, nil, member, map[string]string{"invitation_id": invitation.ID})
+	writeJSON(w, http.StatusOK, vendorInvitationAcceptResponse{
+		authResponse: tokens,
+		Vendor:       registeredVendor,
+		Member:       a.toVendorTeamMemberDTO(registeredVendor, member),
+	})
+}
+
+func writeVendorTeamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, vendors.ErrInvalidMemberRole):
+		writeError(w, http.StatusBadRequest, "role must be owner, catalog_manager, fulfilment or finance")
+	case errors.Is(err, vendors.ErrInvalidEmail):
+		writeError(w, http.StatusBadRequest, "valid email is required")
+	case errors.Is(err, vendors.ErrMemberNotFound):
+		writeError(w, http.StatusNotFound, "team member not found")
+	case errors.Is(err, vendors.ErrInvitationNotFound):
+		writeError(w, http.StatusNotFound, "invitation not found")
+	case errors.Is(err, vendors.ErrPrimaryOwner):
+		writeError(w, http.StatusConflict, "the primary owner cannot be removed or demoted")
+	case errors.Is(err, vendors.ErrAlreadyMember):
+		writeError(w, http.StatusConflict, "user already belongs to a vendor team")
+	case errors.Is(err, vendors.ErrInvitationEmail):
+		writeError(w, http.StatusForbidden, "invitation was sent to another email address")
+	case errors.Is(err, vendors.ErrInvalidInvitation):
+		writeError(w, http.StatusBadRequest, "invitation is invalid, expired or already used")
+	case errors.Is(err, vendors.ErrVendorNotFound):
+		writeError(w, http.StatusNotFound, "vendor not found")
+	default:
+		writeError(w, http.StatusInternalServerError, "vendor team update failed")
+	}
+}
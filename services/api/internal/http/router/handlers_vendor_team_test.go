@@ -0,0 +1,218 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVendorTeamInvitationsRolesAndAudit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MailTransport = "file"
+	cfg.MailDir = t.TempDir()
+	r := mustRouterWithConfig(t, cfg)
+
+	ownerToken, productID := createApprovedVendorProduct(t, r, "team-owner@example.com", "team-vendor", 1999, 5)
+	admin := loginOrRegisterUser(t, r, "admin@example.com")
+	catalog := registerUser(t, r, "team-catalog@example.com")
+	packer := registerUser(t, r, "team-packer@example.com")
+	stranger := registerUser(t, r, "team-stranger@example.com")
+
+	invite := func(email, role string) string {
+		t.Helper()
+		rr := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/team/invitations", map[string]string{"email": email, "role": role}, ownerToken)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("invite %s status=%d body=%s", email, rr.Code, rr.Body.String())
+		}
+		return mailedToken(t, cfg.MailDir, "vendor_team_invitation")
+	}
+	accept := func(token, accessToken string) (*httptest.ResponseRecorder, authPayload) {
+		t.Helper()
+		rr := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/invitations/accept", map[string]string{"token": token}, accessToken)
+		var payload authPayload
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+		}
+		return rr, payload
+	}
+
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/team/invitations", map[string]string{"email": "x@example.com", "role": "janitor"}, ownerToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown role to be rejected, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	catalogToken := invite("Team-Catalog@example.com", "catalog_manager")
+	if rr, _ := accept(catalogToken, stranger.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected another email to be refused, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr, catalogMember := accept(catalogToken, catalog.AccessToken)
+	if rr.Code != http.StatusOK || catalogMember.User.Role != "vendor_catalog_manager" || catalogMember.User.VendorID == nil {
+		t.Fatalf("accept status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr, _ := accept(catalogToken, stranger.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a used invitation to be rejected, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, catalog.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the pre-join session to end, status=%d", rr.Code)
+	}
+
+	products := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/products", nil, catalogMember.AccessToken)
+	if products.Code != http.StatusOK || !strings.Contains(products.Body.String(), productID) {
+		t.Fatalf("expected the catalog manager to see team products, status=%d body=%s", products.Code, products.Body.String())
+	}
+	for _, path := range []string{"/api/v1/vendor/shipments", "/api/v1/vendor/team", "/api/v1/vendor/analytics/overview"} {
+		if rr := requestJSON(t, r, http.MethodGet, path, nil, catalogMember.AccessToken); rr.Code != http.StatusForbidden {
+			t.Fatalf("expected catalog manager to be refused %s, status=%d", path, rr.Code)
+		}
+	}
+
+	_, packerMember := accept(invite("team-packer@example.com", "fulfilment"), packer.AccessToken)
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, packerMember.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("fulfilment shipments status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/products", nil, packerMember.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected fulfilment to be refused products, status=%d", rr.Code)
+	}
+
+	invite("team-admin@example.com", "finance")
+	adminInvite := invite("admin@example.com", "finance")
+	if rr, _ := accept(adminInvite, admin.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected staff to be refused, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	team := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/team", nil, ownerToken)
+	var teamBody struct {
+		Members []struct {
+			UserID       string `json:"user_id"`
+			Email        string `json:"email"`
+			Role         string `json:"role"`
+			PrimaryOwner bool   `json:"primary_owner"`
+		} `json:"members"`
+		Invitations []struct {
+			ID    string `json:"id"`
+			Email string `json:"email"`
+		} `json:"invitations"`
+	}
+	if err := json.Unmarshal(team.Body.Bytes(), &teamBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(teamBody.Members) != 3 || !teamBody.Members[0].PrimaryOwner || teamBody.Members[0].Role != "owner" || len(teamBody.Invitations) != 2 {
+		t.Fatalf("unexpected team: %s", team.Body.String())
+	}
+	for _, invitation := range teamBody.Invitations {
+		if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/vendor/team/invitations/"+invitation.ID, nil, ownerToken); rr.Code != http.StatusOK {
+			t.Fatalf("revoke invitation status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+	if rr, _ := accept(adminInvite, stranger.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a revoked invitation to be rejected, status=%d", rr.Code)
+	}
+
+	ownerID := teamBody.Members[0].UserID
+	if rr := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/team/members/"+ownerID, map[string]string{"role": "finance"}, ownerToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected the primary owner demotion to conflict, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/vendor/team/members/"+ownerID, nil, ownerToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected the primary owner removal to conflict, status=%d", rr.Code)
+	}
+
+	updated := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/team/members/"+catalogMember.User.ID, map[string]string{"role": "finance"}, ownerToken)
+	if updated.Code != http.StatusOK || !strings.Contains(updated.Body.String(), `"role":"finance"`) {
+		t.Fatalf("update member status=%d body=%s", updated.Code, updated.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": catalogMember.RefreshToken}, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the role change to end the member's sessions, status=%d", rr.Code)
+	}
+	financeMember := loginUser(t, r, "team-catalog@example.com")
+	if financeMember.User.Role != "vendor_finance" {
+		t.Fatalf("expected the new role after signing in again, got %+v", financeMember.User)
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/analytics/overview", nil, financeMember.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("finance analytics status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/vendor/team/members/"+packerMember.User.ID, nil, ownerToken); rr.Code != http.StatusOK {
+		t.Fatalf("remove member status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, packerMember.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the removed member to be signed out, status=%d", rr.Code)
+	}
+	if relogin := loginUser(t, r, "team-packer@example.com"); relogin.User.Role != "buyer" || relogin.User.VendorID != nil {
+		t.Fatalf("expected the removed member to be a buyer again, got %+v", relogin.User)
+	}
+
+	for _, action := range []string{"vendor_team_invitation_created", "vendor_team_member_joined", "vendor_team_invitation_revoked", "vendor_team_member_role_updated", "vendor_team_member_removed"} {
+		logs := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?action="+action, nil, admin.AccessToken)
+		if logs.Code != http.StatusOK || !strings.Contains(logs.Body.String(), `"action":"`+action+`"`) {
+			t.Fatalf("expected %s audit entries, status=%d body=%s", action, logs.Code, logs.Body.String())
+		}
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/auth/sessions?keep_current=true", nil, financeMember.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("revoke other sessions status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	memberLogs := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?action=auth_sessions_revoked&actor_type=vendor&actor_id="+financeMember.User.ID, nil, admin.AccessToken)
+	if !strings.Contains(memberLogs.Body.String(), `"actor_role":"vendor_finance"`) {
+		t.Fatalf("expected team members to be audited as vendor actors, body=%s", memberLogs.Body.String())
+	}
+}
+
+func TestVendorFinanceMemberReachesPayoutsAndInvoices(t *testing.T) {
+	cfg := testConfig()
+	cfg.MailTransport = "file"
+	cfg.MailDir = t.TempDir()
+	r := mustRouterWithConfig(t, cfg)
+
+	ownerToken, _ := createApprovedVendorProduct(t, r, "finance-owner@example.com", "finance-vendor", 1999, 5)
+	accountant := registerUser(t, r, "team-accountant@example.com")
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/team/invitations", map[string]string{"email": "team-accountant@example.com", "role": "finance"}, ownerToken); rr.Code != http.StatusCreated {
+		t.Fatalf("invite status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	accepted := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/invitations/accept", map[string]string{"token": mailedToken(t, cfg.MailDir, "vendor_team_invitation")}, accountant.AccessToken)
+	var member authPayload
+	if err := json.Unmarshal(accepted.Body.Bytes(), &member); err != nil || member.User.Role != "vendor_finance" {
+		t.Fatalf("accept status=%d body=%s", accepted.Code, accepted.Body.String())
+	}
+
+	for _, path := range []string{"/api/v1/vendor/payouts", "/api/v1/vendor/payouts/cod-balance", "/api/v1/vendor/invoices"} {
+		if rr := requestJSON(t, r, http.MethodGet, path, nil, member.AccessToken); rr.Code != http.StatusOK {
+			t.Fatalf("expected finance member to reach %s, status=%d body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/team", nil, member.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected finance member to be refused the team, status=%d", rr.Code)
+	}
+}
+
+func TestDemotedVendorOwnerLosesOwnerToken(t *testing.T) {
+	cfg := testConfig()
+	cfg.MailTransport = "file"
+	cfg.MailDir = t.TempDir()
+	r := mustRouterWithConfig(t, cfg)
+
+	ownerToken, _ := createApprovedVendorProduct(t, r, "demote-owner@example.com", "demote-vendor", 1999, 5)
+	coOwner := registerUser(t, r, "demote-co-owner@example.com")
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/team/invitations", map[string]string{"email": "demote-co-owner@example.com", "role": "owner"}, ownerToken); rr.Code != http.StatusCreated {
+		t.Fatalf("invite status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	accepted := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/invitations/accept", map[string]string{"token": mailedToken(t, cfg.MailDir, "vendor_team_invitation")}, coOwner.AccessToken)
+	var member authPayload
+	if err := json.Unmarshal(accepted.Body.Bytes(), &member); err != nil || member.User.Role != "vendor_owner" {
+		t.Fatalf("accept status=%d body=%s", accepted.Code, accepted.Body.String())
+	}
+
+	if rr := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/team/members/"+member.User.ID, map[string]string{"role": "fulfilment"}, ownerToken); rr.Code != http.StatusOK {
+		t.Fatalf("demote status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/team/members/"+member.User.ID, map[string]string{"role": "owner"}, member.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the demoted owner's token to be rejected, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": member.RefreshToken}, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the demoted owner's refresh token to be rejected, status=%d", rr.Code)
+	}
+	if relogin := loginUser(t, r, "demote-co-owner@example.com"); relogin.User.Role != "vendor_fulfilment" {
+		t.Fatalf("expected the demoted role after signing in again, got %+v", relogin.User)
+	}
+}
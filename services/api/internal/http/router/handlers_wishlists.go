@@ -0,0 +1,275 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+	"github.com/yxshee/marketplace-platform/services/api/internal/catalog"
+	"github.com/yxshee/marketplace-platform/services/api/internal/wishlists"
+)
+
+type wishlistNameRequest struct {
+	Name string `json:"name"`
+}
+
+type wishlistAddItemRequest struct {
+	ProductID string `json:"product_id"`
+}
+
+type productAlertCreateRequest struct {
+	ProductID           string `json:"product_id"`
+	Kind                string `json:"kind"`
+	PriceThresholdCents int64  `json:"price_threshold_cents"`
+}
+
+// wishlistItemView attaches the current catalog listing to a saved product.
+// Product is omitted once the listing is no longer visible to buyers.
+type wishlistItemView struct {
+	wishlists.Item
+	Product *catalog.Product `json:"product,omitempty"`
+}
+
+type wishlistView struct {
+	wishlists.Wishlist
+	Items []wishlistItemView `json:"items"`
+}
+
+func (a *api) handleWishlistsList(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	lists := a.wishlists.ListForBuyer(identity.UserID)
+	items := make([]wishlistView, 0, len(lists))
+	for _, list := range lists {
+		items = append(items, a.wishlistView(list))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (a *api) handleWishlistCreate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req wishlistNameRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	list, err := a.wishlists.CreateList(identity.UserID, req.Name)
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, a.wishlistView(list))
+}
+
+func (a *api) handleWishlistGet(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	list, err := a.wishlists.GetList(identity.UserID, chi.URLParam(r, "wishlistID"))
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.wishlistView(list))
+}
+
+func (a *api) handleWishlistRename(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req wishlistNameRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	list, err := a.wishlists.RenameList(identity.UserID, chi.URLParam(r, "wishlistID"), req.Name)
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.wishlistView(list))
+}
+
+func (a *api) handleWishlistDelete(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	if err := a.wishlists.DeleteList(identity.UserID, chi.URLParam(r, "wishlistID")); err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) handleWishlistAddItem(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req wishlistAddItemRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	product, err := a.checkoutProduct(req.ProductID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	list, err := a.wishlists.AddItem(identity.UserID, chi.URLParam(r, "wishlistID"), product.ID)
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.wishlistView(list))
+}
+
+func (a *api) handleWishlistRemoveItem(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	list, err := a.wishlists.RemoveItem(identity.UserID, chi.URLParam(r, "wishlistID"), chi.URLParam(r, "productID"))
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.wishlistView(list))
+}
+
+func (a *api) handleProductAlertsList(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": a.wishlists.ListAlerts(identity.UserID),
+	})
+}
+
+func (a *api) handleProductAlertCreate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req productAlertCreateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	product, err := a.checkoutProduct(req.ProductID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	kind := wishlists.AlertKind(strings.ToLower(strings.TrimSpace(req.Kind)))
+	alert, err := a.wishlists.Subscribe(identity.UserID, product.ID, kind, req.PriceThresholdCents)
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, alert)
+}
+
+func (a *api) handleProductAlertDelete(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	if err := a.wishlists.Unsubscribe(identity.UserID, chi.URLParam(r, "alertID")); err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) handleNotificationsList(w http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	limit, offset, err := parsePagination(r, 20, 100)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := a.notifications.List(strings.TrimSpace(r.URL.Query().Get("kind")), identity.UserID)
+	total := len(items)
+	start, end := paginate(total, limit, offset)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":  items[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (a *api) wishlistView(list wishlists.Wishlist) wishlistView {
+	items := make([]wishlistItemView, 0, len(list.Items))
+	for _, item := range list.Items {
+		view := wishlistItemView{Item: item}
+		if product, err := a.checkoutProduct(item.ProductID); err == nil {
+			view.Product = &product
+		}
+		items = append(items, view)
+	}
+	return wishlistView{Wishlist: list, Items: items}
+}
+
+func writeWishlistError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, wishlists.ErrWishlistNotFound):
+		writeError(w, http.StatusNotFound, "wishlist not found")
+	case errors.Is(err, wishlists.ErrItemNotFound):
+		writeError(w, http.StatusNotFound, "wishlist item not found")
+	case errors.Is(err, wishlists.ErrAlertNotFound):
+		writeError(w, http.StatusNotFound, "product alert not found")
+	case errors.Is(err, wishlists.ErrWishlistNameInUse):
+		writeError(w, http.StatusConflict, "wishlist name already in use")
+	case errors.Is(err, wishlists.ErrWishlistLimitReached):
+		writeError(w, http.StatusConflict, "wishlist limit reached")
+	case errors.Is(err, wishlists.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, "invalid wishlist request")
+	default:
+		writeError(w, http.StatusBadRequest, "unable to update wishlist")
+	}
+}
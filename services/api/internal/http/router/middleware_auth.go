@@ -15,7 +15,7 @@ func (a *api) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), *identity)))
+		a.serveIdentity(w, r, *identity, next)
 	})
 }
 
@@ -33,10 +33,64 @@ func (a *api) optionalAuthenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), *identity)))
+		a.serveIdentity(w, r, *identity, next)
 	})
 }
 
+// serveIdentity runs next as the identity. Impersonated requests are
+// read-only unless the impersonation is elevated, never change the subject's
+// account, and are each recorded in the audit log under the real actor. GET
+// routes that write are wrapped in writesOnRead.
+func (a *api) serveIdentity(w http.ResponseWriter, r *http.Request, identity auth.Identity, next http.Handler) {
+	r = r.WithContext(auth.WithIdentity(r.Context(), identity))
+	if !identity.Impersonated() {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		next.ServeHTTP(recorder, r)
+	case strings.HasPrefix(r.URL.Path, "/api/v1/auth/"):
+		writeError(recorder, http.StatusForbidden, "account settings cannot be changed while impersonating")
+	case !identity.Elevated:
+		writeError(recorder, http.StatusForbidden, "impersonation is read-only")
+	default:
+		next.ServeHTTP(recorder, r)
+	}
+
+	a.recordAuditLog(r, "impersonated_request", "user", identity.UserID, nil, nil, map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"status": recorder.status,
+	})
+}
+
+// writesOnRead marks GET routes that change state, such as issuing invoices
+// on first view or syncing a payment with its provider. Read-only
+// impersonations are refused them.
+func writesOnRead(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity, ok := auth.IdentityFromContext(r.Context()); ok && identity.Impersonated() && !identity.Elevated {
+			writeError(w, http.StatusForbidden, "impersonation is read-only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the status code a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
 func (a *api) requirePermission(permission auth.Permission) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -46,10 +100,14 @@ func (a *api) requirePermission(permission auth.Permission) func(http.Handler) h
 				return
 			}
 
-			if err := auth.MustBeAllowed(identity.Role, permission); err != nil {
+			if !identity.Allowed(permission) {
 				writeError(w, http.StatusForbidden, "forbidden")
 				return
 			}
+			if auth.IsPrivileged(permission) && !identity.MFAVerified && a.authService.MFARequired(identity.UserID, identity.Role) {
+				writeError(w, http.StatusForbidden, "multi-factor authentication required")
+				return
+			}
 
 			next.ServeHTTP(w, r)
 		})
@@ -66,12 +124,37 @@ func (a *api) parseAccessIdentity(authorizationHeader string) (*auth.Identity, e
 	if err != nil {
 		return nil, err
 	}
+	if !a.authService.KnownRole(claims.Role) {
+		return nil, auth.ErrInvalidToken
+	}
 
 	identity := &auth.Identity{
-		UserID:    claims.UserID,
-		Role:      claims.Role,
-		SessionID: claims.SessionID,
-		VendorID:  claims.VendorID,
+		UserID:      claims.UserID,
+		Role:        claims.Role,
+		SessionID:   claims.SessionID,
+		VendorID:    claims.VendorID,
+		MFAVerified: claims.MFAVerified,
+		Permissions: a.authService.LivePermissions(claims.Role, claims.Permissions),
+	}
+
+	// Impersonation tokens live as long as their impersonation, which can be
+	// ended early; the stored record decides whether writes are allowed.
+	if claims.ImpersonatorID != "" {
+		impersonation, active := a.authService.ActiveImpersonation(claims.SessionID)
+		if !active || impersonation.SubjectID != claims.UserID || impersonation.ImpersonatorID != claims.ImpersonatorID {
+			return nil, auth.ErrInvalidToken
+		}
+		identity.ImpersonatorID = impersonation.ImpersonatorID
+		identity.ImpersonatorRole = impersonation.ImpersonatorRole
+		identity.Elevated = impersonation.Elevated
+		return identity, nil
+	}
+
+	// Access tokens die with their session, so revoking a session signs the
+	// device out right away rather than when its access token expires.
+	session, exists := a.authService.GetSession(claims.SessionID)
+	if !exists || session.UserID != claims.UserID {
+		return nil, auth.ErrInvalidToken
 	}
 	return identity, nil
 }
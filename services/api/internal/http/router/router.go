@@ -1,8 +1,12 @@
 package router
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -10,15 +14,25 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/yxshee/marketplace-platform/services/api/internal/auditlog"
 	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+	"github.com/yxshee/marketplace-platform/services/api/internal/blobstore"
+	"github.com/yxshee/marketplace-platform/services/api/internal/carriers"
+	"github.com/yxshee/marketplace-platform/services/api/internal/cartrecovery"
 	"github.com/yxshee/marketplace-platform/services/api/internal/catalog"
 	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
 	"github.com/yxshee/marketplace-platform/services/api/internal/config"
 	"github.com/yxshee/marketplace-platform/services/api/internal/coupons"
+	"github.com/yxshee/marketplace-platform/services/api/internal/currency"
+	"github.com/yxshee/marketplace-platform/services/api/internal/disputes"
 	"github.com/yxshee/marketplace-platform/services/api/internal/invoices"
+	"github.com/yxshee/marketplace-platform/services/api/internal/mailer"
+	"github.com/yxshee/marketplace-platform/services/api/internal/notifications"
+	"github.com/yxshee/marketplace-platform/services/api/internal/oidc"
 	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
 	"github.com/yxshee/marketplace-platform/services/api/internal/promotions"
+	"github.com/yxshee/marketplace-platform/services/api/internal/reconciliation"
 	"github.com/yxshee/marketplace-platform/services/api/internal/refunds"
 	"github.com/yxshee/marketplace-platform/services/api/internal/vendors"
+	"github.com/yxshee/marketplace-platform/services/api/internal/wishlists"
 )
 
 type healthResponse struct {
@@ -28,18 +42,36 @@ type healthResponse struct {
 }
 
 type api struct {
-	authService    *auth.Service
-	tokenManager   *auth.TokenManager
-	vendorService  *vendors.Service
-	catalogService *catalog.Service
-	coupons        *coupons.Service
-	promotions     *promotions.Service
-	auditLogs      *auditlog.Service
-	commerce       *commerce.Service
-	invoices       *invoices.Service
-	payments       *payments.Service
-	refunds        *refunds.Service
-	defaultCommBPS int32
+	authService       *auth.Service
+	tokenManager      *auth.TokenManager
+	vendorService     *vendors.Service
+	catalogService    *catalog.Service
+	coupons           *coupons.Service
+	promotions        *promotions.Service
+	auditLogs         *auditlog.Service
+	commerce          *commerce.Service
+	invoices          *invoices.Service
+	payments          *payments.Service
+	refunds           *refunds.Service
+	disputes          *disputes.Service
+	carriers          *carriers.Service
+	currency          *currency.Service
+	notifications     *notifications.Outbox
+	cartRecovery      *cartrecovery.Service
+	reconciliation    *reconciliation.Service
+	wishlists         *wishlists.Service
+	reportingCurrency string
+	defaultCommBPS    int32
+	mailer            mailer.Mailer
+	accountEmails     accountEmailSettings
+	mfa               mfaSettings
+	oidc              *oidc.Service
+	// secureCookies marks cookies Secure when the web app is served over HTTPS.
+	secureCookies bool
+	// vendorInvitationTTL is how long vendor team invitations stay valid.
+	vendorInvitationTTL time.Duration
+	// impersonationTTL is how long an impersonation token lasts.
+	impersonationTTL time.Duration
 }
 
 func healthHandler(w http.ResponseWriter, _ *http.Request) {
@@ -52,10 +84,30 @@ func healthHandler(w http.ResponseWriter, _ *http.Request) {
 }
 
 // New creates a production-ready chi router with baseline middleware and routes.
-func New(cfg config.Config) (http.Handler, error) {
+// Background workers (carrier polling, cart recovery, payment sweeps, webhook
+// retries, reconciliation and invoice purges) run until ctx is cancelled.
+func New(ctx context.Context, cfg config.Config) (http.Handler, error) {
+	handler, _, err := newRouter(ctx, cfg)
+	return handler, err
+}
+
+// newRouter builds the router behind New. The returned channel is closed once
+// every background worker it started has stopped.
+func newRouter(ctx context.Context, cfg config.Config) (http.Handler, <-chan struct{}, error) {
 	tokenManager, err := auth.NewTokenManager(cfg.JWTSecret, cfg.JWTIssuer, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if strings.TrimSpace(cfg.JWTSigningKeys) != "" {
+		signingKeys, err := auth.LoadSigningKeys(cfg.JWTSigningKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		keySet, err := auth.NewKeySet(signingKeys, cfg.JWTActiveKeyID, cfg.JWTKeyGracePeriod)
+		if err != nil {
+			return nil, nil, err
+		}
+		tokenManager.UseKeySet(keySet)
 	}
 
 	authService := auth.NewService(auth.BuildBootstrapRoleMap(
@@ -64,50 +116,236 @@ func New(cfg config.Config) (http.Handler, error) {
 		cfg.FinanceEmails,
 		cfg.CatalogModEmails,
 	))
+	tokenManager.UseRolePermissions(authService.RolePermissions)
+	if err := authService.SetMFARequiredRoles(parseRoleList(cfg.MFARequiredRoles)); err != nil {
+		return nil, nil, fmt.Errorf("invalid mfa required roles: %w", err)
+	}
 
 	var stripeClient payments.StripeClient = payments.NewMockStripeClient()
 	if strings.EqualFold(strings.TrimSpace(cfg.StripeMode), "live") {
 		stripeClient = payments.NewLiveStripeClient(cfg.StripeSecretKey)
 	}
 
+	currencyService, err := newCurrencyService(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	reportingCurrency, err := currency.NormalizeCode(valueOrDefault(cfg.ReportingCurrency, currencyService.BaseCurrency()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid reporting currency %q: %w", cfg.ReportingCurrency, err)
+	}
+
 	commerceService := commerce.NewService(500)
-	apiHandlers := &api{
-		authService:    authService,
-		tokenManager:   tokenManager,
-		vendorService:  vendors.NewService(),
-		catalogService: catalog.NewService(),
-		coupons:        coupons.NewService(),
-		promotions:     promotions.NewService(),
-		auditLogs:      auditlog.NewService(),
-		commerce:       commerceService,
-		invoices: invoices.NewService(invoices.Config{
-			PlatformName:         "Marketplace Platform",
-			PlatformLegalEntity:  "Marketplace Platform LLC",
-			PlatformSupportEmail: "support@marketplace.local",
-			PlatformAddress:      "Global operations",
-		}),
-		defaultCommBPS: cfg.DefaultCommission,
-		payments: payments.NewService(payments.Config{
-			WebhookSecret: cfg.StripeWebhookSecret,
-			StripeClient:  stripeClient,
-			MarkOrderPaid: func(orderID string) bool {
-				_, ok := commerceService.MarkOrderPaid(orderID)
-				return ok
-			},
-			MarkOrderPaymentFailed: func(orderID string) bool {
-				_, ok := commerceService.MarkOrderPaymentFailed(orderID)
-				return ok
-			},
-			MarkOrderCODConfirmed: func(orderID string) bool {
-				_, ok := commerceService.MarkOrderCODConfirmed(orderID)
-				return ok
-			},
+	commerceService.ConfigureCurrency(currencyService, reportingCurrency)
+	// Carrier scans settle COD payments through the handlers built below.
+	var apiHandlers *api
+	adapters, err := carrierAdapters(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	carrierService := carriers.NewService(carriers.Config{
+		Adapters: adapters,
+		ApplyScan: func(event carriers.ScanEvent) bool {
+			return apiHandlers.applyCarrierScan(event)
+		},
+	})
+	couponService := coupons.NewService()
+	notificationOutbox := notifications.NewOutbox(notifications.LogNotifier{}, 1000)
+	cartRecoveryService := cartrecovery.NewService(cartrecovery.Config{
+		IdleThreshold: cfg.CartRecoveryIdle,
+		Retention:     cfg.CartRetention,
+		Notifier:      notificationOutbox,
+		ListIdleCarts: func(idleSince time.Time) []cartrecovery.Cart {
+			idleCarts := commerceService.ListIdleBuyerCarts(idleSince)
+			items := make([]cartrecovery.Cart, 0, len(idleCarts))
+			for _, cart := range idleCarts {
+				items = append(items, cartrecovery.Cart{
+					CartID:        cart.CartID,
+					BuyerUserID:   cart.BuyerUserID,
+					Currency:      cart.Currency,
+					ItemCount:     cart.ItemCount,
+					SubtotalCents: cart.SubtotalCents,
+					UpdatedAt:     cart.UpdatedAt,
+				})
+			}
+			return items
+		},
+		ExpireCarts: commerceService.ExpireIdleCarts,
+		IssueCoupon: recoveryCouponIssuer(couponService, cfg.CartRecoveryCoupon),
+	})
+	catalogService := catalog.NewService()
+	wishlistService := wishlists.NewService(wishlists.Config{Notifier: notificationOutbox})
+	catalogService.OnProductUpdated(func(previous, updated catalog.Product) {
+		if updated.StockQty > previous.StockQty {
+			commerceService.AllocateArrivedStock(updated.ID, updated.StockQty-previous.StockQty)
+		}
+		wishlistService.ProductChanged(context.Background(), wishlists.ProductChange{
+			ProductID:          updated.ID,
+			Title:              updated.Title,
+			Currency:           updated.Currency,
+			PreviousStockQty:   previous.StockQty,
+			StockQty:           updated.StockQty,
+			PreviousPriceCents: previous.PriceInclTaxCents,
+			PriceCents:         updated.PriceInclTaxCents,
+		})
+	})
+
+	paymentProviders, err := newPaymentProviders(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	paymentEvents, err := newPaymentEventStore(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	paymentService := payments.NewService(payments.Config{
+		WebhookSecret: cfg.StripeWebhookSecret,
+		StripeClient:  stripeClient,
+		MarkOrderPaid: func(orderID string) bool {
+			_, ok := commerceService.MarkOrderPaid(orderID)
+			if ok {
+				apiHandlers.issueOrderInvoices(context.Background(), orderID)
+			}
+			return ok
+		},
+		MarkOrderPaymentFailed: func(orderID string) bool {
+			_, ok := commerceService.MarkOrderPaymentFailed(orderID)
+			return ok
+		},
+		MarkOrderCODConfirmed: func(orderID string) bool {
+			_, ok := commerceService.MarkOrderCODConfirmed(orderID)
+			if ok {
+				apiHandlers.issueOrderInvoices(context.Background(), orderID)
+			}
+			return ok
+		},
+		MarkOrderExpired: func(orderID string) bool {
+			_, ok := commerceService.MarkOrderExpired(orderID)
+			return ok
+		},
+		ReauthorizeWindow:  cfg.PaymentReauthWindow,
+		PendingPaymentTTL:  cfg.PaymentPendingTTL,
+		CODRefusalLimit:    cfg.CODRefusalLimit,
+		Providers:          paymentProviders,
+		EventStore:         paymentEvents,
+		WebhookMaxAttempts: cfg.WebhookMaxAttempts,
+	})
+
+	reconciliationService := reconciliation.NewService(reconciliation.Config{
+		Window:       cfg.ReconcileWindow,
+		ListPayments: paymentService.ListPaymentRecords,
+		ListOrders: func() []commerce.Order {
+			orders, _ := commerceService.ListOrders("")
+			return orders
+		},
+		GetOrder: commerceService.GetOrderForAdmin,
+		Settle:   paymentService.SettlePaymentRecord,
+	})
+
+	accountMailer, err := newMailer(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	webBaseURL := strings.TrimRight(valueOrDefault(cfg.WebBaseURL, "http://localhost:3000"), "/")
+	oidcProviders, err := oidc.ParseProviderConfigs(cfg.OIDCProviders, cfg.OIDCClientIDs, cfg.OIDCClientSecrets)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid oidc providers: %w", err)
+	}
+
+	invoiceStore, err := newInvoiceStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	invoiceLocale, err := invoices.NormalizeLocale(cfg.InvoiceLocale)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid invoice locale %q: %w", cfg.InvoiceLocale, err)
+	}
+	invoiceBranding, err := newInvoiceBranding(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	invoiceService := invoices.NewService(invoices.Config{
+		PlatformName:         "Marketplace Platform",
+		PlatformLegalEntity:  "Marketplace Platform LLC",
+		PlatformSupportEmail: "support@marketplace.local",
+		PlatformAddress:      "Global operations",
+		PlatformCountryCode:  "US",
+		Vendor: func(vendorID string) (invoices.VendorDetails, bool) {
+			return apiHandlers.invoiceVendorDetails(vendorID)
+		},
+		Store:     invoiceStore,
+		Retention: cfg.InvoiceRetention,
+		Locale:    invoiceLocale,
+		Branding:  invoiceBranding,
+	})
+	if err := invoiceService.Restore(ctx); err != nil {
+		return nil, nil, fmt.Errorf("restore invoices: %w", err)
+	}
+
+	apiHandlers = &api{
+		authService:       authService,
+		tokenManager:      tokenManager,
+		vendorService:     vendors.NewService(),
+		catalogService:    catalogService,
+		coupons:           couponService,
+		promotions:        promotions.NewService(),
+		auditLogs:         auditlog.NewService(),
+		commerce:          commerceService,
+		invoices:          invoiceService,
+		defaultCommBPS:    cfg.DefaultCommission,
+		payments:          paymentService,
+		refunds:           refunds.NewService(),
+		disputes:          disputes.NewService(),
+		carriers:          carrierService,
+		currency:          currencyService,
+		notifications:     notificationOutbox,
+		cartRecovery:      cartRecoveryService,
+		reconciliation:    reconciliationService,
+		wishlists:         wishlistService,
+		reportingCurrency: reportingCurrency,
+		mailer:            accountMailer,
+		accountEmails: accountEmailSettings{
+			webBaseURL:      webBaseURL,
+			verificationTTL: valueOrDefaultDuration(cfg.EmailVerificationTTL, 24*time.Hour),
+			resetTTL:        valueOrDefaultDuration(cfg.PasswordResetTTL, time.Hour),
+			requireVerified: cfg.RequireVerifiedEmail,
+		},
+		vendorInvitationTTL: valueOrDefaultDuration(cfg.VendorInvitationTTL, 7*24*time.Hour),
+		impersonationTTL:    valueOrDefaultDuration(cfg.ImpersonationTTL, 15*time.Minute),
+		secureCookies:       strings.HasPrefix(webBaseURL, "https://"),
+		oidc: oidc.NewService(oidc.Config{
+			Providers:       oidcProviders,
+			RedirectBaseURL: webBaseURL,
+			StateTTL:        cfg.OIDCStateTTL,
 		}),
-		refunds: refunds.NewService(),
+		mfa: mfaSettings{
+			issuer:       valueOrDefault(cfg.MFAIssuer, "Marketplace"),
+			challengeTTL: valueOrDefaultDuration(cfg.MFAChallengeTTL, 5*time.Minute),
+		},
 	}
+	paymentService.OnDispute(apiHandlers.recordStripeDispute)
 	if cfg.Environment == "development" {
 		apiHandlers.seedDevelopmentCatalog()
 	}
+	var workers []<-chan struct{}
+	if cfg.CarrierPollInterval > 0 {
+		workers = append(workers, carrierService.Run(ctx, cfg.CarrierPollInterval))
+	}
+	if cfg.CartRecoveryInterval > 0 {
+		workers = append(workers, cartRecoveryService.Start(ctx, cfg.CartRecoveryInterval))
+	}
+	if cfg.PaymentSweepInterval > 0 {
+		workers = append(workers, paymentService.Run(ctx, cfg.PaymentSweepInterval))
+	}
+	if cfg.WebhookRetryInterval > 0 {
+		workers = append(workers, paymentService.RunWebhookRetries(ctx, cfg.WebhookRetryInterval))
+	}
+	if cfg.ReconcileInterval > 0 {
+		workers = append(workers, reconciliationService.Start(ctx, cfg.ReconcileInterval))
+	}
+	if cfg.InvoicePurgeInterval > 0 {
+		workers = append(workers, invoiceService.Run(ctx, cfg.InvoicePurgeInterval))
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
@@ -134,6 +372,7 @@ func New(cfg config.Config) (http.Handler, error) {
 
 	r.Get("/health", healthHandler)
 	r.Get("/healthz", healthHandler)
+	r.Get("/.well-known/jwks.json", apiHandlers.handleJWKS)
 
 	r.Route("/api/v1", func(v1 chi.Router) {
 		v1.Get("/health", healthHandler)
@@ -141,7 +380,10 @@ func New(cfg config.Config) (http.Handler, error) {
 		v1.Get("/catalog/categories", apiHandlers.handleCatalogCategories)
 		v1.Get("/catalog/products", apiHandlers.handleCatalogList)
 		v1.Get("/catalog/products/{productID}", apiHandlers.handleCatalogProductDetail)
+		v1.Get("/currencies", apiHandlers.handleCurrencyList)
 		v1.Post("/webhooks/stripe", apiHandlers.handleStripeWebhook)
+		v1.Post("/webhooks/carriers/{carrierCode}", apiHandlers.handleCarrierWebhook)
+		v1.Post("/webhooks/payments/{provider}", apiHandlers.handleProviderWebhook)
 
 		v1.Group(func(buyerFlow chi.Router) {
 			buyerFlow.Use(apiHandlers.optionalAuthenticate)
@@ -149,28 +391,65 @@ func New(cfg config.Config) (http.Handler, error) {
 			buyerFlow.Post("/cart/items", apiHandlers.handleCartAddItem)
 			buyerFlow.Patch("/cart/items/{itemID}", apiHandlers.handleCartUpdateItem)
 			buyerFlow.Delete("/cart/items/{itemID}", apiHandlers.handleCartDeleteItem)
+			buyerFlow.Put("/cart/currency", apiHandlers.handleCartSetCurrency)
 			buyerFlow.Post("/checkout/quote", apiHandlers.handleCheckoutQuote)
 			buyerFlow.Post("/checkout/place-order", apiHandlers.handleCheckoutPlaceOrder)
 			buyerFlow.Get("/payments/settings", apiHandlers.handleBuyerPaymentSettingsGet)
 			buyerFlow.Post("/payments/stripe/intent", apiHandlers.handleStripeCreateIntent)
 			buyerFlow.Post("/payments/cod/confirm", apiHandlers.handleCODConfirmPayment)
+			buyerFlow.With(writesOnRead).Get("/payments/{paymentID}", apiHandlers.handlePaymentStatus)
+			buyerFlow.Post("/payments/providers/{provider}/intent", apiHandlers.handleProviderCreatePayment)
+			buyerFlow.Post("/payments/providers/{provider}/confirm", apiHandlers.handleProviderConfirmPayment)
 			buyerFlow.Get("/orders/{orderID}", apiHandlers.handleOrderByID)
 			buyerFlow.Post("/orders/{orderID}/refund-requests", apiHandlers.handleBuyerCreateRefundRequest)
-			buyerFlow.Get("/invoices/{orderID}/download", apiHandlers.handleInvoiceDownload)
+			buyerFlow.With(writesOnRead).Get("/invoices/{orderID}", apiHandlers.handleInvoiceList)
+			buyerFlow.With(writesOnRead).Get("/invoices/{orderID}/download", apiHandlers.handleInvoiceDownload)
 		})
 
 		v1.With(authRateLimitMiddleware).Post("/auth/register", apiHandlers.handleAuthRegister)
 		v1.With(authRateLimitMiddleware).Post("/auth/login", apiHandlers.handleAuthLogin)
 		v1.With(authRateLimitMiddleware).Post("/auth/refresh", apiHandlers.handleAuthRefresh)
+		v1.With(authRateLimitMiddleware).Post("/auth/email-verification", apiHandlers.handleEmailVerificationRequest)
+		v1.With(authRateLimitMiddleware).Post("/auth/email-verification/confirm", apiHandlers.handleEmailVerificationConfirm)
+		v1.With(authRateLimitMiddleware).Post("/auth/password-reset", apiHandlers.handlePasswordResetRequest)
+		v1.With(authRateLimitMiddleware).Post("/auth/password-reset/confirm", apiHandlers.handlePasswordResetConfirm)
+		v1.With(authRateLimitMiddleware).Post("/auth/mfa/verify", apiHandlers.handleMFAVerify)
+		v1.Get("/auth/oidc/providers", apiHandlers.handleOIDCProviders)
+		v1.With(authRateLimitMiddleware).Post("/auth/oidc/{provider}/authorize", apiHandlers.handleOIDCAuthorize)
+		v1.With(authRateLimitMiddleware).Post("/auth/oidc/{provider}/callback", apiHandlers.handleOIDCCallback)
 
 		v1.Group(func(private chi.Router) {
 			private.Use(apiHandlers.authenticate)
 			private.Get("/auth/me", apiHandlers.handleAuthMe)
 			private.Post("/auth/logout", apiHandlers.handleAuthLogout)
+			private.Get("/auth/sessions", apiHandlers.handleSessionsList)
+			private.Delete("/auth/sessions", apiHandlers.handleSessionsRevokeAll)
+			private.Delete("/auth/sessions/{sessionID}", apiHandlers.handleSessionRevoke)
+			private.Get("/auth/mfa", apiHandlers.handleMFAStatus)
+			private.Post("/auth/mfa/enroll", apiHandlers.handleMFAEnroll)
+			private.With(authRateLimitMiddleware).Post("/auth/mfa/enroll/confirm", apiHandlers.handleMFAEnrollConfirm)
+			private.With(authRateLimitMiddleware).Post("/auth/mfa/disable", apiHandlers.handleMFADisable)
+			private.With(authRateLimitMiddleware).Post("/auth/mfa/recovery-codes", apiHandlers.handleMFARecoveryCodes)
+			private.Get("/auth/identities", apiHandlers.handleIdentitiesList)
+			private.Post("/auth/identities/{provider}", apiHandlers.handleIdentityLinkStart)
+			private.Delete("/auth/identities/{provider}", apiHandlers.handleIdentityUnlink)
+
+			private.Get("/notifications", apiHandlers.handleNotificationsList)
+			private.Get("/wishlists", apiHandlers.handleWishlistsList)
+			private.Post("/wishlists", apiHandlers.handleWishlistCreate)
+			private.Get("/wishlists/{wishlistID}", apiHandlers.handleWishlistGet)
+			private.Patch("/wishlists/{wishlistID}", apiHandlers.handleWishlistRename)
+			private.Delete("/wishlists/{wishlistID}", apiHandlers.handleWishlistDelete)
+			private.Post("/wishlists/{wishlistID}/items", apiHandlers.handleWishlistAddItem)
+			private.Delete("/wishlists/{wishlistID}/items/{productID}", apiHandlers.handleWishlistRemoveItem)
+			private.Get("/product-alerts", apiHandlers.handleProductAlertsList)
+			private.Post("/product-alerts", apiHandlers.handleProductAlertCreate)
+			private.Delete("/product-alerts/{alertID}", apiHandlers.handleProductAlertDelete)
 
 			private.Post("/vendors/register", apiHandlers.handleVendorRegister)
 			private.Get("/vendor/profile", apiHandlers.handleVendorVerificationStatus)
 			private.Get("/vendor/verification-status", apiHandlers.handleVendorVerificationStatus)
+			private.With(authRateLimitMiddleware).Post("/vendor/invitations/accept", apiHandlers.handleVendorInvitationAccept)
 
 			private.Group(func(vendorRoutes chi.Router) {
 				vendorRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageVendorProducts))
@@ -194,12 +473,17 @@ func New(cfg config.Config) (http.Handler, error) {
 				vendorRoutes.Get("/vendor/shipments", apiHandlers.handleVendorListShipments)
 				vendorRoutes.Get("/vendor/shipments/{shipmentID}", apiHandlers.handleVendorShipmentDetail)
 				vendorRoutes.Patch("/vendor/shipments/{shipmentID}/status", apiHandlers.handleVendorShipmentStatusUpdate)
+				vendorRoutes.Get("/vendor/shipments/carriers", apiHandlers.handleVendorShipmentCarriers)
+				vendorRoutes.Post("/vendor/shipments/{shipmentID}/cod-collection", apiHandlers.handleVendorCODCollection)
 			})
 
 			private.Group(func(vendorRoutes chi.Router) {
 				vendorRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageRefundDecisions))
 				vendorRoutes.Get("/vendor/refund-requests", apiHandlers.handleVendorListRefundRequests)
 				vendorRoutes.Patch("/vendor/refund-requests/{refundRequestID}/decision", apiHandlers.handleVendorRefundDecision)
+				vendorRoutes.Get("/vendor/disputes", apiHandlers.handleVendorListDisputes)
+				vendorRoutes.Get("/vendor/disputes/{disputeID}", apiHandlers.handleVendorDisputeDetail)
+				vendorRoutes.Post("/vendor/disputes/{disputeID}/evidence", apiHandlers.handleVendorSubmitDisputeEvidence)
 			})
 
 			private.Group(func(vendorRoutes chi.Router) {
@@ -209,6 +493,46 @@ func New(cfg config.Config) (http.Handler, error) {
 				vendorRoutes.Get("/vendor/analytics/coupons", apiHandlers.handleVendorAnalyticsCoupons)
 			})
 
+			private.Group(func(vendorRoutes chi.Router) {
+				vendorRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageVendorPayouts))
+				vendorRoutes.With(writesOnRead).Get("/vendor/connect", apiHandlers.handleVendorConnectStatus)
+				vendorRoutes.Post("/vendor/connect/onboarding", apiHandlers.handleVendorConnectOnboarding)
+				vendorRoutes.Get("/vendor/payouts", apiHandlers.handleVendorPayoutsList)
+				vendorRoutes.Get("/vendor/payouts/cod-balance", apiHandlers.handleVendorCODBalance)
+				vendorRoutes.Put("/vendor/legal-details", apiHandlers.handleVendorLegalDetailsUpdate)
+				vendorRoutes.Get("/vendor/invoices", apiHandlers.handleVendorInvoiceList)
+				vendorRoutes.Get("/vendor/invoices/{invoiceID}/download", apiHandlers.handleVendorInvoiceDownload)
+			})
+
+			private.Group(func(vendorRoutes chi.Router) {
+				vendorRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageVendorTeam))
+				vendorRoutes.Get("/vendor/team", apiHandlers.handleVendorTeam)
+				vendorRoutes.Post("/vendor/team/invitations", apiHandlers.handleVendorTeamInvite)
+				vendorRoutes.Delete("/vendor/team/invitations/{invitationID}", apiHandlers.handleVendorTeamInvitationRevoke)
+				vendorRoutes.Patch("/vendor/team/members/{userID}", apiHandlers.handleVendorTeamMemberUpdate)
+				vendorRoutes.Delete("/vendor/team/members/{userID}", apiHandlers.handleVendorTeamMemberRemove)
+			})
+
+			private.Group(func(adminRoutes chi.Router) {
+				adminRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageSecuritySettings))
+				adminRoutes.Get("/admin/security/mfa-policy", apiHandlers.handleAdminMFAPolicyGet)
+				adminRoutes.Put("/admin/security/mfa-policy", apiHandlers.handleAdminMFAPolicyPut)
+			})
+			private.Group(func(adminRoutes chi.Router) {
+				adminRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageRoles))
+				adminRoutes.Get("/admin/roles", apiHandlers.handleAdminRolesList)
+				adminRoutes.Post("/admin/roles", apiHandlers.handleAdminRoleCreate)
+				adminRoutes.Get("/admin/roles/{role}", apiHandlers.handleAdminRoleDetail)
+				adminRoutes.Put("/admin/roles/{role}", apiHandlers.handleAdminRoleUpdate)
+				adminRoutes.Delete("/admin/roles/{role}", apiHandlers.handleAdminRoleDelete)
+				adminRoutes.Put("/admin/users/{userID}/role", apiHandlers.handleAdminUserRoleAssign)
+			})
+			private.Group(func(adminRoutes chi.Router) {
+				adminRoutes.Use(apiHandlers.requirePermission(auth.PermissionImpersonateUsers))
+				adminRoutes.Get("/admin/impersonations", apiHandlers.handleAdminImpersonationsList)
+				adminRoutes.Post("/admin/impersonations", apiHandlers.handleAdminImpersonationStart)
+				adminRoutes.Delete("/admin/impersonations/{impersonationID}", apiHandlers.handleAdminImpersonationEnd)
+			})
 			private.Group(func(adminRoutes chi.Router) {
 				adminRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageVendorVerification))
 				adminRoutes.Get("/admin/vendors", apiHandlers.handleAdminVendorList)
@@ -231,6 +555,7 @@ func New(cfg config.Config) (http.Handler, error) {
 				adminRoutes.Get("/admin/orders", apiHandlers.handleAdminOrdersList)
 				adminRoutes.Get("/admin/orders/{orderID}", apiHandlers.handleAdminOrderDetail)
 				adminRoutes.Patch("/admin/orders/{orderID}/status", apiHandlers.handleAdminOrderStatusUpdate)
+				adminRoutes.Get("/admin/disputes", apiHandlers.handleAdminDisputesList)
 			})
 
 			private.Group(func(adminRoutes chi.Router) {
@@ -239,6 +564,7 @@ func New(cfg config.Config) (http.Handler, error) {
 				adminRoutes.Post("/admin/promotions", apiHandlers.handleAdminPromotionCreate)
 				adminRoutes.Patch("/admin/promotions/{promotionID}", apiHandlers.handleAdminPromotionUpdate)
 				adminRoutes.Delete("/admin/promotions/{promotionID}", apiHandlers.handleAdminPromotionDelete)
+				adminRoutes.Post("/admin/cart-recovery/run", apiHandlers.handleAdminCartRecoveryRun)
 			})
 
 			private.Group(func(adminRoutes chi.Router) {
@@ -251,15 +577,223 @@ func New(cfg config.Config) (http.Handler, error) {
 				adminRoutes.Get("/admin/dashboard/overview", apiHandlers.handleAdminDashboardOverview)
 				adminRoutes.Get("/admin/analytics/revenue", apiHandlers.handleAdminAnalyticsRevenue)
 				adminRoutes.Get("/admin/analytics/vendors", apiHandlers.handleAdminAnalyticsVendors)
+				adminRoutes.Get("/admin/cart-recovery", apiHandlers.handleAdminCartRecoveryList)
+			})
+
+			private.Group(func(adminRoutes chi.Router) {
+				adminRoutes.Use(apiHandlers.requirePermission(auth.PermissionManageTaxSettings))
+				adminRoutes.Get("/admin/invoices", apiHandlers.handleAdminInvoiceList)
+				adminRoutes.Get("/admin/invoices/archive", apiHandlers.handleAdminInvoiceArchive)
+				adminRoutes.Get("/admin/invoices/{invoiceID}/download", apiHandlers.handleAdminInvoiceDownload)
 			})
 
 			private.Group(func(adminRoutes chi.Router) {
 				adminRoutes.Use(apiHandlers.requirePermission(auth.PermissionManagePaymentSettings))
 				adminRoutes.Get("/admin/settings/payments", apiHandlers.handleAdminPaymentSettingsGet)
 				adminRoutes.Patch("/admin/settings/payments", apiHandlers.handleAdminPaymentSettingsPatch)
+				adminRoutes.Get("/admin/payments/authorizations", apiHandlers.handleAdminPaymentAuthorizationsList)
+				adminRoutes.Get("/admin/payments/webhook-events", apiHandlers.handleAdminWebhookEventsList)
+				adminRoutes.Get("/admin/payments/webhook-events/{eventID}", apiHandlers.handleAdminWebhookEventDetail)
+				adminRoutes.Post("/admin/payments/webhook-events/{eventID}/replay", apiHandlers.handleAdminWebhookEventReplay)
+				adminRoutes.Get("/admin/payments/reconciliation/reports", apiHandlers.handleAdminReconciliationReportsList)
+				adminRoutes.Post("/admin/payments/reconciliation/run", apiHandlers.handleAdminReconciliationRun)
+				adminRoutes.Get("/admin/payments/reconciliation/reports/{reportID}", apiHandlers.handleAdminReconciliationReportDetail)
+				adminRoutes.Get("/admin/payments/reconciliation/reports/{reportID}/csv", apiHandlers.handleAdminReconciliationReportCSV)
+				adminRoutes.Post("/admin/payments/reconciliation/reports/{reportID}/fix", apiHandlers.handleAdminReconciliationFix)
+				adminRoutes.Get("/admin/payments/cod/balances", apiHandlers.handleAdminCODBalancesList)
+				adminRoutes.Post("/admin/payments/cod/balances/{vendorID}/remittances", apiHandlers.handleAdminCODRemittanceCreate)
+				adminRoutes.Get("/admin/payments/cod/flagged-buyers", apiHandlers.handleAdminCODBuyerFlagsList)
+				adminRoutes.Delete("/admin/payments/cod/flagged-buyers/{buyerRef}", apiHandlers.handleAdminCODBuyerFlagClear)
+				adminRoutes.Get("/admin/settings/fx-rates", apiHandlers.handleAdminFXRatesList)
+				adminRoutes.Put("/admin/settings/fx-rates/{currency}", apiHandlers.handleAdminFXRateUpsert)
+				adminRoutes.Delete("/admin/settings/fx-rates/{currency}", apiHandlers.handleAdminFXRateDelete)
 			})
 		})
 	})
 
-	return r, nil
+	return r, allStopped(workers), nil
+}
+
+// allStopped returns a channel that is closed once every channel in done is.
+func allStopped(done []<-chan struct{}) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for _, ch := range done {
+			<-ch
+		}
+	}()
+	return stopped
+}
+
+// carrierAdapters returns the carrier integrations enabled for the environment.
+// The file-driven fake carrier is available outside production, or anywhere a
+// scan file is configured explicitly. Production then needs its own webhook
+// secret, since the development one is public.
+func carrierAdapters(cfg config.Config) ([]carriers.Adapter, error) {
+	adapters := make([]carriers.Adapter, 0, 1)
+	production := strings.EqualFold(cfg.Environment, "production")
+	if strings.TrimSpace(cfg.CarrierFakeFile) != "" || !production {
+		secret := strings.TrimSpace(cfg.CarrierWebhookSecret)
+		if production && (secret == "" || secret == config.DevCarrierWebhookSecret) {
+			return nil, errors.New("API_CARRIER_WEBHOOK_SECRET must be set in production")
+		}
+		adapters = append(adapters, carriers.NewFileCarrier(carriers.FileCarrierCode, cfg.CarrierFakeFile, cfg.CarrierWebhookSecret))
+	}
+	return adapters, nil
+}
+
+// newPaymentProviders builds the payment providers listed in
+// API_PAYMENT_PROVIDERS ("paypal=fake,razorpay=fake"). Outside production the
+// fake provider is enabled when nothing is configured.
+func newPaymentProviders(cfg config.Config) ([]payments.Provider, error) {
+	providerList := cfg.PaymentProviders
+	if strings.TrimSpace(providerList) == "" && !strings.EqualFold(cfg.Environment, "production") {
+		providerList = payments.FakeProviderKind
+	}
+	specs, err := payments.ParseProviderSpecs(providerList, cfg.PaymentProviderKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment providers: %w", err)
+	}
+
+	registry := payments.DefaultRegistry()
+	providers := make([]payments.Provider, 0, len(specs))
+	for _, spec := range specs {
+		provider, err := registry.Build(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payment provider %q: %w", spec.Name, err)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// recoveryCouponIssuer returns the cart recovery coupon hook, or nil when
+// API_CART_RECOVERY_COUPON_PERCENT is not set.
+func recoveryCouponIssuer(couponService *coupons.Service, percentOff int64) func(cartrecovery.Cart) (string, error) {
+	if percentOff <= 0 {
+		return nil
+	}
+	return func(cartrecovery.Cart) (string, error) {
+		coupon, err := couponService.IssueSingleUse(
+			coupons.PlatformScopeID,
+			"COMEBACK",
+			coupons.DiscountTypePercent,
+			percentOff,
+			cartRecoveryCouponValidity,
+		)
+		if err != nil {
+			return "", err
+		}
+		return coupon.Code, nil
+	}
+}
+
+// newMailer picks the transport of account email from API_MAIL_TRANSPORT:
+// log (default), file (API_MAIL_DIR) or smtp (API_SMTP_ADDR).
+func newMailer(cfg config.Config) (mailer.Mailer, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.MailTransport)) {
+	case "", "log":
+		return mailer.LogMailer{}, nil
+	case "file":
+		fileMailer, err := mailer.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mail dir %q: %w", cfg.MailDir, err)
+		}
+		return fileMailer, nil
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	default:
+		return nil, fmt.Errorf("invalid mail transport %q", cfg.MailTransport)
+	}
+}
+
+// newPaymentEventStore keeps received payment webhook events below
+// API_PAYMENT_EVENT_STORAGE_DIR, or in memory when it is unset.
+func newPaymentEventStore(ctx context.Context, cfg config.Config) (payments.EventStore, error) {
+	if strings.TrimSpace(cfg.PaymentEventDir) == "" {
+		return payments.NewMemoryEventStore(), nil
+	}
+	dir, err := blobstore.NewDirStore(cfg.PaymentEventDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment event storage dir %q: %w", cfg.PaymentEventDir, err)
+	}
+	store, err := payments.NewBlobEventStore(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load payment events from %q: %w", cfg.PaymentEventDir, err)
+	}
+	return store, nil
+}
+
+// newInvoiceStore keeps issued invoices below API_INVOICE_STORAGE_DIR, or in
+// memory when it is unset.
+func newInvoiceStore(cfg config.Config) (blobstore.Store, error) {
+	if strings.TrimSpace(cfg.InvoiceStorageDir) == "" {
+		return blobstore.NewMemoryStore(), nil
+	}
+	store, err := blobstore.NewDirStore(cfg.InvoiceStorageDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invoice storage dir %q: %w", cfg.InvoiceStorageDir, err)
+	}
+	return store, nil
+}
+
+// newInvoiceBranding loads the logo from API_INVOICE_LOGO_FILE and the brand
+// colors printed on every invoice.
+func newInvoiceBranding(cfg config.Config) (invoices.Branding, error) {
+	branding := invoices.Branding{
+		PrimaryColor: strings.TrimSpace(cfg.InvoicePrimaryColor),
+		AccentColor:  strings.TrimSpace(cfg.InvoiceAccentColor),
+	}
+	if logoFile := strings.TrimSpace(cfg.InvoiceLogoFile); logoFile != "" {
+		logo, err := os.ReadFile(logoFile)
+		if err != nil {
+			return invoices.Branding{}, fmt.Errorf("invalid invoice logo file %q: %w", logoFile, err)
+		}
+		branding.Logo = logo
+	}
+	if err := branding.Validate(); err != nil {
+		return invoices.Branding{}, fmt.Errorf("invalid invoice branding: %w", err)
+	}
+	return branding, nil
+}
+
+// newCurrencyService builds the FX rate table, seeding it from API_FX_RATES
+// ("EUR=0.92,GBP=0.79"). Admin edits are kept in memory only, so a restart
+// drops them and brings back the seeded rates.
+func newCurrencyService(cfg config.Config) (*currency.Service, error) {
+	baseCurrency := valueOrDefault(cfg.BaseCurrency, commerce.DefaultCurrency)
+	if _, err := currency.NormalizeCode(baseCurrency); err != nil {
+		return nil, fmt.Errorf("invalid base currency %q: %w", cfg.BaseCurrency, err)
+	}
+
+	service := currency.NewService(baseCurrency)
+	for _, entry := range strings.Split(cfg.FXRates, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid fx rate entry %q", entry)
+		}
+		if _, err := service.SetRate(parts[0], parts[1], ""); err != nil {
+			return nil, fmt.Errorf("invalid fx rate entry %q: %w", entry, err)
+		}
+	}
+	return service, nil
+}
+
+func valueOrDefault(value, fallback string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
+
+func valueOrDefaultDuration(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
 }
@@ -1,17 +1,33 @@
 package router
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stripe/stripe-go/v83/webhook"
+	"github.com/yxshee/marketplace-platform/services/api/internal/auth"
+	"github.com/yxshee/marketplace-platform/services/api/internal/carriers"
 	"github.com/yxshee/marketplace-platform/services/api/internal/config"
+	"github.com/yxshee/marketplace-platform/services/api/internal/oidc/oidctest"
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
 )
 
 func testConfig() config.Config {
@@ -35,7 +51,7 @@ func testSeconds(v int) time.Duration {
 
 func mustRouter(t *testing.T) http.Handler {
 	t.Helper()
-	r, err := New(testConfig())
+	r, err := New(t.Context(), testConfig())
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -44,7 +60,7 @@ func mustRouter(t *testing.T) http.Handler {
 
 func mustRouterWithConfig(t *testing.T, cfg config.Config) http.Handler {
 	t.Helper()
-	r, err := New(cfg)
+	r, err := New(t.Context(), cfg)
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -2080,6 +2096,34 @@ func TestCheckoutCreatesMultiShipmentAndIdempotentOrder(t *testing.T) {
 	}
 }
 
+func TestBackgroundWorkersStopWhenContextIsCancelled(t *testing.T) {
+	cfg := testConfig()
+	cfg.CarrierPollInterval = time.Hour
+	cfg.CartRecoveryInterval = time.Hour
+	cfg.PaymentSweepInterval = time.Hour
+	cfg.WebhookRetryInterval = time.Hour
+	cfg.ReconcileInterval = time.Hour
+	cfg.InvoicePurgeInterval = time.Hour
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	_, stopped, err := newRouter(ctx, cfg)
+	if err != nil {
+		t.Fatalf("newRouter() error = %v", err)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("expected background workers to run until cancelled")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected background workers to stop after cancel")
+	}
+}
+
 func TestSeedCatalogRunsOnlyInDevelopment(t *testing.T) {
 	prodCfg := testConfig()
 	prodCfg.Environment = "production"
@@ -2433,6 +2477,18 @@ func TestInvoiceDownloadRequiresConfirmedPayment(t *testing.T) {
 	if !bytes.HasPrefix(invoiceRes.Body.Bytes(), []byte("%PDF")) {
 		t.Fatalf("expected PDF payload prefix, got %q", invoiceRes.Body.String())
 	}
+
+	ublRes := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/invoices/"+orderPayload.Order.ID+"/download?format=ubl", nil, "", guestHeaders)
+	if ublRes.Code != http.StatusOK || ublRes.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("ubl download status=%d content-type=%s", ublRes.Code, ublRes.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(ublRes.Body.String(), `<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"`) ||
+		!strings.Contains(ublRes.Header().Get("Content-Disposition"), ".xml") {
+		t.Fatalf("expected a UBL invoice attachment, got %s", ublRes.Body.String())
+	}
+	if unsupported := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/invoices/"+orderPayload.Order.ID+"/download?format=docx", nil, "", guestHeaders); unsupported.Code != http.StatusBadRequest {
+		t.Fatalf("expected unsupported format 400, got status=%d", unsupported.Code)
+	}
 }
 
 func TestStripeWebhookRejectsInvalidSignature(t *testing.T) {
@@ -2673,3 +2729,2375 @@ func signedStripeWebhook(t *testing.T, secret, eventID, eventType, paymentIntent
 	})
 	return signed.Payload, signed.Header
 }
+
+func TestProductionFakeCarrierRequiresItsOwnWebhookSecret(t *testing.T) {
+	cfg := testConfig()
+	cfg.Environment = "production"
+	cfg.CarrierFakeFile = filepath.Join(t.TempDir(), "scans.json")
+	for _, secret := range []string{"", config.DevCarrierWebhookSecret} {
+		cfg.CarrierWebhookSecret = secret
+		if _, err := New(t.Context(), cfg); err == nil || !strings.Contains(err.Error(), "API_CARRIER_WEBHOOK_SECRET") {
+			t.Fatalf("expected production to refuse carrier webhook secret %q, got %v", secret, err)
+		}
+	}
+
+	cfg.CarrierWebhookSecret = "carrier_prod_secret"
+	mustRouterWithConfig(t, cfg)
+	cfg.CarrierFakeFile = ""
+	cfg.CarrierWebhookSecret = ""
+	mustRouterWithConfig(t, cfg)
+}
+
+func TestVendorShipmentTrackingAndCarrierWebhook(t *testing.T) {
+	cfg := testConfig()
+	cfg.CarrierWebhookSecret = "carrier_test_secret"
+	r := mustRouterWithConfig(t, cfg)
+
+	ownerToken, productID := createApprovedVendorProduct(t, r, "vendor-tracking-owner@example.com", "vendor-tracking", 2400, 8)
+
+	guestHeaders := map[string]string{guestTokenHeader: "gst_vendor_tracking_flow"}
+	addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", guestHeaders)
+	if addRes.Code != http.StatusOK {
+		t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "idem-vendor-tracking-order-1",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+
+	listRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, ownerToken)
+	if listRes.Code != http.StatusOK {
+		t.Fatalf("list shipments status=%d body=%s", listRes.Code, listRes.Body.String())
+	}
+	var listPayload struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(listRes.Body.Bytes(), &listPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(listPayload.Items) != 1 {
+		t.Fatalf("expected one shipment, got %d", len(listPayload.Items))
+	}
+	shipmentID := listPayload.Items[0].ID
+
+	carriersRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments/carriers", nil, ownerToken)
+	if carriersRes.Code != http.StatusOK || !strings.Contains(carriersRes.Body.String(), `"fake"`) {
+		t.Fatalf("expected fake carrier to be listed, got status=%d body=%s", carriersRes.Code, carriersRes.Body.String())
+	}
+
+	unsupported := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+shipmentID+"/status", map[string]string{
+		"status":          "shipped",
+		"carrier_code":    "pigeon",
+		"tracking_number": "TRK-ROUTER-1",
+	}, ownerToken)
+	if unsupported.Code != http.StatusBadRequest {
+		t.Fatalf("expected unsupported carrier 400, got status=%d body=%s", unsupported.Code, unsupported.Body.String())
+	}
+
+	shipped := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+shipmentID+"/status", map[string]string{
+		"status":          "shipped",
+		"carrier_code":    "fake",
+		"tracking_number": "trk-router-1",
+	}, ownerToken)
+	if shipped.Code != http.StatusOK {
+		t.Fatalf("ship with tracking status=%d body=%s", shipped.Code, shipped.Body.String())
+	}
+	var shippedPayload struct {
+		Status         string `json:"status"`
+		CarrierCode    string `json:"carrier_code"`
+		TrackingNumber string `json:"tracking_number"`
+	}
+	if err := json.Unmarshal(shipped.Body.Bytes(), &shippedPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if shippedPayload.Status != "shipped" || shippedPayload.CarrierCode != "fake" || shippedPayload.TrackingNumber != "TRK-ROUTER-1" {
+		t.Fatalf("unexpected shipped payload %+v", shippedPayload)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"events": []map[string]string{
+			{"id": "scan_router_1", "tracking_number": "TRK-ROUTER-1", "status": "delivered", "location": "Front door"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	badSignature := requestRawWithHeaders(r, http.MethodPost, "/api/v1/webhooks/carriers/fake", payload, map[string]string{
+		carrierSignatureHeader: "invalid",
+	})
+	if badSignature.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid carrier signature 400, got status=%d body=%s", badSignature.Code, badSignature.Body.String())
+	}
+
+	webhookRes := requestRawWithHeaders(r, http.MethodPost, "/api/v1/webhooks/carriers/fake", payload, map[string]string{
+		carrierSignatureHeader: carriers.SignFilePayload("carrier_test_secret", payload),
+	})
+	if webhookRes.Code != http.StatusOK {
+		t.Fatalf("carrier webhook status=%d body=%s", webhookRes.Code, webhookRes.Body.String())
+	}
+
+	detailRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments/"+shipmentID, nil, ownerToken)
+	if detailRes.Code != http.StatusOK {
+		t.Fatalf("shipment detail status=%d body=%s", detailRes.Code, detailRes.Body.String())
+	}
+	var detailPayload struct {
+		Status   string `json:"status"`
+		Timeline []struct {
+			Status        string `json:"status"`
+			CarrierStatus string `json:"carrier_status"`
+		} `json:"timeline"`
+	}
+	if err := json.Unmarshal(detailRes.Body.Bytes(), &detailPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if detailPayload.Status != "delivered" {
+		t.Fatalf("expected carrier scan to deliver shipment, got %s", detailPayload.Status)
+	}
+	last := detailPayload.Timeline[len(detailPayload.Timeline)-1]
+	if last.CarrierStatus != "delivered" {
+		t.Fatalf("expected carrier scan on timeline, got %+v", last)
+	}
+}
+
+func createApprovedVendorProduct(t *testing.T, r http.Handler, ownerEmail, slug string, priceCents int64, stockQty int32) (string, string) {
+	t.Helper()
+
+	owner := registerUser(t, r, ownerEmail)
+	admin := loginOrRegisterUser(t, r, "admin@example.com")
+	moderator := loginOrRegisterUser(t, r, "moderator@example.com")
+
+	vendorCreated := requestJSON(t, r, http.MethodPost, "/api/v1/vendors/register", map[string]string{
+		"slug":         slug,
+		"display_name": slug,
+	}, owner.AccessToken)
+	if vendorCreated.Code != http.StatusCreated {
+		t.Fatalf("vendor register status=%d body=%s", vendorCreated.Code, vendorCreated.Body.String())
+	}
+	var vendorBody struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(vendorCreated.Body.Bytes(), &vendorBody); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	verified := requestJSON(t, r, http.MethodPatch, "/api/v1/admin/vendors/"+vendorBody.ID+"/verification", map[string]string{
+		"state": "verified",
+	}, admin.AccessToken)
+	if verified.Code != http.StatusOK {
+		t.Fatalf("admin verify vendor status=%d body=%s", verified.Code, verified.Body.String())
+	}
+
+	ownerLogin := loginUser(t, r, ownerEmail)
+	createdProduct := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/products", map[string]interface{}{
+		"title":                slug + " product",
+		"description":          "Product for " + slug,
+		"category_slug":        "stationery",
+		"tags":                 []string{"test"},
+		"price_incl_tax_cents": priceCents,
+		"currency":             "USD",
+		"stock_qty":            stockQty,
+	}, ownerLogin.AccessToken)
+	if createdProduct.Code != http.StatusCreated {
+		t.Fatalf("create product status=%d body=%s", createdProduct.Code, createdProduct.Body.String())
+	}
+	var product struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(createdProduct.Body.Bytes(), &product); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	submitted := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/products/"+product.ID+"/submit-moderation", map[string]string{}, ownerLogin.AccessToken)
+	if submitted.Code != http.StatusOK {
+		t.Fatalf("submit moderation status=%d body=%s", submitted.Code, submitted.Body.String())
+	}
+	approved := requestJSON(t, r, http.MethodPatch, "/api/v1/admin/moderation/products/"+product.ID, map[string]string{
+		"decision": "approve",
+	}, moderator.AccessToken)
+	if approved.Code != http.StatusOK {
+		t.Fatalf("approve moderation status=%d body=%s", approved.Code, approved.Body.String())
+	}
+
+	return ownerLogin.AccessToken, product.ID
+}
+
+func loginOrRegisterUser(t *testing.T, r http.Handler, email string) authPayload {
+	t.Helper()
+
+	rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/login", map[string]string{
+		"email":    email,
+		"password": "strong-password",
+	}, "")
+	if rr.Code != http.StatusOK {
+		return registerUser(t, r, email)
+	}
+	var payload authPayload
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return payload
+}
+
+func requestRawWithHeaders(r http.Handler, method, path string, payload []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMultiCurrencyCatalogCartAndReportingAnalytics(t *testing.T) {
+	cfg := testConfig()
+	cfg.FXRates = "EUR=0.5"
+	r := mustRouterWithConfig(t, cfg)
+
+	_, productID := createApprovedVendorProduct(t, r, "vendor-fx-owner@example.com", "vendor-fx", 2400, 5)
+
+	catalogRes := requestJSON(t, r, http.MethodGet, "/api/v1/catalog/products/"+productID+"?currency=eur", nil, "")
+	if catalogRes.Code != http.StatusOK {
+		t.Fatalf("catalog detail status=%d body=%s", catalogRes.Code, catalogRes.Body.String())
+	}
+	var catalogPayload struct {
+		Item struct {
+			PriceInclTaxCents        int64  `json:"price_incl_tax_cents"`
+			DisplayPriceInclTaxCents int64  `json:"display_price_incl_tax_cents"`
+			DisplayCurrency          string `json:"display_currency"`
+		} `json:"item"`
+	}
+	if err := json.Unmarshal(catalogRes.Body.Bytes(), &catalogPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if catalogPayload.Item.PriceInclTaxCents != 2400 || catalogPayload.Item.DisplayPriceInclTaxCents != 1200 || catalogPayload.Item.DisplayCurrency != "EUR" {
+		t.Fatalf("unexpected display pricing %+v", catalogPayload.Item)
+	}
+	if unsupported := requestJSON(t, r, http.MethodGet, "/api/v1/catalog/products?currency=GBP", nil, ""); unsupported.Code != http.StatusBadRequest {
+		t.Fatalf("expected unsupported display currency 400, got %d", unsupported.Code)
+	}
+
+	support := loginOrRegisterUser(t, r, "support@example.com")
+	finance := loginOrRegisterUser(t, r, "finance@example.com")
+	admin := loginOrRegisterUser(t, r, "admin@example.com")
+
+	if forbidden := requestJSON(t, r, http.MethodPut, "/api/v1/admin/settings/fx-rates/GBP", map[string]string{"rate": "0.8"}, support.AccessToken); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected support fx rate update 403, got %d", forbidden.Code)
+	}
+	if baseRate := requestJSON(t, r, http.MethodPut, "/api/v1/admin/settings/fx-rates/USD", map[string]string{"rate": "2"}, finance.AccessToken); baseRate.Code != http.StatusConflict {
+		t.Fatalf("expected base currency rate update 409, got %d", baseRate.Code)
+	}
+	gbpRate := requestJSON(t, r, http.MethodPut, "/api/v1/admin/settings/fx-rates/gbp", map[string]string{"rate": "0.8"}, finance.AccessToken)
+	if gbpRate.Code != http.StatusOK || !strings.Contains(gbpRate.Body.String(), `"currency":"GBP"`) {
+		t.Fatalf("fx rate upsert status=%d body=%s", gbpRate.Code, gbpRate.Body.String())
+	}
+	currenciesRes := requestJSON(t, r, http.MethodGet, "/api/v1/currencies", nil, "")
+	if currenciesRes.Code != http.StatusOK || !strings.Contains(currenciesRes.Body.String(), `"GBP"`) {
+		t.Fatalf("currencies status=%d body=%s", currenciesRes.Code, currenciesRes.Body.String())
+	}
+
+	guestHeaders := map[string]string{guestTokenHeader: "gst_fx_flow"}
+	if invalidCurrency := requestJSONWithHeaders(t, r, http.MethodPut, "/api/v1/cart/currency", map[string]string{"currency": "CHF"}, "", guestHeaders); invalidCurrency.Code != http.StatusBadRequest {
+		t.Fatalf("expected unsupported cart currency 400, got %d", invalidCurrency.Code)
+	}
+	setCurrency := requestJSONWithHeaders(t, r, http.MethodPut, "/api/v1/cart/currency", map[string]string{"currency": "EUR"}, "", guestHeaders)
+	if setCurrency.Code != http.StatusOK {
+		t.Fatalf("set cart currency status=%d body=%s", setCurrency.Code, setCurrency.Body.String())
+	}
+	addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", guestHeaders)
+	if addRes.Code != http.StatusOK {
+		t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "idem-fx-order-1",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID         string `json:"id"`
+			Currency   string `json:"currency"`
+			TotalCents int64  `json:"total_cents"`
+			FXRates    []struct {
+				FromCurrency string `json:"from_currency"`
+				ToCurrency   string `json:"to_currency"`
+				Rate         string `json:"rate"`
+			} `json:"fx_rates"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if orderPayload.Order.Currency != "EUR" || orderPayload.Order.TotalCents != 1450 {
+		t.Fatalf("expected EUR order total 1450, got %+v", orderPayload.Order)
+	}
+	if len(orderPayload.Order.FXRates) != 2 {
+		t.Fatalf("expected pricing and reporting fx snapshots, got %+v", orderPayload.Order.FXRates)
+	}
+
+	codRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/cod/confirm", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "idem-fx-cod-1",
+	}, "", guestHeaders)
+	if codRes.Code != http.StatusCreated {
+		t.Fatalf("cod confirm status=%d body=%s", codRes.Code, codRes.Body.String())
+	}
+
+	if updated := requestJSON(t, r, http.MethodPut, "/api/v1/admin/settings/fx-rates/EUR", map[string]string{"rate": "0.25"}, finance.AccessToken); updated.Code != http.StatusOK {
+		t.Fatalf("fx rate update status=%d body=%s", updated.Code, updated.Body.String())
+	}
+
+	revenueRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/analytics/revenue?days=7", nil, admin.AccessToken)
+	if revenueRes.Code != http.StatusOK {
+		t.Fatalf("revenue status=%d body=%s", revenueRes.Code, revenueRes.Body.String())
+	}
+	var revenuePayload struct {
+		Currency string `json:"currency"`
+		Summary  struct {
+			GrossRevenueCents int64 `json:"gross_revenue_cents"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(revenueRes.Body.Bytes(), &revenuePayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if revenuePayload.Currency != "USD" || revenuePayload.Summary.GrossRevenueCents != 2900 {
+		t.Fatalf("expected revenue reported in USD at the snapshotted rate, got %+v", revenuePayload)
+	}
+
+	eurRevenueRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/analytics/revenue?days=7&currency=EUR", nil, admin.AccessToken)
+	if err := json.Unmarshal(eurRevenueRes.Body.Bytes(), &revenuePayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if revenuePayload.Currency != "EUR" || revenuePayload.Summary.GrossRevenueCents != 1450 {
+		t.Fatalf("expected revenue reported in EUR, got %+v", revenuePayload)
+	}
+}
+
+func TestCartRecoveryNotifiesIdleBuyerCartsAndTracksConversion(t *testing.T) {
+	cfg := testConfig()
+	cfg.CartRecoveryIdle = time.Millisecond
+	cfg.CartRecoveryCoupon = 10
+	r := mustRouterWithConfig(t, cfg)
+
+	_, productID := createApprovedVendorProduct(t, r, "vendor-recovery-owner@example.com", "vendor-recovery", 1500, 5)
+	buyer := registerUser(t, r, "buyer-recovery@example.com")
+	addRes := requestJSON(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, buyer.AccessToken)
+	if addRes.Code != http.StatusOK {
+		t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+	guestAdd := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", map[string]string{guestTokenHeader: "gst_recovery"})
+	if guestAdd.Code != http.StatusOK {
+		t.Fatalf("guest add cart item status=%d body=%s", guestAdd.Code, guestAdd.Body.String())
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	support := loginOrRegisterUser(t, r, "support@example.com")
+	finance := loginOrRegisterUser(t, r, "finance@example.com")
+	if forbidden := requestJSON(t, r, http.MethodPost, "/api/v1/admin/cart-recovery/run", nil, support.AccessToken); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected support cart recovery run 403, got %d", forbidden.Code)
+	}
+
+	runRes := requestJSON(t, r, http.MethodPost, "/api/v1/admin/cart-recovery/run", nil, finance.AccessToken)
+	if runRes.Code != http.StatusOK {
+		t.Fatalf("cart recovery run status=%d body=%s", runRes.Code, runRes.Body.String())
+	}
+	var runPayload struct {
+		Result struct {
+			IdleCarts int `json:"idle_carts"`
+			Notified  int `json:"notified"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(runRes.Body.Bytes(), &runPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if runPayload.Result.IdleCarts != 1 || runPayload.Result.Notified != 1 {
+		t.Fatalf("expected only the buyer cart to be notified, got %+v", runPayload.Result)
+	}
+
+	placeRes := requestJSON(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]string{
+		"idempotency_key": "recovery-order-1",
+	}, buyer.AccessToken)
+	if placeRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", placeRes.Code, placeRes.Body.String())
+	}
+
+	listRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/cart-recovery?status=recovered", nil, finance.AccessToken)
+	if listRes.Code != http.StatusOK {
+		t.Fatalf("cart recovery list status=%d body=%s", listRes.Code, listRes.Body.String())
+	}
+	var listPayload struct {
+		Metrics struct {
+			AbandonedTotal    int `json:"abandoned_total"`
+			RecoveredTotal    int `json:"recovered_total"`
+			CouponsIssued     int `json:"coupons_issued"`
+			ConversionRateBPS int `json:"conversion_rate_bps"`
+		} `json:"metrics"`
+		Items []struct {
+			BuyerUserID string `json:"buyer_user_id"`
+			CouponCode  string `json:"coupon_code"`
+			OrderID     string `json:"order_id"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(listRes.Body.Bytes(), &listPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if listPayload.Total != 1 || listPayload.Items[0].BuyerUserID != buyer.User.ID || listPayload.Items[0].OrderID == "" {
+		t.Fatalf("unexpected recovered carts %+v", listPayload)
+	}
+	if !strings.HasPrefix(listPayload.Items[0].CouponCode, "COMEBACK-") {
+		t.Fatalf("expected recovery coupon code, got %q", listPayload.Items[0].CouponCode)
+	}
+	if listPayload.Metrics.AbandonedTotal != 1 || listPayload.Metrics.RecoveredTotal != 1 || listPayload.Metrics.CouponsIssued != 1 || listPayload.Metrics.ConversionRateBPS != 10000 {
+		t.Fatalf("unexpected cart recovery metrics %+v", listPayload.Metrics)
+	}
+
+	if invalid := requestJSON(t, r, http.MethodGet, "/api/v1/admin/cart-recovery?status=lost", nil, finance.AccessToken); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid status filter 400, got %d", invalid.Code)
+	}
+}
+
+func TestWishlistsAndProductAlertsNotifyOnRestockAndPriceDrop(t *testing.T) {
+	r := mustRouter(t)
+
+	ownerToken, productID := createApprovedVendorProduct(t, r, "vendor-wishlist-owner@example.com", "vendor-wishlist", 5000, 0)
+	buyer := registerUser(t, r, "buyer-wishlist@example.com")
+	other := registerUser(t, r, "buyer-wishlist-other@example.com")
+
+	if unauthenticated := requestJSON(t, r, http.MethodGet, "/api/v1/wishlists", nil, ""); unauthenticated.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated wishlist list 401, got %d", unauthenticated.Code)
+	}
+
+	createRes := requestJSON(t, r, http.MethodPost, "/api/v1/wishlists", map[string]string{"name": "Birthday"}, buyer.AccessToken)
+	if createRes.Code != http.StatusCreated {
+		t.Fatalf("create wishlist status=%d body=%s", createRes.Code, createRes.Body.String())
+	}
+	var wishlist struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(createRes.Body.Bytes(), &wishlist); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if duplicate := requestJSON(t, r, http.MethodPost, "/api/v1/wishlists", map[string]string{"name": "birthday"}, buyer.AccessToken); duplicate.Code != http.StatusConflict {
+		t.Fatalf("expected duplicate wishlist name 409, got %d", duplicate.Code)
+	}
+
+	itemPath := "/api/v1/wishlists/" + wishlist.ID + "/items"
+	if missing := requestJSON(t, r, http.MethodPost, itemPath, map[string]string{"product_id": "prd_missing"}, buyer.AccessToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown product 404, got %d", missing.Code)
+	}
+	addRes := requestJSON(t, r, http.MethodPost, itemPath, map[string]string{"product_id": productID}, buyer.AccessToken)
+	if addRes.Code != http.StatusOK || !strings.Contains(addRes.Body.String(), `"stock_qty":0`) {
+		t.Fatalf("add wishlist item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+	if foreign := requestJSON(t, r, http.MethodGet, "/api/v1/wishlists/"+wishlist.ID, nil, other.AccessToken); foreign.Code != http.StatusNotFound {
+		t.Fatalf("expected other buyer wishlist access 404, got %d", foreign.Code)
+	}
+
+	for _, payload := range []map[string]interface{}{
+		{"product_id": productID, "kind": "back_in_stock"},
+		{"product_id": productID, "kind": "price_drop", "price_threshold_cents": 4000},
+	} {
+		alertRes := requestJSON(t, r, http.MethodPost, "/api/v1/product-alerts", payload, buyer.AccessToken)
+		if alertRes.Code != http.StatusCreated {
+			t.Fatalf("create product alert status=%d body=%s", alertRes.Code, alertRes.Body.String())
+		}
+	}
+	if invalidKind := requestJSON(t, r, http.MethodPost, "/api/v1/product-alerts", map[string]interface{}{
+		"product_id": productID,
+		"kind":       "restock_soon",
+	}, buyer.AccessToken); invalidKind.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid alert kind 400, got %d", invalidKind.Code)
+	}
+
+	restock := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{"stock_qty": 3}, ownerToken)
+	if restock.Code != http.StatusOK {
+		t.Fatalf("restock status=%d body=%s", restock.Code, restock.Body.String())
+	}
+	smallDrop := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{"price_incl_tax_cents": 4500}, ownerToken)
+	if smallDrop.Code != http.StatusOK {
+		t.Fatalf("price update status=%d body=%s", smallDrop.Code, smallDrop.Body.String())
+	}
+	bigDrop := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{"price_incl_tax_cents": 3500}, ownerToken)
+	if bigDrop.Code != http.StatusOK {
+		t.Fatalf("price update status=%d body=%s", bigDrop.Code, bigDrop.Body.String())
+	}
+
+	notificationsRes := requestJSON(t, r, http.MethodGet, "/api/v1/notifications", nil, buyer.AccessToken)
+	if notificationsRes.Code != http.StatusOK {
+		t.Fatalf("notifications status=%d body=%s", notificationsRes.Code, notificationsRes.Body.String())
+	}
+	var notificationsPayload struct {
+		Items []struct {
+			Kind string            `json:"kind"`
+			Data map[string]string `json:"data"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(notificationsRes.Body.Bytes(), &notificationsPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if notificationsPayload.Total != 2 {
+		t.Fatalf("expected back-in-stock and one price drop notification, got %+v", notificationsPayload)
+	}
+	if notificationsPayload.Items[0].Kind != "price_drop" || notificationsPayload.Items[0].Data["price_cents"] != "3500" {
+		t.Fatalf("unexpected latest notification %+v", notificationsPayload.Items[0])
+	}
+	if notificationsPayload.Items[1].Kind != "back_in_stock" {
+		t.Fatalf("unexpected first notification %+v", notificationsPayload.Items[1])
+	}
+
+	otherNotifications := requestJSON(t, r, http.MethodGet, "/api/v1/notifications", nil, other.AccessToken)
+	if !strings.Contains(otherNotifications.Body.String(), `"total":0`) {
+		t.Fatalf("expected no notifications for other buyer, got %s", otherNotifications.Body.String())
+	}
+}
+
+func TestBackorderedProductHoldsVendorShipmentUntilRestock(t *testing.T) {
+	r := mustRouter(t)
+
+	ownerToken, productID := createApprovedVendorProduct(t, r, "vendor-backorder-owner@example.com", "vendor-backorder", 2500, 0)
+	guestHeaders := map[string]string{guestTokenHeader: "gst_backorder_flow"}
+
+	outOfStock := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", guestHeaders)
+	if outOfStock.Code != http.StatusConflict {
+		t.Fatalf("expected out of stock 409 before backorders are enabled, got %d", outOfStock.Code)
+	}
+
+	if invalid := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{
+		"preorder": true,
+	}, ownerToken); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected pre-order without ship date 400, got %d", invalid.Code)
+	}
+	enable := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{
+		"backorder_limit":    3,
+		"expected_ship_date": "2026-04-20",
+	}, ownerToken)
+	if enable.Code != http.StatusOK || !strings.Contains(enable.Body.String(), `"status":"approved"`) {
+		t.Fatalf("enable backorders status=%d body=%s", enable.Code, enable.Body.String())
+	}
+
+	if tooMany := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        4,
+	}, "", guestHeaders); tooMany.Code != http.StatusConflict {
+		t.Fatalf("expected qty beyond backorder limit 409, got %d", tooMany.Code)
+	}
+	addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        2,
+	}, "", guestHeaders)
+	if addRes.Code != http.StatusOK {
+		t.Fatalf("add backordered item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+
+	quoteRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/quote", map[string]interface{}{}, "", guestHeaders)
+	if quoteRes.Code != http.StatusOK || !strings.Contains(quoteRes.Body.String(), `"expected_ship_date":"2026-04-20T00:00:00Z"`) {
+		t.Fatalf("quote status=%d body=%s", quoteRes.Code, quoteRes.Body.String())
+	}
+
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "backorder-order-1",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ExpectedShipDate string `json:"expected_ship_date"`
+			Shipments        []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"shipments"`
+			Items []struct {
+				Fulfillment    string `json:"fulfillment"`
+				BackorderedQty int32  `json:"backordered_qty"`
+			} `json:"items"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if orderPayload.Order.ExpectedShipDate == "" || orderPayload.Order.Shipments[0].Status != "on_hold" {
+		t.Fatalf("expected held shipment with ship date, got %+v", orderPayload.Order)
+	}
+	if orderPayload.Order.Items[0].Fulfillment != "backorder" || orderPayload.Order.Items[0].BackorderedQty != 2 {
+		t.Fatalf("expected backordered line, got %+v", orderPayload.Order.Items[0])
+	}
+	shipmentPath := "/api/v1/vendor/shipments/" + orderPayload.Order.Shipments[0].ID
+
+	if packHeld := requestJSON(t, r, http.MethodPatch, shipmentPath+"/status", map[string]string{"status": "packed"}, ownerToken); packHeld.Code != http.StatusConflict {
+		t.Fatalf("expected held shipment pack 409, got %d body=%s", packHeld.Code, packHeld.Body.String())
+	}
+
+	restock := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{"stock_qty": 2}, ownerToken)
+	if restock.Code != http.StatusOK {
+		t.Fatalf("restock status=%d body=%s", restock.Code, restock.Body.String())
+	}
+	shipmentRes := requestJSON(t, r, http.MethodGet, shipmentPath, nil, ownerToken)
+	if shipmentRes.Code != http.StatusOK || !strings.Contains(shipmentRes.Body.String(), `"status":"pending"`) {
+		t.Fatalf("expected restocked shipment to be released, status=%d body=%s", shipmentRes.Code, shipmentRes.Body.String())
+	}
+	if packed := requestJSON(t, r, http.MethodPatch, shipmentPath+"/status", map[string]string{"status": "packed"}, ownerToken); packed.Code != http.StatusOK {
+		t.Fatalf("pack released shipment status=%d body=%s", packed.Code, packed.Body.String())
+	}
+}
+
+func TestConsecutiveRestocksAllocateOnlyArrivedUnits(t *testing.T) {
+	r := mustRouter(t)
+
+	ownerToken, productID := createApprovedVendorProduct(t, r, "vendor-restock-owner@example.com", "vendor-restock", 2500, 0)
+	if enable := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{
+		"backorder_limit": 4,
+	}, ownerToken); enable.Code != http.StatusOK {
+		t.Fatalf("enable backorders status=%d body=%s", enable.Code, enable.Body.String())
+	}
+	placeHeldOrder := func(guestToken, idempotencyKey string) string {
+		t.Helper()
+		guestHeaders := map[string]string{guestTokenHeader: guestToken}
+		if addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        2,
+		}, "", guestHeaders); addRes.Code != http.StatusOK {
+			t.Fatalf("add backordered item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+		orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+			"idempotency_key": idempotencyKey,
+		}, "", guestHeaders)
+		if orderRes.Code != http.StatusCreated {
+			t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+		}
+		var payload struct {
+			Order struct {
+				Shipments []struct {
+					ID string `json:"id"`
+				} `json:"shipments"`
+			} `json:"order"`
+		}
+		if err := json.Unmarshal(orderRes.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return "/api/v1/vendor/shipments/" + payload.Order.Shipments[0].ID
+	}
+	restock := func(stockQty int) {
+		t.Helper()
+		if rr := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/products/"+productID, map[string]interface{}{"stock_qty": stockQty}, ownerToken); rr.Code != http.StatusOK {
+			t.Fatalf("restock to %d status=%d body=%s", stockQty, rr.Code, rr.Body.String())
+		}
+	}
+	shipmentStatus := func(path string) string {
+		t.Helper()
+		rr := requestJSON(t, r, http.MethodGet, path, nil, ownerToken)
+		var payload struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("shipment status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		return payload.Status
+	}
+
+	first := placeHeldOrder("gst_restock_first", "restock-order-1")
+	second := placeHeldOrder("gst_restock_second", "restock-order-2")
+
+	restock(2)
+	if got := shipmentStatus(first); got != "pending" {
+		t.Fatalf("expected the first restock to release the oldest order, got %s", got)
+	}
+	if got := shipmentStatus(second); got != "on_hold" {
+		t.Fatalf("expected the second order to stay held, got %s", got)
+	}
+
+	restock(3)
+	if got := shipmentStatus(second); got != "on_hold" {
+		t.Fatalf("expected one arrived unit not to cover two held units, got %s", got)
+	}
+	restock(5)
+	if got := shipmentStatus(second); got != "pending" {
+		t.Fatalf("expected two arrived units to release the second order, got %s", got)
+	}
+}
+
+func TestFakePaymentProviderFlowAndAdminToggle(t *testing.T) {
+	cfg := testConfig()
+	cfg.PaymentProviderKeys = "fake=whsec_fake_router"
+	r := mustRouterWithConfig(t, cfg)
+
+	_, productID := createApprovedVendorProduct(t, r, "vendor-provider-owner@example.com", "vendor-provider", 1800, 5)
+	guestHeaders := map[string]string{guestTokenHeader: "gst_provider_flow"}
+	placeOrder := func(idempotencyKey string) string {
+		t.Helper()
+		addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        1,
+		}, "", guestHeaders)
+		if addRes.Code != http.StatusOK {
+			t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+		orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+			"idempotency_key": idempotencyKey,
+		}, "", guestHeaders)
+		if orderRes.Code != http.StatusCreated {
+			t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+		}
+		var payload struct {
+			Order struct {
+				ID string `json:"id"`
+			} `json:"order"`
+		}
+		if err := json.Unmarshal(orderRes.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return payload.Order.ID
+	}
+
+	settingsRes := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/payments/settings", nil, "", guestHeaders)
+	if settingsRes.Code != http.StatusOK || !strings.Contains(settingsRes.Body.String(), `"fake":true`) {
+		t.Fatalf("expected fake provider in buyer settings, status=%d body=%s", settingsRes.Code, settingsRes.Body.String())
+	}
+
+	orderID := placeOrder("provider-order-1")
+	if unknown := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/providers/paypal/intent", map[string]interface{}{
+		"order_id":        orderID,
+		"idempotency_key": "provider-intent-1",
+	}, "", guestHeaders); unknown.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown provider 404, got %d", unknown.Code)
+	}
+	createRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/providers/fake/intent", map[string]interface{}{
+		"order_id":        orderID,
+		"idempotency_key": "provider-intent-1",
+	}, "", guestHeaders)
+	if createRes.Code != http.StatusCreated {
+		t.Fatalf("create provider payment status=%d body=%s", createRes.Code, createRes.Body.String())
+	}
+	var paymentPayload struct {
+		ProviderRef string `json:"provider_ref"`
+		Provider    string `json:"provider"`
+		Status      string `json:"status"`
+		RedirectURL string `json:"redirect_url"`
+	}
+	if err := json.Unmarshal(createRes.Body.Bytes(), &paymentPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if paymentPayload.Provider != "fake" || paymentPayload.Status != "pending" || paymentPayload.RedirectURL == "" {
+		t.Fatalf("unexpected provider payment %+v", paymentPayload)
+	}
+
+	webhookBody, err := json.Marshal(map[string]string{
+		"id":          "evt_fake_router_1",
+		"payment_ref": paymentPayload.ProviderRef,
+		"status":      "authorized",
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	sendWebhook := func(provider, signature string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/payments/"+provider, bytes.NewBuffer(webhookBody))
+		req.Header.Set(payments.FakeSignatureHeader, signature)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	if missing := sendWebhook("paypal", "sig"); missing.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown provider webhook 404, got %d", missing.Code)
+	}
+	if invalid := sendWebhook("fake", "bad-signature"); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid signature 400, got %d", invalid.Code)
+	}
+	webhookRes := sendWebhook("fake", payments.SignFakePayload("whsec_fake_router", webhookBody))
+	if webhookRes.Code != http.StatusOK || !strings.Contains(webhookRes.Body.String(), `"payment_status":"authorized"`) {
+		t.Fatalf("provider webhook status=%d body=%s", webhookRes.Code, webhookRes.Body.String())
+	}
+	orderView := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/orders/"+orderID, nil, "", guestHeaders)
+	if !strings.Contains(orderView.Body.String(), `"status":"paid"`) {
+		t.Fatalf("expected provider payment to mark order paid, body=%s", orderView.Body.String())
+	}
+
+	admin := loginOrRegisterUser(t, r, "admin@example.com")
+	if unknown := requestJSON(t, r, http.MethodPatch, "/api/v1/admin/settings/payments", map[string]interface{}{
+		"providers": map[string]bool{"paypal": false},
+	}, admin.AccessToken); unknown.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown provider toggle 400, got %d", unknown.Code)
+	}
+	disableRes := requestJSON(t, r, http.MethodPatch, "/api/v1/admin/settings/payments", map[string]interface{}{
+		"providers": map[string]bool{"fake": false, "cod": false},
+	}, admin.AccessToken)
+	if disableRes.Code != http.StatusOK {
+		t.Fatalf("disable provider status=%d body=%s", disableRes.Code, disableRes.Body.String())
+	}
+	if body := disableRes.Body.String(); !strings.Contains(body, `"fake":false`) || !strings.Contains(body, `"cod_enabled":false`) {
+		t.Fatalf("expected fake and cod disabled, body=%s", body)
+	}
+
+	secondOrderID := placeOrder("provider-order-2")
+	if disabled := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/providers/fake/intent", map[string]interface{}{
+		"order_id":        secondOrderID,
+		"idempotency_key": "provider-intent-2",
+	}, "", guestHeaders); disabled.Code != http.StatusConflict {
+		t.Fatalf("expected disabled provider 409, got %d body=%s", disabled.Code, disabled.Body.String())
+	}
+}
+
+func TestStripeConnectTransfersVendorShareAndReversesOnRefund(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_connect"
+	r := mustRouterWithConfig(t, cfg)
+
+	vendorToken, productID := createApprovedVendorProduct(t, r, "vendor-connect-owner@example.com", "vendor-connect", 4000, 5)
+
+	missingStatus := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/connect", nil, vendorToken)
+	if missingStatus.Code != http.StatusNotFound {
+		t.Fatalf("expected connect status 404 before onboarding, got %d", missingStatus.Code)
+	}
+	invalidOnboarding := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/connect/onboarding", map[string]string{
+		"refresh_url": "/relative",
+		"return_url":  "https://vendor.example.com/payouts/done",
+	}, vendorToken)
+	if invalidOnboarding.Code != http.StatusBadRequest {
+		t.Fatalf("expected relative onboarding url 400, got %d", invalidOnboarding.Code)
+	}
+	onboardingRes := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/connect/onboarding", map[string]string{
+		"refresh_url": "https://vendor.example.com/payouts/refresh",
+		"return_url":  "https://vendor.example.com/payouts/done",
+	}, vendorToken)
+	if onboardingRes.Code != http.StatusCreated || !strings.Contains(onboardingRes.Body.String(), `"onboarding_url":"https://`) {
+		t.Fatalf("connect onboarding status=%d body=%s", onboardingRes.Code, onboardingRes.Body.String())
+	}
+	statusRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/connect", nil, vendorToken)
+	if statusRes.Code != http.StatusOK || !strings.Contains(statusRes.Body.String(), `"payouts_enabled":true`) {
+		t.Fatalf("connect status status=%d body=%s", statusRes.Code, statusRes.Body.String())
+	}
+	profileRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/profile", nil, vendorToken)
+	if !strings.Contains(profileRes.Body.String(), `"stripe_account_id":"acct_`) || !strings.Contains(profileRes.Body.String(), `"payouts_enabled":true`) {
+		t.Fatalf("expected connected account on vendor profile, body=%s", profileRes.Body.String())
+	}
+
+	guestHeaders := map[string]string{guestTokenHeader: "gst_connect_flow"}
+	addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", guestHeaders)
+	if addRes.Code != http.StatusOK {
+		t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "connect-order-1",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID string `json:"id"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	intentRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "connect-intent-1",
+	}, "", guestHeaders)
+	if intentRes.Code != http.StatusCreated {
+		t.Fatalf("create stripe intent status=%d body=%s", intentRes.Code, intentRes.Body.String())
+	}
+	var intentPayload struct {
+		ProviderRef string `json:"provider_ref"`
+	}
+	if err := json.Unmarshal(intentRes.Body.Bytes(), &intentPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	webhookBody, webhookSignature := signedStripeWebhook(t, cfg.StripeWebhookSecret, "evt_connect_auth", "payment_intent.amount_capturable_updated", intentPayload.ProviderRef)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(webhookBody))
+	req.Header.Set(stripeSignatureHeader, webhookSignature)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("authorization webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	shipmentsRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, vendorToken)
+	var shipmentsPayload struct {
+		Items []struct {
+			ID         string `json:"id"`
+			TotalCents int64  `json:"total_cents"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(shipmentsRes.Body.Bytes(), &shipmentsPayload); err != nil || len(shipmentsPayload.Items) != 1 {
+		t.Fatalf("expected one vendor shipment, status=%d body=%s", shipmentsRes.Code, shipmentsRes.Body.String())
+	}
+	shipment := shipmentsPayload.Items[0]
+	shipRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+shipment.ID+"/status", map[string]string{"status": "shipped"}, vendorToken)
+	if shipRes.Code != http.StatusOK {
+		t.Fatalf("ship status=%d body=%s", shipRes.Code, shipRes.Body.String())
+	}
+
+	type payoutsPayload struct {
+		Items []struct {
+			OrderID             string `json:"order_id"`
+			ShipmentID          string `json:"shipment_id"`
+			Status              string `json:"status"`
+			AmountCents         int64  `json:"amount_cents"`
+			ApplicationFeeCents int64  `json:"application_fee_cents"`
+			ReversedCents       int64  `json:"reversed_cents"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	listPayouts := func() payoutsPayload {
+		t.Helper()
+		res := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/payouts", nil, vendorToken)
+		if res.Code != http.StatusOK {
+			t.Fatalf("list payouts status=%d body=%s", res.Code, res.Body.String())
+		}
+		var payload payoutsPayload
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return payload
+	}
+	fee := shipment.TotalCents * int64(cfg.DefaultCommission) / 10000
+	paid := listPayouts()
+	if paid.Total != 1 || paid.Items[0].Status != "paid" || paid.Items[0].ShipmentID != shipment.ID {
+		t.Fatalf("expected one paid transfer for shipment %s, got %+v", shipment.ID, paid)
+	}
+	if paid.Items[0].ApplicationFeeCents != fee || paid.Items[0].AmountCents != shipment.TotalCents-fee {
+		t.Fatalf("expected %d transferred with %d commission withheld, got %+v", shipment.TotalCents-fee, fee, paid.Items[0])
+	}
+
+	refundRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/orders/"+orderPayload.Order.ID+"/refund-requests", map[string]interface{}{
+		"shipment_id":            shipment.ID,
+		"reason":                 "Item arrived damaged",
+		"requested_amount_cents": shipment.TotalCents,
+	}, "", guestHeaders)
+	if refundRes.Code != http.StatusCreated {
+		t.Fatalf("create refund request status=%d body=%s", refundRes.Code, refundRes.Body.String())
+	}
+	var refundPayload struct {
+		RefundRequest struct {
+			ID string `json:"id"`
+		} `json:"refund_request"`
+	}
+	if err := json.Unmarshal(refundRes.Body.Bytes(), &refundPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	approveRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/refund-requests/"+refundPayload.RefundRequest.ID+"/decision", map[string]string{
+		"decision": "approve",
+	}, vendorToken)
+	if approveRes.Code != http.StatusOK {
+		t.Fatalf("approve refund status=%d body=%s", approveRes.Code, approveRes.Body.String())
+	}
+
+	reversed := listPayouts()
+	if reversed.Items[0].Status != "reversed" || reversed.Items[0].ReversedCents != shipment.TotalCents-fee {
+		t.Fatalf("expected full refund to reverse the transfer, got %+v", reversed.Items[0])
+	}
+}
+
+func TestStripeDisputeHoldsPayoutAndCollectsVendorEvidence(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_dispute"
+	r := mustRouterWithConfig(t, cfg)
+
+	vendorToken, productID := createApprovedVendorProduct(t, r, "vendor-dispute-owner@example.com", "vendor-dispute", 5000, 5)
+	onboardingRes := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/connect/onboarding", map[string]string{
+		"refresh_url": "https://vendor.example.com/payouts/refresh",
+		"return_url":  "https://vendor.example.com/payouts/done",
+	}, vendorToken)
+	if onboardingRes.Code != http.StatusCreated {
+		t.Fatalf("connect onboarding status=%d body=%s", onboardingRes.Code, onboardingRes.Body.String())
+	}
+	_ = requestJSON(t, r, http.MethodGet, "/api/v1/vendor/connect", nil, vendorToken)
+
+	guestHeaders := map[string]string{guestTokenHeader: "gst_dispute_flow"}
+	addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", guestHeaders)
+	if addRes.Code != http.StatusOK {
+		t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "dispute-order-1",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID string `json:"id"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	intentRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "dispute-intent-1",
+	}, "", guestHeaders)
+	if intentRes.Code != http.StatusCreated {
+		t.Fatalf("create stripe intent status=%d body=%s", intentRes.Code, intentRes.Body.String())
+	}
+	var intentPayload struct {
+		ProviderRef string `json:"provider_ref"`
+	}
+	if err := json.Unmarshal(intentRes.Body.Bytes(), &intentPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	postWebhook := func(body []byte, signature string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(body))
+		req.Header.Set(stripeSignatureHeader, signature)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := postWebhook(signedStripeWebhook(t, cfg.StripeWebhookSecret, "evt_dispute_auth", "payment_intent.amount_capturable_updated", intentPayload.ProviderRef)); rr.Code != http.StatusOK {
+		t.Fatalf("authorization webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	shipmentsRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/shipments", nil, vendorToken)
+	var shipmentsPayload struct {
+		Items []struct {
+			ID         string `json:"id"`
+			TotalCents int64  `json:"total_cents"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(shipmentsRes.Body.Bytes(), &shipmentsPayload); err != nil || len(shipmentsPayload.Items) != 1 {
+		t.Fatalf("expected one vendor shipment, status=%d body=%s", shipmentsRes.Code, shipmentsRes.Body.String())
+	}
+	shipment := shipmentsPayload.Items[0]
+	if shipRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+shipment.ID+"/status", map[string]string{"status": "shipped"}, vendorToken); shipRes.Code != http.StatusOK {
+		t.Fatalf("ship status=%d body=%s", shipRes.Code, shipRes.Body.String())
+	}
+
+	if rr := postWebhook(signedStripeDisputeWebhook(t, cfg.StripeWebhookSecret, "evt_dispute_created", "charge.dispute.created", "dp_router_1", intentPayload.ProviderRef, shipment.TotalCents, "needs_response")); rr.Code != http.StatusOK {
+		t.Fatalf("dispute created webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	fee := shipment.TotalCents * int64(cfg.DefaultCommission) / 10000
+	payoutsRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/payouts", nil, vendorToken)
+	var payouts struct {
+		Items []struct {
+			HeldCents int64 `json:"held_cents"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(payoutsRes.Body.Bytes(), &payouts); err != nil || len(payouts.Items) != 1 {
+		t.Fatalf("list payouts status=%d body=%s", payoutsRes.Code, payoutsRes.Body.String())
+	}
+	if payouts.Items[0].HeldCents != shipment.TotalCents-fee {
+		t.Fatalf("expected vendor share %d held, got %+v", shipment.TotalCents-fee, payouts.Items[0])
+	}
+
+	notificationsRes := requestJSON(t, r, http.MethodGet, "/api/v1/notifications?kind=dispute_opened", nil, vendorToken)
+	if !strings.Contains(notificationsRes.Body.String(), `"shipment_id":"`+shipment.ID+`"`) {
+		t.Fatalf("expected dispute notification for vendor, body=%s", notificationsRes.Body.String())
+	}
+
+	listRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/disputes?status=needs_response", nil, vendorToken)
+	var listPayload struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(listRes.Body.Bytes(), &listPayload); err != nil || listPayload.Total != 1 {
+		t.Fatalf("list disputes status=%d body=%s", listRes.Code, listRes.Body.String())
+	}
+	disputeID := listPayload.Items[0].ID
+
+	invalidEvidence := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/disputes/"+disputeID+"/evidence", map[string]string{
+		"kind": "tracking",
+	}, vendorToken)
+	if invalidEvidence.Code != http.StatusBadRequest {
+		t.Fatalf("expected empty evidence 400, got %d", invalidEvidence.Code)
+	}
+	evidenceRes := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/disputes/"+disputeID+"/evidence", map[string]string{
+		"kind": "tracking",
+		"text": "Delivered and signed for on 2026-10-02.",
+	}, vendorToken)
+	if evidenceRes.Code != http.StatusCreated || !strings.Contains(evidenceRes.Body.String(), `"kind":"tracking"`) {
+		t.Fatalf("submit evidence status=%d body=%s", evidenceRes.Code, evidenceRes.Body.String())
+	}
+
+	finance := registerUser(t, r, "finance@example.com")
+	overviewRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/dashboard/overview", nil, finance.AccessToken)
+	if !strings.Contains(overviewRes.Body.String(), `"chargebacks_open":1`) {
+		t.Fatalf("expected open chargeback on dashboard, body=%s", overviewRes.Body.String())
+	}
+
+	if rr := postWebhook(signedStripeDisputeWebhook(t, cfg.StripeWebhookSecret, "evt_dispute_closed", "charge.dispute.closed", "dp_router_1", intentPayload.ProviderRef, shipment.TotalCents, "won")); rr.Code != http.StatusOK {
+		t.Fatalf("dispute closed webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	closedEvidence := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/disputes/"+disputeID+"/evidence", map[string]string{
+		"kind": "other",
+		"text": "Late evidence.",
+	}, vendorToken)
+	if closedEvidence.Code != http.StatusConflict {
+		t.Fatalf("expected evidence on closed dispute 409, got %d", closedEvidence.Code)
+	}
+	payoutsRes = requestJSON(t, r, http.MethodGet, "/api/v1/vendor/payouts", nil, vendorToken)
+	if !strings.Contains(payoutsRes.Body.String(), `"held_cents":0`) || !strings.Contains(payoutsRes.Body.String(), `"status":"released"`) {
+		t.Fatalf("expected won dispute to release the hold, body=%s", payoutsRes.Body.String())
+	}
+	overviewRes = requestJSON(t, r, http.MethodGet, "/api/v1/admin/dashboard/overview", nil, finance.AccessToken)
+	if !strings.Contains(overviewRes.Body.String(), `"chargebacks_won":1`) {
+		t.Fatalf("expected won chargeback on dashboard, body=%s", overviewRes.Body.String())
+	}
+}
+
+func TestAdminWebhookEventsListAndReplay(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_events"
+	r := mustRouterWithConfig(t, cfg)
+
+	webhookBody, webhookSignature := signedStripeWebhook(t, cfg.StripeWebhookSecret, "evt_unmatched", "payment_intent.succeeded", "pi_unknown")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(webhookBody))
+	req.Header.Set(stripeSignatureHeader, webhookSignature)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected unmatched webhook 409, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	buyer := registerUser(t, r, "webhook-events-buyer@example.com")
+	if forbidden := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/webhook-events", nil, buyer.AccessToken); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected buyer 403, got %d", forbidden.Code)
+	}
+
+	finance := registerUser(t, r, "finance@example.com")
+	listRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/webhook-events?status=failed&provider=stripe", nil, finance.AccessToken)
+	if listRes.Code != http.StatusOK {
+		t.Fatalf("list webhook events status=%d body=%s", listRes.Code, listRes.Body.String())
+	}
+	var listPayload struct {
+		Items []struct {
+			ID              string `json:"id"`
+			ProviderEventID string `json:"provider_event_id"`
+			Attempts        int    `json:"attempts"`
+			Payload         string `json:"payload"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(listRes.Body.Bytes(), &listPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if listPayload.Total != 1 || listPayload.Items[0].ProviderEventID != "evt_unmatched" || listPayload.Items[0].Payload != string(webhookBody) {
+		t.Fatalf("expected the failed event stored raw, got %+v", listPayload)
+	}
+	eventID := listPayload.Items[0].ID
+
+	if detail := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/webhook-events/"+eventID, nil, finance.AccessToken); detail.Code != http.StatusOK {
+		t.Fatalf("webhook event detail status=%d body=%s", detail.Code, detail.Body.String())
+	}
+	if missing := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/webhook-events/pev_missing", nil, finance.AccessToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("expected missing event 404, got %d", missing.Code)
+	}
+	if invalid := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/webhook-events?status=stuck", nil, finance.AccessToken); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid status filter 400, got %d", invalid.Code)
+	}
+
+	replayRes := requestJSON(t, r, http.MethodPost, "/api/v1/admin/payments/webhook-events/"+eventID+"/replay", nil, finance.AccessToken)
+	if replayRes.Code != http.StatusOK || !strings.Contains(replayRes.Body.String(), `"attempts":2`) || !strings.Contains(replayRes.Body.String(), `"status":"failed"`) {
+		t.Fatalf("replay webhook event status=%d body=%s", replayRes.Code, replayRes.Body.String())
+	}
+	if missing := requestJSON(t, r, http.MethodPost, "/api/v1/admin/payments/webhook-events/pev_missing/replay", nil, finance.AccessToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("expected missing replay 404, got %d", missing.Code)
+	}
+
+	superAdmin := loginOrRegisterUser(t, r, "admin@example.com")
+	auditRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?action=payment_webhook_event_replayed", nil, superAdmin.AccessToken)
+	if auditRes.Code != http.StatusOK || !strings.Contains(auditRes.Body.String(), eventID) {
+		t.Fatalf("expected replay audit log, status=%d body=%s", auditRes.Code, auditRes.Body.String())
+	}
+}
+
+func TestAdminPaymentReconciliationReportsMismatches(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_reconcile"
+	r := mustRouterWithConfig(t, cfg)
+
+	_, productID := createApprovedVendorProduct(t, r, "vendor-reconcile@example.com", "vendor-reconcile", 2500, 10)
+	placeOrder := func(guestToken string) string {
+		t.Helper()
+		guestHeaders := map[string]string{guestTokenHeader: guestToken}
+		addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        1,
+		}, "", guestHeaders)
+		if addRes.Code != http.StatusOK {
+			t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+		orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+			"idempotency_key": guestToken + "-order",
+		}, "", guestHeaders)
+		if orderRes.Code != http.StatusCreated {
+			t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+		}
+		var payload struct {
+			Order struct {
+				ID string `json:"id"`
+			} `json:"order"`
+		}
+		if err := json.Unmarshal(orderRes.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return payload.Order.ID
+	}
+
+	codOrderID := placeOrder("gst_reconcile_cod")
+	codRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/cod/confirm", map[string]interface{}{
+		"order_id":        codOrderID,
+		"idempotency_key": "reconcile-cod",
+	}, "", map[string]string{guestTokenHeader: "gst_reconcile_cod"})
+	if codRes.Code != http.StatusCreated {
+		t.Fatalf("cod confirm status=%d body=%s", codRes.Code, codRes.Body.String())
+	}
+
+	// The mock Stripe client never sees the buyer confirm, so an order marked
+	// paid by webhook alone has no settled intent behind it.
+	paidOrderID := placeOrder("gst_reconcile_stripe")
+	intentRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        paidOrderID,
+		"idempotency_key": "reconcile-intent",
+	}, "", map[string]string{guestTokenHeader: "gst_reconcile_stripe"})
+	if intentRes.Code != http.StatusCreated {
+		t.Fatalf("create stripe intent status=%d body=%s", intentRes.Code, intentRes.Body.String())
+	}
+	var intentPayload struct {
+		ProviderRef string `json:"provider_ref"`
+	}
+	if err := json.Unmarshal(intentRes.Body.Bytes(), &intentPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	webhookBody, webhookSignature := signedStripeWebhook(t, cfg.StripeWebhookSecret, "evt_reconcile_paid", "payment_intent.succeeded", intentPayload.ProviderRef)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(webhookBody))
+	req.Header.Set(stripeSignatureHeader, webhookSignature)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("stripe webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	buyer := registerUser(t, r, "reconcile-buyer@example.com")
+	if forbidden := requestJSON(t, r, http.MethodPost, "/api/v1/admin/payments/reconciliation/run", nil, buyer.AccessToken); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected buyer 403, got %d", forbidden.Code)
+	}
+
+	finance := registerUser(t, r, "finance@example.com")
+	runRes := requestJSON(t, r, http.MethodPost, "/api/v1/admin/payments/reconciliation/run", nil, finance.AccessToken)
+	if runRes.Code != http.StatusCreated {
+		t.Fatalf("run reconciliation status=%d body=%s", runRes.Code, runRes.Body.String())
+	}
+	var report struct {
+		ID              string `json:"id"`
+		Status          string `json:"status"`
+		PaymentsChecked int    `json:"payments_checked"`
+		OrdersChecked   int    `json:"orders_checked"`
+		Mismatches      []struct {
+			Kind    string `json:"kind"`
+			OrderID string `json:"order_id"`
+			Fixable bool   `json:"fixable"`
+		} `json:"mismatches"`
+	}
+	if err := json.Unmarshal(runRes.Body.Bytes(), &report); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if report.Status != "completed" || report.PaymentsChecked != 2 || report.OrdersChecked != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Kind != "missing_payment" || report.Mismatches[0].OrderID != paidOrderID || report.Mismatches[0].Fixable {
+		t.Fatalf("expected only the webhook-paid order reported, got %+v", report.Mismatches)
+	}
+
+	csvRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/reconciliation/reports/"+report.ID+"/csv", nil, finance.AccessToken)
+	if csvRes.Code != http.StatusOK || !strings.HasPrefix(csvRes.Header().Get("Content-Type"), "text/csv") ||
+		!strings.Contains(csvRes.Body.String(), "missing_payment,"+paidOrderID) {
+		t.Fatalf("csv report status=%d type=%s body=%s", csvRes.Code, csvRes.Header().Get("Content-Type"), csvRes.Body.String())
+	}
+
+	fixRes := requestJSON(t, r, http.MethodPost, "/api/v1/admin/payments/reconciliation/reports/"+report.ID+"/fix", nil, finance.AccessToken)
+	if fixRes.Code != http.StatusOK || !strings.Contains(fixRes.Body.String(), `"fixed":0`) {
+		t.Fatalf("fix reconciliation status=%d body=%s", fixRes.Code, fixRes.Body.String())
+	}
+	if missing := requestJSON(t, r, http.MethodPost, "/api/v1/admin/payments/reconciliation/reports/rec_missing/fix", nil, finance.AccessToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("expected missing report 404, got %d", missing.Code)
+	}
+	if missing := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/reconciliation/reports/rec_missing", nil, finance.AccessToken); missing.Code != http.StatusNotFound {
+		t.Fatalf("expected missing report 404, got %d", missing.Code)
+	}
+
+	listRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/reconciliation/reports", nil, finance.AccessToken)
+	if listRes.Code != http.StatusOK || !strings.Contains(listRes.Body.String(), `"total":1`) || !strings.Contains(listRes.Body.String(), report.ID) {
+		t.Fatalf("list reconciliation reports status=%d body=%s", listRes.Code, listRes.Body.String())
+	}
+}
+
+func TestPaymentStatusPollingFollowsThreeDSecureAndExpiresCancelledOrders(t *testing.T) {
+	cfg := testConfig()
+	cfg.StripeWebhookSecret = "whsec_router_3ds"
+	r := mustRouterWithConfig(t, cfg)
+
+	_, productID := createApprovedVendorProduct(t, r, "vendor-3ds@example.com", "vendor-3ds", 3100, 5)
+	guestHeaders := map[string]string{guestTokenHeader: "gst_router_3ds"}
+	addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", guestHeaders)
+	if addRes.Code != http.StatusOK {
+		t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "router-3ds-order",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID string `json:"id"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	intentRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "router-3ds-intent",
+	}, "", guestHeaders)
+	if intentRes.Code != http.StatusCreated {
+		t.Fatalf("create stripe intent status=%d body=%s", intentRes.Code, intentRes.Body.String())
+	}
+	var intent struct {
+		ID           string `json:"id"`
+		ProviderRef  string `json:"provider_ref"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.Unmarshal(intentRes.Body.Bytes(), &intent); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	sendWebhook := func(eventID, eventType string) {
+		t.Helper()
+		body, signature := signedStripeWebhook(t, cfg.StripeWebhookSecret, eventID, eventType, intent.ProviderRef)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewBuffer(body))
+		req.Header.Set(stripeSignatureHeader, signature)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("stripe webhook %s status=%d body=%s", eventType, rr.Code, rr.Body.String())
+		}
+	}
+	type paymentStatus struct {
+		Status         string `json:"status"`
+		OrderStatus    string `json:"order_status"`
+		ActionRequired bool   `json:"action_required"`
+		ClientSecret   string `json:"client_secret"`
+	}
+	poll := func() paymentStatus {
+		t.Helper()
+		res := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/payments/"+intent.ID, nil, "", guestHeaders)
+		if res.Code != http.StatusOK {
+			t.Fatalf("payment status status=%d body=%s", res.Code, res.Body.String())
+		}
+		var status paymentStatus
+		if err := json.Unmarshal(res.Body.Bytes(), &status); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return status
+	}
+
+	sendWebhook("evt_router_3ds_action", "payment_intent.requires_action")
+	if status := poll(); status.Status != "requires_action" || !status.ActionRequired || status.ClientSecret != intent.ClientSecret ||
+		status.OrderStatus != "pending_payment" {
+		t.Fatalf("expected 3-D Secure challenge pending, got %+v", status)
+	}
+
+	otherGuest := map[string]string{guestTokenHeader: "gst_router_3ds_other"}
+	if res := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/payments/"+intent.ID, nil, "", otherGuest); res.Code != http.StatusNotFound {
+		t.Fatalf("expected another guest to get 404, got %d", res.Code)
+	}
+	if res := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/payments/pay_missing", nil, "", guestHeaders); res.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown payment 404, got %d", res.Code)
+	}
+
+	sendWebhook("evt_router_3ds_canceled", "payment_intent.canceled")
+	if status := poll(); status.Status != "cancelled" || status.OrderStatus != "expired" || status.ActionRequired {
+		t.Fatalf("expected cancelled payment and expired order, got %+v", status)
+	}
+	retryRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/stripe/intent", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "router-3ds-intent-retry",
+	}, "", guestHeaders)
+	if retryRes.Code != http.StatusConflict {
+		t.Fatalf("expected expired order not payable, got %d body=%s", retryRes.Code, retryRes.Body.String())
+	}
+}
+
+func TestCODCollectionRefusalsAndVendorRemittance(t *testing.T) {
+	cfg := testConfig()
+	cfg.DefaultCommission = 1000
+	cfg.CarrierWebhookSecret = "carrier_cod_secret"
+	r := mustRouterWithConfig(t, cfg)
+
+	vendorToken, productID := createApprovedVendorProduct(t, r, "vendor-cod-cash@example.com", "vendor-cod-cash", 2500, 10)
+	placeCODOrder := func(guestToken, key string) (string, string, int) {
+		t.Helper()
+		guestHeaders := map[string]string{guestTokenHeader: guestToken}
+		addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        1,
+		}, "", guestHeaders)
+		if addRes.Code != http.StatusOK {
+			t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+		orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+			"idempotency_key": key + "-order",
+		}, "", guestHeaders)
+		if orderRes.Code != http.StatusCreated {
+			t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+		}
+		var payload struct {
+			Order struct {
+				ID        string `json:"id"`
+				Shipments []struct {
+					ID string `json:"id"`
+				} `json:"shipments"`
+			} `json:"order"`
+		}
+		if err := json.Unmarshal(orderRes.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		codRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/cod/confirm", map[string]interface{}{
+			"order_id":        payload.Order.ID,
+			"idempotency_key": key + "-cod",
+		}, "", guestHeaders)
+		return payload.Order.ID, payload.Order.Shipments[0].ID, codRes.Code
+	}
+	ship := func(shipmentID, trackingNumber string) {
+		t.Helper()
+		body := map[string]string{"status": "shipped"}
+		if trackingNumber != "" {
+			body["carrier_code"] = "fake"
+			body["tracking_number"] = trackingNumber
+		}
+		if shipRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/shipments/"+shipmentID+"/status", body, vendorToken); shipRes.Code != http.StatusOK {
+			t.Fatalf("ship status=%d body=%s", shipRes.Code, shipRes.Body.String())
+		}
+	}
+
+	_, cashShipment, code := placeCODOrder("gst_cod_cash", "cod-cash")
+	if code != http.StatusCreated {
+		t.Fatalf("cod confirm status=%d", code)
+	}
+	early := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/shipments/"+cashShipment+"/cod-collection", map[string]string{"outcome": "collected"}, vendorToken)
+	if early.Code != http.StatusConflict {
+		t.Fatalf("expected collection before shipping 409, got status=%d body=%s", early.Code, early.Body.String())
+	}
+	ship(cashShipment, "")
+	understated := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/shipments/"+cashShipment+"/cod-collection", map[string]interface{}{"outcome": "collected", "amount_cents": 1}, vendorToken)
+	if understated.Code != http.StatusBadRequest {
+		t.Fatalf("expected an amount other than the shipment total to be rejected, status=%d body=%s", understated.Code, understated.Body.String())
+	}
+	collectRes := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/shipments/"+cashShipment+"/cod-collection", map[string]string{"outcome": "collected"}, vendorToken)
+	if collectRes.Code != http.StatusOK {
+		t.Fatalf("cod collection status=%d body=%s", collectRes.Code, collectRes.Body.String())
+	}
+	var collected struct {
+		Shipment struct {
+			Status      string `json:"status"`
+			OrderStatus string `json:"order_status"`
+		} `json:"shipment"`
+		Payment struct {
+			Status         string `json:"status"`
+			CollectedCents int64  `json:"collected_cents"`
+		} `json:"payment"`
+	}
+	if err := json.Unmarshal(collectRes.Body.Bytes(), &collected); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if collected.Shipment.Status != "delivered" || collected.Payment.Status != "collected" || collected.Payment.CollectedCents != 3000 {
+		t.Fatalf("unexpected collection payload %s", collectRes.Body.String())
+	}
+
+	balanceRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/payouts/cod-balance", nil, vendorToken)
+	if balanceRes.Code != http.StatusOK || !strings.Contains(balanceRes.Body.String(), `"outstanding_cents":300`) {
+		t.Fatalf("expected vendor to owe 300 commission, got status=%d body=%s", balanceRes.Code, balanceRes.Body.String())
+	}
+
+	finance := registerUser(t, r, "finance@example.com")
+	if forbidden := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/cod/balances", nil, vendorToken); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected vendor 403, got %d", forbidden.Code)
+	}
+	var balances struct {
+		Items []struct {
+			VendorID string `json:"vendor_id"`
+		} `json:"items"`
+		Total int `json:"total"`
+	}
+	listRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/cod/balances", nil, finance.AccessToken)
+	if err := json.Unmarshal(listRes.Body.Bytes(), &balances); err != nil || balances.Total != 1 {
+		t.Fatalf("expected one COD balance, got status=%d body=%s", listRes.Code, listRes.Body.String())
+	}
+	remitPath := "/api/v1/admin/payments/cod/balances/" + balances.Items[0].VendorID + "/remittances"
+	tooMuch := requestJSON(t, r, http.MethodPost, remitPath, map[string]interface{}{
+		"currency": "USD", "amount_cents": 400, "reference": "bank-cod-1",
+	}, finance.AccessToken)
+	if tooMuch.Code != http.StatusConflict {
+		t.Fatalf("expected over-remittance 409, got status=%d body=%s", tooMuch.Code, tooMuch.Body.String())
+	}
+	remitRes := requestJSON(t, r, http.MethodPost, remitPath, map[string]interface{}{
+		"currency": "USD", "amount_cents": 100, "reference": "bank-cod-1",
+	}, finance.AccessToken)
+	if remitRes.Code != http.StatusCreated || !strings.Contains(remitRes.Body.String(), `"outstanding_cents":200`) {
+		t.Fatalf("remittance status=%d body=%s", remitRes.Code, remitRes.Body.String())
+	}
+
+	scanRefusedOrder, scanRefusedShipment, _ := placeCODOrder("gst_cod_refuser", "cod-refused-1")
+	ship(scanRefusedShipment, "trk-cod-refused")
+	payload := []byte(`{"events":[{"id":"scan_cod_refused","tracking_number":"TRK-COD-REFUSED","status":"refused"}]}`)
+	if webhookRes := requestRawWithHeaders(r, http.MethodPost, "/api/v1/webhooks/carriers/fake", payload, map[string]string{
+		carrierSignatureHeader: carriers.SignFilePayload("carrier_cod_secret", payload),
+	}); webhookRes.Code != http.StatusOK {
+		t.Fatalf("carrier webhook status=%d body=%s", webhookRes.Code, webhookRes.Body.String())
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/orders/"+scanRefusedOrder, nil, "", map[string]string{guestTokenHeader: "gst_cod_refuser"})
+	if !strings.Contains(orderRes.Body.String(), `"status":"payment_failed"`) || !strings.Contains(orderRes.Body.String(), `"status":"cancelled"`) {
+		t.Fatalf("expected refused order failed with its shipment cancelled, got %s", orderRes.Body.String())
+	}
+
+	_, vendorRefusedShipment, _ := placeCODOrder("gst_cod_refuser", "cod-refused-2")
+	ship(vendorRefusedShipment, "")
+	if refuseRes := requestJSON(t, r, http.MethodPost, "/api/v1/vendor/shipments/"+vendorRefusedShipment+"/cod-collection", map[string]string{"outcome": "refused"}, vendorToken); refuseRes.Code != http.StatusOK {
+		t.Fatalf("cod refusal status=%d body=%s", refuseRes.Code, refuseRes.Body.String())
+	}
+	if _, _, code := placeCODOrder("gst_cod_refuser", "cod-refused-3"); code != http.StatusConflict {
+		t.Fatalf("expected flagged buyer COD 409, got %d", code)
+	}
+
+	var flags struct {
+		Items []struct {
+			BuyerRef string `json:"buyer_ref"`
+			Flagged  bool   `json:"flagged"`
+		} `json:"items"`
+	}
+	flagsRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/payments/cod/flagged-buyers", nil, finance.AccessToken)
+	if err := json.Unmarshal(flagsRes.Body.Bytes(), &flags); err != nil || len(flags.Items) != 1 || !flags.Items[0].Flagged {
+		t.Fatalf("expected one flagged buyer, got status=%d body=%s", flagsRes.Code, flagsRes.Body.String())
+	}
+	if clearRes := requestJSON(t, r, http.MethodDelete, "/api/v1/admin/payments/cod/flagged-buyers/"+flags.Items[0].BuyerRef, nil, finance.AccessToken); clearRes.Code != http.StatusNoContent {
+		t.Fatalf("clear flag status=%d body=%s", clearRes.Code, clearRes.Body.String())
+	}
+	if _, _, code := placeCODOrder("gst_cod_refuser", "cod-refused-4"); code != http.StatusCreated {
+		t.Fatalf("expected cleared buyer COD 201, got %d", code)
+	}
+}
+
+func TestPerVendorInvoicesCommissionAndCreditNotes(t *testing.T) {
+	cfg := testConfig()
+	cfg.DefaultCommission = 1000
+	r := mustRouterWithConfig(t, cfg)
+
+	paperToken, paperProduct := createApprovedVendorProduct(t, r, "vendor-invoice-paper@example.com", "paper-goods", 2500, 10)
+	cupsToken, cupsProduct := createApprovedVendorProduct(t, r, "vendor-invoice-cups@example.com", "cups-goods", 1500, 10)
+
+	if unsupported := requestJSON(t, r, http.MethodPut, "/api/v1/vendor/legal-details", map[string]string{
+		"legal_name":     "Paper Goods GmbH",
+		"address":        "1 Mill Road, Berlin",
+		"invoice_locale": "pt",
+	}, paperToken); unsupported.Code != http.StatusBadRequest {
+		t.Fatalf("expected unsupported invoice locale 400, got status=%d body=%s", unsupported.Code, unsupported.Body.String())
+	}
+	legalRes := requestJSON(t, r, http.MethodPut, "/api/v1/vendor/legal-details", map[string]string{
+		"legal_name":     "Paper Goods GmbH",
+		"tax_id":         "DE123456789",
+		"address":        "1 Mill Road, Berlin",
+		"invoice_locale": "DE",
+		"invoice_footer": "Amtsgericht Berlin HRB 12345",
+	}, paperToken)
+	if legalRes.Code != http.StatusOK {
+		t.Fatalf("legal details status=%d body=%s", legalRes.Code, legalRes.Body.String())
+	}
+	if invalid := requestJSON(t, r, http.MethodPut, "/api/v1/vendor/legal-details", map[string]string{"legal_name": "Cups Ltd"}, cupsToken); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected missing address 400, got status=%d body=%s", invalid.Code, invalid.Body.String())
+	}
+
+	guestHeaders := map[string]string{guestTokenHeader: "gst_split_invoices"}
+	for _, productID := range []string{paperProduct, cupsProduct} {
+		addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+			"product_id": productID,
+			"qty":        1,
+		}, "", guestHeaders)
+		if addRes.Code != http.StatusOK {
+			t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+		}
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "idem-split-invoices",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID string `json:"id"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	orderID := orderPayload.Order.ID
+
+	codRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/cod/confirm", map[string]interface{}{
+		"order_id":        orderID,
+		"idempotency_key": "idem-split-invoices-cod",
+	}, "", guestHeaders)
+	if codRes.Code != http.StatusCreated {
+		t.Fatalf("cod confirm status=%d body=%s", codRes.Code, codRes.Body.String())
+	}
+
+	type invoiceDocument struct {
+		ID                    string `json:"id"`
+		Kind                  string `json:"kind"`
+		ShipmentID            string `json:"shipment_id"`
+		VendorID              string `json:"vendor_id"`
+		InvoiceNumber         string `json:"invoice_number"`
+		OriginalInvoiceNumber string `json:"original_invoice_number"`
+		TotalCents            int64  `json:"total_cents"`
+		Locale                string `json:"locale"`
+		Footer                string `json:"footer"`
+		Issuer                struct {
+			LegalName string `json:"legal_name"`
+			TaxID     string `json:"tax_id"`
+		} `json:"issuer"`
+	}
+	listBuyerDocuments := func() map[string]invoiceDocument {
+		t.Helper()
+		listRes := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/invoices/"+orderID, nil, "", guestHeaders)
+		if listRes.Code != http.StatusOK {
+			t.Fatalf("invoice list status=%d body=%s", listRes.Code, listRes.Body.String())
+		}
+		var payload struct {
+			Items []invoiceDocument `json:"items"`
+		}
+		if err := json.Unmarshal(listRes.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		documents := make(map[string]invoiceDocument, len(payload.Items))
+		for _, item := range payload.Items {
+			documents[item.InvoiceNumber] = item
+		}
+		return documents
+	}
+
+	documents := listBuyerDocuments()
+	paperInvoice, cupsInvoice := documents["INV-PAPER-GOODS-000001"], documents["INV-CUPS-GOODS-000001"]
+	if len(documents) != 2 || paperInvoice.Issuer.LegalName != "Paper Goods GmbH" || paperInvoice.Issuer.TaxID != "DE123456789" || paperInvoice.TotalCents != 3000 {
+		t.Fatalf("expected one invoice per vendor with the seller's legal details, got %+v", documents)
+	}
+	if paperInvoice.Locale != "de" || paperInvoice.Footer != "Amtsgericht Berlin HRB 12345" || cupsInvoice.Locale != "en" || cupsInvoice.Footer != "" {
+		t.Fatalf("expected the paper vendor's German template and footer only, got %+v and %+v", paperInvoice, cupsInvoice)
+	}
+	if cupsInvoice.Kind != "invoice" || cupsInvoice.TotalCents != 2000 {
+		t.Fatalf("expected the cups vendor's shipment invoice, got %+v", cupsInvoice)
+	}
+
+	ambiguous := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/invoices/"+orderID+"/download", nil, "", guestHeaders)
+	if ambiguous.Code != http.StatusBadRequest {
+		t.Fatalf("expected invoice_id required 400, got status=%d body=%s", ambiguous.Code, ambiguous.Body.String())
+	}
+	downloadRes := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/invoices/"+orderID+"/download?invoice_id="+paperInvoice.ID, nil, "", guestHeaders)
+	if downloadRes.Code != http.StatusOK || !bytes.HasPrefix(downloadRes.Body.Bytes(), []byte("%PDF")) {
+		t.Fatalf("invoice download status=%d body=%q", downloadRes.Code, downloadRes.Body.String())
+	}
+
+	vendorListRes := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/invoices", nil, paperToken)
+	if vendorListRes.Code != http.StatusOK {
+		t.Fatalf("vendor invoice list status=%d body=%s", vendorListRes.Code, vendorListRes.Body.String())
+	}
+	var vendorList struct {
+		Total int               `json:"total"`
+		Items []invoiceDocument `json:"items"`
+	}
+	if err := json.Unmarshal(vendorListRes.Body.Bytes(), &vendorList); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	kinds := make(map[string]string)
+	for _, item := range vendorList.Items {
+		kinds[item.Kind] = item.InvoiceNumber
+	}
+	if vendorList.Total != 2 || kinds["invoice"] != paperInvoice.InvoiceNumber || !strings.HasPrefix(kinds["commission_invoice"], "COM-MKT-") {
+		t.Fatalf("expected the vendor's invoice and its commission invoice, got %+v", vendorList.Items)
+	}
+	if foreign := requestJSON(t, r, http.MethodGet, "/api/v1/vendor/invoices/"+cupsInvoice.ID+"/download", nil, paperToken); foreign.Code != http.StatusNotFound {
+		t.Fatalf("expected another vendor's invoice 404, got status=%d", foreign.Code)
+	}
+
+	refundCreateRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/orders/"+orderID+"/refund-requests", map[string]interface{}{
+		"shipment_id": paperInvoice.ShipmentID,
+		"reason":      "Item arrived damaged",
+	}, "", guestHeaders)
+	if refundCreateRes.Code != http.StatusCreated {
+		t.Fatalf("create refund request status=%d body=%s", refundCreateRes.Code, refundCreateRes.Body.String())
+	}
+	var refundPayload struct {
+		RefundRequest struct {
+			ID string `json:"id"`
+		} `json:"refund_request"`
+	}
+	if err := json.Unmarshal(refundCreateRes.Body.Bytes(), &refundPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	approveRes := requestJSON(t, r, http.MethodPatch, "/api/v1/vendor/refund-requests/"+refundPayload.RefundRequest.ID+"/decision", map[string]string{
+		"decision":        "approve",
+		"decision_reason": "Damaged in transit",
+	}, paperToken)
+	if approveRes.Code != http.StatusOK {
+		t.Fatalf("approve refund status=%d body=%s", approveRes.Code, approveRes.Body.String())
+	}
+
+	creditNote := listBuyerDocuments()["CN-PAPER-GOODS-000001"]
+	if creditNote.Kind != "credit_note" || creditNote.OriginalInvoiceNumber != paperInvoice.InvoiceNumber || creditNote.VendorID != paperInvoice.VendorID {
+		t.Fatalf("expected a credit note against the paper invoice, got %+v", creditNote)
+	}
+
+	finance := registerUser(t, r, "finance@example.com")
+	adminListRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/invoices?kind=credit_note", nil, finance.AccessToken)
+	if adminListRes.Code != http.StatusOK || !strings.Contains(adminListRes.Body.String(), `"total":1`) {
+		t.Fatalf("expected one credit note for finance, got status=%d body=%s", adminListRes.Code, adminListRes.Body.String())
+	}
+	if forbidden := requestJSON(t, r, http.MethodGet, "/api/v1/admin/invoices", nil, cupsToken); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected vendor forbidden from the admin invoice list, got status=%d", forbidden.Code)
+	}
+}
+
+func TestStoredInvoicesRedownloadAfterRestartAndArchiveForFinance(t *testing.T) {
+	cfg := testConfig()
+	cfg.InvoiceStorageDir = t.TempDir()
+	r := mustRouterWithConfig(t, cfg)
+
+	vendorToken, productID := createApprovedVendorProduct(t, r, "vendor-archive@example.com", "archive-goods", 2500, 5)
+	guestHeaders := map[string]string{guestTokenHeader: "gst_invoice_archive"}
+	if addRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/cart/items", map[string]interface{}{
+		"product_id": productID,
+		"qty":        1,
+	}, "", guestHeaders); addRes.Code != http.StatusOK {
+		t.Fatalf("add cart item status=%d body=%s", addRes.Code, addRes.Body.String())
+	}
+	orderRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/checkout/place-order", map[string]interface{}{
+		"idempotency_key": "idem-invoice-archive",
+	}, "", guestHeaders)
+	if orderRes.Code != http.StatusCreated {
+		t.Fatalf("place order status=%d body=%s", orderRes.Code, orderRes.Body.String())
+	}
+	var orderPayload struct {
+		Order struct {
+			ID string `json:"id"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(orderRes.Body.Bytes(), &orderPayload); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if codRes := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/payments/cod/confirm", map[string]interface{}{
+		"order_id":        orderPayload.Order.ID,
+		"idempotency_key": "idem-invoice-archive-cod",
+	}, "", guestHeaders); codRes.Code != http.StatusCreated {
+		t.Fatalf("cod confirm status=%d body=%s", codRes.Code, codRes.Body.String())
+	}
+
+	first := requestJSONWithHeaders(t, r, http.MethodGet, "/api/v1/invoices/"+orderPayload.Order.ID+"/download", nil, "", guestHeaders)
+	if first.Code != http.StatusOK {
+		t.Fatalf("invoice download status=%d body=%s", first.Code, first.Body.String())
+	}
+	sum := sha256.Sum256(first.Body.Bytes())
+	if first.Header().Get("X-Content-SHA256") != hex.EncodeToString(sum[:]) || first.Header().Get("ETag") == "" {
+		t.Fatalf("expected the content hash headers, got %v", first.Header())
+	}
+
+	finance := registerUser(t, r, "finance@example.com")
+	var listPayload struct {
+		Items []struct {
+			ID            string `json:"id"`
+			InvoiceNumber string `json:"invoice_number"`
+			StorageKey    string `json:"storage_key"`
+		} `json:"items"`
+	}
+	listRes := requestJSON(t, r, http.MethodGet, "/api/v1/admin/invoices", nil, finance.AccessToken)
+	if err := json.Unmarshal(listRes.Body.Bytes(), &listPayload); err != nil || len(listPayload.Items) != 1 || listPayload.Items[0].StorageKey == "" {
+		t.Fatalf("expected one stored invoice, got %s", listRes.Body.String())
+	}
+
+	restarted := mustRouterWithConfig(t, cfg)
+	restartedFinance := registerUser(t, restarted, "finance@example.com")
+	again := requestJSON(t, restarted, http.MethodGet, "/api/v1/admin/invoices/"+listPayload.Items[0].ID+"/download", nil, restartedFinance.AccessToken)
+	if again.Code != http.StatusOK || !bytes.Equal(again.Body.Bytes(), first.Body.Bytes()) {
+		t.Fatalf("expected the exact stored PDF after a restart, got status=%d", again.Code)
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	archiveRes := requestJSON(t, restarted, http.MethodGet, "/api/v1/admin/invoices/archive?from="+today+"&to="+today, nil, restartedFinance.AccessToken)
+	if archiveRes.Code != http.StatusOK || archiveRes.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("archive status=%d body=%s", archiveRes.Code, archiveRes.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(archiveRes.Body.Bytes()), int64(archiveRes.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	names := make([]string, 0, len(archive.File))
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[1] != "manifest.csv" || !strings.HasPrefix(names[0], "invoice-inv-archive-goods-") {
+		t.Fatalf("expected the invoice PDF and a manifest, got %v", names)
+	}
+
+	if invalid := requestJSON(t, restarted, http.MethodGet, "/api/v1/admin/invoices/archive?from=2026-01-01&to=2025-01-01", nil, restartedFinance.AccessToken); invalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected an inverted range 400, got status=%d", invalid.Code)
+	}
+	if forbidden := requestJSON(t, r, http.MethodGet, "/api/v1/admin/invoices/archive?from="+today+"&to="+today, nil, vendorToken); forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected vendor archive access 403, got status=%d", forbidden.Code)
+	}
+}
+
+// mailedToken returns the token linked from the newest mail of a kind that
+// the file mailer wrote to mailDir.
+func mailedToken(t *testing.T, mailDir, kind string) string {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(mailDir, "*.eml"))
+	sort.Strings(files)
+	for i := len(files) - 1; i >= 0; i-- {
+		raw, err := os.ReadFile(files[i])
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		message := string(raw)
+		if !strings.Contains(message, "X-Mail-Kind: "+kind+"\r\n") {
+			continue
+		}
+		_, rest, found := strings.Cut(message, "?token=")
+		if !found {
+			t.Fatalf("expected a token link in %q", message)
+		}
+		token, _, _ := strings.Cut(rest, "\r\n")
+		unescaped, err := url.QueryUnescape(token)
+		if err != nil {
+			t.Fatalf("QueryUnescape() error = %v", err)
+		}
+		return unescaped
+	}
+	t.Fatalf("no %s mail in %v", kind, files)
+	return ""
+}
+
+func TestEmailVerificationAndPasswordResetRevokeSessions(t *testing.T) {
+	cfg := testConfig()
+	cfg.MailTransport = "file"
+	cfg.MailDir = t.TempDir()
+	cfg.RequireVerifiedEmail = true
+	r := mustRouterWithConfig(t, cfg)
+
+	rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/register", map[string]string{"email": "verify@example.com", "password": "strong-password"}, "")
+	if rr.Code != http.StatusCreated || strings.Contains(rr.Body.String(), "access_token") || !strings.Contains(rr.Body.String(), `"verification_required":true`) {
+		t.Fatalf("expected registration without tokens, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": "verify@example.com", "password": "strong-password"}, "")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected unverified login to be refused, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/email-verification", map[string]string{"email": "verify@example.com"}, "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("resend verification status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/email-verification/confirm", map[string]string{"token": "not-a-token"}, "")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid verification token to fail, status=%d", rr.Code)
+	}
+	verificationToken := mailedToken(t, cfg.MailDir, "email_verification")
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/email-verification/confirm", map[string]string{"token": verificationToken}, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"email_verified":true`) {
+		t.Fatalf("verify email status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/email-verification/confirm", map[string]string{"token": verificationToken}, "")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected the verification token to be single-use, status=%d", rr.Code)
+	}
+
+	first := loginUser(t, r, "verify@example.com")
+	second := loginUser(t, r, "verify@example.com")
+
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/password-reset", map[string]string{"email": "nobody@example.com"}, "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected unknown emails to be accepted silently, status=%d", rr.Code)
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/password-reset", map[string]string{"email": "verify@example.com"}, "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("password reset request status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	resetToken := mailedToken(t, cfg.MailDir, "password_reset")
+
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/password-reset/confirm", map[string]string{"token": resetToken, "password": "short"}, "")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a weak password to be rejected, status=%d", rr.Code)
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/password-reset/confirm", map[string]string{"token": resetToken, "password": "new-strong-password"}, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"revoked_sessions":2`) {
+		t.Fatalf("password reset status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/password-reset/confirm", map[string]string{"token": resetToken, "password": "another-password"}, "")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected the reset token to be single-use, status=%d", rr.Code)
+	}
+
+	for _, session := range []authPayload{first, second} {
+		rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": session.RefreshToken}, "")
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected sessions to be revoked after the reset, status=%d", rr.Code)
+		}
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": "verify@example.com", "password": "strong-password"}, "")
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the old password to stop working, status=%d", rr.Code)
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": "verify@example.com", "password": "new-strong-password"}, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the new password to work, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestTOTPLoginAndPerRoleMFAPolicyGuardPrivilegedPermissions(t *testing.T) {
+	cfg := testConfig()
+	cfg.MFAChallengeTTL = testSeconds(300)
+	r := mustRouterWithConfig(t, cfg)
+	admin := registerUser(t, r, "admin@example.com")
+	finance := registerUser(t, r, "finance@example.com")
+
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/settings/payments", nil, finance.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected finance to read payment settings without a policy, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/security/mfa-policy", map[string]interface{}{"required_roles": []string{"finance"}}, finance.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected finance not to manage the mfa policy, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/security/mfa-policy", map[string]interface{}{"required_roles": []string{"janitor"}}, admin.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown roles to be rejected, status=%d", rr.Code)
+	}
+	rr := requestJSON(t, r, http.MethodPut, "/api/v1/admin/security/mfa-policy", map[string]interface{}{"required_roles": []string{"finance", "vendor_owner"}}, admin.AccessToken)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"required_roles":["finance","vendor_owner"]`) {
+		t.Fatalf("update mfa policy status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = requestJSON(t, r, http.MethodGet, "/api/v1/admin/settings/payments", nil, finance.AccessToken)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "multi-factor") {
+		t.Fatalf("expected privileged access to need mfa, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": "finance@example.com", "password": "strong-password"}, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"mfa_enrollment_required":true`) {
+		t.Fatalf("expected login to ask for enrolment, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/mfa/enroll", nil, finance.AccessToken)
+	var enrollment struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &enrollment) != nil || !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/Marketplace:finance@example.com?") {
+		t.Fatalf("enroll status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/mfa/enroll/confirm", map[string]string{"code": "000000"}, finance.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a wrong code to be rejected, status=%d", rr.Code)
+	}
+	code, err := auth.TOTPCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("TOTPCode() error = %v", err)
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/mfa/enroll/confirm", map[string]string{"code": code}, finance.AccessToken)
+	var enrolled struct {
+		authPayload
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &enrolled) != nil || len(enrolled.RecoveryCodes) != 10 {
+		t.Fatalf("confirm enrolment status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/settings/payments", nil, enrolled.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected the enrolled session to pass mfa, status=%d", rr.Code)
+	}
+
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": "finance@example.com", "password": "strong-password"}, "")
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		AccessToken string `json:"access_token"`
+	}
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &challenge) != nil || !challenge.MFARequired || challenge.MFAToken == "" || challenge.AccessToken != "" {
+		t.Fatalf("expected a two-step login, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, challenge.MFAToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the challenge token not to authenticate, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/mfa/verify", map[string]string{"mfa_token": challenge.MFAToken, "code": code}, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a replayed totp code to be rejected, status=%d", rr.Code)
+	}
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/mfa/verify", map[string]string{"mfa_token": challenge.MFAToken, "code": enrolled.RecoveryCodes[0]}, "")
+	var verified authPayload
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &verified) != nil {
+		t.Fatalf("verify with recovery code status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	refreshed := requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": verified.RefreshToken}, "")
+	var refreshedPayload authPayload
+	if refreshed.Code != http.StatusOK || json.Unmarshal(refreshed.Body.Bytes(), &refreshedPayload) != nil {
+		t.Fatalf("refresh status=%d body=%s", refreshed.Code, refreshed.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/admin/settings/payments", nil, refreshedPayload.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected refreshed tokens to keep mfa, status=%d", rr.Code)
+	}
+	rr = requestJSON(t, r, http.MethodGet, "/api/v1/auth/mfa", nil, refreshedPayload.AccessToken)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"session_verified":true`) || !strings.Contains(rr.Body.String(), `"recovery_codes_remaining":9`) {
+		t.Fatalf("mfa status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/mfa/disable", map[string]string{"code": enrolled.RecoveryCodes[1]}, refreshedPayload.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected mfa to stay on while the role requires it, status=%d", rr.Code)
+	}
+
+	rr = requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?action=mfa_policy_updated", nil, admin.AccessToken)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "mfa_policy_updated") {
+		t.Fatalf("expected the policy change to be audited, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestOIDCSignInLinksByVerifiedEmailAndManagesIdentities(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("marketplace-web", "client-secret")
+	if err != nil {
+		t.Fatalf("NewIssuer() error = %v", err)
+	}
+	defer issuer.Close()
+
+	cfg := testConfig()
+	cfg.WebBaseURL = "https://shop.example.com"
+	cfg.OIDCProviders = "acme=" + issuer.URL() + ",globex=" + issuer.URL()
+	cfg.OIDCClientIDs = "acme=marketplace-web,globex=marketplace-web"
+	cfg.OIDCClientSecrets = "acme=client-secret,globex=client-secret"
+	cfg.MailTransport = "file"
+	cfg.MailDir = t.TempDir()
+	r := mustRouterWithConfig(t, cfg)
+	existing := registerUser(t, r, "linked@example.com")
+
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/oidc/providers", nil, ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `["acme","globex"]`) {
+		t.Fatalf("providers status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/oidc/unknown/authorize", nil, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown providers to 404, status=%d", rr.Code)
+	}
+
+	type authorization struct {
+		URL    string `json:"authorization_url"`
+		State  string `json:"state"`
+		cookie string
+	}
+	begin := func(path, token string) authorization {
+		t.Helper()
+		rr := requestJSON(t, r, http.MethodPost, path, nil, token)
+		var payload authorization
+		if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &payload) != nil {
+			t.Fatalf("authorize status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(payload.URL, url.QueryEscape("https://shop.example.com/auth/oidc/")) {
+			t.Fatalf("expected the web app callback as redirect uri, got %q", payload.URL)
+		}
+		for _, cookie := range rr.Result().Cookies() {
+			if cookie.Name == "oidc_state" && cookie.Value == payload.State && cookie.HttpOnly && cookie.Secure {
+				payload.cookie = cookie.Name + "=" + cookie.Value
+			}
+		}
+		if payload.cookie == "" {
+			t.Fatalf("expected a secure state cookie, got %v", rr.Header().Values("Set-Cookie"))
+		}
+		return payload
+	}
+	complete := func(provider, cookie string, query url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		return requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/auth/oidc/"+provider+"/callback", map[string]string{"state": query.Get("state"), "code": query.Get("code")}, "", map[string]string{"Cookie": cookie})
+	}
+	callback := func(provider string, started authorization, user oidctest.User) *httptest.ResponseRecorder {
+		t.Helper()
+		query, err := issuer.Authorize(started.URL, user)
+		if err != nil {
+			t.Fatalf("Authorize() error = %v", err)
+		}
+		return complete(provider, started.cookie, query)
+	}
+
+	// A state only completes in the browser that started the flow.
+	started := begin("/api/v1/auth/oidc/acme/authorize", "")
+	query, err := issuer.Authorize(started.URL, oidctest.User{Subject: "acme-1", Email: "linked@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if rr := complete("acme", "", query); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a callback without the state cookie to be rejected, status=%d", rr.Code)
+	}
+	if rr := complete("acme", begin("/api/v1/auth/oidc/acme/authorize", "").cookie, query); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected another browser's state cookie to be rejected, status=%d", rr.Code)
+	}
+
+	// The password account's email is not verified yet, so whoever holds the
+	// provider account has to sign in first and link from there.
+	rr := callback("acme", begin("/api/v1/auth/oidc/acme/authorize", ""), oidctest.User{Subject: "acme-1", Email: "linked@example.com", EmailVerified: true})
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected an unverified account not to be linked, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/email-verification", map[string]string{"email": "linked@example.com"}, ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("resend verification status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/email-verification/confirm", map[string]string{"token": mailedToken(t, cfg.MailDir, "email_verification")}, ""); rr.Code != http.StatusOK {
+		t.Fatalf("verify email status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	started = begin("/api/v1/auth/oidc/acme/authorize", "")
+	rr = callback("acme", started, oidctest.User{Subject: "acme-1", Email: "linked@example.com", EmailVerified: true})
+	var signedIn authPayload
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &signedIn) != nil || signedIn.User.ID != existing.User.ID || signedIn.AccessToken == "" {
+		t.Fatalf("expected the verified email to sign in the existing user, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := complete("acme", started.cookie, url.Values{"state": {started.State}, "code": {"replayed"}}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a used state to be rejected, status=%d", rr.Code)
+	}
+
+	rr = callback("acme", begin("/api/v1/auth/oidc/acme/authorize", ""), oidctest.User{Subject: "acme-2", Email: "unverified@example.com"})
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected an unverified provider email to be refused, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = callback("acme", begin("/api/v1/auth/oidc/acme/authorize", ""), oidctest.User{Subject: "acme-3", Email: "fresh@example.com", EmailVerified: true})
+	var fresh authPayload
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &fresh) != nil || fresh.User.Role != "buyer" {
+		t.Fatalf("expected a new account for an unknown verified email, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = requestJSON(t, r, http.MethodGet, "/api/v1/auth/identities", nil, fresh.AccessToken)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"has_password":false`) || !strings.Contains(rr.Body.String(), `"subject":"acme-3"`) {
+		t.Fatalf("identities status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/auth/identities/acme", nil, fresh.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected the only sign-in method to stay, status=%d", rr.Code)
+	}
+
+	linking := begin("/api/v1/auth/identities/globex", signedIn.AccessToken)
+	rr = callback("globex", linking, oidctest.User{Subject: "acme-3", Email: "someone@example.com", EmailVerified: true})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"provider":"globex"`) || !strings.Contains(rr.Body.String(), `"provider":"acme"`) {
+		t.Fatalf("link status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = callback("globex", begin("/api/v1/auth/identities/globex", fresh.AccessToken), oidctest.User{Subject: "acme-3"})
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected an identity linked to another user to be refused, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = requestJSON(t, r, http.MethodDelete, "/api/v1/auth/identities/acme", nil, signedIn.AccessToken)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), `"provider":"acme"`) {
+		t.Fatalf("unlink status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/auth/identities/acme", nil, signedIn.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected unlinking twice to 404, status=%d", rr.Code)
+	}
+	loginUser(t, r, "linked@example.com")
+}
+
+func TestRefreshReuseRevokesSessionAndSessionsCanBeManaged(t *testing.T) {
+	r := mustRouter(t)
+	laptop := registerUser(t, r, "buyer@example.com")
+
+	login := func(userAgent string) authPayload {
+		t.Helper()
+		rr := requestJSONWithHeaders(t, r, http.MethodPost, "/api/v1/auth/login", map[string]string{
+			"email":    "buyer@example.com",
+			"password": "strong-password",
+		}, "", map[string]string{"User-Agent": userAgent})
+		var payload authPayload
+		if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &payload) != nil {
+			t.Fatalf("login status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		return payload
+	}
+	phone := login("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Mobile/15E148 Safari/604.1")
+	tablet := login("Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 Chrome/120.0 Safari/537.36")
+
+	rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/sessions", nil, phone.AccessToken)
+	var listed struct {
+		Items []struct {
+			ID         string    `json:"id"`
+			Device     string    `json:"device"`
+			IP         string    `json:"ip"`
+			Current    bool      `json:"current"`
+			LastUsedAt time.Time `json:"last_used_at"`
+		} `json:"items"`
+	}
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &listed) != nil || len(listed.Items) != 3 {
+		t.Fatalf("sessions status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var phoneSessionID, tabletSessionID string
+	for _, item := range listed.Items {
+		switch item.Device {
+		case "Safari on iOS":
+			if !item.Current || item.IP == "" || item.LastUsedAt.IsZero() {
+				t.Fatalf("unexpected current session %+v", item)
+			}
+			phoneSessionID = item.ID
+		case "Chrome on Android":
+			tabletSessionID = item.ID
+		}
+	}
+	if phoneSessionID == "" || tabletSessionID == "" {
+		t.Fatalf("expected device labels, got %s", rr.Body.String())
+	}
+
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": phone.RefreshToken}, "")
+	var rotated authPayload
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &rotated) != nil {
+		t.Fatalf("refresh status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, rotated.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected rotated tokens to work, status=%d", rr.Code)
+	}
+
+	rr = requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": phone.RefreshToken}, "")
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "reuse") {
+		t.Fatalf("expected reuse detection, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": rotated.RefreshToken}, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the whole session family to be revoked, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, rotated.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected access tokens of a revoked session to fail, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, tablet.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected other sessions to survive reuse, status=%d", rr.Code)
+	}
+
+	other := registerUser(t, r, "other@example.com")
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/auth/sessions/"+tabletSessionID, nil, other.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected another user's session to be hidden, status=%d", rr.Code)
+	}
+	if rr := requestJSON(t, r, http.MethodDelete, "/api/v1/auth/sessions/"+tabletSessionID, nil, laptop.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("session revoke status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, tablet.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked device to be signed out, status=%d", rr.Code)
+	}
+
+	desktop := login("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	rr = requestJSON(t, r, http.MethodDelete, "/api/v1/auth/sessions?keep_current=true", nil, laptop.AccessToken)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"revoked":1`) {
+		t.Fatalf("sign out others status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, desktop.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected other devices to be signed out, status=%d", rr.Code)
+	}
+	rr = requestJSON(t, r, http.MethodDelete, "/api/v1/auth/sessions", nil, laptop.AccessToken)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"revoked":1`) {
+		t.Fatalf("sign out everywhere status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, laptop.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the current session to be signed out too, status=%d", rr.Code)
+	}
+
+	entries := requestJSON(t, r, http.MethodGet, "/api/v1/admin/audit-logs?action=auth_refresh_token_reused", nil, registerUser(t, r, "admin@example.com").AccessToken)
+	if entries.Code != http.StatusOK || !strings.Contains(entries.Body.String(), phoneSessionID) {
+		t.Fatalf("expected a reuse audit entry, status=%d body=%s", entries.Code, entries.Body.String())
+	}
+}
+
+func TestJWKSPublishesSigningKeysAndTokensCarryKeyID(t *testing.T) {
+	if rr := requestJSON(t, mustRouter(t), http.MethodGet, "/.well-known/jwks.json", nil, ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"keys":[]`) {
+		t.Fatalf("expected no keys while signing with HMAC, status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	cfg := testConfig()
+	cfg.JWTSigningKeys = "api-2026=base64:" + base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	cfg.JWTKeyGracePeriod = testSeconds(3600)
+	r := mustRouterWithConfig(t, cfg)
+
+	rr := requestJSON(t, r, http.MethodGet, "/.well-known/jwks.json", nil, "")
+	var document auth.JWKS
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &document) != nil {
+		t.Fatalf("jwks status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if len(document.Keys) != 1 || document.Keys[0].KeyID != "api-2026" || document.Keys[0].Algorithm != "EdDSA" ||
+		document.Keys[0].X != base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)) {
+		t.Fatalf("unexpected jwks: %+v", document)
+	}
+
+	session := registerUser(t, r, "buyer@example.com")
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(session.AccessToken, ".")[0])
+	if err != nil || !strings.Contains(string(header), `"kid":"api-2026"`) || !strings.Contains(string(header), `"alg":"EdDSA"`) {
+		t.Fatalf("unexpected token header %s err=%v", header, err)
+	}
+	if rr := requestJSON(t, r, http.MethodGet, "/api/v1/auth/me", nil, session.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("auth me status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	cfg.JWTActiveKeyID = "missing"
+	if _, err := New(t.Context(), cfg); err == nil {
+		t.Fatal("expected an unknown active key to fail startup")
+	}
+}
+
+func signedStripeDisputeWebhook(t *testing.T, secret, eventID, eventType, disputeID, paymentIntentID string, amountCents int64, status string) ([]byte, string) {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":   eventID,
+		"type": eventType,
+		"data": map[string]interface{}{
+			"object": map[string]interface{}{
+				"id":             disputeID,
+				"amount":         amountCents,
+				"currency":       "usd",
+				"reason":         "product_not_received",
+				"status":         status,
+				"payment_intent": paymentIntentID,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    secret,
+		Timestamp: time.Now().UTC(),
+		Scheme:    "v1",
+	})
+	return signed.Payload, signed.Header
+}
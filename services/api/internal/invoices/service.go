@@ -1,20 +1,46 @@
 package invoices
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/go-pdf/fpdf"
+	"github.com/yxshee/marketplace-platform/services/api/internal/blobstore"
 	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+// Document kinds. Vendors invoice buyers per shipment, the platform invoices
+// vendors for its commission, and approved refunds are credited against the
+// original vendor invoice.
+const (
+	KindInvoice           = "invoice"
+	KindCommissionInvoice = "commission_invoice"
+	KindCreditNote        = "credit_note"
+
+	// PlatformIssuerID identifies the marketplace operator as an issuer.
+	PlatformIssuerID = "platform"
+)
+
+const (
+	seriesInvoice    = "INV"
+	seriesCommission = "COM"
+	seriesCreditNote = "CN"
 )
 
 var (
-	ErrInvalidOrder        = errors.New("order is invalid")
-	ErrOrderNotInvoiceable = errors.New("order is not invoiceable")
+	ErrInvalidOrder         = errors.New("order is invalid")
+	ErrOrderNotInvoiceable  = errors.New("order is not invoiceable")
+	ErrInvoiceNotFound      = errors.New("invoice not found")
+	ErrInvalidCreditNote    = errors.New("credit note is invalid")
+	ErrCreditExceedsInvoice = errors.New("credit note exceeds the uncredited invoice total")
 )
 
 type Config struct {
@@ -22,24 +48,115 @@ type Config struct {
 	PlatformLegalEntity  string
 	PlatformSupportEmail string
 	PlatformAddress      string
+	PlatformTaxID        string
+	PlatformCountryCode  string
+	// PlatformCode prefixes the platform's document numbers.
+	PlatformCode string
+	// Vendor resolves the seller details printed on a vendor's documents.
+	Vendor func(vendorID string) (VendorDetails, bool)
+	// Store keeps each issued PDF and its record; an in-memory store is used
+	// when it is nil.
+	Store blobstore.Store
+	// Retention is how long an issued PDF is kept before PurgeExpired
+	// deletes it. It defaults to ten years.
+	Retention time.Duration
+	// Locale is the template of the platform's documents and of vendors that
+	// did not choose one. It defaults to en.
+	Locale   string
+	Branding Branding
+}
+
+// Party is an issuer or recipient as printed on a document.
+type Party struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	LegalName string `json:"legal_name,omitempty"`
+	TaxID     string `json:"tax_id,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Email     string `json:"email,omitempty"`
+	// CountryCode is the ISO 3166-1 alpha-2 country of the party's address.
+	CountryCode string `json:"country_code,omitempty"`
+}
+
+// VendorDetails describe a vendor as an invoice issuer. Code prefixes the
+// vendor's document numbers; CommissionBPS is the commission the platform
+// invoices the vendor for. Locale and Footer pick the template and the custom
+// footer text of the vendor's own documents.
+type VendorDetails struct {
+	Party
+	Code          string
+	CommissionBPS int32
+	Locale        string
+	Footer        string
 }
 
+type Line struct {
+	Description    string `json:"description"`
+	Qty            int32  `json:"qty"`
+	UnitPriceCents int64  `json:"unit_price_cents"`
+	TotalCents     int64  `json:"total_cents"`
+}
+
+// Invoice is an issued invoice, commission invoice or credit note. Issuer and
+// Recipient are snapshots taken when the document was issued. The PDF itself
+// lives in the store under StorageKey and is checked against ContentSHA256
+// whenever it is read back.
 type Invoice struct {
-	OrderID       string    `json:"order_id"`
-	InvoiceNumber string    `json:"invoice_number"`
-	FileName      string    `json:"file_name"`
-	IssuedAt      time.Time `json:"issued_at"`
-	Currency      string    `json:"currency"`
-	TotalCents    int64     `json:"total_cents"`
-	Content       []byte    `json:"-"`
+	ID                    string    `json:"id"`
+	Kind                  string    `json:"kind"`
+	OrderID               string    `json:"order_id"`
+	ShipmentID            string    `json:"shipment_id"`
+	VendorID              string    `json:"vendor_id"`
+	IssuerID              string    `json:"issuer_id"`
+	InvoiceNumber         string    `json:"invoice_number"`
+	FileName              string    `json:"file_name"`
+	IssuedAt              time.Time `json:"issued_at"`
+	Issuer                Party     `json:"issuer"`
+	Recipient             Party     `json:"recipient"`
+	Lines                 []Line    `json:"lines"`
+	Currency              string    `json:"currency"`
+	SubtotalCents         int64     `json:"subtotal_cents"`
+	ShippingCents         int64     `json:"shipping_cents"`
+	TaxCents              int64     `json:"tax_cents"`
+	TotalCents            int64     `json:"total_cents"`
+	OriginalInvoiceID     string    `json:"original_invoice_id,omitempty"`
+	OriginalInvoiceNumber string    `json:"original_invoice_number,omitempty"`
+	RefundRequestID       string    `json:"refund_request_id,omitempty"`
+	Reason                string    `json:"reason,omitempty"`
+	Locale                string    `json:"locale"`
+	Footer                string    `json:"footer,omitempty"`
+	StorageKey            string    `json:"storage_key"`
+	ContentSHA256         string    `json:"content_sha256"`
+	ContentSize           int64     `json:"content_size"`
+	RetainUntil           time.Time `json:"retain_until"`
+	// PurgedAt is set once the PDF was deleted after its retention period.
+	// The record and its number are kept.
+	PurgedAt *time.Time `json:"purged_at,omitempty"`
+}
+
+// CreditNoteInput credits part of a shipment's invoice for an approved refund.
+type CreditNoteInput struct {
+	OrderID         string
+	ShipmentID      string
+	RefundRequestID string
+	AmountCents     int64
+	Reason          string
 }
 
 type Service struct {
-	mu        sync.Mutex
-	cfg       Config
-	now       func() time.Time
-	sequence  int64
-	byOrderID map[string]Invoice
+	mu  sync.Mutex
+	cfg Config
+	now func() time.Time
+	// sequences holds the last number issued per issuer and series. A number
+	// is only consumed once its document is stored, so each series stays
+	// gap-free.
+	sequences            map[string]int64
+	byID                 map[string]Invoice
+	idsByOrder           map[string][]string
+	invoiceByShipment    map[string]string
+	commissionByShipment map[string]string
+	creditByRefund       map[string]string
+	creditedCents        map[string]int64
 }
 
 func NewService(cfg Config) *Service {
@@ -55,121 +172,367 @@ func NewService(cfg Config) *Service {
 	if strings.TrimSpace(cfg.PlatformAddress) == "" {
 		cfg.PlatformAddress = "Global operations"
 	}
+	if strings.TrimSpace(cfg.PlatformCode) == "" {
+		cfg.PlatformCode = "MKT"
+	}
+	cfg.PlatformCode = strings.ToUpper(strings.TrimSpace(cfg.PlatformCode))
+	if cfg.Store == nil {
+		cfg.Store = blobstore.NewMemoryStore()
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultRetention
+	}
+	if locale, err := NormalizeLocale(cfg.Locale); err != nil || locale == "" {
+		cfg.Locale = LocaleEN
+	} else {
+		cfg.Locale = locale
+	}
+	if _, _, _, ok := parseColor(cfg.Branding.PrimaryColor); !ok {
+		cfg.Branding.PrimaryColor = defaultPrimaryColor
+	}
+	if _, _, _, ok := parseColor(cfg.Branding.AccentColor); !ok {
+		cfg.Branding.AccentColor = defaultAccentColor
+	}
 
 	return &Service{
-		cfg:       cfg,
-		now:       func() time.Time { return time.Now().UTC() },
-		sequence:  0,
-		byOrderID: make(map[string]Invoice),
+		cfg:                  cfg,
+		now:                  func() time.Time { return time.Now().UTC() },
+		sequences:            make(map[string]int64),
+		byID:                 make(map[string]Invoice),
+		idsByOrder:           make(map[string][]string),
+		invoiceByShipment:    make(map[string]string),
+		commissionByShipment: make(map[string]string),
+		creditByRefund:       make(map[string]string),
+		creditedCents:        make(map[string]int64),
 	}
 }
 
-func (s *Service) GenerateForOrder(order commerce.Order) (Invoice, error) {
+// GenerateForOrder issues an invoice from each vendor to the buyer for its
+// shipment, and a commission invoice from the platform to each vendor with a
+// commission. Cancelled shipments are not invoiced. Documents already issued
+// are returned as they are, so the call is safe to repeat.
+func (s *Service) GenerateForOrder(ctx context.Context, order commerce.Order, buyer Party) ([]Invoice, error) {
 	orderID := strings.TrimSpace(order.ID)
 	if orderID == "" || order.TotalCents <= 0 || strings.TrimSpace(order.Currency) == "" || len(order.Shipments) == 0 {
-		return Invoice{}, ErrInvalidOrder
+		return nil, ErrInvalidOrder
 	}
 
 	switch order.Status {
 	case commerce.OrderStatusPaid, commerce.OrderStatusCODConfirmed:
 	default:
-		return Invoice{}, ErrOrderNotInvoiceable
+		return nil, ErrOrderNotInvoiceable
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if existing, ok := s.byOrderID[orderID]; ok {
-		return existing, nil
+	platform := s.platformParty()
+	platformTemplate := templateFor(s.cfg.Locale)
+	for _, shipment := range order.Shipments {
+		if shipment.Status == commerce.ShipmentStatusCancelled || shipment.TotalCents <= 0 {
+			continue
+		}
+		vendor := s.vendorDetails(shipment.VendorID)
+
+		key := shipmentKey(orderID, shipment.ID)
+		if _, issued := s.invoiceByShipment[key]; !issued {
+			invoice := Invoice{
+				Kind:          KindInvoice,
+				OrderID:       orderID,
+				ShipmentID:    shipment.ID,
+				VendorID:      shipment.VendorID,
+				IssuerID:      shipment.VendorID,
+				Issuer:        vendor.Party,
+				Recipient:     buyer,
+				Currency:      order.Currency,
+				SubtotalCents: shipment.SubtotalCents,
+				ShippingCents: shipment.ShippingFeeCents,
+				TaxCents:      shipmentTaxCents(order, shipment),
+				TotalCents:    shipment.TotalCents,
+				Locale:        vendor.Locale,
+				Footer:        vendor.Footer,
+			}
+			for _, item := range order.Items {
+				if item.ShipmentID != shipment.ID {
+					continue
+				}
+				invoice.Lines = append(invoice.Lines, Line{
+					Description:    item.Title,
+					Qty:            item.Qty,
+					UnitPriceCents: item.UnitPriceCents,
+					TotalCents:     item.LineTotalCents,
+				})
+			}
+			if shipment.ShippingFeeCents > 0 {
+				invoice.Lines = append(invoice.Lines, Line{
+					Description:    templateFor(vendor.Locale).shipping,
+					Qty:            1,
+					UnitPriceCents: shipment.ShippingFeeCents,
+					TotalCents:     shipment.ShippingFeeCents,
+				})
+			}
+			if _, err := s.issueLocked(ctx, invoice, vendor.Code, seriesInvoice); err != nil {
+				return nil, err
+			}
+		}
+
+		commissionCents := shipment.TotalCents * int64(vendor.CommissionBPS) / 10000
+		if _, issued := s.commissionByShipment[key]; issued || commissionCents <= 0 {
+			continue
+		}
+		_, err := s.issueLocked(ctx, Invoice{
+			Kind:       KindCommissionInvoice,
+			OrderID:    orderID,
+			ShipmentID: shipment.ID,
+			VendorID:   shipment.VendorID,
+			IssuerID:   PlatformIssuerID,
+			Issuer:     platform,
+			Recipient:  vendor.Party,
+			Lines: []Line{{
+				Description:    fmt.Sprintf(platformTemplate.commissionLine, formatBPS(vendor.CommissionBPS), shipment.ID),
+				Qty:            1,
+				UnitPriceCents: commissionCents,
+				TotalCents:     commissionCents,
+			}},
+			Currency:      order.Currency,
+			SubtotalCents: commissionCents,
+			TotalCents:    commissionCents,
+			Locale:        s.cfg.Locale,
+		}, s.cfg.PlatformCode, seriesCommission)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	s.sequence++
-	issuedAt := s.now()
-	invoiceNumber := fmt.Sprintf("INV-%s-%06d", issuedAt.Format("20060102"), s.sequence)
+	return s.listForOrderLocked(orderID), nil
+}
 
-	content, err := renderInvoicePDF(order, invoiceNumber, issuedAt, s.cfg)
-	if err != nil {
-		return Invoice{}, err
+// IssueCreditNote credits a shipment's invoice for an approved refund. The
+// credit note is issued by the same vendor in its own gap-free series and is
+// only issued once per refund request.
+func (s *Service) IssueCreditNote(ctx context.Context, input CreditNoteInput) (Invoice, error) {
+	input.RefundRequestID = strings.TrimSpace(input.RefundRequestID)
+	if input.RefundRequestID == "" || input.AmountCents <= 0 {
+		return Invoice{}, ErrInvalidCreditNote
 	}
 
-	invoice := Invoice{
-		OrderID:       orderID,
-		InvoiceNumber: invoiceNumber,
-		FileName:      fmt.Sprintf("invoice-%s.pdf", strings.ToLower(invoiceNumber)),
-		IssuedAt:      issuedAt,
-		Currency:      order.Currency,
-		TotalCents:    order.TotalCents,
-		Content:       content,
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existingID, exists := s.creditByRefund[input.RefundRequestID]; exists {
+		return s.byID[existingID], nil
 	}
-	s.byOrderID[orderID] = invoice
 
-	return invoice, nil
+	invoiceID, exists := s.invoiceByShipment[shipmentKey(strings.TrimSpace(input.OrderID), strings.TrimSpace(input.ShipmentID))]
+	if !exists {
+		return Invoice{}, ErrInvoiceNotFound
+	}
+	original := s.byID[invoiceID]
+	if s.creditedCents[original.ID]+input.AmountCents > original.TotalCents {
+		return Invoice{}, ErrCreditExceedsInvoice
+	}
+
+	reason := strings.TrimSpace(input.Reason)
+	description := fmt.Sprintf(templateFor(original.Locale).refundLine, original.InvoiceNumber)
+	if reason != "" {
+		description += ": " + reason
+	}
+	return s.issueLocked(ctx, Invoice{
+		Kind:                  KindCreditNote,
+		OrderID:               original.OrderID,
+		ShipmentID:            original.ShipmentID,
+		VendorID:              original.VendorID,
+		IssuerID:              original.IssuerID,
+		Issuer:                original.Issuer,
+		Recipient:             original.Recipient,
+		Lines:                 []Line{{Description: description, Qty: 1, UnitPriceCents: input.AmountCents, TotalCents: input.AmountCents}},
+		Currency:              original.Currency,
+		SubtotalCents:         input.AmountCents,
+		TaxCents:              proportionalCents(original.TaxCents, input.AmountCents, original.TotalCents),
+		TotalCents:            input.AmountCents,
+		OriginalInvoiceID:     original.ID,
+		OriginalInvoiceNumber: original.InvoiceNumber,
+		RefundRequestID:       input.RefundRequestID,
+		Reason:                reason,
+		Locale:                original.Locale,
+		Footer:                original.Footer,
+	}, s.issuerCodeLocked(original), seriesCreditNote)
 }
 
-func renderInvoicePDF(order commerce.Order, invoiceNumber string, issuedAt time.Time, cfg Config) ([]byte, error) {
-	pdf := fpdf.New("P", "mm", "A4", "")
-	pdf.SetTitle(invoiceNumber, false)
-	pdf.SetAuthor(cfg.PlatformName, false)
-	pdf.AddPage()
+func (s *Service) Get(invoiceID string) (Invoice, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, exists := s.byID[strings.TrimSpace(invoiceID)]
+	return invoice, exists
+}
+
+// ListForOrder returns every document issued for an order, oldest first.
+func (s *Service) ListForOrder(orderID string) []Invoice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	pdf.SetFont("Helvetica", "B", 16)
-	pdf.CellFormat(0, 10, "Invoice", "", 1, "L", false, 0, "")
+	return s.listForOrderLocked(strings.TrimSpace(orderID))
+}
 
-	pdf.SetFont("Helvetica", "", 10)
-	pdf.CellFormat(0, 6, cfg.PlatformName, "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, cfg.PlatformLegalEntity, "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, cfg.PlatformSupportEmail, "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, cfg.PlatformAddress, "", 1, "L", false, 0, "")
-	pdf.Ln(2)
+// List returns issued documents, optionally narrowed to a kind and to the
+// documents a vendor issued or received, oldest first.
+func (s *Service) List(kind, vendorID string) []Invoice {
+	kind = strings.TrimSpace(kind)
+	vendorID = strings.TrimSpace(vendorID)
 
-	pdf.SetFont("Helvetica", "", 11)
-	pdf.CellFormat(0, 6, fmt.Sprintf("Invoice number: %s", invoiceNumber), "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, fmt.Sprintf("Issued at (UTC): %s", issuedAt.Format(time.RFC3339)), "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, fmt.Sprintf("Order ID: %s", order.ID), "", 1, "L", false, 0, "")
-	pdf.Ln(3)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	for _, shipment := range order.Shipments {
-		pdf.SetFont("Helvetica", "B", 12)
-		pdf.CellFormat(0, 7, fmt.Sprintf("Shipment %s", shipment.ID), "", 1, "L", false, 0, "")
-		pdf.SetFont("Helvetica", "", 10)
-		pdf.CellFormat(0, 6, fmt.Sprintf("Vendor: %s", shipment.VendorID), "", 1, "L", false, 0, "")
-		pdf.CellFormat(0, 6, fmt.Sprintf("Shipment status: %s", shipment.Status), "", 1, "L", false, 0, "")
-
-		for _, item := range order.Items {
-			if item.ShipmentID != shipment.ID {
-				continue
-			}
-			pdf.CellFormat(0, 6, fmt.Sprintf("- %s x%d  (%s)", item.Title, item.Qty, formatCents(item.LineTotalCents)), "", 1, "L", false, 0, "")
+	items := make([]Invoice, 0, len(s.byID))
+	for _, invoice := range s.byID {
+		if kind != "" && invoice.Kind != kind {
+			continue
 		}
+		if vendorID != "" && invoice.VendorID != vendorID {
+			continue
+		}
+		items = append(items, invoice)
+	}
+	sortInvoices(items)
+	return items
+}
 
-		pdf.CellFormat(0, 6, fmt.Sprintf("Shipment subtotal: %s", formatCents(shipment.SubtotalCents)), "", 1, "L", false, 0, "")
-		pdf.CellFormat(0, 6, fmt.Sprintf("Shipping: %s", formatCents(shipment.ShippingFeeCents)), "", 1, "L", false, 0, "")
-		pdf.CellFormat(0, 6, fmt.Sprintf("Shipment total: %s", formatCents(shipment.TotalCents)), "", 1, "L", false, 0, "")
-		pdf.Ln(2)
+func (s *Service) listForOrderLocked(orderID string) []Invoice {
+	ids := s.idsByOrder[orderID]
+	items := make([]Invoice, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, s.byID[id])
 	}
+	sortInvoices(items)
+	return items
+}
+
+// issueLocked numbers, renders and stores a document. The issuer's sequence
+// only advances once the PDF and its record are in the store; a failed write
+// leaves the number free for the next document.
+func (s *Service) issueLocked(ctx context.Context, invoice Invoice, issuerCode, series string) (Invoice, error) {
+	sequenceKey := invoice.IssuerID + "/" + series
+	next := s.sequences[sequenceKey] + 1
+
+	invoice.ID = identifier.New("inv")
+	invoice.IssuedAt = s.now()
+	invoice.InvoiceNumber = fmt.Sprintf("%s-%s-%06d", series, issuerCode, next)
+	invoice.FileName = fmt.Sprintf("%s-%s.pdf", strings.ReplaceAll(invoice.Kind, "_", "-"), strings.ToLower(invoice.InvoiceNumber))
 
-	pdf.SetFont("Helvetica", "B", 12)
-	pdf.CellFormat(0, 7, "Order totals", "", 1, "L", false, 0, "")
-	pdf.SetFont("Helvetica", "", 10)
-	pdf.CellFormat(0, 6, fmt.Sprintf("Subtotal: %s", formatCents(order.SubtotalCents)), "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, fmt.Sprintf("Shipping: %s", formatCents(order.ShippingCents)), "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, fmt.Sprintf("Discount: %s", formatCents(order.DiscountCents)), "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, fmt.Sprintf("Tax included: %s", formatCents(order.TaxCents)), "", 1, "L", false, 0, "")
-	pdf.CellFormat(0, 6, fmt.Sprintf("Grand total: %s", formatCents(order.TotalCents)), "", 1, "L", false, 0, "")
+	content, err := renderInvoicePDF(invoice, s.cfg)
+	if err != nil {
+		return Invoice{}, err
+	}
+	sum := sha256.Sum256(content)
+	invoice.StorageKey = path.Join(documentPrefix, invoice.IssuerID, invoice.IssuedAt.Format("2006"), invoice.FileName)
+	invoice.ContentSHA256 = hex.EncodeToString(sum[:])
+	invoice.ContentSize = int64(len(content))
+	invoice.RetainUntil = invoice.IssuedAt.Add(s.cfg.Retention)
 
-	var out bytes.Buffer
-	if err := pdf.Output(&out); err != nil {
-		return nil, err
+	if err := s.cfg.Store.Put(ctx, invoice.StorageKey, content); err != nil {
+		return Invoice{}, err
+	}
+	if err := s.putRecord(ctx, invoiceRecord{Invoice: invoice, Series: series, Sequence: next}); err != nil {
+		return Invoice{}, err
 	}
-	return out.Bytes(), nil
+
+	s.indexLocked(invoice, series, next)
+	return invoice, nil
 }
 
-func formatCents(cents int64) string {
-	sign := ""
-	value := cents
-	if cents < 0 {
-		sign = "-"
-		value = -cents
+// indexLocked registers a stored document and advances its issuer's
+// sequence. It is shared by issuing and Restore.
+func (s *Service) indexLocked(invoice Invoice, series string, sequence int64) {
+	if sequenceKey := invoice.IssuerID + "/" + series; sequence > s.sequences[sequenceKey] {
+		s.sequences[sequenceKey] = sequence
+	}
+	s.byID[invoice.ID] = invoice
+	s.idsByOrder[invoice.OrderID] = append(s.idsByOrder[invoice.OrderID], invoice.ID)
+
+	key := shipmentKey(invoice.OrderID, invoice.ShipmentID)
+	switch invoice.Kind {
+	case KindInvoice:
+		s.invoiceByShipment[key] = invoice.ID
+	case KindCommissionInvoice:
+		s.commissionByShipment[key] = invoice.ID
+	case KindCreditNote:
+		s.creditByRefund[invoice.RefundRequestID] = invoice.ID
+		s.creditedCents[invoice.OriginalInvoiceID] += invoice.TotalCents
 	}
-	return fmt.Sprintf("%s$%d.%02d", sign, value/100, value%100)
+}
+
+func (s *Service) issuerCodeLocked(invoice Invoice) string {
+	if invoice.IssuerID == PlatformIssuerID {
+		return s.cfg.PlatformCode
+	}
+	return s.vendorDetails(invoice.IssuerID).Code
+}
+
+func (s *Service) platformParty() Party {
+	return Party{
+		ID:          PlatformIssuerID,
+		Name:        s.cfg.PlatformName,
+		LegalName:   s.cfg.PlatformLegalEntity,
+		TaxID:       s.cfg.PlatformTaxID,
+		Address:     s.cfg.PlatformAddress,
+		Email:       s.cfg.PlatformSupportEmail,
+		CountryCode: s.cfg.PlatformCountryCode,
+	}
+}
+
+// vendorDetails falls back to the vendor id when the vendor is unknown, so a
+// missing profile never blocks invoicing.
+func (s *Service) vendorDetails(vendorID string) VendorDetails {
+	var details VendorDetails
+	if s.cfg.Vendor != nil {
+		details, _ = s.cfg.Vendor(vendorID)
+	}
+	details.ID = vendorID
+	if strings.TrimSpace(details.Name) == "" {
+		details.Name = vendorID
+	}
+	if strings.TrimSpace(details.LegalName) == "" {
+		details.LegalName = details.Name
+	}
+	if strings.TrimSpace(details.Code) == "" {
+		details.Code = vendorID
+	}
+	details.Code = strings.ToUpper(details.Code)
+	if locale, err := NormalizeLocale(details.Locale); err != nil || locale == "" {
+		details.Locale = s.cfg.Locale
+	} else {
+		details.Locale = locale
+	}
+	return details
+}
+
+func shipmentKey(orderID, shipmentID string) string {
+	return orderID + "/" + shipmentID
+}
+
+// shipmentTaxCents is the shipment's share of the tax included in the order
+// total.
+func shipmentTaxCents(order commerce.Order, shipment commerce.OrderShipment) int64 {
+	return proportionalCents(order.TaxCents, shipment.TotalCents, order.TotalCents)
+}
+
+func proportionalCents(amount, part, whole int64) int64 {
+	if amount <= 0 || whole <= 0 {
+		return 0
+	}
+	return amount * part / whole
+}
+
+func sortInvoices(items []Invoice) {
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].IssuedAt.Equal(items[j].IssuedAt) {
+			return items[i].IssuedAt.Before(items[j].IssuedAt)
+		}
+		return items[i].InvoiceNumber < items[j].InvoiceNumber
+	})
+}
+
+func formatBPS(bps int32) string {
+	return fmt.Sprintf("%d.%02d%%", bps/100, bps%100)
 }
@@ -2,6 +2,8 @@ package invoices
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -16,45 +18,134 @@ func TestGenerateForOrderIsStablePerOrder(t *testing.T) {
 
 	order := testOrder("ord_invoice_1", commerce.OrderStatusCODConfirmed)
 
-	first, err := svc.GenerateForOrder(order)
+	first, err := svc.GenerateForOrder(context.Background(), order, Party{ID: "usr_buyer", Name: "buyer@example.com"})
 	if err != nil {
 		t.Fatalf("GenerateForOrder() first error = %v", err)
 	}
-	second, err := svc.GenerateForOrder(order)
+	second, err := svc.GenerateForOrder(context.Background(), order, Party{ID: "usr_buyer", Name: "buyer@example.com"})
 	if err != nil {
 		t.Fatalf("GenerateForOrder() second error = %v", err)
 	}
 
-	if first.InvoiceNumber != second.InvoiceNumber {
-		t.Fatalf("expected stable invoice number %s, got %s", first.InvoiceNumber, second.InvoiceNumber)
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("expected one invoice per order with one shipment, got %d then %d", len(first), len(second))
 	}
-	if first.FileName != second.FileName {
-		t.Fatalf("expected stable file name %s, got %s", first.FileName, second.FileName)
+	if first[0].InvoiceNumber != second[0].InvoiceNumber {
+		t.Fatalf("expected stable invoice number %s, got %s", first[0].InvoiceNumber, second[0].InvoiceNumber)
 	}
-	if len(first.Content) == 0 {
-		t.Fatal("expected invoice pdf bytes")
+	if first[0].FileName != second[0].FileName {
+		t.Fatalf("expected stable file name %s, got %s", first[0].FileName, second[0].FileName)
 	}
-	if !bytes.HasPrefix(first.Content, []byte("%PDF")) {
-		t.Fatalf("expected PDF header, got %q", first.Content)
+	content, err := svc.Content(context.Background(), first[0])
+	if err != nil {
+		t.Fatalf("Content() error = %v", err)
+	}
+	if !bytes.HasPrefix(content, []byte("%PDF")) {
+		t.Fatalf("expected PDF header, got %q", content)
 	}
 
-	other, err := svc.GenerateForOrder(testOrder("ord_invoice_2", commerce.OrderStatusPaid))
+	other, err := svc.GenerateForOrder(context.Background(), testOrder("ord_invoice_2", commerce.OrderStatusPaid), Party{ID: "usr_buyer"})
 	if err != nil {
 		t.Fatalf("GenerateForOrder() second order error = %v", err)
 	}
-	if other.InvoiceNumber == first.InvoiceNumber {
-		t.Fatalf("expected unique invoice number, got %s", other.InvoiceNumber)
+	if other[0].InvoiceNumber == first[0].InvoiceNumber {
+		t.Fatalf("expected unique invoice number, got %s", other[0].InvoiceNumber)
 	}
 }
 
 func TestGenerateForOrderRejectsPendingPayment(t *testing.T) {
 	svc := NewService(Config{})
-	_, err := svc.GenerateForOrder(testOrder("ord_invoice_pending", commerce.OrderStatusPendingPayment))
+	_, err := svc.GenerateForOrder(context.Background(), testOrder("ord_invoice_pending", commerce.OrderStatusPendingPayment), Party{})
 	if err != ErrOrderNotInvoiceable {
 		t.Fatalf("expected ErrOrderNotInvoiceable, got %v", err)
 	}
 }
 
+func TestVendorInvoicesCommissionAndCreditNotesNumberPerIssuer(t *testing.T) {
+	svc := NewService(Config{
+		PlatformCode: "mkt",
+		Vendor: func(vendorID string) (VendorDetails, bool) {
+			switch vendorID {
+			case "ven_1":
+				return VendorDetails{
+					Party:         Party{Name: "Paper Co", LegalName: "Paper Co GmbH", TaxID: "DE123456789", Address: "1 Mill Road"},
+					Code:          "paper",
+					CommissionBPS: 1000,
+				}, true
+			case "ven_2":
+				return VendorDetails{Party: Party{Name: "Cups Ltd"}, Code: "cups"}, true
+			}
+			return VendorDetails{}, false
+		},
+	})
+
+	order := testOrder("ord_split", commerce.OrderStatusPaid)
+	order.Shipments = append(order.Shipments,
+		commerce.OrderShipment{ID: "shp_2", VendorID: "ven_2", Status: "pending", SubtotalCents: 1500, ShippingFeeCents: 500, TotalCents: 2000},
+		commerce.OrderShipment{ID: "shp_3", VendorID: "ven_1", Status: commerce.ShipmentStatusCancelled, SubtotalCents: 900, TotalCents: 900},
+	)
+	order.Items = append(order.Items, commerce.OrderItem{ID: "itm_3", ShipmentID: "shp_2", VendorID: "ven_2", Title: "Mug", Qty: 1, UnitPriceCents: 1500, LineTotalCents: 1500})
+	order.TotalCents = 7900
+
+	issued, err := svc.GenerateForOrder(context.Background(), order, Party{ID: "usr_buyer", Name: "buyer@example.com"})
+	if err != nil {
+		t.Fatalf("GenerateForOrder() error = %v", err)
+	}
+	numbers := make(map[string]Invoice)
+	for _, invoice := range issued {
+		numbers[invoice.InvoiceNumber] = invoice
+	}
+	if len(issued) != 3 {
+		t.Fatalf("expected two vendor invoices and one commission invoice, got %+v", numbers)
+	}
+	paper, cups, commission := numbers["INV-PAPER-000001"], numbers["INV-CUPS-000001"], numbers["COM-MKT-000001"]
+	if paper.Issuer.TaxID != "DE123456789" || paper.ShipmentID != "shp_1" || paper.TotalCents != 5900 || len(paper.Lines) != 3 {
+		t.Fatalf("expected the paper invoice issued by the vendor for its shipment, got %+v", paper)
+	}
+	if cups.Kind != KindInvoice || cups.TotalCents != 2000 || cups.Recipient.Name != "buyer@example.com" {
+		t.Fatalf("expected the cups invoice addressed to the buyer, got %+v", cups)
+	}
+	if commission.Kind != KindCommissionInvoice || commission.Recipient.LegalName != "Paper Co GmbH" || commission.TotalCents != 590 {
+		t.Fatalf("expected a 10%% commission invoice to the paper vendor, got %+v", commission)
+	}
+
+	if _, err := svc.IssueCreditNote(context.Background(), CreditNoteInput{
+		OrderID: "ord_split", ShipmentID: "shp_1", RefundRequestID: "rfd_too_big", AmountCents: 6000,
+	}); !errors.Is(err, ErrCreditExceedsInvoice) {
+		t.Fatalf("expected ErrCreditExceedsInvoice, got %v", err)
+	}
+	if _, err := svc.IssueCreditNote(context.Background(), CreditNoteInput{
+		OrderID: "ord_split", ShipmentID: "shp_3", RefundRequestID: "rfd_cancelled", AmountCents: 100,
+	}); !errors.Is(err, ErrInvoiceNotFound) {
+		t.Fatalf("expected ErrInvoiceNotFound, got %v", err)
+	}
+	credit, err := svc.IssueCreditNote(context.Background(), CreditNoteInput{
+		OrderID: "ord_split", ShipmentID: "shp_1", RefundRequestID: "rfd_1", AmountCents: 2200, Reason: "damaged",
+	})
+	if err != nil {
+		t.Fatalf("IssueCreditNote() error = %v", err)
+	}
+	if credit.InvoiceNumber != "CN-PAPER-000001" || credit.OriginalInvoiceID != paper.ID || credit.OriginalInvoiceNumber != paper.InvoiceNumber {
+		t.Fatalf("expected a credit note referencing the paper invoice, got %+v", credit)
+	}
+	if repeat, _ := svc.IssueCreditNote(context.Background(), CreditNoteInput{
+		OrderID: "ord_split", ShipmentID: "shp_1", RefundRequestID: "rfd_1", AmountCents: 2200,
+	}); repeat.ID != credit.ID {
+		t.Fatalf("expected the refund credited once, got %s and %s", credit.ID, repeat.ID)
+	}
+
+	next, err := svc.GenerateForOrder(context.Background(), testOrder("ord_next", commerce.OrderStatusPaid), Party{ID: "usr_buyer"})
+	if err != nil {
+		t.Fatalf("GenerateForOrder() next order error = %v", err)
+	}
+	if next[0].InvoiceNumber != "INV-PAPER-000002" || next[1].InvoiceNumber != "COM-MKT-000002" {
+		t.Fatalf("expected each issuer series to continue without gaps, got %s and %s", next[0].InvoiceNumber, next[1].InvoiceNumber)
+	}
+	if vendorDocs := svc.List("", "ven_1"); len(vendorDocs) != 5 {
+		t.Fatalf("expected the paper vendor's invoices, credit note and commission invoices, got %d", len(vendorDocs))
+	}
+}
+
 func testOrder(orderID, status string) commerce.Order {
 	return commerce.Order{
 		ID:            orderID,
@@ -0,0 +1,245 @@
+package invoices
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// documentPrefix holds the issued PDFs, one per document under
+	// invoices/<issuer>/<year>/<file name>.
+	documentPrefix = "invoices"
+	// recordPrefix holds one JSON record per document. Records outlive the
+	// PDFs they describe so numbering survives purges and restarts.
+	recordPrefix = "invoice-records"
+
+	defaultRetention = 10 * 365 * 24 * time.Hour
+)
+
+var (
+	ErrDocumentPurged  = errors.New("invoice document was purged after its retention period")
+	ErrContentMismatch = errors.New("stored invoice document does not match its hash")
+	ErrInvalidArchive  = errors.New("archive range is invalid")
+)
+
+// invoiceRecord is what the store keeps next to each PDF. Series and Sequence
+// restore the issuer's numbering without parsing document numbers.
+type invoiceRecord struct {
+	Invoice  Invoice `json:"invoice"`
+	Series   string  `json:"series"`
+	Sequence int64   `json:"sequence"`
+}
+
+// ArchiveFilter selects the documents issued in [From, To), optionally
+// narrowed to a kind and to the documents a vendor issued or received.
+type ArchiveFilter struct {
+	From     time.Time
+	To       time.Time
+	Kind     string
+	VendorID string
+}
+
+// Restore loads the records of previously issued documents from the store, so
+// a restarted service serves the same documents and continues each series
+// where it stopped. It is meant to run once, before the service is used.
+func (s *Service) Restore(ctx context.Context) error {
+	keys, err := s.cfg.Store.List(ctx, recordPrefix+"/")
+	if err != nil {
+		return err
+	}
+
+	records := make([]invoiceRecord, 0, len(keys))
+	for _, key := range keys {
+		raw, err := s.cfg.Store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		var record invoiceRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return fmt.Errorf("invoice record %s: %w", key, err)
+		}
+		records = append(records, record)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		if _, exists := s.byID[record.Invoice.ID]; exists {
+			continue
+		}
+		s.indexLocked(record.Invoice, record.Series, record.Sequence)
+	}
+	return nil
+}
+
+// Content returns the stored PDF of an issued document, byte for byte as it
+// was issued. The bytes are checked against the hash recorded at issue time.
+func (s *Service) Content(ctx context.Context, invoice Invoice) ([]byte, error) {
+	if invoice.PurgedAt != nil {
+		return nil, ErrDocumentPurged
+	}
+	content, err := s.cfg.Store.Get(ctx, invoice.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != invoice.ContentSHA256 {
+		return nil, ErrContentMismatch
+	}
+	return content, nil
+}
+
+// PurgeExpired deletes the PDFs whose retention period has ended and marks
+// their records as purged. It returns how many documents were purged.
+func (s *Service) PurgeExpired(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	purged := 0
+	for _, invoice := range s.byID {
+		if invoice.PurgedAt != nil || invoice.RetainUntil.After(now) {
+			continue
+		}
+		if err := s.cfg.Store.Delete(ctx, invoice.StorageKey); err != nil {
+			return purged, err
+		}
+		invoice.PurgedAt = &now
+		if err := s.updateRecordLocked(ctx, invoice); err != nil {
+			return purged, err
+		}
+		s.byID[invoice.ID] = invoice
+		purged++
+	}
+	return purged, nil
+}
+
+// Run purges expired documents on every tick in the background until ctx is
+// cancelled. The returned channel is closed once purging has stopped.
+func (s *Service) Run(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, _ = s.PurgeExpired(ctx)
+			}
+		}
+	}()
+	return done
+}
+
+// WriteArchive writes a ZIP of the stored PDFs matching the filter, with a
+// manifest.csv listing each document's number, amounts and SHA-256. Purged
+// documents are left out. It returns how many documents were archived.
+func (s *Service) WriteArchive(ctx context.Context, w io.Writer, filter ArchiveFilter) (int, error) {
+	if filter.From.IsZero() || filter.To.IsZero() || !filter.From.Before(filter.To) {
+		return 0, ErrInvalidArchive
+	}
+
+	selected := make([]Invoice, 0)
+	for _, invoice := range s.List(filter.Kind, filter.VendorID) {
+		if invoice.PurgedAt != nil || invoice.IssuedAt.Before(filter.From) || !invoice.IssuedAt.Before(filter.To) {
+			continue
+		}
+		selected = append(selected, invoice)
+	}
+
+	var manifest bytes.Buffer
+	manifestWriter := csv.NewWriter(&manifest)
+	_ = manifestWriter.Write([]string{"invoice_number", "kind", "issued_at", "order_id", "vendor_id", "currency", "total_cents", "file_name", "sha256"})
+
+	archive := zip.NewWriter(w)
+	for _, invoice := range selected {
+		content, err := s.Content(ctx, invoice)
+		if err != nil {
+			return 0, err
+		}
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     invoice.FileName,
+			Method:   zip.Deflate,
+			Modified: invoice.IssuedAt,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if _, err := entry.Write(content); err != nil {
+			return 0, err
+		}
+		_ = manifestWriter.Write([]string{
+			invoice.InvoiceNumber,
+			invoice.Kind,
+			invoice.IssuedAt.Format(time.RFC3339),
+			invoice.OrderID,
+			invoice.VendorID,
+			invoice.Currency,
+			strconv.FormatInt(invoice.TotalCents, 10),
+			invoice.FileName,
+			invoice.ContentSHA256,
+		})
+	}
+	manifestWriter.Flush()
+	if err := manifestWriter.Error(); err != nil {
+		return 0, err
+	}
+
+	entry, err := archive.Create("manifest.csv")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := entry.Write(manifest.Bytes()); err != nil {
+		return 0, err
+	}
+	if err := archive.Close(); err != nil {
+		return 0, err
+	}
+	return len(selected), nil
+}
+
+func (s *Service) putRecord(ctx context.Context, record invoiceRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.cfg.Store.Put(ctx, recordKey(record.Invoice.ID), raw)
+}
+
+// updateRecordLocked rewrites a document's record, keeping its numbering.
+func (s *Service) updateRecordLocked(ctx context.Context, invoice Invoice) error {
+	raw, err := s.cfg.Store.Get(ctx, recordKey(invoice.ID))
+	if err != nil {
+		return err
+	}
+	var record invoiceRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return err
+	}
+	record.Invoice = invoice
+	return s.putRecord(ctx, record)
+}
+
+func recordKey(invoiceID string) string {
+	return path.Join(recordPrefix, strings.TrimSpace(invoiceID)+".json")
+}
@@ -0,0 +1,157 @@
+package invoices
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/blobstore"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestStoredInvoicesSurviveRestartAndExpireAfterRetention(t *testing.T) {
+	ctx := context.Background()
+	store, err := blobstore.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirStore() error = %v", err)
+	}
+	issuedAt := time.Date(2026, time.February, 10, 8, 0, 0, 0, time.UTC)
+	cfg := Config{PlatformName: "Marketplace", Store: store, Retention: 30 * 24 * time.Hour}
+
+	svc := NewService(cfg)
+	svc.now = func() time.Time { return issuedAt }
+	issued, err := svc.GenerateForOrder(ctx, testOrder("ord_stored", commerce.OrderStatusPaid), Party{ID: "usr_buyer"})
+	if err != nil {
+		t.Fatalf("GenerateForOrder() error = %v", err)
+	}
+	original := issued[0]
+	if original.StorageKey != "invoices/ven_1/2026/invoice-inv-ven_1-000001.pdf" || len(original.ContentSHA256) != 64 {
+		t.Fatalf("expected the PDF stored under its issuer and year with a hash, got %+v", original)
+	}
+	stored, err := svc.Content(ctx, original)
+	if err != nil {
+		t.Fatalf("Content() error = %v", err)
+	}
+
+	restarted := NewService(cfg)
+	restarted.now = func() time.Time { return issuedAt.Add(time.Hour) }
+	if err := restarted.Restore(ctx); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	again, err := restarted.GenerateForOrder(ctx, testOrder("ord_stored", commerce.OrderStatusPaid), Party{ID: "usr_buyer"})
+	if err != nil {
+		t.Fatalf("GenerateForOrder() after restart error = %v", err)
+	}
+	if len(again) != 1 || again[0].InvoiceNumber != original.InvoiceNumber || !again[0].IssuedAt.Equal(issuedAt) {
+		t.Fatalf("expected the issued invoice to be kept across restarts, got %+v", again)
+	}
+	redownloaded, err := restarted.Content(ctx, again[0])
+	if err != nil || !bytes.Equal(redownloaded, stored) {
+		t.Fatalf("expected the exact stored bytes, err=%v", err)
+	}
+	next, err := restarted.GenerateForOrder(ctx, testOrder("ord_after_restart", commerce.OrderStatusPaid), Party{ID: "usr_buyer"})
+	if err != nil || next[0].InvoiceNumber != "INV-VEN_1-000002" {
+		t.Fatalf("expected the series to continue after a restart, got %+v err=%v", next, err)
+	}
+
+	if err := store.Put(ctx, original.StorageKey, []byte("%PDF-tampered")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, err := restarted.Content(ctx, original); !errors.Is(err, ErrContentMismatch) {
+		t.Fatalf("expected ErrContentMismatch for altered bytes, got %v", err)
+	}
+
+	restarted.now = func() time.Time { return issuedAt.Add(31 * 24 * time.Hour) }
+	purged, err := restarted.PurgeExpired(ctx)
+	if err != nil || purged != 2 {
+		t.Fatalf("expected both documents purged after retention, got %d err=%v", purged, err)
+	}
+	expired, _ := restarted.Get(original.ID)
+	if _, err := restarted.Content(ctx, expired); !errors.Is(err, ErrDocumentPurged) {
+		t.Fatalf("expected ErrDocumentPurged, got %v", err)
+	}
+	if _, err := store.Get(ctx, original.StorageKey); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected the purged PDF deleted from the store, got %v", err)
+	}
+
+	afterPurge := NewService(cfg)
+	if err := afterPurge.Restore(ctx); err != nil {
+		t.Fatalf("Restore() after purge error = %v", err)
+	}
+	if kept, found := afterPurge.Get(original.ID); !found || kept.PurgedAt == nil {
+		t.Fatalf("expected the purged record kept, got %+v", kept)
+	}
+}
+
+func TestWriteArchiveZipsStoredDocumentsWithManifest(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(Config{})
+	svc.now = func() time.Time { return time.Date(2026, time.April, 3, 12, 0, 0, 0, time.UTC) }
+	first, err := svc.GenerateForOrder(ctx, testOrder("ord_april", commerce.OrderStatusPaid), Party{ID: "usr_buyer"})
+	if err != nil {
+		t.Fatalf("GenerateForOrder() error = %v", err)
+	}
+	svc.now = func() time.Time { return time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC) }
+	if _, err := svc.GenerateForOrder(ctx, testOrder("ord_may", commerce.OrderStatusPaid), Party{ID: "usr_buyer"}); err != nil {
+		t.Fatalf("GenerateForOrder() error = %v", err)
+	}
+
+	var archive bytes.Buffer
+	count, err := svc.WriteArchive(ctx, &archive, ArchiveFilter{
+		From: time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("expected only April's invoice archived, got %d err=%v", count, err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	files := make(map[string][]byte, len(reader.File))
+	for _, file := range reader.File {
+		opened, err := file.Open()
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", file.Name, err)
+		}
+		files[file.Name], _ = io.ReadAll(opened)
+		opened.Close()
+	}
+	stored, _ := svc.Content(ctx, first[0])
+	if !bytes.Equal(files[first[0].FileName], stored) {
+		t.Fatalf("expected the stored PDF in the archive, got files %v", len(files))
+	}
+	rows, err := csv.NewReader(bytes.NewReader(files["manifest.csv"])).ReadAll()
+	if err != nil || len(rows) != 2 || rows[1][0] != first[0].InvoiceNumber || rows[1][8] != first[0].ContentSHA256 {
+		t.Fatalf("expected a manifest row with the invoice hash, got %v err=%v", rows, err)
+	}
+
+	if _, err := svc.WriteArchive(ctx, io.Discard, ArchiveFilter{}); !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("expected ErrInvalidArchive, got %v", err)
+	}
+}
+
+func TestRunStopsWhenContextIsCancelled(t *testing.T) {
+	svc := NewService(Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := svc.Run(ctx, time.Hour)
+	select {
+	case <-done:
+		t.Fatal("expected purging to run until cancelled")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected purging to stop after cancel")
+	}
+}
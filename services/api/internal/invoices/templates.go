@@ -0,0 +1,442 @@
+package invoices
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/yxshee/marketplace-platform/services/api/internal/currency"
+)
+
+// Document locales. Each locale has its own template: translated labels and
+// number, date and currency formatting.
+const (
+	LocaleEN = "en"
+	LocaleDE = "de"
+	LocaleFR = "fr"
+)
+
+const (
+	defaultPrimaryColor = "#1F2937"
+	defaultAccentColor  = "#2563EB"
+	// maxFooterLength bounds a vendor's custom footer text.
+	maxFooterLength = 500
+)
+
+var (
+	ErrUnsupportedLocale = errors.New("invoice locale is not supported")
+	ErrInvalidBranding   = errors.New("invoice branding is invalid")
+	ErrInvalidFooter     = errors.New("invoice footer is too long")
+)
+
+// Branding is printed on every document: an optional PNG or JPEG logo in the
+// header, the primary color for titles and headings, and the accent color for
+// the rules between sections. Colors are #RRGGBB.
+type Branding struct {
+	Logo         []byte
+	PrimaryColor string
+	AccentColor  string
+}
+
+// Validate reports whether the logo is a PNG or JPEG image and the colors are
+// #RRGGBB values.
+func (b Branding) Validate() error {
+	if len(b.Logo) > 0 && logoImageType(b.Logo) == "" {
+		return ErrInvalidBranding
+	}
+	for _, color := range []string{b.PrimaryColor, b.AccentColor} {
+		if _, _, _, ok := parseColor(color); color != "" && !ok {
+			return ErrInvalidBranding
+		}
+	}
+	return nil
+}
+
+// documentTemplate holds a locale's wording and formatting.
+type documentTemplate struct {
+	titleInvoice           string
+	titleCommissionInvoice string
+	titleCreditNote        string
+	issuedBy               string
+	issuedTo               string
+	taxID                  string
+	number                 string
+	issuedAt               string
+	orderID                string
+	shipmentID             string
+	creditsInvoice         string
+	lines                  string
+	totals                 string
+	subtotal               string
+	shipping               string
+	taxIncluded            string
+	total                  string
+	// footer is formatted with the platform name and support email.
+	footer string
+	// commissionLine is formatted with the rate and the shipment id.
+	commissionLine string
+	// refundLine is formatted with the credited invoice number.
+	refundLine string
+
+	// labelSeparator sits between a label and its value.
+	labelSeparator     string
+	decimalSeparator   string
+	thousandsSeparator string
+	dateLayout         string
+	// symbolAfter places the currency symbol after the amount.
+	symbolAfter bool
+}
+
+var documentTemplates = map[string]documentTemplate{
+	LocaleEN: {
+		titleInvoice:           "Invoice",
+		titleCommissionInvoice: "Commission invoice",
+		titleCreditNote:        "Credit note",
+		issuedBy:               "Issued by",
+		issuedTo:               "Issued to",
+		taxID:                  "Tax ID",
+		number:                 "Number",
+		issuedAt:               "Issued at",
+		orderID:                "Order ID",
+		shipmentID:             "Shipment ID",
+		creditsInvoice:         "Credits invoice",
+		lines:                  "Items",
+		totals:                 "Totals",
+		subtotal:               "Subtotal",
+		shipping:               "Shipping",
+		taxIncluded:            "Tax included",
+		total:                  "Total",
+		footer:                 "Issued through %s. Questions: %s",
+		commissionLine:         "Marketplace commission (%s) on shipment %s",
+		refundLine:             "Refund against invoice %s",
+		labelSeparator:         ": ",
+		decimalSeparator:       ".",
+		thousandsSeparator:     ",",
+		dateLayout:             "01/02/2006 15:04 MST",
+	},
+	LocaleDE: {
+		titleInvoice:           "Rechnung",
+		titleCommissionInvoice: "Provisionsrechnung",
+		titleCreditNote:        "Gutschrift",
+		issuedBy:               "Aussteller",
+		issuedTo:               "Empfänger",
+		taxID:                  "USt-IdNr.",
+		number:                 "Nummer",
+		issuedAt:               "Ausgestellt am",
+		orderID:                "Bestellnummer",
+		shipmentID:             "Sendungsnummer",
+		creditsInvoice:         "Gutschrift zu Rechnung",
+		lines:                  "Positionen",
+		totals:                 "Summen",
+		subtotal:               "Zwischensumme",
+		shipping:               "Versand",
+		taxIncluded:            "Enthaltene Steuer",
+		total:                  "Gesamtbetrag",
+		footer:                 "Ausgestellt über %s. Fragen: %s",
+		commissionLine:         "Marktplatzprovision (%s) für Sendung %s",
+		refundLine:             "Erstattung zu Rechnung %s",
+		labelSeparator:         ": ",
+		decimalSeparator:       ",",
+		thousandsSeparator:     ".",
+		dateLayout:             "02.01.2006 15:04 MST",
+		symbolAfter:            true,
+	},
+	LocaleFR: {
+		titleInvoice:           "Facture",
+		titleCommissionInvoice: "Facture de commission",
+		titleCreditNote:        "Avoir",
+		issuedBy:               "Émise par",
+		issuedTo:               "Destinataire",
+		taxID:                  "N° TVA",
+		number:                 "Numéro",
+		issuedAt:               "Date d'émission",
+		orderID:                "Commande",
+		shipmentID:             "Expédition",
+		creditsInvoice:         "Avoir sur la facture",
+		lines:                  "Articles",
+		totals:                 "Totaux",
+		subtotal:               "Sous-total",
+		shipping:               "Livraison",
+		taxIncluded:            "Dont TVA",
+		total:                  "Total",
+		footer:                 "Émise via %s. Questions : %s",
+		commissionLine:         "Commission de la place de marché (%s) sur l'expédition %s",
+		refundLine:             "Remboursement sur la facture %s",
+		labelSeparator:         " : ",
+		decimalSeparator:       ",",
+		thousandsSeparator:     " ",
+		dateLayout:             "02/01/2006 15:04 MST",
+		symbolAfter:            true,
+	},
+}
+
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"USD": "$",
+}
+
+// SupportedLocales lists the locales documents can be issued in.
+func SupportedLocales() []string {
+	locales := make([]string, 0, len(documentTemplates))
+	for locale := range documentTemplates {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// NormalizeLocale lowercases a locale and checks that it has a template. The
+// empty locale is valid and means the platform default.
+func NormalizeLocale(locale string) (string, error) {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == "" {
+		return "", nil
+	}
+	if _, exists := documentTemplates[locale]; !exists {
+		return "", ErrUnsupportedLocale
+	}
+	return locale, nil
+}
+
+// NormalizeFooter trims a vendor's footer text and checks its length.
+func NormalizeFooter(footer string) (string, error) {
+	footer = strings.TrimSpace(footer)
+	if len([]rune(footer)) > maxFooterLength {
+		return "", ErrInvalidFooter
+	}
+	return footer, nil
+}
+
+func templateFor(locale string) documentTemplate {
+	if tmpl, exists := documentTemplates[locale]; exists {
+		return tmpl
+	}
+	return documentTemplates[LocaleEN]
+}
+
+// documentLine is one line of a rendered document. The PDF renderer maps each
+// style to a font, size and color.
+type documentLine struct {
+	Style string
+	Text  string
+}
+
+const (
+	styleTitle   = "title"
+	styleHeading = "heading"
+	styleText    = "text"
+	styleItem    = "item"
+	styleTotal   = "total"
+	styleFooter  = "footer"
+	styleRule    = "rule"
+)
+
+// documentLines lays out a document in its locale. It holds everything the
+// PDF shows apart from the logo, so the wording and formatting of each
+// template can be checked without parsing PDFs.
+func documentLines(invoice Invoice, cfg Config) []documentLine {
+	tmpl := templateFor(invoice.Locale)
+	out := make([]documentLine, 0, 32)
+	add := func(style, text string) {
+		out = append(out, documentLine{Style: style, Text: text})
+	}
+
+	title := tmpl.titleInvoice
+	switch invoice.Kind {
+	case KindCommissionInvoice:
+		title = tmpl.titleCommissionInvoice
+	case KindCreditNote:
+		title = tmpl.titleCreditNote
+	}
+	add(styleTitle, title)
+	add(styleRule, "")
+
+	for _, party := range []struct {
+		heading string
+		party   Party
+	}{{tmpl.issuedBy, invoice.Issuer}, {tmpl.issuedTo, invoice.Recipient}} {
+		add(styleHeading, party.heading)
+		name := party.party.LegalName
+		if name == "" {
+			name = party.party.Name
+		}
+		for _, value := range []string{name, party.party.Address, party.party.Email} {
+			if value != "" {
+				add(styleText, value)
+			}
+		}
+		if party.party.TaxID != "" {
+			add(styleText, labeled(tmpl, tmpl.taxID, party.party.TaxID))
+		}
+	}
+	add(styleRule, "")
+
+	add(styleText, labeled(tmpl, tmpl.number, invoice.InvoiceNumber))
+	add(styleText, labeled(tmpl, tmpl.issuedAt, invoice.IssuedAt.UTC().Format(tmpl.dateLayout)))
+	add(styleText, labeled(tmpl, tmpl.orderID, invoice.OrderID))
+	add(styleText, labeled(tmpl, tmpl.shipmentID, invoice.ShipmentID))
+	if invoice.OriginalInvoiceNumber != "" {
+		add(styleText, labeled(tmpl, tmpl.creditsInvoice, invoice.OriginalInvoiceNumber))
+	}
+
+	add(styleHeading, tmpl.lines)
+	for _, line := range invoice.Lines {
+		add(styleItem, fmt.Sprintf("%s x%d  %s", line.Description, line.Qty, tmpl.formatMoney(line.TotalCents, invoice.Currency)))
+	}
+
+	add(styleHeading, tmpl.totals)
+	if invoice.Kind == KindInvoice {
+		add(styleText, labeled(tmpl, tmpl.subtotal, tmpl.formatMoney(invoice.SubtotalCents, invoice.Currency)))
+		add(styleText, labeled(tmpl, tmpl.shipping, tmpl.formatMoney(invoice.ShippingCents, invoice.Currency)))
+	}
+	add(styleText, labeled(tmpl, tmpl.taxIncluded, tmpl.formatMoney(invoice.TaxCents, invoice.Currency)))
+	add(styleTotal, labeled(tmpl, tmpl.total, tmpl.formatMoney(invoice.TotalCents, invoice.Currency)))
+
+	add(styleRule, "")
+	if invoice.Footer != "" {
+		add(styleFooter, invoice.Footer)
+	}
+	add(styleFooter, fmt.Sprintf(tmpl.footer, cfg.PlatformName, cfg.PlatformSupportEmail))
+	return out
+}
+
+func labeled(tmpl documentTemplate, label, value string) string {
+	return label + tmpl.labelSeparator + value
+}
+
+// formatMoney formats an amount in the currency's minor units with the
+// locale's separators and the currency's symbol, or its code when it has no
+// common symbol. Zero-decimal currencies such as JPY have no fractional part.
+func (t documentTemplate) formatMoney(minor int64, code string) string {
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	decimals := currency.MinorUnits(code)
+	scale := minorUnitScale(decimals)
+
+	digits := strconv.FormatInt(minor/scale, 10)
+	var whole strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			whole.WriteString(t.thousandsSeparator)
+		}
+		whole.WriteRune(digit)
+	}
+	amount := sign + whole.String()
+	if decimals > 0 {
+		amount += fmt.Sprintf("%s%0*d", t.decimalSeparator, decimals, minor%scale)
+	}
+
+	symbol, known := currencySymbols[code]
+	switch {
+	case !known:
+		return amount + " " + code
+	case t.symbolAfter:
+		return amount + " " + symbol
+	default:
+		return symbol + amount
+	}
+}
+
+// minorUnitScale returns the number of minor units in one major unit.
+func minorUnitScale(decimals int) int64 {
+	scale := int64(1)
+	for range decimals {
+		scale *= 10
+	}
+	return scale
+}
+
+func renderInvoicePDF(invoice Invoice, cfg Config) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	// Core fonts are cp1252; translate so accents and currency symbols print.
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetCreationDate(invoice.IssuedAt)
+	pdf.SetModificationDate(invoice.IssuedAt)
+	pdf.SetTitle(invoice.InvoiceNumber, true)
+	pdf.SetAuthor(invoice.Issuer.LegalName, true)
+	pdf.AddPage()
+
+	primaryR, primaryG, primaryB, _ := parseColor(cfg.Branding.PrimaryColor)
+	accentR, accentG, accentB, _ := parseColor(cfg.Branding.AccentColor)
+
+	if len(cfg.Branding.Logo) > 0 {
+		options := fpdf.ImageOptions{ImageType: logoImageType(cfg.Branding.Logo), ReadDpi: true}
+		pdf.RegisterImageOptionsReader("logo", options, bytes.NewReader(cfg.Branding.Logo))
+		pdf.ImageOptions("logo", 150, 10, 45, 0, false, options, 0, "")
+	}
+
+	for _, line := range documentLines(invoice, cfg) {
+		pdf.SetTextColor(0, 0, 0)
+		switch line.Style {
+		case styleTitle:
+			pdf.SetFont("Helvetica", "B", 16)
+			pdf.SetTextColor(primaryR, primaryG, primaryB)
+			pdf.CellFormat(0, 10, tr(line.Text), "", 1, "L", false, 0, "")
+		case styleHeading:
+			pdf.Ln(2)
+			pdf.SetFont("Helvetica", "B", 11)
+			pdf.SetTextColor(primaryR, primaryG, primaryB)
+			pdf.CellFormat(0, 6, tr(line.Text), "", 1, "L", false, 0, "")
+		case styleItem:
+			pdf.SetFont("Helvetica", "", 10)
+			pdf.CellFormat(0, 6, tr("- "+line.Text), "", 1, "L", false, 0, "")
+		case styleTotal:
+			pdf.SetFont("Helvetica", "B", 11)
+			pdf.CellFormat(0, 7, tr(line.Text), "", 1, "L", false, 0, "")
+		case styleFooter:
+			pdf.SetFont("Helvetica", "I", 8)
+			pdf.MultiCell(0, 4, tr(line.Text), "", "L", false)
+		case styleRule:
+			pdf.Ln(1)
+			pdf.SetDrawColor(accentR, accentG, accentB)
+			pdf.SetLineWidth(0.4)
+			pdf.Line(10, pdf.GetY(), 200, pdf.GetY())
+			pdf.Ln(2)
+		default:
+			pdf.SetFont("Helvetica", "", 10)
+			pdf.CellFormat(0, 6, tr(line.Text), "", 1, "L", false, 0, "")
+		}
+	}
+
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// parseColor parses #RRGGBB.
+func parseColor(value string) (int, int, int, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(value) != 6 {
+		return 0, 0, 0, false
+	}
+	rgb, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return int(rgb >> 16 & 0xFF), int(rgb >> 8 & 0xFF), int(rgb & 0xFF), true
+}
+
+func logoImageType(logo []byte) string {
+	switch http.DetectContentType(logo) {
+	case "image/png":
+		return "PNG"
+	case "image/jpeg":
+		return "JPG"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,138 @@
+package invoices
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the invoice template golden files")
+
+func TestDocumentTemplatesMatchGoldenFilesPerLocale(t *testing.T) {
+	cfg := NewService(Config{PlatformName: "Marketplace", PlatformSupportEmail: "support@example.com"}).cfg
+	issuedAt := time.Date(2026, time.March, 2, 9, 30, 0, 0, time.UTC)
+
+	for _, locale := range SupportedLocales() {
+		t.Run(locale, func(t *testing.T) {
+			tmpl := templateFor(locale)
+			invoice := Invoice{
+				Kind:          KindInvoice,
+				OrderID:       "ord_golden",
+				ShipmentID:    "shp_1",
+				InvoiceNumber: "INV-PAPER-000042",
+				IssuedAt:      issuedAt,
+				Issuer:        Party{Name: "Paper Co", LegalName: "Paper Co GmbH", TaxID: "DE123456789", Address: "1 Mühlenweg, Berlin"},
+				Recipient:     Party{Name: "buyer@example.com", Email: "buyer@example.com"},
+				Lines: []Line{
+					{Description: "Grid Notebook", Qty: 3, UnitPriceCents: 45000, TotalCents: 135000},
+					{Description: tmpl.shipping, Qty: 1, UnitPriceCents: 500, TotalCents: 500},
+				},
+				Currency:      "EUR",
+				SubtotalCents: 135000,
+				ShippingCents: 500,
+				TaxCents:      21643,
+				TotalCents:    135500,
+				Locale:        locale,
+				Footer:        "Paper Co GmbH · Amtsgericht Berlin HRB 12345",
+			}
+			credit := invoice
+			credit.Kind = KindCreditNote
+			credit.InvoiceNumber = "CN-PAPER-000007"
+			credit.OriginalInvoiceNumber = invoice.InvoiceNumber
+			credit.Lines = []Line{{Description: "Refund", Qty: 1, UnitPriceCents: 2200, TotalCents: 2200}}
+			credit.Currency = "CHF"
+			credit.TaxCents, credit.TotalCents = 351, 2200
+
+			// JPY has no minor unit and KWD has three decimals.
+			yen := invoice
+			yen.InvoiceNumber = "INV-PAPER-000043"
+			yen.Lines = []Line{
+				{Description: "Grid Notebook", Qty: 2, UnitPriceCents: 750, TotalCents: 1500},
+				{Description: tmpl.shipping, Qty: 1, UnitPriceCents: 1200, TotalCents: 1200},
+			}
+			yen.Currency = "JPY"
+			yen.SubtotalCents, yen.ShippingCents, yen.TaxCents, yen.TotalCents = 1500, 1200, 245, 2700
+			dinar := credit
+			dinar.InvoiceNumber = "CN-PAPER-000008"
+			dinar.Lines = []Line{{Description: "Refund", Qty: 1, UnitPriceCents: 1234567, TotalCents: 1234567}}
+			dinar.Currency = "KWD"
+			dinar.TaxCents, dinar.TotalCents = 5, 1234567
+
+			var got strings.Builder
+			for _, document := range []Invoice{invoice, credit, yen, dinar} {
+				for _, line := range documentLines(document, cfg) {
+					got.WriteString(line.Style + " | " + line.Text + "\n")
+				}
+				got.WriteString("\n")
+			}
+
+			golden := filepath.Join("testdata", "invoice_"+locale+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got.String()), 0o644); err != nil {
+					t.Fatalf("WriteFile() error = %v", err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v (run go test -update to create it)", err)
+			}
+			if got.String() != string(want) {
+				t.Fatalf("%s does not match the rendered document:\n%s", golden, got.String())
+			}
+		})
+	}
+}
+
+func TestRenderInvoicePDFAppliesBrandingAndVendorLocale(t *testing.T) {
+	var logo bytes.Buffer
+	if err := png.Encode(&logo, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	branding := Branding{Logo: logo.Bytes(), PrimaryColor: "#0F766E", AccentColor: "#F59E0B"}
+	if err := branding.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	for _, invalid := range []Branding{{Logo: []byte("GIF89a")}, {PrimaryColor: "teal"}, {AccentColor: "#12345"}} {
+		if err := invalid.Validate(); !errors.Is(err, ErrInvalidBranding) {
+			t.Fatalf("expected ErrInvalidBranding for %+v, got %v", invalid, err)
+		}
+	}
+	if _, err := NormalizeLocale("pt"); !errors.Is(err, ErrUnsupportedLocale) {
+		t.Fatalf("expected ErrUnsupportedLocale, got %v", err)
+	}
+
+	svc := NewService(Config{
+		Locale:   "DE",
+		Branding: branding,
+		Vendor: func(vendorID string) (VendorDetails, bool) {
+			return VendorDetails{Party: Party{Name: "Paper Co"}, Code: "paper", CommissionBPS: 1000, Locale: "fr", Footer: "SIRET 123"}, true
+		},
+	})
+	issued, err := svc.GenerateForOrder(t.Context(), testOrder("ord_branded", "paid"), Party{ID: "usr_buyer"})
+	if err != nil {
+		t.Fatalf("GenerateForOrder() error = %v", err)
+	}
+	for _, invoice := range issued {
+		content, err := svc.Content(t.Context(), invoice)
+		if err != nil || !bytes.HasPrefix(content, []byte("%PDF")) {
+			t.Fatalf("expected a rendered PDF, err=%v", err)
+		}
+		switch invoice.Kind {
+		case KindInvoice:
+			if invoice.Locale != LocaleFR || invoice.Footer != "SIRET 123" || invoice.Lines[len(invoice.Lines)-1].Description != "Livraison" {
+				t.Fatalf("expected the vendor's French template and footer, got %+v", invoice)
+			}
+		case KindCommissionInvoice:
+			if invoice.Locale != LocaleDE || invoice.Footer != "" || !strings.HasPrefix(invoice.Lines[0].Description, "Marktplatzprovision") {
+				t.Fatalf("expected the platform's German template without the vendor footer, got %+v", invoice)
+			}
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package invoices
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/currency"
+)
+
+// Export formats. PDF is the printable document; UBL is the same document as
+// UBL 2.1 XML following the Peppol BIS Billing 3.0 profile.
+const (
+	FormatPDF = "pdf"
+	FormatUBL = "ubl"
+)
+
+const (
+	ublInvoiceNamespace    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCreditNoteNamespace = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	ublCACNamespace        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCBCNamespace        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+
+	peppolCustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	peppolProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+
+	ublInvoiceTypeCode    = "380"
+	ublCreditNoteTypeCode = "381"
+	// ublUnitCode is UN/ECE rec 20 "one", used for every line.
+	ublUnitCode = "C62"
+)
+
+var ErrUnsupportedFormat = errors.New("invoice format is not supported")
+
+// Document is an issued invoice rendered in one export format.
+type Document struct {
+	Format      string
+	ContentType string
+	FileName    string
+	Content     []byte
+}
+
+// Export returns an issued document as PDF or UBL XML. The PDF is the stored
+// document, served byte for byte. The UBL rendering is derived from the
+// document's record, so both formats carry the same number, parties and
+// amounts.
+func (s *Service) Export(ctx context.Context, invoice Invoice, format string) (Document, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatPDF:
+		content, err := s.Content(ctx, invoice)
+		if err != nil {
+			return Document{}, err
+		}
+		return Document{
+			Format:      FormatPDF,
+			ContentType: "application/pdf",
+			FileName:    invoice.FileName,
+			Content:     content,
+		}, nil
+	case FormatUBL:
+		content, err := RenderUBL(invoice)
+		if err != nil {
+			return Document{}, err
+		}
+		return Document{
+			Format:      FormatUBL,
+			ContentType: "application/xml",
+			FileName:    strings.TrimSuffix(invoice.FileName, ".pdf") + ".xml",
+			Content:     content,
+		}, nil
+	default:
+		return Document{}, ErrUnsupportedFormat
+	}
+}
+
+// RenderUBL renders invoices and commission invoices as UBL Invoice documents
+// and credit notes as UBL CreditNote documents that reference the credited
+// invoice. Prices are tax inclusive, so line amounts are reported net of their
+// share of the document's tax.
+func RenderUBL(invoice Invoice) ([]byte, error) {
+	if invoice.InvoiceNumber == "" || invoice.Currency == "" || len(invoice.Lines) == 0 {
+		return nil, ErrInvalidOrder
+	}
+
+	currencyCode := strings.ToUpper(invoice.Currency)
+	taxCategory := ublTaxCategoryFor(invoice)
+	netTotal := invoice.TotalCents - invoice.TaxCents
+	netLines := netLineAmounts(invoice.Lines, netTotal)
+
+	header := ublDocumentHeader{
+		XMLNSCAC:        ublCACNamespace,
+		XMLNSCBC:        ublCBCNamespace,
+		CustomizationID: peppolCustomizationID,
+		ProfileID:       peppolProfileID,
+		ID:              invoice.InvoiceNumber,
+		IssueDate:       invoice.IssuedAt.UTC().Format("2006-01-02"),
+	}
+	body := ublDocumentBody{
+		Note:                 invoice.Reason,
+		DocumentCurrencyCode: currencyCode,
+		BuyerReference:       invoice.OrderID,
+		OrderReference:       &ublOrderReference{ID: invoice.OrderID},
+		Supplier:             ublSupplierParty{Party: newUBLParty(invoice.Issuer)},
+		Customer:             ublCustomerParty{Party: newUBLParty(invoice.Recipient)},
+		TaxTotal: ublTaxTotal{
+			TaxAmount: newUBLAmount(invoice.TaxCents, currencyCode),
+			TaxSubtotal: []ublTaxSubtotal{{
+				TaxableAmount: newUBLAmount(netTotal, currencyCode),
+				TaxAmount:     newUBLAmount(invoice.TaxCents, currencyCode),
+				TaxCategory:   taxCategory,
+			}},
+		},
+		LegalMonetaryTotal: ublMonetaryTotal{
+			LineExtensionAmount: newUBLAmount(netTotal, currencyCode),
+			TaxExclusiveAmount:  newUBLAmount(netTotal, currencyCode),
+			TaxInclusiveAmount:  newUBLAmount(invoice.TotalCents, currencyCode),
+			PayableAmount:       newUBLAmount(invoice.TotalCents, currencyCode),
+		},
+	}
+
+	lines := make([]ublLine, 0, len(invoice.Lines))
+	for i, line := range invoice.Lines {
+		unitPrice := netLines[i]
+		if line.Qty > 0 {
+			unitPrice = netLines[i] / int64(line.Qty)
+		}
+		lines = append(lines, ublLine{
+			ID:                  fmt.Sprintf("%d", i+1),
+			Quantity:            ublQuantity{UnitCode: ublUnitCode, Value: fmt.Sprintf("%d", maxQty(line.Qty))},
+			LineExtensionAmount: newUBLAmount(netLines[i], currencyCode),
+			Item: ublItem{
+				Name: line.Description,
+				ClassifiedTaxCategory: ublTaxCategory{
+					ID:        taxCategory.ID,
+					Percent:   taxCategory.Percent,
+					TaxScheme: taxCategory.TaxScheme,
+				},
+			},
+			Price: ublPrice{PriceAmount: newUBLAmount(unitPrice, currencyCode)},
+		})
+	}
+
+	var root interface{}
+	if invoice.Kind == KindCreditNote {
+		body.BillingReference = &ublBillingReference{
+			InvoiceDocumentReference: ublDocumentReference{ID: invoice.OriginalInvoiceNumber},
+		}
+		root = ublCreditNote{
+			XMLName:            xml.Name{Local: "CreditNote"},
+			XMLNS:              ublCreditNoteNamespace,
+			ublDocumentHeader:  header,
+			CreditNoteTypeCode: ublCreditNoteTypeCode,
+			ublDocumentBody:    body,
+			Lines:              creditNoteLines(lines),
+		}
+	} else {
+		root = ublInvoice{
+			XMLName:           xml.Name{Local: "Invoice"},
+			XMLNS:             ublInvoiceNamespace,
+			ublDocumentHeader: header,
+			InvoiceTypeCode:   ublInvoiceTypeCode,
+			ublDocumentBody:   body,
+			Lines:             lines,
+		}
+	}
+
+	content, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+// ublTaxCategoryFor reports tax as standard rated at the rate implied by the
+// document's tax share, or zero rated when no tax is included.
+func ublTaxCategoryFor(invoice Invoice) ublTaxCategory {
+	category := ublTaxCategory{ID: "Z", Percent: "0.00", TaxScheme: ublTaxScheme{ID: "VAT"}}
+	netTotal := invoice.TotalCents - invoice.TaxCents
+	if invoice.TaxCents > 0 && netTotal > 0 {
+		basisPoints := (invoice.TaxCents*10000 + netTotal/2) / netTotal
+		category.ID = "S"
+		category.Percent = fmt.Sprintf("%d.%02d", basisPoints/100, basisPoints%100)
+	}
+	return category
+}
+
+// netLineAmounts spreads the document's net total over its lines in
+// proportion to their tax-inclusive totals. The last line absorbs rounding so
+// the lines always add up to the net total.
+func netLineAmounts(lines []Line, netTotal int64) []int64 {
+	var grossTotal int64
+	for _, line := range lines {
+		grossTotal += line.TotalCents
+	}
+
+	amounts := make([]int64, len(lines))
+	var allocated int64
+	for i, line := range lines {
+		if i == len(lines)-1 {
+			amounts[i] = netTotal - allocated
+			break
+		}
+		amounts[i] = line.TotalCents
+		if grossTotal > 0 {
+			amounts[i] = line.TotalCents * netTotal / grossTotal
+		}
+		allocated += amounts[i]
+	}
+	return amounts
+}
+
+func maxQty(qty int32) int32 {
+	if qty < 1 {
+		return 1
+	}
+	return qty
+}
+
+// newUBLAmount writes an amount in the currency's minor units with exactly
+// that many decimals, as Peppol rule BR-DEC requires.
+func newUBLAmount(minor int64, code string) ublAmount {
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	decimals := currency.MinorUnits(code)
+	scale := minorUnitScale(decimals)
+	value := fmt.Sprintf("%s%d", sign, minor/scale)
+	if decimals > 0 {
+		value += fmt.Sprintf(".%0*d", decimals, minor%scale)
+	}
+	return ublAmount{CurrencyID: code, Value: value}
+}
+
+func newUBLParty(party Party) ublParty {
+	registrationName := party.LegalName
+	if registrationName == "" {
+		registrationName = party.Name
+	}
+
+	out := ublParty{
+		PartyName:        &ublPartyName{Name: party.Name},
+		PostalAddress:    ublAddress{StreetName: party.Address},
+		PartyLegalEntity: ublLegalEntity{RegistrationName: registrationName},
+	}
+	if party.Email != "" {
+		out.EndpointID = &ublIdentifier{SchemeID: "EM", Value: party.Email}
+		out.Contact = &ublContact{ElectronicMail: party.Email}
+	}
+	if party.CountryCode != "" {
+		out.PostalAddress.Country = &ublCountry{IdentificationCode: party.CountryCode}
+	}
+	if party.TaxID != "" {
+		out.PartyTaxScheme = &ublPartyTaxScheme{CompanyID: party.TaxID, TaxScheme: ublTaxScheme{ID: "VAT"}}
+	}
+	return out
+}
+
+func creditNoteLines(lines []ublLine) []ublCreditNoteLine {
+	out := make([]ublCreditNoteLine, 0, len(lines))
+	for _, line := range lines {
+		out = append(out, ublCreditNoteLine(line))
+	}
+	return out
+}
+
+// The Invoice and CreditNote schemas share their header and body elements
+// but differ in the type code between them and in the line element, so each
+// root embeds the shared parts around its own fields to keep the element
+// order the schemas require.
+type ublDocumentHeader struct {
+	XMLNSCAC        string `xml:"xmlns:cac,attr"`
+	XMLNSCBC        string `xml:"xmlns:cbc,attr"`
+	CustomizationID string `xml:"cbc:CustomizationID"`
+	ProfileID       string `xml:"cbc:ProfileID"`
+	ID              string `xml:"cbc:ID"`
+	IssueDate       string `xml:"cbc:IssueDate"`
+}
+
+type ublDocumentBody struct {
+	Note                 string               `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode string               `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference       string               `xml:"cbc:BuyerReference,omitempty"`
+	OrderReference       *ublOrderReference   `xml:"cac:OrderReference,omitempty"`
+	BillingReference     *ublBillingReference `xml:"cac:BillingReference,omitempty"`
+	Supplier             ublSupplierParty     `xml:"cac:AccountingSupplierParty"`
+	Customer             ublCustomerParty     `xml:"cac:AccountingCustomerParty"`
+	TaxTotal             ublTaxTotal          `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal   ublMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+}
+
+type ublInvoice struct {
+	XMLName xml.Name
+	XMLNS   string `xml:"xmlns,attr"`
+	ublDocumentHeader
+	InvoiceTypeCode string `xml:"cbc:InvoiceTypeCode"`
+	ublDocumentBody
+	Lines []ublLine `xml:"cac:InvoiceLine"`
+}
+
+type ublCreditNote struct {
+	XMLName xml.Name
+	XMLNS   string `xml:"xmlns,attr"`
+	ublDocumentHeader
+	CreditNoteTypeCode string `xml:"cbc:CreditNoteTypeCode"`
+	ublDocumentBody
+	Lines []ublCreditNoteLine `xml:"cac:CreditNoteLine"`
+}
+
+type ublAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublIdentifier struct {
+	SchemeID string `xml:"schemeID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublOrderReference struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublBillingReference struct {
+	InvoiceDocumentReference ublDocumentReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+type ublDocumentReference struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublSupplierParty struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublCustomerParty struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublParty struct {
+	EndpointID       *ublIdentifier     `xml:"cbc:EndpointID,omitempty"`
+	PartyName        *ublPartyName      `xml:"cac:PartyName,omitempty"`
+	PostalAddress    ublAddress         `xml:"cac:PostalAddress"`
+	PartyTaxScheme   *ublPartyTaxScheme `xml:"cac:PartyTaxScheme,omitempty"`
+	PartyLegalEntity ublLegalEntity     `xml:"cac:PartyLegalEntity"`
+	Contact          *ublContact        `xml:"cac:Contact,omitempty"`
+}
+
+type ublPartyName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+type ublAddress struct {
+	StreetName string      `xml:"cbc:StreetName,omitempty"`
+	Country    *ublCountry `xml:"cac:Country,omitempty"`
+}
+
+type ublCountry struct {
+	IdentificationCode string `xml:"cbc:IdentificationCode"`
+}
+
+type ublPartyTaxScheme struct {
+	CompanyID string       `xml:"cbc:CompanyID"`
+	TaxScheme ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublLegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+}
+
+type ublContact struct {
+	ElectronicMail string `xml:"cbc:ElectronicMail"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount   ublAmount        `xml:"cbc:TaxAmount"`
+	TaxSubtotal []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	TaxCategory   ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID        string       `xml:"cbc:ID"`
+	Percent   string       `xml:"cbc:Percent"`
+	TaxScheme ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublTaxScheme struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount ublAmount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  ublAmount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  ublAmount `xml:"cbc:TaxInclusiveAmount"`
+	PayableAmount       ublAmount `xml:"cbc:PayableAmount"`
+}
+
+type ublLine struct {
+	ID                  string      `xml:"cbc:ID"`
+	Quantity            ublQuantity `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount ublAmount   `xml:"cbc:LineExtensionAmount"`
+	Item                ublItem     `xml:"cac:Item"`
+	Price               ublPrice    `xml:"cac:Price"`
+}
+
+type ublCreditNoteLine struct {
+	ID                  string      `xml:"cbc:ID"`
+	Quantity            ublQuantity `xml:"cbc:CreditedQuantity"`
+	LineExtensionAmount ublAmount   `xml:"cbc:LineExtensionAmount"`
+	Item                ublItem     `xml:"cac:Item"`
+	Price               ublPrice    `xml:"cac:Price"`
+}
+
+type ublItem struct {
+	Name                  string         `xml:"cbc:Name"`
+	ClassifiedTaxCategory ublTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type ublPrice struct {
+	PriceAmount ublAmount `xml:"cbc:PriceAmount"`
+}
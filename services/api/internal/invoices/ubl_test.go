@@ -0,0 +1,418 @@
+package invoices
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/currency"
+)
+
+// ublSchema is the part of a UBL 2.1 document schema the export relies on:
+// the xsd:sequence of the root and line elements, in schema order, and the
+// elements Peppol BIS Billing 3.0 makes mandatory. checkUBL compares documents
+// against it by hand; it is not an XSD validator.
+type ublSchema struct {
+	namespace    string
+	sequence     []string
+	required     []string
+	line         string
+	lineSequence []string
+}
+
+var ublSchemas = map[string]ublSchema{
+	// maindoc/UBL-Invoice-2.1.xsd
+	"Invoice": {
+		namespace: ublInvoiceNamespace,
+		sequence: []string{
+			"UBLExtensions", "UBLVersionID", "CustomizationID", "ProfileID", "ProfileExecutionID", "ID",
+			"CopyIndicator", "UUID", "IssueDate", "IssueTime", "DueDate", "InvoiceTypeCode", "Note",
+			"TaxPointDate", "DocumentCurrencyCode", "TaxCurrencyCode", "PricingCurrencyCode",
+			"PaymentCurrencyCode", "PaymentAlternativeCurrencyCode", "AccountingCostCode", "AccountingCost",
+			"LineCountNumeric", "BuyerReference", "InvoicePeriod", "OrderReference", "BillingReference",
+			"DespatchDocumentReference", "ReceiptDocumentReference", "StatementDocumentReference",
+			"OriginatorDocumentReference", "ContractDocumentReference", "AdditionalDocumentReference",
+			"ProjectReference", "Signature", "AccountingSupplierParty", "AccountingCustomerParty",
+			"PayeeParty", "BuyerCustomerParty", "SellerSupplierParty", "TaxRepresentativeParty", "Delivery",
+			"DeliveryTerms", "PaymentMeans", "PaymentTerms", "PrepaidPayment", "AllowanceCharge",
+			"TaxExchangeRate", "PricingExchangeRate", "PaymentExchangeRate", "PaymentAlternativeExchangeRate",
+			"TaxTotal", "WithholdingTaxTotal", "LegalMonetaryTotal", "InvoiceLine",
+		},
+		required: []string{
+			"CustomizationID", "ProfileID", "ID", "IssueDate", "InvoiceTypeCode", "DocumentCurrencyCode",
+			"AccountingSupplierParty", "AccountingCustomerParty", "TaxTotal", "LegalMonetaryTotal", "InvoiceLine",
+		},
+		line: "InvoiceLine",
+		lineSequence: []string{
+			"ID", "UUID", "Note", "InvoicedQuantity", "LineExtensionAmount", "TaxPointDate",
+			"AccountingCostCode", "AccountingCost", "PaymentPurposeCode", "FreeOfChargeIndicator",
+			"InvoicePeriod", "OrderLineReference", "DespatchLineReference", "ReceiptLineReference",
+			"BillingReference", "DocumentReference", "PricingReference", "OriginatorParty", "Delivery",
+			"PaymentTerms", "AllowanceCharge", "TaxTotal", "WithholdingTaxTotal", "Item", "Price",
+			"DeliveryTerms", "SubInvoiceLine", "ItemPriceExtension",
+		},
+	},
+	// maindoc/UBL-CreditNote-2.1.xsd
+	"CreditNote": {
+		namespace: ublCreditNoteNamespace,
+		sequence: []string{
+			"UBLExtensions", "UBLVersionID", "CustomizationID", "ProfileID", "ProfileExecutionID", "ID",
+			"CopyIndicator", "UUID", "IssueDate", "IssueTime", "TaxPointDate", "CreditNoteTypeCode", "Note",
+			"DocumentCurrencyCode", "TaxCurrencyCode", "PricingCurrencyCode", "PaymentCurrencyCode",
+			"PaymentAlternativeCurrencyCode", "AccountingCostCode", "AccountingCost", "LineCountNumeric",
+			"BuyerReference", "InvoicePeriod", "DiscrepancyResponse", "OrderReference", "BillingReference",
+			"DespatchDocumentReference", "ReceiptDocumentReference", "ContractDocumentReference",
+			"AdditionalDocumentReference", "StatementDocumentReference", "OriginatorDocumentReference",
+			"Signature", "AccountingSupplierParty", "AccountingCustomerParty", "PayeeParty",
+			"BuyerCustomerParty", "SellerSupplierParty", "TaxRepresentativeParty", "Delivery",
+			"DeliveryTerms", "PaymentMeans", "PaymentTerms", "TaxExchangeRate", "PricingExchangeRate",
+			"PaymentExchangeRate", "PaymentAlternativeExchangeRate", "AllowanceCharge", "TaxTotal",
+			"LegalMonetaryTotal", "CreditNoteLine",
+		},
+		required: []string{
+			"CustomizationID", "ProfileID", "ID", "IssueDate", "CreditNoteTypeCode", "DocumentCurrencyCode",
+			"BillingReference", "AccountingSupplierParty", "AccountingCustomerParty", "TaxTotal",
+			"LegalMonetaryTotal", "CreditNoteLine",
+		},
+		line: "CreditNoteLine",
+		lineSequence: []string{
+			"ID", "UUID", "Note", "CreditedQuantity", "LineExtensionAmount", "TaxPointDate",
+			"AccountingCostCode", "AccountingCost", "PaymentPurposeCode", "FreeOfChargeIndicator",
+			"InvoicePeriod", "OrderLineReference", "DespatchLineReference", "ReceiptLineReference",
+			"BillingReference", "DocumentReference", "PricingReference", "OriginatorParty", "Delivery",
+			"PaymentTerms", "TaxTotal", "AllowanceCharge", "Item", "Price", "DeliveryTerms",
+			"SubCreditNoteLine", "ItemPriceExtension",
+		},
+	},
+}
+
+type xmlNode struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Text     string
+	Children []*xmlNode
+}
+
+func (n *xmlNode) child(local string) *xmlNode {
+	for _, child := range n.Children {
+		if child.Name.Local == local {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *xmlNode) path(locals ...string) *xmlNode {
+	node := n
+	for _, local := range locals {
+		if node = node.child(local); node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+func (n *xmlNode) attr(local string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func parseXMLTree(t *testing.T, content []byte) *xmlNode {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: element.Name, Attrs: element.Attr}
+			if len(stack) == 0 {
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += strings.TrimSpace(string(element))
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if root == nil || len(stack) != 0 {
+		t.Fatalf("expected well-formed XML, got %s", content)
+	}
+	return root
+}
+
+// checkUBL checks a document's element order and mandatory elements against
+// ublSchemas, and that its amounts carry the currency's decimals and add up,
+// and returns the parsed tree.
+func checkUBL(t *testing.T, content []byte) *xmlNode {
+	t.Helper()
+	root := parseXMLTree(t, content)
+	schema, known := ublSchemas[root.Name.Local]
+	if !known || root.Name.Space != schema.namespace {
+		t.Fatalf("unexpected root element %s in %s", root.Name.Local, root.Name.Space)
+	}
+
+	checkSequence(t, root, schema.sequence)
+	for _, name := range schema.required {
+		if root.child(name) == nil {
+			t.Fatalf("%s is missing mandatory %s", root.Name.Local, name)
+		}
+	}
+	for _, child := range root.Children {
+		if child.Name.Space != ublCBCNamespace && child.Name.Space != ublCACNamespace {
+			t.Fatalf("%s is not in a UBL common components namespace: %s", child.Name.Local, child.Name.Space)
+		}
+	}
+
+	currencyCode := root.child("DocumentCurrencyCode").Text
+	decimals := currency.MinorUnits(currencyCode)
+	amount := func(node *xmlNode) int64 {
+		t.Helper()
+		if node == nil {
+			t.Fatal("expected amount element")
+		}
+		if node.attr("currencyID") != currencyCode {
+			t.Fatalf("%s currencyID=%q, want %q", node.Name.Local, node.attr("currencyID"), currencyCode)
+		}
+		whole, fraction, hasFraction := strings.Cut(node.Text, ".")
+		if hasFraction != (decimals > 0) || len(fraction) != decimals {
+			t.Fatalf("%s=%q is not a %s amount with %d decimals", node.Name.Local, node.Text, currencyCode, decimals)
+		}
+		minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+		if err != nil {
+			t.Fatalf("%s=%q is not an amount: %v", node.Name.Local, node.Text, err)
+		}
+		return minor
+	}
+
+	var lineTotal int64
+	for _, line := range root.Children {
+		if line.Name.Local != schema.line {
+			continue
+		}
+		checkSequence(t, line, schema.lineSequence)
+		if line.path("Item", "Name") == nil || line.path("Item", "ClassifiedTaxCategory", "TaxScheme", "ID") == nil {
+			t.Fatalf("%s %s is missing its item name or tax category", schema.line, line.child("ID").Text)
+		}
+		lineTotal += amount(line.child("LineExtensionAmount"))
+		amount(line.path("Price", "PriceAmount"))
+	}
+
+	totals := root.child("LegalMonetaryTotal")
+	taxExclusive := amount(totals.child("TaxExclusiveAmount"))
+	taxAmount := amount(root.path("TaxTotal", "TaxAmount"))
+	if amount(totals.child("LineExtensionAmount")) != lineTotal || taxExclusive != lineTotal {
+		t.Fatalf("expected line amounts to add up to %d", lineTotal)
+	}
+	if amount(totals.child("TaxInclusiveAmount")) != taxExclusive+taxAmount || amount(totals.child("PayableAmount")) != taxExclusive+taxAmount {
+		t.Fatal("expected tax inclusive and payable amounts to equal net amount plus tax")
+	}
+	var subtotalTax int64
+	for _, subtotal := range root.child("TaxTotal").Children {
+		if subtotal.Name.Local == "TaxSubtotal" {
+			subtotalTax += amount(subtotal.child("TaxAmount"))
+			amount(subtotal.child("TaxableAmount"))
+		}
+	}
+	if subtotalTax != taxAmount {
+		t.Fatalf("expected tax breakdown to add up to %d, got %d", taxAmount, subtotalTax)
+	}
+	for _, party := range []string{"AccountingSupplierParty", "AccountingCustomerParty"} {
+		if root.path(party, "Party", "PartyLegalEntity", "RegistrationName") == nil || root.path(party, "Party", "PostalAddress") == nil {
+			t.Fatalf("%s is missing its legal entity or address", party)
+		}
+	}
+	return root
+}
+
+func checkSequence(t *testing.T, parent *xmlNode, sequence []string) {
+	t.Helper()
+	position := make(map[string]int, len(sequence))
+	for i, name := range sequence {
+		position[name] = i
+	}
+	last := -1
+	for _, child := range parent.Children {
+		index, known := position[child.Name.Local]
+		if !known {
+			t.Fatalf("%s is not allowed in %s", child.Name.Local, parent.Name.Local)
+		}
+		if index < last {
+			t.Fatalf("%s is out of schema order in %s", child.Name.Local, parent.Name.Local)
+		}
+		last = index
+	}
+}
+
+func TestExportRendersPeppolUBLInvoicesAndCreditNotes(t *testing.T) {
+	svc := NewService(Config{
+		PlatformCountryCode: "US",
+		Vendor: func(vendorID string) (VendorDetails, bool) {
+			return VendorDetails{
+				Party: Party{
+					Name:        "Paper Co",
+					LegalName:   "Paper Co GmbH",
+					TaxID:       "DE123456789",
+					Address:     "1 Mill Road, Berlin",
+					Email:       "billing@paper.example",
+					CountryCode: "DE",
+				},
+				Code:          "paper",
+				CommissionBPS: 1000,
+			}, true
+		},
+	})
+	svc.now = func() time.Time { return time.Date(2026, time.March, 2, 9, 30, 0, 0, time.UTC) }
+
+	order := testOrder("ord_ubl", commerce.OrderStatusPaid)
+	order.TaxCents = 941
+	issued, err := svc.GenerateForOrder(context.Background(), order, Party{ID: "usr_buyer", Name: "buyer@example.com", Email: "buyer@example.com"})
+	if err != nil {
+		t.Fatalf("GenerateForOrder() error = %v", err)
+	}
+	byKind := make(map[string]Invoice, len(issued))
+	for _, invoice := range issued {
+		byKind[invoice.Kind] = invoice
+	}
+	if len(byKind) != 2 {
+		t.Fatalf("expected an invoice and a commission invoice, got %d documents", len(issued))
+	}
+
+	document, err := svc.Export(context.Background(), byKind[KindInvoice], "UBL")
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if document.ContentType != "application/xml" || document.FileName != "invoice-inv-paper-000001.xml" {
+		t.Fatalf("unexpected UBL document %s %s", document.ContentType, document.FileName)
+	}
+	root := checkUBL(t, document.Content)
+	if root.child("ID").Text != "INV-PAPER-000001" || root.child("IssueDate").Text != "2026-03-02" || root.child("InvoiceTypeCode").Text != "380" {
+		t.Fatalf("unexpected invoice header in %s", document.Content)
+	}
+	supplier := root.path("AccountingSupplierParty", "Party")
+	if supplier.path("PartyTaxScheme", "CompanyID").Text != "DE123456789" || supplier.path("PostalAddress", "Country", "IdentificationCode").Text != "DE" {
+		t.Fatalf("expected the vendor's VAT number and country, got %s", document.Content)
+	}
+	if subtotal := root.path("TaxTotal", "TaxSubtotal", "TaxCategory"); subtotal.child("ID").Text != "S" || subtotal.child("Percent").Text != "18.98" {
+		t.Fatalf("expected standard rated tax at the included rate, got %s", document.Content)
+	}
+	lines := 0
+	for _, child := range root.Children {
+		if child.Name.Local == "InvoiceLine" {
+			lines++
+		}
+	}
+	if lines != 3 || root.path("LegalMonetaryTotal", "PayableAmount").Text != "59.00" {
+		t.Fatalf("expected two items and shipping payable 59.00, got %s", document.Content)
+	}
+
+	commission, err := svc.Export(context.Background(), byKind[KindCommissionInvoice], FormatUBL)
+	if err != nil {
+		t.Fatalf("Export() commission error = %v", err)
+	}
+	if root := checkUBL(t, commission.Content); root.path("AccountingCustomerParty", "Party", "PartyLegalEntity", "RegistrationName").Text != "Paper Co GmbH" {
+		t.Fatalf("expected the commission invoice addressed to the vendor, got %s", commission.Content)
+	}
+
+	credit, err := svc.IssueCreditNote(context.Background(), CreditNoteInput{
+		OrderID: "ord_ubl", ShipmentID: "shp_1", RefundRequestID: "rfd_ubl", AmountCents: 2200, Reason: "damaged",
+	})
+	if err != nil {
+		t.Fatalf("IssueCreditNote() error = %v", err)
+	}
+	creditDocument, err := svc.Export(context.Background(), credit, FormatUBL)
+	if err != nil {
+		t.Fatalf("Export() credit note error = %v", err)
+	}
+	creditRoot := checkUBL(t, creditDocument.Content)
+	if creditRoot.Name.Local != "CreditNote" || creditRoot.path("BillingReference", "InvoiceDocumentReference", "ID").Text != "INV-PAPER-000001" {
+		t.Fatalf("expected a credit note referencing the invoice, got %s", creditDocument.Content)
+	}
+
+	if pdf, err := svc.Export(context.Background(), byKind[KindInvoice], ""); err != nil || !bytes.HasPrefix(pdf.Content, []byte("%PDF")) {
+		t.Fatalf("expected the PDF by default, got err=%v", err)
+	}
+	if _, err := svc.Export(context.Background(), byKind[KindInvoice], "docx"); err != ErrUnsupportedFormat {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestRenderUBLWritesAmountsInTheCurrencysMinorUnits(t *testing.T) {
+	issuedAt := time.Date(2026, time.March, 2, 9, 30, 0, 0, time.UTC)
+	party := Party{Name: "Paper Co", LegalName: "Paper Co KK", Address: "1 Mill Road"}
+
+	for _, tc := range []struct {
+		currency string
+		kind     string
+		lines    []Line
+		tax      int64
+		total    int64
+		payable  string
+		price    string
+	}{
+		{
+			currency: "JPY",
+			kind:     KindInvoice,
+			lines:    []Line{{Description: "Grid Notebook", Qty: 2, UnitPriceCents: 750, TotalCents: 1500}},
+			tax:      136,
+			total:    1500,
+			payable:  "1500",
+			price:    "682",
+		},
+		{
+			currency: "KWD",
+			kind:     KindCreditNote,
+			lines:    []Line{{Description: "Refund", Qty: 1, UnitPriceCents: 12345, TotalCents: 12345}},
+			tax:      5,
+			total:    12345,
+			payable:  "12.345",
+			price:    "12.340",
+		},
+	} {
+		t.Run(tc.currency, func(t *testing.T) {
+			content, err := RenderUBL(Invoice{
+				Kind:                  tc.kind,
+				OrderID:               "ord_minor",
+				InvoiceNumber:         "DOC-" + tc.currency,
+				OriginalInvoiceNumber: "INV-" + tc.currency,
+				IssuedAt:              issuedAt,
+				Issuer:                party,
+				Recipient:             party,
+				Lines:                 tc.lines,
+				Currency:              tc.currency,
+				TaxCents:              tc.tax,
+				TotalCents:            tc.total,
+			})
+			if err != nil {
+				t.Fatalf("RenderUBL() error = %v", err)
+			}
+			root := checkUBL(t, content)
+			line := root.child(ublSchemas[root.Name.Local].line)
+			if got := root.path("LegalMonetaryTotal", "PayableAmount").Text; got != tc.payable {
+				t.Fatalf("PayableAmount=%q, want %q", got, tc.payable)
+			}
+			if got := line.path("Price", "PriceAmount").Text; got != tc.price {
+				t.Fatalf("PriceAmount=%q, want %q", got, tc.price)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+var ErrInvalidMail = errors.New("mail recipient and subject are required")
+
+// Mail is a plain-text email. Kind names the template it was rendered from,
+// so local transports and logs can tell messages apart.
+type Mail struct {
+	Kind    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as verification and password reset
+// links.
+type Mailer interface {
+	Send(ctx context.Context, message Mail) error
+}
+
+func validate(message Mail) error {
+	if _, err := mail.ParseAddress(message.To); err != nil || strings.TrimSpace(message.Subject) == "" {
+		return ErrInvalidMail
+	}
+	return nil
+}
+
+// LogMailer writes the envelope of each message to the process log. Bodies
+// are left out because they carry single-use tokens. It is the default when
+// no transport is configured.
+type LogMailer struct {
+	Logger *log.Logger
+}
+
+func (m LogMailer) Send(_ context.Context, message Mail) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+
+	logger := m.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("mail kind=%s to=%s subject=%q", message.Kind, message.To, message.Subject)
+	return nil
+}
+
+// FileMailer writes each message as an .eml file to a directory, for local
+// development and tests.
+type FileMailer struct {
+	Dir  string
+	From string
+	now  func() time.Time
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("mail directory must not be empty")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir, From: from, now: func() time.Time { return time.Now().UTC() }}, nil
+}
+
+func (m *FileMailer) Send(_ context.Context, message Mail) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", m.now().Format("20060102T150405.000000000"), identifier.New("mail"))
+	return os.WriteFile(filepath.Join(m.Dir, name), render(m.From, message, m.now()), 0o640)
+}
+
+// SMTPMailer delivers through an SMTP relay. Credentials are optional; when
+// set, the relay must offer STARTTLS because PLAIN auth refuses to send them
+// in the clear.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPMailer(addr, username, password, from string) (*SMTPMailer, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("smtp address must be host:port: %w", err)
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("mail from address is invalid: %w", err)
+	}
+	return &SMTPMailer{Addr: addr, Username: username, Password: password, From: from}, nil
+}
+
+func (m *SMTPMailer) Send(_ context.Context, message Mail) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, auth, sender.Address, []string{message.To}, render(m.From, message, time.Now().UTC()))
+}
+
+// render formats a message as RFC 5322 text. Header values are stripped of
+// line breaks so user input cannot inject headers.
+func render(from string, message Mail, sentAt time.Time) []byte {
+	var out strings.Builder
+	for _, header := range [][2]string{
+		{"From", from},
+		{"To", message.To},
+		{"Subject", message.Subject},
+		{"Date", sentAt.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=UTF-8"},
+		{"X-Mail-Kind", message.Kind},
+	} {
+		value := strings.NewReplacer("\r", "", "\n", "").Replace(header[1])
+		out.WriteString(header[0] + ": " + value + "\r\n")
+	}
+	out.WriteString("\r\n")
+	out.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(out.String())
+}
@@ -0,0 +1,113 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerWritesMessagesWithoutHeaderInjection(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := NewFileMailer(dir, "Marketplace <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewFileMailer() error = %v", err)
+	}
+
+	if err := mailer.Send(context.Background(), Mail{Kind: "password_reset", To: "buyer@example.com", Subject: "Reset\r\nBcc: attacker@example.com", Body: "Open the link.\nIt expires soon."}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := mailer.Send(context.Background(), Mail{To: "not an address", Subject: "Hi"}); !errors.Is(err, ErrInvalidMail) {
+		t.Fatalf("expected ErrInvalidMail, got %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one message file, got %v", files)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	message := string(raw)
+	if !strings.Contains(message, "To: buyer@example.com\r\n") || !strings.Contains(message, "Subject: ResetBcc: attacker@example.com\r\n") {
+		t.Fatalf("expected sanitized headers, got %q", message)
+	}
+	if strings.Contains(message, "\r\nBcc:") || !strings.HasSuffix(message, "\r\n\r\nOpen the link.\r\nIt expires soon.") {
+		t.Fatalf("unexpected message layout %q", message)
+	}
+}
+
+func TestSMTPMailerDeliversThroughRelay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go serveOneSMTPSession(listener, received)
+
+	mailer, err := NewSMTPMailer(listener.Addr().String(), "", "", "Marketplace <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+	if err := mailer.Send(context.Background(), Mail{Kind: "email_verification", To: "buyer@example.com", Subject: "Verify your email", Body: "token"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	transcript := <-received
+	for _, want := range []string{"MAIL FROM:<no-reply@example.com>", "RCPT TO:<buyer@example.com>", "Subject: Verify your email", "token"} {
+		if !strings.Contains(transcript, want) {
+			t.Fatalf("expected %q in the SMTP transcript, got %q", want, transcript)
+		}
+	}
+	if _, err := NewSMTPMailer("smtp.example.com", "", "", "no-reply@example.com"); err == nil {
+		t.Fatal("expected an address without a port to be rejected")
+	}
+}
+
+// serveOneSMTPSession accepts one connection and answers just enough of SMTP
+// for net/smtp to deliver a message.
+func serveOneSMTPSession(listener net.Listener, received chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	var transcript strings.Builder
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	inData := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		transcript.WriteString(line)
+		switch {
+		case inData && line == ".\r\n":
+			inData = false
+			reply("250 queued")
+		case inData:
+		case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(line, "DATA"):
+			inData = true
+			reply("354 go ahead")
+		case strings.HasPrefix(line, "QUIT"):
+			reply("221 bye")
+			received <- transcript.String()
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+	received <- transcript.String()
+}
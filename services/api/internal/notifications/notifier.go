@@ -0,0 +1,123 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidMessage = errors.New("notification recipient and kind are required")
+
+// Message is a channel-agnostic notification addressed to a platform user.
+type Message struct {
+	Kind            string            `json:"kind"`
+	RecipientUserID string            `json:"recipient_user_id"`
+	Subject         string            `json:"subject"`
+	Body            string            `json:"body"`
+	Data            map[string]string `json:"data,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+// Notifier delivers messages to buyers. Implementations may send email, push
+// or simply record the message.
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
+
+func validate(message Message) error {
+	if strings.TrimSpace(message.Kind) == "" || strings.TrimSpace(message.RecipientUserID) == "" {
+		return ErrInvalidMessage
+	}
+	return nil
+}
+
+// LogNotifier writes messages to the process log. It is the default until a
+// delivery channel is configured.
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+func (n LogNotifier) Notify(_ context.Context, message Message) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+
+	logger := n.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("notification kind=%s recipient=%s subject=%q", message.Kind, message.RecipientUserID, message.Subject)
+	return nil
+}
+
+// Outbox keeps delivered messages in memory so they can be inspected, and
+// optionally forwards them to another notifier.
+type Outbox struct {
+	mu       sync.Mutex
+	next     Notifier
+	messages []Message
+	limit    int
+	now      func() time.Time
+}
+
+// NewOutbox retains up to limit messages, dropping the oldest first.
+func NewOutbox(next Notifier, limit int) *Outbox {
+	if limit <= 0 {
+		limit = 1000
+	}
+	return &Outbox{
+		next:     next,
+		messages: make([]Message, 0),
+		limit:    limit,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (o *Outbox) Notify(ctx context.Context, message Message) error {
+	if err := validate(message); err != nil {
+		return err
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = o.now()
+	}
+	if o.next != nil {
+		if err := o.next.Notify(ctx, message); err != nil {
+			return err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, message)
+	if overflow := len(o.messages) - o.limit; overflow > 0 {
+		o.messages = append([]Message(nil), o.messages[overflow:]...)
+	}
+	return nil
+}
+
+// List returns retained messages newest first, optionally filtered by kind
+// and recipient.
+func (o *Outbox) List(kind, recipientUserID string) []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	items := make([]Message, 0, len(o.messages))
+	for _, message := range o.messages {
+		if kind != "" && message.Kind != kind {
+			continue
+		}
+		if recipientUserID != "" && message.RecipientUserID != recipientUserID {
+			continue
+		}
+		items = append(items, message)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreatedAt.After(items[j].CreatedAt)
+	})
+	return items
+}
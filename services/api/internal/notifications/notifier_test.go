@@ -0,0 +1,39 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOutboxValidatesRetainsAndFilters(t *testing.T) {
+	forwarded := NewOutbox(nil, 10)
+	outbox := NewOutbox(forwarded, 2)
+	base := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	if err := outbox.Notify(context.Background(), Message{Kind: "cart_recovery"}); err != ErrInvalidMessage {
+		t.Fatalf("expected ErrInvalidMessage, got %v", err)
+	}
+
+	for i, recipient := range []string{"usr_1", "usr_2", "usr_1"} {
+		if err := outbox.Notify(context.Background(), Message{
+			Kind:            "cart_recovery",
+			RecipientUserID: recipient,
+			Subject:         "Come back",
+			CreatedAt:       base.Add(time.Duration(i) * time.Minute),
+		}); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	retained := outbox.List("", "")
+	if len(retained) != 2 || !retained[0].CreatedAt.Equal(base.Add(2*time.Minute)) {
+		t.Fatalf("expected newest two messages to be retained, got %+v", retained)
+	}
+	if filtered := outbox.List("cart_recovery", "usr_2"); len(filtered) != 1 {
+		t.Fatalf("expected one message for usr_2, got %+v", filtered)
+	}
+	if len(forwarded.List("", "")) != 3 {
+		t.Fatal("expected every message to be forwarded to the next notifier")
+	}
+}
@@ -0,0 +1,391 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidProviderSpec = errors.New("invalid oidc provider spec")
+	ErrDiscovery           = errors.New("oidc discovery failed")
+	ErrTokenExchange       = errors.New("oidc token exchange failed")
+	ErrInvalidIDToken      = errors.New("invalid oidc id token")
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// ProviderConfig names an OpenID provider and the client registered with it.
+type ProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// ParseProviderConfigs reads the name=value lists of API_OIDC_PROVIDERS,
+// API_OIDC_CLIENT_IDS and API_OIDC_CLIENT_SECRETS. Every provider needs an
+// issuer URL and a client ID; the secret is optional for public clients.
+func ParseProviderConfigs(issuers, clientIDs, clientSecrets string) ([]ProviderConfig, error) {
+	ids, err := parsePairs(clientIDs)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := parsePairs(clientSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	configs := make([]ProviderConfig, 0)
+	for _, entry := range splitList(issuers) {
+		name, issuer, found := strings.Cut(entry, "=")
+		cfg := ProviderConfig{
+			Name:         normalizeName(name),
+			Issuer:       strings.TrimRight(strings.TrimSpace(issuer), "/"),
+			ClientID:     ids[normalizeName(name)],
+			ClientSecret: secrets[normalizeName(name)],
+		}
+		if !found || cfg.Name == "" || cfg.ClientID == "" {
+			return nil, ErrInvalidProviderSpec
+		}
+		if parsed, err := url.Parse(cfg.Issuer); err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			return nil, ErrInvalidProviderSpec
+		}
+		if _, duplicate := seen[cfg.Name]; duplicate {
+			return nil, ErrInvalidProviderSpec
+		}
+		seen[cfg.Name] = struct{}{}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+func parsePairs(value string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, entry := range splitList(value) {
+		name, pairValue, found := strings.Cut(entry, "=")
+		if !found || normalizeName(name) == "" {
+			return nil, ErrInvalidProviderSpec
+		}
+		pairs[normalizeName(name)] = strings.TrimSpace(pairValue)
+	}
+	return pairs, nil
+}
+
+func splitList(value string) []string {
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Claims are the ID token claims used to find or link an account.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// flexibleBool accepts email_verified as a boolean or as the string some
+// providers send.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch typed := value.(type) {
+	case bool:
+		*b = flexibleBool(typed)
+	case string:
+		*b = flexibleBool(strings.EqualFold(typed, "true"))
+	}
+	return nil
+}
+
+// Provider talks to one OpenID provider. Discovery and signing keys are
+// fetched on first use; keys are fetched again when a token names an
+// unknown key ID, which covers provider key rotation.
+type Provider struct {
+	cfg    ProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *discoveryDocument
+	keys     map[string]crypto.PublicKey
+}
+
+func NewProvider(cfg ProviderConfig, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = defaultScopes
+	}
+	return &Provider{cfg: cfg, client: client, keys: make(map[string]crypto.PublicKey)}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the provider URL the browser is sent to.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// its ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, redirectURI, nonce string) (Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.doJSON(req, &tokens); err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrTokenExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return Claims{}, fmt.Errorf("%w: response has no id_token", ErrTokenExchange)
+	}
+	return p.verifyIDToken(ctx, metadata, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, metadata discoveryDocument, rawToken, nonce string) (Claims, error) {
+	claims := idTokenClaims{}
+	token, err := jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, metadata, kid)
+	}, jwt.WithValidMethods([]string{"RS256", "ES256"}))
+	if err != nil || !token.Valid {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Issuer != metadata.Issuer:
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.VerifyAudience(p.cfg.ClientID, true):
+		return Claims{}, fmt.Errorf("%w: token is not for this client", ErrInvalidIDToken)
+	case claims.ExpiresAt == nil:
+		return Claims{}, fmt.Errorf("%w: token has no expiry", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return Claims{}, fmt.Errorf("%w: token has no subject", ErrInvalidIDToken)
+	}
+
+	return Claims{
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(strings.TrimSpace(claims.Email)),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+	var metadata discoveryDocument
+	if err := p.doJSON(req, &metadata); err != nil {
+		return discoveryDocument{}, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if strings.TrimRight(metadata.Issuer, "/") != p.cfg.Issuer {
+		return discoveryDocument{}, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, metadata.Issuer, p.cfg.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return discoveryDocument{}, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+	p.metadata = &metadata
+	return metadata, nil
+}
+
+func (p *Provider) key(ctx context.Context, metadata discoveryDocument, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, candidate := range set.Keys {
+		if candidate.Use != "" && candidate.Use != "sig" {
+			continue
+		}
+		if key, err := candidate.publicKey(); err == nil {
+			keys[candidate.KeyID] = key
+		}
+	}
+	p.keys = keys
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) doJSON(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
@@ -0,0 +1,199 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown oidc provider")
+	ErrInvalidState    = errors.New("oidc state is invalid or expired")
+)
+
+const defaultStateTTL = 10 * time.Minute
+
+// Config lists the providers and where the web app receives their
+// callbacks.
+type Config struct {
+	Providers []ProviderConfig
+	// RedirectBaseURL is the web app origin; providers redirect to
+	// <RedirectBaseURL>/auth/oidc/<provider>/callback.
+	RedirectBaseURL string
+	StateTTL        time.Duration
+	HTTPClient      *http.Client
+}
+
+// Authorization is a started login or link flow.
+type Authorization struct {
+	Provider  string    `json:"provider"`
+	URL       string    `json:"authorization_url"`
+	State     string    `json:"state"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Result is a completed flow. LinkUserID is set when the flow was started
+// to link the identity to a signed-in user.
+type Result struct {
+	Provider   string
+	Claims     Claims
+	LinkUserID string
+}
+
+type pendingAuthorization struct {
+	provider     string
+	codeVerifier string
+	nonce        string
+	redirectURI  string
+	linkUserID   string
+	expiresAt    time.Time
+}
+
+// Service runs authorization code flows with PKCE. The verifier and nonce of
+// each flow stay on the server, keyed by the hash of the state parameter.
+type Service struct {
+	providers    map[string]*Provider
+	order        []string
+	redirectBase string
+	stateTTL     time.Duration
+
+	mu      sync.Mutex
+	pending map[string]pendingAuthorization
+	now     func() time.Time
+}
+
+func NewService(cfg Config) *Service {
+	stateTTL := cfg.StateTTL
+	if stateTTL <= 0 {
+		stateTTL = defaultStateTTL
+	}
+	svc := &Service{
+		providers:    make(map[string]*Provider, len(cfg.Providers)),
+		redirectBase: strings.TrimRight(cfg.RedirectBaseURL, "/"),
+		stateTTL:     stateTTL,
+		pending:      make(map[string]pendingAuthorization),
+		now:          func() time.Time { return time.Now().UTC() },
+	}
+	for _, providerCfg := range cfg.Providers {
+		svc.providers[providerCfg.Name] = NewProvider(providerCfg, cfg.HTTPClient)
+		svc.order = append(svc.order, providerCfg.Name)
+	}
+	return svc
+}
+
+// Providers returns the configured provider names in configuration order.
+func (s *Service) Providers() []string {
+	return append([]string(nil), s.order...)
+}
+
+func (s *Service) HasProvider(name string) bool {
+	_, ok := s.providers[normalizeName(name)]
+	return ok
+}
+
+// RedirectURI is the callback registered with the provider.
+func (s *Service) RedirectURI(provider string) string {
+	return s.redirectBase + "/auth/oidc/" + normalizeName(provider) + "/callback"
+}
+
+// Begin starts a flow and returns the URL to send the browser to. Pass the
+// signed-in user's ID as linkUserID to link instead of signing in.
+func (s *Service) Begin(ctx context.Context, providerName, linkUserID string) (Authorization, error) {
+	provider, ok := s.providers[normalizeName(providerName)]
+	if !ok {
+		return Authorization{}, ErrUnknownProvider
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return Authorization{}, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return Authorization{}, err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	redirectURI := s.RedirectURI(provider.Name())
+	authURL, err := provider.AuthCodeURL(ctx, redirectURI, state, nonce, CodeChallenge(verifier))
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	now := s.now()
+	expiresAt := now.Add(s.stateTTL)
+	s.mu.Lock()
+	for key, pending := range s.pending {
+		if !pending.expiresAt.After(now) {
+			delete(s.pending, key)
+		}
+	}
+	s.pending[hashState(state)] = pendingAuthorization{
+		provider:     provider.Name(),
+		codeVerifier: verifier,
+		nonce:        nonce,
+		redirectURI:  redirectURI,
+		linkUserID:   linkUserID,
+		expiresAt:    expiresAt,
+	}
+	s.mu.Unlock()
+
+	return Authorization{Provider: provider.Name(), URL: authURL, State: state, ExpiresAt: expiresAt}, nil
+}
+
+// Complete redeems the code returned to the callback. A state is accepted
+// once, and only for the provider it was issued for.
+func (s *Service) Complete(ctx context.Context, providerName, state, code string) (Result, error) {
+	name := normalizeName(providerName)
+	provider, ok := s.providers[name]
+	if !ok {
+		return Result{}, ErrUnknownProvider
+	}
+
+	key := hashState(strings.TrimSpace(state))
+	s.mu.Lock()
+	pending, exists := s.pending[key]
+	delete(s.pending, key)
+	s.mu.Unlock()
+	if !exists || pending.provider != name || !pending.expiresAt.After(s.now()) {
+		return Result{}, ErrInvalidState
+	}
+	if strings.TrimSpace(code) == "" {
+		return Result{}, ErrTokenExchange
+	}
+
+	claims, err := provider.Exchange(ctx, strings.TrimSpace(code), pending.codeVerifier, pending.redirectURI, pending.nonce)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Provider: name, Claims: claims, LinkUserID: pending.linkUserID}, nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge of a verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/oidc/oidctest"
+)
+
+func TestAuthorizationCodeFlowWithPKCEAgainstMockIssuer(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("marketplace-web", "client-secret")
+	if err != nil {
+		t.Fatalf("NewIssuer() error = %v", err)
+	}
+	defer issuer.Close()
+
+	configs, err := ParseProviderConfigs("Acme="+issuer.URL(), "acme=marketplace-web", "acme=client-secret")
+	if err != nil {
+		t.Fatalf("ParseProviderConfigs() error = %v", err)
+	}
+	svc := NewService(Config{Providers: configs, RedirectBaseURL: "https://shop.example.com/"})
+	if got := svc.Providers(); len(got) != 1 || got[0] != "acme" {
+		t.Fatalf("unexpected providers %v", got)
+	}
+
+	ctx := context.Background()
+	authorization, err := svc.Begin(ctx, "acme", "")
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if !strings.HasPrefix(authorization.URL, issuer.URL()+"/authorize?") || !strings.Contains(authorization.URL, "code_challenge_method=S256") {
+		t.Fatalf("unexpected authorization url %q", authorization.URL)
+	}
+	if !strings.Contains(authorization.URL, "redirect_uri=https%3A%2F%2Fshop.example.com%2Fauth%2Foidc%2Facme%2Fcallback") {
+		t.Fatalf("expected the web callback as redirect uri, got %q", authorization.URL)
+	}
+
+	callback, err := issuer.Authorize(authorization.URL, oidctest.User{Subject: "acme-42", Email: "Buyer@Example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if _, err := svc.Complete(ctx, "acme", "forged-state", callback.Get("code")); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState, got %v", err)
+	}
+	result, err := svc.Complete(ctx, "acme", callback.Get("state"), callback.Get("code"))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if result.Provider != "acme" || result.Claims.Subject != "acme-42" || result.Claims.Email != "buyer@example.com" || !result.Claims.EmailVerified {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if _, err := svc.Complete(ctx, "acme", callback.Get("state"), callback.Get("code")); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected the state to be single-use, got %v", err)
+	}
+
+	// A flow whose code was issued for another verifier fails at the token
+	// endpoint.
+	first, _ := svc.Begin(ctx, "acme", "usr_1")
+	second, _ := svc.Begin(ctx, "acme", "usr_1")
+	stolen, _ := issuer.Authorize(first.URL, oidctest.User{Subject: "acme-42"})
+	if _, err := svc.Complete(ctx, "acme", second.State, stolen.Get("code")); !errors.Is(err, ErrTokenExchange) {
+		t.Fatalf("expected ErrTokenExchange for a mismatched verifier, got %v", err)
+	}
+	if _, err := svc.Begin(ctx, "other", ""); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected ErrUnknownProvider, got %v", err)
+	}
+}
+
+func TestIDTokensWithWrongNonceOrAudienceAreRejected(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("marketplace-web", "client-secret")
+	if err != nil {
+		t.Fatalf("NewIssuer() error = %v", err)
+	}
+	defer issuer.Close()
+
+	provider := NewProvider(ProviderConfig{Name: "acme", Issuer: issuer.URL(), ClientID: "marketplace-web", ClientSecret: "client-secret"}, nil)
+	ctx := context.Background()
+	redeem := func(nonce string) error {
+		authURL, err := provider.AuthCodeURL(ctx, "https://shop.example.com/cb", "state", "nonce-1", CodeChallenge("verifier"))
+		if err != nil {
+			t.Fatalf("AuthCodeURL() error = %v", err)
+		}
+		callback, err := issuer.Authorize(authURL, oidctest.User{Subject: "acme-42"})
+		if err != nil {
+			t.Fatalf("Authorize() error = %v", err)
+		}
+		_, err = provider.Exchange(ctx, callback.Get("code"), "verifier", "https://shop.example.com/cb", nonce)
+		return err
+	}
+
+	if err := redeem("nonce-2"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("expected a nonce mismatch to be rejected, got %v", err)
+	}
+	issuer.Audience = "someone-else"
+	if err := redeem("nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("expected a token for another client to be rejected, got %v", err)
+	}
+	issuer.Audience = ""
+	if err := redeem("nonce-1"); err != nil {
+		t.Fatalf("expected a valid token to pass, got %v", err)
+	}
+}
+
+func TestParseProviderConfigsRejectsIncompleteSpecs(t *testing.T) {
+	for _, spec := range [][3]string{
+		{"acme=https://idp.example.com", "", ""},
+		{"acme", "acme=client", ""},
+		{"acme=idp.example.com", "acme=client", ""},
+		{"acme=https://a.example.com,acme=https://b.example.com", "acme=client", ""},
+		{"acme=https://idp.example.com", "client", ""},
+	} {
+		if _, err := ParseProviderConfigs(spec[0], spec[1], spec[2]); !errors.Is(err, ErrInvalidProviderSpec) {
+			t.Fatalf("expected ErrInvalidProviderSpec for %v, got %v", spec, err)
+		}
+	}
+}
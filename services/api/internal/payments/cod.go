@@ -0,0 +1,394 @@
+package payments
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+const (
+	// DefaultCODRefusalLimit is how many orders a buyer may refuse at the door
+	// before cash on delivery is withheld from them.
+	DefaultCODRefusalLimit = 2
+
+	CODSettlementOffset     = "offset"
+	CODSettlementRemittance = "remittance"
+)
+
+var (
+	ErrCODBuyerFlagged         = errors.New("cash on delivery is unavailable after repeated refusals")
+	ErrInvalidCODOutcome       = errors.New("cod outcome must be collected or refused")
+	ErrCODOutcomeConflict      = errors.New("cod shipment already has a different outcome")
+	ErrInvalidRemittance       = errors.New("remittance requires a vendor, currency, amount and reference")
+	ErrRemittanceExceedsOwed   = errors.New("remittance exceeds the commission the vendor owes")
+	ErrCODBuyerFlagNotFound    = errors.New("cod buyer flag not found")
+	errCODCollectionIncomplete = errors.New("cod collection requires an order and shipment")
+)
+
+// CODCollection is the outcome of one shipment delivered cash on delivery.
+// ConfirmedBy names who reported it, such as vendor:<user id> or
+// carrier:<carrier code>.
+type CODCollection struct {
+	ShipmentID      string    `json:"shipment_id"`
+	VendorID        string    `json:"vendor_id"`
+	Status          string    `json:"status"`
+	AmountCents     int64     `json:"amount_cents"`
+	CommissionCents int64     `json:"commission_cents"`
+	ConfirmedBy     string    `json:"confirmed_by"`
+	RecordedAt      time.Time `json:"recorded_at"`
+}
+
+// CODOutcomeInput reports whether the cash for one shipment was collected or
+// the buyer refused the parcel. CommissionCents is the platform's share of
+// the collected cash, which the vendor now holds and owes back. Final is set
+// when no other shipment of the order is still on its way.
+type CODOutcomeInput struct {
+	OrderID         string
+	ShipmentID      string
+	VendorID        string
+	Outcome         string
+	AmountCents     int64
+	CommissionCents int64
+	Final           bool
+	ConfirmedBy     string
+}
+
+// CODSettlement reduces the commission a vendor owes on COD cash, either by
+// withholding it from a Stripe transfer or by a remittance the vendor paid.
+type CODSettlement struct {
+	Kind        string    `json:"kind"`
+	Reference   string    `json:"reference"`
+	AmountCents int64     `json:"amount_cents"`
+	SettledAt   time.Time `json:"settled_at"`
+}
+
+// CODVendorBalance tracks cash-on-delivery money held by one vendor in one
+// currency. CollectedCents is the cash the vendor took at the door and
+// CommissionCents the platform's share of it; OutstandingCents is what is
+// still owed after offsets and remittances.
+type CODVendorBalance struct {
+	VendorID         string          `json:"vendor_id"`
+	Currency         string          `json:"currency"`
+	CollectedCents   int64           `json:"collected_cents"`
+	CommissionCents  int64           `json:"commission_cents"`
+	OffsetCents      int64           `json:"offset_cents"`
+	RemittedCents    int64           `json:"remitted_cents"`
+	OutstandingCents int64           `json:"outstanding_cents"`
+	Settlements      []CODSettlement `json:"settlements"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// CODBuyerFlag is a buyer who refused cash-on-delivery orders. Flagged buyers
+// reached the refusal limit and can no longer choose COD.
+type CODBuyerFlag struct {
+	BuyerRef  string     `json:"buyer_ref"`
+	Refusals  int        `json:"refusals"`
+	OrderIDs  []string   `json:"order_ids"`
+	Flagged   bool       `json:"flagged"`
+	FlaggedAt *time.Time `json:"flagged_at,omitempty"`
+}
+
+// RecordCODOutcome records the collection or refusal of one COD shipment.
+// Collected cash is added to the vendor's COD balance; a refusal counts
+// against the buyer. Once the last shipment is resolved the payment becomes
+// collected, marking the order paid, or refused when no cash came in at all.
+// Repeating an outcome is a no-op.
+func (s *Service) RecordCODOutcome(input CODOutcomeInput) (CODPayment, error) {
+	orderID := strings.TrimSpace(input.OrderID)
+	shipmentID := strings.TrimSpace(input.ShipmentID)
+	if orderID == "" || shipmentID == "" {
+		return CODPayment{}, errCODCollectionIncomplete
+	}
+	switch input.Outcome {
+	case PaymentStatusCollected:
+		if input.AmountCents <= 0 || input.CommissionCents < 0 || input.CommissionCents > input.AmountCents {
+			return CODPayment{}, ErrInvalidCODOutcome
+		}
+	case PaymentStatusRefused:
+	default:
+		return CODPayment{}, ErrInvalidCODOutcome
+	}
+
+	s.mu.Lock()
+	paymentID, exists := s.codByOrderID[orderID]
+	if !exists {
+		s.mu.Unlock()
+		return CODPayment{}, ErrPaymentNotFound
+	}
+	payment := s.codPaymentsByID[paymentID]
+	for _, collection := range payment.Collections {
+		if collection.ShipmentID != shipmentID {
+			continue
+		}
+		s.mu.Unlock()
+		if collection.Status != input.Outcome {
+			return payment, ErrCODOutcomeConflict
+		}
+		return payment, nil
+	}
+
+	now := s.now()
+	collection := CODCollection{
+		ShipmentID:  shipmentID,
+		VendorID:    strings.TrimSpace(input.VendorID),
+		Status:      input.Outcome,
+		ConfirmedBy: strings.TrimSpace(input.ConfirmedBy),
+		RecordedAt:  now,
+	}
+	if input.Outcome == PaymentStatusCollected {
+		collection.AmountCents = input.AmountCents
+		collection.CommissionCents = input.CommissionCents
+		payment.CollectedCents += input.AmountCents
+		s.creditCODBalanceLocked(collection, payment.Currency, now)
+	} else {
+		s.recordCODRefusalLocked(payment, now)
+	}
+	payment.Collections = append(append([]CODCollection(nil), payment.Collections...), collection)
+	payment.UpdatedAt = now
+
+	var markOrder func(orderID string) bool
+	if input.Final || payment.Status != PaymentStatusPendingCollection {
+		next := PaymentStatusRefused
+		if payment.CollectedCents > 0 {
+			next = PaymentStatusCollected
+		}
+		if next != payment.Status {
+			markOrder = s.markOrderFailed
+			if next == PaymentStatusCollected {
+				markOrder = s.markOrderPaid
+			}
+		}
+		payment.Status = next
+	}
+	s.codPaymentsByID[payment.ID] = payment
+	s.mu.Unlock()
+
+	if markOrder != nil && !markOrder(orderID) {
+		return payment, ErrOrderSyncFailed
+	}
+	return payment, nil
+}
+
+// GetCODPayment returns the COD payment for an order.
+func (s *Service) GetCODPayment(orderID string) (CODPayment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paymentID, exists := s.codByOrderID[strings.TrimSpace(orderID)]
+	if !exists {
+		return CODPayment{}, false
+	}
+	return s.codPaymentsByID[paymentID], true
+}
+
+// ListCODBalances returns COD balances, largest amount owed first. An empty
+// vendorID lists every vendor.
+func (s *Service) ListCODBalances(vendorID string) []CODVendorBalance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vendorID = strings.TrimSpace(vendorID)
+	items := make([]CODVendorBalance, 0)
+	for _, balance := range s.codBalances {
+		if vendorID != "" && balance.VendorID != vendorID {
+			continue
+		}
+		items = append(items, balance)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].OutstandingCents != items[j].OutstandingCents {
+			return items[i].OutstandingCents > items[j].OutstandingCents
+		}
+		if items[i].VendorID != items[j].VendorID {
+			return items[i].VendorID < items[j].VendorID
+		}
+		return items[i].Currency < items[j].Currency
+	})
+	return items
+}
+
+// RecordCODRemittance records commission a vendor paid back for COD cash
+// they hold. Repeating a reference is a no-op.
+func (s *Service) RecordCODRemittance(vendorID, currency string, amountCents int64, reference string) (CODVendorBalance, error) {
+	vendorID = strings.TrimSpace(vendorID)
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	reference = strings.TrimSpace(reference)
+	if vendorID == "" || currency == "" || reference == "" || amountCents <= 0 {
+		return CODVendorBalance{}, ErrInvalidRemittance
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, exists := s.codBalances[codBalanceKey(vendorID, currency)]
+	if !exists {
+		return CODVendorBalance{}, ErrRemittanceExceedsOwed
+	}
+	for _, settlement := range balance.Settlements {
+		if settlement.Kind == CODSettlementRemittance && settlement.Reference == reference {
+			return balance, nil
+		}
+	}
+	if amountCents > balance.OutstandingCents {
+		return balance, ErrRemittanceExceedsOwed
+	}
+
+	now := s.now()
+	balance.RemittedCents += amountCents
+	balance.Settlements = append(append([]CODSettlement(nil), balance.Settlements...), CODSettlement{
+		Kind:        CODSettlementRemittance,
+		Reference:   reference,
+		AmountCents: amountCents,
+		SettledAt:   now,
+	})
+	s.storeCODBalanceLocked(balance, now)
+	return s.codBalances[codBalanceKey(vendorID, currency)], nil
+}
+
+// ListCODBuyerFlags returns buyers who refused COD orders, flagged buyers
+// first.
+func (s *Service) ListCODBuyerFlags() []CODBuyerFlag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]CODBuyerFlag, 0, len(s.codRefusals))
+	for buyerRef := range s.codRefusals {
+		items = append(items, s.codBuyerFlagLocked(buyerRef))
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Flagged != items[j].Flagged {
+			return items[i].Flagged
+		}
+		if items[i].Refusals != items[j].Refusals {
+			return items[i].Refusals > items[j].Refusals
+		}
+		return items[i].BuyerRef < items[j].BuyerRef
+	})
+	return items
+}
+
+// ClearCODBuyerFlag forgets a buyer's refusals so they can use COD again.
+func (s *Service) ClearCODBuyerFlag(buyerRef string) (CODBuyerFlag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buyerRef = strings.TrimSpace(buyerRef)
+	if _, exists := s.codRefusals[buyerRef]; !exists {
+		return CODBuyerFlag{}, ErrCODBuyerFlagNotFound
+	}
+	flag := s.codBuyerFlagLocked(buyerRef)
+	delete(s.codRefusals, buyerRef)
+	return flag, nil
+}
+
+func (s *Service) creditCODBalanceLocked(collection CODCollection, currency string, now time.Time) {
+	key := codBalanceKey(collection.VendorID, currency)
+	balance, exists := s.codBalances[key]
+	if !exists {
+		balance = CODVendorBalance{
+			VendorID:    collection.VendorID,
+			Currency:    strings.ToUpper(strings.TrimSpace(currency)),
+			Settlements: []CODSettlement{},
+		}
+	}
+	balance.CollectedCents += collection.AmountCents
+	balance.CommissionCents += collection.CommissionCents
+	s.storeCODBalanceLocked(balance, now)
+}
+
+// offsetCODCommissionLocked withholds commission the vendor owes on COD cash
+// from a freshly queued transfer in the same currency.
+func (s *Service) offsetCODCommissionLocked(payment *StripeIntent, shipmentID string) {
+	index := transferIndex(*payment, shipmentID)
+	if index < 0 {
+		return
+	}
+	transfer := payment.Transfers[index]
+	balance, exists := s.codBalances[codBalanceKey(transfer.VendorID, payment.Currency)]
+	if !exists || balance.OutstandingCents <= 0 {
+		return
+	}
+	offset := balance.OutstandingCents
+	if available := transfer.payableCents(); offset > available {
+		offset = available
+	}
+	if offset <= 0 {
+		return
+	}
+
+	payment.Transfers[index].CODOffsetCents += offset
+	balance.OffsetCents += offset
+	balance.Settlements = append(append([]CODSettlement(nil), balance.Settlements...), CODSettlement{
+		Kind:        CODSettlementOffset,
+		Reference:   shipmentID,
+		AmountCents: offset,
+		SettledAt:   payment.UpdatedAt,
+	})
+	s.storeCODBalanceLocked(balance, payment.UpdatedAt)
+}
+
+func (s *Service) storeCODBalanceLocked(balance CODVendorBalance, now time.Time) {
+	balance.OutstandingCents = balance.CommissionCents - balance.OffsetCents - balance.RemittedCents
+	balance.UpdatedAt = now
+	s.codBalances[codBalanceKey(balance.VendorID, balance.Currency)] = balance
+}
+
+func (s *Service) recordCODRefusalLocked(payment CODPayment, now time.Time) {
+	if payment.buyerRef == "" {
+		return
+	}
+	refusals, exists := s.codRefusals[payment.buyerRef]
+	if !exists {
+		refusals = make(map[string]time.Time)
+		s.codRefusals[payment.buyerRef] = refusals
+	}
+	if _, counted := refusals[payment.OrderID]; !counted {
+		refusals[payment.OrderID] = now
+	}
+}
+
+func (s *Service) codBuyerFlaggedLocked(buyerRef string) bool {
+	return buyerRef != "" && len(s.codRefusals[buyerRef]) >= s.codRefusalLimit
+}
+
+func (s *Service) codBuyerFlagLocked(buyerRef string) CODBuyerFlag {
+	refusals := s.codRefusals[buyerRef]
+	flag := CODBuyerFlag{
+		BuyerRef: buyerRef,
+		Refusals: len(refusals),
+		OrderIDs: make([]string, 0, len(refusals)),
+		Flagged:  len(refusals) >= s.codRefusalLimit,
+	}
+	times := make([]time.Time, 0, len(refusals))
+	for orderID, refusedAt := range refusals {
+		flag.OrderIDs = append(flag.OrderIDs, orderID)
+		times = append(times, refusedAt)
+	}
+	sort.Strings(flag.OrderIDs)
+	if flag.Flagged {
+		// The flag went up with the refusal that reached the limit.
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		flaggedAt := times[s.codRefusalLimit-1]
+		flag.FlaggedAt = &flaggedAt
+	}
+	return flag
+}
+
+// codBuyerRef identifies the buyer behind an order: the user when signed in,
+// otherwise the guest checkout token.
+func codBuyerRef(order commerce.Order) string {
+	if userID := strings.TrimSpace(order.BuyerUserID); userID != "" {
+		return "usr:" + userID
+	}
+	if guestToken := strings.TrimSpace(order.GuestToken); guestToken != "" {
+		return "gst:" + guestToken
+	}
+	return ""
+}
+
+func codBalanceKey(vendorID, currency string) string {
+	return strings.TrimSpace(vendorID) + "::" + strings.ToUpper(strings.TrimSpace(currency))
+}
@@ -0,0 +1,157 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestCODOutcomesSettlePaymentAndTrackVendorCash(t *testing.T) {
+	paid := make(map[string]bool)
+	failed := make(map[string]bool)
+	svc := NewService(Config{
+		MarkOrderPaid:          func(orderID string) bool { paid[orderID] = true; return true },
+		MarkOrderPaymentFailed: func(orderID string) bool { failed[orderID] = true; return true },
+	})
+
+	payment, err := svc.ConfirmCODPayment(commerce.Order{
+		ID: "ord_cod_split", Status: commerce.OrderStatusPendingPayment, TotalCents: 7000, Currency: "USD", BuyerUserID: "usr_cod",
+	}, "idem-cod-split")
+	if err != nil {
+		t.Fatalf("ConfirmCODPayment() error = %v", err)
+	}
+
+	collected, err := svc.RecordCODOutcome(CODOutcomeInput{
+		OrderID: payment.OrderID, ShipmentID: "shp_a", VendorID: "ven_a", Outcome: PaymentStatusCollected,
+		AmountCents: 4000, CommissionCents: 400, ConfirmedBy: "vendor:usr_vendor_a",
+	})
+	if err != nil {
+		t.Fatalf("RecordCODOutcome() collected error = %v", err)
+	}
+	if collected.Status != PaymentStatusPendingCollection || collected.CollectedCents != 4000 || paid["ord_cod_split"] {
+		t.Fatalf("expected collection pending another shipment, got %+v", collected)
+	}
+	if repeat, err := svc.RecordCODOutcome(CODOutcomeInput{
+		OrderID: payment.OrderID, ShipmentID: "shp_a", VendorID: "ven_a", Outcome: PaymentStatusCollected,
+		AmountCents: 4000, CommissionCents: 400,
+	}); err != nil || repeat.CollectedCents != 4000 {
+		t.Fatalf("expected repeated collection to be a no-op, got %+v err=%v", repeat, err)
+	}
+	if _, err := svc.RecordCODOutcome(CODOutcomeInput{
+		OrderID: payment.OrderID, ShipmentID: "shp_a", VendorID: "ven_a", Outcome: PaymentStatusRefused,
+	}); !errors.Is(err, ErrCODOutcomeConflict) {
+		t.Fatalf("expected ErrCODOutcomeConflict, got %v", err)
+	}
+
+	settled, err := svc.RecordCODOutcome(CODOutcomeInput{
+		OrderID: payment.OrderID, ShipmentID: "shp_b", VendorID: "ven_b", Outcome: PaymentStatusRefused, Final: true,
+	})
+	if err != nil {
+		t.Fatalf("RecordCODOutcome() refused error = %v", err)
+	}
+	if settled.Status != PaymentStatusCollected || len(settled.Collections) != 2 || !paid["ord_cod_split"] || failed["ord_cod_split"] {
+		t.Fatalf("expected partially refused order collected and paid, got %+v paid=%v failed=%v", settled, paid, failed)
+	}
+
+	balances := svc.ListCODBalances("ven_a")
+	if len(balances) != 1 || balances[0].CollectedCents != 4000 || balances[0].OutstandingCents != 400 {
+		t.Fatalf("expected vendor holding 4000 and owing 400, got %+v", balances)
+	}
+	if _, err := svc.RecordCODRemittance("ven_a", "usd", 500, "bank-001"); !errors.Is(err, ErrRemittanceExceedsOwed) {
+		t.Fatalf("expected ErrRemittanceExceedsOwed, got %v", err)
+	}
+	if _, err := svc.RecordCODRemittance("ven_a", "usd", 150, ""); !errors.Is(err, ErrInvalidRemittance) {
+		t.Fatalf("expected ErrInvalidRemittance, got %v", err)
+	}
+	balance, err := svc.RecordCODRemittance("ven_a", "usd", 150, "bank-001")
+	if err != nil {
+		t.Fatalf("RecordCODRemittance() error = %v", err)
+	}
+	if repeat, _ := svc.RecordCODRemittance("ven_a", "usd", 150, "bank-001"); balance.OutstandingCents != 250 || repeat.RemittedCents != 150 {
+		t.Fatalf("expected one remittance of 150, got %+v then %+v", balance, repeat)
+	}
+}
+
+func TestCODRefusalsFlagBuyerAndOffsetAgainstTransfers(t *testing.T) {
+	client := NewMockStripeClient()
+	failed := make(map[string]bool)
+	svc := NewService(Config{
+		WebhookSecret:          "whsec_test_secret",
+		StripeClient:           client,
+		MarkOrderPaid:          func(string) bool { return true },
+		MarkOrderPaymentFailed: func(orderID string) bool { failed[orderID] = true; return true },
+	})
+	ctx := context.Background()
+
+	for _, orderID := range []string{"ord_refused_1", "ord_refused_2"} {
+		if _, err := svc.ConfirmCODPayment(commerce.Order{
+			ID: orderID, Status: commerce.OrderStatusPendingPayment, TotalCents: 2000, Currency: "USD", GuestToken: "gst_refuser",
+		}, "idem-"+orderID); err != nil {
+			t.Fatalf("ConfirmCODPayment() error = %v", err)
+		}
+		refused, err := svc.RecordCODOutcome(CODOutcomeInput{
+			OrderID: orderID, ShipmentID: "shp_" + orderID, VendorID: "ven_cod", Outcome: PaymentStatusRefused, Final: true,
+		})
+		if err != nil || refused.Status != PaymentStatusRefused || !failed[orderID] {
+			t.Fatalf("expected refused payment and failed order, got %+v err=%v", refused, err)
+		}
+	}
+	if _, err := svc.ConfirmCODPayment(commerce.Order{
+		ID: "ord_refused_3", Status: commerce.OrderStatusPendingPayment, TotalCents: 2000, Currency: "USD", GuestToken: "gst_refuser",
+	}, "idem-ord_refused_3"); !errors.Is(err, ErrCODBuyerFlagged) {
+		t.Fatalf("expected ErrCODBuyerFlagged, got %v", err)
+	}
+	flags := svc.ListCODBuyerFlags()
+	if len(flags) != 1 || !flags[0].Flagged || flags[0].Refusals != 2 || flags[0].FlaggedAt == nil {
+		t.Fatalf("expected one flagged buyer, got %+v", flags)
+	}
+	if _, err := svc.ClearCODBuyerFlag(flags[0].BuyerRef); err != nil {
+		t.Fatalf("ClearCODBuyerFlag() error = %v", err)
+	}
+	if _, err := svc.ConfirmCODPayment(commerce.Order{
+		ID: "ord_refused_3", Status: commerce.OrderStatusPendingPayment, TotalCents: 2000, Currency: "USD", GuestToken: "gst_refuser",
+	}, "idem-ord_refused_3"); err != nil {
+		t.Fatalf("expected cleared buyer to use COD again, got %v", err)
+	}
+
+	if _, err := svc.RecordCODOutcome(CODOutcomeInput{
+		OrderID: "ord_refused_3", ShipmentID: "shp_cash", VendorID: "ven_cod", Outcome: PaymentStatusCollected,
+		AmountCents: 2000, CommissionCents: 300, Final: true,
+	}); err != nil {
+		t.Fatalf("RecordCODOutcome() collected error = %v", err)
+	}
+	onboarding, err := svc.StartConnectOnboarding(ctx, ConnectOnboardingInput{
+		VendorID:   "ven_cod",
+		RefreshURL: "https://vendor.example.com/payouts/refresh",
+		ReturnURL:  "https://vendor.example.com/payouts/done",
+	})
+	if err != nil {
+		t.Fatalf("StartConnectOnboarding() error = %v", err)
+	}
+	intent, err := svc.CreateStripeIntent(ctx, commerce.Order{
+		ID: "ord_card", Status: commerce.OrderStatusPendingPayment, TotalCents: 5000, Currency: "USD",
+	}, "idem-card")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_cod_offset_auth", "payment_intent.amount_capturable_updated", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() error = %v", err)
+	}
+
+	captured, err := svc.CaptureShipment(ctx, CaptureShipmentInput{
+		OrderID: "ord_card", ShipmentID: "shp_card", AmountCents: 5000, Final: true,
+		VendorID: "ven_cod", Destination: onboarding.AccountID, ApplicationFeeCents: 500,
+	})
+	if err != nil {
+		t.Fatalf("CaptureShipment() error = %v", err)
+	}
+	if transfer := captured.Transfers[0]; transfer.CODOffsetCents != 300 || client.TransferredCents(onboarding.AccountID) != 4200 {
+		t.Fatalf("expected COD commission withheld from the transfer, got %+v", transfer)
+	}
+	if balance := svc.ListCODBalances("ven_cod")[0]; balance.OutstandingCents != 0 || balance.OffsetCents != 300 {
+		t.Fatalf("expected the COD balance settled by offset, got %+v", balance)
+	}
+}
@@ -0,0 +1,433 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TransferStatusPending  = "pending"
+	TransferStatusPaid     = "paid"
+	TransferStatusFailed   = "failed"
+	TransferStatusReversed = "reversed"
+)
+
+var (
+	ErrConnectOnboardingInput = errors.New("connect onboarding requires a vendor and return urls")
+	ErrTransferPending        = errors.New("vendor transfer is still pending")
+)
+
+// VendorTransfer moves a vendor's share of one shipment capture to the
+// vendor's connected account. The platform commission is withheld as
+// ApplicationFeeCents and never leaves the platform account. HeldCents is
+// kept back while disputes on the shipment are open, and CODOffsetCents
+// recovers commission the vendor owes on cash-on-delivery collections.
+type VendorTransfer struct {
+	OrderID             string             `json:"order_id"`
+	ShipmentID          string             `json:"shipment_id"`
+	VendorID            string             `json:"vendor_id"`
+	Destination         string             `json:"destination"`
+	TransferRef         string             `json:"transfer_ref,omitempty"`
+	Status              string             `json:"status"`
+	AmountCents         int64              `json:"amount_cents"`
+	ApplicationFeeCents int64              `json:"application_fee_cents"`
+	ReversedCents       int64              `json:"reversed_cents"`
+	Reversals           []TransferReversal `json:"reversals"`
+	HeldCents           int64              `json:"held_cents"`
+	Holds               []PayoutHold       `json:"holds"`
+	CODOffsetCents      int64              `json:"cod_offset_cents"`
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
+}
+
+// payableCents is what the vendor receives from the transfer after
+// reversals, dispute holds and COD offsets.
+func (t VendorTransfer) payableCents() int64 {
+	return t.AmountCents - t.ReversedCents - t.HeldCents - t.CODOffsetCents
+}
+
+// TransferReversal is the vendor's share of one refund pulled back from a
+// transfer. Reversals recorded before the transfer went out have no
+// ReversalRef; they shrink the transfer instead.
+type TransferReversal struct {
+	Reference   string    `json:"reference"`
+	ReversalRef string    `json:"reversal_ref,omitempty"`
+	AmountCents int64     `json:"amount_cents"`
+	ReversedAt  time.Time `json:"reversed_at"`
+}
+
+// ConnectOnboardingInput starts or resumes Connect onboarding for a vendor.
+// AccountID is the vendor's existing connected account, if any.
+type ConnectOnboardingInput struct {
+	VendorID   string
+	Email      string
+	AccountID  string
+	RefreshURL string
+	ReturnURL  string
+}
+
+type ConnectOnboarding struct {
+	AccountID     string `json:"stripe_account_id"`
+	OnboardingURL string `json:"onboarding_url"`
+}
+
+// ShipmentRefundInput reverses the vendor's share of a refund on a shipment.
+// Reference identifies the refund so repeated calls reverse once.
+type ShipmentRefundInput struct {
+	OrderID     string
+	ShipmentID  string
+	AmountCents int64
+	Reference   string
+}
+
+// StartConnectOnboarding creates the vendor's connected account when it has
+// none and returns a hosted onboarding link for it.
+func (s *Service) StartConnectOnboarding(ctx context.Context, input ConnectOnboardingInput) (ConnectOnboarding, error) {
+	vendorID := strings.TrimSpace(input.VendorID)
+	if vendorID == "" || strings.TrimSpace(input.RefreshURL) == "" || strings.TrimSpace(input.ReturnURL) == "" {
+		return ConnectOnboarding{}, ErrConnectOnboardingInput
+	}
+
+	accountID := strings.TrimSpace(input.AccountID)
+	if accountID == "" {
+		created, err := s.stripeClient.CreateConnectedAccount(ctx, ConnectedAccountInput{
+			VendorID:       vendorID,
+			Email:          input.Email,
+			IdempotencyKey: "connect_" + vendorID,
+		})
+		if err != nil {
+			return ConnectOnboarding{}, err
+		}
+		accountID = strings.TrimSpace(created)
+		if accountID == "" {
+			return ConnectOnboarding{}, ErrInvalidPayload
+		}
+	}
+
+	url, err := s.stripeClient.CreateAccountLink(ctx, AccountLinkInput{
+		AccountID:  accountID,
+		RefreshURL: input.RefreshURL,
+		ReturnURL:  input.ReturnURL,
+	})
+	if err != nil {
+		return ConnectOnboarding{AccountID: accountID}, err
+	}
+
+	return ConnectOnboarding{AccountID: accountID, OnboardingURL: url}, nil
+}
+
+// ConnectedAccount fetches the onboarding state of a connected account.
+func (s *Service) ConnectedAccount(ctx context.Context, accountID string) (ConnectedAccountStatus, error) {
+	accountID = strings.TrimSpace(accountID)
+	if accountID == "" {
+		return ConnectedAccountStatus{}, ErrConnectedAccountNotFound
+	}
+	return s.stripeClient.GetConnectedAccount(ctx, accountID)
+}
+
+// ListVendorTransfers returns the transfers made to one vendor, newest first.
+func (s *Service) ListVendorTransfers(vendorID string) []VendorTransfer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vendorID = strings.TrimSpace(vendorID)
+	items := make([]VendorTransfer, 0)
+	for _, payment := range s.paymentsByID {
+		for _, transfer := range payment.Transfers {
+			if transfer.VendorID == vendorID {
+				items = append(items, transfer)
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ShipmentID < items[j].ShipmentID
+	})
+	return items
+}
+
+// RetryVendorTransfers sends transfers that failed earlier and reports how
+// many went through. It also places dispute holds whose reversal failed after
+// their transfer went out.
+func (s *Service) RetryVendorTransfers(ctx context.Context) int {
+	type pendingTransfer struct {
+		paymentID  string
+		shipmentID string
+	}
+
+	s.mu.Lock()
+	due := make([]pendingTransfer, 0)
+	late := make([]pendingTransfer, 0)
+	for _, payment := range s.paymentsByID {
+		for _, transfer := range payment.Transfers {
+			switch {
+			case transfer.Status == TransferStatusFailed:
+				due = append(due, pendingTransfer{paymentID: payment.ID, shipmentID: transfer.ShipmentID})
+			case transfer.TransferRef != "" && len(waitingHoldsFor(payment, transfer.ShipmentID)) > 0:
+				late = append(late, pendingTransfer{paymentID: payment.ID, shipmentID: transfer.ShipmentID})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	sent := 0
+	for _, item := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := s.sendVendorTransfer(ctx, item.paymentID, item.shipmentID); err == nil {
+			sent++
+		}
+	}
+	for _, item := range late {
+		if ctx.Err() != nil {
+			break
+		}
+		s.placeLateHolds(ctx, item.paymentID, item.shipmentID)
+	}
+	return sent
+}
+
+// ReverseShipmentTransfer pulls the vendor's share of a refund back from the
+// shipment's transfer. The share is proportional to the transfer, so the
+// platform gives up the matching part of its application fee.
+func (s *Service) ReverseShipmentTransfer(ctx context.Context, input ShipmentRefundInput) (StripeIntent, error) {
+	orderID := strings.TrimSpace(input.OrderID)
+	shipmentID := strings.TrimSpace(input.ShipmentID)
+	reference := strings.TrimSpace(input.Reference)
+	if orderID == "" || shipmentID == "" || reference == "" || input.AmountCents <= 0 {
+		return StripeIntent{}, ErrInvalidOrder
+	}
+
+	s.mu.Lock()
+	paymentID, exists := s.orderToPaymentID[orderID]
+	if !exists {
+		s.mu.Unlock()
+		return StripeIntent{}, ErrPaymentNotFound
+	}
+	payment := s.paymentsByID[paymentID]
+	index := transferIndex(payment, shipmentID)
+	if index < 0 {
+		s.mu.Unlock()
+		return payment, ErrTransferNotFound
+	}
+	transfer := payment.Transfers[index]
+	if hasTransferReversal(transfer, reference) {
+		s.mu.Unlock()
+		return payment, nil
+	}
+	if transfer.Status == TransferStatusPending {
+		s.mu.Unlock()
+		return payment, ErrTransferPending
+	}
+
+	grossCents := transfer.AmountCents + transfer.ApplicationFeeCents
+	amount := input.AmountCents * transfer.AmountCents / grossCents
+	if remaining := transfer.payableCents(); amount > remaining {
+		amount = remaining
+	}
+	if amount <= 0 {
+		s.mu.Unlock()
+		return payment, nil
+	}
+	if transfer.TransferRef == "" {
+		// Nothing went out yet; shrink what the retry will send.
+		s.applyTransferReversalLocked(&payment, index, TransferReversal{Reference: reference, AmountCents: amount})
+		s.mu.Unlock()
+		return payment, nil
+	}
+	s.mu.Unlock()
+
+	reversalRef, err := s.stripeClient.ReverseTransfer(ctx, ReverseTransferInput{
+		TransferRef:    transfer.TransferRef,
+		AmountCents:    amount,
+		IdempotencyKey: "reverse_" + transfer.TransferRef + "_" + reference,
+	})
+	if err != nil {
+		return payment, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.paymentsByID[paymentID]
+	if hasTransferReversal(payment.Transfers[index], reference) {
+		return payment, nil
+	}
+	s.applyTransferReversalLocked(&payment, index, TransferReversal{
+		Reference:   reference,
+		ReversalRef: strings.TrimSpace(reversalRef),
+		AmountCents: amount,
+	})
+
+	return payment, nil
+}
+
+func (s *Service) applyTransferReversalLocked(payment *StripeIntent, index int, reversal TransferReversal) {
+	now := s.now()
+	reversal.ReversedAt = now
+	payment.Transfers = append([]VendorTransfer(nil), payment.Transfers...)
+	transfer := &payment.Transfers[index]
+	transfer.Reversals = append(transfer.Reversals, reversal)
+	transfer.ReversedCents += reversal.AmountCents
+	if transfer.ReversedCents >= transfer.AmountCents {
+		transfer.Status = TransferStatusReversed
+	}
+	transfer.UpdatedAt = now
+	payment.UpdatedAt = now
+	s.refreshTransferAttentionLocked(payment)
+	s.paymentsByID[payment.ID] = *payment
+}
+
+// queueVendorTransfer records a pending transfer for a fresh shipment capture
+// when the vendor has a connected account. It reports whether one was queued.
+func queueVendorTransfer(payment *StripeIntent, input CaptureShipmentInput, capturedCents int64) bool {
+	destination := strings.TrimSpace(input.Destination)
+	if destination == "" || transferIndex(*payment, input.ShipmentID) >= 0 {
+		return false
+	}
+	fee := input.ApplicationFeeCents
+	if fee < 0 {
+		fee = 0
+	}
+	if fee > capturedCents {
+		fee = capturedCents
+	}
+	if capturedCents-fee <= 0 {
+		return false
+	}
+
+	payment.Transfers = append(payment.Transfers, VendorTransfer{
+		OrderID:             payment.OrderID,
+		ShipmentID:          strings.TrimSpace(input.ShipmentID),
+		VendorID:            strings.TrimSpace(input.VendorID),
+		Destination:         destination,
+		Status:              TransferStatusPending,
+		AmountCents:         capturedCents - fee,
+		ApplicationFeeCents: fee,
+		Reversals:           []TransferReversal{},
+		Holds:               []PayoutHold{},
+		CreatedAt:           payment.UpdatedAt,
+		UpdatedAt:           payment.UpdatedAt,
+	})
+	return true
+}
+
+// sendVendorTransfer sends a queued or failed transfer, less the dispute
+// holds that were waiting for it. Holds that arrive while it is on its way
+// are reversed once it went out. A failure leaves the capture in place and
+// flags the payment until a retry succeeds.
+func (s *Service) sendVendorTransfer(ctx context.Context, paymentID, shipmentID string) (StripeIntent, error) {
+	s.mu.Lock()
+	payment := s.paymentsByID[paymentID]
+	index := transferIndex(payment, shipmentID)
+	if index < 0 {
+		s.mu.Unlock()
+		return payment, ErrTransferNotFound
+	}
+	if payment.Transfers[index].TransferRef == "" {
+		s.placeWaitingHoldsLocked(&payment, index)
+	}
+	transfer := payment.Transfers[index]
+	amount := transfer.payableCents()
+	if transfer.TransferRef != "" || transfer.Status == TransferStatusReversed || amount <= 0 {
+		s.mu.Unlock()
+		return payment, nil
+	}
+	payment.Transfers = append([]VendorTransfer(nil), payment.Transfers...)
+	payment.Transfers[index].Status = TransferStatusPending
+	s.paymentsByID[paymentID] = payment
+	s.mu.Unlock()
+
+	transferRef, err := s.stripeClient.CreateTransfer(ctx, TransferInput{
+		Destination:    transfer.Destination,
+		AmountCents:    amount,
+		Currency:       payment.Currency,
+		TransferGroup:  payment.OrderID,
+		OrderID:        payment.OrderID,
+		ShipmentID:     shipmentID,
+		IdempotencyKey: "transfer_" + paymentID + "_" + shipmentID,
+	})
+	if err == nil && strings.TrimSpace(transferRef) == "" {
+		err = ErrInvalidPayload
+	}
+
+	s.mu.Lock()
+	payment = s.paymentsByID[paymentID]
+	payment.Transfers = append([]VendorTransfer(nil), payment.Transfers...)
+	current := &payment.Transfers[index]
+	current.UpdatedAt = s.now()
+	if err != nil {
+		current.Status = TransferStatusFailed
+	} else {
+		current.TransferRef = strings.TrimSpace(transferRef)
+		current.Status = TransferStatusPaid
+	}
+	payment.UpdatedAt = current.UpdatedAt
+	s.refreshTransferAttentionLocked(&payment)
+	s.paymentsByID[paymentID] = payment
+	s.mu.Unlock()
+	if err != nil {
+		// The retry places waiting holds before sending again.
+		return payment, err
+	}
+
+	return s.placeLateHolds(ctx, paymentID, shipmentID), nil
+}
+
+// placeLateHolds reverses the dispute holds that were waiting while the
+// shipment's transfer was on its way. A failed reversal stays waiting for the
+// transfer retry loop.
+func (s *Service) placeLateHolds(ctx context.Context, paymentID, shipmentID string) StripeIntent {
+	s.mu.Lock()
+	payment := s.paymentsByID[paymentID]
+	late := waitingHoldsFor(payment, shipmentID)
+	s.mu.Unlock()
+
+	for _, hold := range late {
+		if updated, err := s.HoldShipmentPayout(ctx, hold); err == nil {
+			payment = updated
+		}
+	}
+	return payment
+}
+
+// refreshTransferAttentionLocked flags the payment while any transfer has
+// failed, without overriding authorization or capture problems.
+func (s *Service) refreshTransferAttentionLocked(payment *StripeIntent) {
+	failed := false
+	for _, transfer := range payment.Transfers {
+		if transfer.Status == TransferStatusFailed {
+			failed = true
+			break
+		}
+	}
+	switch {
+	case failed && payment.Attention == "":
+		payment.Attention = AttentionTransferFailed
+	case !failed && payment.Attention == AttentionTransferFailed:
+		payment.Attention = ""
+	}
+}
+
+func transferIndex(payment StripeIntent, shipmentID string) int {
+	for index, transfer := range payment.Transfers {
+		if transfer.ShipmentID == strings.TrimSpace(shipmentID) {
+			return index
+		}
+	}
+	return -1
+}
+
+func hasTransferReversal(transfer VendorTransfer, reference string) bool {
+	for _, reversal := range transfer.Reversals {
+		if reversal.Reference == reference {
+			return true
+		}
+	}
+	return false
+}
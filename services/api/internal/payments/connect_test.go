@@ -0,0 +1,238 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+type failingTransferClient struct {
+	*MockStripeClient
+	fail bool
+}
+
+func (c *failingTransferClient) CreateTransfer(ctx context.Context, input TransferInput) (string, error) {
+	if c.fail {
+		return "", errors.New("destination account restricted")
+	}
+	return c.MockStripeClient.CreateTransfer(ctx, input)
+}
+
+func TestCaptureShipmentTransfersVendorShareAndReversesRefunds(t *testing.T) {
+	client := &failingTransferClient{MockStripeClient: NewMockStripeClient()}
+	svc := NewService(Config{
+		WebhookSecret: "whsec_test_secret",
+		StripeClient:  client,
+		MarkOrderPaid: func(string) bool { return true },
+	})
+
+	if _, err := svc.StartConnectOnboarding(context.Background(), ConnectOnboardingInput{VendorID: "ven_a"}); !errors.Is(err, ErrConnectOnboardingInput) {
+		t.Fatalf("expected ErrConnectOnboardingInput, got %v", err)
+	}
+	onboarding, err := svc.StartConnectOnboarding(context.Background(), ConnectOnboardingInput{
+		VendorID:   "ven_a",
+		RefreshURL: "https://vendor.example.com/payouts/refresh",
+		ReturnURL:  "https://vendor.example.com/payouts/done",
+	})
+	if err != nil {
+		t.Fatalf("StartConnectOnboarding() error = %v", err)
+	}
+	if onboarding.AccountID == "" || onboarding.OnboardingURL == "" {
+		t.Fatalf("expected account and onboarding link, got %+v", onboarding)
+	}
+	status, err := svc.ConnectedAccount(context.Background(), onboarding.AccountID)
+	if err != nil || !status.PayoutsEnabled {
+		t.Fatalf("expected payouts enabled, got %+v err=%v", status, err)
+	}
+
+	order := commerce.Order{
+		ID:         "ord_test_connect",
+		Status:     commerce.OrderStatusPendingPayment,
+		TotalCents: 10000,
+		Currency:   "USD",
+	}
+	intent, err := svc.CreateStripeIntent(context.Background(), order, "idem-connect")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_connect_auth", "payment_intent.amount_capturable_updated", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() error = %v", err)
+	}
+
+	captured, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID:             order.ID,
+		ShipmentID:          "shp_a",
+		AmountCents:         6000,
+		VendorID:            "ven_a",
+		Destination:         onboarding.AccountID,
+		ApplicationFeeCents: 600,
+	})
+	if err != nil {
+		t.Fatalf("CaptureShipment() error = %v", err)
+	}
+	if len(captured.Transfers) != 1 {
+		t.Fatalf("expected one transfer, got %+v", captured.Transfers)
+	}
+	transfer := captured.Transfers[0]
+	if transfer.Status != TransferStatusPaid || transfer.AmountCents != 5400 || transfer.ApplicationFeeCents != 600 || transfer.TransferRef == "" {
+		t.Fatalf("expected 5400 transferred with 600 fee withheld, got %+v", transfer)
+	}
+	if got := client.TransferredCents(onboarding.AccountID); got != 5400 {
+		t.Fatalf("expected connected account to hold 5400, got %d", got)
+	}
+
+	refund := ShipmentRefundInput{OrderID: order.ID, ShipmentID: "shp_a", AmountCents: 2000, Reference: "rfr_a"}
+	reversed, err := svc.ReverseShipmentTransfer(context.Background(), refund)
+	if err != nil {
+		t.Fatalf("ReverseShipmentTransfer() error = %v", err)
+	}
+	if _, err := svc.ReverseShipmentTransfer(context.Background(), refund); err != nil {
+		t.Fatalf("ReverseShipmentTransfer() repeat error = %v", err)
+	}
+	if reversed.Transfers[0].ReversedCents != 1800 || client.TransferredCents(onboarding.AccountID) != 3600 {
+		t.Fatalf("expected vendor share 1800 reversed once, got %+v", reversed.Transfers[0])
+	}
+
+	client.fail = true
+	flagged, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID:             order.ID,
+		ShipmentID:          "shp_b",
+		AmountCents:         4000,
+		Final:               true,
+		VendorID:            "ven_a",
+		Destination:         onboarding.AccountID,
+		ApplicationFeeCents: 400,
+	})
+	if err == nil {
+		t.Fatalf("expected transfer failure to be reported")
+	}
+	if flagged.Status != PaymentStatusSuccess || flagged.Attention != AttentionTransferFailed || flagged.Transfers[1].Status != TransferStatusFailed {
+		t.Fatalf("expected capture kept and transfer flagged, got %+v", flagged)
+	}
+	if _, err := svc.ReverseShipmentTransfer(context.Background(), ShipmentRefundInput{
+		OrderID: order.ID, ShipmentID: "shp_b", AmountCents: 1000, Reference: "rfr_b",
+	}); err != nil {
+		t.Fatalf("ReverseShipmentTransfer() before transfer error = %v", err)
+	}
+
+	client.fail = false
+	if sent := svc.RetryVendorTransfers(context.Background()); sent != 1 {
+		t.Fatalf("expected one retried transfer, got %d", sent)
+	}
+	items := svc.ListVendorTransfers("ven_a")
+	if len(items) != 2 {
+		t.Fatalf("expected two vendor transfers, got %+v", items)
+	}
+	if got := client.TransferredCents(onboarding.AccountID); got != 3600+3600-900 {
+		t.Fatalf("expected retried transfer net of pre-transfer refund, got %d", got)
+	}
+	if authorizations := svc.ListAuthorizations(true); len(authorizations) != 0 {
+		t.Fatalf("expected transfer attention cleared, got %+v", authorizations)
+	}
+}
+
+func TestLiveStripeClientConnectCallsAgainstStubServer(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = make(map[string]url.Values)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error = %v", err)
+		}
+		mu.Lock()
+		requests[r.Method+" "+r.URL.Path] = r.PostForm
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/payment_intents":
+			_, _ = w.Write([]byte(`{"id":"pi_stub","object":"payment_intent","client_secret":"pi_stub_secret"}`))
+		case "POST /v1/accounts":
+			_, _ = w.Write([]byte(`{"id":"acct_stub","object":"account"}`))
+		case "POST /v1/account_links":
+			_, _ = w.Write([]byte(`{"object":"account_link","url":"https://connect.stripe.com/setup/e/acct_stub"}`))
+		case "GET /v1/accounts/acct_stub":
+			_, _ = w.Write([]byte(`{"id":"acct_stub","object":"account","details_submitted":true,"charges_enabled":true,"payouts_enabled":true}`))
+		case "POST /v1/transfers":
+			_, _ = w.Write([]byte(`{"id":"tr_stub","object":"transfer"}`))
+		case "POST /v1/disputes/dp_stub":
+			_, _ = w.Write([]byte(`{"id":"dp_stub","object":"dispute"}`))
+		case "POST /v1/transfers/tr_stub/reversals":
+			_, _ = w.Write([]byte(`{"id":"trr_stub","object":"transfer_reversal"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"unexpected request"}}`))
+		}
+	}))
+	defer server.Close()
+
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(server.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+		LeveledLogger:     &stripe.LeveledLogger{Level: stripe.LevelNull},
+	})
+	client := NewLiveStripeClientWithBackend("sk_test_stub", backend)
+	ctx := context.Background()
+
+	if _, err := client.CreatePaymentIntent(ctx, CreateIntentInput{
+		OrderID: "ord_stub", AmountCents: 10000, Currency: "USD", TransferGroup: "ord_stub", IdempotencyKey: "idem-stub",
+	}); err != nil {
+		t.Fatalf("CreatePaymentIntent() error = %v", err)
+	}
+	accountID, err := client.CreateConnectedAccount(ctx, ConnectedAccountInput{VendorID: "ven_stub", IdempotencyKey: "connect_ven_stub"})
+	if err != nil || accountID != "acct_stub" {
+		t.Fatalf("CreateConnectedAccount() = %q, %v", accountID, err)
+	}
+	link, err := client.CreateAccountLink(ctx, AccountLinkInput{
+		AccountID: accountID, RefreshURL: "https://vendor.example.com/refresh", ReturnURL: "https://vendor.example.com/done",
+	})
+	if err != nil || link == "" {
+		t.Fatalf("CreateAccountLink() = %q, %v", link, err)
+	}
+	status, err := client.GetConnectedAccount(ctx, accountID)
+	if err != nil || !status.PayoutsEnabled {
+		t.Fatalf("GetConnectedAccount() = %+v, %v", status, err)
+	}
+	transferRef, err := client.CreateTransfer(ctx, TransferInput{
+		Destination: accountID, AmountCents: 5400, Currency: "USD", TransferGroup: "ord_stub",
+		OrderID: "ord_stub", ShipmentID: "shp_stub", IdempotencyKey: "transfer_stub",
+	})
+	if err != nil || transferRef != "tr_stub" {
+		t.Fatalf("CreateTransfer() = %q, %v", transferRef, err)
+	}
+	if _, err := client.ReverseTransfer(ctx, ReverseTransferInput{TransferRef: transferRef, AmountCents: 1800, IdempotencyKey: "reverse_stub"}); err != nil {
+		t.Fatalf("ReverseTransfer() error = %v", err)
+	}
+	if err := client.UpdateDisputeEvidence(ctx, DisputeEvidenceInput{DisputeRef: "dp_stub", Text: "Delivered 2026-10-02", IdempotencyKey: "evidence_stub"}); err != nil {
+		t.Fatalf("UpdateDisputeEvidence() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := requests["POST /v1/payment_intents"].Get("transfer_group"); got != "ord_stub" {
+		t.Fatalf("expected intent transfer_group ord_stub, got %q", got)
+	}
+	if got := requests["POST /v1/accounts"].Get("type"); got != "express" {
+		t.Fatalf("expected express account, got %q", got)
+	}
+	transferForm := requests["POST /v1/transfers"]
+	if transferForm.Get("destination") != "acct_stub" || transferForm.Get("amount") != "5400" || transferForm.Get("transfer_group") != "ord_stub" {
+		t.Fatalf("unexpected transfer params %v", transferForm)
+	}
+	if got := requests["POST /v1/transfers/tr_stub/reversals"].Get("amount"); got != "1800" {
+		t.Fatalf("expected reversal of 1800, got %q", got)
+	}
+	disputeForm := requests["POST /v1/disputes/dp_stub"]
+	if disputeForm.Get("evidence[uncategorized_text]") != "Delivered 2026-10-02" || disputeForm.Get("submit") != "false" {
+		t.Fatalf("unexpected dispute params %v", disputeForm)
+	}
+}
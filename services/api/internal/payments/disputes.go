@@ -0,0 +1,423 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	DisputeEventCreated = "created"
+	DisputeEventUpdated = "updated"
+	DisputeEventClosed  = "closed"
+
+	PayoutHoldStatusHeld      = "held"
+	PayoutHoldStatusReleased  = "released"
+	PayoutHoldStatusForfeited = "forfeited"
+)
+
+var ErrDisputeEvidence = errors.New("dispute evidence requires a dispute and text")
+
+// DisputeEvent is a Stripe dispute notification matched to the order payment
+// it was raised against. Status and Reason are Stripe's own values.
+type DisputeEvent struct {
+	EventID       string
+	Type          string
+	DisputeRef    string
+	PaymentID     string
+	OrderID       string
+	AmountCents   int64
+	Currency      string
+	Reason        string
+	Status        string
+	EvidenceDueBy *time.Time
+}
+
+// PayoutHold keeps a disputed part of a vendor transfer back until the
+// dispute closes. Holds placed after the transfer went out are reversed from
+// the connected account and carry the ReversalRef.
+type PayoutHold struct {
+	Reference   string     `json:"reference"`
+	Status      string     `json:"status"`
+	AmountCents int64      `json:"amount_cents"`
+	ReversalRef string     `json:"reversal_ref,omitempty"`
+	ReleaseRef  string     `json:"release_ref,omitempty"`
+	HeldAt      time.Time  `json:"held_at"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+}
+
+type stripeWebhookDispute struct {
+	ID              string `json:"id"`
+	Amount          int64  `json:"amount"`
+	Currency        string `json:"currency"`
+	Reason          string `json:"reason"`
+	Status          string `json:"status"`
+	PaymentIntent   string `json:"payment_intent"`
+	EvidenceDetails struct {
+		DueBy int64 `json:"due_by"`
+	} `json:"evidence_details"`
+}
+
+// OnDispute registers the callback that records dispute events. Returning
+// false leaves the event unprocessed so Stripe delivers it again.
+func (s *Service) OnDispute(callback func(event DisputeEvent) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disputeEvent = callback
+}
+
+func (s *Service) applyDisputeEvent(event stripeWebhookEnvelope) (WebhookResult, error) {
+	var object stripeWebhookDispute
+	if err := json.Unmarshal(event.Data.Object, &object); err != nil {
+		return WebhookResult{}, ErrInvalidPayload
+	}
+	disputeRef := strings.TrimSpace(object.ID)
+	providerRef := strings.TrimSpace(object.PaymentIntent)
+	if disputeRef == "" || providerRef == "" {
+		return WebhookResult{}, ErrInvalidPayload
+	}
+
+	s.mu.Lock()
+	paymentID, exists := s.providerToPayment[providerRef]
+	payment := s.paymentsByID[paymentID]
+	callback := s.disputeEvent
+	s.mu.Unlock()
+	if !exists {
+		return WebhookResult{}, ErrPaymentNotFound
+	}
+
+	disputeEvent := DisputeEvent{
+		EventID:     event.ID,
+		Type:        strings.TrimPrefix(event.Type, "charge.dispute."),
+		DisputeRef:  disputeRef,
+		PaymentID:   payment.ID,
+		OrderID:     payment.OrderID,
+		AmountCents: object.Amount,
+		Currency:    strings.ToUpper(strings.TrimSpace(object.Currency)),
+		Reason:      strings.TrimSpace(object.Reason),
+		Status:      strings.TrimSpace(object.Status),
+	}
+	if object.EvidenceDetails.DueBy > 0 {
+		dueBy := time.Unix(object.EvidenceDetails.DueBy, 0).UTC()
+		disputeEvent.EvidenceDueBy = &dueBy
+	}
+	if callback != nil && !callback(disputeEvent) {
+		return WebhookResult{}, ErrOrderSyncFailed
+	}
+
+	return WebhookResult{
+		EventID:       event.ID,
+		Processed:     true,
+		Duplicate:     false,
+		PaymentID:     payment.ID,
+		OrderID:       payment.OrderID,
+		PaymentStatus: payment.Status,
+		DisputeRef:    disputeRef,
+	}, nil
+}
+
+// UpdateDisputeEvidence stages vendor evidence on the Stripe dispute. The
+// text replaces what was staged before, so callers send all of it.
+func (s *Service) UpdateDisputeEvidence(ctx context.Context, disputeRef, text, idempotencyKey string) error {
+	disputeRef = strings.TrimSpace(disputeRef)
+	if disputeRef == "" || strings.TrimSpace(text) == "" {
+		return ErrDisputeEvidence
+	}
+	return s.stripeClient.UpdateDisputeEvidence(ctx, DisputeEvidenceInput{
+		DisputeRef:     disputeRef,
+		Text:           text,
+		IdempotencyKey: strings.TrimSpace(idempotencyKey),
+	})
+}
+
+// HoldShipmentPayout keeps the vendor's share of a disputed amount back from
+// the shipment's transfer. A transfer that already went out is partly
+// reversed; otherwise the held amount is left out when it is sent. A shipment
+// that is not captured yet, or whose transfer is on its way, gets the hold
+// once its transfer is sent. Reference identifies the dispute so repeated
+// calls hold once.
+func (s *Service) HoldShipmentPayout(ctx context.Context, input ShipmentRefundInput) (StripeIntent, error) {
+	orderID := strings.TrimSpace(input.OrderID)
+	shipmentID := strings.TrimSpace(input.ShipmentID)
+	reference := strings.TrimSpace(input.Reference)
+	if orderID == "" || shipmentID == "" || reference == "" || input.AmountCents <= 0 {
+		return StripeIntent{}, ErrInvalidOrder
+	}
+
+	s.mu.Lock()
+	paymentID, exists := s.orderToPaymentID[orderID]
+	if !exists {
+		s.mu.Unlock()
+		return StripeIntent{}, ErrPaymentNotFound
+	}
+	payment := s.paymentsByID[paymentID]
+	index := transferIndex(payment, shipmentID)
+	if index >= 0 && payoutHoldIndex(payment.Transfers[index], reference) >= 0 {
+		s.dropWaitingHoldsLocked(&payment, shipmentID, reference)
+		s.mu.Unlock()
+		return payment, nil
+	}
+	if index < 0 || payment.Transfers[index].Status == TransferStatusPending {
+		s.addWaitingHoldLocked(&payment, ShipmentRefundInput{
+			OrderID:     orderID,
+			ShipmentID:  shipmentID,
+			AmountCents: input.AmountCents,
+			Reference:   reference,
+		})
+		s.mu.Unlock()
+		return payment, nil
+	}
+	transfer := payment.Transfers[index]
+
+	amount := payoutHoldCents(transfer, input.AmountCents)
+	if amount <= 0 {
+		s.dropWaitingHoldsLocked(&payment, shipmentID, reference)
+		s.mu.Unlock()
+		return payment, nil
+	}
+	if transfer.TransferRef == "" {
+		s.applyPayoutHoldLocked(&payment, index, PayoutHold{Reference: reference, AmountCents: amount})
+		s.dropWaitingHoldsLocked(&payment, shipmentID, reference)
+		s.mu.Unlock()
+		return payment, nil
+	}
+	s.mu.Unlock()
+
+	reversalRef, err := s.stripeClient.ReverseTransfer(ctx, ReverseTransferInput{
+		TransferRef:    transfer.TransferRef,
+		AmountCents:    amount,
+		IdempotencyKey: "hold_" + transfer.TransferRef + "_" + reference,
+	})
+	if err != nil {
+		return payment, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.paymentsByID[paymentID]
+	if payoutHoldIndex(payment.Transfers[index], reference) < 0 {
+		s.applyPayoutHoldLocked(&payment, index, PayoutHold{
+			Reference:   reference,
+			AmountCents: amount,
+			ReversalRef: strings.TrimSpace(reversalRef),
+		})
+	}
+	s.dropWaitingHoldsLocked(&payment, shipmentID, reference)
+
+	return payment, nil
+}
+
+// ClosePayoutHolds settles every hold placed for reference on the order. A
+// won dispute releases the held amounts to the vendors, sending them as new
+// transfers where the original already went out, or sending the original
+// when the hold kept all of it back. A lost dispute forfeits them as
+// reversals.
+func (s *Service) ClosePayoutHolds(ctx context.Context, orderID, reference string, won bool) (StripeIntent, error) {
+	orderID = strings.TrimSpace(orderID)
+	reference = strings.TrimSpace(reference)
+	if orderID == "" || reference == "" {
+		return StripeIntent{}, ErrInvalidOrder
+	}
+
+	s.mu.Lock()
+	paymentID, exists := s.orderToPaymentID[orderID]
+	if !exists {
+		s.mu.Unlock()
+		return StripeIntent{}, ErrPaymentNotFound
+	}
+	payment := s.paymentsByID[paymentID]
+	// Holds still waiting for their transfer are simply dropped.
+	s.dropWaitingHoldsLocked(&payment, "", reference)
+	shipmentIDs := make([]string, 0)
+	unsent := make(map[string]bool)
+	for _, transfer := range payment.Transfers {
+		if index := payoutHoldIndex(transfer, reference); index >= 0 && transfer.Holds[index].Status == PayoutHoldStatusHeld {
+			shipmentIDs = append(shipmentIDs, transfer.ShipmentID)
+			// A transfer held in full was never sent, so nothing else
+			// sends it once the hold is released.
+			unsent[transfer.ShipmentID] = transfer.TransferRef == "" && transfer.Status == TransferStatusPending && transfer.payableCents() <= 0
+		}
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, shipmentID := range shipmentIDs {
+		updated, err := s.closePayoutHold(ctx, paymentID, shipmentID, reference, won)
+		if err == nil && won && unsent[shipmentID] {
+			updated, err = s.sendVendorTransfer(ctx, paymentID, shipmentID)
+		}
+		payment = updated
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return payment, firstErr
+}
+
+func (s *Service) closePayoutHold(ctx context.Context, paymentID, shipmentID, reference string, won bool) (StripeIntent, error) {
+	s.mu.Lock()
+	payment := s.paymentsByID[paymentID]
+	index := transferIndex(payment, shipmentID)
+	if index < 0 {
+		s.mu.Unlock()
+		return payment, ErrTransferNotFound
+	}
+	transfer := payment.Transfers[index]
+	holdIndex := payoutHoldIndex(transfer, reference)
+	if holdIndex < 0 || transfer.Holds[holdIndex].Status != PayoutHoldStatusHeld {
+		s.mu.Unlock()
+		return payment, nil
+	}
+	hold := transfer.Holds[holdIndex]
+	if !won || transfer.TransferRef == "" {
+		// Nothing to send back yet; an unsent transfer picks the
+		// released amount up when it goes out.
+		s.closePayoutHoldLocked(&payment, index, holdIndex, won, "")
+		s.mu.Unlock()
+		return payment, nil
+	}
+	s.mu.Unlock()
+
+	releaseRef, err := s.stripeClient.CreateTransfer(ctx, TransferInput{
+		Destination:    transfer.Destination,
+		AmountCents:    hold.AmountCents,
+		Currency:       payment.Currency,
+		TransferGroup:  payment.OrderID,
+		OrderID:        payment.OrderID,
+		ShipmentID:     shipmentID,
+		IdempotencyKey: "release_" + transfer.TransferRef + "_" + reference,
+	})
+	if err != nil {
+		return payment, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.paymentsByID[paymentID]
+	holdIndex = payoutHoldIndex(payment.Transfers[index], reference)
+	if payment.Transfers[index].Holds[holdIndex].Status != PayoutHoldStatusHeld {
+		return payment, nil
+	}
+	s.closePayoutHoldLocked(&payment, index, holdIndex, true, strings.TrimSpace(releaseRef))
+
+	return payment, nil
+}
+
+func (s *Service) applyPayoutHoldLocked(payment *StripeIntent, index int, hold PayoutHold) {
+	now := s.now()
+	hold.Status = PayoutHoldStatusHeld
+	hold.HeldAt = now
+	payment.Transfers = append([]VendorTransfer(nil), payment.Transfers...)
+	transfer := &payment.Transfers[index]
+	transfer.Holds = append(append([]PayoutHold(nil), transfer.Holds...), hold)
+	transfer.HeldCents += hold.AmountCents
+	transfer.UpdatedAt = now
+	payment.UpdatedAt = now
+	s.paymentsByID[payment.ID] = *payment
+}
+
+// closePayoutHoldLocked releases or forfeits one hold. A forfeited hold
+// becomes a reversal, so the vendor's net share stays in ReversedCents.
+func (s *Service) closePayoutHoldLocked(payment *StripeIntent, index, holdIndex int, won bool, releaseRef string) {
+	now := s.now()
+	payment.Transfers = append([]VendorTransfer(nil), payment.Transfers...)
+	transfer := &payment.Transfers[index]
+	transfer.Holds = append([]PayoutHold(nil), transfer.Holds...)
+	hold := &transfer.Holds[holdIndex]
+	hold.ClosedAt = &now
+	hold.ReleaseRef = releaseRef
+	hold.Status = PayoutHoldStatusReleased
+	transfer.HeldCents -= hold.AmountCents
+	if !won {
+		hold.Status = PayoutHoldStatusForfeited
+		transfer.Reversals = append(append([]TransferReversal(nil), transfer.Reversals...), TransferReversal{
+			Reference:   hold.Reference,
+			ReversalRef: hold.ReversalRef,
+			AmountCents: hold.AmountCents,
+			ReversedAt:  now,
+		})
+		transfer.ReversedCents += hold.AmountCents
+		if transfer.ReversedCents >= transfer.AmountCents {
+			transfer.Status = TransferStatusReversed
+		}
+	}
+	transfer.UpdatedAt = now
+	payment.UpdatedAt = now
+	s.paymentsByID[payment.ID] = *payment
+}
+
+// payoutHoldCents is the vendor's part of a disputed amount on a transfer:
+// the same share of it as the transfer is of the captured amount, capped at
+// what the transfer still pays out.
+func payoutHoldCents(transfer VendorTransfer, disputedCents int64) int64 {
+	grossCents := transfer.AmountCents + transfer.ApplicationFeeCents
+	amount := disputedCents * transfer.AmountCents / grossCents
+	if remaining := transfer.payableCents(); amount > remaining {
+		amount = remaining
+	}
+	return amount
+}
+
+func (s *Service) addWaitingHoldLocked(payment *StripeIntent, hold ShipmentRefundInput) {
+	for _, waiting := range payment.waitingHolds {
+		if waiting.ShipmentID == hold.ShipmentID && waiting.Reference == hold.Reference {
+			return
+		}
+	}
+	payment.waitingHolds = append(append([]ShipmentRefundInput(nil), payment.waitingHolds...), hold)
+	s.paymentsByID[payment.ID] = *payment
+}
+
+// dropWaitingHoldsLocked forgets waiting holds for reference, on every
+// shipment when shipmentID is empty.
+func (s *Service) dropWaitingHoldsLocked(payment *StripeIntent, shipmentID, reference string) {
+	kept := make([]ShipmentRefundInput, 0, len(payment.waitingHolds))
+	for _, waiting := range payment.waitingHolds {
+		if waiting.Reference == reference && (shipmentID == "" || waiting.ShipmentID == shipmentID) {
+			continue
+		}
+		kept = append(kept, waiting)
+	}
+	if len(kept) == len(payment.waitingHolds) {
+		return
+	}
+	payment.waitingHolds = kept
+	s.paymentsByID[payment.ID] = *payment
+}
+
+// placeWaitingHoldsLocked holds back the waiting disputed amounts from a
+// transfer that has not gone out, so they are left out when it is sent.
+func (s *Service) placeWaitingHoldsLocked(payment *StripeIntent, index int) {
+	shipmentID := payment.Transfers[index].ShipmentID
+	for _, waiting := range waitingHoldsFor(*payment, shipmentID) {
+		transfer := payment.Transfers[index]
+		if payoutHoldIndex(transfer, waiting.Reference) < 0 {
+			if amount := payoutHoldCents(transfer, waiting.AmountCents); amount > 0 {
+				s.applyPayoutHoldLocked(payment, index, PayoutHold{Reference: waiting.Reference, AmountCents: amount})
+			}
+		}
+		s.dropWaitingHoldsLocked(payment, shipmentID, waiting.Reference)
+	}
+}
+
+func waitingHoldsFor(payment StripeIntent, shipmentID string) []ShipmentRefundInput {
+	items := make([]ShipmentRefundInput, 0)
+	for _, waiting := range payment.waitingHolds {
+		if waiting.ShipmentID == shipmentID {
+			items = append(items, waiting)
+		}
+	}
+	return items
+}
+
+func payoutHoldIndex(transfer VendorTransfer, reference string) int {
+	for index, hold := range transfer.Holds {
+		if hold.Reference == reference {
+			return index
+		}
+	}
+	return -1
+}
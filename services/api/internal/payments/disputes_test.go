@@ -0,0 +1,257 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v83/webhook"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestDisputeWebhookHoldsAndSettlesVendorPayout(t *testing.T) {
+	client := NewMockStripeClient()
+	svc := NewService(Config{
+		WebhookSecret: "whsec_test_secret",
+		StripeClient:  client,
+		MarkOrderPaid: func(string) bool { return true },
+	})
+
+	events := make([]DisputeEvent, 0)
+	accept := false
+	svc.OnDispute(func(event DisputeEvent) bool {
+		if !accept {
+			return false
+		}
+		events = append(events, event)
+		return true
+	})
+
+	onboarding, err := svc.StartConnectOnboarding(context.Background(), ConnectOnboardingInput{
+		VendorID:   "ven_a",
+		RefreshURL: "https://vendor.example.com/payouts/refresh",
+		ReturnURL:  "https://vendor.example.com/payouts/done",
+	})
+	if err != nil {
+		t.Fatalf("StartConnectOnboarding() error = %v", err)
+	}
+	order := commerce.Order{ID: "ord_test_dispute", Status: commerce.OrderStatusPendingPayment, TotalCents: 10000, Currency: "USD"}
+	intent, err := svc.CreateStripeIntent(context.Background(), order, "idem-dispute")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_dispute_auth", "payment_intent.amount_capturable_updated", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() error = %v", err)
+	}
+	if _, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID:             order.ID,
+		ShipmentID:          "shp_a",
+		AmountCents:         6000,
+		VendorID:            "ven_a",
+		Destination:         onboarding.AccountID,
+		ApplicationFeeCents: 600,
+	}); err != nil {
+		t.Fatalf("CaptureShipment() error = %v", err)
+	}
+
+	payload, signature = signedStripeDisputePayload(t, "whsec_test_secret", "evt_dp_1_created", "charge.dispute.created", "dp_1", intent.ProviderRef, 2000, "needs_response")
+	if _, err := svc.HandleStripeWebhook(payload, signature); !errors.Is(err, ErrOrderSyncFailed) {
+		t.Fatalf("expected ErrOrderSyncFailed while dispute is not recorded, got %v", err)
+	}
+	accept = true
+	result, err := svc.HandleStripeWebhook(payload, signature)
+	if err != nil {
+		t.Fatalf("HandleStripeWebhook() redelivery error = %v", err)
+	}
+	if !result.Processed || result.DisputeRef != "dp_1" || result.OrderID != order.ID {
+		t.Fatalf("unexpected dispute webhook result %+v", result)
+	}
+	if len(events) != 1 || events[0].Type != DisputeEventCreated || events[0].AmountCents != 2000 || events[0].EvidenceDueBy == nil {
+		t.Fatalf("unexpected dispute events %+v", events)
+	}
+
+	hold := ShipmentRefundInput{OrderID: order.ID, ShipmentID: "shp_a", AmountCents: 2000, Reference: "dsp_1"}
+	held, err := svc.HoldShipmentPayout(context.Background(), hold)
+	if err != nil {
+		t.Fatalf("HoldShipmentPayout() error = %v", err)
+	}
+	if _, err := svc.HoldShipmentPayout(context.Background(), hold); err != nil {
+		t.Fatalf("HoldShipmentPayout() repeat error = %v", err)
+	}
+	if held.Transfers[0].HeldCents != 1800 || held.Transfers[0].Holds[0].ReversalRef == "" || client.TransferredCents(onboarding.AccountID) != 3600 {
+		t.Fatalf("expected vendor share 1800 held once, got %+v", held.Transfers[0])
+	}
+
+	released, err := svc.ClosePayoutHolds(context.Background(), order.ID, "dsp_1", true)
+	if err != nil {
+		t.Fatalf("ClosePayoutHolds(won) error = %v", err)
+	}
+	releasedHold := released.Transfers[0].Holds[0]
+	if releasedHold.Status != PayoutHoldStatusReleased || releasedHold.ReleaseRef == "" || released.Transfers[0].HeldCents != 0 {
+		t.Fatalf("expected hold released, got %+v", released.Transfers[0])
+	}
+	if got := client.TransferredCents(onboarding.AccountID); got != 5400 {
+		t.Fatalf("expected won dispute to restore 5400, got %d", got)
+	}
+
+	if _, err := svc.HoldShipmentPayout(context.Background(), ShipmentRefundInput{
+		OrderID: order.ID, ShipmentID: "shp_a", AmountCents: 1000, Reference: "dsp_2",
+	}); err != nil {
+		t.Fatalf("HoldShipmentPayout() second dispute error = %v", err)
+	}
+	forfeited, err := svc.ClosePayoutHolds(context.Background(), order.ID, "dsp_2", false)
+	if err != nil {
+		t.Fatalf("ClosePayoutHolds(lost) error = %v", err)
+	}
+	if forfeited.Transfers[0].Holds[1].Status != PayoutHoldStatusForfeited || forfeited.Transfers[0].ReversedCents != 900 || forfeited.Transfers[0].HeldCents != 0 {
+		t.Fatalf("expected lost dispute forfeited as reversal, got %+v", forfeited.Transfers[0])
+	}
+	if got := client.TransferredCents(onboarding.AccountID); got != 4500 {
+		t.Fatalf("expected lost dispute to keep 900 back, got %d", got)
+	}
+
+	if err := svc.UpdateDisputeEvidence(context.Background(), "dp_1", "", "evidence_1"); !errors.Is(err, ErrDisputeEvidence) {
+		t.Fatalf("expected ErrDisputeEvidence, got %v", err)
+	}
+	if err := svc.UpdateDisputeEvidence(context.Background(), "dp_1", "Tracking 1Z999 delivered", "evidence_1"); err != nil {
+		t.Fatalf("UpdateDisputeEvidence() error = %v", err)
+	}
+	if got := client.DisputeEvidence("dp_1"); got != "Tracking 1Z999 delivered" {
+		t.Fatalf("expected staged evidence, got %q", got)
+	}
+}
+
+type transferHookClient struct {
+	*MockStripeClient
+	duringTransfer func()
+}
+
+func (c *transferHookClient) CreateTransfer(ctx context.Context, input TransferInput) (string, error) {
+	if hook := c.duringTransfer; hook != nil {
+		c.duringTransfer = nil
+		hook()
+	}
+	return c.MockStripeClient.CreateTransfer(ctx, input)
+}
+
+func TestDisputeHoldsReachTransfersSentAfterTheDisputeOpened(t *testing.T) {
+	client := &transferHookClient{MockStripeClient: NewMockStripeClient()}
+	svc := NewService(Config{
+		WebhookSecret: "whsec_test_secret",
+		StripeClient:  client,
+		MarkOrderPaid: func(string) bool { return true },
+	})
+	onboarding, err := svc.StartConnectOnboarding(context.Background(), ConnectOnboardingInput{
+		VendorID:   "ven_a",
+		RefreshURL: "https://vendor.example.com/payouts/refresh",
+		ReturnURL:  "https://vendor.example.com/payouts/done",
+	})
+	if err != nil {
+		t.Fatalf("StartConnectOnboarding() error = %v", err)
+	}
+	authorize := func(orderID string) {
+		t.Helper()
+		order := commerce.Order{ID: orderID, Status: commerce.OrderStatusPendingPayment, TotalCents: 10000, Currency: "USD"}
+		intent, err := svc.CreateStripeIntent(context.Background(), order, "idem-"+orderID)
+		if err != nil {
+			t.Fatalf("CreateStripeIntent() error = %v", err)
+		}
+		payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_auth_"+orderID, "payment_intent.amount_capturable_updated", intent.ProviderRef)
+		if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+			t.Fatalf("HandleStripeWebhook() error = %v", err)
+		}
+	}
+	capture := func(orderID, shipmentID string, amountCents int64, final bool) StripeIntent {
+		t.Helper()
+		captured, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+			OrderID:             orderID,
+			ShipmentID:          shipmentID,
+			AmountCents:         amountCents,
+			Final:               final,
+			VendorID:            "ven_a",
+			Destination:         onboarding.AccountID,
+			ApplicationFeeCents: amountCents / 10,
+		})
+		if err != nil {
+			t.Fatalf("CaptureShipment(%s) error = %v", shipmentID, err)
+		}
+		return captured
+	}
+
+	authorize("ord_dispute_later")
+	capture("ord_dispute_later", "shp_a", 6000, false)
+	for _, hold := range []ShipmentRefundInput{
+		{OrderID: "ord_dispute_later", ShipmentID: "shp_a", AmountCents: 6000, Reference: "dsp_1"},
+		{OrderID: "ord_dispute_later", ShipmentID: "shp_b", AmountCents: 4000, Reference: "dsp_1"},
+	} {
+		if _, err := svc.HoldShipmentPayout(context.Background(), hold); err != nil {
+			t.Fatalf("HoldShipmentPayout(%s) error = %v", hold.ShipmentID, err)
+		}
+	}
+	captured := capture("ord_dispute_later", "shp_b", 4000, true)
+	if later := captured.Transfers[1]; later.HeldCents != 3600 || later.TransferRef != "" {
+		t.Fatalf("expected the later shipment's transfer to be held in full, got %+v", later)
+	}
+	if got := client.TransferredCents(onboarding.AccountID); got != 0 {
+		t.Fatalf("expected nothing paid out while the dispute is open, got %d", got)
+	}
+	if _, err := svc.ClosePayoutHolds(context.Background(), "ord_dispute_later", "dsp_1", true); err != nil {
+		t.Fatalf("ClosePayoutHolds(won) error = %v", err)
+	}
+	if got := client.TransferredCents(onboarding.AccountID); got != 9000 {
+		t.Fatalf("expected both vendor shares paid once the dispute was won, got %d", got)
+	}
+
+	authorize("ord_dispute_in_flight")
+	client.duringTransfer = func() {
+		if _, err := svc.HoldShipmentPayout(context.Background(), ShipmentRefundInput{
+			OrderID: "ord_dispute_in_flight", ShipmentID: "shp_c", AmountCents: 10000, Reference: "dsp_2",
+		}); err != nil {
+			t.Errorf("HoldShipmentPayout() while the transfer is on its way error = %v", err)
+		}
+	}
+	captured = capture("ord_dispute_in_flight", "shp_c", 10000, true)
+	if inFlight := captured.Transfers[0]; inFlight.HeldCents != 9000 || len(inFlight.Holds) != 1 || inFlight.Holds[0].ReversalRef == "" {
+		t.Fatalf("expected the hold to be reversed once the transfer went out, got %+v", inFlight)
+	}
+	if got := client.TransferredCents(onboarding.AccountID); got != 9000 {
+		t.Fatalf("expected the in-flight transfer to be pulled back, got %d", got)
+	}
+}
+
+func signedStripeDisputePayload(t *testing.T, secret, eventID, eventType, disputeID, paymentIntentID string, amountCents int64, status string) ([]byte, string) {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":   eventID,
+		"type": eventType,
+		"data": map[string]interface{}{
+			"object": map[string]interface{}{
+				"id":             disputeID,
+				"amount":         amountCents,
+				"currency":       "usd",
+				"reason":         "product_not_received",
+				"status":         status,
+				"payment_intent": paymentIntentID,
+				"evidence_details": map[string]interface{}{
+					"due_by": time.Now().Add(7 * 24 * time.Hour).Unix(),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    secret,
+		Timestamp: time.Now().UTC(),
+		Scheme:    "v1",
+	})
+
+	return signed.Payload, signed.Header
+}
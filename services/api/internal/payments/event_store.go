@@ -0,0 +1,203 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/blobstore"
+)
+
+const (
+	WebhookEventStatusReceived   = "received"
+	WebhookEventStatusProcessed  = "processed"
+	WebhookEventStatusIgnored    = "ignored"
+	WebhookEventStatusFailed     = "failed"
+	WebhookEventStatusDeadLetter = "dead_letter"
+)
+
+var (
+	ErrWebhookEventNotFound = errors.New("webhook event not found")
+	ErrWebhookEventInFlight = errors.New("webhook event is being processed")
+	ErrInvalidEventFilter   = errors.New("webhook event filter is invalid")
+)
+
+// WebhookEvent is a received provider webhook, stored raw before it is
+// applied so a failed attempt can be retried. Only a BlobEventStore on disk
+// keeps events across a restart. It maps onto the payment_events table. ProviderRef is set for provider
+// webhooks, whose payloads are replayed from the verified fields rather than
+// parsed again.
+type WebhookEvent struct {
+	ID              string     `json:"id"`
+	Provider        string     `json:"provider"`
+	ProviderEventID string     `json:"provider_event_id"`
+	EventType       string     `json:"event_type"`
+	ProviderRef     string     `json:"provider_ref,omitempty"`
+	Payload         string     `json:"payload"`
+	Status          string     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	LastError       string     `json:"last_error,omitempty"`
+	PaymentID       string     `json:"payment_id,omitempty"`
+	OrderID         string     `json:"order_id,omitempty"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"`
+	ReceivedAt      time.Time  `json:"received_at"`
+	ProcessedAt     *time.Time `json:"processed_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// WebhookEventFilter narrows a webhook event listing. Empty fields match
+// everything.
+type WebhookEventFilter struct {
+	Status   string
+	Provider string
+}
+
+// EventStore persists webhook events. Save inserts or replaces the event
+// with the same ID.
+type EventStore interface {
+	Save(event WebhookEvent) error
+	Get(id string) (WebhookEvent, bool)
+	FindByProviderEventID(provider, providerEventID string) (WebhookEvent, bool)
+	List(filter WebhookEventFilter) []WebhookEvent
+}
+
+// MemoryEventStore keeps webhook events in memory, so they are lost on
+// restart. It is the default when no storage directory is configured and is
+// used in tests.
+type MemoryEventStore struct {
+	mu         sync.Mutex
+	eventsByID map[string]WebhookEvent
+	idByKey    map[string]string
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		eventsByID: make(map[string]WebhookEvent),
+		idByKey:    make(map[string]string),
+	}
+}
+
+func (m *MemoryEventStore) Save(event WebhookEvent) error {
+	if strings.TrimSpace(event.ID) == "" || strings.TrimSpace(event.ProviderEventID) == "" {
+		return ErrInvalidPayload
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.eventsByID[event.ID] = event
+	m.idByKey[eventKey(event.Provider, event.ProviderEventID)] = event.ID
+	return nil
+}
+
+func (m *MemoryEventStore) Get(id string) (WebhookEvent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, exists := m.eventsByID[strings.TrimSpace(id)]
+	return event, exists
+}
+
+func (m *MemoryEventStore) FindByProviderEventID(provider, providerEventID string) (WebhookEvent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, exists := m.idByKey[eventKey(provider, providerEventID)]
+	if !exists {
+		return WebhookEvent{}, false
+	}
+	return m.eventsByID[id], true
+}
+
+// List returns matching events, newest first.
+func (m *MemoryEventStore) List(filter WebhookEventFilter) []WebhookEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := make([]WebhookEvent, 0, len(m.eventsByID))
+	for _, event := range m.eventsByID {
+		if filter.Status != "" && event.Status != filter.Status {
+			continue
+		}
+		if filter.Provider != "" && event.Provider != filter.Provider {
+			continue
+		}
+		items = append(items, event)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].ReceivedAt.Equal(items[j].ReceivedAt) {
+			return items[i].ReceivedAt.After(items[j].ReceivedAt)
+		}
+		return items[i].ID > items[j].ID
+	})
+	return items
+}
+
+// eventBlobPrefix is where BlobEventStore keeps one JSON document per event.
+const eventBlobPrefix = "payment-events/"
+
+// BlobEventStore writes every webhook event to a blob store before it is
+// acknowledged, so received events survive a restart. The events are read
+// back into memory when the store is opened.
+type BlobEventStore struct {
+	blobs  blobstore.Store
+	memory *MemoryEventStore
+}
+
+func NewBlobEventStore(ctx context.Context, blobs blobstore.Store) (*BlobEventStore, error) {
+	keys, err := blobs.List(ctx, eventBlobPrefix)
+	if err != nil {
+		return nil, err
+	}
+	memory := NewMemoryEventStore()
+	for _, key := range keys {
+		content, err := blobs.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var event WebhookEvent
+		if err := json.Unmarshal(content, &event); err != nil {
+			return nil, fmt.Errorf("invalid webhook event %q: %w", key, err)
+		}
+		if err := memory.Save(event); err != nil {
+			return nil, fmt.Errorf("invalid webhook event %q: %w", key, err)
+		}
+	}
+	return &BlobEventStore{blobs: blobs, memory: memory}, nil
+}
+
+func (b *BlobEventStore) Save(event WebhookEvent) error {
+	if strings.TrimSpace(event.ID) == "" || strings.TrimSpace(event.ProviderEventID) == "" {
+		return ErrInvalidPayload
+	}
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := b.blobs.Put(context.Background(), eventBlobPrefix+event.ID+".json", content); err != nil {
+		return err
+	}
+	return b.memory.Save(event)
+}
+
+func (b *BlobEventStore) Get(id string) (WebhookEvent, bool) {
+	return b.memory.Get(id)
+}
+
+func (b *BlobEventStore) FindByProviderEventID(provider, providerEventID string) (WebhookEvent, bool) {
+	return b.memory.FindByProviderEventID(provider, providerEventID)
+}
+
+// List returns matching events, newest first.
+func (b *BlobEventStore) List(filter WebhookEventFilter) []WebhookEvent {
+	return b.memory.List(filter)
+}
+
+func eventKey(provider, providerEventID string) string {
+	return normalizeProviderName(provider) + "::" + strings.TrimSpace(providerEventID)
+}
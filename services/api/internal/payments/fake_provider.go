@@ -0,0 +1,168 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+const (
+	// FakeProviderKind is the provider kind of FakeProvider.
+	FakeProviderKind = "fake"
+	// FakeSignatureHeader carries the FakeProvider webhook signature.
+	FakeSignatureHeader = "X-Payment-Signature"
+)
+
+// FakeProvider is an in-memory payment provider for local development and
+// tests. Payments authorize on confirmation unless declined with Decline.
+// Webhooks are signed with a hex-encoded HMAC-SHA256 of the raw payload.
+type FakeProvider struct {
+	mu            sync.Mutex
+	name          string
+	webhookSecret string
+	payments      map[string]*fakePayment
+	declined      map[string]bool
+}
+
+type fakePayment struct {
+	amountCents   int64
+	capturedCents int64
+	refundedCents int64
+	closed        bool
+}
+
+type fakeWebhookPayload struct {
+	ID         string `json:"id"`
+	PaymentRef string `json:"payment_ref"`
+	Status     string `json:"status"`
+}
+
+func NewFakeProvider(name, webhookSecret string) *FakeProvider {
+	normalizedName := normalizeProviderName(name)
+	if normalizedName == "" {
+		normalizedName = FakeProviderKind
+	}
+	return &FakeProvider{
+		name:          normalizedName,
+		webhookSecret: strings.TrimSpace(webhookSecret),
+		payments:      make(map[string]*fakePayment),
+		declined:      make(map[string]bool),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return p.name
+}
+
+func (p *FakeProvider) SignatureHeader() string {
+	return FakeSignatureHeader
+}
+
+func (p *FakeProvider) CreatePayment(_ context.Context, input ProviderPaymentInput) (ProviderPaymentResult, error) {
+	if input.AmountCents <= 0 {
+		return ProviderPaymentResult{}, ErrInvalidOrder
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ref := identifier.New(p.name)
+	p.payments[ref] = &fakePayment{amountCents: input.AmountCents}
+	return ProviderPaymentResult{
+		ProviderRef: ref,
+		Status:      PaymentStatusPending,
+		ClientToken: ref + "_token",
+		RedirectURL: "https://" + p.name + ".invalid/checkout/" + ref,
+	}, nil
+}
+
+// Decline makes the next confirmation of providerRef fail.
+func (p *FakeProvider) Decline(providerRef string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.declined[strings.TrimSpace(providerRef)] = true
+}
+
+func (p *FakeProvider) ConfirmPayment(_ context.Context, providerRef string) (ProviderPaymentResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ref := strings.TrimSpace(providerRef)
+	if _, exists := p.payments[ref]; !exists {
+		return ProviderPaymentResult{}, ErrPaymentNotFound
+	}
+	status := PaymentStatusAuthorized
+	if p.declined[ref] {
+		delete(p.declined, ref)
+		status = PaymentStatusFailed
+	}
+	return ProviderPaymentResult{ProviderRef: ref, Status: status}, nil
+}
+
+func (p *FakeProvider) CapturePayment(_ context.Context, input CaptureIntentInput) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, exists := p.payments[strings.TrimSpace(input.ProviderRef)]
+	if !exists {
+		return ErrPaymentNotFound
+	}
+	if payment.closed || input.AmountCents < 0 || payment.capturedCents+input.AmountCents > payment.amountCents {
+		return ErrPaymentNotCapturable
+	}
+	payment.capturedCents += input.AmountCents
+	payment.closed = input.FinalCapture
+	return nil
+}
+
+func (p *FakeProvider) RefundPayment(_ context.Context, input ProviderRefundInput) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, exists := p.payments[strings.TrimSpace(input.ProviderRef)]
+	if !exists {
+		return "", ErrPaymentNotFound
+	}
+	if input.AmountCents <= 0 || payment.refundedCents+input.AmountCents > payment.capturedCents {
+		return "", ErrRefundExceedsCapture
+	}
+	payment.refundedCents += input.AmountCents
+	return identifier.New("re"), nil
+}
+
+func (p *FakeProvider) ParseWebhook(payload []byte, signatureHeader string) (ProviderEvent, error) {
+	if p.webhookSecret == "" {
+		return ProviderEvent{}, ErrWebhookSecretRequired
+	}
+	if !hmac.Equal([]byte(SignFakePayload(p.webhookSecret, payload)), []byte(strings.TrimSpace(signatureHeader))) {
+		return ProviderEvent{}, ErrInvalidSignature
+	}
+
+	var body fakeWebhookPayload
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return ProviderEvent{}, ErrInvalidPayload
+	}
+	event := ProviderEvent{
+		ID:          strings.TrimSpace(body.ID),
+		ProviderRef: strings.TrimSpace(body.PaymentRef),
+		Status:      strings.ToLower(strings.TrimSpace(body.Status)),
+	}
+	if event.ID == "" || event.ProviderRef == "" || event.Status == "" {
+		return ProviderEvent{}, ErrInvalidPayload
+	}
+	return event, nil
+}
+
+// SignFakePayload returns the signature header value expected by FakeProvider webhooks.
+func SignFakePayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(strings.TrimSpace(secret)))
+	_, _ = mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,180 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+// PaymentSummary is what a buyer polls while a payment settles. It covers
+// Stripe, COD and provider payments alike. ActionRequired is set while the
+// buyer still has to confirm the payment or complete 3-D Secure; ClientSecret
+// is only returned then.
+type PaymentSummary struct {
+	ID             string    `json:"id"`
+	OrderID        string    `json:"order_id"`
+	Method         string    `json:"method"`
+	Provider       string    `json:"provider"`
+	Status         string    `json:"status"`
+	ActionRequired bool      `json:"action_required"`
+	ClientSecret   string    `json:"client_secret,omitempty"`
+	ClientToken    string    `json:"client_token,omitempty"`
+	RedirectURL    string    `json:"redirect_url,omitempty"`
+	AmountCents    int64     `json:"amount_cents"`
+	Currency       string    `json:"currency"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// GetPayment returns the current state of a payment. An unconfirmed Stripe
+// payment is first refreshed from the intent so polling keeps up when a
+// webhook is late; if Stripe cannot be reached the last known state is
+// returned.
+func (s *Service) GetPayment(ctx context.Context, paymentID string) (PaymentSummary, error) {
+	paymentID = strings.TrimSpace(paymentID)
+
+	s.mu.Lock()
+	payment, isStripe := s.paymentsByID[paymentID]
+	s.mu.Unlock()
+	if isStripe && isAwaitingConfirmation(payment.Status) {
+		s.refreshStripePayment(ctx, payment)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if payment, exists := s.paymentsByID[paymentID]; exists {
+		summary := PaymentSummary{
+			ID:             payment.ID,
+			OrderID:        payment.OrderID,
+			Method:         payment.Method,
+			Provider:       payment.Provider,
+			Status:         payment.Status,
+			ActionRequired: payment.Status == PaymentStatusPending || payment.Status == PaymentStatusRequiresAction,
+			AmountCents:    payment.AmountCents,
+			Currency:       payment.Currency,
+			UpdatedAt:      payment.UpdatedAt,
+		}
+		if summary.ActionRequired {
+			summary.ClientSecret = payment.ClientSecret
+		}
+		return summary, nil
+	}
+	if payment, exists := s.codPaymentsByID[paymentID]; exists {
+		return PaymentSummary{
+			ID:          payment.ID,
+			OrderID:     payment.OrderID,
+			Method:      payment.Method,
+			Provider:    payment.Provider,
+			Status:      payment.Status,
+			AmountCents: payment.AmountCents,
+			Currency:    payment.Currency,
+			UpdatedAt:   payment.UpdatedAt,
+		}, nil
+	}
+	if payment, exists := s.providerPaymentsByID[paymentID]; exists {
+		summary := PaymentSummary{
+			ID:             payment.ID,
+			OrderID:        payment.OrderID,
+			Method:         payment.Method,
+			Provider:       payment.Provider,
+			Status:         payment.Status,
+			ActionRequired: payment.Status == PaymentStatusPending,
+			AmountCents:    payment.AmountCents,
+			Currency:       payment.Currency,
+			UpdatedAt:      payment.UpdatedAt,
+		}
+		if summary.ActionRequired {
+			summary.ClientToken = payment.ClientToken
+			summary.RedirectURL = payment.RedirectURL
+		}
+		return summary, nil
+	}
+	return PaymentSummary{}, ErrPaymentNotFound
+}
+
+// refreshStripePayment applies the intent's current Stripe status as if its
+// webhook had just arrived.
+func (s *Service) refreshStripePayment(ctx context.Context, payment StripeIntent) {
+	intent, err := s.stripeClient.GetPaymentIntent(ctx, payment.ProviderRef)
+	if err != nil {
+		return
+	}
+
+	var eventType string
+	switch stripe.PaymentIntentStatus(intent.Status) {
+	case stripe.PaymentIntentStatusRequiresAction:
+		if payment.Status == PaymentStatusRequiresAction {
+			return
+		}
+		eventType = stripeEventIntentRequiresAction
+	case stripe.PaymentIntentStatusProcessing:
+		if payment.Status == PaymentStatusProcessing {
+			return
+		}
+		eventType = stripeEventIntentProcessing
+	case stripe.PaymentIntentStatusRequiresCapture:
+		eventType = stripeEventIntentAmountCapturable
+	case stripe.PaymentIntentStatusSucceeded:
+		eventType = stripeEventIntentSucceeded
+	case stripe.PaymentIntentStatusCanceled:
+		eventType = stripeEventIntentCanceled
+	default:
+		// requires_payment_method is both a fresh intent and one whose 3-D
+		// Secure attempt failed; the payment_intent.payment_failed webhook
+		// tells them apart.
+		return
+	}
+	_, _ = s.applySyntheticIntentEvent("poll_"+payment.ProviderRef, eventType, intent.ProviderRef, intent.AmountReceivedCents)
+}
+
+// ExpireStalePayments cancels Stripe intents that stayed unconfirmed for
+// longer than the pending payment TTL, which expires their orders. Intents
+// that are processing are left for Stripe to settle. It returns how many
+// payments expired.
+func (s *Service) ExpireStalePayments(ctx context.Context) int {
+	cutoff := s.now().Add(-s.pendingTTL)
+
+	s.mu.Lock()
+	stale := make([]StripeIntent, 0)
+	for _, payment := range s.paymentsByID {
+		if s.orderToPaymentID[payment.OrderID] != payment.ID || payment.UpdatedAt.After(cutoff) {
+			continue
+		}
+		switch payment.Status {
+		case PaymentStatusPending, PaymentStatusRequiresAction, PaymentStatusFailed:
+			stale = append(stale, payment)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].UpdatedAt.Before(stale[j].UpdatedAt)
+	})
+
+	expired := 0
+	for _, payment := range stale {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := s.stripeClient.CancelPaymentIntent(ctx, payment.ProviderRef, "expire_"+payment.ID); err != nil {
+			continue
+		}
+		result, err := s.applySyntheticIntentEvent("expire_"+payment.ProviderRef, stripeEventIntentCanceled, payment.ProviderRef, 0)
+		if err == nil && result.PaymentStatus == PaymentStatusCancelled {
+			expired++
+		}
+	}
+	return expired
+}
+
+func (s *Service) applySyntheticIntentEvent(eventID, eventType, providerRef string, amountReceived int64) (WebhookResult, error) {
+	object, err := json.Marshal(stripeWebhookPaymentIntent{ID: providerRef, AmountReceived: amountReceived})
+	if err != nil {
+		return WebhookResult{}, err
+	}
+	event := stripeWebhookEnvelope{ID: eventID, Type: eventType}
+	event.Data.Object = object
+	return s.processStripeEvent(event)
+}
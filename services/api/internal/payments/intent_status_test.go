@@ -0,0 +1,140 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestIntentStatesFollowThreeDSecureAndExpireCancelledOrders(t *testing.T) {
+	client := NewMockStripeClient()
+	paid := make(map[string]bool)
+	expired := make(map[string]bool)
+	svc := NewService(Config{
+		WebhookSecret:    "whsec_test_secret",
+		StripeClient:     client,
+		MarkOrderPaid:    func(orderID string) bool { paid[orderID] = true; return true },
+		MarkOrderExpired: func(orderID string) bool { expired[orderID] = true; return true },
+	})
+	ctx := context.Background()
+
+	intent, err := svc.CreateStripeIntent(ctx, commerce.Order{
+		ID: "ord_3ds", Status: commerce.OrderStatusPendingPayment, TotalCents: 8800, Currency: "USD",
+	}, "idem-3ds")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+
+	client.SetIntentStatus(intent.ProviderRef, stripe.PaymentIntentStatusRequiresAction)
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_3ds_action", "payment_intent.requires_action", intent.ProviderRef)
+	if result, err := svc.HandleStripeWebhook(payload, signature); err != nil || result.PaymentStatus != PaymentStatusRequiresAction {
+		t.Fatalf("expected requires_action, got %+v err=%v", result, err)
+	}
+	summary, err := svc.GetPayment(ctx, intent.ID)
+	if err != nil {
+		t.Fatalf("GetPayment() error = %v", err)
+	}
+	if !summary.ActionRequired || summary.ClientSecret != intent.ClientSecret || summary.OrderID != "ord_3ds" {
+		t.Fatalf("expected buyer action with the client secret, got %+v", summary)
+	}
+
+	client.SetIntentStatus(intent.ProviderRef, stripe.PaymentIntentStatusProcessing)
+	payload, signature = signedStripeEventPayload(t, "whsec_test_secret", "evt_3ds_processing", "payment_intent.processing", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() processing error = %v", err)
+	}
+	if summary, _ := svc.GetPayment(ctx, intent.ID); summary.Status != PaymentStatusProcessing || summary.ActionRequired || summary.ClientSecret != "" {
+		t.Fatalf("expected processing without buyer action, got %+v", summary)
+	}
+
+	client.SetIntentStatus(intent.ProviderRef, stripe.PaymentIntentStatusCanceled)
+	payload, signature = signedStripeEventPayload(t, "whsec_test_secret", "evt_3ds_canceled", "payment_intent.canceled", intent.ProviderRef)
+	if result, err := svc.HandleStripeWebhook(payload, signature); err != nil || result.PaymentStatus != PaymentStatusCancelled {
+		t.Fatalf("expected cancelled payment, got %+v err=%v", result, err)
+	}
+	if !expired["ord_3ds"] || paid["ord_3ds"] {
+		t.Fatalf("expected the order expired, got expired=%v paid=%v", expired, paid)
+	}
+
+	authorized, err := svc.CreateStripeIntent(ctx, commerce.Order{
+		ID: "ord_late_event", Status: commerce.OrderStatusPendingPayment, TotalCents: 1200, Currency: "USD",
+	}, "idem-late-event")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	payload, signature = signedStripeEventPayload(t, "whsec_test_secret", "evt_late_auth", "payment_intent.amount_capturable_updated", authorized.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() authorization error = %v", err)
+	}
+	payload, signature = signedStripeEventPayload(t, "whsec_test_secret", "evt_late_action", "payment_intent.requires_action", authorized.ProviderRef)
+	if result, err := svc.HandleStripeWebhook(payload, signature); err != nil || result.PaymentStatus != PaymentStatusAuthorized {
+		t.Fatalf("expected a late requires_action to leave the payment authorized, got %+v err=%v", result, err)
+	}
+
+	if _, err := svc.GetPayment(ctx, "pay_missing"); !errors.Is(err, ErrPaymentNotFound) {
+		t.Fatalf("expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+func TestGetPaymentRefreshesFromStripeAndSweepExpiresStaleIntents(t *testing.T) {
+	client := NewMockStripeClient()
+	paid := make(map[string]bool)
+	expired := make(map[string]bool)
+	svc := NewService(Config{
+		StripeClient:      client,
+		MarkOrderPaid:     func(orderID string) bool { paid[orderID] = true; return true },
+		MarkOrderExpired:  func(orderID string) bool { expired[orderID] = true; return true },
+		PendingPaymentTTL: time.Hour,
+	})
+	clock := time.Date(2026, 10, 7, 8, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	newIntent := func(orderID string) StripeIntent {
+		t.Helper()
+		intent, err := svc.CreateStripeIntent(ctx, commerce.Order{
+			ID: orderID, Status: commerce.OrderStatusPendingPayment, TotalCents: 3000, Currency: "USD",
+		}, "idem-"+orderID)
+		if err != nil {
+			t.Fatalf("CreateStripeIntent() error = %v", err)
+		}
+		return intent
+	}
+	confirmed := newIntent("ord_polled")
+	abandoned := newIntent("ord_abandoned")
+	processing := newIntent("ord_processing")
+
+	client.SetIntentStatus(confirmed.ProviderRef, stripe.PaymentIntentStatusRequiresCapture)
+	summary, err := svc.GetPayment(ctx, confirmed.ID)
+	if err != nil {
+		t.Fatalf("GetPayment() error = %v", err)
+	}
+	if summary.Status != PaymentStatusAuthorized || !paid["ord_polled"] {
+		t.Fatalf("expected polling to pick up the authorization, got %+v paid=%v", summary, paid)
+	}
+	client.SetIntentStatus(processing.ProviderRef, stripe.PaymentIntentStatusProcessing)
+	if summary, _ := svc.GetPayment(ctx, processing.ID); summary.Status != PaymentStatusProcessing {
+		t.Fatalf("expected polling to pick up processing, got %+v", summary)
+	}
+
+	if count := svc.ExpireStalePayments(ctx); count != 0 {
+		t.Fatalf("expected nothing stale before the TTL, got %d", count)
+	}
+	clock = clock.Add(time.Hour)
+	if count := svc.ExpireStalePayments(ctx); count != 1 {
+		t.Fatalf("expected one stale payment expired, got %d", count)
+	}
+	if !expired["ord_abandoned"] || expired["ord_processing"] || expired["ord_polled"] {
+		t.Fatalf("expected only the abandoned order expired, got %v", expired)
+	}
+	if payment := svc.paymentsByID[abandoned.ID]; payment.Status != PaymentStatusCancelled {
+		t.Fatalf("expected abandoned payment cancelled, got %s", payment.Status)
+	}
+	if record, _ := client.GetPaymentIntent(ctx, abandoned.ProviderRef); record.Status != string(stripe.PaymentIntentStatusCanceled) {
+		t.Fatalf("expected the abandoned intent cancelled with Stripe, got %s", record.Status)
+	}
+}
@@ -0,0 +1,185 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrProviderNotFound     = errors.New("payment provider not found")
+	ErrProviderDisabled     = errors.New("payment provider is disabled")
+	ErrProviderKindUnknown  = errors.New("payment provider kind is not registered")
+	ErrProviderNameReserved = errors.New("payment provider name is reserved")
+	ErrInvalidProviderSpec  = errors.New("payment provider spec is invalid")
+	ErrRefundExceedsCapture = errors.New("refund exceeds captured amount")
+)
+
+// ProviderPaymentInput asks a provider to start a payment for one order.
+type ProviderPaymentInput struct {
+	OrderID        string
+	AmountCents    int64
+	Currency       string
+	IdempotencyKey string
+}
+
+// ProviderPaymentResult is the provider's view of a payment. Status is one of
+// the PaymentStatus constants; ClientToken and RedirectURL are handed to the
+// buyer to complete the payment with the provider.
+type ProviderPaymentResult struct {
+	ProviderRef string
+	Status      string
+	ClientToken string
+	RedirectURL string
+}
+
+// ProviderRefundInput refunds part of a captured payment.
+type ProviderRefundInput struct {
+	ProviderRef    string
+	AmountCents    int64
+	IdempotencyKey string
+}
+
+// ProviderEvent is a verified webhook notification about one payment.
+type ProviderEvent struct {
+	ID          string
+	ProviderRef string
+	Status      string
+}
+
+// Provider integrates a payment provider other than the built-in Stripe and
+// COD flows. CapturePayment follows CaptureIntentInput: a final capture
+// releases whatever remains uncaptured, and a final capture of zero releases
+// the authorization without capturing anything.
+type Provider interface {
+	Name() string
+	SignatureHeader() string
+	CreatePayment(ctx context.Context, input ProviderPaymentInput) (ProviderPaymentResult, error)
+	ConfirmPayment(ctx context.Context, providerRef string) (ProviderPaymentResult, error)
+	CapturePayment(ctx context.Context, input CaptureIntentInput) error
+	RefundPayment(ctx context.Context, input ProviderRefundInput) (string, error)
+	ParseWebhook(payload []byte, signatureHeader string) (ProviderEvent, error)
+}
+
+// ProviderSpec configures one provider instance: Name is how buyers, webhooks
+// and admin settings refer to it, Kind selects the registered implementation.
+type ProviderSpec struct {
+	Name          string
+	Kind          string
+	WebhookSecret string
+}
+
+// ProviderFactory builds a provider from its spec.
+type ProviderFactory func(spec ProviderSpec) (Provider, error)
+
+// Registry maps provider kinds to the factories that build them.
+type Registry struct {
+	mu        sync.Mutex
+	factories map[string]ProviderFactory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]ProviderFactory)}
+}
+
+// DefaultRegistry returns a registry with every provider kind shipped in this
+// package.
+func DefaultRegistry() *Registry {
+	registry := NewRegistry()
+	registry.Register(FakeProviderKind, func(spec ProviderSpec) (Provider, error) {
+		return NewFakeProvider(spec.Name, spec.WebhookSecret), nil
+	})
+	return registry
+}
+
+func (r *Registry) Register(kind string, factory ProviderFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.factories[normalizeProviderName(kind)] = factory
+}
+
+// Kinds lists the registered provider kinds in name order.
+func (r *Registry) Kinds() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kinds := make([]string, 0, len(r.factories))
+	for kind := range r.factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func (r *Registry) Build(spec ProviderSpec) (Provider, error) {
+	spec.Name = normalizeProviderName(spec.Name)
+	spec.Kind = normalizeProviderName(spec.Kind)
+	if spec.Name == "" || spec.Kind == "" {
+		return nil, ErrInvalidProviderSpec
+	}
+	if spec.Name == ProviderStripe || spec.Name == ProviderCOD {
+		return nil, ErrProviderNameReserved
+	}
+
+	r.mu.Lock()
+	factory, exists := r.factories[spec.Kind]
+	r.mu.Unlock()
+	if !exists {
+		return nil, ErrProviderKindUnknown
+	}
+	return factory(spec)
+}
+
+// ParseProviderSpecs reads provider specs from configuration. providers is a
+// comma-separated list of name=kind pairs, where a bare name is its own kind;
+// secrets is a comma-separated list of name=webhook-secret pairs.
+func ParseProviderSpecs(providers, secrets string) ([]ProviderSpec, error) {
+	secretByName := make(map[string]string)
+	for _, entry := range splitList(secrets) {
+		name, secret, found := strings.Cut(entry, "=")
+		if !found || normalizeProviderName(name) == "" {
+			return nil, ErrInvalidProviderSpec
+		}
+		secretByName[normalizeProviderName(name)] = strings.TrimSpace(secret)
+	}
+
+	seen := make(map[string]struct{})
+	specs := make([]ProviderSpec, 0)
+	for _, entry := range splitList(providers) {
+		name, kind, found := strings.Cut(entry, "=")
+		if !found {
+			kind = name
+		}
+		spec := ProviderSpec{
+			Name: normalizeProviderName(name),
+			Kind: normalizeProviderName(kind),
+		}
+		if spec.Name == "" || spec.Kind == "" {
+			return nil, ErrInvalidProviderSpec
+		}
+		if _, duplicate := seen[spec.Name]; duplicate {
+			return nil, ErrInvalidProviderSpec
+		}
+		seen[spec.Name] = struct{}{}
+		spec.WebhookSecret = secretByName[spec.Name]
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func splitList(value string) []string {
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func normalizeProviderName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,511 @@
+package payments
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+// ProviderPayment is a payment for one order taken through a configured
+// Provider. Method and Provider both carry the provider name.
+type ProviderPayment struct {
+	ID            string           `json:"id"`
+	OrderID       string           `json:"order_id"`
+	Method        string           `json:"method"`
+	Status        string           `json:"status"`
+	Provider      string           `json:"provider"`
+	ProviderRef   string           `json:"provider_ref"`
+	ClientToken   string           `json:"client_token,omitempty"`
+	RedirectURL   string           `json:"redirect_url,omitempty"`
+	AmountCents   int64            `json:"amount_cents"`
+	Currency      string           `json:"currency"`
+	CapturedCents int64            `json:"captured_cents"`
+	RefundedCents int64            `json:"refunded_cents"`
+	Captures      []PaymentCapture `json:"captures"`
+	ReleasedCents int64            `json:"released_cents"`
+	Releases      []PaymentRelease `json:"releases"`
+	Refunds       []PaymentRefund  `json:"refunds"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+// PaymentRefund is money returned to the buyer. Reference identifies the
+// request that triggered it, such as a refund request id.
+type PaymentRefund struct {
+	RefundRef   string    `json:"refund_ref"`
+	Reference   string    `json:"reference"`
+	AmountCents int64     `json:"amount_cents"`
+	RefundedAt  time.Time `json:"refunded_at"`
+}
+
+func (p ProviderPayment) uncapturedCents() int64 {
+	if p.AmountCents <= p.CapturedCents+p.ReleasedCents {
+		return 0
+	}
+	return p.AmountCents - p.CapturedCents - p.ReleasedCents
+}
+
+// CreateProviderPayment starts a payment for order with the named provider.
+// Like CreateStripeIntent it is idempotent per order and key, and returns the
+// order's existing payment with that provider unless it failed.
+func (s *Service) CreateProviderPayment(ctx context.Context, providerName string, order commerce.Order, idempotencyKey string) (ProviderPayment, error) {
+	name := normalizeProviderName(providerName)
+	orderID := strings.TrimSpace(order.ID)
+	if orderID == "" || order.TotalCents <= 0 || strings.TrimSpace(order.Currency) == "" {
+		return ProviderPayment{}, ErrInvalidOrder
+	}
+	if order.Status != commerce.OrderStatusPendingPayment && order.Status != commerce.OrderStatusPaymentFailed {
+		return ProviderPayment{}, ErrOrderNotPayable
+	}
+	normalizedKey := strings.TrimSpace(idempotencyKey)
+	if normalizedKey == "" {
+		return ProviderPayment{}, ErrIdempotencyKey
+	}
+	requestID := name + "::" + orderID + "::" + normalizedKey
+	orderKey := name + "::" + orderID
+
+	s.mu.Lock()
+	provider, exists := s.providers[name]
+	if !exists {
+		s.mu.Unlock()
+		return ProviderPayment{}, ErrProviderNotFound
+	}
+	if payment, found := s.existingProviderPaymentLocked(requestID, orderKey, order.Status); found {
+		s.mu.Unlock()
+		return payment, nil
+	}
+	if !s.settings.Providers[name] {
+		s.mu.Unlock()
+		return ProviderPayment{}, ErrProviderDisabled
+	}
+	s.mu.Unlock()
+
+	result, err := provider.CreatePayment(ctx, ProviderPaymentInput{
+		OrderID:        orderID,
+		AmountCents:    order.TotalCents,
+		Currency:       order.Currency,
+		IdempotencyKey: normalizedKey,
+	})
+	if err != nil {
+		return ProviderPayment{}, err
+	}
+	if strings.TrimSpace(result.ProviderRef) == "" {
+		return ProviderPayment{}, ErrInvalidPayload
+	}
+
+	now := s.now()
+	payment := ProviderPayment{
+		ID:          identifier.New("pay"),
+		OrderID:     orderID,
+		Method:      name,
+		Status:      PaymentStatusPending,
+		Provider:    name,
+		ProviderRef: strings.TrimSpace(result.ProviderRef),
+		ClientToken: strings.TrimSpace(result.ClientToken),
+		RedirectURL: strings.TrimSpace(result.RedirectURL),
+		AmountCents: order.TotalCents,
+		Currency:    order.Currency,
+		Captures:    []PaymentCapture{},
+		Releases:    []PaymentRelease{},
+		Refunds:     []PaymentRefund{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, found := s.existingProviderPaymentLocked(requestID, orderKey, order.Status); found {
+		return existing, nil
+	}
+	s.providerPaymentsByID[payment.ID] = payment
+	s.providerPaymentByRequest[requestID] = payment.ID
+	s.providerPaymentByOrder[orderKey] = payment.ID
+	s.providerPaymentByRef[name+"::"+payment.ProviderRef] = payment.ID
+
+	return payment, nil
+}
+
+func (s *Service) existingProviderPaymentLocked(requestID, orderKey, orderStatus string) (ProviderPayment, bool) {
+	if paymentID, exists := s.providerPaymentByRequest[requestID]; exists {
+		return s.providerPaymentsByID[paymentID], true
+	}
+	paymentID, exists := s.providerPaymentByOrder[orderKey]
+	if !exists {
+		return ProviderPayment{}, false
+	}
+	payment := s.providerPaymentsByID[paymentID]
+	if orderStatus == commerce.OrderStatusPaymentFailed && payment.Status == PaymentStatusFailed {
+		return ProviderPayment{}, false
+	}
+	s.providerPaymentByRequest[requestID] = paymentID
+	return payment, true
+}
+
+// ConfirmProviderPayment asks the provider for the outcome of the order's
+// payment after the buyer returns from it, and applies that outcome.
+func (s *Service) ConfirmProviderPayment(ctx context.Context, providerName string, order commerce.Order) (ProviderPayment, error) {
+	name := normalizeProviderName(providerName)
+
+	s.mu.Lock()
+	provider, exists := s.providers[name]
+	if !exists {
+		s.mu.Unlock()
+		return ProviderPayment{}, ErrProviderNotFound
+	}
+	paymentID, exists := s.providerPaymentByOrder[name+"::"+strings.TrimSpace(order.ID)]
+	if !exists {
+		s.mu.Unlock()
+		return ProviderPayment{}, ErrPaymentNotFound
+	}
+	payment := s.providerPaymentsByID[paymentID]
+	s.mu.Unlock()
+	if payment.Status != PaymentStatusPending {
+		return payment, nil
+	}
+
+	result, err := provider.ConfirmPayment(ctx, payment.ProviderRef)
+	if err != nil {
+		return ProviderPayment{}, err
+	}
+	return s.applyProviderStatus(paymentID, result.Status)
+}
+
+// ProviderSignatureHeader returns the header the named provider signs its
+// webhooks with.
+func (s *Service) ProviderSignatureHeader(providerName string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, exists := s.providers[normalizeProviderName(providerName)]
+	if !exists {
+		return "", false
+	}
+	return provider.SignatureHeader(), true
+}
+
+// HandleProviderWebhook verifies and applies a webhook from the named
+// provider. Events are deduplicated per provider by event id.
+func (s *Service) HandleProviderWebhook(providerName string, payload []byte, signatureHeader string) (WebhookResult, error) {
+	name := normalizeProviderName(providerName)
+
+	s.mu.Lock()
+	provider, exists := s.providers[name]
+	s.mu.Unlock()
+	if !exists {
+		return WebhookResult{}, ErrProviderNotFound
+	}
+
+	event, err := provider.ParseWebhook(payload, signatureHeader)
+	if err != nil {
+		return WebhookResult{}, err
+	}
+
+	stored, fresh, err := s.receiveEvent(WebhookEvent{
+		Provider:        name,
+		ProviderEventID: event.ID,
+		EventType:       event.Status,
+		ProviderRef:     event.ProviderRef,
+		Payload:         string(payload),
+	})
+	if err != nil {
+		return WebhookResult{}, err
+	}
+	if !fresh {
+		return WebhookResult{
+			EventID:   event.ID,
+			Processed: false,
+			Duplicate: true,
+		}, nil
+	}
+
+	result, err := s.processProviderEvent(name, event)
+	s.finishEvent(stored, result, err)
+	return result, err
+}
+
+// processProviderEvent applies one verified provider event.
+func (s *Service) processProviderEvent(name string, event ProviderEvent) (WebhookResult, error) {
+	s.mu.Lock()
+	paymentID, exists := s.providerPaymentByRef[name+"::"+event.ProviderRef]
+	s.mu.Unlock()
+	if !exists {
+		return WebhookResult{}, ErrPaymentNotFound
+	}
+
+	payment, err := s.applyProviderStatus(paymentID, event.Status)
+	if err != nil {
+		return WebhookResult{}, err
+	}
+
+	return WebhookResult{
+		EventID:       event.ID,
+		Processed:     true,
+		Duplicate:     false,
+		PaymentID:     payment.ID,
+		OrderID:       payment.OrderID,
+		PaymentStatus: payment.Status,
+	}, nil
+}
+
+// applyProviderStatus moves a provider payment forward and syncs the order.
+// Statuses never move backwards, so late or repeated notifications are no-ops.
+func (s *Service) applyProviderStatus(paymentID, status string) (ProviderPayment, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch status {
+	case PaymentStatusPending, PaymentStatusAuthorized, PaymentStatusSuccess, PaymentStatusFailed:
+	default:
+		return ProviderPayment{}, ErrInvalidPayload
+	}
+
+	s.mu.Lock()
+	payment := s.providerPaymentsByID[paymentID]
+	s.mu.Unlock()
+
+	advances := false
+	switch payment.Status {
+	case PaymentStatusPending:
+		advances = status != PaymentStatusPending
+	case PaymentStatusFailed:
+		advances = status == PaymentStatusAuthorized || status == PaymentStatusSuccess
+	case PaymentStatusAuthorized:
+		advances = status == PaymentStatusSuccess
+	}
+	if !advances {
+		return payment, nil
+	}
+
+	markOrder := s.markOrderPaid
+	if status == PaymentStatusFailed {
+		markOrder = s.markOrderFailed
+	}
+	if markOrder != nil {
+		if ok := markOrder(payment.OrderID); !ok {
+			return ProviderPayment{}, ErrOrderSyncFailed
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.providerPaymentsByID[paymentID]
+	payment.Status = status
+	payment.UpdatedAt = s.now()
+	switch status {
+	case PaymentStatusAuthorized:
+		s.capturablePaymentByOrderID[payment.OrderID] = payment.ID
+	case PaymentStatusSuccess:
+		// The provider captured the payment in full on its side.
+		payment.CapturedCents = payment.AmountCents
+		s.capturablePaymentByOrderID[payment.OrderID] = payment.ID
+	}
+	s.providerPaymentsByID[paymentID] = payment
+
+	return payment, nil
+}
+
+// CaptureProviderShipment is CaptureShipment for orders paid through a
+// configured provider.
+func (s *Service) CaptureProviderShipment(ctx context.Context, input CaptureShipmentInput) (ProviderPayment, error) {
+	orderID := strings.TrimSpace(input.OrderID)
+	shipmentID := strings.TrimSpace(input.ShipmentID)
+	if orderID == "" || shipmentID == "" || input.AmountCents <= 0 {
+		return ProviderPayment{}, ErrInvalidOrder
+	}
+
+	s.mu.Lock()
+	payment, provider, err := s.capturableProviderPaymentLocked(orderID)
+	if err != nil {
+		s.mu.Unlock()
+		return payment, err
+	}
+	for _, capture := range payment.Captures {
+		if capture.ShipmentID == shipmentID {
+			s.mu.Unlock()
+			return payment, nil
+		}
+	}
+	if payment.Status != PaymentStatusAuthorized || payment.uncapturedCents() <= 0 {
+		s.mu.Unlock()
+		return payment, ErrPaymentNotCapturable
+	}
+	amount := input.AmountCents
+	if amount > payment.uncapturedCents() {
+		amount = payment.uncapturedCents()
+	}
+	final := input.Final || amount == payment.uncapturedCents()
+	s.mu.Unlock()
+
+	if err := provider.CapturePayment(ctx, CaptureIntentInput{
+		ProviderRef:    payment.ProviderRef,
+		AmountCents:    amount,
+		FinalCapture:   final,
+		IdempotencyKey: "capture_" + payment.ID + "_" + shipmentID,
+	}); err != nil {
+		return payment, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.providerPaymentsByID[payment.ID]
+	for _, capture := range payment.Captures {
+		if capture.ShipmentID == shipmentID {
+			return payment, nil
+		}
+	}
+	payment.UpdatedAt = s.now()
+	payment.Captures = append(payment.Captures, PaymentCapture{
+		ShipmentID:  shipmentID,
+		AmountCents: amount,
+		Final:       final,
+		CapturedAt:  payment.UpdatedAt,
+	})
+	payment.CapturedCents += amount
+	if final {
+		payment.Status = PaymentStatusSuccess
+	}
+	s.providerPaymentsByID[payment.ID] = payment
+
+	return payment, nil
+}
+
+// ReleaseProviderShipment is ReleaseShipment for orders paid through a
+// configured provider.
+func (s *Service) ReleaseProviderShipment(orderID, shipmentID string, amountCents int64) (ProviderPayment, error) {
+	orderID = strings.TrimSpace(orderID)
+	shipmentID = strings.TrimSpace(shipmentID)
+	if orderID == "" || shipmentID == "" || amountCents <= 0 {
+		return ProviderPayment{}, ErrInvalidOrder
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment, _, err := s.capturableProviderPaymentLocked(orderID)
+	if err != nil {
+		return payment, err
+	}
+	if hasShipmentRelease(payment.Releases, shipmentID) {
+		return payment, nil
+	}
+	if payment.Status != PaymentStatusAuthorized {
+		return payment, ErrPaymentNotCapturable
+	}
+	amount := min(amountCents, payment.uncapturedCents())
+	payment.UpdatedAt = s.now()
+	payment.Releases = append(payment.Releases, PaymentRelease{
+		ShipmentID:  shipmentID,
+		AmountCents: amount,
+		ReleasedAt:  payment.UpdatedAt,
+	})
+	payment.ReleasedCents += amount
+	s.providerPaymentsByID[payment.ID] = payment
+	return payment, nil
+}
+
+// ReleaseProviderAuthorization is ReleaseAuthorization for orders paid through
+// a configured provider.
+func (s *Service) ReleaseProviderAuthorization(ctx context.Context, orderID string) (ProviderPayment, error) {
+	s.mu.Lock()
+	payment, provider, err := s.capturableProviderPaymentLocked(strings.TrimSpace(orderID))
+	s.mu.Unlock()
+	if err != nil {
+		return payment, err
+	}
+	if payment.Status != PaymentStatusAuthorized {
+		return payment, ErrPaymentNotCapturable
+	}
+
+	if err := provider.CapturePayment(ctx, CaptureIntentInput{
+		ProviderRef:    payment.ProviderRef,
+		AmountCents:    0,
+		FinalCapture:   true,
+		IdempotencyKey: "release_" + payment.ID,
+	}); err != nil {
+		return payment, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.providerPaymentsByID[payment.ID]
+	if payment.Status != PaymentStatusAuthorized {
+		return payment, nil
+	}
+	payment.Status = PaymentStatusCancelled
+	if payment.CapturedCents > 0 {
+		payment.Status = PaymentStatusSuccess
+	}
+	payment.UpdatedAt = s.now()
+	s.providerPaymentsByID[payment.ID] = payment
+
+	return payment, nil
+}
+
+// RefundProviderPayment refunds part of the captured amount of the order's
+// provider payment. Refunds are idempotent per reference.
+func (s *Service) RefundProviderPayment(ctx context.Context, orderID string, amountCents int64, reference string) (ProviderPayment, error) {
+	normalizedReference := strings.TrimSpace(reference)
+	if amountCents <= 0 || normalizedReference == "" {
+		return ProviderPayment{}, ErrInvalidOrder
+	}
+
+	s.mu.Lock()
+	payment, provider, err := s.capturableProviderPaymentLocked(strings.TrimSpace(orderID))
+	if err != nil {
+		s.mu.Unlock()
+		return payment, err
+	}
+	for _, refund := range payment.Refunds {
+		if refund.Reference == normalizedReference {
+			s.mu.Unlock()
+			return payment, nil
+		}
+	}
+	if payment.RefundedCents+amountCents > payment.CapturedCents {
+		s.mu.Unlock()
+		return payment, ErrRefundExceedsCapture
+	}
+	s.mu.Unlock()
+
+	refundRef, err := provider.RefundPayment(ctx, ProviderRefundInput{
+		ProviderRef:    payment.ProviderRef,
+		AmountCents:    amountCents,
+		IdempotencyKey: "refund_" + payment.ID + "_" + normalizedReference,
+	})
+	if err != nil {
+		return payment, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.providerPaymentsByID[payment.ID]
+	for _, refund := range payment.Refunds {
+		if refund.Reference == normalizedReference {
+			return payment, nil
+		}
+	}
+	payment.UpdatedAt = s.now()
+	payment.Refunds = append(payment.Refunds, PaymentRefund{
+		RefundRef:   strings.TrimSpace(refundRef),
+		Reference:   normalizedReference,
+		AmountCents: amountCents,
+		RefundedAt:  payment.UpdatedAt,
+	})
+	payment.RefundedCents += amountCents
+	s.providerPaymentsByID[payment.ID] = payment
+
+	return payment, nil
+}
+
+func (s *Service) capturableProviderPaymentLocked(orderID string) (ProviderPayment, Provider, error) {
+	paymentID, exists := s.capturablePaymentByOrderID[orderID]
+	if !exists {
+		return ProviderPayment{}, nil, ErrPaymentNotFound
+	}
+	payment := s.providerPaymentsByID[paymentID]
+	provider, exists := s.providers[payment.Provider]
+	if !exists {
+		return payment, nil, ErrProviderNotFound
+	}
+	return payment, provider, nil
+}
@@ -0,0 +1,187 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestParseProviderSpecsAndRegistryBuild(t *testing.T) {
+	specs, err := ParseProviderSpecs("paypal=fake, Razorpay=FAKE ,fake", "paypal=whsec_paypal,fake=whsec_fake")
+	if err != nil {
+		t.Fatalf("ParseProviderSpecs() error = %v", err)
+	}
+	if len(specs) != 3 {
+		t.Fatalf("expected 3 specs, got %d", len(specs))
+	}
+	if specs[0] != (ProviderSpec{Name: "paypal", Kind: "fake", WebhookSecret: "whsec_paypal"}) {
+		t.Fatalf("unexpected paypal spec %+v", specs[0])
+	}
+	if specs[1].Name != "razorpay" || specs[1].Kind != "fake" || specs[1].WebhookSecret != "" {
+		t.Fatalf("unexpected razorpay spec %+v", specs[1])
+	}
+	if specs[2].Name != "fake" || specs[2].Kind != "fake" {
+		t.Fatalf("expected bare name to be its own kind, got %+v", specs[2])
+	}
+
+	if _, err := ParseProviderSpecs("paypal,paypal=fake", ""); !errors.Is(err, ErrInvalidProviderSpec) {
+		t.Fatalf("expected duplicate provider name to be rejected, got %v", err)
+	}
+	if _, err := ParseProviderSpecs("paypal", "whsec_without_name"); !errors.Is(err, ErrInvalidProviderSpec) {
+		t.Fatalf("expected malformed secret entry to be rejected, got %v", err)
+	}
+
+	registry := DefaultRegistry()
+	provider, err := registry.Build(specs[0])
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if provider.Name() != "paypal" || provider.SignatureHeader() != FakeSignatureHeader {
+		t.Fatalf("unexpected provider name=%s header=%s", provider.Name(), provider.SignatureHeader())
+	}
+	if _, err := registry.Build(ProviderSpec{Name: "adyen", Kind: "adyen"}); !errors.Is(err, ErrProviderKindUnknown) {
+		t.Fatalf("expected unknown kind error, got %v", err)
+	}
+	if _, err := registry.Build(ProviderSpec{Name: "stripe", Kind: "fake"}); !errors.Is(err, ErrProviderNameReserved) {
+		t.Fatalf("expected reserved name error, got %v", err)
+	}
+}
+
+func TestProviderPaymentLifecycle(t *testing.T) {
+	var markedPaid []string
+	provider := NewFakeProvider("paypal", "whsec_paypal")
+	svc := NewService(Config{
+		StripeClient: NewMockStripeClient(),
+		Providers:    []Provider{provider},
+		MarkOrderPaid: func(orderID string) bool {
+			markedPaid = append(markedPaid, orderID)
+			return true
+		},
+	})
+
+	order := commerce.Order{
+		ID:         "ord_provider_1",
+		Status:     commerce.OrderStatusPendingPayment,
+		TotalCents: 9000,
+		Currency:   "USD",
+	}
+	if _, err := svc.CreateProviderPayment(context.Background(), "razorpay", order, "idem-provider"); !errors.Is(err, ErrProviderNotFound) {
+		t.Fatalf("expected ErrProviderNotFound, got %v", err)
+	}
+
+	payment, err := svc.CreateProviderPayment(context.Background(), "PayPal", order, "idem-provider")
+	if err != nil {
+		t.Fatalf("CreateProviderPayment() error = %v", err)
+	}
+	if payment.Provider != "paypal" || payment.Status != PaymentStatusPending || payment.RedirectURL == "" {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+	again, err := svc.CreateProviderPayment(context.Background(), "paypal", order, "idem-provider-2")
+	if err != nil || again.ID != payment.ID {
+		t.Fatalf("expected existing payment for order, got id=%s err=%v", again.ID, err)
+	}
+
+	payload, err := json.Marshal(map[string]string{"id": "evt_paypal_1", "payment_ref": payment.ProviderRef, "status": "authorized"})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if _, err := svc.HandleProviderWebhook("paypal", payload, "bad-signature"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	result, err := svc.HandleProviderWebhook("paypal", payload, SignFakePayload("whsec_paypal", payload))
+	if err != nil {
+		t.Fatalf("HandleProviderWebhook() error = %v", err)
+	}
+	if !result.Processed || result.PaymentStatus != PaymentStatusAuthorized {
+		t.Fatalf("expected authorized payment, got %+v", result)
+	}
+	duplicate, err := svc.HandleProviderWebhook("paypal", payload, SignFakePayload("whsec_paypal", payload))
+	if err != nil || !duplicate.Duplicate {
+		t.Fatalf("expected duplicate webhook, got %+v err=%v", duplicate, err)
+	}
+	if len(markedPaid) != 1 || markedPaid[0] != order.ID {
+		t.Fatalf("expected order marked paid once, got %#v", markedPaid)
+	}
+
+	captured, err := svc.CaptureProviderShipment(context.Background(), CaptureShipmentInput{
+		OrderID: order.ID, ShipmentID: "shp_1", AmountCents: 5000,
+	})
+	if err != nil {
+		t.Fatalf("CaptureProviderShipment() error = %v", err)
+	}
+	if captured.CapturedCents != 5000 || captured.Status != PaymentStatusAuthorized {
+		t.Fatalf("expected partial capture, got %+v", captured)
+	}
+
+	if _, err := svc.RefundProviderPayment(context.Background(), order.ID, 6000, "rfr_1"); !errors.Is(err, ErrRefundExceedsCapture) {
+		t.Fatalf("expected refund beyond capture to fail, got %v", err)
+	}
+	refunded, err := svc.RefundProviderPayment(context.Background(), order.ID, 2000, "rfr_1")
+	if err != nil {
+		t.Fatalf("RefundProviderPayment() error = %v", err)
+	}
+	refunded, err = svc.RefundProviderPayment(context.Background(), order.ID, 2000, "rfr_1")
+	if err != nil || refunded.RefundedCents != 2000 || len(refunded.Refunds) != 1 {
+		t.Fatalf("expected idempotent refund of 2000, got %+v err=%v", refunded, err)
+	}
+
+	released, err := svc.ReleaseProviderAuthorization(context.Background(), order.ID)
+	if err != nil {
+		t.Fatalf("ReleaseProviderAuthorization() error = %v", err)
+	}
+	if released.Status != PaymentStatusSuccess || released.CapturedCents != 5000 {
+		t.Fatalf("expected remainder released, got %+v", released)
+	}
+}
+
+func TestProviderPaymentsRespectSettings(t *testing.T) {
+	provider := NewFakeProvider("paypal", "")
+	svc := NewService(Config{
+		StripeClient: NewMockStripeClient(),
+		Providers:    []Provider{provider},
+	})
+
+	settings := svc.GetSettings()
+	if !settings.Providers["paypal"] || !settings.Providers[ProviderStripe] || !settings.Providers[ProviderCOD] {
+		t.Fatalf("expected all providers enabled by default, got %#v", settings.Providers)
+	}
+
+	updated := svc.UpdateSettings(PaymentSettingsUpdate{Providers: map[string]bool{"paypal": false, "cod": false, "unknown": false}})
+	if updated.Providers["paypal"] || updated.CODEnabled || updated.Providers[ProviderCOD] {
+		t.Fatalf("expected paypal and cod disabled, got %+v", updated)
+	}
+	if _, exists := updated.Providers["unknown"]; exists {
+		t.Fatalf("expected unknown provider to be ignored")
+	}
+	updated.Providers["paypal"] = true
+	if svc.GetSettings().Providers["paypal"] {
+		t.Fatalf("expected settings snapshot to be a copy")
+	}
+
+	order := commerce.Order{
+		ID:         "ord_provider_disabled",
+		Status:     commerce.OrderStatusPendingPayment,
+		TotalCents: 1200,
+		Currency:   "USD",
+	}
+	if _, err := svc.CreateProviderPayment(context.Background(), "paypal", order, "idem-disabled"); !errors.Is(err, ErrProviderDisabled) {
+		t.Fatalf("expected ErrProviderDisabled, got %v", err)
+	}
+
+	svc.UpdateSettings(PaymentSettingsUpdate{Providers: map[string]bool{"paypal": true}})
+	payment, err := svc.CreateProviderPayment(context.Background(), "paypal", order, "idem-enabled")
+	if err != nil {
+		t.Fatalf("CreateProviderPayment() error = %v", err)
+	}
+	provider.Decline(payment.ProviderRef)
+	declined, err := svc.ConfirmProviderPayment(context.Background(), "paypal", order)
+	if err != nil {
+		t.Fatalf("ConfirmProviderPayment() error = %v", err)
+	}
+	if declined.Status != PaymentStatusFailed {
+		t.Fatalf("expected declined payment to fail, got %s", declined.Status)
+	}
+}
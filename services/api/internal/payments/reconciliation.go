@@ -0,0 +1,180 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+var ErrPaymentNotSettled = errors.New("payment is not settled with the provider")
+
+// PaymentRecord is one payment as the provider reports it. Stripe records
+// come from the Stripe API; COD collections and other providers come from
+// the payments recorded here. AmountCents is what the provider collected or
+// still holds for the order, and Status is one of the PaymentStatus
+// constants.
+type PaymentRecord struct {
+	Provider    string    `json:"provider"`
+	ProviderRef string    `json:"provider_ref"`
+	PaymentID   string    `json:"payment_id,omitempty"`
+	OrderID     string    `json:"order_id,omitempty"`
+	Status      string    `json:"status"`
+	AmountCents int64     `json:"amount_cents"`
+	Currency    string    `json:"currency"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Settled reports whether the provider holds money for the record: the
+// payment succeeded, is authorized, or is awaiting or has collected cash on
+// delivery.
+func (r PaymentRecord) Settled() bool {
+	switch r.Status {
+	case PaymentStatusSuccess, PaymentStatusAuthorized, PaymentStatusPartiallyCaptured, PaymentStatusPendingCollection, PaymentStatusCollected:
+		return true
+	default:
+		return false
+	}
+}
+
+// ListPaymentRecords returns every payment created in [from, to), oldest
+// first.
+func (s *Service) ListPaymentRecords(ctx context.Context, from, to time.Time) ([]PaymentRecord, error) {
+	intents, err := s.stripeClient.ListPaymentIntents(ctx, ListIntentsInput{CreatedFrom: from, CreatedTo: to})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	records := make([]PaymentRecord, 0, len(intents)+len(s.codPaymentsByID)+len(s.providerPaymentsByID))
+	for _, intent := range intents {
+		record := PaymentRecord{
+			Provider:    ProviderStripe,
+			ProviderRef: intent.ProviderRef,
+			OrderID:     intent.OrderID,
+			Status:      stripeRecordStatus(intent),
+			AmountCents: intent.AmountReceivedCents + intent.AmountCapturableCents,
+			Currency:    strings.ToUpper(intent.Currency),
+			CreatedAt:   intent.CreatedAt,
+		}
+		if paymentID, exists := s.providerToPayment[intent.ProviderRef]; exists {
+			record.PaymentID = paymentID
+			if record.OrderID == "" {
+				record.OrderID = s.paymentsByID[paymentID].OrderID
+			}
+		}
+		records = append(records, record)
+	}
+	for _, payment := range s.codPaymentsByID {
+		if payment.CreatedAt.Before(from) || !payment.CreatedAt.Before(to) {
+			continue
+		}
+		record := PaymentRecord{
+			Provider:    ProviderCOD,
+			ProviderRef: payment.ProviderRef,
+			PaymentID:   payment.ID,
+			OrderID:     payment.OrderID,
+			Status:      payment.Status,
+			AmountCents: payment.AmountCents,
+			Currency:    payment.Currency,
+			CreatedAt:   payment.CreatedAt,
+		}
+		if payment.Status == PaymentStatusCollected {
+			record.AmountCents = payment.CollectedCents
+		}
+		records = append(records, record)
+	}
+	for _, payment := range s.providerPaymentsByID {
+		if payment.CreatedAt.Before(from) || !payment.CreatedAt.Before(to) {
+			continue
+		}
+		records = append(records, PaymentRecord{
+			Provider:    payment.Provider,
+			ProviderRef: payment.ProviderRef,
+			PaymentID:   payment.ID,
+			OrderID:     payment.OrderID,
+			Status:      payment.Status,
+			AmountCents: payment.AmountCents,
+			Currency:    payment.Currency,
+			CreatedAt:   payment.CreatedAt,
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.Before(records[j].CreatedAt)
+		}
+		return records[i].ProviderRef < records[j].ProviderRef
+	})
+	return records, nil
+}
+
+// stripeRecordStatus maps a Stripe intent status onto the PaymentStatus
+// constants. A cancelled intent that captured part of its amount counts as
+// succeeded, as it does for the payment itself.
+func stripeRecordStatus(intent IntentRecord) string {
+	switch stripe.PaymentIntentStatus(intent.Status) {
+	case stripe.PaymentIntentStatusSucceeded:
+		return PaymentStatusSuccess
+	case stripe.PaymentIntentStatusRequiresCapture:
+		return PaymentStatusAuthorized
+	case stripe.PaymentIntentStatusRequiresAction:
+		return PaymentStatusRequiresAction
+	case stripe.PaymentIntentStatusProcessing:
+		return PaymentStatusProcessing
+	case stripe.PaymentIntentStatusCanceled:
+		if intent.AmountReceivedCents > 0 {
+			return PaymentStatusSuccess
+		}
+		return PaymentStatusCancelled
+	default:
+		return PaymentStatusPending
+	}
+}
+
+// SettlePaymentRecord applies a settled provider payment whose notification
+// never reached the order, as if it had just arrived: the payment is updated
+// and the order marked paid, or COD confirmed while cash is still due.
+func (s *Service) SettlePaymentRecord(ctx context.Context, record PaymentRecord) error {
+	if !record.Settled() {
+		return ErrPaymentNotSettled
+	}
+
+	switch normalizeProviderName(record.Provider) {
+	case ProviderStripe:
+		eventType := stripeEventIntentSucceeded
+		if record.Status != PaymentStatusSuccess {
+			eventType = stripeEventIntentAmountCapturable
+		}
+		_, err := s.applySyntheticIntentEvent("reconcile_"+record.ProviderRef, eventType, record.ProviderRef, record.AmountCents)
+		return err
+	case ProviderCOD:
+		s.mu.Lock()
+		_, exists := s.codByOrderID[strings.TrimSpace(record.OrderID)]
+		s.mu.Unlock()
+		if !exists {
+			return ErrPaymentNotFound
+		}
+		markOrder := s.markOrderCOD
+		if record.Status == PaymentStatusCollected {
+			markOrder = s.markOrderPaid
+		}
+		if markOrder != nil && !markOrder(record.OrderID) {
+			return ErrOrderSyncFailed
+		}
+		return nil
+	default:
+		s.mu.Lock()
+		_, exists := s.providerPaymentsByID[record.PaymentID]
+		s.mu.Unlock()
+		if !exists {
+			return ErrPaymentNotFound
+		}
+		_, err := s.applyProviderStatus(record.PaymentID, record.Status)
+		return err
+	}
+}
@@ -0,0 +1,109 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestListPaymentRecordsAndSettleStuckOrders(t *testing.T) {
+	client := NewMockStripeClient()
+	paid := make(map[string]bool)
+	svc := NewService(Config{
+		StripeClient:          client,
+		MarkOrderPaid:         func(orderID string) bool { paid[orderID] = true; return true },
+		MarkOrderCODConfirmed: func(string) bool { return false },
+	})
+	ctx := context.Background()
+
+	intent, err := svc.CreateStripeIntent(ctx, commerce.Order{
+		ID: "ord_rec_stripe", Status: commerce.OrderStatusPendingPayment, TotalCents: 6400, Currency: "USD",
+	}, "idem-rec")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	if _, err := svc.ConfirmCODPayment(commerce.Order{
+		ID: "ord_rec_cod", Status: commerce.OrderStatusPendingPayment, TotalCents: 1500, Currency: "USD",
+	}, "idem-rec-cod"); err != nil {
+		t.Fatalf("ConfirmCODPayment() error = %v", err)
+	}
+	client.SetIntentStatus(intent.ProviderRef, stripe.PaymentIntentStatusRequiresCapture)
+
+	from, to := time.Now().UTC().Add(-time.Hour), time.Now().UTC().Add(time.Hour)
+	records, err := svc.ListPaymentRecords(ctx, from, to)
+	if err != nil {
+		t.Fatalf("ListPaymentRecords() error = %v", err)
+	}
+	byProvider := make(map[string]PaymentRecord)
+	for _, record := range records {
+		byProvider[record.Provider] = record
+	}
+	stripeRecord := byProvider[ProviderStripe]
+	if len(records) != 2 || stripeRecord.Status != PaymentStatusAuthorized || stripeRecord.AmountCents != 6400 ||
+		stripeRecord.Currency != "USD" || stripeRecord.OrderID != "ord_rec_stripe" || stripeRecord.PaymentID != intent.ID {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	if cod := byProvider[ProviderCOD]; cod.Status != PaymentStatusPendingCollection || !cod.Settled() {
+		t.Fatalf("expected COD collection record, got %+v", cod)
+	}
+	if outside, _ := svc.ListPaymentRecords(ctx, to, to.Add(time.Hour)); len(outside) != 0 {
+		t.Fatalf("expected no records outside the window, got %+v", outside)
+	}
+
+	if err := svc.SettlePaymentRecord(ctx, stripeRecord); err != nil {
+		t.Fatalf("SettlePaymentRecord() error = %v", err)
+	}
+	if payment := svc.paymentsByID[intent.ID]; payment.Status != PaymentStatusAuthorized || !paid["ord_rec_stripe"] {
+		t.Fatalf("expected payment authorized and order paid, got %s paid=%v", payment.Status, paid)
+	}
+	if err := svc.SettlePaymentRecord(ctx, byProvider[ProviderCOD]); !errors.Is(err, ErrOrderSyncFailed) {
+		t.Fatalf("expected ErrOrderSyncFailed from the COD order, got %v", err)
+	}
+	if err := svc.SettlePaymentRecord(ctx, PaymentRecord{Provider: ProviderStripe, Status: PaymentStatusPending}); !errors.Is(err, ErrPaymentNotSettled) {
+		t.Fatalf("expected ErrPaymentNotSettled, got %v", err)
+	}
+}
+
+func TestLiveStripeClientListsPaymentIntents(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/payment_intents" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"unexpected request"}}`))
+			return
+		}
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object":"list","has_more":false,"data":[` +
+			`{"id":"pi_listed","object":"payment_intent","status":"requires_capture","amount":5000,"amount_received":2000,` +
+			`"amount_capturable":3000,"currency":"usd","created":1791363600,"metadata":{"order_id":"ord_listed"}}]}`))
+	}))
+	defer server.Close()
+
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(server.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+		LeveledLogger:     &stripe.LeveledLogger{Level: stripe.LevelNull},
+	})
+	client := NewLiveStripeClientWithBackend("sk_test_stub", backend)
+
+	from := time.Unix(1791360000, 0).UTC()
+	records, err := client.ListPaymentIntents(context.Background(), ListIntentsInput{CreatedFrom: from, CreatedTo: from.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("ListPaymentIntents() error = %v", err)
+	}
+	if len(records) != 1 || records[0].OrderID != "ord_listed" || records[0].AmountReceivedCents != 2000 ||
+		records[0].AmountCapturableCents != 3000 || records[0].Status != "requires_capture" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	if query.Get("created[gte]") != "1791360000" || query.Get("created[lt]") != "1791446400" {
+		t.Fatalf("expected created range in query, got %v", query)
+	}
+}
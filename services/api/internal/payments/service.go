@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,12 +21,49 @@ const (
 	ProviderStripe                 = "stripe"
 	ProviderCOD                    = "cod"
 	PaymentStatusPending           = "pending"
+	PaymentStatusRequiresAction    = "requires_action"
+	PaymentStatusProcessing        = "processing"
 	PaymentStatusPendingCollection = "pending_collection"
+	PaymentStatusAuthorized        = "authorized"
+	PaymentStatusPartiallyCaptured = "partially_captured"
 	PaymentStatusSuccess           = "succeeded"
 	PaymentStatusFailed            = "failed"
+	PaymentStatusCancelled         = "cancelled"
+	PaymentStatusCollected         = "collected"
+	PaymentStatusRefused           = "refused"
 
-	stripeEventIntentSucceeded = "payment_intent.succeeded"
-	stripeEventIntentFailed    = "payment_intent.payment_failed"
+	CaptureMethodManual = "manual"
+
+	// AttentionAuthorizationExpiring marks an authorization that is about to
+	// lapse and could not be placed again off-session.
+	AttentionAuthorizationExpiring = "authorization_expiring"
+	// AttentionAuthorizationExpired marks an authorization that lapsed with
+	// shipments still waiting to be captured.
+	AttentionAuthorizationExpired = "authorization_expired"
+	// AttentionCaptureFailed marks a shipment capture the provider rejected.
+	AttentionCaptureFailed = "capture_failed"
+	// AttentionTransferFailed marks a vendor transfer that has not gone
+	// through yet; the sweep retries it.
+	AttentionTransferFailed = "transfer_failed"
+
+	// DefaultAuthorizationTTL matches how long card networks hold an
+	// uncaptured authorization.
+	DefaultAuthorizationTTL = 7 * 24 * time.Hour
+	// DefaultReauthorizeWindow is how far ahead of expiry the sweep acts.
+	DefaultReauthorizeWindow = 24 * time.Hour
+	// DefaultPendingPaymentTTL is how long an unconfirmed intent is kept
+	// before the sweep cancels it and expires the order.
+	DefaultPendingPaymentTTL = 24 * time.Hour
+
+	stripeEventIntentSucceeded        = "payment_intent.succeeded"
+	stripeEventIntentFailed           = "payment_intent.payment_failed"
+	stripeEventIntentAmountCapturable = "payment_intent.amount_capturable_updated"
+	stripeEventIntentCanceled         = "payment_intent.canceled"
+	stripeEventIntentRequiresAction   = "payment_intent.requires_action"
+	stripeEventIntentProcessing       = "payment_intent.processing"
+	stripeEventDisputeCreated         = "charge.dispute.created"
+	stripeEventDisputeUpdated         = "charge.dispute.updated"
+	stripeEventDisputeClosed          = "charge.dispute.closed"
 )
 
 var (
@@ -38,28 +77,143 @@ var (
 	ErrInvalidPayload        = errors.New("invalid stripe webhook payload")
 	ErrPaymentNotFound       = errors.New("payment not found")
 	ErrOrderSyncFailed       = errors.New("failed to sync order payment status")
+	ErrPaymentNotCapturable  = errors.New("payment is not capturable")
 )
 
+// Config wires the payment service to order state. AuthorizationTTL,
+// ReauthorizeWindow and PendingPaymentTTL default to DefaultAuthorizationTTL,
+// DefaultReauthorizeWindow and DefaultPendingPaymentTTL when zero;
+// WebhookMaxAttempts and WebhookRetryBackoff default to
+// DefaultWebhookMaxAttempts and DefaultWebhookRetryBackoff, and
+// CODRefusalLimit to DefaultCODRefusalLimit. EventStore defaults to an
+// in-memory store.
 type Config struct {
 	WebhookSecret          string
 	StripeClient           StripeClient
 	MarkOrderPaid          func(orderID string) bool
 	MarkOrderPaymentFailed func(orderID string) bool
 	MarkOrderCODConfirmed  func(orderID string) bool
+	MarkOrderExpired       func(orderID string) bool
+	AuthorizationTTL       time.Duration
+	ReauthorizeWindow      time.Duration
+	PendingPaymentTTL      time.Duration
+	Providers              []Provider
+	EventStore             EventStore
+	WebhookMaxAttempts     int
+	WebhookRetryBackoff    time.Duration
+	CODRefusalLimit        int
 }
 
+// PaymentCapture is the portion of an authorization captured when one vendor
+// shipment shipped.
+type PaymentCapture struct {
+	ShipmentID  string    `json:"shipment_id"`
+	AmountCents int64     `json:"amount_cents"`
+	Final       bool      `json:"final"`
+	CapturedAt  time.Time `json:"captured_at"`
+}
+
+// PaymentRelease is the share of an authorization given up when a vendor
+// shipment was cancelled while other shipments were still open. The provider
+// drops it with the final capture or release; reauthorizations leave it out.
+type PaymentRelease struct {
+	ShipmentID  string    `json:"shipment_id"`
+	AmountCents int64     `json:"amount_cents"`
+	ReleasedAt  time.Time `json:"released_at"`
+}
+
+// StripeIntent is a Stripe payment for one order. Intents are authorized at
+// checkout and captured shipment by shipment as vendors ship.
 type StripeIntent struct {
-	ID           string    `json:"id"`
-	OrderID      string    `json:"order_id"`
-	Method       string    `json:"method"`
-	Status       string    `json:"status"`
-	Provider     string    `json:"provider"`
-	ProviderRef  string    `json:"provider_ref"`
-	ClientSecret string    `json:"client_secret"`
-	AmountCents  int64     `json:"amount_cents"`
-	Currency     string    `json:"currency"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                     string           `json:"id"`
+	OrderID                string           `json:"order_id"`
+	Method                 string           `json:"method"`
+	Status                 string           `json:"status"`
+	Provider               string           `json:"provider"`
+	ProviderRef            string           `json:"provider_ref"`
+	ClientSecret           string           `json:"client_secret"`
+	AmountCents            int64            `json:"amount_cents"`
+	Currency               string           `json:"currency"`
+	CaptureMethod          string           `json:"capture_method"`
+	CapturedCents          int64            `json:"captured_cents"`
+	Captures               []PaymentCapture `json:"captures"`
+	ReleasedCents          int64            `json:"released_cents"`
+	Releases               []PaymentRelease `json:"releases"`
+	AuthorizedAt           *time.Time       `json:"authorized_at,omitempty"`
+	AuthorizationExpiresAt *time.Time       `json:"authorization_expires_at,omitempty"`
+	Reauthorizations       int              `json:"reauthorizations"`
+	Transfers              []VendorTransfer `json:"transfers"`
+	Attention              string           `json:"attention,omitempty"`
+	CreatedAt              time.Time        `json:"created_at"`
+	UpdatedAt              time.Time        `json:"updated_at"`
+
+	// earlierIntentsCapturedCents is what was captured on intents since
+	// replaced by reauthorizations; the provider reports the current intent's
+	// captures alone.
+	earlierIntentsCapturedCents int64
+	// waitingHolds are dispute holds on shipments whose transfer was not
+	// sent yet; each is placed when its shipment's transfer goes out.
+	waitingHolds []ShipmentRefundInput
+}
+
+// UncapturedCents is the authorized amount still waiting to be captured,
+// leaving out the shares of cancelled shipments.
+func (i StripeIntent) UncapturedCents() int64 {
+	if i.AmountCents <= i.CapturedCents+i.ReleasedCents {
+		return 0
+	}
+	return i.AmountCents - i.CapturedCents - i.ReleasedCents
+}
+
+// CaptureShipmentInput requests capture of one shipment's share of an order
+// authorization. Final is set when no other shipment is left to capture, so
+// the provider releases anything still uncaptured. When Destination names the
+// vendor's connected account, the captured amount less ApplicationFeeCents is
+// transferred to it.
+type CaptureShipmentInput struct {
+	OrderID             string
+	ShipmentID          string
+	AmountCents         int64
+	Final               bool
+	VendorID            string
+	Destination         string
+	ApplicationFeeCents int64
+}
+
+// ShipmentCharges splits the order's charged total across its shipments in
+// proportion to their totals, so order-level discounts lower every vendor's
+// capture rather than the last one. Rounding is settled on the last shipment.
+func ShipmentCharges(order commerce.Order) map[string]int64 {
+	shipmentsTotal := int64(0)
+	last := -1
+	for index, shipment := range order.Shipments {
+		if shipment.TotalCents > 0 {
+			shipmentsTotal += shipment.TotalCents
+			last = index
+		}
+	}
+
+	charges := make(map[string]int64, len(order.Shipments))
+	allocated := int64(0)
+	for index, shipment := range order.Shipments {
+		if shipment.TotalCents <= 0 {
+			continue
+		}
+		share := order.TotalCents * shipment.TotalCents / shipmentsTotal
+		if index == last {
+			share = order.TotalCents - allocated
+		}
+		allocated += share
+		charges[shipment.ID] = share
+	}
+	return charges
+}
+
+// AuthorizationSweepResult summarises one pass over expiring authorizations.
+type AuthorizationSweepResult struct {
+	Checked      int `json:"checked"`
+	Reauthorized int `json:"reauthorized"`
+	Flagged      int `json:"flagged"`
 }
 
 type WebhookResult struct {
@@ -69,51 +223,81 @@ type WebhookResult struct {
 	PaymentID     string `json:"payment_id,omitempty"`
 	OrderID       string `json:"order_id,omitempty"`
 	PaymentStatus string `json:"payment_status,omitempty"`
+	DisputeRef    string `json:"dispute_ref,omitempty"`
 }
 
+// CODPayment is a cash-on-delivery payment for one order. Cash is collected
+// shipment by shipment; the payment stays pending_collection until the last
+// shipment is collected or refused.
 type CODPayment struct {
-	ID          string    `json:"id"`
-	OrderID     string    `json:"order_id"`
-	Method      string    `json:"method"`
-	Status      string    `json:"status"`
-	Provider    string    `json:"provider"`
-	ProviderRef string    `json:"provider_ref"`
-	AmountCents int64     `json:"amount_cents"`
-	Currency    string    `json:"currency"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             string          `json:"id"`
+	OrderID        string          `json:"order_id"`
+	Method         string          `json:"method"`
+	Status         string          `json:"status"`
+	Provider       string          `json:"provider"`
+	ProviderRef    string          `json:"provider_ref"`
+	AmountCents    int64           `json:"amount_cents"`
+	Currency       string          `json:"currency"`
+	CollectedCents int64           `json:"collected_cents"`
+	Collections    []CODCollection `json:"collections"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	buyerRef string
 }
 
+// PaymentSettings toggles payment methods. Providers is keyed by provider name
+// and always includes stripe and cod, mirroring StripeEnabled and CODEnabled.
 type PaymentSettings struct {
-	StripeEnabled bool      `json:"stripe_enabled"`
-	CODEnabled    bool      `json:"cod_enabled"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	StripeEnabled bool            `json:"stripe_enabled"`
+	CODEnabled    bool            `json:"cod_enabled"`
+	Providers     map[string]bool `json:"providers"`
+	UpdatedAt     time.Time       `json:"updated_at"`
 }
 
 type PaymentSettingsUpdate struct {
-	StripeEnabled *bool `json:"stripe_enabled,omitempty"`
-	CODEnabled    *bool `json:"cod_enabled,omitempty"`
+	StripeEnabled *bool           `json:"stripe_enabled,omitempty"`
+	CODEnabled    *bool           `json:"cod_enabled,omitempty"`
+	Providers     map[string]bool `json:"providers,omitempty"`
 }
 
 type Service struct {
-	mu              sync.Mutex
-	webhookSecret   string
-	stripeClient    StripeClient
-	markOrderPaid   func(orderID string) bool
-	markOrderFailed func(orderID string) bool
-	markOrderCOD    func(orderID string) bool
-	now             func() time.Time
+	mu               sync.Mutex
+	webhookSecret    string
+	stripeClient     StripeClient
+	markOrderPaid    func(orderID string) bool
+	markOrderFailed  func(orderID string) bool
+	markOrderCOD     func(orderID string) bool
+	markOrderExpired func(orderID string) bool
+	authTTL          time.Duration
+	reauthWindow     time.Duration
+	pendingTTL       time.Duration
+	now              func() time.Time
 
 	paymentsByID      map[string]StripeIntent
 	orderToPaymentID  map[string]string
 	intentByRequestID map[string]string
 	providerToPayment map[string]string
-	processedEvents   map[string]struct{}
 	processingEvents  map[string]struct{}
+	events            EventStore
+	eventMaxAttempts  int
+	eventBackoff      time.Duration
 	codPaymentsByID   map[string]CODPayment
 	codByRequestID    map[string]string
 	codByOrderID      map[string]string
+	codBalances       map[string]CODVendorBalance
+	codRefusals       map[string]map[string]time.Time
+	codRefusalLimit   int
 	settings          PaymentSettings
+
+	providers                  map[string]Provider
+	providerPaymentsByID       map[string]ProviderPayment
+	providerPaymentByRequest   map[string]string
+	providerPaymentByOrder     map[string]string
+	providerPaymentByRef       map[string]string
+	capturablePaymentByOrderID map[string]string
+
+	disputeEvent func(event DisputeEvent) bool
 }
 
 type stripeWebhookEnvelope struct {
@@ -125,7 +309,8 @@ type stripeWebhookEnvelope struct {
 }
 
 type stripeWebhookPaymentIntent struct {
-	ID string `json:"id"`
+	ID             string `json:"id"`
+	AmountReceived int64  `json:"amount_received"`
 }
 
 func NewService(cfg Config) *Service {
@@ -134,6 +319,49 @@ func NewService(cfg Config) *Service {
 		client = NewMockStripeClient()
 	}
 	nowFn := func() time.Time { return time.Now().UTC() }
+	authTTL := cfg.AuthorizationTTL
+	if authTTL <= 0 {
+		authTTL = DefaultAuthorizationTTL
+	}
+	reauthWindow := cfg.ReauthorizeWindow
+	if reauthWindow <= 0 {
+		reauthWindow = DefaultReauthorizeWindow
+	}
+	pendingTTL := cfg.PendingPaymentTTL
+	if pendingTTL <= 0 {
+		pendingTTL = DefaultPendingPaymentTTL
+	}
+
+	events := cfg.EventStore
+	if events == nil {
+		events = NewMemoryEventStore()
+	}
+	eventMaxAttempts := cfg.WebhookMaxAttempts
+	if eventMaxAttempts <= 0 {
+		eventMaxAttempts = DefaultWebhookMaxAttempts
+	}
+	eventBackoff := cfg.WebhookRetryBackoff
+	if eventBackoff <= 0 {
+		eventBackoff = DefaultWebhookRetryBackoff
+	}
+	codRefusalLimit := cfg.CODRefusalLimit
+	if codRefusalLimit <= 0 {
+		codRefusalLimit = DefaultCODRefusalLimit
+	}
+
+	providers := make(map[string]Provider, len(cfg.Providers))
+	enabled := map[string]bool{ProviderStripe: true, ProviderCOD: true}
+	for _, provider := range cfg.Providers {
+		if provider == nil {
+			continue
+		}
+		name := normalizeProviderName(provider.Name())
+		if name == "" || name == ProviderStripe || name == ProviderCOD {
+			continue
+		}
+		providers[name] = provider
+		enabled[name] = true
+	}
 
 	return &Service{
 		webhookSecret:     strings.TrimSpace(cfg.WebhookSecret),
@@ -141,21 +369,37 @@ func NewService(cfg Config) *Service {
 		markOrderPaid:     cfg.MarkOrderPaid,
 		markOrderFailed:   cfg.MarkOrderPaymentFailed,
 		markOrderCOD:      cfg.MarkOrderCODConfirmed,
+		markOrderExpired:  cfg.MarkOrderExpired,
+		authTTL:           authTTL,
+		reauthWindow:      reauthWindow,
+		pendingTTL:        pendingTTL,
 		now:               nowFn,
 		paymentsByID:      make(map[string]StripeIntent),
 		orderToPaymentID:  make(map[string]string),
 		intentByRequestID: make(map[string]string),
 		providerToPayment: make(map[string]string),
-		processedEvents:   make(map[string]struct{}),
 		processingEvents:  make(map[string]struct{}),
+		events:            events,
+		eventMaxAttempts:  eventMaxAttempts,
+		eventBackoff:      eventBackoff,
 		codPaymentsByID:   make(map[string]CODPayment),
 		codByRequestID:    make(map[string]string),
 		codByOrderID:      make(map[string]string),
+		codBalances:       make(map[string]CODVendorBalance),
+		codRefusals:       make(map[string]map[string]time.Time),
+		codRefusalLimit:   codRefusalLimit,
 		settings: PaymentSettings{
 			StripeEnabled: true,
 			CODEnabled:    true,
+			Providers:     enabled,
 			UpdatedAt:     nowFn(),
 		},
+		providers:                  providers,
+		providerPaymentsByID:       make(map[string]ProviderPayment),
+		providerPaymentByRequest:   make(map[string]string),
+		providerPaymentByOrder:     make(map[string]string),
+		providerPaymentByRef:       make(map[string]string),
+		capturablePaymentByOrderID: make(map[string]string),
 	}
 }
 
@@ -201,6 +445,7 @@ func (s *Service) CreateStripeIntent(ctx context.Context, order commerce.Order,
 		OrderID:        orderID,
 		AmountCents:    order.TotalCents,
 		Currency:       order.Currency,
+		TransferGroup:  orderID,
 		IdempotencyKey: normalizedKey,
 	})
 	if err != nil {
@@ -212,17 +457,21 @@ func (s *Service) CreateStripeIntent(ctx context.Context, order commerce.Order,
 
 	now := s.now()
 	intent := StripeIntent{
-		ID:           identifier.New("pay"),
-		OrderID:      orderID,
-		Method:       MethodStripe,
-		Status:       PaymentStatusPending,
-		Provider:     ProviderStripe,
-		ProviderRef:  strings.TrimSpace(gatewayResult.ProviderRef),
-		ClientSecret: strings.TrimSpace(gatewayResult.ClientSecret),
-		AmountCents:  order.TotalCents,
-		Currency:     order.Currency,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+		ID:            identifier.New("pay"),
+		OrderID:       orderID,
+		Method:        MethodStripe,
+		Status:        PaymentStatusPending,
+		Provider:      ProviderStripe,
+		ProviderRef:   strings.TrimSpace(gatewayResult.ProviderRef),
+		ClientSecret:  strings.TrimSpace(gatewayResult.ClientSecret),
+		AmountCents:   order.TotalCents,
+		Currency:      order.Currency,
+		CaptureMethod: CaptureMethodManual,
+		Captures:      []PaymentCapture{},
+		Releases:      []PaymentRelease{},
+		Transfers:     []VendorTransfer{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	}
 
 	s.mu.Lock()
@@ -280,6 +529,11 @@ func (s *Service) ConfirmCODPayment(order commerce.Order, idempotencyKey string)
 		s.mu.Unlock()
 		return CODPayment{}, ErrCODDisabled
 	}
+	buyerRef := codBuyerRef(order)
+	if s.codBuyerFlaggedLocked(buyerRef) {
+		s.mu.Unlock()
+		return CODPayment{}, ErrCODBuyerFlagged
+	}
 
 	now := s.now()
 	payment := CODPayment{
@@ -291,8 +545,10 @@ func (s *Service) ConfirmCODPayment(order commerce.Order, idempotencyKey string)
 		ProviderRef: identifier.New("cod"),
 		AmountCents: order.TotalCents,
 		Currency:    order.Currency,
+		Collections: []CODCollection{},
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		buyerRef:    buyerRef,
 	}
 
 	s.codPaymentsByID[payment.ID] = payment
@@ -311,9 +567,12 @@ func (s *Service) GetSettings() PaymentSettings {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.settings
+	return s.settingsSnapshotLocked()
 }
 
+// UpdateSettings applies the given toggles. Provider entries for names that
+// are not configured are ignored; stripe and cod entries behave like
+// StripeEnabled and CODEnabled.
 func (s *Service) UpdateSettings(update PaymentSettingsUpdate) PaymentSettings {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -327,11 +586,46 @@ func (s *Service) UpdateSettings(update PaymentSettingsUpdate) PaymentSettings {
 		s.settings.CODEnabled = *update.CODEnabled
 		changed = true
 	}
+	for name, enabled := range update.Providers {
+		name = normalizeProviderName(name)
+		switch name {
+		case ProviderStripe:
+			s.settings.StripeEnabled = enabled
+		case ProviderCOD:
+			s.settings.CODEnabled = enabled
+		default:
+			if _, exists := s.providers[name]; !exists {
+				continue
+			}
+			s.settings.Providers[name] = enabled
+		}
+		changed = true
+	}
+	s.settings.Providers[ProviderStripe] = s.settings.StripeEnabled
+	s.settings.Providers[ProviderCOD] = s.settings.CODEnabled
 	if changed {
 		s.settings.UpdatedAt = s.now()
 	}
 
-	return s.settings
+	return s.settingsSnapshotLocked()
+}
+
+// HasProvider reports whether name is stripe, cod or a configured provider.
+func (s *Service) HasProvider(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.settings.Providers[normalizeProviderName(name)]
+	return exists
+}
+
+func (s *Service) settingsSnapshotLocked() PaymentSettings {
+	settings := s.settings
+	settings.Providers = make(map[string]bool, len(s.settings.Providers))
+	for name, enabled := range s.settings.Providers {
+		settings.Providers[name] = enabled
+	}
+	return settings
 }
 
 func (s *Service) HandleStripeWebhook(payload []byte, signatureHeader string) (WebhookResult, error) {
@@ -353,20 +647,37 @@ func (s *Service) HandleStripeWebhook(payload []byte, signatureHeader string) (W
 		return WebhookResult{}, ErrInvalidPayload
 	}
 
-	if !s.startEventProcessing(event.ID) {
+	stored, fresh, err := s.receiveEvent(WebhookEvent{
+		Provider:        ProviderStripe,
+		ProviderEventID: event.ID,
+		EventType:       strings.TrimSpace(event.Type),
+		Payload:         string(payload),
+	})
+	if err != nil {
+		return WebhookResult{}, err
+	}
+	if !fresh {
 		return WebhookResult{
 			EventID:   event.ID,
 			Processed: false,
 			Duplicate: true,
 		}, nil
 	}
-	processed := false
-	defer s.finishEventProcessing(event.ID, &processed)
 
+	result, err := s.processStripeEvent(event)
+	s.finishEvent(stored, result, err)
+	return result, err
+}
+
+// processStripeEvent applies one verified Stripe event. It is shared by live
+// deliveries, retries and admin replays.
+func (s *Service) processStripeEvent(event stripeWebhookEnvelope) (WebhookResult, error) {
 	switch event.Type {
-	case stripeEventIntentSucceeded, stripeEventIntentFailed:
+	case stripeEventIntentSucceeded, stripeEventIntentFailed, stripeEventIntentAmountCapturable, stripeEventIntentCanceled,
+		stripeEventIntentRequiresAction, stripeEventIntentProcessing:
+	case stripeEventDisputeCreated, stripeEventDisputeUpdated, stripeEventDisputeClosed:
+		return s.applyDisputeEvent(event)
 	default:
-		processed = true
 		return WebhookResult{
 			EventID:   event.ID,
 			Processed: false,
@@ -392,11 +703,32 @@ func (s *Service) HandleStripeWebhook(payload []byte, signatureHeader string) (W
 	payment := s.paymentsByID[paymentID]
 	s.mu.Unlock()
 
-	nextStatus := PaymentStatusSuccess
-	markOrder := s.markOrderPaid
-	if event.Type == stripeEventIntentFailed {
-		nextStatus = PaymentStatusFailed
+	// Events for an intent replaced by a reauthorization no longer describe
+	// the payment, most notably the cancellation of the old intent.
+	if payment.ProviderRef != providerRef {
+		return WebhookResult{
+			EventID:   event.ID,
+			Processed: false,
+			Duplicate: false,
+			PaymentID: payment.ID,
+			OrderID:   payment.OrderID,
+		}, nil
+	}
+
+	var markOrder func(orderID string) bool
+	switch event.Type {
+	case stripeEventIntentSucceeded:
+		markOrder = s.markOrderPaid
+	case stripeEventIntentFailed:
 		markOrder = s.markOrderFailed
+	case stripeEventIntentAmountCapturable:
+		if isAwaitingConfirmation(payment.Status) {
+			markOrder = s.markOrderPaid
+		}
+	case stripeEventIntentCanceled:
+		if isAwaitingConfirmation(payment.Status) {
+			markOrder = s.markOrderExpired
+		}
 	}
 
 	if markOrder != nil {
@@ -407,11 +739,9 @@ func (s *Service) HandleStripeWebhook(payload []byte, signatureHeader string) (W
 
 	s.mu.Lock()
 	payment = s.paymentsByID[paymentID]
-	payment.Status = nextStatus
-	payment.UpdatedAt = s.now()
+	s.applyIntentEventLocked(&payment, event.Type, intent)
 	s.paymentsByID[paymentID] = payment
 	s.mu.Unlock()
-	processed = true
 
 	return WebhookResult{
 		EventID:       event.ID,
@@ -423,27 +753,373 @@ func (s *Service) HandleStripeWebhook(payload []byte, signatureHeader string) (W
 	}, nil
 }
 
-func (s *Service) startEventProcessing(eventID string) bool {
+func (s *Service) applyIntentEventLocked(payment *StripeIntent, eventType string, intent stripeWebhookPaymentIntent) {
+	now := s.now()
+	switch eventType {
+	case stripeEventIntentSucceeded:
+		payment.Status = PaymentStatusSuccess
+		if received := payment.earlierIntentsCapturedCents + intent.AmountReceived; received > payment.CapturedCents {
+			payment.CapturedCents = received
+		}
+	case stripeEventIntentFailed:
+		payment.Status = PaymentStatusFailed
+	case stripeEventIntentRequiresAction, stripeEventIntentProcessing:
+		// Stripe may deliver these after the payment moved on; only an
+		// unconfirmed payment takes them.
+		if !isAwaitingConfirmation(payment.Status) {
+			return
+		}
+		payment.Status = PaymentStatusRequiresAction
+		if eventType == stripeEventIntentProcessing {
+			payment.Status = PaymentStatusProcessing
+		}
+	case stripeEventIntentAmountCapturable:
+		if !isAwaitingConfirmation(payment.Status) {
+			return
+		}
+		expiresAt := now.Add(s.authTTL)
+		payment.Status = PaymentStatusAuthorized
+		payment.AuthorizedAt = &now
+		payment.AuthorizationExpiresAt = &expiresAt
+	case stripeEventIntentCanceled:
+		if isAwaitingConfirmation(payment.Status) {
+			// The buyer never completed the payment; the order expires.
+			payment.Status = PaymentStatusCancelled
+			break
+		}
+		if !isCapturable(payment.Status) {
+			return
+		}
+		// The provider dropped an authorization we still meant to capture.
+		payment.Attention = AttentionAuthorizationExpired
+		payment.Status = PaymentStatusCancelled
+		if payment.CapturedCents > 0 {
+			payment.Status = PaymentStatusSuccess
+		}
+	}
+	payment.UpdatedAt = now
+}
+
+// CaptureShipment captures one shipment's share of the order authorization.
+// The amount is capped at what remains uncaptured. Repeated calls for the same
+// shipment return the payment without capturing again.
+func (s *Service) CaptureShipment(ctx context.Context, input CaptureShipmentInput) (StripeIntent, error) {
+	orderID := strings.TrimSpace(input.OrderID)
+	shipmentID := strings.TrimSpace(input.ShipmentID)
+	if orderID == "" || shipmentID == "" || input.AmountCents <= 0 {
+		return StripeIntent{}, ErrInvalidOrder
+	}
+
+	s.mu.Lock()
+	paymentID, exists := s.orderToPaymentID[orderID]
+	if !exists {
+		s.mu.Unlock()
+		return StripeIntent{}, ErrPaymentNotFound
+	}
+	payment := s.paymentsByID[paymentID]
+	if hasShipmentCapture(payment, shipmentID) {
+		s.mu.Unlock()
+		return payment, nil
+	}
+	if !isCapturable(payment.Status) || payment.UncapturedCents() <= 0 {
+		s.mu.Unlock()
+		return payment, ErrPaymentNotCapturable
+	}
+	amount := input.AmountCents
+	if amount > payment.UncapturedCents() {
+		amount = payment.UncapturedCents()
+	}
+	final := input.Final || amount == payment.UncapturedCents()
+	s.mu.Unlock()
+
+	err := s.stripeClient.CapturePaymentIntent(ctx, CaptureIntentInput{
+		ProviderRef:    payment.ProviderRef,
+		AmountCents:    amount,
+		FinalCapture:   final,
+		IdempotencyKey: "capture_" + payment.ID + "_" + shipmentID,
+	})
+
+	s.mu.Lock()
+	payment = s.paymentsByID[paymentID]
+	payment.UpdatedAt = s.now()
+	if err != nil {
+		payment.Attention = AttentionCaptureFailed
+		s.paymentsByID[paymentID] = payment
+		s.mu.Unlock()
+		return payment, err
+	}
+	if hasShipmentCapture(payment, shipmentID) {
+		s.mu.Unlock()
+		return payment, nil
+	}
+
+	payment.Captures = append(payment.Captures, PaymentCapture{
+		ShipmentID:  shipmentID,
+		AmountCents: amount,
+		Final:       final,
+		CapturedAt:  payment.UpdatedAt,
+	})
+	payment.CapturedCents += amount
+	payment.Status = PaymentStatusPartiallyCaptured
+	if final {
+		payment.Status = PaymentStatusSuccess
+	}
+	if payment.Attention == AttentionCaptureFailed {
+		payment.Attention = ""
+	}
+	transferPending := queueVendorTransfer(&payment, input, amount)
+	if transferPending {
+		s.offsetCODCommissionLocked(&payment, shipmentID)
+	}
+	s.paymentsByID[paymentID] = payment
+	s.mu.Unlock()
+
+	if transferPending {
+		return s.sendVendorTransfer(ctx, paymentID, shipmentID)
+	}
+	return payment, nil
+}
+
+// ReleaseShipment records that a cancelled shipment's share of the order
+// authorization will not be captured while other shipments are still open.
+// The share is left out of later reauthorizations, and the capture of the
+// last open shipment becomes final so the provider drops it. Repeated calls
+// for the same shipment return the payment unchanged.
+func (s *Service) ReleaseShipment(orderID, shipmentID string, amountCents int64) (StripeIntent, error) {
+	orderID = strings.TrimSpace(orderID)
+	shipmentID = strings.TrimSpace(shipmentID)
+	if orderID == "" || shipmentID == "" || amountCents <= 0 {
+		return StripeIntent{}, ErrInvalidOrder
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	paymentID, exists := s.orderToPaymentID[orderID]
+	if !exists {
+		return StripeIntent{}, ErrPaymentNotFound
+	}
+	payment := s.paymentsByID[paymentID]
+	if hasShipmentRelease(payment.Releases, shipmentID) {
+		return payment, nil
+	}
+	if !isCapturable(payment.Status) {
+		return payment, ErrPaymentNotCapturable
+	}
+	amount := min(amountCents, payment.UncapturedCents())
+	payment.UpdatedAt = s.now()
+	payment.Releases = append(payment.Releases, PaymentRelease{
+		ShipmentID:  shipmentID,
+		AmountCents: amount,
+		ReleasedAt:  payment.UpdatedAt,
+	})
+	payment.ReleasedCents += amount
+	s.paymentsByID[paymentID] = payment
+	return payment, nil
+}
 
-	if _, exists := s.processedEvents[eventID]; exists {
-		return false
+func hasShipmentRelease(releases []PaymentRelease, shipmentID string) bool {
+	for _, release := range releases {
+		if release.ShipmentID == shipmentID {
+			return true
+		}
 	}
-	if _, exists := s.processingEvents[eventID]; exists {
-		return false
+	return false
+}
+
+// ReleaseAuthorization voids whatever remains uncaptured on the order's
+// authorization, for when the remaining shipments were cancelled. Captured
+// amounts are kept.
+func (s *Service) ReleaseAuthorization(ctx context.Context, orderID string) (StripeIntent, error) {
+	s.mu.Lock()
+	paymentID, exists := s.orderToPaymentID[strings.TrimSpace(orderID)]
+	if !exists {
+		s.mu.Unlock()
+		return StripeIntent{}, ErrPaymentNotFound
+	}
+	payment := s.paymentsByID[paymentID]
+	if !isCapturable(payment.Status) {
+		s.mu.Unlock()
+		return payment, ErrPaymentNotCapturable
+	}
+	s.mu.Unlock()
+
+	if err := s.stripeClient.CancelPaymentIntent(ctx, payment.ProviderRef, "release_"+payment.ID); err != nil {
+		return payment, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payment = s.paymentsByID[paymentID]
+	if !isCapturable(payment.Status) {
+		return payment, nil
 	}
-	s.processingEvents[eventID] = struct{}{}
+	payment.Status = PaymentStatusCancelled
+	if payment.CapturedCents > 0 {
+		payment.Status = PaymentStatusSuccess
+	}
+	payment.UpdatedAt = s.now()
+	s.paymentsByID[paymentID] = payment
 
-	return true
+	return payment, nil
 }
 
-func (s *Service) finishEventProcessing(eventID string, processed *bool) {
+// ListAuthorizations returns open authorizations and payments flagged for
+// attention, soonest expiry first. flaggedOnly limits the list to the latter.
+func (s *Service) ListAuthorizations(flaggedOnly bool) []StripeIntent {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.processingEvents, eventID)
-	if processed != nil && *processed {
-		s.processedEvents[eventID] = struct{}{}
+	items := make([]StripeIntent, 0)
+	for _, payment := range s.paymentsByID {
+		if payment.Attention == "" && (flaggedOnly || !isCapturable(payment.Status)) {
+			continue
+		}
+		items = append(items, payment)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		left, right := items[i].AuthorizationExpiresAt, items[j].AuthorizationExpiresAt
+		if left != nil && right != nil && !left.Equal(*right) {
+			return left.Before(*right)
+		}
+		if (left == nil) != (right == nil) {
+			return left != nil
+		}
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+
+	return items
+}
+
+// SweepAuthorizations reauthorizes open authorizations that expire within the
+// reauthorize window. Authorizations that cannot be placed again are flagged
+// for attention, as are ones that already lapsed.
+func (s *Service) SweepAuthorizations(ctx context.Context) AuthorizationSweepResult {
+	now := s.now()
+	result := AuthorizationSweepResult{}
+
+	s.mu.Lock()
+	due := make([]StripeIntent, 0)
+	for _, payment := range s.paymentsByID {
+		if !isCapturable(payment.Status) || payment.AuthorizationExpiresAt == nil {
+			continue
+		}
+		result.Checked++
+		if payment.AuthorizationExpiresAt.Sub(now) > s.reauthWindow || payment.Attention == AttentionAuthorizationExpired {
+			continue
+		}
+		due = append(due, payment)
+	}
+	s.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].AuthorizationExpiresAt.Before(*due[j].AuthorizationExpiresAt)
+	})
+
+	for _, payment := range due {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var (
+			gatewayResult StripeIntentResult
+			err           error
+		)
+		expired := !now.Before(*payment.AuthorizationExpiresAt)
+		if !expired {
+			gatewayResult, err = s.stripeClient.ReauthorizePaymentIntent(ctx, ReauthorizeIntentInput{
+				ProviderRef:    payment.ProviderRef,
+				OrderID:        payment.OrderID,
+				AmountCents:    payment.UncapturedCents(),
+				Currency:       payment.Currency,
+				IdempotencyKey: "reauth_" + payment.ID + "_" + strconv.Itoa(payment.Reauthorizations+1),
+			})
+			if err == nil && strings.TrimSpace(gatewayResult.ProviderRef) == "" {
+				err = ErrInvalidPayload
+			}
+		}
+
+		s.mu.Lock()
+		current := s.paymentsByID[payment.ID]
+		if current.ProviderRef != payment.ProviderRef || !isCapturable(current.Status) {
+			s.mu.Unlock()
+			continue
+		}
+		current.UpdatedAt = s.now()
+		switch {
+		case expired:
+			current.Attention = AttentionAuthorizationExpired
+			result.Flagged++
+		case err != nil:
+			current.Attention = AttentionAuthorizationExpiring
+			result.Flagged++
+		default:
+			authorizedAt := current.UpdatedAt
+			expiresAt := authorizedAt.Add(s.authTTL)
+			current.earlierIntentsCapturedCents = current.CapturedCents
+			current.ProviderRef = strings.TrimSpace(gatewayResult.ProviderRef)
+			current.ClientSecret = strings.TrimSpace(gatewayResult.ClientSecret)
+			current.AuthorizedAt = &authorizedAt
+			current.AuthorizationExpiresAt = &expiresAt
+			current.Reauthorizations++
+			current.Attention = ""
+			s.providerToPayment[current.ProviderRef] = current.ID
+			result.Reauthorized++
+		}
+		s.paymentsByID[current.ID] = current
+		s.mu.Unlock()
+	}
+
+	return result
+}
+
+// Run sweeps expiring authorizations, expires stale unconfirmed payments and
+// retries failed vendor transfers every interval in the background until ctx
+// is cancelled. The returned channel is closed once the sweeps have stopped.
+func (s *Service) Run(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.SweepAuthorizations(ctx)
+				s.ExpireStalePayments(ctx)
+				s.RetryVendorTransfers(ctx)
+			}
+		}
+	}()
+	return done
+}
+
+func isCapturable(status string) bool {
+	return status == PaymentStatusAuthorized || status == PaymentStatusPartiallyCaptured
+}
+
+// isAwaitingConfirmation reports whether an intent has not been authorized
+// yet: the buyer still has to confirm it, complete 3-D Secure, or retry after
+// a failure, or the provider is still processing it.
+func isAwaitingConfirmation(status string) bool {
+	switch status {
+	case PaymentStatusPending, PaymentStatusRequiresAction, PaymentStatusProcessing, PaymentStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+func hasShipmentCapture(payment StripeIntent, shipmentID string) bool {
+	for _, capture := range payment.Captures {
+		if capture.ShipmentID == shipmentID {
+			return true
+		}
 	}
+	return false
 }
@@ -461,16 +461,229 @@ func TestPaymentSettingsDisableStripeAndCOD(t *testing.T) {
 	}
 }
 
+func TestAuthorizedPaymentCapturesPerShipmentAndReleasesRemainder(t *testing.T) {
+	var markedPaid []string
+	client := NewMockStripeClient()
+	svc := NewService(Config{
+		WebhookSecret: "whsec_test_secret",
+		StripeClient:  client,
+		MarkOrderPaid: func(orderID string) bool {
+			markedPaid = append(markedPaid, orderID)
+			return true
+		},
+	})
+
+	order := commerce.Order{
+		ID:         "ord_test_capture",
+		Status:     commerce.OrderStatusPendingPayment,
+		TotalCents: 10000,
+		Currency:   "USD",
+	}
+	intent, err := svc.CreateStripeIntent(context.Background(), order, "idem-capture")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	if intent.CaptureMethod != CaptureMethodManual {
+		t.Fatalf("expected manual capture, got %q", intent.CaptureMethod)
+	}
+	if _, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID: order.ID, ShipmentID: "shp_a", AmountCents: 6000,
+	}); !errors.Is(err, ErrPaymentNotCapturable) {
+		t.Fatalf("expected ErrPaymentNotCapturable before authorization, got %v", err)
+	}
+
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_auth", "payment_intent.amount_capturable_updated", intent.ProviderRef)
+	result, err := svc.HandleStripeWebhook(payload, signature)
+	if err != nil {
+		t.Fatalf("HandleStripeWebhook() error = %v", err)
+	}
+	if result.PaymentStatus != PaymentStatusAuthorized {
+		t.Fatalf("expected payment status %s, got %s", PaymentStatusAuthorized, result.PaymentStatus)
+	}
+	if len(markedPaid) != 1 || markedPaid[0] != order.ID {
+		t.Fatalf("expected order %s marked paid on authorization, got %#v", order.ID, markedPaid)
+	}
+
+	captured, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID: order.ID, ShipmentID: "shp_a", AmountCents: 6000,
+	})
+	if err != nil {
+		t.Fatalf("CaptureShipment() error = %v", err)
+	}
+	if captured.Status != PaymentStatusPartiallyCaptured || captured.CapturedCents != 6000 {
+		t.Fatalf("expected partial capture of 6000, got status=%s captured=%d", captured.Status, captured.CapturedCents)
+	}
+	again, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID: order.ID, ShipmentID: "shp_a", AmountCents: 6000,
+	})
+	if err != nil {
+		t.Fatalf("CaptureShipment() repeat error = %v", err)
+	}
+	if again.CapturedCents != 6000 || len(again.Captures) != 1 || client.CapturedCents(intent.ProviderRef) != 6000 {
+		t.Fatalf("expected repeated capture to be a no-op, got captured=%d captures=%d", again.CapturedCents, len(again.Captures))
+	}
+
+	released, err := svc.ReleaseAuthorization(context.Background(), order.ID)
+	if err != nil {
+		t.Fatalf("ReleaseAuthorization() error = %v", err)
+	}
+	if released.Status != PaymentStatusSuccess || released.UncapturedCents() != 4000 {
+		t.Fatalf("expected succeeded payment with 4000 released, got status=%s uncaptured=%d", released.Status, released.UncapturedCents())
+	}
+	if _, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID: order.ID, ShipmentID: "shp_b", AmountCents: 4000,
+	}); !errors.Is(err, ErrPaymentNotCapturable) {
+		t.Fatalf("expected ErrPaymentNotCapturable after release, got %v", err)
+	}
+}
+
+type failingReauthClient struct {
+	*MockStripeClient
+}
+
+func (failingReauthClient) ReauthorizePaymentIntent(context.Context, ReauthorizeIntentInput) (StripeIntentResult, error) {
+	return StripeIntentResult{}, ErrReauthorizationUnavailable
+}
+
+func TestSweepAuthorizationsReauthorizesOrFlagsExpiringAuthorizations(t *testing.T) {
+	authorize := func(t *testing.T, client StripeClient, clock *time.Time) (*Service, StripeIntent) {
+		t.Helper()
+
+		svc := NewService(Config{
+			WebhookSecret:     "whsec_test_secret",
+			StripeClient:      client,
+			AuthorizationTTL:  48 * time.Hour,
+			ReauthorizeWindow: 12 * time.Hour,
+		})
+		svc.now = func() time.Time { return *clock }
+
+		order := commerce.Order{
+			ID:         "ord_test_sweep",
+			Status:     commerce.OrderStatusPendingPayment,
+			TotalCents: 5000,
+			Currency:   "USD",
+		}
+		intent, err := svc.CreateStripeIntent(context.Background(), order, "idem-sweep")
+		if err != nil {
+			t.Fatalf("CreateStripeIntent() error = %v", err)
+		}
+		payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_sweep_auth", "payment_intent.amount_capturable_updated", intent.ProviderRef)
+		if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+			t.Fatalf("HandleStripeWebhook() error = %v", err)
+		}
+		return svc, intent
+	}
+
+	t.Run("reauthorizes", func(t *testing.T) {
+		clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		svc, intent := authorize(t, NewMockStripeClient(), &clock)
+
+		if result := svc.SweepAuthorizations(context.Background()); result.Checked != 1 || result.Reauthorized != 0 {
+			t.Fatalf("expected fresh authorization to be left alone, got %+v", result)
+		}
+
+		clock = clock.Add(40 * time.Hour)
+		result := svc.SweepAuthorizations(context.Background())
+		if result.Reauthorized != 1 || result.Flagged != 0 {
+			t.Fatalf("expected one reauthorization, got %+v", result)
+		}
+		items := svc.ListAuthorizations(false)
+		if len(items) != 1 {
+			t.Fatalf("expected one open authorization, got %d", len(items))
+		}
+		if items[0].ProviderRef == intent.ProviderRef || items[0].Reauthorizations != 1 {
+			t.Fatalf("expected provider ref to be replaced, got %+v", items[0])
+		}
+		if !items[0].AuthorizationExpiresAt.Equal(clock.Add(48 * time.Hour)) {
+			t.Fatalf("expected expiry to be extended, got %v", items[0].AuthorizationExpiresAt)
+		}
+
+		payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_sweep_old_cancel", "payment_intent.canceled", intent.ProviderRef)
+		stale, err := svc.HandleStripeWebhook(payload, signature)
+		if err != nil {
+			t.Fatalf("HandleStripeWebhook() stale cancel error = %v", err)
+		}
+		if stale.Processed {
+			t.Fatalf("expected cancellation of replaced intent to be ignored")
+		}
+		if got := svc.ListAuthorizations(false)[0].Status; got != PaymentStatusAuthorized {
+			t.Fatalf("expected payment to stay authorized, got %s", got)
+		}
+	})
+
+	t.Run("leaves released shares out", func(t *testing.T) {
+		clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		client := NewMockStripeClient()
+		svc, _ := authorize(t, client, &clock)
+
+		released, err := svc.ReleaseShipment("ord_test_sweep", "shp_cancelled", 2000)
+		if err != nil {
+			t.Fatalf("ReleaseShipment() error = %v", err)
+		}
+		if released.Status != PaymentStatusAuthorized || released.ReleasedCents != 2000 || released.UncapturedCents() != 3000 {
+			t.Fatalf("expected 2000 of 5000 released, got status=%s released=%d uncaptured=%d", released.Status, released.ReleasedCents, released.UncapturedCents())
+		}
+		if again, _ := svc.ReleaseShipment("ord_test_sweep", "shp_cancelled", 2000); again.ReleasedCents != 2000 || len(again.Releases) != 1 {
+			t.Fatalf("expected repeated release to be a no-op, got %+v", again.Releases)
+		}
+
+		clock = clock.Add(40 * time.Hour)
+		if result := svc.SweepAuthorizations(context.Background()); result.Reauthorized != 1 {
+			t.Fatalf("expected one reauthorization, got %+v", result)
+		}
+		reauthorized := svc.ListAuthorizations(false)[0]
+		if record, err := client.GetPaymentIntent(context.Background(), reauthorized.ProviderRef); err != nil || record.AmountCents != 3000 {
+			t.Fatalf("expected the cancelled share left out of the new hold, got %+v err=%v", record, err)
+		}
+
+		captured, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+			OrderID: "ord_test_sweep", ShipmentID: "shp_shipped", AmountCents: 3000,
+		})
+		if err != nil {
+			t.Fatalf("CaptureShipment() error = %v", err)
+		}
+		if captured.Status != PaymentStatusSuccess || !captured.Captures[0].Final {
+			t.Fatalf("expected the last open shipment's capture to be final, got status=%s captures=%+v", captured.Status, captured.Captures)
+		}
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		svc, _ := authorize(t, failingReauthClient{NewMockStripeClient()}, &clock)
+
+		clock = clock.Add(40 * time.Hour)
+		if result := svc.SweepAuthorizations(context.Background()); result.Flagged != 1 {
+			t.Fatalf("expected expiring authorization to be flagged, got %+v", result)
+		}
+		flagged := svc.ListAuthorizations(true)
+		if len(flagged) != 1 || flagged[0].Attention != AttentionAuthorizationExpiring {
+			t.Fatalf("expected flagged expiring authorization, got %+v", flagged)
+		}
+
+		clock = clock.Add(10 * time.Hour)
+		svc.SweepAuthorizations(context.Background())
+		if got := svc.ListAuthorizations(true)[0].Attention; got != AttentionAuthorizationExpired {
+			t.Fatalf("expected lapsed authorization to be flagged expired, got %q", got)
+		}
+		if result := svc.SweepAuthorizations(context.Background()); result.Flagged != 0 {
+			t.Fatalf("expected lapsed authorization to be flagged once, got %+v", result)
+		}
+	})
+}
+
 func signedStripeEventPayload(t *testing.T, secret, eventID, eventType, paymentIntentID string) ([]byte, string) {
 	t.Helper()
+	return signedStripeIntentPayload(t, secret, eventID, eventType, map[string]interface{}{"id": paymentIntentID})
+}
+
+func signedStripeIntentPayload(t *testing.T, secret, eventID, eventType string, intent map[string]interface{}) ([]byte, string) {
+	t.Helper()
 
 	payload, err := json.Marshal(map[string]interface{}{
 		"id":   eventID,
 		"type": eventType,
 		"data": map[string]interface{}{
-			"object": map[string]interface{}{
-				"id": paymentIntentID,
-			},
+			"object": intent,
 		},
 	})
 	if err != nil {
@@ -486,3 +699,140 @@ func signedStripeEventPayload(t *testing.T, secret, eventID, eventType, paymentI
 
 	return signed.Payload, signed.Header
 }
+
+func TestRunStopsWhenContextIsCancelled(t *testing.T) {
+	svc := NewService(Config{StripeClient: NewMockStripeClient()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := svc.Run(ctx, time.Hour)
+	select {
+	case <-done:
+		t.Fatal("expected sweeps to run until cancelled")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected sweeps to stop after cancel")
+	}
+}
+
+func TestShipmentChargesSplitTheDiscountedTotalByShipmentValue(t *testing.T) {
+	order := commerce.Order{
+		TotalCents: 9001,
+		Shipments: []commerce.OrderShipment{
+			{ID: "shp_a", TotalCents: 3333},
+			{ID: "shp_empty", TotalCents: 0},
+			{ID: "shp_b", TotalCents: 3333},
+			{ID: "shp_c", TotalCents: 3334},
+		},
+	}
+
+	charges := ShipmentCharges(order)
+	if charges["shp_a"] != 3000 || charges["shp_b"] != 3000 || charges["shp_c"] != 3001 {
+		t.Fatalf("expected proportional shares with rounding on the last shipment, got %v", charges)
+	}
+	if _, exists := charges["shp_empty"]; exists {
+		t.Fatalf("expected empty shipments to get no share, got %v", charges)
+	}
+	if again := ShipmentCharges(order); again["shp_c"] != charges["shp_c"] {
+		t.Fatalf("expected the split to be deterministic, got %v then %v", charges, again)
+	}
+	if none := ShipmentCharges(commerce.Order{TotalCents: 500}); len(none) != 0 {
+		t.Fatalf("expected no shares without shipments, got %v", none)
+	}
+}
+
+func TestDiscountedMultiVendorOrderCapturesExactlyTheCharge(t *testing.T) {
+	client := NewMockStripeClient()
+	svc := NewService(Config{WebhookSecret: "whsec_test_secret", StripeClient: client})
+
+	// A 10% order discount: the shipments are worth 10000 but 9000 was charged.
+	order := commerce.Order{
+		ID:         "ord_discounted",
+		Status:     commerce.OrderStatusPendingPayment,
+		TotalCents: 9000,
+		Currency:   "USD",
+		Shipments: []commerce.OrderShipment{
+			{ID: "shp_first", VendorID: "ven_first", TotalCents: 6000},
+			{ID: "shp_second", VendorID: "ven_second", TotalCents: 4000},
+		},
+	}
+	intent, err := svc.CreateStripeIntent(context.Background(), order, "idem-discounted")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_discounted_auth", "payment_intent.amount_capturable_updated", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() error = %v", err)
+	}
+
+	charges := ShipmentCharges(order)
+	first, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID: order.ID, ShipmentID: "shp_first", AmountCents: charges["shp_first"], VendorID: "ven_first",
+	})
+	if err != nil || first.CapturedCents != 5400 || first.Status != PaymentStatusPartiallyCaptured {
+		t.Fatalf("expected the first vendor's discounted share captured, got captured=%d status=%s err=%v", first.CapturedCents, first.Status, err)
+	}
+	second, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{
+		OrderID: order.ID, ShipmentID: "shp_second", AmountCents: charges["shp_second"], Final: true, VendorID: "ven_second",
+	})
+	if err != nil || second.Captures[1].AmountCents != 3600 || second.Status != PaymentStatusSuccess {
+		t.Fatalf("expected the second vendor's discounted share captured in full, got %+v err=%v", second.Captures, err)
+	}
+	if got := client.CapturedCents(intent.ProviderRef); got != order.TotalCents {
+		t.Fatalf("expected captures to add up to the charge, got %d", got)
+	}
+}
+
+func TestSucceededAfterReauthorizationKeepsEarlierCaptures(t *testing.T) {
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewService(Config{
+		WebhookSecret:     "whsec_test_secret",
+		StripeClient:      NewMockStripeClient(),
+		AuthorizationTTL:  48 * time.Hour,
+		ReauthorizeWindow: 12 * time.Hour,
+	})
+	svc.now = func() time.Time { return clock }
+
+	order := commerce.Order{ID: "ord_reauth_capture", Status: commerce.OrderStatusPendingPayment, TotalCents: 5000, Currency: "USD"}
+	intent, err := svc.CreateStripeIntent(context.Background(), order, "idem-reauth-capture")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_reauth_capture_auth", "payment_intent.amount_capturable_updated", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() error = %v", err)
+	}
+	if _, err := svc.CaptureShipment(context.Background(), CaptureShipmentInput{OrderID: order.ID, ShipmentID: "shp_early", AmountCents: 2000}); err != nil {
+		t.Fatalf("CaptureShipment() early error = %v", err)
+	}
+
+	clock = clock.Add(40 * time.Hour)
+	if result := svc.SweepAuthorizations(context.Background()); result.Reauthorized != 1 {
+		t.Fatalf("expected one reauthorization, got %+v", result)
+	}
+	reauthorized := svc.ListAuthorizations(false)[0]
+
+	// The rest was captured on the new intent without reaching this service,
+	// say after a timeout; the provider reports that intent's captures alone.
+	payload, signature = signedStripeIntentPayload(t, "whsec_test_secret", "evt_reauth_capture_succeeded", "payment_intent.succeeded", map[string]interface{}{
+		"id":              reauthorized.ProviderRef,
+		"amount_received": 3000,
+	})
+	if _, err := svc.HandleStripeWebhook(payload, signature); err != nil {
+		t.Fatalf("HandleStripeWebhook() succeeded error = %v", err)
+	}
+	payment, err := svc.GetPayment(context.Background(), intent.ID)
+	if err != nil || payment.Status != PaymentStatusSuccess {
+		t.Fatalf("GetPayment() = %+v err=%v", payment, err)
+	}
+	svc.mu.Lock()
+	captured := svc.paymentsByID[intent.ID].CapturedCents
+	svc.mu.Unlock()
+	if captured != 5000 {
+		t.Fatalf("expected captures across both intents to be kept, got %d", captured)
+	}
+}
@@ -3,20 +3,36 @@ package payments
 import (
 	"context"
 	"errors"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/account"
+	"github.com/stripe/stripe-go/v83/accountlink"
+	"github.com/stripe/stripe-go/v83/dispute"
 	"github.com/stripe/stripe-go/v83/paymentintent"
+	"github.com/stripe/stripe-go/v83/transfer"
+	"github.com/stripe/stripe-go/v83/transferreversal"
 	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
 )
 
-var ErrStripeSecretKeyRequired = errors.New("stripe secret key is required")
+var (
+	ErrStripeSecretKeyRequired    = errors.New("stripe secret key is required")
+	ErrReauthorizationUnavailable = errors.New("payment method cannot be reauthorized off-session")
+	ErrConnectedAccountNotFound   = errors.New("connected account not found")
+	ErrTransferNotFound           = errors.New("transfer not found")
+	ErrDisputeNotFound            = errors.New("dispute not found")
+)
 
+// CreateIntentInput creates an order payment intent. TransferGroup ties the
+// charge to the vendor transfers made from it.
 type CreateIntentInput struct {
 	OrderID        string
 	AmountCents    int64
 	Currency       string
+	TransferGroup  string
 	IdempotencyKey string
 }
 
@@ -25,16 +41,146 @@ type StripeIntentResult struct {
 	ClientSecret string
 }
 
+// CaptureIntentInput captures part of an authorized intent. FinalCapture
+// releases whatever remains uncaptured after this capture.
+type CaptureIntentInput struct {
+	ProviderRef    string
+	AmountCents    int64
+	FinalCapture   bool
+	IdempotencyKey string
+}
+
+// ReauthorizeIntentInput places a fresh authorization for the uncaptured
+// remainder of an intent whose authorization is about to lapse.
+type ReauthorizeIntentInput struct {
+	ProviderRef    string
+	OrderID        string
+	AmountCents    int64
+	Currency       string
+	IdempotencyKey string
+}
+
+// ConnectedAccountInput creates a Connect account for one vendor.
+type ConnectedAccountInput struct {
+	VendorID       string
+	Email          string
+	IdempotencyKey string
+}
+
+// AccountLinkInput asks for a hosted onboarding link for a connected account.
+type AccountLinkInput struct {
+	AccountID  string
+	RefreshURL string
+	ReturnURL  string
+}
+
+// ConnectedAccountStatus reports whether a connected account finished
+// onboarding and can receive transfers.
+type ConnectedAccountStatus struct {
+	AccountID        string
+	DetailsSubmitted bool
+	ChargesEnabled   bool
+	PayoutsEnabled   bool
+}
+
+// TransferInput moves a vendor's share of a captured charge to its connected
+// account.
+type TransferInput struct {
+	Destination    string
+	AmountCents    int64
+	Currency       string
+	TransferGroup  string
+	OrderID        string
+	ShipmentID     string
+	IdempotencyKey string
+}
+
+// ReverseTransferInput pulls part of a transfer back from a connected account.
+type ReverseTransferInput struct {
+	TransferRef    string
+	AmountCents    int64
+	IdempotencyKey string
+}
+
+// DisputeEvidenceInput stages evidence text on a dispute. The evidence is
+// not submitted, so the platform can review it before the deadline.
+type DisputeEvidenceInput struct {
+	DisputeRef     string
+	Text           string
+	IdempotencyKey string
+}
+
+// ListIntentsInput selects the payment intents created in [CreatedFrom,
+// CreatedTo).
+type ListIntentsInput struct {
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// IntentRecord is Stripe's view of one payment intent. Status is the raw
+// Stripe status, such as requires_capture or succeeded.
+type IntentRecord struct {
+	ProviderRef           string
+	OrderID               string
+	Status                string
+	AmountCents           int64
+	AmountReceivedCents   int64
+	AmountCapturableCents int64
+	Currency              string
+	CreatedAt             time.Time
+}
+
 type StripeClient interface {
 	CreatePaymentIntent(ctx context.Context, input CreateIntentInput) (StripeIntentResult, error)
+	CapturePaymentIntent(ctx context.Context, input CaptureIntentInput) error
+	CancelPaymentIntent(ctx context.Context, providerRef, idempotencyKey string) error
+	ReauthorizePaymentIntent(ctx context.Context, input ReauthorizeIntentInput) (StripeIntentResult, error)
+	CreateConnectedAccount(ctx context.Context, input ConnectedAccountInput) (string, error)
+	CreateAccountLink(ctx context.Context, input AccountLinkInput) (string, error)
+	GetConnectedAccount(ctx context.Context, accountID string) (ConnectedAccountStatus, error)
+	CreateTransfer(ctx context.Context, input TransferInput) (string, error)
+	ReverseTransfer(ctx context.Context, input ReverseTransferInput) (string, error)
+	UpdateDisputeEvidence(ctx context.Context, input DisputeEvidenceInput) error
+	ListPaymentIntents(ctx context.Context, input ListIntentsInput) ([]IntentRecord, error)
+	GetPaymentIntent(ctx context.Context, providerRef string) (IntentRecord, error)
 }
 
+// MockStripeClient simulates Stripe in memory. Connected accounts count as
+// onboarded as soon as they are created. Intents wait for a payment method
+// until SetIntentStatus confirms them.
 type MockStripeClient struct {
-	mu sync.Mutex
+	mu        sync.Mutex
+	intents   map[string]*mockIntent
+	captured  map[string]int64
+	cancelled map[string]bool
+	accounts  map[string]bool
+	transfers map[string]mockTransfer
+	evidence  map[string]string
+}
+
+type mockIntent struct {
+	orderID     string
+	status      string
+	amountCents int64
+	currency    string
+	createdAt   time.Time
+}
+
+type mockTransfer struct {
+	destination   string
+	amountCents   int64
+	reversedCents int64
 }
 
 func NewMockStripeClient() *MockStripeClient {
-	return &MockStripeClient{}
+	return &MockStripeClient{
+		intents:   make(map[string]*mockIntent),
+		captured:  make(map[string]int64),
+		cancelled: make(map[string]bool),
+		accounts:  make(map[string]bool),
+		transfers: make(map[string]mockTransfer),
+		evidence:  make(map[string]string),
+	}
 }
 
 func (c *MockStripeClient) CreatePaymentIntent(_ context.Context, input CreateIntentInput) (StripeIntentResult, error) {
@@ -43,18 +189,277 @@ func (c *MockStripeClient) CreatePaymentIntent(_ context.Context, input CreateIn
 
 	intentID := identifier.New("pi")
 	secret := intentID + "_secret_" + identifier.New("sec")
+	c.intents[intentID] = &mockIntent{
+		orderID:     strings.TrimSpace(input.OrderID),
+		status:      string(stripe.PaymentIntentStatusRequiresPaymentMethod),
+		amountCents: input.AmountCents,
+		currency:    strings.ToLower(strings.TrimSpace(input.Currency)),
+		createdAt:   time.Now().UTC(),
+	}
 	return StripeIntentResult{
 		ProviderRef:  intentID,
 		ClientSecret: secret,
 	}, nil
 }
 
+func (c *MockStripeClient) CapturePaymentIntent(_ context.Context, input CaptureIntentInput) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	providerRef := strings.TrimSpace(input.ProviderRef)
+	if providerRef == "" || input.AmountCents <= 0 {
+		return ErrInvalidPayload
+	}
+	if c.cancelled[providerRef] {
+		return ErrPaymentNotCapturable
+	}
+	c.captured[providerRef] += input.AmountCents
+	if input.FinalCapture {
+		c.cancelled[providerRef] = true
+	}
+	if intent, exists := c.intents[providerRef]; exists && (input.FinalCapture || c.captured[providerRef] >= intent.amountCents) {
+		intent.status = string(stripe.PaymentIntentStatusSucceeded)
+	}
+	return nil
+}
+
+func (c *MockStripeClient) CancelPaymentIntent(_ context.Context, providerRef, _ string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	providerRef = strings.TrimSpace(providerRef)
+	c.cancelled[providerRef] = true
+	if intent, exists := c.intents[providerRef]; exists {
+		intent.status = string(stripe.PaymentIntentStatusCanceled)
+		if c.captured[providerRef] > 0 {
+			intent.status = string(stripe.PaymentIntentStatusSucceeded)
+		}
+	}
+	return nil
+}
+
+func (c *MockStripeClient) ReauthorizePaymentIntent(_ context.Context, input ReauthorizeIntentInput) (StripeIntentResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previousRef := strings.TrimSpace(input.ProviderRef)
+	c.cancelled[previousRef] = true
+	if previous, exists := c.intents[previousRef]; exists {
+		previous.status = string(stripe.PaymentIntentStatusCanceled)
+		if c.captured[previousRef] > 0 {
+			previous.status = string(stripe.PaymentIntentStatusSucceeded)
+		}
+	}
+	intentID := identifier.New("pi")
+	c.intents[intentID] = &mockIntent{
+		orderID:     strings.TrimSpace(input.OrderID),
+		status:      string(stripe.PaymentIntentStatusRequiresCapture),
+		amountCents: input.AmountCents,
+		currency:    strings.ToLower(strings.TrimSpace(input.Currency)),
+		createdAt:   time.Now().UTC(),
+	}
+	return StripeIntentResult{
+		ProviderRef:  intentID,
+		ClientSecret: intentID + "_secret_" + identifier.New("sec"),
+	}, nil
+}
+
+// CapturedCents reports the total captured against a mock intent.
+func (c *MockStripeClient) CapturedCents(providerRef string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.captured[strings.TrimSpace(providerRef)]
+}
+
+func (c *MockStripeClient) CreateConnectedAccount(_ context.Context, input ConnectedAccountInput) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if strings.TrimSpace(input.VendorID) == "" {
+		return "", ErrInvalidPayload
+	}
+	accountID := identifier.New("acct")
+	c.accounts[accountID] = true
+	return accountID, nil
+}
+
+func (c *MockStripeClient) CreateAccountLink(_ context.Context, input AccountLinkInput) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	accountID := strings.TrimSpace(input.AccountID)
+	if !c.accounts[accountID] {
+		return "", ErrConnectedAccountNotFound
+	}
+	return "https://connect.stripe.invalid/setup/" + accountID, nil
+}
+
+func (c *MockStripeClient) GetConnectedAccount(_ context.Context, accountID string) (ConnectedAccountStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	accountID = strings.TrimSpace(accountID)
+	if !c.accounts[accountID] {
+		return ConnectedAccountStatus{}, ErrConnectedAccountNotFound
+	}
+	return ConnectedAccountStatus{
+		AccountID:        accountID,
+		DetailsSubmitted: true,
+		ChargesEnabled:   true,
+		PayoutsEnabled:   true,
+	}, nil
+}
+
+func (c *MockStripeClient) CreateTransfer(_ context.Context, input TransferInput) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	destination := strings.TrimSpace(input.Destination)
+	if !c.accounts[destination] {
+		return "", ErrConnectedAccountNotFound
+	}
+	if input.AmountCents <= 0 {
+		return "", ErrInvalidPayload
+	}
+	transferRef := identifier.New("tr")
+	c.transfers[transferRef] = mockTransfer{destination: destination, amountCents: input.AmountCents}
+	return transferRef, nil
+}
+
+func (c *MockStripeClient) ReverseTransfer(_ context.Context, input ReverseTransferInput) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transferRef := strings.TrimSpace(input.TransferRef)
+	current, exists := c.transfers[transferRef]
+	if !exists {
+		return "", ErrTransferNotFound
+	}
+	if input.AmountCents <= 0 || current.reversedCents+input.AmountCents > current.amountCents {
+		return "", ErrInvalidPayload
+	}
+	current.reversedCents += input.AmountCents
+	c.transfers[transferRef] = current
+	return identifier.New("trr"), nil
+}
+
+func (c *MockStripeClient) UpdateDisputeEvidence(_ context.Context, input DisputeEvidenceInput) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	disputeRef := strings.TrimSpace(input.DisputeRef)
+	if disputeRef == "" {
+		return ErrDisputeNotFound
+	}
+	c.evidence[disputeRef] = input.Text
+	return nil
+}
+
+// SetIntentStatus moves a mock intent to a Stripe status, standing in for
+// the buyer confirming the payment.
+func (c *MockStripeClient) SetIntentStatus(providerRef string, status stripe.PaymentIntentStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if intent, exists := c.intents[strings.TrimSpace(providerRef)]; exists {
+		intent.status = string(status)
+	}
+}
+
+func (c *MockStripeClient) ListPaymentIntents(_ context.Context, input ListIntentsInput) ([]IntentRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	records := make([]IntentRecord, 0, len(c.intents))
+	for providerRef, intent := range c.intents {
+		if intent.createdAt.Before(input.CreatedFrom) || !intent.createdAt.Before(input.CreatedTo) {
+			continue
+		}
+		records = append(records, c.recordLocked(providerRef, intent))
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+func (c *MockStripeClient) GetPaymentIntent(_ context.Context, providerRef string) (IntentRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	providerRef = strings.TrimSpace(providerRef)
+	intent, exists := c.intents[providerRef]
+	if !exists {
+		return IntentRecord{}, ErrPaymentNotFound
+	}
+	return c.recordLocked(providerRef, intent), nil
+}
+
+func (c *MockStripeClient) recordLocked(providerRef string, intent *mockIntent) IntentRecord {
+	record := IntentRecord{
+		ProviderRef:         providerRef,
+		OrderID:             intent.orderID,
+		Status:              intent.status,
+		AmountCents:         intent.amountCents,
+		AmountReceivedCents: c.captured[providerRef],
+		Currency:            intent.currency,
+		CreatedAt:           intent.createdAt,
+	}
+	if intent.status == string(stripe.PaymentIntentStatusSucceeded) && record.AmountReceivedCents == 0 {
+		// Confirmed without manual capture, so Stripe captured it all.
+		record.AmountReceivedCents = intent.amountCents
+	}
+	if intent.status == string(stripe.PaymentIntentStatusRequiresCapture) {
+		record.AmountCapturableCents = intent.amountCents - record.AmountReceivedCents
+	}
+	return record
+}
+
+// DisputeEvidence returns the evidence text staged on a mock dispute.
+func (c *MockStripeClient) DisputeEvidence(disputeRef string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evidence[strings.TrimSpace(disputeRef)]
+}
+
+// TransferredCents reports the net amount transferred to a mock connected
+// account after reversals.
+func (c *MockStripeClient) TransferredCents(accountID string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := int64(0)
+	for _, current := range c.transfers {
+		if current.destination == strings.TrimSpace(accountID) {
+			total += current.amountCents - current.reversedCents
+		}
+	}
+	return total
+}
+
+// LiveStripeClient calls the Stripe API. The backend defaults to Stripe's
+// own; NewLiveStripeClientWithBackend points it elsewhere, such as a stub
+// server in tests.
 type LiveStripeClient struct {
 	secretKey string
+	backend   stripe.Backend
 }
 
 func NewLiveStripeClient(secretKey string) *LiveStripeClient {
-	return &LiveStripeClient{secretKey: strings.TrimSpace(secretKey)}
+	return NewLiveStripeClientWithBackend(secretKey, nil)
+}
+
+func NewLiveStripeClientWithBackend(secretKey string, backend stripe.Backend) *LiveStripeClient {
+	if backend == nil {
+		backend = stripe.GetBackend(stripe.APIBackend)
+	}
+	return &LiveStripeClient{secretKey: strings.TrimSpace(secretKey), backend: backend}
+}
+
+func (c *LiveStripeClient) intents() paymentintent.Client {
+	return paymentintent.Client{B: c.backend, Key: c.secretKey}
 }
 
 func (c *LiveStripeClient) CreatePaymentIntent(ctx context.Context, input CreateIntentInput) (StripeIntentResult, error) {
@@ -62,8 +467,6 @@ func (c *LiveStripeClient) CreatePaymentIntent(ctx context.Context, input Create
 		return StripeIntentResult{}, ErrStripeSecretKeyRequired
 	}
 
-	stripe.Key = c.secretKey
-
 	params := &stripe.PaymentIntentParams{
 		Amount:   stripe.Int64(input.AmountCents),
 		Currency: stripe.String(strings.ToLower(strings.TrimSpace(input.Currency))),
@@ -73,17 +476,287 @@ func (c *LiveStripeClient) CreatePaymentIntent(ctx context.Context, input Create
 		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
 		},
+		CaptureMethod: stripe.String(string(stripe.PaymentIntentCaptureMethodManual)),
+		PaymentMethodOptions: &stripe.PaymentIntentPaymentMethodOptionsParams{
+			Card: &stripe.PaymentIntentPaymentMethodOptionsCardParams{
+				RequestMulticapture: stripe.String(string(stripe.PaymentIntentPaymentMethodOptionsCardRequestMulticaptureIfAvailable)),
+			},
+		},
+	}
+	if transferGroup := strings.TrimSpace(input.TransferGroup); transferGroup != "" {
+		params.TransferGroup = stripe.String(transferGroup)
+	}
+	params.SetIdempotencyKey(strings.TrimSpace(input.IdempotencyKey))
+	params.Context = ctx
+
+	intent, err := c.intents().New(params)
+	if err != nil {
+		return StripeIntentResult{}, err
+	}
+
+	return StripeIntentResult{
+		ProviderRef:  strings.TrimSpace(intent.ID),
+		ClientSecret: strings.TrimSpace(intent.ClientSecret),
+	}, nil
+}
+
+func (c *LiveStripeClient) CapturePaymentIntent(ctx context.Context, input CaptureIntentInput) error {
+	if c.secretKey == "" {
+		return ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.PaymentIntentCaptureParams{
+		AmountToCapture: stripe.Int64(input.AmountCents),
+		FinalCapture:    stripe.Bool(input.FinalCapture),
+	}
+	params.SetIdempotencyKey(strings.TrimSpace(input.IdempotencyKey))
+	params.Context = ctx
+
+	_, err := c.intents().Capture(strings.TrimSpace(input.ProviderRef), params)
+	return err
+}
+
+func (c *LiveStripeClient) CancelPaymentIntent(ctx context.Context, providerRef, idempotencyKey string) error {
+	if c.secretKey == "" {
+		return ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.PaymentIntentCancelParams{}
+	params.SetIdempotencyKey(strings.TrimSpace(idempotencyKey))
+	params.Context = ctx
+
+	_, err := c.intents().Cancel(strings.TrimSpace(providerRef), params)
+	return err
+}
+
+// ReauthorizePaymentIntent confirms a new manual-capture intent off-session
+// against the customer's saved payment method, then cancels the old intent.
+// Intents without a customer and payment method cannot be reauthorized.
+func (c *LiveStripeClient) ReauthorizePaymentIntent(ctx context.Context, input ReauthorizeIntentInput) (StripeIntentResult, error) {
+	if c.secretKey == "" {
+		return StripeIntentResult{}, ErrStripeSecretKeyRequired
+	}
+
+	getParams := &stripe.PaymentIntentParams{}
+	getParams.Context = ctx
+	current, err := c.intents().Get(strings.TrimSpace(input.ProviderRef), getParams)
+	if err != nil {
+		return StripeIntentResult{}, err
+	}
+	if current.Customer == nil || current.PaymentMethod == nil {
+		return StripeIntentResult{}, ErrReauthorizationUnavailable
+	}
+
+	params := &stripe.PaymentIntentParams{
+		Amount:        stripe.Int64(input.AmountCents),
+		Currency:      stripe.String(strings.ToLower(strings.TrimSpace(input.Currency))),
+		Customer:      stripe.String(current.Customer.ID),
+		PaymentMethod: stripe.String(current.PaymentMethod.ID),
+		Confirm:       stripe.Bool(true),
+		OffSession:    stripe.Bool(true),
+		CaptureMethod: stripe.String(string(stripe.PaymentIntentCaptureMethodManual)),
+		Metadata: map[string]string{
+			"order_id":         strings.TrimSpace(input.OrderID),
+			"reauthorizes_ref": strings.TrimSpace(input.ProviderRef),
+		},
 	}
 	params.SetIdempotencyKey(strings.TrimSpace(input.IdempotencyKey))
 	params.Context = ctx
 
-	intent, err := paymentintent.New(params)
+	intent, err := c.intents().New(params)
 	if err != nil {
 		return StripeIntentResult{}, err
 	}
+	if err := c.CancelPaymentIntent(ctx, input.ProviderRef, strings.TrimSpace(input.IdempotencyKey)+"_cancel"); err != nil {
+		return StripeIntentResult{}, err
+	}
 
 	return StripeIntentResult{
 		ProviderRef:  strings.TrimSpace(intent.ID),
 		ClientSecret: strings.TrimSpace(intent.ClientSecret),
 	}, nil
 }
+
+func (c *LiveStripeClient) CreateConnectedAccount(ctx context.Context, input ConnectedAccountInput) (string, error) {
+	if c.secretKey == "" {
+		return "", ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.AccountParams{
+		Type: stripe.String(string(stripe.AccountTypeExpress)),
+		Capabilities: &stripe.AccountCapabilitiesParams{
+			Transfers: &stripe.AccountCapabilitiesTransfersParams{Requested: stripe.Bool(true)},
+		},
+		Metadata: map[string]string{
+			"vendor_id": strings.TrimSpace(input.VendorID),
+		},
+	}
+	if email := strings.TrimSpace(input.Email); email != "" {
+		params.Email = stripe.String(email)
+	}
+	params.SetIdempotencyKey(strings.TrimSpace(input.IdempotencyKey))
+	params.Context = ctx
+
+	created, err := account.Client{B: c.backend, Key: c.secretKey}.New(params)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(created.ID), nil
+}
+
+func (c *LiveStripeClient) CreateAccountLink(ctx context.Context, input AccountLinkInput) (string, error) {
+	if c.secretKey == "" {
+		return "", ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.AccountLinkParams{
+		Account:    stripe.String(strings.TrimSpace(input.AccountID)),
+		RefreshURL: stripe.String(strings.TrimSpace(input.RefreshURL)),
+		ReturnURL:  stripe.String(strings.TrimSpace(input.ReturnURL)),
+		Type:       stripe.String(string(stripe.AccountLinkTypeAccountOnboarding)),
+	}
+	params.Context = ctx
+
+	link, err := accountlink.Client{B: c.backend, Key: c.secretKey}.New(params)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(link.URL), nil
+}
+
+func (c *LiveStripeClient) GetConnectedAccount(ctx context.Context, accountID string) (ConnectedAccountStatus, error) {
+	if c.secretKey == "" {
+		return ConnectedAccountStatus{}, ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.AccountParams{}
+	params.Context = ctx
+
+	current, err := account.Client{B: c.backend, Key: c.secretKey}.GetByID(strings.TrimSpace(accountID), params)
+	if err != nil {
+		return ConnectedAccountStatus{}, err
+	}
+	return ConnectedAccountStatus{
+		AccountID:        strings.TrimSpace(current.ID),
+		DetailsSubmitted: current.DetailsSubmitted,
+		ChargesEnabled:   current.ChargesEnabled,
+		PayoutsEnabled:   current.PayoutsEnabled,
+	}, nil
+}
+
+func (c *LiveStripeClient) CreateTransfer(ctx context.Context, input TransferInput) (string, error) {
+	if c.secretKey == "" {
+		return "", ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.TransferParams{
+		Amount:      stripe.Int64(input.AmountCents),
+		Currency:    stripe.String(strings.ToLower(strings.TrimSpace(input.Currency))),
+		Destination: stripe.String(strings.TrimSpace(input.Destination)),
+		Metadata: map[string]string{
+			"order_id":    strings.TrimSpace(input.OrderID),
+			"shipment_id": strings.TrimSpace(input.ShipmentID),
+		},
+	}
+	if transferGroup := strings.TrimSpace(input.TransferGroup); transferGroup != "" {
+		params.TransferGroup = stripe.String(transferGroup)
+	}
+	params.SetIdempotencyKey(strings.TrimSpace(input.IdempotencyKey))
+	params.Context = ctx
+
+	created, err := transfer.Client{B: c.backend, Key: c.secretKey}.New(params)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(created.ID), nil
+}
+
+func (c *LiveStripeClient) ReverseTransfer(ctx context.Context, input ReverseTransferInput) (string, error) {
+	if c.secretKey == "" {
+		return "", ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.TransferReversalParams{
+		ID:     stripe.String(strings.TrimSpace(input.TransferRef)),
+		Amount: stripe.Int64(input.AmountCents),
+	}
+	params.SetIdempotencyKey(strings.TrimSpace(input.IdempotencyKey))
+	params.Context = ctx
+
+	reversal, err := transferreversal.Client{B: c.backend, Key: c.secretKey}.New(params)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reversal.ID), nil
+}
+
+func (c *LiveStripeClient) UpdateDisputeEvidence(ctx context.Context, input DisputeEvidenceInput) error {
+	if c.secretKey == "" {
+		return ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.DisputeParams{
+		Evidence: &stripe.DisputeEvidenceParams{
+			UncategorizedText: stripe.String(input.Text),
+		},
+		Submit: stripe.Bool(false),
+	}
+	params.SetIdempotencyKey(strings.TrimSpace(input.IdempotencyKey))
+	params.Context = ctx
+
+	_, err := dispute.Client{B: c.backend, Key: c.secretKey}.Update(strings.TrimSpace(input.DisputeRef), params)
+	return err
+}
+
+// ListPaymentIntents pages through every intent created in the window. The
+// order id comes from the metadata set by CreatePaymentIntent.
+func (c *LiveStripeClient) ListPaymentIntents(ctx context.Context, input ListIntentsInput) ([]IntentRecord, error) {
+	if c.secretKey == "" {
+		return nil, ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.PaymentIntentListParams{
+		CreatedRange: &stripe.RangeQueryParams{
+			GreaterThanOrEqual: input.CreatedFrom.Unix(),
+			LesserThan:         input.CreatedTo.Unix(),
+		},
+	}
+	params.Context = ctx
+
+	records := make([]IntentRecord, 0)
+	iter := c.intents().List(params)
+	for iter.Next() {
+		records = append(records, intentRecord(iter.PaymentIntent()))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (c *LiveStripeClient) GetPaymentIntent(ctx context.Context, providerRef string) (IntentRecord, error) {
+	if c.secretKey == "" {
+		return IntentRecord{}, ErrStripeSecretKeyRequired
+	}
+
+	params := &stripe.PaymentIntentParams{}
+	params.Context = ctx
+	intent, err := c.intents().Get(strings.TrimSpace(providerRef), params)
+	if err != nil {
+		return IntentRecord{}, err
+	}
+	return intentRecord(intent), nil
+}
+
+func intentRecord(intent *stripe.PaymentIntent) IntentRecord {
+	return IntentRecord{
+		ProviderRef:           strings.TrimSpace(intent.ID),
+		OrderID:               strings.TrimSpace(intent.Metadata["order_id"]),
+		Status:                string(intent.Status),
+		AmountCents:           intent.Amount,
+		AmountReceivedCents:   intent.AmountReceived,
+		AmountCapturableCents: intent.AmountCapturable,
+		Currency:              strings.ToLower(string(intent.Currency)),
+		CreatedAt:             time.Unix(intent.Created, 0).UTC(),
+	}
+}
@@ -0,0 +1,240 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+const (
+	// DefaultWebhookMaxAttempts is how many times an event is processed
+	// before it is moved to the dead-letter list.
+	DefaultWebhookMaxAttempts = 8
+	// DefaultWebhookRetryBackoff is the wait before the first retry; it
+	// doubles with every further attempt up to maxWebhookRetryBackoff.
+	DefaultWebhookRetryBackoff = time.Minute
+
+	maxWebhookRetryBackoff = 6 * time.Hour
+	// staleReceivedEventAge is how long an event may sit in received before
+	// the retry sweep assumes its processing was interrupted.
+	staleReceivedEventAge = 10 * time.Minute
+)
+
+// receiveEvent stores an incoming event before it is applied and claims it
+// for processing. It reports false for events that are in flight or already
+// settled, which the caller acknowledges as duplicates. Dead-lettered events
+// are only processed again through ReplayWebhookEvent.
+func (s *Service) receiveEvent(incoming WebhookEvent) (WebhookEvent, bool, error) {
+	incoming.Provider = normalizeProviderName(incoming.Provider)
+	incoming.ProviderEventID = strings.TrimSpace(incoming.ProviderEventID)
+	key := eventKey(incoming.Provider, incoming.ProviderEventID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, busy := s.processingEvents[key]; busy {
+		return WebhookEvent{}, false, nil
+	}
+	stored, exists := s.events.FindByProviderEventID(incoming.Provider, incoming.ProviderEventID)
+	if exists {
+		switch stored.Status {
+		case WebhookEventStatusProcessed, WebhookEventStatusIgnored, WebhookEventStatusDeadLetter:
+			return stored, false, nil
+		}
+	} else {
+		now := s.now()
+		incoming.ID = identifier.New("pev")
+		incoming.Status = WebhookEventStatusReceived
+		incoming.ReceivedAt = now
+		incoming.UpdatedAt = now
+		if err := s.events.Save(incoming); err != nil {
+			return WebhookEvent{}, false, err
+		}
+		stored = incoming
+	}
+	s.processingEvents[key] = struct{}{}
+
+	return stored, true, nil
+}
+
+// finishEvent records the outcome of one processing attempt and releases the
+// event. Failures are retried with exponential backoff until the attempts run
+// out; malformed payloads never succeed, so they are dead-lettered at once.
+func (s *Service) finishEvent(stored WebhookEvent, result WebhookResult, processErr error) WebhookEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.processingEvents, eventKey(stored.Provider, stored.ProviderEventID))
+
+	now := s.now()
+	stored.Attempts++
+	stored.UpdatedAt = now
+	stored.NextAttemptAt = nil
+	if result.PaymentID != "" {
+		stored.PaymentID = result.PaymentID
+	}
+	if result.OrderID != "" {
+		stored.OrderID = result.OrderID
+	}
+
+	switch {
+	case processErr == nil:
+		stored.Status = WebhookEventStatusProcessed
+		if !result.Processed {
+			stored.Status = WebhookEventStatusIgnored
+		}
+		stored.LastError = ""
+		stored.ProcessedAt = &now
+	case stored.Status == WebhookEventStatusDeadLetter,
+		stored.Attempts >= s.eventMaxAttempts,
+		errors.Is(processErr, ErrInvalidPayload):
+		stored.Status = WebhookEventStatusDeadLetter
+		stored.LastError = processErr.Error()
+	default:
+		nextAttemptAt := now.Add(s.eventRetryBackoff(stored.Attempts))
+		stored.Status = WebhookEventStatusFailed
+		stored.LastError = processErr.Error()
+		stored.NextAttemptAt = &nextAttemptAt
+	}
+	_ = s.events.Save(stored)
+
+	return stored
+}
+
+func (s *Service) eventRetryBackoff(attempts int) time.Duration {
+	backoff := s.eventBackoff
+	for attempt := 1; attempt < attempts && backoff < maxWebhookRetryBackoff; attempt++ {
+		backoff *= 2
+	}
+	if backoff > maxWebhookRetryBackoff {
+		backoff = maxWebhookRetryBackoff
+	}
+	return backoff
+}
+
+// RetryWebhookEvents processes failed events whose backoff has elapsed, and
+// events left in received by an interrupted delivery. It reports how many
+// were applied.
+func (s *Service) RetryWebhookEvents(ctx context.Context) int {
+	now := s.now()
+	due := make([]WebhookEvent, 0)
+	for _, event := range s.events.List(WebhookEventFilter{Status: WebhookEventStatusFailed}) {
+		if event.NextAttemptAt != nil && !event.NextAttemptAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	for _, event := range s.events.List(WebhookEventFilter{Status: WebhookEventStatusReceived}) {
+		if now.Sub(event.UpdatedAt) >= staleReceivedEventAge {
+			due = append(due, event)
+		}
+	}
+
+	applied := 0
+	for _, event := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		updated, err := s.processStoredEvent(event.ID)
+		if err == nil && (updated.Status == WebhookEventStatusProcessed || updated.Status == WebhookEventStatusIgnored) {
+			applied++
+		}
+	}
+	return applied
+}
+
+// RunWebhookRetries retries due webhook events every interval in the
+// background until ctx is cancelled. The returned channel is closed once
+// retries have stopped.
+func (s *Service) RunWebhookRetries(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.RetryWebhookEvents(ctx)
+			}
+		}
+	}()
+	return done
+}
+
+// ReplayWebhookEvent processes a stored event again whatever its status,
+// typically to recover a dead-lettered event once its cause is fixed. A
+// failed replay leaves a dead-lettered event dead-lettered.
+func (s *Service) ReplayWebhookEvent(eventID string) (WebhookEvent, error) {
+	return s.processStoredEvent(eventID)
+}
+
+// ListWebhookEvents returns stored events, newest first.
+func (s *Service) ListWebhookEvents(filter WebhookEventFilter) ([]WebhookEvent, error) {
+	filter.Status = strings.ToLower(strings.TrimSpace(filter.Status))
+	filter.Provider = normalizeProviderName(filter.Provider)
+	switch filter.Status {
+	case "", WebhookEventStatusReceived, WebhookEventStatusProcessed, WebhookEventStatusIgnored,
+		WebhookEventStatusFailed, WebhookEventStatusDeadLetter:
+	default:
+		return nil, ErrInvalidEventFilter
+	}
+	return s.events.List(filter), nil
+}
+
+func (s *Service) GetWebhookEvent(eventID string) (WebhookEvent, bool) {
+	return s.events.Get(eventID)
+}
+
+func (s *Service) processStoredEvent(eventID string) (WebhookEvent, error) {
+	s.mu.Lock()
+	stored, exists := s.events.Get(eventID)
+	if !exists {
+		s.mu.Unlock()
+		return WebhookEvent{}, ErrWebhookEventNotFound
+	}
+	key := eventKey(stored.Provider, stored.ProviderEventID)
+	if _, busy := s.processingEvents[key]; busy {
+		s.mu.Unlock()
+		return stored, ErrWebhookEventInFlight
+	}
+	s.processingEvents[key] = struct{}{}
+	s.mu.Unlock()
+
+	result, err := s.dispatchStoredEvent(stored)
+	return s.finishEvent(stored, result, err), nil
+}
+
+// dispatchStoredEvent applies a stored event without verifying its signature
+// again; it was verified when it was received.
+func (s *Service) dispatchStoredEvent(stored WebhookEvent) (WebhookResult, error) {
+	if stored.Provider == ProviderStripe {
+		var event stripeWebhookEnvelope
+		if err := json.Unmarshal([]byte(stored.Payload), &event); err != nil {
+			return WebhookResult{}, ErrInvalidPayload
+		}
+		return s.processStripeEvent(event)
+	}
+
+	s.mu.Lock()
+	_, exists := s.providers[stored.Provider]
+	s.mu.Unlock()
+	if !exists {
+		return WebhookResult{}, ErrProviderNotFound
+	}
+	return s.processProviderEvent(stored.Provider, ProviderEvent{
+		ID:          stored.ProviderEventID,
+		ProviderRef: stored.ProviderRef,
+		Status:      stored.EventType,
+	})
+}
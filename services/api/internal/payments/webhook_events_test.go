@@ -0,0 +1,150 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/blobstore"
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+)
+
+func TestWebhookEventsAreStoredRetriedAndDeadLettered(t *testing.T) {
+	orderSyncUp := false
+	svc := NewService(Config{
+		WebhookSecret:       "whsec_test_secret",
+		MarkOrderPaid:       func(string) bool { return orderSyncUp },
+		WebhookMaxAttempts:  3,
+		WebhookRetryBackoff: time.Minute,
+	})
+	clock := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return clock }
+
+	intent, err := svc.CreateStripeIntent(context.Background(), commerce.Order{
+		ID: "ord_events", Status: commerce.OrderStatusPendingPayment, TotalCents: 5000, Currency: "USD",
+	}, "idem-events")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_events_paid", "payment_intent.succeeded", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); !errors.Is(err, ErrOrderSyncFailed) {
+		t.Fatalf("expected ErrOrderSyncFailed, got %v", err)
+	}
+	failed, err := svc.ListWebhookEvents(WebhookEventFilter{Status: WebhookEventStatusFailed})
+	if err != nil || len(failed) != 1 {
+		t.Fatalf("expected one failed event, got %+v err=%v", failed, err)
+	}
+	event := failed[0]
+	if event.Provider != ProviderStripe || event.Payload != string(payload) || event.Attempts != 1 || event.LastError == "" {
+		t.Fatalf("expected raw payload stored with the failed attempt, got %+v", event)
+	}
+	if event.NextAttemptAt == nil || !event.NextAttemptAt.Equal(clock.Add(time.Minute)) {
+		t.Fatalf("expected first retry after one minute, got %v", event.NextAttemptAt)
+	}
+
+	if applied := svc.RetryWebhookEvents(context.Background()); applied != 0 {
+		t.Fatalf("expected no retry before backoff elapsed, got %d", applied)
+	}
+	clock = clock.Add(time.Minute)
+	svc.RetryWebhookEvents(context.Background())
+	event, _ = svc.GetWebhookEvent(event.ID)
+	if event.Attempts != 2 || !event.NextAttemptAt.Equal(clock.Add(2*time.Minute)) {
+		t.Fatalf("expected backoff to double, got %+v", event)
+	}
+	clock = clock.Add(2 * time.Minute)
+	svc.RetryWebhookEvents(context.Background())
+	event, _ = svc.GetWebhookEvent(event.ID)
+	if event.Status != WebhookEventStatusDeadLetter || event.Attempts != 3 || event.NextAttemptAt != nil {
+		t.Fatalf("expected event dead-lettered after three attempts, got %+v", event)
+	}
+
+	redelivered, err := svc.HandleStripeWebhook(payload, signature)
+	if err != nil || !redelivered.Duplicate {
+		t.Fatalf("expected dead-lettered redelivery acknowledged as duplicate, got %+v err=%v", redelivered, err)
+	}
+
+	orderSyncUp = true
+	replayed, err := svc.ReplayWebhookEvent(event.ID)
+	if err != nil {
+		t.Fatalf("ReplayWebhookEvent() error = %v", err)
+	}
+	if replayed.Status != WebhookEventStatusProcessed || replayed.Attempts != 4 || replayed.OrderID != "ord_events" || replayed.ProcessedAt == nil {
+		t.Fatalf("expected replay to process the event, got %+v", replayed)
+	}
+	if payment := svc.paymentsByID[intent.ID]; payment.Status != PaymentStatusSuccess {
+		t.Fatalf("expected replay to apply the payment, got %s", payment.Status)
+	}
+	if _, err := svc.ReplayWebhookEvent("pev_missing"); !errors.Is(err, ErrWebhookEventNotFound) {
+		t.Fatalf("expected ErrWebhookEventNotFound, got %v", err)
+	}
+
+	ignoredPayload, ignoredSignature := signedStripeEventPayload(t, "whsec_test_secret", "evt_events_other", "customer.created", "cus_1")
+	if _, err := svc.HandleStripeWebhook(ignoredPayload, ignoredSignature); err != nil {
+		t.Fatalf("HandleStripeWebhook() ignored event error = %v", err)
+	}
+	if ignored, _ := svc.ListWebhookEvents(WebhookEventFilter{Status: WebhookEventStatusIgnored}); len(ignored) != 1 {
+		t.Fatalf("expected unhandled event stored as ignored, got %+v", ignored)
+	}
+	if _, err := svc.ListWebhookEvents(WebhookEventFilter{Status: "stuck"}); !errors.Is(err, ErrInvalidEventFilter) {
+		t.Fatalf("expected ErrInvalidEventFilter, got %v", err)
+	}
+}
+
+func TestBlobEventStoreKeepsEventsAcrossRestart(t *testing.T) {
+	dir, err := blobstore.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirStore() error = %v", err)
+	}
+	store, err := NewBlobEventStore(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("NewBlobEventStore() error = %v", err)
+	}
+	svc := NewService(Config{
+		WebhookSecret: "whsec_test_secret",
+		MarkOrderPaid: func(string) bool { return false },
+		EventStore:    store,
+	})
+	intent, err := svc.CreateStripeIntent(context.Background(), commerce.Order{
+		ID: "ord_durable_events", Status: commerce.OrderStatusPendingPayment, TotalCents: 5000, Currency: "USD",
+	}, "idem-durable-events")
+	if err != nil {
+		t.Fatalf("CreateStripeIntent() error = %v", err)
+	}
+	payload, signature := signedStripeEventPayload(t, "whsec_test_secret", "evt_durable_paid", "payment_intent.succeeded", intent.ProviderRef)
+	if _, err := svc.HandleStripeWebhook(payload, signature); !errors.Is(err, ErrOrderSyncFailed) {
+		t.Fatalf("expected ErrOrderSyncFailed, got %v", err)
+	}
+
+	reopened, err := NewBlobEventStore(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("NewBlobEventStore() reopen error = %v", err)
+	}
+	failed := reopened.List(WebhookEventFilter{Status: WebhookEventStatusFailed})
+	if len(failed) != 1 || failed[0].Payload != string(payload) || failed[0].Attempts != 1 || failed[0].NextAttemptAt == nil {
+		t.Fatalf("expected the failed event back after reopening, got %+v", failed)
+	}
+	if _, found := reopened.FindByProviderEventID(ProviderStripe, "evt_durable_paid"); !found {
+		t.Fatal("expected the reopened store to recognise a redelivery")
+	}
+}
+
+func TestRunWebhookRetriesStopsWhenContextIsCancelled(t *testing.T) {
+	svc := NewService(Config{StripeClient: NewMockStripeClient()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := svc.RunWebhookRetries(ctx, time.Hour)
+	select {
+	case <-done:
+		t.Fatal("expected webhook retries to run until cancelled")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected webhook retries to stop after cancel")
+	}
+}
@@ -0,0 +1,450 @@
+package reconciliation
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+const (
+	// MismatchOrphanPayment is a settled provider payment with no order.
+	MismatchOrphanPayment = "orphan_payment"
+	// MismatchAmount is an order whose settled payments do not add up to
+	// its total, or are in another currency.
+	MismatchAmount = "amount_mismatch"
+	// MismatchStuckPending is an order still awaiting payment although the
+	// provider settled its payment.
+	MismatchStuckPending = "stuck_pending_payment"
+	// MismatchMissingPayment is a paid or COD confirmed order without a
+	// settled provider payment.
+	MismatchMissingPayment = "missing_payment"
+
+	ReportStatusCompleted = "completed"
+	ReportStatusFailed    = "failed"
+
+	DefaultWindow = 72 * time.Hour
+
+	maxReports = 30
+)
+
+var ErrReportNotFound = errors.New("reconciliation report not found")
+
+type Config struct {
+	// Window is how far back each run looks at payments and orders.
+	Window time.Duration
+	// ListPayments returns the provider payments created in [from, to).
+	ListPayments func(ctx context.Context, from, to time.Time) ([]payments.PaymentRecord, error)
+	// ListOrders returns every order.
+	ListOrders func() []commerce.Order
+	// GetOrder finds an order outside the window that a payment refers to.
+	GetOrder func(orderID string) (commerce.Order, bool)
+	// Settle applies a settled payment to its stuck order.
+	Settle func(ctx context.Context, record payments.PaymentRecord) error
+}
+
+// Mismatch is one discrepancy between provider payments and orders.
+// ExpectedCents is the order total and ActualCents what the provider settled.
+// Only stuck orders whose payments match their total are Fixable.
+type Mismatch struct {
+	ID            string                   `json:"id"`
+	Kind          string                   `json:"kind"`
+	OrderID       string                   `json:"order_id,omitempty"`
+	OrderStatus   string                   `json:"order_status,omitempty"`
+	Currency      string                   `json:"currency"`
+	ExpectedCents int64                    `json:"expected_cents"`
+	ActualCents   int64                    `json:"actual_cents"`
+	Payments      []payments.PaymentRecord `json:"payments"`
+	Detail        string                   `json:"detail"`
+	Fixable       bool                     `json:"fixable"`
+	FixedAt       *time.Time               `json:"fixed_at,omitempty"`
+	FixError      string                   `json:"fix_error,omitempty"`
+}
+
+// Report is the outcome of one reconciliation run over [WindowStart,
+// WindowEnd).
+type Report struct {
+	ID              string     `json:"id"`
+	Status          string     `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	WindowStart     time.Time  `json:"window_start"`
+	WindowEnd       time.Time  `json:"window_end"`
+	PaymentsChecked int        `json:"payments_checked"`
+	OrdersChecked   int        `json:"orders_checked"`
+	Mismatches      []Mismatch `json:"mismatches"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// FixResult summarises one auto-fix pass over a report.
+type FixResult struct {
+	Fixed  int    `json:"fixed"`
+	Failed int    `json:"failed"`
+	Report Report `json:"report"`
+}
+
+// Service runs payment reconciliation and keeps the most recent reports.
+type Service struct {
+	mu            sync.Mutex
+	cfg           Config
+	now           func() time.Time
+	reports       []Report
+	runInProgress bool
+}
+
+func NewService(cfg Config) *Service {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	return &Service{
+		cfg:     cfg,
+		now:     func() time.Time { return time.Now().UTC() },
+		reports: make([]Report, 0),
+	}
+}
+
+// Run compares the payments and orders created in the window and stores the
+// report. A run started while another is in progress returns false.
+func (s *Service) Run(ctx context.Context) (Report, bool) {
+	s.mu.Lock()
+	if s.runInProgress {
+		s.mu.Unlock()
+		return Report{}, false
+	}
+	s.runInProgress = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.runInProgress = false
+		s.mu.Unlock()
+	}()
+
+	now := s.now()
+	report := Report{
+		ID:          identifier.New("rec"),
+		Status:      ReportStatusCompleted,
+		WindowStart: now.Add(-s.cfg.Window),
+		WindowEnd:   now,
+		Mismatches:  make([]Mismatch, 0),
+		CreatedAt:   now,
+	}
+
+	var records []payments.PaymentRecord
+	if s.cfg.ListPayments != nil {
+		var err error
+		records, err = s.cfg.ListPayments(ctx, report.WindowStart, report.WindowEnd)
+		if err != nil {
+			report.Status = ReportStatusFailed
+			report.Error = err.Error()
+		}
+	}
+	if report.Status == ReportStatusCompleted {
+		report.PaymentsChecked = len(records)
+		report.Mismatches, report.OrdersChecked = s.compare(records, report.WindowStart, report.WindowEnd)
+	}
+
+	s.mu.Lock()
+	s.reports = append([]Report{report}, s.reports...)
+	if len(s.reports) > maxReports {
+		s.reports = s.reports[:maxReports]
+	}
+	s.mu.Unlock()
+
+	return cloneReport(report), true
+}
+
+// Start runs reconciliation on a fixed interval in the background until ctx
+// is cancelled. The returned channel is closed once reconciliation has
+// stopped.
+func (s *Service) Start(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Run(ctx)
+			}
+		}
+	}()
+	return done
+}
+
+// compare matches settled payments to orders. Orders created in the window
+// are checked even without payments; orders outside it only when a payment
+// in the window refers to them.
+func (s *Service) compare(records []payments.PaymentRecord, from, to time.Time) ([]Mismatch, int) {
+	orders := make(map[string]commerce.Order)
+	if s.cfg.ListOrders != nil {
+		for _, order := range s.cfg.ListOrders() {
+			if order.CreatedAt.Before(from) || !order.CreatedAt.Before(to) {
+				continue
+			}
+			orders[order.ID] = order
+		}
+	}
+
+	settledByOrder := make(map[string][]payments.PaymentRecord)
+	mismatches := make([]Mismatch, 0)
+	for _, record := range records {
+		if !record.Settled() {
+			continue
+		}
+		orderID := strings.TrimSpace(record.OrderID)
+		if _, exists := orders[orderID]; !exists && orderID != "" && s.cfg.GetOrder != nil {
+			if order, found := s.cfg.GetOrder(orderID); found {
+				orders[orderID] = order
+			}
+		}
+		if _, exists := orders[orderID]; !exists {
+			mismatches = append(mismatches, Mismatch{
+				ID:          identifier.New("mis"),
+				Kind:        MismatchOrphanPayment,
+				OrderID:     orderID,
+				Currency:    record.Currency,
+				ActualCents: record.AmountCents,
+				Payments:    []payments.PaymentRecord{record},
+				Detail:      "provider payment " + record.ProviderRef + " matches no order",
+			})
+			continue
+		}
+		settledByOrder[orderID] = append(settledByOrder[orderID], record)
+	}
+
+	orderIDs := make([]string, 0, len(orders))
+	for orderID := range orders {
+		orderIDs = append(orderIDs, orderID)
+	}
+	sort.Strings(orderIDs)
+
+	for _, orderID := range orderIDs {
+		order := orders[orderID]
+		settled := settledByOrder[orderID]
+		actual := int64(0)
+		currencyMatches := true
+		for _, record := range settled {
+			actual += record.AmountCents
+			if !strings.EqualFold(record.Currency, order.Currency) {
+				currencyMatches = false
+			}
+		}
+		amountMatches := currencyMatches && actual == order.TotalCents
+
+		mismatch := Mismatch{
+			OrderID:       order.ID,
+			OrderStatus:   order.Status,
+			Currency:      order.Currency,
+			ExpectedCents: order.TotalCents,
+			ActualCents:   actual,
+			Payments:      settled,
+		}
+		switch order.Status {
+		case commerce.OrderStatusPendingPayment, commerce.OrderStatusPaymentFailed:
+			if len(settled) == 0 {
+				continue
+			}
+			mismatch.Kind = MismatchStuckPending
+			mismatch.Detail = "order is " + order.Status + " but the provider settled its payment"
+			mismatch.Fixable = amountMatches
+			if !amountMatches {
+				mismatch.Detail += "; " + amountDetail(currencyMatches, order.TotalCents, actual)
+			}
+		case commerce.OrderStatusPaid, commerce.OrderStatusCODConfirmed:
+			if len(settled) == 0 {
+				mismatch.Kind = MismatchMissingPayment
+				mismatch.Detail = "order is " + order.Status + " but no provider payment settled"
+			} else if !amountMatches {
+				mismatch.Kind = MismatchAmount
+				mismatch.Detail = amountDetail(currencyMatches, order.TotalCents, actual)
+			} else {
+				continue
+			}
+		default:
+			continue
+		}
+		mismatch.ID = identifier.New("mis")
+		mismatches = append(mismatches, mismatch)
+	}
+
+	return mismatches, len(orders)
+}
+
+func amountDetail(currencyMatches bool, expected, actual int64) string {
+	if !currencyMatches {
+		return "payment currency differs from the order"
+	}
+	return "settled " + strconv.FormatInt(actual, 10) + " of " + strconv.FormatInt(expected, 10)
+}
+
+// List returns stored reports, newest first.
+func (s *Service) List() []Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]Report, 0, len(s.reports))
+	for _, report := range s.reports {
+		items = append(items, cloneReport(report))
+	}
+	return items
+}
+
+func (s *Service) Get(reportID string) (Report, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.reportIndexLocked(reportID)
+	if index < 0 {
+		return Report{}, false
+	}
+	return cloneReport(s.reports[index]), true
+}
+
+// Fix settles every fixable mismatch in the report that is not fixed yet.
+// Orders are checked again first, so ones that were paid in the meantime
+// are left alone.
+func (s *Service) Fix(ctx context.Context, reportID string) (FixResult, error) {
+	s.mu.Lock()
+	index := s.reportIndexLocked(reportID)
+	if index < 0 {
+		s.mu.Unlock()
+		return FixResult{}, ErrReportNotFound
+	}
+	pending := make([]Mismatch, 0)
+	for _, mismatch := range s.reports[index].Mismatches {
+		if mismatch.Fixable && mismatch.FixedAt == nil {
+			pending = append(pending, mismatch)
+		}
+	}
+	s.mu.Unlock()
+
+	result := FixResult{}
+	outcomes := make(map[string]Mismatch, len(pending))
+	for _, mismatch := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		mismatch.FixError = ""
+		if err := s.fixMismatch(ctx, mismatch); err != nil {
+			mismatch.FixError = err.Error()
+			result.Failed++
+		} else {
+			fixedAt := s.now()
+			mismatch.FixedAt = &fixedAt
+			result.Fixed++
+		}
+		outcomes[mismatch.ID] = mismatch
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index = s.reportIndexLocked(reportID)
+	if index < 0 {
+		return FixResult{}, ErrReportNotFound
+	}
+	for position, mismatch := range s.reports[index].Mismatches {
+		if outcome, exists := outcomes[mismatch.ID]; exists {
+			s.reports[index].Mismatches[position] = outcome
+		}
+	}
+	result.Report = cloneReport(s.reports[index])
+	return result, nil
+}
+
+func (s *Service) fixMismatch(ctx context.Context, mismatch Mismatch) error {
+	if s.cfg.Settle == nil {
+		return errors.New("settling payments is not configured")
+	}
+	if s.cfg.GetOrder != nil {
+		order, found := s.cfg.GetOrder(mismatch.OrderID)
+		if !found {
+			return errors.New("order not found")
+		}
+		if order.Status != commerce.OrderStatusPendingPayment && order.Status != commerce.OrderStatusPaymentFailed {
+			return errors.New("order is already " + order.Status)
+		}
+	}
+	for _, record := range mismatch.Payments {
+		if err := s.cfg.Settle(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) reportIndexLocked(reportID string) int {
+	reportID = strings.TrimSpace(reportID)
+	for index, report := range s.reports {
+		if report.ID == reportID {
+			return index
+		}
+	}
+	return -1
+}
+
+// CSV renders the report's mismatches, one row per mismatch.
+func (r Report) CSV() ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	rows := [][]string{{
+		"mismatch_id", "kind", "order_id", "order_status", "currency", "expected_cents", "actual_cents",
+		"providers", "provider_refs", "detail", "fixable", "fixed_at", "fix_error",
+	}}
+	for _, mismatch := range r.Mismatches {
+		providers := make([]string, 0, len(mismatch.Payments))
+		refs := make([]string, 0, len(mismatch.Payments))
+		for _, record := range mismatch.Payments {
+			providers = append(providers, record.Provider)
+			refs = append(refs, record.ProviderRef)
+		}
+		fixedAt := ""
+		if mismatch.FixedAt != nil {
+			fixedAt = mismatch.FixedAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			mismatch.ID,
+			mismatch.Kind,
+			mismatch.OrderID,
+			mismatch.OrderStatus,
+			mismatch.Currency,
+			strconv.FormatInt(mismatch.ExpectedCents, 10),
+			strconv.FormatInt(mismatch.ActualCents, 10),
+			strings.Join(providers, ";"),
+			strings.Join(refs, ";"),
+			mismatch.Detail,
+			strconv.FormatBool(mismatch.Fixable),
+			fixedAt,
+			mismatch.FixError,
+		})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func cloneReport(report Report) Report {
+	mismatches := make([]Mismatch, 0, len(report.Mismatches))
+	for _, mismatch := range report.Mismatches {
+		mismatch.Payments = append([]payments.PaymentRecord(nil), mismatch.Payments...)
+		mismatches = append(mismatches, mismatch)
+	}
+	report.Mismatches = mismatches
+	return report
+}
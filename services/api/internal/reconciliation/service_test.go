@@ -0,0 +1,160 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/commerce"
+	"github.com/yxshee/marketplace-platform/services/api/internal/payments"
+)
+
+func TestRunReportsMismatchesAndFixesStuckOrders(t *testing.T) {
+	now := time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC)
+	created := now.Add(-2 * time.Hour)
+	orders := map[string]commerce.Order{
+		"ord_ok":      {ID: "ord_ok", Status: commerce.OrderStatusPaid, TotalCents: 5000, Currency: "USD", CreatedAt: created},
+		"ord_short":   {ID: "ord_short", Status: commerce.OrderStatusPaid, TotalCents: 5000, Currency: "USD", CreatedAt: created},
+		"ord_stuck":   {ID: "ord_stuck", Status: commerce.OrderStatusPendingPayment, TotalCents: 2500, Currency: "USD", CreatedAt: created},
+		"ord_nopay":   {ID: "ord_nopay", Status: commerce.OrderStatusPaid, TotalCents: 900, Currency: "USD", CreatedAt: created},
+		"ord_waiting": {ID: "ord_waiting", Status: commerce.OrderStatusPendingPayment, TotalCents: 700, Currency: "USD", CreatedAt: created},
+		"ord_old":     {ID: "ord_old", Status: commerce.OrderStatusPaid, TotalCents: 400, Currency: "USD", CreatedAt: now.Add(-30 * 24 * time.Hour)},
+	}
+	records := []payments.PaymentRecord{
+		{Provider: payments.ProviderStripe, ProviderRef: "pi_ok", OrderID: "ord_ok", Status: payments.PaymentStatusSuccess, AmountCents: 5000, Currency: "USD"},
+		{Provider: payments.ProviderStripe, ProviderRef: "pi_short", OrderID: "ord_short", Status: payments.PaymentStatusSuccess, AmountCents: 4500, Currency: "USD"},
+		{Provider: payments.ProviderStripe, ProviderRef: "pi_stuck", OrderID: "ord_stuck", Status: payments.PaymentStatusAuthorized, AmountCents: 2500, Currency: "USD"},
+		{Provider: payments.ProviderStripe, ProviderRef: "pi_orphan", Status: payments.PaymentStatusSuccess, AmountCents: 1200, Currency: "USD"},
+		{Provider: payments.ProviderStripe, ProviderRef: "pi_waiting", OrderID: "ord_waiting", Status: payments.PaymentStatusPending, AmountCents: 0, Currency: "USD"},
+		{Provider: payments.ProviderStripe, ProviderRef: "pi_old", OrderID: "ord_old", Status: payments.PaymentStatusSuccess, AmountCents: 400, Currency: "USD"},
+	}
+	var requestedFrom time.Time
+	settled := make([]string, 0)
+
+	svc := NewService(Config{
+		Window: 24 * time.Hour,
+		ListPayments: func(_ context.Context, from, _ time.Time) ([]payments.PaymentRecord, error) {
+			requestedFrom = from
+			return records, nil
+		},
+		ListOrders: func() []commerce.Order {
+			items := make([]commerce.Order, 0, len(orders))
+			for _, order := range orders {
+				items = append(items, order)
+			}
+			return items
+		},
+		GetOrder: func(orderID string) (commerce.Order, bool) {
+			order, found := orders[orderID]
+			return order, found
+		},
+		Settle: func(_ context.Context, record payments.PaymentRecord) error {
+			settled = append(settled, record.ProviderRef)
+			order := orders[record.OrderID]
+			order.Status = commerce.OrderStatusPaid
+			orders[record.OrderID] = order
+			return nil
+		},
+	})
+	svc.now = func() time.Time { return now }
+
+	report, started := svc.Run(context.Background())
+	if !started || report.Status != ReportStatusCompleted {
+		t.Fatalf("expected completed run, got %+v started=%v", report, started)
+	}
+	if !requestedFrom.Equal(now.Add(-24 * time.Hour)) {
+		t.Fatalf("expected a 24h window, got %s", requestedFrom)
+	}
+	if report.PaymentsChecked != 6 || report.OrdersChecked != 6 {
+		t.Fatalf("expected 6 payments and 6 orders checked, got %+v", report)
+	}
+
+	kinds := make(map[string]Mismatch)
+	for _, mismatch := range report.Mismatches {
+		kinds[mismatch.Kind+":"+mismatch.OrderID] = mismatch
+	}
+	if len(report.Mismatches) != 4 {
+		t.Fatalf("expected 4 mismatches, got %+v", report.Mismatches)
+	}
+	if short, ok := kinds[MismatchAmount+":ord_short"]; !ok || short.ExpectedCents != 5000 || short.ActualCents != 4500 || short.Fixable {
+		t.Fatalf("expected unfixable amount mismatch, got %+v", short)
+	}
+	if stuck, ok := kinds[MismatchStuckPending+":ord_stuck"]; !ok || !stuck.Fixable {
+		t.Fatalf("expected fixable stuck order, got %+v", stuck)
+	}
+	if _, ok := kinds[MismatchOrphanPayment+":"]; !ok {
+		t.Fatalf("expected orphan payment, got %+v", report.Mismatches)
+	}
+	if _, ok := kinds[MismatchMissingPayment+":ord_nopay"]; !ok {
+		t.Fatalf("expected paid order without payment, got %+v", report.Mismatches)
+	}
+
+	csvReport, err := report.CSV()
+	if err != nil {
+		t.Fatalf("CSV() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(csvReport)), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "mismatch_id,kind,order_id") || !strings.Contains(string(csvReport), "settled 4500 of 5000") {
+		t.Fatalf("unexpected csv report:\n%s", csvReport)
+	}
+
+	fixed, err := svc.Fix(context.Background(), report.ID)
+	if err != nil {
+		t.Fatalf("Fix() error = %v", err)
+	}
+	if fixed.Fixed != 1 || fixed.Failed != 0 || len(settled) != 1 || settled[0] != "pi_stuck" {
+		t.Fatalf("expected only the stuck order settled, got %+v settled=%v", fixed, settled)
+	}
+	again, err := svc.Fix(context.Background(), report.ID)
+	if err != nil || again.Fixed != 0 || len(settled) != 1 {
+		t.Fatalf("expected fixed mismatches to be skipped, got %+v err=%v", again, err)
+	}
+	if _, err := svc.Fix(context.Background(), "rec_missing"); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("expected ErrReportNotFound, got %v", err)
+	}
+
+	rerun, _ := svc.Run(context.Background())
+	if len(rerun.Mismatches) != 3 {
+		t.Fatalf("expected the stuck order resolved on the next run, got %+v", rerun.Mismatches)
+	}
+	if listed := svc.List(); len(listed) != 2 || listed[0].ID != rerun.ID {
+		t.Fatalf("expected reports newest first, got %+v", listed)
+	}
+}
+
+func TestRunRecordsProviderFailure(t *testing.T) {
+	svc := NewService(Config{
+		ListPayments: func(context.Context, time.Time, time.Time) ([]payments.PaymentRecord, error) {
+			return nil, errors.New("stripe unavailable")
+		},
+	})
+
+	report, _ := svc.Run(context.Background())
+	if report.Status != ReportStatusFailed || report.Error != "stripe unavailable" || len(report.Mismatches) != 0 {
+		t.Fatalf("expected failed report, got %+v", report)
+	}
+	if stored, found := svc.Get(report.ID); !found || stored.Status != ReportStatusFailed {
+		t.Fatalf("expected failed report stored, got %+v", stored)
+	}
+}
+
+func TestStartStopsWhenContextIsCancelled(t *testing.T) {
+	svc := NewService(Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := svc.Start(ctx, time.Hour)
+	select {
+	case <-done:
+		t.Fatal("expected reconciliation to run until cancelled")
+	default:
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected reconciliation to stop after cancel")
+	}
+}
@@ -24,8 +24,24 @@ var (
 	ErrSlugInUse          = errors.New("vendor slug already in use")
 	ErrVendorNotFound     = errors.New("vendor not found")
 	ErrInvalidState       = errors.New("invalid verification state")
+	ErrInvalidLegal       = errors.New("legal details are invalid")
 )
 
+// LegalDetails identify the vendor as the seller on the invoices it issues.
+type LegalDetails struct {
+	LegalName string `json:"legal_name"`
+	TaxID     string `json:"tax_id,omitempty"`
+	Address   string `json:"address"`
+	Email     string `json:"email,omitempty"`
+	// CountryCode is the ISO 3166-1 alpha-2 country of Address.
+	CountryCode string `json:"country_code,omitempty"`
+	// InvoiceLocale picks the template of the vendor's invoices; empty uses
+	// the platform default.
+	InvoiceLocale string `json:"invoice_locale,omitempty"`
+	// InvoiceFooter is printed at the bottom of the vendor's invoices.
+	InvoiceFooter string `json:"invoice_footer,omitempty"`
+}
+
 // Vendor captures vendor profile and verification state.
 type Vendor struct {
 	ID                    string            `json:"id"`
@@ -34,6 +50,9 @@ type Vendor struct {
 	DisplayName           string            `json:"display_name"`
 	VerificationState     VerificationState `json:"verification_state"`
 	CommissionOverrideBPS *int32            `json:"commission_override_bps"`
+	StripeAccountID       string            `json:"stripe_account_id,omitempty"`
+	PayoutsEnabled        bool              `json:"payouts_enabled"`
+	LegalDetails          *LegalDetails     `json:"legal_details,omitempty"`
 	CreatedAt             time.Time         `json:"created_at"`
 	UpdatedAt             time.Time         `json:"updated_at"`
 }
@@ -44,13 +63,21 @@ type Service struct {
 	byID      map[string]Vendor
 	byOwnerID map[string]string
 	bySlug    map[string]string
+	// members holds each vendor's team by user ID; memberVendor maps a user
+	// to the one team they are on.
+	members      map[string]map[string]Member
+	memberVendor map[string]string
+	invitations  map[string]Invitation
 }
 
 func NewService() *Service {
 	return &Service{
-		byID:      make(map[string]Vendor),
-		byOwnerID: make(map[string]string),
-		bySlug:    make(map[string]string),
+		byID:         make(map[string]Vendor),
+		byOwnerID:    make(map[string]string),
+		bySlug:       make(map[string]string),
+		members:      make(map[string]map[string]Member),
+		memberVendor: make(map[string]string),
+		invitations:  make(map[string]Invitation),
 	}
 }
 
@@ -63,7 +90,7 @@ func (s *Service) Register(ownerUserID, slug, displayName string) (Vendor, error
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.byOwnerID[ownerUserID]; exists {
+	if _, exists := s.memberVendor[ownerUserID]; exists {
 		return Vendor{}, ErrOwnerAlreadyVendor
 	}
 	if _, exists := s.bySlug[normalizedSlug]; exists {
@@ -84,6 +111,7 @@ func (s *Service) Register(ownerUserID, slug, displayName string) (Vendor, error
 	s.byID[vendor.ID] = vendor
 	s.byOwnerID[ownerUserID] = vendor.ID
 	s.bySlug[normalizedSlug] = vendor.ID
+	s.addMemberLocked(vendor.ID, Member{UserID: ownerUserID, Role: MemberRoleOwner, JoinedAt: now})
 	return vendor, nil
 }
 
@@ -161,6 +189,69 @@ func (s *Service) SetCommission(vendorID string, commissionBPS int32) (Vendor, e
 	return vendor, nil
 }
 
+// SetStripeAccount links the vendor's Stripe Connect account. Transfers only
+// go to accounts with payouts enabled.
+func (s *Service) SetStripeAccount(vendorID, accountID string, payoutsEnabled bool) (Vendor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vendor, exists := s.byID[vendorID]
+	if !exists {
+		return Vendor{}, ErrVendorNotFound
+	}
+
+	vendor.StripeAccountID = strings.TrimSpace(accountID)
+	vendor.PayoutsEnabled = payoutsEnabled && vendor.StripeAccountID != ""
+	vendor.UpdatedAt = time.Now().UTC()
+	s.byID[vendorID] = vendor
+	return vendor, nil
+}
+
+// SetLegalDetails records the seller details printed on the vendor's
+// invoices. Documents already issued keep the details they were issued with.
+func (s *Service) SetLegalDetails(vendorID string, details LegalDetails) (Vendor, error) {
+	details = LegalDetails{
+		LegalName:     strings.TrimSpace(details.LegalName),
+		TaxID:         strings.TrimSpace(details.TaxID),
+		Address:       strings.TrimSpace(details.Address),
+		Email:         strings.TrimSpace(details.Email),
+		CountryCode:   strings.ToUpper(strings.TrimSpace(details.CountryCode)),
+		InvoiceLocale: strings.ToLower(strings.TrimSpace(details.InvoiceLocale)),
+		InvoiceFooter: strings.TrimSpace(details.InvoiceFooter),
+	}
+	if details.LegalName == "" || details.Address == "" || !isCountryCode(details.CountryCode) {
+		return Vendor{}, ErrInvalidLegal
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vendor, exists := s.byID[vendorID]
+	if !exists {
+		return Vendor{}, ErrVendorNotFound
+	}
+
+	vendor.LegalDetails = &details
+	vendor.UpdatedAt = time.Now().UTC()
+	s.byID[vendorID] = vendor
+	return vendor, nil
+}
+
+func isCountryCode(code string) bool {
+	if code == "" {
+		return true
+	}
+	if len(code) != 2 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 func isValidState(state VerificationState) bool {
 	switch state {
 	case VerificationPending, VerificationVerified, VerificationRejected, VerificationSuspended:
@@ -1,6 +1,9 @@
 package vendors
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestRegisterAndVerificationState(t *testing.T) {
 	service := NewService()
@@ -50,3 +53,110 @@ func TestRegisterAndVerificationState(t *testing.T) {
 		t.Fatalf("expected verified vendor %s, got %s", created.ID, verifiedVendors[0].ID)
 	}
 }
+
+func TestSetLegalDetails(t *testing.T) {
+	service := NewService()
+
+	created, err := service.Register("usr_1", "example-shop", "Example Shop")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := service.SetLegalDetails(created.ID, LegalDetails{LegalName: "Example Shop GmbH"}); err != ErrInvalidLegal {
+		t.Fatalf("expected ErrInvalidLegal, got %v", err)
+	}
+	if _, err := service.SetLegalDetails(created.ID, LegalDetails{LegalName: "Example Shop GmbH", Address: "Berlin", CountryCode: "DEU"}); err != ErrInvalidLegal {
+		t.Fatalf("expected ErrInvalidLegal for a three-letter country, got %v", err)
+	}
+	if _, err := service.SetLegalDetails("ven_missing", LegalDetails{LegalName: "Missing", Address: "Nowhere"}); err != ErrVendorNotFound {
+		t.Fatalf("expected ErrVendorNotFound, got %v", err)
+	}
+
+	updated, err := service.SetLegalDetails(created.ID, LegalDetails{
+		LegalName:   " Example Shop GmbH ",
+		TaxID:       "DE123456789",
+		Address:     "1 Mill Road, Berlin",
+		CountryCode: "de",
+	})
+	if err != nil {
+		t.Fatalf("SetLegalDetails() error = %v", err)
+	}
+	if updated.LegalDetails == nil || updated.LegalDetails.LegalName != "Example Shop GmbH" || updated.LegalDetails.TaxID != "DE123456789" || updated.LegalDetails.CountryCode != "DE" {
+		t.Fatalf("expected trimmed legal details, got %+v", updated.LegalDetails)
+	}
+}
+
+func TestTeamInvitationsAndMembers(t *testing.T) {
+	service := NewService()
+	shop, err := service.Register("usr_owner", "team-shop", "Team Shop")
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, member, ok := service.GetByMember("usr_owner"); !ok || member.Role != MemberRoleOwner {
+		t.Fatalf("expected the registering user to own the team, got %+v ok=%v", member, ok)
+	}
+
+	if _, _, err := service.Invite(shop.ID, "staff@example.com", "janitor", "usr_owner", time.Hour); err != ErrInvalidMemberRole {
+		t.Fatalf("expected ErrInvalidMemberRole, got %v", err)
+	}
+	if _, _, err := service.Invite(shop.ID, "not-an-email", MemberRoleFinance, "usr_owner", time.Hour); err != ErrInvalidEmail {
+		t.Fatalf("expected ErrInvalidEmail, got %v", err)
+	}
+
+	_, replaced, _ := service.Invite(shop.ID, "Staff@Example.com", MemberRoleFinance, "usr_owner", time.Hour)
+	invitation, token, err := service.Invite(shop.ID, "staff@example.com", MemberRoleCatalogManager, "usr_owner", time.Hour)
+	if err != nil {
+		t.Fatalf("Invite() error = %v", err)
+	}
+	if pending := service.PendingInvitations(shop.ID); len(pending) != 1 || pending[0].ID != invitation.ID {
+		t.Fatalf("expected the new invitation to replace the old one, got %+v", pending)
+	}
+	if _, _, err := service.AcceptInvitation(replaced, "usr_staff", "staff@example.com"); err != ErrInvalidInvitation {
+		t.Fatalf("expected the replaced token to fail, got %v", err)
+	}
+	if _, _, err := service.AcceptInvitation(token, "usr_other", "other@example.com"); err != ErrInvitationEmail {
+		t.Fatalf("expected ErrInvitationEmail, got %v", err)
+	}
+	if _, _, err := service.AcceptInvitation(token, "usr_owner", "staff@example.com"); err != ErrAlreadyMember {
+		t.Fatalf("expected ErrAlreadyMember, got %v", err)
+	}
+
+	_, member, err := service.AcceptInvitation(token, "usr_staff", "STAFF@example.com")
+	if err != nil || member.Role != MemberRoleCatalogManager || member.InvitedBy != "usr_owner" {
+		t.Fatalf("AcceptInvitation() = %+v err=%v", member, err)
+	}
+	if _, _, err := service.AcceptInvitation(token, "usr_staff", "staff@example.com"); err != ErrInvalidInvitation {
+		t.Fatalf("expected a used invitation to fail, got %v", err)
+	}
+	if members := service.Members(shop.ID); len(members) != 2 || members[0].UserID != "usr_owner" {
+		t.Fatalf("expected owner first, got %+v", members)
+	}
+
+	if _, _, err := service.SetMemberRole(shop.ID, "usr_owner", MemberRoleFinance); err != ErrPrimaryOwner {
+		t.Fatalf("expected ErrPrimaryOwner, got %v", err)
+	}
+	before, after, err := service.SetMemberRole(shop.ID, "usr_staff", MemberRoleFulfilment)
+	if err != nil || before.Role != MemberRoleCatalogManager || after.Role != MemberRoleFulfilment {
+		t.Fatalf("SetMemberRole() = %+v %+v err=%v", before, after, err)
+	}
+
+	if _, err := service.RemoveMember(shop.ID, "usr_owner"); err != ErrPrimaryOwner {
+		t.Fatalf("expected ErrPrimaryOwner, got %v", err)
+	}
+	if _, err := service.RemoveMember(shop.ID, "usr_staff"); err != nil {
+		t.Fatalf("RemoveMember() error = %v", err)
+	}
+	if _, _, ok := service.GetByMember("usr_staff"); ok {
+		t.Fatal("expected the removed member to have no vendor")
+	}
+	if _, err := service.RemoveMember(shop.ID, "usr_staff"); err != ErrMemberNotFound {
+		t.Fatalf("expected ErrMemberNotFound, got %v", err)
+	}
+
+	pending, _, _ := service.Invite(shop.ID, "later@example.com", MemberRoleFinance, "usr_owner", time.Hour)
+	if _, err := service.RevokeInvitation(shop.ID, pending.ID); err != nil {
+		t.Fatalf("RevokeInvitation() error = %v", err)
+	}
+	if _, err := service.RevokeInvitation(shop.ID, pending.ID); err != ErrInvitationNotFound {
+		t.Fatalf("expected ErrInvitationNotFound, got %v", err)
+	}
+}
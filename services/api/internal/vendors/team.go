@@ -0,0 +1,287 @@
+package vendors
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+// MemberRole is a vendor team member's job in the shop.
+type MemberRole string
+
+const (
+	MemberRoleOwner          MemberRole = "owner"
+	MemberRoleCatalogManager MemberRole = "catalog_manager"
+	MemberRoleFulfilment     MemberRole = "fulfilment"
+	MemberRoleFinance        MemberRole = "finance"
+)
+
+var (
+	ErrInvalidMemberRole  = errors.New("invalid team member role")
+	ErrInvalidEmail       = errors.New("invalid invitation email")
+	ErrMemberNotFound     = errors.New("team member not found")
+	ErrAlreadyMember      = errors.New("user already belongs to a vendor team")
+	ErrPrimaryOwner       = errors.New("the primary owner cannot be removed or demoted")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invitation is invalid, expired or already used")
+	ErrInvitationEmail    = errors.New("invitation was sent to another email")
+)
+
+// MemberRoles returns the team roles in stable order.
+func MemberRoles() []MemberRole {
+	return []MemberRole{MemberRoleOwner, MemberRoleCatalogManager, MemberRoleFulfilment, MemberRoleFinance}
+}
+
+func isMemberRole(role MemberRole) bool {
+	for _, known := range MemberRoles() {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Member is a user on a vendor's team.
+type Member struct {
+	UserID    string     `json:"user_id"`
+	Role      MemberRole `json:"role"`
+	InvitedBy string     `json:"invited_by,omitempty"`
+	JoinedAt  time.Time  `json:"joined_at"`
+}
+
+// Invitation asks the owner of an email address to join a vendor team. Only
+// the hash of its token is kept.
+type Invitation struct {
+	ID         string     `json:"id"`
+	VendorID   string     `json:"vendor_id"`
+	Email      string     `json:"email"`
+	Role       MemberRole `json:"role"`
+	InvitedBy  string     `json:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+
+	tokenHash string
+}
+
+func (s *Service) addMemberLocked(vendorID string, member Member) {
+	if s.members[vendorID] == nil {
+		s.members[vendorID] = make(map[string]Member)
+	}
+	s.members[vendorID][member.UserID] = member
+	s.memberVendor[member.UserID] = vendorID
+}
+
+// GetByMember returns the vendor whose team the user is on.
+func (s *Service) GetByMember(userID string) (Vendor, Member, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	vendorID, exists := s.memberVendor[userID]
+	if !exists {
+		return Vendor{}, Member{}, false
+	}
+	return s.byID[vendorID], s.members[vendorID][userID], true
+}
+
+// Member returns the user's membership of the vendor team.
+func (s *Service) Member(vendorID, userID string) (Member, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	member, exists := s.members[vendorID][userID]
+	return member, exists
+}
+
+// Members lists the team, owners first, then by join date.
+func (s *Service) Members(vendorID string) []Member {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]Member, 0, len(s.members[vendorID]))
+	for _, member := range s.members[vendorID] {
+		items = append(items, member)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		iOwner, jOwner := items[i].Role == MemberRoleOwner, items[j].Role == MemberRoleOwner
+		if iOwner != jOwner {
+			return iOwner
+		}
+		if !items[i].JoinedAt.Equal(items[j].JoinedAt) {
+			return items[i].JoinedAt.Before(items[j].JoinedAt)
+		}
+		return items[i].UserID < items[j].UserID
+	})
+	return items
+}
+
+// Invite creates an invitation and returns it with its raw token. A new
+// invitation replaces a pending one for the same email.
+func (s *Service) Invite(vendorID, email string, role MemberRole, invitedBy string, ttl time.Duration) (Invitation, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return Invitation{}, "", ErrInvalidEmail
+	}
+	if !isMemberRole(role) {
+		return Invitation{}, "", ErrInvalidMemberRole
+	}
+	token, err := invitationToken()
+	if err != nil {
+		return Invitation{}, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.byID[vendorID]; !exists {
+		return Invitation{}, "", ErrVendorNotFound
+	}
+	for id, pending := range s.invitations {
+		if pending.VendorID == vendorID && pending.Email == email && pending.AcceptedAt == nil {
+			delete(s.invitations, id)
+		}
+	}
+
+	now := time.Now().UTC()
+	invitation := Invitation{
+		ID:        identifier.New("vinv"),
+		VendorID:  vendorID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		tokenHash: hashInvitationToken(token),
+	}
+	s.invitations[invitation.ID] = invitation
+	return invitation, token, nil
+}
+
+// PendingInvitations lists the vendor's unanswered, unexpired invitations,
+// newest first.
+func (s *Service) PendingInvitations(vendorID string) []Invitation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now().UTC()
+	items := make([]Invitation, 0)
+	for _, invitation := range s.invitations {
+		if invitation.VendorID == vendorID && invitation.AcceptedAt == nil && invitation.ExpiresAt.After(now) {
+			items = append(items, invitation)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+// RevokeInvitation withdraws a pending invitation.
+func (s *Service) RevokeInvitation(vendorID, invitationID string) (Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitation, exists := s.invitations[invitationID]
+	if !exists || invitation.VendorID != vendorID || invitation.AcceptedAt != nil {
+		return Invitation{}, ErrInvitationNotFound
+	}
+	delete(s.invitations, invitationID)
+	return invitation, nil
+}
+
+// AcceptInvitation adds the user to the team the token invites them to.
+// The invitation must be addressed to the user's email and works once.
+func (s *Service) AcceptInvitation(rawToken, userID, email string) (Invitation, Member, error) {
+	hash := hashInvitationToken(strings.TrimSpace(rawToken))
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, invitation := range s.invitations {
+		if invitation.tokenHash != hash {
+			continue
+		}
+		if invitation.AcceptedAt != nil || !invitation.ExpiresAt.After(now) {
+			return Invitation{}, Member{}, ErrInvalidInvitation
+		}
+		if invitation.Email != email {
+			return Invitation{}, Member{}, ErrInvitationEmail
+		}
+		if _, exists := s.memberVendor[userID]; exists {
+			return Invitation{}, Member{}, ErrAlreadyMember
+		}
+		if _, exists := s.byID[invitation.VendorID]; !exists {
+			return Invitation{}, Member{}, ErrVendorNotFound
+		}
+
+		member := Member{UserID: userID, Role: invitation.Role, InvitedBy: invitation.InvitedBy, JoinedAt: now}
+		s.addMemberLocked(invitation.VendorID, member)
+		invitation.AcceptedAt = &now
+		s.invitations[id] = invitation
+		return invitation, member, nil
+	}
+	return Invitation{}, Member{}, ErrInvalidInvitation
+}
+
+// SetMemberRole changes a member's role and returns the membership before
+// and after.
+func (s *Service) SetMemberRole(vendorID, userID string, role MemberRole) (Member, Member, error) {
+	if !isMemberRole(role) {
+		return Member{}, Member{}, ErrInvalidMemberRole
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member, exists := s.members[vendorID][userID]
+	if !exists {
+		return Member{}, Member{}, ErrMemberNotFound
+	}
+	if s.byID[vendorID].OwnerUserID == userID && role != MemberRoleOwner {
+		return Member{}, Member{}, ErrPrimaryOwner
+	}
+	updated := member
+	updated.Role = role
+	s.members[vendorID][userID] = updated
+	return member, updated, nil
+}
+
+// RemoveMember takes a user off the team. The primary owner stays.
+func (s *Service) RemoveMember(vendorID, userID string) (Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member, exists := s.members[vendorID][userID]
+	if !exists {
+		return Member{}, ErrMemberNotFound
+	}
+	if s.byID[vendorID].OwnerUserID == userID {
+		return Member{}, ErrPrimaryOwner
+	}
+	delete(s.members[vendorID], userID)
+	delete(s.memberVendor, userID)
+	return member, nil
+}
+
+func invitationToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,450 @@
+package wishlists
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/notifications"
+	"github.com/yxshee/marketplace-platform/services/api/internal/platform/identifier"
+)
+
+type AlertKind string
+
+const (
+	AlertKindBackInStock AlertKind = "back_in_stock"
+	AlertKindPriceDrop   AlertKind = "price_drop"
+)
+
+const (
+	MaxListsPerBuyer = 20
+	MaxItemsPerList  = 200
+	maxListNameRunes = 80
+
+	notificationSendTimeout = 10 * time.Second
+)
+
+var (
+	ErrWishlistNotFound     = errors.New("wishlist not found")
+	ErrWishlistNameInUse    = errors.New("wishlist name already in use")
+	ErrWishlistLimitReached = errors.New("wishlist limit reached")
+	ErrItemNotFound         = errors.New("wishlist item not found")
+	ErrAlertNotFound        = errors.New("product alert not found")
+	ErrInvalidInput         = errors.New("invalid wishlist input")
+)
+
+// Wishlist is a named list of products a buyer saved for later.
+type Wishlist struct {
+	ID          string    `json:"id"`
+	BuyerUserID string    `json:"buyer_user_id"`
+	Name        string    `json:"name"`
+	Items       []Item    `json:"items"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Item struct {
+	ProductID string    `json:"product_id"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// Alert subscribes a buyer to stock or price changes on one product. Price
+// drop alerts with a zero threshold fire on any decrease.
+type Alert struct {
+	ID                  string     `json:"id"`
+	BuyerUserID         string     `json:"buyer_user_id"`
+	ProductID           string     `json:"product_id"`
+	Kind                AlertKind  `json:"kind"`
+	PriceThresholdCents int64      `json:"price_threshold_cents,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	LastNotifiedAt      *time.Time `json:"last_notified_at,omitempty"`
+}
+
+// ProductChange describes a catalog update as seen by alert subscribers.
+type ProductChange struct {
+	ProductID          string
+	Title              string
+	Currency           string
+	PreviousStockQty   int32
+	StockQty           int32
+	PreviousPriceCents int64
+	PriceCents         int64
+}
+
+type Config struct {
+	Notifier notifications.Notifier
+}
+
+// Service stores buyer wishlists and product alert subscriptions.
+type Service struct {
+	mu           sync.RWMutex
+	notifier     notifications.Notifier
+	now          func() time.Time
+	lists        map[string]Wishlist
+	listsByBuyer map[string][]string
+	alerts       map[string]Alert
+}
+
+func NewService(cfg Config) *Service {
+	notifier := cfg.Notifier
+	if notifier == nil {
+		notifier = notifications.LogNotifier{}
+	}
+	return &Service{
+		notifier:     notifier,
+		now:          func() time.Time { return time.Now().UTC() },
+		lists:        make(map[string]Wishlist),
+		listsByBuyer: make(map[string][]string),
+		alerts:       make(map[string]Alert),
+	}
+}
+
+func (s *Service) CreateList(buyerUserID, name string) (Wishlist, error) {
+	buyerUserID = strings.TrimSpace(buyerUserID)
+	name, err := normalizeListName(name)
+	if buyerUserID == "" || err != nil {
+		return Wishlist{}, ErrInvalidInput
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.listsByBuyer[buyerUserID]) >= MaxListsPerBuyer {
+		return Wishlist{}, ErrWishlistLimitReached
+	}
+	if s.nameInUseLocked(buyerUserID, name, "") {
+		return Wishlist{}, ErrWishlistNameInUse
+	}
+
+	now := s.now()
+	list := Wishlist{
+		ID:          identifier.New("wsl"),
+		BuyerUserID: buyerUserID,
+		Name:        name,
+		Items:       []Item{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.lists[list.ID] = list
+	s.listsByBuyer[buyerUserID] = append(s.listsByBuyer[buyerUserID], list.ID)
+	return cloneList(list), nil
+}
+
+// ListForBuyer returns the buyer's wishlists in creation order.
+func (s *Service) ListForBuyer(buyerUserID string) []Wishlist {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.listsByBuyer[strings.TrimSpace(buyerUserID)]
+	items := make([]Wishlist, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, cloneList(s.lists[id]))
+	}
+	return items
+}
+
+func (s *Service) GetList(buyerUserID, wishlistID string) (Wishlist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, err := s.ownedListLocked(buyerUserID, wishlistID)
+	if err != nil {
+		return Wishlist{}, err
+	}
+	return cloneList(list), nil
+}
+
+func (s *Service) RenameList(buyerUserID, wishlistID, name string) (Wishlist, error) {
+	name, err := normalizeListName(name)
+	if err != nil {
+		return Wishlist{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.ownedListLocked(buyerUserID, wishlistID)
+	if err != nil {
+		return Wishlist{}, err
+	}
+	if s.nameInUseLocked(list.BuyerUserID, name, list.ID) {
+		return Wishlist{}, ErrWishlistNameInUse
+	}
+	list.Name = name
+	list.UpdatedAt = s.now()
+	s.lists[list.ID] = list
+	return cloneList(list), nil
+}
+
+func (s *Service) DeleteList(buyerUserID, wishlistID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.ownedListLocked(buyerUserID, wishlistID)
+	if err != nil {
+		return err
+	}
+	delete(s.lists, list.ID)
+	ids := s.listsByBuyer[list.BuyerUserID]
+	for i, id := range ids {
+		if id == list.ID {
+			s.listsByBuyer[list.BuyerUserID] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// AddItem saves a product to a wishlist. Adding a product already on the list
+// is a no-op.
+func (s *Service) AddItem(buyerUserID, wishlistID, productID string) (Wishlist, error) {
+	productID = strings.TrimSpace(productID)
+	if productID == "" {
+		return Wishlist{}, ErrInvalidInput
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.ownedListLocked(buyerUserID, wishlistID)
+	if err != nil {
+		return Wishlist{}, err
+	}
+	for _, item := range list.Items {
+		if item.ProductID == productID {
+			return cloneList(list), nil
+		}
+	}
+	if len(list.Items) >= MaxItemsPerList {
+		return Wishlist{}, ErrWishlistLimitReached
+	}
+
+	now := s.now()
+	list.Items = append(cloneItems(list.Items), Item{ProductID: productID, AddedAt: now})
+	list.UpdatedAt = now
+	s.lists[list.ID] = list
+	return cloneList(list), nil
+}
+
+func (s *Service) RemoveItem(buyerUserID, wishlistID, productID string) (Wishlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.ownedListLocked(buyerUserID, wishlistID)
+	if err != nil {
+		return Wishlist{}, err
+	}
+	productID = strings.TrimSpace(productID)
+	for i, item := range list.Items {
+		if item.ProductID != productID {
+			continue
+		}
+		items := cloneItems(list.Items)
+		list.Items = append(items[:i], items[i+1:]...)
+		list.UpdatedAt = s.now()
+		s.lists[list.ID] = list
+		return cloneList(list), nil
+	}
+	return Wishlist{}, ErrItemNotFound
+}
+
+// Subscribe creates an alert, or updates the threshold of the buyer's
+// existing alert of the same kind for the product.
+func (s *Service) Subscribe(buyerUserID, productID string, kind AlertKind, priceThresholdCents int64) (Alert, error) {
+	buyerUserID = strings.TrimSpace(buyerUserID)
+	productID = strings.TrimSpace(productID)
+	if buyerUserID == "" || productID == "" || priceThresholdCents < 0 {
+		return Alert{}, ErrInvalidInput
+	}
+	switch kind {
+	case AlertKindBackInStock:
+		if priceThresholdCents != 0 {
+			return Alert{}, ErrInvalidInput
+		}
+	case AlertKindPriceDrop:
+	default:
+		return Alert{}, ErrInvalidInput
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, alert := range s.alerts {
+		if alert.BuyerUserID == buyerUserID && alert.ProductID == productID && alert.Kind == kind {
+			alert.PriceThresholdCents = priceThresholdCents
+			s.alerts[id] = alert
+			return alert, nil
+		}
+	}
+
+	alert := Alert{
+		ID:                  identifier.New("alr"),
+		BuyerUserID:         buyerUserID,
+		ProductID:           productID,
+		Kind:                kind,
+		PriceThresholdCents: priceThresholdCents,
+		CreatedAt:           s.now(),
+	}
+	s.alerts[alert.ID] = alert
+	return alert, nil
+}
+
+// ListAlerts returns the buyer's alert subscriptions, oldest first.
+func (s *Service) ListAlerts(buyerUserID string) []Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buyerUserID = strings.TrimSpace(buyerUserID)
+	items := make([]Alert, 0)
+	for _, alert := range s.alerts {
+		if alert.BuyerUserID == buyerUserID {
+			items = append(items, alert)
+		}
+	}
+	sortAlerts(items)
+	return items
+}
+
+func (s *Service) Unsubscribe(buyerUserID, alertID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alert, exists := s.alerts[strings.TrimSpace(alertID)]
+	if !exists || alert.BuyerUserID != strings.TrimSpace(buyerUserID) {
+		return ErrAlertNotFound
+	}
+	delete(s.alerts, alert.ID)
+	return nil
+}
+
+// ProductChanged notifies subscribers when a product comes back in stock or
+// its price drops to or below their threshold. It returns the number of
+// notifications delivered.
+func (s *Service) ProductChanged(ctx context.Context, change ProductChange) int {
+	s.mu.RLock()
+	due := make([]Alert, 0)
+	for _, alert := range s.alerts {
+		if alert.ProductID == change.ProductID && alertTriggered(alert, change) {
+			due = append(due, alert)
+		}
+	}
+	s.mu.RUnlock()
+	sortAlerts(due)
+
+	delivered := 0
+	for _, alert := range due {
+		sendCtx, cancel := context.WithTimeout(ctx, notificationSendTimeout)
+		err := s.notifier.Notify(sendCtx, alertMessage(alert, change, s.now()))
+		cancel()
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		if current, exists := s.alerts[alert.ID]; exists {
+			notifiedAt := s.now()
+			current.LastNotifiedAt = &notifiedAt
+			s.alerts[alert.ID] = current
+		}
+		s.mu.Unlock()
+		delivered++
+	}
+	return delivered
+}
+
+func alertTriggered(alert Alert, change ProductChange) bool {
+	switch alert.Kind {
+	case AlertKindBackInStock:
+		return change.PreviousStockQty <= 0 && change.StockQty > 0
+	case AlertKindPriceDrop:
+		if change.PriceCents <= 0 || change.PriceCents >= change.PreviousPriceCents {
+			return false
+		}
+		if alert.PriceThresholdCents == 0 {
+			return true
+		}
+		return change.PreviousPriceCents > alert.PriceThresholdCents && change.PriceCents <= alert.PriceThresholdCents
+	default:
+		return false
+	}
+}
+
+func alertMessage(alert Alert, change ProductChange, now time.Time) notifications.Message {
+	title := change.Title
+	if title == "" {
+		title = "An item you follow"
+	}
+
+	message := notifications.Message{
+		Kind:            string(alert.Kind),
+		RecipientUserID: alert.BuyerUserID,
+		Data: map[string]string{
+			"alert_id":    alert.ID,
+			"product_id":  change.ProductID,
+			"price_cents": strconv.FormatInt(change.PriceCents, 10),
+			"currency":    change.Currency,
+			"stock_qty":   strconv.FormatInt(int64(change.StockQty), 10),
+		},
+		CreatedAt: now,
+	}
+	switch alert.Kind {
+	case AlertKindBackInStock:
+		message.Subject = fmt.Sprintf("%s is back in stock", title)
+		message.Body = fmt.Sprintf("%s is available again. Grab it before it sells out.", title)
+	case AlertKindPriceDrop:
+		message.Subject = fmt.Sprintf("Price drop on %s", title)
+		message.Body = fmt.Sprintf("The price of %s just dropped. Check it out while the offer lasts.", title)
+		message.Data["previous_price_cents"] = strconv.FormatInt(change.PreviousPriceCents, 10)
+	}
+	return message
+}
+
+func (s *Service) ownedListLocked(buyerUserID, wishlistID string) (Wishlist, error) {
+	list, exists := s.lists[strings.TrimSpace(wishlistID)]
+	if !exists || list.BuyerUserID != strings.TrimSpace(buyerUserID) {
+		return Wishlist{}, ErrWishlistNotFound
+	}
+	return list, nil
+}
+
+func (s *Service) nameInUseLocked(buyerUserID, name, exceptID string) bool {
+	for _, id := range s.listsByBuyer[buyerUserID] {
+		if id != exceptID && strings.EqualFold(s.lists[id].Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeListName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxListNameRunes {
+		return "", ErrInvalidInput
+	}
+	return name, nil
+}
+
+func sortAlerts(items []Alert) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+}
+
+func cloneList(list Wishlist) Wishlist {
+	list.Items = cloneItems(list.Items)
+	return list
+}
+
+func cloneItems(items []Item) []Item {
+	cloned := make([]Item, len(items))
+	copy(cloned, items)
+	return cloned
+}
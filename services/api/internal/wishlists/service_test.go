@@ -0,0 +1,113 @@
+package wishlists
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yxshee/marketplace-platform/services/api/internal/notifications"
+)
+
+func TestWishlistListsAreScopedToBuyerAndNamedUniquely(t *testing.T) {
+	svc := NewService(Config{})
+
+	gifts, err := svc.CreateList("usr_1", "Gifts")
+	if err != nil {
+		t.Fatalf("CreateList() error = %v", err)
+	}
+	if _, err := svc.CreateList("usr_1", " gifts "); err != ErrWishlistNameInUse {
+		t.Fatalf("expected ErrWishlistNameInUse, got %v", err)
+	}
+	if _, err := svc.CreateList("usr_2", "Gifts"); err != nil {
+		t.Fatalf("expected other buyer to reuse the name, got %v", err)
+	}
+	if _, err := svc.CreateList("usr_1", ""); err != ErrInvalidInput {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+
+	if _, err := svc.AddItem("usr_1", gifts.ID, "prd_1"); err != nil {
+		t.Fatalf("AddItem() error = %v", err)
+	}
+	updated, err := svc.AddItem("usr_1", gifts.ID, "prd_1")
+	if err != nil || len(updated.Items) != 1 {
+		t.Fatalf("expected duplicate add to be a no-op, got %+v err=%v", updated, err)
+	}
+	if _, err := svc.AddItem("usr_2", gifts.ID, "prd_2"); err != ErrWishlistNotFound {
+		t.Fatalf("expected other buyer to be denied, got %v", err)
+	}
+
+	later, _ := svc.CreateList("usr_1", "Later")
+	if _, err := svc.RenameList("usr_1", later.ID, "GIFTS"); err != ErrWishlistNameInUse {
+		t.Fatalf("expected rename collision, got %v", err)
+	}
+	if lists := svc.ListForBuyer("usr_1"); len(lists) != 2 || lists[0].ID != gifts.ID {
+		t.Fatalf("unexpected buyer lists %+v", lists)
+	}
+
+	if _, err := svc.RemoveItem("usr_1", gifts.ID, "prd_missing"); err != ErrItemNotFound {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+	removed, err := svc.RemoveItem("usr_1", gifts.ID, "prd_1")
+	if err != nil || len(removed.Items) != 0 {
+		t.Fatalf("RemoveItem() = %+v, %v", removed, err)
+	}
+	if err := svc.DeleteList("usr_1", gifts.ID); err != nil {
+		t.Fatalf("DeleteList() error = %v", err)
+	}
+	if lists := svc.ListForBuyer("usr_1"); len(lists) != 1 || lists[0].ID != later.ID {
+		t.Fatalf("expected only the remaining list, got %+v", lists)
+	}
+}
+
+func TestProductChangedNotifiesBackInStockAndPriceDropSubscribers(t *testing.T) {
+	outbox := notifications.NewOutbox(nil, 10)
+	svc := NewService(Config{Notifier: outbox})
+
+	if _, err := svc.Subscribe("usr_1", "prd_1", AlertKindBackInStock, 500); err != ErrInvalidInput {
+		t.Fatalf("expected threshold on back-in-stock alert to be rejected, got %v", err)
+	}
+	if _, err := svc.Subscribe("usr_1", "prd_1", AlertKindBackInStock, 0); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	threshold, err := svc.Subscribe("usr_2", "prd_1", AlertKindPriceDrop, 4000)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if _, err := svc.Subscribe("usr_3", "prd_1", AlertKindPriceDrop, 0); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	// A restock without a price change only reaches the back-in-stock subscriber.
+	if delivered := svc.ProductChanged(context.Background(), ProductChange{
+		ProductID: "prd_1", Title: "Lamp", Currency: "USD",
+		PreviousStockQty: 0, StockQty: 3, PreviousPriceCents: 5000, PriceCents: 5000,
+	}); delivered != 1 {
+		t.Fatalf("expected one back-in-stock notification, got %d", delivered)
+	}
+	if messages := outbox.List(string(AlertKindBackInStock), "usr_1"); len(messages) != 1 || messages[0].Data["product_id"] != "prd_1" {
+		t.Fatalf("unexpected back-in-stock messages %+v", messages)
+	}
+
+	// A drop that stays above the threshold only reaches the any-drop subscriber.
+	if delivered := svc.ProductChanged(context.Background(), ProductChange{
+		ProductID: "prd_1", PreviousStockQty: 3, StockQty: 3, PreviousPriceCents: 5000, PriceCents: 4500,
+	}); delivered != 1 {
+		t.Fatalf("expected one price drop notification, got %d", delivered)
+	}
+
+	if delivered := svc.ProductChanged(context.Background(), ProductChange{
+		ProductID: "prd_1", PreviousStockQty: 3, StockQty: 3, PreviousPriceCents: 4500, PriceCents: 3900,
+	}); delivered != 2 {
+		t.Fatalf("expected threshold crossing to notify both price subscribers, got %d", delivered)
+	}
+	alerts := svc.ListAlerts("usr_2")
+	if len(alerts) != 1 || alerts[0].ID != threshold.ID || alerts[0].LastNotifiedAt == nil {
+		t.Fatalf("expected threshold alert to record notification, got %+v", alerts)
+	}
+
+	if err := svc.Unsubscribe("usr_1", threshold.ID); err != ErrAlertNotFound {
+		t.Fatalf("expected other buyer unsubscribe to fail, got %v", err)
+	}
+	if err := svc.Unsubscribe("usr_2", threshold.ID); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+DROP INDEX IF EXISTS payment_events_retry_idx;
+DROP INDEX IF EXISTS payment_events_status_idx;
+
+DELETE FROM payment_events WHERE payment_id IS NULL OR processed_at IS NULL;
+
+ALTER TABLE payment_events DROP CONSTRAINT IF EXISTS payment_events_provider_event_key;
+ALTER TABLE payment_events ADD CONSTRAINT payment_events_provider_event_id_key UNIQUE (provider_event_id);
+
+ALTER TABLE payment_events
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS received_at,
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS order_id,
+    DROP COLUMN IF EXISTS provider_ref,
+    DROP COLUMN IF EXISTS provider,
+    ALTER COLUMN processed_at SET DEFAULT NOW(),
+    ALTER COLUMN processed_at SET NOT NULL,
+    ALTER COLUMN payment_id SET NOT NULL;
+
+DROP TYPE IF EXISTS payment_event_status;
@@ -0,0 +1,25 @@
+CREATE TYPE payment_event_status AS ENUM ('received', 'processed', 'ignored', 'failed', 'dead_letter');
+
+-- Events are stored before they are matched to a payment, so payment_id is
+-- filled in once processing succeeds.
+ALTER TABLE payment_events
+    ALTER COLUMN payment_id DROP NOT NULL,
+    ALTER COLUMN processed_at DROP NOT NULL,
+    ALTER COLUMN processed_at DROP DEFAULT,
+    ADD COLUMN provider TEXT NOT NULL DEFAULT 'stripe',
+    ADD COLUMN provider_ref TEXT,
+    ADD COLUMN order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    ADD COLUMN status payment_event_status NOT NULL DEFAULT 'received',
+    ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0 CHECK (attempts >= 0),
+    ADD COLUMN last_error TEXT,
+    ADD COLUMN next_attempt_at TIMESTAMPTZ,
+    ADD COLUMN received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE payment_events SET status = 'processed', attempts = 1, received_at = processed_at;
+
+ALTER TABLE payment_events DROP CONSTRAINT payment_events_provider_event_id_key;
+ALTER TABLE payment_events ADD CONSTRAINT payment_events_provider_event_key UNIQUE (provider, provider_event_id);
+
+CREATE INDEX payment_events_status_idx ON payment_events (status, received_at DESC);
+CREATE INDEX payment_events_retry_idx ON payment_events (next_attempt_at) WHERE status = 'failed';
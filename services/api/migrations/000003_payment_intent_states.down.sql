@@ -0,0 +1,7 @@
+-- Enum values cannot be dropped, so the type is rebuilt without them.
+UPDATE payments SET status = 'pending' WHERE status IN ('requires_action', 'processing');
+
+ALTER TYPE payment_status RENAME TO payment_status_old;
+CREATE TYPE payment_status AS ENUM ('pending', 'authorized', 'succeeded', 'failed', 'cancelled', 'refunded', 'partially_refunded');
+ALTER TABLE payments ALTER COLUMN status TYPE payment_status USING status::text::payment_status;
+DROP TYPE payment_status_old;
@@ -0,0 +1,4 @@
+-- Stripe intents waiting on 3-D Secure or still processing are mirrored on
+-- the payment.
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'requires_action' AFTER 'pending';
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'processing' AFTER 'requires_action';
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS cod_buyer_refusals;
+DROP TABLE IF EXISTS cod_vendor_settlements;
+DROP TABLE IF EXISTS cod_collections;
+DROP TYPE IF EXISTS cod_settlement_kind;
+DROP TYPE IF EXISTS cod_collection_status;
+
+-- Enum values cannot be dropped, so the type is rebuilt without them.
+UPDATE payments SET status = 'succeeded' WHERE status = 'collected';
+UPDATE payments SET status = 'failed' WHERE status = 'refused';
+
+ALTER TYPE payment_status RENAME TO payment_status_old;
+CREATE TYPE payment_status AS ENUM ('pending', 'requires_action', 'processing', 'authorized', 'succeeded', 'failed', 'cancelled', 'refunded', 'partially_refunded');
+ALTER TABLE payments ALTER COLUMN status TYPE payment_status USING status::text::payment_status;
+DROP TYPE payment_status_old;
@@ -0,0 +1,41 @@
+-- Cash-on-delivery payments settle per shipment once the vendor or courier
+-- reports the cash collected or the parcel refused.
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'collected' AFTER 'succeeded';
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'refused' AFTER 'collected';
+
+CREATE TYPE cod_collection_status AS ENUM ('collected', 'refused');
+CREATE TYPE cod_settlement_kind AS ENUM ('offset', 'remittance');
+
+CREATE TABLE cod_collections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    shipment_id UUID NOT NULL UNIQUE REFERENCES shipments(id) ON DELETE CASCADE,
+    vendor_id UUID NOT NULL REFERENCES vendors(id) ON DELETE RESTRICT,
+    status cod_collection_status NOT NULL,
+    amount_cents BIGINT NOT NULL DEFAULT 0 CHECK (amount_cents >= 0),
+    commission_cents BIGINT NOT NULL DEFAULT 0 CHECK (commission_cents >= 0 AND commission_cents <= amount_cents),
+    confirmed_by TEXT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX cod_collections_vendor_id_idx ON cod_collections (vendor_id, recorded_at DESC);
+
+-- Commission the vendor owes on cash it holds is settled by withholding it
+-- from Stripe transfers or by remittances recorded by finance.
+CREATE TABLE cod_vendor_settlements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    vendor_id UUID NOT NULL REFERENCES vendors(id) ON DELETE RESTRICT,
+    currency CHAR(3) NOT NULL,
+    kind cod_settlement_kind NOT NULL,
+    reference TEXT NOT NULL,
+    amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+    settled_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (vendor_id, currency, kind, reference)
+);
+
+-- buyer_ref is the buyer's user id or guest token.
+CREATE TABLE cod_buyer_refusals (
+    buyer_ref TEXT NOT NULL,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    refused_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (buyer_ref, order_id)
+);
@@ -0,0 +1,34 @@
+DROP TABLE IF EXISTS invoice_sequences;
+CREATE TABLE invoice_sequences (
+    sequence_date DATE PRIMARY KEY,
+    last_value BIGINT NOT NULL DEFAULT 0 CHECK (last_value >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Only one invoice per order survives: credit notes, commission invoices and
+-- all but the first shipment invoice are dropped.
+DELETE FROM invoices WHERE kind <> 'invoice';
+DELETE FROM invoices i USING invoices other
+    WHERE i.order_id = other.order_id AND (i.issued_at, i.id) > (other.issued_at, other.id);
+
+DROP INDEX IF EXISTS invoices_vendor_id_idx;
+DROP INDEX IF EXISTS invoices_order_id_idx;
+DROP INDEX IF EXISTS invoices_shipment_kind_idx;
+ALTER TABLE invoices
+    DROP CONSTRAINT IF EXISTS invoices_credit_note_original_check,
+    DROP COLUMN IF EXISTS refund_request_id,
+    DROP COLUMN IF EXISTS original_invoice_id,
+    DROP COLUMN IF EXISTS recipient_snapshot,
+    DROP COLUMN IF EXISTS issuer_snapshot,
+    DROP COLUMN IF EXISTS issuer_id,
+    DROP COLUMN IF EXISTS vendor_id,
+    DROP COLUMN IF EXISTS shipment_id,
+    DROP COLUMN IF EXISTS kind,
+    ADD CONSTRAINT invoices_order_id_key UNIQUE (order_id);
+DROP TYPE IF EXISTS invoice_kind;
+
+ALTER TABLE vendors
+    DROP COLUMN IF EXISTS invoice_email,
+    DROP COLUMN IF EXISTS legal_address,
+    DROP COLUMN IF EXISTS tax_id,
+    DROP COLUMN IF EXISTS legal_name;
@@ -0,0 +1,36 @@
+-- Vendors issue an invoice per shipment, the platform invoices vendors for
+-- its commission, and approved refunds issue credit notes.
+ALTER TABLE vendors
+    ADD COLUMN legal_name TEXT,
+    ADD COLUMN tax_id TEXT,
+    ADD COLUMN legal_address TEXT,
+    ADD COLUMN invoice_email TEXT;
+
+CREATE TYPE invoice_kind AS ENUM ('invoice', 'commission_invoice', 'credit_note');
+
+-- issuer_id is the issuing vendor's id, or 'platform'.
+ALTER TABLE invoices DROP CONSTRAINT invoices_order_id_key;
+ALTER TABLE invoices
+    ADD COLUMN kind invoice_kind NOT NULL DEFAULT 'invoice',
+    ADD COLUMN shipment_id UUID REFERENCES shipments(id) ON DELETE RESTRICT,
+    ADD COLUMN vendor_id UUID REFERENCES vendors(id) ON DELETE RESTRICT,
+    ADD COLUMN issuer_id TEXT NOT NULL DEFAULT 'platform',
+    ADD COLUMN issuer_snapshot JSONB NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN recipient_snapshot JSONB NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN original_invoice_id UUID REFERENCES invoices(id) ON DELETE RESTRICT,
+    ADD COLUMN refund_request_id UUID UNIQUE REFERENCES refund_requests(id) ON DELETE RESTRICT,
+    ADD CONSTRAINT invoices_credit_note_original_check CHECK ((kind = 'credit_note') = (original_invoice_id IS NOT NULL));
+CREATE UNIQUE INDEX invoices_shipment_kind_idx ON invoices (shipment_id, kind) WHERE kind <> 'credit_note';
+CREATE INDEX invoices_order_id_idx ON invoices (order_id, issued_at);
+CREATE INDEX invoices_vendor_id_idx ON invoices (vendor_id, issued_at DESC);
+
+-- Numbering is gap-free per issuer and series (INV, CN, COM): the sequence row
+-- is locked and bumped in the transaction that stores the document.
+DROP TABLE invoice_sequences;
+CREATE TABLE invoice_sequences (
+    issuer_id TEXT NOT NULL,
+    series TEXT NOT NULL,
+    last_value BIGINT NOT NULL DEFAULT 0 CHECK (last_value >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer_id, series)
+);
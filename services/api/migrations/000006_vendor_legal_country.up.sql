@@ -0,0 +1,3 @@
+-- UBL exports carry the seller's country next to its address.
+ALTER TABLE vendors
+    ADD COLUMN legal_country_code CHAR(2) CHECK (legal_country_code ~ '^[A-Z]{2}$');
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS invoices_retain_until_idx;
+DROP INDEX IF EXISTS invoices_issued_at_idx;
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS purged_at,
+    DROP COLUMN IF EXISTS retain_until,
+    DROP COLUMN IF EXISTS content_size,
+    DROP COLUMN IF EXISTS content_sha256;
@@ -0,0 +1,9 @@
+-- Issued PDFs are stored once under pdf_storage_key; downloads are checked
+-- against content_sha256 and PDFs are purged after retain_until.
+ALTER TABLE invoices
+    ADD COLUMN content_sha256 CHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN content_size BIGINT NOT NULL DEFAULT 0 CHECK (content_size >= 0),
+    ADD COLUMN retain_until TIMESTAMPTZ,
+    ADD COLUMN purged_at TIMESTAMPTZ;
+CREATE INDEX invoices_issued_at_idx ON invoices (issued_at);
+CREATE INDEX invoices_retain_until_idx ON invoices (retain_until) WHERE purged_at IS NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE invoices
+    DROP COLUMN IF EXISTS footer,
+    DROP COLUMN IF EXISTS locale;
+ALTER TABLE vendors
+    DROP COLUMN IF EXISTS invoice_footer,
+    DROP COLUMN IF EXISTS invoice_locale;
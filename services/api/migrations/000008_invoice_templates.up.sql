@@ -0,0 +1,8 @@
+-- Vendors pick the template of their invoices and may add a footer; each
+-- document keeps the locale and footer it was issued with.
+ALTER TABLE vendors
+    ADD COLUMN invoice_locale TEXT CHECK (invoice_locale IN ('en', 'de', 'fr')),
+    ADD COLUMN invoice_footer TEXT CHECK (char_length(invoice_footer) <= 500);
+ALTER TABLE invoices
+    ADD COLUMN locale TEXT NOT NULL DEFAULT 'en',
+    ADD COLUMN footer TEXT;
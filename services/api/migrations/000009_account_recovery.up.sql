@@ -0,0 +1,15 @@
+-- Users confirm their email address; verification and password reset links
+-- carry single-use tokens that are stored hashed.
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+CREATE TABLE auth_action_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('email_verification', 'password_reset')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX auth_action_tokens_user_idx ON auth_action_tokens (user_id, purpose);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS mfa_role_policies;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS mfa_verified;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS mfa_enabled_at,
+    DROP COLUMN IF EXISTS totp_last_step,
+    DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,22 @@
+-- TOTP multi-factor authentication. The API needs the TOTP secret itself to
+-- check codes; recovery codes are stored hashed and work once.
+ALTER TABLE users
+    ADD COLUMN totp_secret TEXT,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN mfa_enabled_at TIMESTAMPTZ;
+
+ALTER TABLE sessions
+    ADD COLUMN mfa_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE mfa_recovery_codes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE mfa_role_policies (
+    role TEXT PRIMARY KEY CHECK (role IN ('buyer', 'vendor_owner', 'super_admin', 'support', 'finance', 'catalog_moderator')),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_external_identities;
+-- Passwordless users must be removed or given a password before this runs.
+ALTER TABLE users
+    ALTER COLUMN password_hash SET NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS sessions_user_id_last_used_at_idx;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,6 @@
+-- Sessions keep their ID across refresh-token rotations; the device list
+-- shows when each one was last used.
+ALTER TABLE sessions
+    ADD COLUMN last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX sessions_user_id_last_used_at_idx ON sessions (user_id, last_used_at DESC);
@@ -0,0 +1,7 @@
+DELETE FROM mfa_role_policies WHERE role IN ('vendor_catalog_manager', 'vendor_fulfilment', 'vendor_finance');
+ALTER TABLE mfa_role_policies
+    DROP CONSTRAINT mfa_role_policies_role_check,
+    ADD CONSTRAINT mfa_role_policies_role_check CHECK (role IN ('buyer', 'vendor_owner', 'super_admin', 'support', 'finance', 'catalog_moderator'));
+
+DROP TABLE IF EXISTS vendor_team_invitations;
+DROP TABLE IF EXISTS vendor_team_members;
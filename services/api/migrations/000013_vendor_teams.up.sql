@@ -0,0 +1,35 @@
+-- Vendors are run by a team. The registering user is the primary owner;
+-- others join through single-use, hashed email invitations and hold one
+-- team role each.
+CREATE TABLE vendor_team_members (
+    vendor_id UUID NOT NULL REFERENCES vendors(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'catalog_manager', 'fulfilment', 'finance')),
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (vendor_id, user_id)
+);
+
+INSERT INTO vendor_team_members (vendor_id, user_id, role, joined_at)
+SELECT id, owner_user_id, 'owner', created_at FROM vendors;
+
+CREATE TABLE vendor_team_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    vendor_id UUID NOT NULL REFERENCES vendors(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'catalog_manager', 'fulfilment', 'finance')),
+    token_hash TEXT NOT NULL UNIQUE,
+    invited_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ
+);
+
+CREATE INDEX vendor_team_invitations_vendor_email_idx ON vendor_team_invitations (vendor_id, (lower(email)));
+
+ALTER TABLE mfa_role_policies
+    DROP CONSTRAINT mfa_role_policies_role_check,
+    ADD CONSTRAINT mfa_role_policies_role_check CHECK (role IN (
+        'buyer', 'vendor_owner', 'vendor_catalog_manager', 'vendor_fulfilment', 'vendor_finance',
+        'super_admin', 'support', 'finance', 'catalog_moderator'
+    ));
@@ -0,0 +1,18 @@
+DELETE FROM mfa_role_policies WHERE role IN (SELECT name FROM roles WHERE NOT built_in);
+ALTER TABLE mfa_role_policies
+    DROP CONSTRAINT mfa_role_policies_role_fkey,
+    ADD CONSTRAINT mfa_role_policies_role_check CHECK (role IN (
+        'buyer', 'vendor_owner', 'vendor_catalog_manager', 'vendor_fulfilment', 'vendor_finance',
+        'super_admin', 'support', 'finance', 'catalog_moderator'
+    ));
+
+DROP INDEX IF EXISTS admin_roles_role_idx;
+DELETE FROM admin_roles WHERE role NOT IN ('super_admin', 'support', 'finance', 'catalog_moderator');
+ALTER TABLE admin_roles
+    DROP CONSTRAINT admin_roles_role_fkey,
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS assigned_by,
+    ADD CONSTRAINT admin_roles_role_check CHECK (role IN ('super_admin', 'support', 'finance', 'catalog_moderator'));
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
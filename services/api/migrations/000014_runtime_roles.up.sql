@@ -0,0 +1,40 @@
+-- Roles are defined at runtime. Built-in roles are seeded and keep their
+-- permissions in code; custom roles list theirs in role_permissions. Staff
+-- role assignments and the MFA policy reference the role table instead of a
+-- fixed list.
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY CHECK (name ~ '^[a-z][a-z0-9_]{2,47}$'),
+    description TEXT NOT NULL DEFAULT '',
+    built_in BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO roles (name, built_in) VALUES
+    ('buyer', TRUE),
+    ('vendor_owner', TRUE),
+    ('vendor_catalog_manager', TRUE),
+    ('vendor_fulfilment', TRUE),
+    ('vendor_finance', TRUE),
+    ('support', TRUE),
+    ('finance', TRUE),
+    ('catalog_moderator', TRUE),
+    ('super_admin', TRUE);
+
+CREATE TABLE role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL CHECK (permission <> 'manage_roles'),
+    PRIMARY KEY (role, permission)
+);
+
+ALTER TABLE admin_roles
+    DROP CONSTRAINT admin_roles_role_check,
+    ADD CONSTRAINT admin_roles_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON DELETE RESTRICT,
+    ADD COLUMN assigned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX admin_roles_role_idx ON admin_roles (role);
+
+ALTER TABLE mfa_role_policies
+    DROP CONSTRAINT mfa_role_policies_role_check,
+    ADD CONSTRAINT mfa_role_policies_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE;
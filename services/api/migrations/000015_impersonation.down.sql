@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS audit_logs_impersonation_idx;
+
+ALTER TABLE audit_logs
+    DROP COLUMN IF EXISTS on_behalf_of,
+    DROP COLUMN IF EXISTS impersonation_id;
+
+DROP TABLE IF EXISTS impersonations;
@@ -0,0 +1,25 @@
+-- Support staff can view the marketplace as a buyer or vendor. Each
+-- impersonation records who started it and why; its token is read-only
+-- unless elevated. Audit entries written under an impersonation name the
+-- staff member as the actor and the impersonated user alongside.
+CREATE TABLE impersonations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    impersonator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    impersonator_role TEXT NOT NULL REFERENCES roles(name) ON DELETE RESTRICT,
+    subject_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL CHECK (char_length(reason) BETWEEN 1 AND 500),
+    elevated BOOLEAN NOT NULL DEFAULT FALSE,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ,
+    CHECK (impersonator_id <> subject_id)
+);
+
+CREATE INDEX impersonations_active_idx ON impersonations (expires_at) WHERE ended_at IS NULL;
+CREATE INDEX impersonations_subject_idx ON impersonations (subject_id, started_at DESC);
+
+ALTER TABLE audit_logs
+    ADD COLUMN impersonation_id UUID REFERENCES impersonations(id) ON DELETE SET NULL,
+    ADD COLUMN on_behalf_of UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX audit_logs_impersonation_idx ON audit_logs (impersonation_id, created_at DESC) WHERE impersonation_id IS NOT NULL;